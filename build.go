@@ -0,0 +1,448 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains the invocation of the C compiler.
+//
+// A program importing modules is compiled module by module: the units are
+// written to a build cache next to the program, each is compiled into an
+// object file and the objects are linked. A unit is only compiled again when
+// its source, one of the module headers or the C flags changed since its
+// object was built, and files are only rewritten when their content changes,
+// so an edit to a single module only recompiles that module and the units
+// whose declarations it changed.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+
+	"scar/buildlog"
+	"scar/lexer"
+	"scar/logging"
+	"scar/manifest"
+	"scar/preprocessor"
+	"scar/renderer"
+)
+
+// The directory of the build cache, relative to the program.
+const cacheDirName = ".scar-cache"
+
+// The C compiler chosen with -cc or the CC environment variable, possibly
+// followed by flags of its own, and the flags passed to it on top of those of
+// the toolchain, such as the cflags and ldflags of a project.
+var (
+	selectedCC                string
+	extraCFlags, extraLDFlags []string
+)
+
+// The libraries the standard modules need linking against, by module.
+var stdModuleLibraries = map[string][]string{
+	"math": {"-lm"},
+}
+
+// The libraries the standard modules need linking against on Windows only.
+var stdModuleWindowsLibraries = map[string][]string{
+	"http": {"-lws2_32"},
+	"net":  {"-lws2_32"},
+}
+
+// Returns the flags linking a library given to -link, which is either a flag
+// such as -lfoo or the name of the library.
+func linkFlags(library string) []string {
+	flags := strings.Fields(library)
+	for i, flag := range flags {
+		if !strings.HasPrefix(flag, "-") && !strings.ContainsAny(flag, "./\\") {
+			flags[i] = "-l" + flag
+		}
+	}
+	return flags
+}
+
+// Adds the libraries of the standard modules a program loaded to the flags
+// the C compiler links with.
+func linkStdModuleLibraries() {
+	for _, module := range lexer.SortedModules() {
+		if module.Std {
+			extraLDFlags = append(extraLDFlags, stdModuleLibraries[module.Name]...)
+			if targetOS() == "windows" {
+				extraLDFlags = append(extraLDFlags, stdModuleWindowsLibraries[module.Name]...)
+			}
+		}
+	}
+}
+
+// The platform programs are built for, as os/arch, when -target asks for one
+// other than the host.
+var targetPlatform string
+
+// The clang target triples of the platforms -target accepts.
+var targetTriples = map[string]string{
+	"linux/amd64":   "x86_64-linux-gnu",
+	"linux/arm64":   "aarch64-linux-gnu",
+	"windows/amd64": "x86_64-w64-windows-gnu",
+	"darwin/amd64":  "x86_64-apple-darwin",
+	"darwin/arm64":  "arm64-apple-darwin",
+}
+
+// Sets the platform programs are built for.
+func setTarget(target string) error {
+	if _, ok := targetTriples[target]; !ok {
+		platforms := slices.Sorted(maps.Keys(targetTriples))
+		return fmt.Errorf("unknown target '%s', expected one of %s", target, strings.Join(platforms, ", "))
+	}
+	if target != runtime.GOOS+"/"+runtime.GOARCH {
+		targetPlatform = target
+	}
+	return nil
+}
+
+// Returns the operating system programs are built for.
+func targetOS() string {
+	if targetPlatform == "" {
+		return runtime.GOOS
+	}
+	goos, _, _ := strings.Cut(targetPlatform, "/")
+	return goos
+}
+
+// Returns the file name of a binary on the platform programs are built for.
+func binaryName(path string) string {
+	if targetOS() == "windows" {
+		return path + ".exe"
+	}
+	return path
+}
+
+// Reads the manifest of the project in dir for scar build, adding the
+// directories of its dependencies to those modules are looked up in and its
+// flags to those the C compiler is invoked with.
+func loadProject(dir string) (*manifest.Manifest, error) {
+	project, err := manifest.Load(dir)
+	if err != nil {
+		return nil, err
+	}
+	lexer.ModuleSearchDirs = append(lexer.ModuleSearchDirs, project.DependencyDirs()...)
+	extraCFlags = append(extraCFlags, project.CFlags...)
+	extraLDFlags = append(extraLDFlags, project.LDFlags...)
+	return project, nil
+}
+
+// Returns the C compiler together with the flags it compiles and links
+// programs with. Cross-compiling takes clang, which is told the target triple.
+func toolchain() (cc string, cflags, ldflags []string, err error) {
+	cc, cflags, ldflags = platformToolchain(targetOS())
+	if openMP {
+		ompCFlags, ompLDFlags := openMPFlags(targetOS())
+		cflags, ldflags = append(cflags, ompCFlags...), append(ldflags, ompLDFlags...)
+	}
+	if targetPlatform != "" {
+		if !strings.HasSuffix(cc, "clang") {
+			cc = "clang"
+		}
+		cflags = append([]string{"--target=" + targetTriples[targetPlatform]}, cflags...)
+		ldflags = append([]string{"--target=" + targetTriples[targetPlatform]}, ldflags...)
+	}
+	if selectedCC != "" {
+		fields := strings.Fields(selectedCC)
+		cc, cflags = fields[0], append(fields[1:], cflags...)
+	}
+	if cc, err = findCompiler(cc, selectedCC != "" || targetPlatform != ""); err != nil {
+		return "", nil, nil, err
+	}
+	return cc, append(cflags, extraCFlags...), append(ldflags, extraLDFlags...), nil
+}
+
+// Returns the flags selecting the optimization level and debug information of
+// the C compiler. A release build is optimized with -O2 unless a level is
+// given and leaves out the assertions of the C runtime.
+func optimizationFlags(level string, debug, release bool) []string {
+	var flags []string
+	if level == "" && release {
+		level = "2"
+	}
+	if level != "" {
+		flags = append(flags, "-O"+level)
+	}
+	if release {
+		flags = append(flags, "-DNDEBUG")
+	}
+	if debug {
+		flags = append(flags, "-g")
+	}
+	return flags
+}
+
+// Looks a C compiler up on the PATH. When the default compiler of the
+// platform is missing, the first of clang, gcc and cc found is used instead,
+// while a compiler that was asked for has to exist.
+func findCompiler(cc string, chosen bool) (string, error) {
+	if path, err := exec.LookPath(cc); err == nil {
+		return path, nil
+	}
+	if chosen {
+		return "", fmt.Errorf("C compiler '%s' not found", cc)
+	}
+	for _, fallback := range []string{"clang", "gcc", "cc"} {
+		if path, err := exec.LookPath(fallback); err == nil {
+			return path, nil
+		}
+	}
+	return "", errors.New("no C compiler found: install clang or gcc, or choose one with -cc or the CC environment variable")
+}
+
+// Returns the default C compiler together with the flags it compiles and
+// links programs with on a platform. Windows binaries are linked statically,
+// since the OpenMP runtime is rarely installed where they are run.
+func platformToolchain(goos string) (cc string, cflags, ldflags []string) {
+	switch goos {
+	case "darwin":
+		return "/opt/homebrew/opt/llvm/bin/clang", []string{"-w"}, nil
+	case "linux":
+		return "clang", nil, nil
+	case "windows":
+		return "gcc", []string{"-w"}, []string{"-static"}
+	}
+	return "clang", []string{"-w"}, nil
+}
+
+// Returns the flags compiling and linking OpenMP programs on a platform.
+func openMPFlags(goos string) (cflags, ldflags []string) {
+	if goos == "darwin" {
+		return []string{"-fopenmp", "-I/opt/homebrew/opt/libomp/include"},
+			[]string{"-fopenmp", "-L/opt/homebrew/opt/libomp/lib"}
+	}
+	return []string{"-fopenmp"}, []string{"-fopenmp"}
+}
+
+// Whether programs are compiled and linked with OpenMP, which is only the
+// case for those with parallel constructs unless --no-openmp is given.
+var openMP bool
+
+// Reports whether C code has parallel constructs, which need OpenMP. The
+// functions of the OpenMP runtime alone do not, as the preprocessor defines
+// them for programs compiled without it.
+func usesOpenMP(cCode string) bool {
+	return strings.Contains(cCode, "#pragma omp")
+}
+
+// Runs the C compiler, reporting the warnings and errors it prints as build
+// events.
+func runCompiler(events *buildlog.Logger, cc string, args []string) error {
+	events.Emit("cc_invoked", map[string]any{"compiler": cc, "args": args})
+	logging.Verbosef("%s %s", cc, strings.Join(args, " "))
+
+	var ccOutput strings.Builder
+	cmd := exec.Command(cc, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if events.Enabled() {
+		cmd.Stderr = io.MultiWriter(os.Stderr, &ccOutput)
+	}
+	err := cmd.Run()
+
+	for line := range strings.SplitSeq(ccOutput.String(), "\n") {
+		if strings.Contains(line, "warning:") {
+			events.Emit("warning", map[string]any{"phase": "cc", "message": strings.TrimSpace(line)})
+		} else if strings.Contains(line, "error:") {
+			events.Emit("error", map[string]any{"phase": "cc", "message": strings.TrimSpace(line)})
+		}
+	}
+	if err != nil {
+		events.Emit("error", map[string]any{"phase": "cc", "message": err.Error()})
+	}
+	return err
+}
+
+// Returns where -c writes the C code of a program to, which is the path given
+// by -o or a file named after the program in the directory given by -outdir.
+// The code is printed when neither is given.
+func cOutputPath(output, outDir, name string) string {
+	if output != "" {
+		return output
+	}
+	if outDir != "" {
+		return filepath.Join(outDir, name+".c")
+	}
+	return ""
+}
+
+// Writes a file, creating the directories it is in.
+func writeFile(path, content string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(content), 0o644)
+}
+
+// Writes a file unless it already holds the given content, so its
+// modification time only changes with its content.
+func writeIfChanged(path, content string) (bool, error) {
+	if existing, err := os.ReadFile(path); err == nil && bytes.Equal(existing, []byte(content)) {
+		return false, nil
+	}
+	return true, os.WriteFile(path, []byte(content), 0o644)
+}
+
+// Reports whether a file exists and is newer than all of its inputs.
+func upToDate(target string, inputs ...string) bool {
+	info, err := os.Stat(target)
+	if err != nil {
+		return false
+	}
+	for _, input := range inputs {
+		inputInfo, err := os.Stat(input)
+		if err != nil || inputInfo.ModTime().After(info.ModTime()) {
+			return false
+		}
+	}
+	return true
+}
+
+// Compiles the units of a program in the cache directory and links them into
+// the output binary, with OpenMP unless noOpenMP is set. Returns the C code of
+// all units, joined.
+func buildUnits(events *buildlog.Logger, units []renderer.Unit, cacheDir, name, outputBinary string, noOpenMP bool) (string, error) {
+	if err := os.MkdirAll(cacheDir, 0o755); err != nil {
+		return "", err
+	}
+
+	codes := make([]string, len(units))
+	for i, unit := range units {
+		codes[i] = preprocessor.InsertMacros(unit.Source)
+		openMP = openMP || (!noOpenMP && usesOpenMP(codes[i]))
+	}
+
+	// The flags are recorded like a header, so changing them rebuilds every
+	// unit.
+	cc, cflags, ldflags, err := toolchain()
+	if err != nil {
+		return "", err
+	}
+	flagsFile := filepath.Join(cacheDir, "cflags")
+	if _, err := writeIfChanged(flagsFile, cc+" "+strings.Join(cflags, " ")+"\n"); err != nil {
+		return "", err
+	}
+	headers := []string{flagsFile}
+	for _, unit := range units {
+		if unit.Module == "" {
+			continue
+		}
+		header := filepath.Join(cacheDir, renderer.HeaderName(unit.Module))
+		if _, err := writeIfChanged(header, unit.Header); err != nil {
+			return "", err
+		}
+		headers = append(headers, header)
+	}
+
+	var (
+		objects []string
+		cCode   strings.Builder
+	)
+	for i, unit := range units {
+		base := unit.Module
+		if base == "" {
+			base = name + ".main"
+		}
+		var (
+			source = filepath.Join(cacheDir, base+".c")
+			object = filepath.Join(cacheDir, base+".o")
+			code   = codes[i]
+		)
+		cCode.WriteString(code)
+		objects = append(objects, object)
+
+		changed, err := writeIfChanged(source, code)
+		if err != nil {
+			return "", err
+		}
+		if changed {
+			events.Emit("file_generated", map[string]any{"path": source, "bytes": len(code)})
+		}
+		if upToDate(object, append([]string{source}, headers...)...) {
+			events.Emit("unit_cached", map[string]any{"unit": base, "object": object})
+			logging.Verbosef("%s is up to date", object)
+			continue
+		}
+		args := append(append([]string{"-c"}, cflags...), source, "-o", object)
+		if err := runCompiler(events, cc, args); err != nil {
+			os.Remove(object)
+			return "", err
+		}
+	}
+
+	args := append(append(objects, ldflags...), "-o", outputBinary)
+	return cCode.String(), runCompiler(events, cc, args)
+}
+
+// Returns the file name of a library of the given kind, static or shared,
+// on the platform programs are built for.
+func libraryFileName(name, kind string) string {
+	switch {
+	case kind == "static" && targetOS() == "windows":
+		return name + ".lib"
+	case kind == "static":
+		return "lib" + name + ".a"
+	case targetOS() == "windows":
+		return name + ".dll"
+	case targetOS() == "darwin":
+		return "lib" + name + ".dylib"
+	}
+	return "lib" + name + ".so"
+}
+
+// Compiles the C code in cPath into a static library, archived with ar, or
+// into a shared library.
+func buildLibrary(events *buildlog.Logger, cPath, kind, output string) error {
+	cc, cflags, ldflags, err := toolchain()
+	if err != nil {
+		return err
+	}
+	if kind == "shared" {
+		args := append(append(append([]string{"-shared", "-fPIC"}, cflags...), cPath), ldflags...)
+		return runCompiler(events, cc, append(args, "-o", output))
+	}
+	object := strings.TrimSuffix(cPath, ".c") + ".o"
+	defer os.Remove(object)
+	if err := runCompiler(events, cc, append(append([]string{"-c"}, cflags...), cPath, "-o", object)); err != nil {
+		return err
+	}
+	os.Remove(output)
+	logging.Verbosef("ar rcs %s %s", output, object)
+	cmd := exec.Command("ar", "rcs", output, object)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// Runs a compiled program with the given arguments and the standard streams
+// of the compiler, returning the exit code it exited with.
+func runBinary(binary string, args []string) int {
+	cmd := exec.Command(binary, args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if code := exitErr.ExitCode(); code >= 0 {
+			return code
+		}
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to run %s: %v\n", binary, err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"scar/lexer"
+)
+
+func TestIncrementalBuildFiles(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "geo.c")
+	object := filepath.Join(dir, "geo.o")
+
+	if changed, err := writeIfChanged(source, "int x;\n"); err != nil || !changed {
+		t.Fatalf("expected a new file to be written, got %v %v", changed, err)
+	}
+	if upToDate(object, source) {
+		t.Error("expected a missing object to be out of date")
+	}
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(source, old, old)
+	if err := os.WriteFile(object, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	built := time.Now().Add(-time.Minute)
+	os.Chtimes(object, built, built)
+	if !upToDate(object, source) {
+		t.Error("expected an object newer than its source to be up to date")
+	}
+	if changed, _ := writeIfChanged(source, "int x;\n"); changed || !upToDate(object, source) {
+		t.Error("expected writing the same content to leave the source untouched")
+	}
+	if changed, _ := writeIfChanged(source, "int y;\n"); !changed || upToDate(object, source) {
+		t.Error("expected a changed source to make the object out of date")
+	}
+}
+
+func TestRunBinaryExitCode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a POSIX shell")
+	}
+	if code := runBinary("sh", []string{"-c", "exit 4"}); code != 4 {
+		t.Errorf("expected exit code 4, got %d", code)
+	}
+	if code := runBinary("sh", []string{"-c", "true"}); code != 0 {
+		t.Errorf("expected exit code 0, got %d", code)
+	}
+}
+
+func TestCOutputPath(t *testing.T) {
+	tests := []struct{ output, outDir, expected string }{
+		{"", "", ""},
+		{"gen/prog.c", "", "gen/prog.c"},
+		{"", "gen", filepath.Join("gen", "prog.c")},
+		{"a.c", "gen", "a.c"},
+	}
+	for _, test := range tests {
+		if got := cOutputPath(test.output, test.outDir, "prog"); got != test.expected {
+			t.Errorf("cOutputPath(%q, %q) = %q, expected %q", test.output, test.outDir, got, test.expected)
+		}
+	}
+}
+
+func TestFindCompiler(t *testing.T) {
+	if _, err := findCompiler("scar-no-such-cc", true); err == nil || err.Error() != "C compiler 'scar-no-such-cc' not found" {
+		t.Errorf("expected a missing chosen compiler to fail, got %v", err)
+	}
+	t.Setenv("PATH", t.TempDir())
+	if _, err := findCompiler("clang", false); err == nil || !strings.Contains(err.Error(), "no C compiler found") {
+		t.Errorf("expected no compiler to be found, got %v", err)
+	}
+}
+
+func TestSetTarget(t *testing.T) {
+	defer func() { targetPlatform = "" }()
+	if err := setTarget("plan9/386"); err == nil {
+		t.Error("expected an unknown target to fail")
+	}
+	if err := setTarget(runtime.GOOS + "/" + runtime.GOARCH); err == nil && targetPlatform != "" {
+		t.Errorf("expected the host platform not to be a cross target, got %q", targetPlatform)
+	}
+	target := "windows/amd64"
+	if runtime.GOOS == "windows" {
+		target = "linux/arm64"
+	}
+	if err := setTarget(target); err != nil {
+		t.Fatal(err)
+	}
+	if name := binaryName("out"); (target == "windows/amd64") != (name == "out.exe") {
+		t.Errorf("unexpected binary name %q for %s", name, target)
+	}
+}
+
+func TestLinkStdModuleLibraries(t *testing.T) {
+	defer func() {
+		extraLDFlags = nil
+		lexer.LoadedModules = make(map[string]*lexer.ModuleInfo)
+	}()
+	lexer.LoadedModules = map[string]*lexer.ModuleInfo{
+		"math":  {Name: "math", Std: true},
+		"shape": {Name: "shape"},
+	}
+	linkStdModuleLibraries()
+	if flags := strings.Join(extraLDFlags, " "); flags != "-lm" {
+		t.Errorf("expected std/math to link -lm, got %q", flags)
+	}
+
+	extraLDFlags = nil
+	lexer.LoadedModules = map[string]*lexer.ModuleInfo{"math": {Name: "math"}}
+	linkStdModuleLibraries()
+	if len(extraLDFlags) > 0 {
+		t.Errorf("expected a module of the program named math to link nothing, got %q", extraLDFlags)
+	}
+
+	defer func() { targetPlatform = "" }()
+	extraLDFlags = nil
+	lexer.LoadedModules = map[string]*lexer.ModuleInfo{"net": {Name: "net", Std: true}}
+	linkStdModuleLibraries()
+	if len(extraLDFlags) > 0 {
+		t.Errorf("expected std/net to link nothing on %s, got %q", targetOS(), extraLDFlags)
+	}
+	targetPlatform = "windows/amd64"
+	linkStdModuleLibraries()
+	if flags := strings.Join(extraLDFlags, " "); flags != "-lws2_32" {
+		t.Errorf("expected std/net to link -lws2_32 on windows, got %q", flags)
+	}
+}
+
+func TestOpenMPToolchain(t *testing.T) {
+	if _, err := findCompiler("cc", false); err != nil {
+		t.Skip(err)
+	}
+	defer func() { openMP = false }()
+	for _, enabled := range []bool{false, true} {
+		openMP = enabled
+		_, cflags, ldflags, err := toolchain()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if slices.Contains(cflags, "-fopenmp") != enabled || slices.Contains(ldflags, "-fopenmp") != enabled {
+			t.Errorf("expected OpenMP flags only when OpenMP is used (%v), got %q and %q", enabled, cflags, ldflags)
+		}
+	}
+	if usesOpenMP("int x = omp_get_thread_num();") || !usesOpenMP("#pragma omp parallel for\nfor (;;) {}") {
+		t.Error("expected only parallel constructs to need OpenMP")
+	}
+}
+
+func TestLinkFlags(t *testing.T) {
+	for library, expected := range map[string]string{
+		"-lfoo":          "-lfoo",
+		"foo":            "-lfoo",
+		"foo bar":        "-lfoo -lbar",
+		"-L/opt/lib -lz": "-L/opt/lib -lz",
+		"libfoo.a":       "libfoo.a",
+	} {
+		if flags := strings.Join(linkFlags(library), " "); flags != expected {
+			t.Errorf("linkFlags(%q) = %q, expected %q", library, flags, expected)
+		}
+	}
+}
+
+func TestLibraryFileName(t *testing.T) {
+	defer func() { targetPlatform = "" }()
+	tests := []struct {
+		target, kind, expected string
+	}{
+		{"linux/amd64", "static", "libgeo.a"},
+		{"linux/amd64", "shared", "libgeo.so"},
+		{"darwin/arm64", "shared", "libgeo.dylib"},
+		{"windows/amd64", "static", "geo.lib"},
+		{"windows/amd64", "shared", "geo.dll"},
+	}
+	for _, test := range tests {
+		targetPlatform = test.target
+		if name := libraryFileName("geo", test.kind); name != test.expected {
+			t.Errorf("libraryFileName(%q, %q) on %s = %q, expected %q", "geo", test.kind, test.target, name, test.expected)
+		}
+	}
+}
+
+func TestOptimizationFlags(t *testing.T) {
+	tests := []struct {
+		level          string
+		debug, release bool
+		expected       string
+	}{
+		{"", false, false, ""},
+		{"3", true, false, "-O3 -g"},
+		{"", false, true, "-O2 -DNDEBUG"},
+		{"s", false, true, "-Os -DNDEBUG"},
+	}
+	for _, test := range tests {
+		flags := strings.Join(optimizationFlags(test.level, test.debug, test.release), " ")
+		if flags != test.expected {
+			t.Errorf("optimizationFlags(%q, %v, %v) = %q, expected %q", test.level, test.debug, test.release, flags, test.expected)
+		}
+	}
+}
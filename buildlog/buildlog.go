@@ -0,0 +1,68 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains the machine-readable build event log for the scar compiler.
+
+package buildlog
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// Emits structured build events as JSON lines.
+// A nil or disabled logger silently discards every event.
+type Logger struct {
+	mu      sync.Mutex
+	out     io.Writer
+	start   time.Time
+	enabled bool
+}
+
+// Creates a logger for the given --log format. Only "json" enables output.
+func New(format string, out io.Writer) *Logger {
+	return &Logger{
+		out:     out,
+		start:   time.Now(),
+		enabled: format == "json",
+	}
+}
+
+// Reports whether events are being written.
+func (l *Logger) Enabled() bool {
+	return l != nil && l.enabled
+}
+
+// Writes a single event with the given fields.
+// Every event carries its name, a timestamp and the milliseconds elapsed since the build started.
+func (l *Logger) Emit(event string, fields map[string]any) {
+	if !l.Enabled() {
+		return
+	}
+	record := make(map[string]any, len(fields)+3)
+	for k, v := range fields {
+		record[k] = v
+	}
+	record["event"] = event
+	record["time"] = time.Now().UTC().Format(time.RFC3339Nano)
+	record["elapsed_ms"] = time.Since(l.start).Milliseconds()
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.out.Write(append(data, '\n'))
+}
+
+// Emits a timing event for a named build phase that began at start.
+func (l *Logger) Phase(name string, start time.Time) {
+	l.Emit("phase", map[string]any{
+		"phase":       name,
+		"duration_ms": time.Since(start).Milliseconds(),
+	})
+}
@@ -0,0 +1,39 @@
+package buildlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestEmitJSON(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New("json", &buf)
+	logger.Emit("module_loaded", map[string]any{"module": "math"})
+
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("event is not valid JSON: %v (%q)", err, buf.String())
+	}
+	if record["event"] != "module_loaded" {
+		t.Errorf("expected event 'module_loaded', got %v", record["event"])
+	}
+	if record["module"] != "math" {
+		t.Errorf("expected module 'math', got %v", record["module"])
+	}
+	if !strings.HasSuffix(buf.String(), "\n") {
+		t.Error("expected events to be newline terminated")
+	}
+}
+
+func TestDisabledLogger(t *testing.T) {
+	var buf bytes.Buffer
+	New("", &buf).Emit("cc_invoked", nil)
+	if buf.Len() != 0 {
+		t.Errorf("expected no output from disabled logger, got %q", buf.String())
+	}
+
+	var nilLogger *Logger
+	nilLogger.Emit("cc_invoked", nil)
+}
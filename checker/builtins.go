@@ -0,0 +1,279 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains the builtin functions and constants the checker treats as declared.
+
+package checker
+
+import (
+	"strings"
+
+	"scar/lexer"
+)
+
+// The type of the value bound by catch e:, with an int code and a string message.
+const exceptionClass = "Exception"
+
+var (
+	builtinFunctions = []string{
+		// Scar builtins and casts.
+		"len", "ord", "chr", "rand", "float", "double", "int", "char", "cat", "fmt",
+		"sizeof", "read", "write", "readln", "args", "argc", "input", "read_int", "read_float",
+		"to_int", "to_float", "to_string", "ulen", "panic",
+		// C library functions commonly called from scar code.
+		"printf", "sprintf", "snprintf", "fprintf", "puts", "putchar", "getchar", "fopen", "fclose",
+		"fgets", "fputs", "fread", "fwrite", "fflush",
+		"strlen", "strcpy", "strncpy", "strcat", "strncat", "strcmp", "strncmp", "strchr", "strrchr",
+		"strstr", "strdup", "strtok", "memcpy", "memset", "memcmp", "memmove",
+		"malloc", "calloc", "realloc", "free", "exit", "abort", "atoi", "atof", "atol", "strtol", "strtod",
+		"abs", "labs", "getenv", "system", "qsort", "srand", "time", "clock", "usleep", "sleep",
+		"toupper", "tolower", "isdigit", "isalpha", "isalnum", "isspace", "isupper", "islower",
+		"sqrt", "pow", "sin", "cos", "tan", "asin", "acos", "atan", "atan2", "exp", "log", "log10",
+		"floor", "ceil", "round", "fabs", "fmod",
+		"omp_get_thread_num", "omp_get_num_threads", "set_threads",
+	}
+	builtinConstants = []string{
+		"stdin", "stdout", "stderr", "EOF", "RAND_MAX", "INT_MAX", "INT_MIN", "M_PI", "M_E",
+		"__global_argc", "__global_argv",
+	}
+	builtinReturnTypes = map[string]string{
+		"len": "int", "argc": "int", "args": "list[string]", "input": "string", "read_int": "int", "read_float": "float", "ord": "int", "rand": "int",
+		"float": "float", "double": "double", "int": "int", "char": "char", "chr": "char",
+		"cat": "string", "fmt": "string", "cat!": "string", "fmt!": "string",
+		"to_int": "int", "to_float": "float", "to_string": "string", "format!": "string", "ulen": "int",
+		"has!": "bool", "del!": "bool", "contains!": "bool", "maplen!": "int", "index_of!": "int",
+	}
+)
+
+// Checks ord(c), which takes a char, and chr(n), which takes an integer code.
+func (c *Checker) checkCharBuiltin(name string, args []string, line int) {
+	if len(args) != 1 {
+		c.errorf(line, "%s() takes exactly 1 argument, got %d", name, len(args))
+		return
+	}
+	want := "char"
+	if name == "chr" {
+		want = "int"
+	}
+	if typ := c.inferType(args[0]); typ != "" && !isNumeric(normalizeType(typ)) {
+		c.errorf(line, "%s() expects %s, got %s", name, want, typ)
+	}
+}
+
+// Checks to_int(s), to_float(s) and ulen(s), which take a string, and
+// to_string(x), which takes a number, char, bool or string.
+func (c *Checker) checkConversion(name string, args []string, line int) {
+	if len(args) != 1 {
+		c.errorf(line, "%s() takes exactly 1 argument, got %d", name, len(args))
+		return
+	}
+	typ := c.inferType(args[0])
+	if typ == "" {
+		return
+	}
+	switch t := normalizeType(typ); {
+	case name != "to_string" && !isString(t):
+		c.errorf(line, "%s() expects string, got %s", name, typ)
+	case name == "to_string" && !isNumeric(t) && !isString(t):
+		c.errorf(line, "to_string() expects a number, char, bool or string, got %s", typ)
+	}
+}
+
+// Checks format!(f, args), whose arguments have to match the conversions of
+// a literal format f: %s takes a string, and the numeric conversions a
+// number, char or bool. A * width or precision takes an integer of its own.
+func (c *Checker) checkFormat(args []string, line int) {
+	if len(args) == 0 {
+		c.errorf(line, "format! takes a format and its values, got no arguments")
+		return
+	}
+	format := args[0]
+	expr, _ := lexer.ParseExpr(format)
+	if literal, ok := expr.(*lexer.LiteralExpr); !ok || literal.Kind != lexer.StringLiteral {
+		if typ := c.inferType(format); typ != "" && !isString(normalizeType(typ)) {
+			c.errorf(line, "format! expects a string format, got %s", typ)
+		}
+		return
+	}
+	var wants []string
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+		for i++; i < len(format) && strings.ContainsRune("-+ #0123456789.*hlLzjt", rune(format[i])); i++ {
+			if format[i] == '*' {
+				wants = append(wants, "d")
+			}
+		}
+		if i < len(format) && format[i] != '%' {
+			wants = append(wants, string(format[i]))
+		}
+	}
+	values := args[1:]
+	if len(values) != len(wants) {
+		c.errorf(line, "format! expects %d values for %s, got %d", len(wants), format, len(values))
+		return
+	}
+	for i, want := range wants {
+		typ := c.inferType(values[i])
+		if typ == "" {
+			continue
+		}
+		switch t := normalizeType(typ); {
+		case want == "s" && !isString(t):
+			c.errorf(line, "format! expects a string for %%%s, got %s", want, typ)
+		case strings.Contains("diouxXcfFeEgGaA", want) && !isNumeric(t):
+			c.errorf(line, "format! expects a number for %%%s, got %s", want, typ)
+		}
+	}
+}
+
+// Checks panic(message), which takes a string.
+func (c *Checker) checkPanic(args []string, line int) {
+	if len(args) != 1 {
+		c.errorf(line, "panic() takes exactly 1 argument, got %d", len(args))
+		return
+	}
+	if typ := c.inferType(args[0]); typ != "" && !isString(normalizeType(typ)) {
+		c.errorf(line, "panic() expects a string message, got %s", typ)
+	}
+}
+
+// Checks the declaration of a list from map!(list, f) or filter!(list, f),
+// where f is a function taking an element of the list. The function of map!
+// returns an element of the declared list and that of filter! returns a bool.
+func (c *Checker) checkListTransform(builtin string, args []string, elemType string, line int) {
+	if len(args) != 2 {
+		c.errorf(line, "%s takes a list and a function, got %d arguments", builtin, len(args))
+		return
+	}
+	c.checkExpr(args[0], line)
+	fn, ok := c.functions[args[1]]
+	if !ok {
+		if !c.isModuleSymbol(args[1]) {
+			c.errorf(line, "%s expects the name of a function, got '%s'", builtin, args[1])
+		}
+		return
+	}
+	if len(fn.params) != 1 {
+		c.errorf(line, "function '%s' given to %s must take 1 argument, not %d", fn.name, builtin, len(fn.params))
+		return
+	}
+	source := c.inferType(args[0])
+	if inner, isList := strings.CutPrefix(source, "list["); isList {
+		if inner = strings.TrimSuffix(inner, "]"); !c.compatible(paramType(fn.params[0]), inner) {
+			c.errorf(line, "function '%s' given to %s takes %s, but the elements of '%s' are %s", fn.name, builtin, paramType(fn.params[0]), args[0], inner)
+		}
+		if builtin == "filter!" && !c.compatible(elemType, inner) {
+			c.errorf(line, "filter! cannot fill a list[%s] with the elements of '%s', which are %s", elemType, args[0], inner)
+		}
+	}
+	switch {
+	case builtin == "filter!" && fn.returnType != "bool":
+		c.errorf(line, "function '%s' given to filter! must return bool, not %s", fn.name, fn.returnType)
+	case builtin == "map!" && !c.compatible(elemType, fn.returnType):
+		c.errorf(line, "function '%s' given to map! returns %s, which a list[%s] cannot hold", fn.name, fn.returnType, elemType)
+	}
+}
+
+// Splits a call of map! or filter! into the builtin and its arguments.
+func listTransform(call string) (string, []string, bool) {
+	for _, builtin := range []string{"map!", "filter!"} {
+		if args, ok := strings.CutPrefix(call, builtin+"("); ok && strings.HasSuffix(args, ")") {
+			return builtin, lexer.SplitArguments(args[:len(args)-1]), true
+		}
+	}
+	return "", nil, false
+}
+
+// Checks sort!(list) and sort!(list, f). Lists of other elements than
+// numbers, chars, bools and strings need f, a function taking two elements
+// and returning an int or a bool.
+func (c *Checker) checkSort(args []string, line int) {
+	if len(args) != 1 && len(args) != 2 {
+		c.errorf(line, "sort! takes a list and optionally a comparator, got %d arguments", len(args))
+		return
+	}
+	source := c.inferType(args[0])
+	if !isList(source) {
+		if source != "" {
+			c.errorf(line, "sort! expects a list, but '%s' is %s", args[0], source)
+		}
+		return
+	}
+	elemType := listElemType(source)
+	if len(args) == 1 {
+		if !isNumeric(elemType) && !isString(elemType) && elemType != "bool" {
+			c.errorf(line, "sort! cannot order the %s elements of '%s' by itself, pass it a comparator", elemType, args[0])
+		}
+		return
+	}
+	fn, ok := c.functions[args[1]]
+	switch {
+	case !ok:
+		// Undefined names are already reported as such.
+		if !c.isModuleSymbol(args[1]) && c.inferType(args[1]) != "" {
+			c.errorf(line, "sort! expects the name of a function, got '%s'", args[1])
+		}
+	case len(fn.params) != 2:
+		c.errorf(line, "function '%s' given to sort! must take 2 arguments, not %d", fn.name, len(fn.params))
+	case !c.compatible(paramType(fn.params[0]), elemType) || !c.compatible(paramType(fn.params[1]), elemType):
+		c.errorf(line, "function '%s' given to sort! must take two %s elements of '%s'", fn.name, elemType, args[0])
+	case fn.returnType != "int" && fn.returnType != "bool":
+		c.errorf(line, "function '%s' given to sort! must return int or bool, not %s", fn.name, fn.returnType)
+	}
+}
+
+// The arguments taken by the list builtins other than sort!, map! and filter!.
+var listBuiltinArity = map[string]int{
+	"contains!": 2, "index_of!": 2, "sum!": 1, "min!": 1, "max!": 1, "reverse!": 1,
+}
+
+// Checks contains!(list, value), index_of!(list, value), sum!(list),
+// min!(list), max!(list) and reverse!(list). contains! also takes a set,
+// which is left alone.
+func (c *Checker) checkListBuiltin(name string, args []string, line int) {
+	if want := listBuiltinArity[name]; len(args) != want {
+		takes := "a list"
+		if want == 2 {
+			takes = "a list and a value"
+		}
+		c.errorf(line, "%s takes %s, got %d arguments", name, takes, len(args))
+		return
+	}
+	source := c.inferType(args[0])
+	if !isList(source) {
+		if source != "" && !strings.HasPrefix(source, "set[") {
+			c.errorf(line, "%s expects a list, but '%s' is %s", name, args[0], source)
+		}
+		return
+	}
+	elemType := listElemType(source)
+	switch name {
+	case "contains!", "index_of!":
+		if !isNumeric(elemType) && !isString(elemType) {
+			c.errorf(line, "%s cannot compare the %s elements of '%s'", name, elemType, args[0])
+		} else if value := c.inferType(args[1]); !c.compatible(elemType, value) {
+			c.errorf(line, "%s looks for %s in '%s', whose elements are %s", name, value, args[0], elemType)
+		}
+	case "sum!", "min!", "max!":
+		if !isNumeric(elemType) {
+			c.errorf(line, "%s expects a list of numbers, but the elements of '%s' are %s", name, args[0], elemType)
+		}
+	case "reverse!":
+		if isList(elemType) {
+			c.errorf(line, "reverse! cannot reverse '%s', a list of lists", args[0])
+		}
+	}
+}
+
+// Returns the type of sum!(list), min!(list) and max!(list), which is the
+// element type of the list.
+func (c *Checker) listBuiltinType(name string, args []string) (string, bool) {
+	if (name != "sum!" && name != "min!" && name != "max!") || len(args) != 1 {
+		return "", false
+	}
+	source := c.inferType(args[0])
+	return listElemType(source), isList(source)
+}
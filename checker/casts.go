@@ -0,0 +1,110 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains the checking of casts such as x as f64.
+//
+// Numbers, chars and bools may be cast to each other, widening or narrowing
+// them, and enums to and from the integer types. Strings are converted with
+// to_int, to_float and to_string instead.
+
+package checker
+
+import "slices"
+
+// Returns the index of the token opening the bracket closed at end, or -1.
+func matchingOpen(tokens []token, end int) int {
+	var (
+		close = tokens[end].text
+		open  = map[string]string{")": "(", "]": "[", "}": "{"}[close]
+		depth = 0
+	)
+	for i := end; i >= 0; i-- {
+		if tokens[i].kind != tokOp {
+			continue
+		}
+		switch tokens[i].text {
+		case close:
+			depth++
+		case open:
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// Returns the index of the first token of the value cast by the as at index
+// at, which is the postfix chain before it along with its unary operators.
+func castOperandStart(tokens []token, at int) int {
+	start := at
+	for i := at - 1; i >= 0; {
+		tok := tokens[i]
+		if tok.kind == tokOp && (tok.text == ")" || tok.text == "]") {
+			if i = matchingOpen(tokens, i); i == -1 {
+				return start
+			}
+			start = i
+			if i > 0 && (tokens[i-1].kind != tokOp || tokens[i-1].text == ")" || tokens[i-1].text == "]") {
+				// The brackets call or index the value before them.
+				i--
+				continue
+			}
+		} else if tok.kind != tokOp {
+			start = i
+		} else {
+			break
+		}
+		if i < 2 || (tokens[i-1].text != "." && tokens[i-1].text != "->") {
+			break
+		}
+		i -= 2
+	}
+	for start > 0 && slices.Contains([]string{"-", "+", "!", "~"}, tokens[start-1].text) {
+		if start > 1 && (tokens[start-2].kind != tokOp || tokens[start-2].text == ")" || tokens[start-2].text == "]") {
+			// The operator is binary.
+			break
+		}
+		start--
+	}
+	return start
+}
+
+// Reports whether the tokens are a value cast to a type, returning the type.
+func castType(tokens []token) (string, bool) {
+	n := len(tokens)
+	if n < 3 || tokens[n-2].kind != tokIdent || tokens[n-2].text != "as" || tokens[n-1].kind != tokIdent {
+		return "", false
+	}
+	return tokens[n-1].text, castOperandStart(tokens, n-2) == 0
+}
+
+// Checks the cast made by the as at index at.
+func (c *Checker) checkCastAt(tokens []token, at, line int) {
+	from := c.inferTokens(tokens[castOperandStart(tokens, at):at])
+	c.checkCast(normalizeType(from), tokens[at+1].text, line)
+}
+
+// Checks a cast of a value of type from to type to.
+func (c *Checker) checkCast(from, to string, line int) {
+	integer := func(t string) bool {
+		return isNumeric(t) && !slices.Contains(floatTypes, t) && t != "bool"
+	}
+	switch {
+	case isString(to):
+		c.errorf(line, "cannot cast to %s, use to_string instead", to)
+	case !isNumeric(to) && !c.enums[to]:
+		c.errorf(line, "cannot cast to %s, which is not a number or enum type", to)
+	case from == "" || from == to:
+	case isString(from):
+		c.errorf(line, "cannot cast %s to %s, use to_int or to_float instead", from, to)
+	case c.enums[to] && !integer(from):
+		c.errorf(line, "cannot cast %s to enum %s, only integers can be", from, to)
+	case c.enums[from] && !integer(to):
+		c.errorf(line, "cannot cast enum %s to %s, only to integer types", from, to)
+	case !c.enums[from] && !isNumeric(from):
+		c.errorf(line, "cannot cast %s to %s", from, to)
+	}
+}
@@ -0,0 +1,1374 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains the semantic analysis pass run between parsing and code generation.
+// The checker builds symbol tables for classes, functions and variables, then
+// reports type mismatches, undefined identifiers and wrong-arity calls against
+// scar source lines before any C is emitted.
+
+package checker
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"path"
+	"scar/diagnostics"
+	"scar/lexer"
+	"slices"
+	"strings"
+)
+
+type funcInfo struct {
+	name       string
+	params     []*lexer.MethodParameter
+	returnType string
+}
+
+type classInfo struct {
+	name        string
+	base        string
+	interfaces  []string
+	fields      map[string]string
+	methods     map[string]*funcInfo
+	ctor        []*lexer.MethodParameter
+	hasCtor     bool
+	isInterface bool
+	isStruct    bool
+}
+
+// Returns the kind of declaration a class entry comes from, for messages.
+func (info *classInfo) kind() string {
+	if info.isStruct {
+		return "struct"
+	}
+	return "class"
+}
+
+type loopInfo struct {
+	label    string
+	parallel bool
+}
+
+type scope struct {
+	vars     map[string]string
+	narrowed map[string]string
+	parent   *scope
+}
+
+type Checker struct {
+	classes   map[string]*classInfo
+	functions map[string]*funcInfo
+	enums     map[string]bool
+	members   map[string]string
+	modules   map[string]bool
+	consts    map[string]*lexer.ConstDeclStmt
+	globals   *scope
+	scope     *scope
+	class     *classInfo
+	fn        *funcInfo
+	loops     []loopInfo
+	blocks    map[string]int
+	lenient   bool
+	errors    []error
+	seen      map[string]bool
+}
+
+// Creates a new checker with empty symbol tables.
+func New() *Checker {
+	globals := &scope{vars: make(map[string]string), narrowed: make(map[string]string)}
+	return &Checker{
+		classes: map[string]*classInfo{
+			exceptionClass: {
+				name:    exceptionClass,
+				fields:  map[string]string{"code": "int", "message": "string"},
+				methods: make(map[string]*funcInfo),
+			},
+		},
+		functions: make(map[string]*funcInfo),
+		enums:     make(map[string]bool),
+		members:   make(map[string]string),
+		modules:   make(map[string]bool),
+		consts:    make(map[string]*lexer.ConstDeclStmt),
+		blocks:    make(map[string]int),
+		globals:   globals,
+		scope:     globals,
+		seen:      make(map[string]bool),
+	}
+}
+
+// Runs semantic analysis over a parsed program.
+func Check(program *lexer.Program) []error {
+	return New().Check(program)
+}
+
+// Builds the symbol tables for the program and checks every statement.
+func (c *Checker) Check(program *lexer.Program) []error {
+	c.registerModules(program)
+	c.checkDefinitions(program.Statements)
+	c.registerDeclarations(program.Statements)
+	c.resolveInheritance()
+	c.lenient = containsRawCode(program.Statements)
+
+	c.pushScope()
+	c.checkStatements(program.Statements, 0)
+	c.popScope()
+
+	return c.errors
+}
+
+func (c *Checker) errorf(line int, format string, args ...any) {
+	c.report(diagnostics.Errorf(line, format, args...))
+}
+
+// Records an error unless it was already reported.
+func (c *Checker) report(err error) {
+	if c.seen[err.Error()] {
+		return
+	}
+	c.seen[err.Error()] = true
+	c.errors = append(c.errors, err)
+}
+
+func (c *Checker) pushScope() {
+	c.scope = &scope{vars: make(map[string]string), narrowed: make(map[string]string), parent: c.scope}
+}
+
+func (c *Checker) popScope() {
+	c.scope = c.scope.parent
+}
+
+func (c *Checker) declare(name, typ string) {
+	if name == "" || strings.HasPrefix(name, "this.") {
+		return
+	}
+	c.scope.vars[name] = normalizeType(typ)
+}
+
+func (c *Checker) lookupVar(name string) (string, bool) {
+	if name == "this" && c.class != nil {
+		return c.class.name, true
+	}
+	for s := c.scope; s != nil; s = s.parent {
+		if t, ok := s.narrowed[name]; ok {
+			return t, true
+		}
+		if t, ok := s.vars[name]; ok {
+			return t, true
+		}
+	}
+	return "", false
+}
+
+// Reports whether a variable holds a std/io File, whose lines foreach can
+// iterate over.
+func (c *Checker) isFile(name string) bool {
+	typ, _ := c.lookupVar(name)
+	return normalizeType(typ) == "io_File"
+}
+
+func (c *Checker) registerModules(program *lexer.Program) {
+	for _, imp := range program.Imports {
+		c.modules[path.Base(strings.TrimPrefix(imp.Module, "std/"))] = true
+	}
+	for _, module := range lexer.LoadedModules {
+		c.modules[module.Name] = true
+		for name, v := range module.PublicVars {
+			c.globals.vars[module.Name+"_"+name] = normalizeType(v.Type)
+		}
+		for name, decl := range module.PublicConsts {
+			c.registerConst(module.Name+"_"+name, decl)
+		}
+		for name, fn := range module.PublicFuncs {
+			c.functions[module.Name+"_"+name] = &funcInfo{
+				name:       module.Name + "::" + name,
+				params:     fn.Parameters,
+				returnType: fn.ReturnType,
+			}
+		}
+		for name, class := range module.PublicClasses {
+			info := c.newClass(module.Name+"."+name, class.Constructor, class.Methods)
+			if class.Base != "" {
+				info.base = module.Name + "_" + class.Base
+			}
+			c.classes[module.Name+"_"+name] = info
+		}
+	}
+}
+
+// Reports the top-level names of the program defined more than once, and
+// those the C symbols of the loaded modules collide with. A module symbol is
+// named module_name in C, so a module can clash with the program or with
+// another module.
+func (c *Checker) checkDefinitions(statements []*lexer.Statement) {
+	for _, err := range lexer.CheckDuplicateDefinitions(statements) {
+		c.report(err)
+	}
+
+	symbols := make(map[string]string)
+	for _, module := range lexer.SortedModules() {
+		for _, def := range moduleDefinitions(module) {
+			symbol := lexer.GenerateUniqueSymbol(def.Name, module.Name)
+			what := fmt.Sprintf("%s '%s::%s'", def.Kind, module.Name, def.Name)
+			if other, exists := symbols[symbol]; exists {
+				c.errorf(0, "%s and %s are both named '%s' in C", other, what, symbol)
+				continue
+			}
+			symbols[symbol] = what
+		}
+	}
+	for _, def := range lexer.Definitions(statements) {
+		if other, exists := symbols[def.Name]; exists {
+			c.errorf(def.Line, "%s '%s' has the same name in C as %s", def.Kind, def.Name, other)
+		}
+	}
+}
+
+// Returns the public declarations of a module, sorted by name.
+func moduleDefinitions(module *lexer.ModuleInfo) []lexer.Definition {
+	var defs []lexer.Definition
+	for name := range module.PublicClasses {
+		defs = append(defs, lexer.Definition{Kind: "class", Name: name})
+	}
+	for name := range module.PublicFuncs {
+		defs = append(defs, lexer.Definition{Kind: "function", Name: name})
+	}
+	for name := range module.PublicVars {
+		defs = append(defs, lexer.Definition{Kind: "variable", Name: name})
+	}
+	for name := range module.PublicConsts {
+		defs = append(defs, lexer.Definition{Kind: "constant", Name: name})
+	}
+	slices.SortFunc(defs, func(a, b lexer.Definition) int {
+		return cmp.Or(strings.Compare(a.Name, b.Name), strings.Compare(a.Kind, b.Kind))
+	})
+	return defs
+}
+
+func (c *Checker) registerDeclarations(statements []*lexer.Statement) {
+	for _, stmt := range statements {
+		switch {
+		case stmt.ClassDecl != nil:
+			info := c.newClass(stmt.ClassDecl.Name, stmt.ClassDecl.Constructor, stmt.ClassDecl.Methods)
+			info.base, info.interfaces = baseClassKey(stmt.ClassDecl.Base), stmt.ClassDecl.Interfaces
+		case stmt.PubClassDecl != nil:
+			info := c.newClass(stmt.PubClassDecl.Name, stmt.PubClassDecl.Constructor, stmt.PubClassDecl.Methods)
+			info.base, info.interfaces = baseClassKey(stmt.PubClassDecl.Base), stmt.PubClassDecl.Interfaces
+		case stmt.InterfaceDecl != nil:
+			info := c.newClass(stmt.InterfaceDecl.Name, nil, stmt.InterfaceDecl.Methods)
+			info.isInterface = true
+		case stmt.TopLevelFuncDecl != nil:
+			decl := stmt.TopLevelFuncDecl
+			c.functions[decl.Name] = &funcInfo{decl.Name, decl.Parameters, decl.ReturnType}
+		case stmt.PubTopLevelFuncDecl != nil:
+			decl := stmt.PubTopLevelFuncDecl
+			c.functions[decl.Name] = &funcInfo{decl.Name, decl.Parameters, decl.ReturnType}
+		case stmt.ExternFunc != nil:
+			decl := stmt.ExternFunc
+			c.functions[decl.Name] = &funcInfo{decl.Name, decl.Parameters, decl.ReturnType}
+		case stmt.StructDecl != nil:
+			c.registerStruct(stmt.StructDecl)
+		case stmt.EnumDecl != nil:
+			c.registerEnum(stmt.EnumDecl.Name, stmt.EnumDecl.Values)
+		case stmt.PubEnumDecl != nil:
+			c.registerEnum(stmt.PubEnumDecl.Name, stmt.PubEnumDecl.Values)
+		case stmt.PubVarDecl != nil:
+			c.globals.vars[stmt.PubVarDecl.Name] = normalizeType(stmt.PubVarDecl.Type)
+		case stmt.ConstDecl != nil:
+			c.registerConst(stmt.ConstDecl.Name, stmt.ConstDecl)
+		}
+	}
+}
+
+// Registers a struct as a class without methods whose values are created by
+// calling it with one argument per field.
+func (c *Checker) registerStruct(decl *lexer.StructDeclStmt) {
+	info := c.newClass(decl.Name, nil, nil)
+	info.isStruct, info.hasCtor = true, true
+	for _, field := range decl.Fields {
+		info.fields[field.Name] = normalizeType(field.Type)
+		info.ctor = append(info.ctor, &lexer.MethodParameter{Type: field.Type, Name: field.Name})
+	}
+}
+
+func (c *Checker) newClass(name string, ctor *lexer.ConstructorStmt, methods []*lexer.MethodDeclStmt) *classInfo {
+	info := &classInfo{
+		name:    name,
+		fields:  make(map[string]string),
+		methods: make(map[string]*funcInfo),
+	}
+	if ctor != nil {
+		info.ctor = ctor.Parameters
+		info.hasCtor = true
+		collectFields(info, ctor.Fields, ctor.Parameters)
+	}
+	for _, method := range methods {
+		info.methods[method.Name] = &funcInfo{name + "." + method.Name, method.Parameters, method.ReturnType}
+		collectFields(info, method.Body, method.Parameters)
+	}
+	c.classes[name] = info
+	return info
+}
+
+// Returns the symbol table key of a base class named in a class header.
+func baseClassKey(base string) string {
+	return strings.Replace(base, ".", "_", 1)
+}
+
+// Returns the ancestors of a class, nearest first, and whether the chain
+// loops back on itself.
+func (c *Checker) ancestors(class *classInfo) ([]*classInfo, bool) {
+	var (
+		chain []*classInfo
+		seen  = map[*classInfo]bool{class: true}
+	)
+	for base := c.classes[class.base]; base != nil; base = c.classes[base.base] {
+		if seen[base] {
+			return chain, true
+		}
+		seen[base] = true
+		chain = append(chain, base)
+	}
+	return chain, false
+}
+
+// Copies inherited fields and methods into every derived class. Classes
+// without a constructor of their own use the nearest inherited one.
+func (c *Checker) resolveInheritance() {
+	for _, class := range c.classes {
+		chain, _ := c.ancestors(class)
+		for _, base := range chain {
+			for name, typ := range base.fields {
+				if _, exists := class.fields[name]; !exists {
+					class.fields[name] = typ
+				}
+			}
+			for name, method := range base.methods {
+				if _, exists := class.methods[name]; !exists {
+					class.methods[name] = method
+				}
+			}
+			if !class.hasCtor && base.hasCtor {
+				class.ctor, class.hasCtor = base.ctor, true
+			}
+		}
+	}
+}
+
+// Reports whether instances of the class sub may be used where the class or
+// interface named super is expected.
+func (c *Checker) isSubtype(sub, super string) bool {
+	class, ok := c.classes[normalizeType(sub)]
+	if !ok {
+		return false
+	}
+	target := c.classes[normalizeType(super)]
+	chain, _ := c.ancestors(class)
+	for _, ancestor := range append([]*classInfo{class}, chain...) {
+		if ancestor == target && ancestor != class {
+			return true
+		}
+		if slices.Contains(ancestor.interfaces, normalizeType(super)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Reports whether a value of type actual may be stored in a slot of type
+// expected, allowing instances of a subclass where a base class or an
+// implemented interface is expected.
+func (c *Checker) compatible(expected, actual string) bool {
+	return compatible(expected, actual) || c.isSubtype(actual, expected) || c.widensEnum(expected, actual)
+}
+
+// Records every this.field the class declares or assigns. A field assigned
+// a parameter of the constructor or method it is assigned in has the type of
+// the parameter.
+func collectFields(info *classInfo, statements []*lexer.Statement, params []*lexer.MethodParameter) {
+	add := func(name, typ string) {
+		if field, ok := strings.CutPrefix(name, "this."); ok {
+			if _, exists := info.fields[field]; !exists || info.fields[field] == "" {
+				info.fields[field] = normalizeType(typ)
+			}
+		}
+	}
+	for _, stmt := range statements {
+		switch {
+		case stmt.VarDecl != nil:
+			add(stmt.VarDecl.Name, stmt.VarDecl.Type)
+		case stmt.VarAssign != nil:
+			typ := ""
+			for _, param := range params {
+				if param.Name == strings.TrimSpace(stmt.VarAssign.Value) {
+					typ = param.Type
+				}
+			}
+			add(stmt.VarAssign.Name, typ)
+		case stmt.ListDecl != nil:
+			add(stmt.ListDecl.Name, "list["+stmt.ListDecl.Type+"]")
+		case stmt.ListDeclFunctionCall != nil:
+			add(stmt.ListDeclFunctionCall.Name, "list["+stmt.ListDeclFunctionCall.Type+"]")
+		case stmt.MapDecl != nil:
+			add(stmt.MapDecl.Name, "map["+stmt.MapDecl.KeyType+":"+stmt.MapDecl.ValueType+"]")
+		case stmt.SetDecl != nil:
+			add(stmt.SetDecl.Name, "set["+stmt.SetDecl.ElemType+"]")
+		case stmt.ObjectDecl != nil:
+			add(stmt.ObjectDecl.Name, stmt.ObjectDecl.Type)
+		}
+		for _, body := range nestedBodies(stmt) {
+			collectFields(info, body, params)
+		}
+	}
+}
+
+// Returns the statement blocks nested directly inside a control flow statement.
+func nestedBodies(stmt *lexer.Statement) [][]*lexer.Statement {
+	var bodies [][]*lexer.Statement
+	switch {
+	case stmt.If != nil:
+		bodies = append(bodies, stmt.If.Body)
+		for _, elif := range stmt.If.ElseIfs {
+			bodies = append(bodies, elif.Body)
+		}
+		if stmt.If.Else != nil {
+			bodies = append(bodies, stmt.If.Else.Body)
+		}
+	case stmt.Match != nil:
+		for _, arm := range stmt.Match.Cases {
+			bodies = append(bodies, arm.Body)
+		}
+		if stmt.Match.Else != nil {
+			bodies = append(bodies, stmt.Match.Else.Body)
+		}
+	case stmt.While != nil:
+		bodies = append(bodies, stmt.While.Body)
+	case stmt.For != nil:
+		bodies = append(bodies, stmt.For.Body)
+	case stmt.ParallelFor != nil:
+		bodies = append(bodies, stmt.ParallelFor.Body)
+	case stmt.Foreach != nil:
+		bodies = append(bodies, stmt.Foreach.Body)
+	case stmt.TryCatch != nil:
+		bodies = append(bodies, stmt.TryCatch.TryBody, stmt.TryCatch.CatchBody, stmt.TryCatch.FinallyBody)
+	case stmt.Test != nil:
+		bodies = append(bodies, stmt.Test.Body)
+	case stmt.Bench != nil:
+		bodies = append(bodies, stmt.Bench.Body)
+	}
+	return bodies
+}
+
+func containsRawCode(statements []*lexer.Statement) bool {
+	for _, stmt := range statements {
+		if stmt.RawCode != nil {
+			return true
+		}
+		var bodies [][]*lexer.Statement
+		switch {
+		case stmt.ClassDecl != nil:
+			bodies = classBodies(stmt.ClassDecl.Constructor, stmt.ClassDecl.Methods, stmt.ClassDecl.Deinit)
+		case stmt.PubClassDecl != nil:
+			bodies = classBodies(stmt.PubClassDecl.Constructor, stmt.PubClassDecl.Methods, stmt.PubClassDecl.Deinit)
+		case stmt.TopLevelFuncDecl != nil:
+			bodies = [][]*lexer.Statement{stmt.TopLevelFuncDecl.Body}
+		case stmt.PubTopLevelFuncDecl != nil:
+			bodies = [][]*lexer.Statement{stmt.PubTopLevelFuncDecl.Body}
+		default:
+			bodies = nestedBodies(stmt)
+		}
+		if slices.ContainsFunc(bodies, containsRawCode) {
+			return true
+		}
+	}
+	return false
+}
+
+func classBodies(ctor *lexer.ConstructorStmt, methods []*lexer.MethodDeclStmt, deinit []*lexer.Statement) [][]*lexer.Statement {
+	bodies := [][]*lexer.Statement{deinit}
+	if ctor != nil {
+		bodies = append(bodies, ctor.Fields)
+	}
+	for _, method := range methods {
+		bodies = append(bodies, method.Body)
+	}
+	return bodies
+}
+
+func (c *Checker) checkBlock(statements []*lexer.Statement, line int, declare func()) {
+	c.pushScope()
+	if declare != nil {
+		declare()
+	}
+	c.checkStatements(statements, line)
+	c.popScope()
+}
+
+func (c *Checker) checkStatements(statements []*lexer.Statement, line int) {
+	for _, stmt := range statements {
+		if stmt.Line > 0 {
+			line = stmt.Line
+		}
+		c.checkStatement(stmt, line)
+	}
+}
+
+func (c *Checker) checkStatement(stmt *lexer.Statement, line int) {
+	switch {
+	case stmt.ClassDecl != nil:
+		c.checkClass(stmt.ClassDecl.Name, stmt.ClassDecl.Constructor, stmt.ClassDecl.Methods, stmt.ClassDecl.Deinit, line)
+	case stmt.PubClassDecl != nil:
+		c.checkClass(stmt.PubClassDecl.Name, stmt.PubClassDecl.Constructor, stmt.PubClassDecl.Methods, stmt.PubClassDecl.Deinit, line)
+	case stmt.TopLevelFuncDecl != nil:
+		c.checkFunction(c.functions[stmt.TopLevelFuncDecl.Name], stmt.TopLevelFuncDecl.Body, line)
+	case stmt.PubTopLevelFuncDecl != nil:
+		c.checkFunction(c.functions[stmt.PubTopLevelFuncDecl.Name], stmt.PubTopLevelFuncDecl.Body, line)
+
+	case stmt.VarDecl != nil:
+		c.checkDecl(stmt.VarDecl.Name, stmt.VarDecl.Type, stmt.VarDecl.Value, stmt.VarDecl.Quoted, line)
+	case stmt.PubVarDecl != nil:
+		c.checkDecl(stmt.PubVarDecl.Name, stmt.PubVarDecl.Type, stmt.PubVarDecl.Value, false, line)
+	case stmt.ConstDecl != nil:
+		c.checkConst(stmt.ConstDecl, line)
+	case stmt.ArrayDecl != nil:
+		c.checkArrayDecl(stmt.ArrayDecl, line)
+	case stmt.VarDeclInferred != nil:
+		c.checkNotConst(stmt.VarDeclInferred.Name, line)
+		c.checkExpr(stmt.VarDeclInferred.Value, line)
+		c.declare(stmt.VarDeclInferred.Name, c.inferType(stmt.VarDeclInferred.Value))
+	case stmt.VarAssign != nil:
+		value := stmt.VarAssign.Value
+		if stmt.VarAssign.Quoted {
+			value = quote(value)
+		}
+		c.checkConstAssign(stmt.VarAssign.Name, line)
+		c.checkExpr(stmt.VarAssign.Name, line)
+		c.checkExpr(value, line)
+		c.checkAssignable(stmt.VarAssign.Name, c.declaredType(stmt.VarAssign.Name), value, line)
+		c.assignNarrowing(stmt.VarAssign.Name, value)
+	case stmt.IndexAssign != nil:
+		c.checkConstAssign(stmt.IndexAssign.ListName, line)
+		c.checkExpr(stmt.IndexAssign.ListName, line)
+		c.checkExpr(stmt.IndexAssign.Index, line)
+		c.checkExpr(stmt.IndexAssign.Value, line)
+		target := stmt.IndexAssign.ListName + "[" + stmt.IndexAssign.Index + "]"
+		c.checkAssignable(target, c.inferType(target), stmt.IndexAssign.Value, line)
+	case stmt.ListDecl != nil:
+		if normalizeType(stmt.ListDecl.Type) != "string" {
+			for _, element := range stmt.ListDecl.Elements {
+				c.checkExpr(element, line)
+			}
+		}
+		c.declare(stmt.ListDecl.Name, "list["+stmt.ListDecl.Type+"]")
+	case stmt.ListDeclFunctionCall != nil:
+		if low, high, ok := lexer.ParseRange(stmt.ListDeclFunctionCall.FunctionCall); ok {
+			c.checkExpr(low, line)
+			c.checkExpr(high, line)
+			if stmt.ListDeclFunctionCall.Type != "int" {
+				c.errorf(line, "a range can only be held by a list[int], not list[%s]", stmt.ListDeclFunctionCall.Type)
+			}
+		} else if builtin, args, ok := listTransform(stmt.ListDeclFunctionCall.FunctionCall); ok {
+			c.checkListTransform(builtin, args, stmt.ListDeclFunctionCall.Type, line)
+		} else {
+			c.checkExpr(stmt.ListDeclFunctionCall.FunctionCall, line)
+		}
+		c.declare(stmt.ListDeclFunctionCall.Name, "list["+stmt.ListDeclFunctionCall.Type+"]")
+	case stmt.ListOf != nil:
+		c.checkExpr(stmt.ListOf.Value, line)
+	case stmt.ListOfDecl != nil:
+		c.checkExpr(stmt.ListOfDecl.Value, line)
+		c.declare(stmt.ListOfDecl.Name, "list["+stmt.ListOfDecl.Type+"]")
+	case stmt.MapDecl != nil:
+		c.declare(stmt.MapDecl.Name, "map["+stmt.MapDecl.KeyType+":"+stmt.MapDecl.ValueType+"]")
+	case stmt.PutMap != nil:
+		c.checkExpr(stmt.PutMap.MapName, line)
+		c.checkExpr(stmt.PutMap.Key, line)
+		c.checkExpr(stmt.PutMap.Value, line)
+	case stmt.GetMap != nil:
+		c.checkExpr(stmt.GetMap.MapName, line)
+		c.checkExpr(stmt.GetMap.Key, line)
+	case stmt.DelMap != nil:
+		c.checkExpr(stmt.DelMap.MapName, line)
+		c.checkExpr(stmt.DelMap.Key, line)
+	case stmt.SetDecl != nil:
+		c.declare(stmt.SetDecl.Name, "set["+stmt.SetDecl.ElemType+"]")
+	case stmt.SetAdd != nil:
+		c.checkExpr(stmt.SetAdd.SetName, line)
+		c.checkExpr(stmt.SetAdd.Value, line)
+	case stmt.SetRemove != nil:
+		c.checkExpr(stmt.SetRemove.SetName, line)
+		c.checkExpr(stmt.SetRemove.Value, line)
+	case stmt.CatString != nil:
+		c.checkExpr(stmt.CatString.Target, line)
+		c.checkExpr(stmt.CatString.Value, line)
+	case stmt.CatList != nil:
+		for _, list := range stmt.CatList.Lists {
+			c.checkExpr(list, line)
+		}
+		if stmt.CatList.Target != "" && len(stmt.CatList.Lists) > 0 {
+			c.declare(stmt.CatList.Target, c.inferType(stmt.CatList.Lists[0]))
+		}
+	case stmt.ObjectDecl != nil:
+		c.checkObjectDecl(stmt.ObjectDecl, line)
+
+	case stmt.FunctionCall != nil:
+		c.checkExpr(stmt.FunctionCall.Name+"("+strings.Join(stmt.FunctionCall.Args, ", ")+")", line)
+		if stmt.FunctionCall.Name == "sort!" {
+			c.checkSort(stmt.FunctionCall.Args, line)
+		}
+	case stmt.Run != nil:
+		c.checkExpr(stmt.Run.FunctionCall, line)
+	case stmt.MethodCall != nil:
+		c.checkExpr(methodCallExpr(stmt.MethodCall.Object, stmt.MethodCall.Method, stmt.MethodCall.Args), line)
+	case stmt.VarDeclMethodCall != nil:
+		decl := stmt.VarDeclMethodCall
+		call := methodCallExpr(decl.Object, decl.Method, decl.Args)
+		c.checkExpr(call, line)
+		c.checkAssignable(decl.Name, decl.Type, call, line)
+		c.declare(decl.Name, decl.Type)
+	case stmt.VarAssignMethodCall != nil:
+		assign := stmt.VarAssignMethodCall
+		call := methodCallExpr(assign.Object, assign.Method, assign.Args)
+		c.checkConstAssign(assign.Name, line)
+		c.checkExpr(assign.Name, line)
+		c.checkExpr(call, line)
+		c.checkAssignable(assign.Name, c.inferType(assign.Name), call, line)
+
+	case stmt.Print != nil:
+		for _, variable := range stmt.Print.Variables {
+			c.checkPrintArg(variable, stmt.Print.Segments != nil, line)
+		}
+	case stmt.Put != nil:
+		for _, variable := range stmt.Put.Variables {
+			c.checkPrintArg(variable, stmt.Put.Segments != nil, line)
+		}
+	case stmt.Sleep != nil:
+		c.checkExpr(stmt.Sleep.Duration, line)
+	case stmt.Delete != nil:
+		c.checkDelete(stmt.Delete.Target, line)
+	case stmt.Spawn != nil:
+		c.checkSpawn(stmt.Spawn, line)
+	case stmt.Join != nil:
+		c.checkExpr(stmt.Join.Handle, line)
+		if typ, ok := c.lookupVar(stmt.Join.Handle); ok && typ != "thread" {
+			c.errorf(line, "cannot join '%s' of type %s, only threads started by spawn can be joined", stmt.Join.Handle, typ)
+		}
+	case stmt.Throw != nil:
+		c.checkExpr(stmt.Throw.Value, line)
+		if stmt.Throw.Message != "" {
+			c.checkExpr(stmt.Throw.Message, line)
+		}
+	case stmt.VarDeclRead != nil:
+		c.checkExpr(stmt.VarDeclRead.FilePath, line)
+		c.declare(stmt.VarDeclRead.Name, stmt.VarDeclRead.Type)
+	case stmt.VarDeclWrite != nil:
+		c.checkExpr(stmt.VarDeclWrite.Content, line)
+	case stmt.Return != nil:
+		c.checkReturn(stmt.Return.Value, line)
+
+	case stmt.If != nil:
+		c.checkIf(stmt.If, line)
+	case stmt.Match != nil:
+		c.checkMatch(stmt.Match, line)
+	case stmt.While != nil:
+		whenTrue, _ := nilTests(stmt.While.Condition)
+		c.checkCondition(stmt.While.Condition, line)
+		c.checkLoop(loopInfo{label: stmt.While.Label}, stmt.While.Body, line, func() { c.narrow(whenTrue) })
+	case stmt.For != nil:
+		c.checkExpr(stmt.For.Start, line)
+		c.checkExpr(stmt.For.End, line)
+		c.checkLoop(loopInfo{label: stmt.For.Label}, stmt.For.Body, line, func() { c.declare(stmt.For.Var, "int") })
+	case stmt.ParallelFor != nil:
+		c.checkExpr(stmt.ParallelFor.Start, line)
+		c.checkExpr(stmt.ParallelFor.End, line)
+		if stmt.ParallelFor.Threads != "" {
+			c.checkExpr(stmt.ParallelFor.Threads, line)
+		}
+		if _, chunk, ok := strings.Cut(stmt.ParallelFor.Schedule, ","); ok {
+			c.checkExpr(chunk, line)
+		}
+		for _, reduction := range stmt.ParallelFor.Reductions {
+			_, vars, _ := strings.Cut(reduction, ":")
+			for name := range strings.SplitSeq(vars, ",") {
+				name = strings.TrimSpace(name)
+				if typ, ok := c.lookupVar(name); ok && !isNumeric(typ) && typ != "bool" {
+					c.errorf(line, "cannot reduce '%s' of type %s, only numbers and bools can be reduced", name, typ)
+				} else if !ok {
+					c.checkIdent(name, line)
+				}
+			}
+		}
+		c.checkLoop(loopInfo{parallel: true}, stmt.ParallelFor.Body, line, func() { c.declare(stmt.ParallelFor.Var, "int") })
+	case stmt.Foreach != nil:
+		if file, ok := strings.CutSuffix(stmt.Foreach.Collection, ".lines"); ok && c.isFile(file) {
+			if stmt.Foreach.VarType != "string" {
+				c.errorf(line, "foreach over the lines of a file must use 'string' variable type")
+			}
+		} else {
+			c.checkExpr(stmt.Foreach.Collection, line)
+			if typ, _ := c.lookupVar(stmt.Foreach.Collection); typ == "string" && stmt.Foreach.VarType != "char" && stmt.Foreach.VarType != "string" {
+				c.errorf(line, "foreach over string must use 'char' or 'string' variable type")
+			}
+		}
+		c.checkLoop(loopInfo{label: stmt.Foreach.Label}, stmt.Foreach.Body, line, func() { c.declare(stmt.Foreach.VarName, stmt.Foreach.VarType) })
+	case stmt.Break != nil:
+		c.checkLoopExit("break", stmt.Break.Target, line)
+	case stmt.Continue != nil:
+		c.checkLoopExit("continue", stmt.Continue.Target, line)
+	case stmt.TryCatch != nil:
+		c.checkBlock(stmt.TryCatch.TryBody, line, nil)
+		c.checkBlock(stmt.TryCatch.CatchBody, line, func() {
+			if stmt.TryCatch.CatchVar != "" {
+				c.declare(stmt.TryCatch.CatchVar, exceptionClass)
+			}
+		})
+		c.checkBlock(stmt.TryCatch.FinallyBody, line, nil)
+	case stmt.Test != nil:
+		c.checkNamedBlock("test", stmt.Test.Name, stmt.Test.Body, line)
+	case stmt.Bench != nil:
+		c.checkNamedBlock("bench", stmt.Bench.Name, stmt.Bench.Body, line)
+	case stmt.Assert != nil:
+		c.checkAssert(stmt.Assert, line)
+	}
+}
+
+// Checks a test or bench block, which has to be at the top level of the
+// program and named differently from the other blocks of its kind.
+func (c *Checker) checkNamedBlock(kind, name string, body []*lexer.Statement, line int) {
+	if c.scope.parent != c.globals || c.class != nil || c.fn != nil {
+		c.errorf(line, "%s \"%s\" must be at the top level", kind, name)
+	}
+	key := kind + " " + name
+	if first, exists := c.blocks[key]; exists {
+		c.errorf(line, "duplicate %s \"%s\", first defined at line %d", kind, name, first)
+	} else {
+		c.blocks[key] = line
+	}
+	c.checkBlock(body, line, nil)
+}
+
+// Checks an assert!, assert_eq! or assert. The operands of assert_eq! have to
+// be comparable and the message of an assert has to be a string.
+func (c *Checker) checkAssert(assert *lexer.AssertStmt, line int) {
+	if assert.Condition != "" {
+		c.checkCondition(assert.Condition, line)
+		if assert.Message != "" {
+			c.checkExpr(assert.Message, line)
+			if typ := c.inferType(assert.Message); typ != "" && !isString(typ) {
+				c.errorf(line, "assert message must be a string, got %s", normalizeType(typ))
+			}
+		}
+		return
+	}
+	c.checkExpr(assert.Left, line)
+	c.checkExpr(assert.Right, line)
+	left, right := c.inferType(assert.Left), c.inferType(assert.Right)
+	if !c.compatible(left, right) && !c.compatible(right, left) {
+		c.errorf(line, "assert_eq! cannot compare %s with %s", normalizeType(left), normalizeType(right))
+	}
+}
+
+func (c *Checker) checkLoop(loop loopInfo, body []*lexer.Statement, line int, declare func()) {
+	if loop.label != "" && slices.ContainsFunc(c.loops, func(outer loopInfo) bool { return outer.label == loop.label }) {
+		c.errorf(line, "loop label '%s' is already used by an enclosing loop", loop.label)
+	}
+	c.loops = append(c.loops, loop)
+	c.checkBlock(body, line, declare)
+	c.loops = c.loops[:len(c.loops)-1]
+}
+
+// Reports a break or continue whose target loop does not exist or cannot be
+// left, such as one outside the body of a parallel for.
+func (c *Checker) checkLoopExit(keyword string, target lexer.LoopTarget, line int) {
+	if len(c.loops) == 0 {
+		c.errorf(line, "'%s' outside of a loop", keyword)
+		return
+	}
+	depth := len(c.loops) - 1
+	switch {
+	case target.Label != "":
+		for depth >= 0 && c.loops[depth].label != target.Label {
+			depth--
+		}
+		if depth < 0 {
+			c.errorf(line, "undefined loop label '%s'", target.Label)
+			return
+		}
+	case target.Levels > len(c.loops):
+		c.errorf(line, "'%s %d' is only inside %d loop(s)", keyword, target.Levels, len(c.loops))
+		return
+	case target.Levels > 0:
+		depth = len(c.loops) - target.Levels
+	}
+	for i := depth; i < len(c.loops); i++ {
+		if c.loops[i].parallel && (i > depth || keyword == "break") {
+			c.errorf(line, "'%s' cannot leave a parallel for", keyword)
+			return
+		}
+	}
+}
+
+// Checks the value, case values and arm bodies of a match statement.
+func (c *Checker) checkMatch(match *lexer.MatchStmt, line int) {
+	c.checkExpr(match.Value, line)
+	seen := make(map[string]bool)
+	for _, arm := range match.Cases {
+		caseLine := line
+		if arm.Line > 0 {
+			caseLine = arm.Line
+		}
+		for _, value := range arm.Values {
+			if low, high, ok := lexer.CaseRange(value); ok {
+				c.checkExpr(low, caseLine)
+				c.checkExpr(high, caseLine)
+			} else {
+				c.checkExpr(value, caseLine)
+			}
+			if seen[value] {
+				c.errorf(caseLine, "duplicate case value '%s' in match", value)
+			}
+			seen[value] = true
+		}
+		c.checkBlock(arm.Body, caseLine, nil)
+	}
+	if match.Else != nil {
+		c.checkBlock(match.Else.Body, line, nil)
+	}
+}
+
+// Restores the quotes the parser strips from string literal values.
+func quote(value string) string {
+	return `"` + strings.ReplaceAll(value, `"`, `\"`) + `"`
+}
+
+func methodCallExpr(object, method string, args []string) string {
+	return object + "." + method + "(" + strings.Join(args, ", ") + ")"
+}
+
+func (c *Checker) checkClass(name string, ctor *lexer.ConstructorStmt, methods []*lexer.MethodDeclStmt, deinit []*lexer.Statement, line int) {
+	outerClass, outerScope := c.class, c.scope
+	c.class, c.scope = c.classes[name], c.globals
+	defer func() { c.class, c.scope = outerClass, outerScope }()
+
+	if base := c.class.base; base != "" {
+		if _, cyclic := c.ancestors(c.class); cyclic {
+			c.errorf(line, "class '%s' inherits from itself", name)
+		} else if class, exists := c.classes[base]; exists && class.isInterface {
+			c.errorf(line, "class '%s' cannot inherit from interface '%s', use 'implements' instead", name, base)
+		} else if !exists && !c.lenient && !c.isModuleSymbol(base) {
+			c.errorf(line, "undefined base class '%s'", base)
+		}
+	}
+	for _, iface := range c.class.interfaces {
+		c.checkImplements(c.class, iface, line)
+	}
+
+	if ctor != nil {
+		for _, param := range ctor.Parameters {
+			if param.Default != "" {
+				c.checkExpr(param.Default, line)
+				c.checkAssignable(param.Name, paramType(param), param.Default, line)
+			}
+		}
+		c.checkBlock(ctor.Fields, line, func() { c.declareParams(ctor.Parameters) })
+	}
+	for _, method := range methods {
+		c.checkFunction(c.class.methods[method.Name], method.Body, line)
+	}
+	c.checkFunction(&funcInfo{name: name + ".deinit"}, deinit, line)
+}
+
+// Checks that a class provides every method of an interface it implements
+// with a matching signature.
+func (c *Checker) checkImplements(class *classInfo, name string, line int) {
+	iface, exists := c.classes[name]
+	switch {
+	case !exists:
+		if !c.lenient {
+			c.errorf(line, "undefined interface '%s'", name)
+		}
+		return
+	case !iface.isInterface:
+		c.errorf(line, "'%s' is a class, not an interface", name)
+		return
+	}
+	for methodName, want := range iface.methods {
+		got, ok := class.methods[methodName]
+		if !ok {
+			c.errorf(line, "class '%s' does not implement method '%s' of interface '%s'", class.name, methodName, name)
+			continue
+		}
+		if !sameSignature(got, want) {
+			c.errorf(line, "method '%s' does not match the signature declared by interface '%s'", got.name, name)
+		}
+	}
+}
+
+// Reports whether two methods take the same parameter types and return the same type.
+func sameSignature(a, b *funcInfo) bool {
+	if len(a.params) != len(b.params) || normalizeType(a.returnType) != normalizeType(b.returnType) {
+		return false
+	}
+	for i := range a.params {
+		if normalizeType(paramType(a.params[i])) != normalizeType(paramType(b.params[i])) {
+			return false
+		}
+	}
+	return true
+}
+
+// Checks that a delete statement frees a class instance. Deleting clears an
+// optional, so it needs a nil test again afterwards.
+func (c *Checker) checkDelete(target string, line int) {
+	c.checkExpr(target, line)
+	typ := normalizeType(c.inferType(target))
+	if typ == "" {
+		return
+	}
+	if class, ok := c.classes[optionalElem(typ)]; !ok || class.isStruct || class.isInterface {
+		c.errorf(line, "cannot delete '%s' of type %s, only class instances can be deleted", target, typ)
+	}
+	c.assignNarrowing(target, "nil")
+}
+
+func (c *Checker) checkSpawn(spawn *lexer.SpawnStmt, line int) {
+	c.checkExpr(spawn.Call, line)
+	name, _, _ := strings.Cut(spawn.Call, "(")
+	name = strings.TrimSpace(name)
+	if _, ok := c.functions[name]; !ok && slices.Contains(builtinFunctions, name) {
+		c.errorf(line, "spawn requires a function of the program or of a module, but '%s' is a builtin", name)
+	}
+	c.declare(spawn.Handle, "thread")
+}
+
+func (c *Checker) checkFunction(fn *funcInfo, body []*lexer.Statement, line int) {
+	if fn == nil {
+		return
+	}
+	outerFn, outerScope, outerLoops := c.fn, c.scope, c.loops
+	c.fn, c.scope, c.loops = fn, c.globals, nil
+	defer func() { c.fn, c.scope, c.loops = outerFn, outerScope, outerLoops }()
+
+	c.checkBlock(body, line, func() { c.declareParams(fn.params) })
+}
+
+func (c *Checker) declareParams(params []*lexer.MethodParameter) {
+	for _, param := range params {
+		c.declare(param.Name, paramType(param))
+	}
+}
+
+func paramType(param *lexer.MethodParameter) string {
+	if param.IsList && param.ListType != "" {
+		return "list[" + param.ListType + "]"
+	}
+	return param.Type
+}
+
+func (c *Checker) checkDecl(name, typ, value string, quoted bool, line int) {
+	typ = normalizeType(typ)
+	if quoted {
+		value = quote(value)
+	}
+	if !strings.HasPrefix(name, "this.") {
+		c.checkNotConst(name, line)
+	}
+	if isString(typ) {
+		// String declarations store bare literals without quotes, so only
+		// calls can be checked reliably.
+		if strings.Contains(value, "(") {
+			c.checkExpr(value, line)
+		} else if lexer.IsCharLiteral(value) {
+			c.errorf(line, "cannot assign char value to '%s' of type %s", name, typ)
+		}
+	} else if value != "" {
+		c.checkExpr(value, line)
+		c.checkAssignable(name, typ, value, line)
+	}
+	c.declare(name, typ)
+	c.assignNarrowing(name, value)
+}
+
+// Reports an error when the value cannot be stored in a target of the given type.
+func (c *Checker) checkAssignable(target, targetType, value string, line int) {
+	valueType := c.inferType(value)
+	if !c.compatible(targetType, valueType) {
+		c.errorf(line, "cannot assign %s value to '%s' of type %s", valueType, target, normalizeType(targetType))
+	}
+}
+
+// Checks a value passed to print. The type of the hole of an interpolated
+// string picks how it is printed, so it must be known unless it uses the
+// symbols of a module that is not loaded.
+func (c *Checker) checkPrintArg(hole string, interpolated bool, line int) {
+	reported := len(c.errors)
+	c.checkExpr(hole, line)
+	if !interpolated || c.lenient || len(c.errors) > reported {
+		return
+	}
+	for _, tok := range tokenize(hole) {
+		if tok.kind == tokIdent && c.isModuleSymbol(tok.text) {
+			return
+		}
+	}
+	if c.inferType(hole) == "" {
+		c.errorf(line, "cannot infer the type of '%s' to print it, cast it with 'as'", hole)
+	}
+}
+
+func (c *Checker) checkReturn(value string, line int) {
+	// "format" | values returned formatted text before format! did.
+	if call, ok := lexer.PipeFormatCall(value); ok {
+		if lexer.LangVersionAtLeast("0.3") {
+			c.errorf(line, "cannot return \"format\" | values, use format!(\"format\", values) instead")
+			return
+		}
+		value = call
+	}
+	c.checkExpr(value, line)
+	if c.fn == nil || value == "" {
+		return
+	}
+	if c.fn.returnType == "void" {
+		c.errorf(line, "function '%s' returns void, but a value was returned", c.fn.name)
+		return
+	}
+	if valueType := c.inferType(value); !c.compatible(c.fn.returnType, valueType) {
+		c.errorf(line, "function '%s' returns %s, but %s was returned", c.fn.name, c.fn.returnType, valueType)
+	}
+}
+
+func (c *Checker) checkObjectDecl(decl *lexer.ObjectDeclStmt, line int) {
+	args := decl.Args
+	if strings.Contains(decl.Type, ".") && len(args) >= 2 {
+		args = args[2:]
+	} else if len(args) >= 1 {
+		args = args[1:]
+	}
+	for _, arg := range args {
+		c.checkExpr(arg, line)
+	}
+
+	// `Base b = new Derived(...)` constructs a different class than the declared type.
+	created := decl.Type
+	if len(decl.Args) >= 1 && decl.Args[0] != decl.Type {
+		if _, ok := c.classes[decl.Args[0]]; ok {
+			created = decl.Args[0]
+			if !c.compatible(decl.Type, created) {
+				c.errorf(line, "cannot assign %s value to '%s' of type %s", created, decl.Name, decl.Type)
+			}
+		} else if isName(decl.Args[0]) && !c.modules[decl.Args[0]] && !c.isModuleSymbol(decl.Args[0]) {
+			created = decl.Args[0]
+		}
+	}
+	class, ok := c.classes[created]
+	switch {
+	case ok && class.isInterface:
+		c.errorf(line, "cannot instantiate interface '%s'", created)
+	case ok && class.isStruct:
+		c.errorf(line, "struct '%s' is created by value as %s(...), not with new", created, created)
+	case ok:
+		c.checkArgs("constructor for class '"+created+"'", class.ctor, args, line)
+	case !strings.Contains(created, ".") && !c.lenient:
+		c.errorf(line, "undefined class '%s'%s", created, didYouMean(created, slices.Collect(maps.Keys(c.classes))))
+	}
+	c.declare(decl.Name, decl.Type)
+}
+
+// Checks argument count and, where both sides are known, argument types.
+func (c *Checker) checkArgs(what string, params []*lexer.MethodParameter, args []string, line int) {
+	required := len(params)
+	for required > 0 && params[required-1].Default != "" {
+		required--
+	}
+	if len(args) < required || len(args) > len(params) {
+		if required == len(params) {
+			c.errorf(line, "%s expects %d arguments, but %d were provided", what, len(params), len(args))
+		} else {
+			c.errorf(line, "%s expects %d to %d arguments, but %d were provided", what, required, len(params), len(args))
+		}
+		return
+	}
+	for i, arg := range args {
+		expected := paramType(params[i])
+		if actual := c.inferType(arg); !c.compatible(expected, actual) {
+			c.errorf(line, "argument %d of %s expects %s, but %s was provided", i+1, what, normalizeType(expected), actual)
+		}
+	}
+}
+
+// Checks that every identifier, call and member access in an expression resolves.
+func (c *Checker) checkExpr(expr string, line int) {
+	c.checkTokens(tokenize(expr), line)
+}
+
+func (c *Checker) checkTokens(tokens []token, line int) {
+	for i := 0; i < len(tokens); i++ {
+		tok := tokens[i]
+		if tok.kind != tokIdent || (i > 0 && (tokens[i-1].text == "." || tokens[i-1].text == "->")) {
+			continue
+		}
+		isCall := i+1 < len(tokens) && tokens[i+1].text == "("
+
+		switch {
+		case tok.text == "new":
+			i = c.checkConstructorCall(tokens, i, line)
+			continue
+		case tok.text == "as" && i > 0 && i+1 < len(tokens) && tokens[i+1].kind == tokIdent:
+			c.checkCastAt(tokens, i, line)
+			i++
+			continue
+		case tok.text == "this":
+		case slices.Contains(keywords, tok.text):
+			continue
+		case isCall:
+			c.checkCall(tok.text, tokens, i+1, line)
+		default:
+			c.checkIdent(tok.text, line)
+		}
+		c.checkMembers(tokens, i, line)
+	}
+}
+
+func (c *Checker) checkIdent(name string, line int) {
+	if _, ok := c.lookupVar(name); ok {
+		return
+	}
+	if c.enums[name] || c.members[name] != "" || c.classes[name] != nil || c.modules[name] || c.functions[name] != nil {
+		return
+	}
+	if slices.Contains(builtinConstants, name) || c.lenient || c.isModuleSymbol(name) {
+		return
+	}
+	c.errorf(line, "undefined identifier '%s'%s", name, didYouMean(name, c.identCandidates()))
+}
+
+func (c *Checker) checkCall(name string, tokens []token, open, line int) {
+	close := matchingClose(tokens, open)
+	if close == -1 {
+		return
+	}
+	args := splitArgs(tokens, open, close)
+	if name == "super" {
+		c.checkSuper(args, line)
+		return
+	}
+	if fn, ok := c.functions[name]; ok {
+		c.checkArgs("function '"+fn.name+"'", fn.params, args, line)
+		return
+	}
+	if name == "ord" || name == "chr" {
+		c.checkCharBuiltin(name, args, line)
+		return
+	}
+	if name == "to_int" || name == "to_float" || name == "to_string" || name == "ulen" {
+		c.checkConversion(name, args, line)
+		return
+	}
+	if name == "panic" {
+		c.checkPanic(args, line)
+		return
+	}
+	if name == "set_threads" && len(args) != 1 {
+		c.errorf(line, "set_threads() takes exactly 1 argument, got %d", len(args))
+		return
+	}
+	if c.enums[name] {
+		c.checkEnumConversion(name, args, line)
+		return
+	}
+	if class, ok := c.classes[name]; ok && class.isStruct {
+		c.checkArgs("struct '"+class.name+"'", class.ctor, args, line)
+		return
+	} else if ok {
+		c.checkArgs("constructor for class '"+class.name+"'", class.ctor, args, line)
+		return
+	}
+	if _, isVar := c.lookupVar(name); isVar {
+		return
+	}
+	if name == "format!" {
+		c.checkFormat(args, line)
+		return
+	}
+	if _, ok := listBuiltinArity[name]; ok {
+		c.checkListBuiltin(name, args, line)
+		return
+	}
+	if strings.HasSuffix(name, "!") || slices.Contains(builtinFunctions, name) || c.lenient || c.isModuleSymbol(name) {
+		return
+	}
+	c.errorf(line, "undefined function '%s'%s", name, didYouMean(name, c.callCandidates()))
+}
+
+// Checks a super(args) call against the constructor of the base class.
+func (c *Checker) checkSuper(args []string, line int) {
+	if c.class == nil || c.class.base == "" || c.fn != nil {
+		c.errorf(line, "super() can only be called from the constructor of a derived class")
+		return
+	}
+	if base, ok := c.classes[c.class.base]; ok {
+		c.checkArgs("constructor for class '"+base.name+"'", base.ctor, args, line)
+	}
+}
+
+// Checks `new Class(args)` and returns the index of the class name token.
+func (c *Checker) checkConstructorCall(tokens []token, i, line int) int {
+	open := i + 1
+	for open < len(tokens) && tokens[open].text != "(" {
+		open++
+	}
+	if open >= len(tokens) {
+		return i
+	}
+	name := className(tokens[i+1 : open])
+	if class, ok := c.classes[name]; ok && class.isInterface {
+		c.errorf(line, "cannot instantiate interface '%s'", name)
+	} else if ok && class.isStruct {
+		c.errorf(line, "struct '%s' is created by value as %s(...), not with new", name, name)
+	} else if ok {
+		if close := matchingClose(tokens, open); close != -1 {
+			c.checkArgs("constructor for class '"+name+"'", class.ctor, splitArgs(tokens, open, close), line)
+		}
+	} else if !strings.Contains(name, ".") && !c.lenient {
+		c.errorf(line, "undefined class '%s'%s", name, didYouMean(name, slices.Collect(maps.Keys(c.classes))))
+	}
+	return open - 1
+}
+
+// Walks the member accesses following the identifier at start, checking each
+// field and method against the class of the value it is applied to.
+func (c *Checker) checkMembers(tokens []token, start, line int) {
+	var current, path string
+	i := start + 1
+	if i < len(tokens) && tokens[i].text == "(" {
+		if fn, ok := c.functions[tokens[start].text]; ok {
+			current = fn.returnType
+		} else if class, ok := c.classes[tokens[start].text]; ok && class.isStruct {
+			current = class.name
+		}
+		i = matchingClose(tokens, i) + 1
+		if i == 0 {
+			return
+		}
+	} else {
+		current, _ = c.lookupVar(tokens[start].text)
+		path = tokens[start].text
+	}
+
+	for i+1 < len(tokens) {
+		switch tokens[i].text {
+		case "[":
+			close := matchingClose(tokens, i)
+			if close == -1 {
+				return
+			}
+			if t := normalizeType(current); isList(t) {
+				current = listElemType(t)
+			} else {
+				current = ""
+			}
+			path = ""
+			i = close + 1
+			continue
+		case ".", "->":
+		default:
+			return
+		}
+
+		if t := normalizeType(current); isOptional(t) {
+			if path != "" {
+				c.errorf(line, "'%s' may be nil, test it against nil before using it", path)
+			}
+			current = optionalElem(t)
+		}
+		member := tokens[i+1].text
+		if enum, ok := c.enumOf(current, path); ok {
+			if member != "to_string" {
+				c.errorf(line, "enum '%s' has no method '%s'", enum, member)
+			}
+			return
+		}
+		class := c.classes[normalizeType(current)]
+		if class == nil {
+			return
+		}
+		isCall := i+2 < len(tokens) && tokens[i+2].text == "("
+		if method, ok := class.methods[member]; ok {
+			current = method.returnType
+			if !isCall {
+				return
+			}
+			close := matchingClose(tokens, i+2)
+			if close == -1 {
+				return
+			}
+			c.checkArgs("method '"+method.name+"'", method.params, splitArgs(tokens, i+2, close), line)
+			path = ""
+			i = close + 1
+			continue
+		}
+		if fieldType, ok := class.fields[member]; ok && !isCall {
+			current = c.narrowedField(path, member, fieldType)
+			if path != "" {
+				path += "." + member
+			}
+			i += 2
+			continue
+		}
+		if isCall {
+			c.errorf(line, "%s '%s' has no method '%s'%s", class.kind(), class.name, member, didYouMean(member, class.memberCandidates(true)))
+		} else {
+			c.errorf(line, "%s '%s' has no field '%s'%s", class.kind(), class.name, member, didYouMean(member, class.memberCandidates(false)))
+		}
+		return
+	}
+}
+
+// Reports whether name refers to a symbol of an imported module that could
+// not be loaded for inspection.
+func (c *Checker) isModuleSymbol(name string) bool {
+	for module := range c.modules {
+		if strings.HasPrefix(name, module+"_") {
+			for _, loaded := range lexer.LoadedModules {
+				if loaded.Name == module {
+					return false
+				}
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the source text of each argument between the brackets at open and close.
+func splitArgs(tokens []token, open, close int) []string {
+	if close <= open+1 {
+		return nil
+	}
+	var (
+		args    []string
+		current []string
+		depth   = 0
+	)
+	for i := open + 1; i < close; i++ {
+		tok := tokens[i]
+		if tok.kind == tokOp {
+			switch tok.text {
+			case "(", "[", "{":
+				depth++
+			case ")", "]", "}":
+				depth--
+			case ",":
+				if depth == 0 {
+					args = append(args, strings.Join(current, " "))
+					current = nil
+					continue
+				}
+			}
+		}
+		current = append(current, tok.text)
+	}
+	return append(args, strings.Join(current, " "))
+}
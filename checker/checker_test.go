@@ -0,0 +1,1139 @@
+package checker
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"scar/lexer"
+	"scar/preprocessor"
+	"strings"
+	"testing"
+)
+
+func checkSource(t *testing.T, input string) []error {
+	t.Helper()
+	program, err := lexer.ParseWithIndentation(preprocessor.ProcessSourceLevelMacros(input))
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	return Check(program)
+}
+
+func TestCheckReportsErrors(t *testing.T) {
+	input := `class Dog:
+    init(string name):
+        int this.age = 3
+
+    fn bark(int times) -> int:
+        return this.age
+
+fn add(int a, int b) -> int:
+    return a + b
+
+Dog d = new Dog("rex", 2)
+int x = d.bark()
+d.run()
+int y = "hello"
+y = missing + 1
+int z = add(1, "two")
+Cat c = new Cat()
+unknown_fn(1)
+`
+	errors := checkSource(t, input)
+	expected := []string{
+		"line 11: constructor for class 'Dog' expects 1 arguments, but 2 were provided",
+		"line 12: method 'Dog.bark' expects 1 arguments, but 0 were provided",
+		"line 13: class 'Dog' has no method 'run'",
+		"line 14: cannot assign string value to 'y' of type int",
+		"line 15: undefined identifier 'missing'",
+		"line 16: argument 2 of function 'add' expects int, but string was provided",
+		"line 17: undefined class 'Cat'",
+		"line 18: undefined function 'unknown_fn'",
+	}
+
+	var got []string
+	for _, err := range errors {
+		got = append(got, err.Error())
+	}
+	for _, want := range expected {
+		found := false
+		for _, msg := range got {
+			if msg == want {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("expected error %q, got:\n%s", want, strings.Join(got, "\n"))
+		}
+	}
+	if len(got) != len(expected) {
+		t.Errorf("expected %d errors, got %d:\n%s", len(expected), len(got), strings.Join(got, "\n"))
+	}
+}
+
+func TestCheckFunctionScope(t *testing.T) {
+	input := `int counter = 0
+fn get() -> int:
+    return counter
+`
+	errors := checkSource(t, input)
+	if len(errors) != 1 || !strings.Contains(errors[0].Error(), "line 3: undefined identifier 'counter'") {
+		t.Errorf("expected top-level variables to be invisible inside functions, got %v", errors)
+	}
+}
+
+func TestCheckRawCodeIsLenient(t *testing.T) {
+	input := `$raw (
+    int from_c = 1;
+)
+print "%d" | from_c
+`
+	if errors := checkSource(t, input); len(errors) != 0 {
+		t.Errorf("expected no errors when raw C may declare identifiers, got %v", errors)
+	}
+}
+
+func TestCheckAcceptsTestPrograms(t *testing.T) {
+	files, err := filepath.Glob("../tests/prims/*.scar")
+	if err != nil {
+		t.Fatalf("Failed to list test files: %v", err)
+	}
+	progs, _ := filepath.Glob("../tests/progs/*.scar")
+	files = append(files, progs...)
+
+	for _, file := range files {
+		// This program exercises the validator with a deliberate arity error.
+		if filepath.Base(file) == "test_validation.scar" {
+			continue
+		}
+		content, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("Failed to read file %s: %v", file, err)
+		}
+		program, err := lexer.ParseWithIndentation(preprocessor.ProcessSourceLevelMacros(string(content)))
+		if err != nil {
+			continue
+		}
+		if errors := Check(program); len(errors) != 0 {
+			t.Errorf("unexpected errors in %s: %v", file, errors)
+		}
+	}
+}
+
+func TestCheckInheritance(t *testing.T) {
+	input := `class Animal:
+    init(string name):
+        this.name = name
+
+    fn speak():
+        print "%s" | this.name
+
+class Dog(Animal):
+    init(string name, int age):
+        super(name)
+        this.age = age
+
+class Puppy(Dog):
+    fn play():
+        super("x")
+
+Dog d = new Dog("rex", 3)
+d.speak()
+string n = d.name
+Puppy p = new Puppy("bit")
+Animal a = new Puppy("bit", 1)
+Puppy q = new Animal("cat")
+class Cat(Tiger):
+    fn f():
+        print "x"
+`
+	errors := checkSource(t, input)
+	expected := []string{
+		"line 15: super() can only be called from the constructor of a derived class",
+		"line 20: constructor for class 'Puppy' expects 2 arguments, but 1 were provided",
+		"line 22: cannot assign Animal value to 'q' of type Puppy",
+		"line 23: undefined base class 'Tiger'",
+	}
+	var got []string
+	for _, err := range errors {
+		got = append(got, err.Error())
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected errors:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestCheckInterfaces(t *testing.T) {
+	input := `interface Shape:
+    fn area() -> float
+
+class Circle implements Shape:
+    fn area() -> float:
+        return 1.0
+
+class Square(Circle):
+    fn side() -> int:
+        return 1
+
+class Blob implements Shape:
+    fn area() -> int:
+        return 1
+
+class Dot implements Shape, Drawable:
+    fn size() -> int:
+        return 1
+
+Shape a = new Square()
+Shape b = new Shape()
+Circle c = new Circle()
+float x = a.area()
+a.size()
+`
+	errors := checkSource(t, input)
+	expected := []string{
+		"line 12: method 'Blob.area' does not match the signature declared by interface 'Shape'",
+		"line 16: class 'Dot' does not implement method 'area' of interface 'Shape'",
+		"line 16: undefined interface 'Drawable'",
+		"line 21: cannot instantiate interface 'Shape'",
+		"line 24: class 'Shape' has no method 'size'",
+	}
+	var got []string
+	for _, err := range errors {
+		got = append(got, err.Error())
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected errors:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestCheckMatch(t *testing.T) {
+	input := `int n = 3
+match n:
+    case 1, 2:
+        print "small"
+    case 2:
+        print "two"
+    case 3..limit:
+        int m = 1
+    else:
+        print "%d" | m
+`
+	errors := checkSource(t, input)
+	expected := []string{
+		"line 5: duplicate case value '2' in match",
+		"line 7: undefined identifier 'limit'",
+		"line 10: undefined identifier 'm'",
+	}
+	var got []string
+	for _, err := range errors {
+		got = append(got, err.Error())
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected errors:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestCheckCatchBinding(t *testing.T) {
+	input := `try:
+    throw 1
+catch e:
+    print "%d %s" | e.code, e.message
+    print "%s" | e.reason
+finally:
+    print "%d" | e.code
+`
+	errors := checkSource(t, input)
+	expected := []string{
+		"line 5: class 'Exception' has no field 'reason'",
+		"line 7: undefined identifier 'e'",
+	}
+	var got []string
+	for _, err := range errors {
+		got = append(got, err.Error())
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected errors:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestCheckLoopExits(t *testing.T) {
+	input := `outer: for i = 0 to 3:
+    for j = 0 to 3:
+        break outer
+        continue inner
+        break 3
+    outer: while i < 2:
+        continue 2
+parallel for k = 0 to 3:
+    continue
+    break
+break
+`
+	errors := checkSource(t, input)
+	expected := []string{
+		"line 4: undefined loop label 'inner'",
+		"line 5: 'break 3' is only inside 2 loop(s)",
+		"line 6: loop label 'outer' is already used by an enclosing loop",
+		"line 10: 'break' cannot leave a parallel for",
+		"line 11: 'break' outside of a loop",
+	}
+	var got []string
+	for _, err := range errors {
+		got = append(got, err.Error())
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected errors:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestCheckSlices(t *testing.T) {
+	input := `list[int] items = [1, 2, 3]
+list[int] rest = items[1:]
+items = items[:2]
+string name = "scar"
+string head = name[:2]
+int first = items[0:1]
+`
+	errors := checkSource(t, input)
+	expected := []string{
+		"line 6: cannot assign list[int] value to 'first' of type int",
+	}
+	var got []string
+	for _, err := range errors {
+		got = append(got, err.Error())
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected errors:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestCheckSetForeach(t *testing.T) {
+	input := `set[int] seen = [1, 2]
+add!(seen, 3)
+foreach (int n in seen):
+    print n
+string name = "scar"
+foreach (int c in name):
+    print c
+`
+	errors := checkSource(t, input)
+	expected := []string{
+		"line 6: foreach over string must use 'char' or 'string' variable type",
+	}
+	var got []string
+	for _, err := range errors {
+		got = append(got, err.Error())
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected errors:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestCheckOptionals(t *testing.T) {
+	input := `class Node:
+    init(int value):
+        int this.value = value
+        Node? this.next = nil
+
+    fn second() -> int:
+        if this.next == nil:
+            return 0
+        return this.next.value
+
+    fn third() -> int:
+        if this.next != nil and this.next.next != nil:
+            return this.next.next.value
+        return this.next.value
+
+int? count = nil
+int total = count
+count = 3
+int more = count + 1
+count = nil
+Node? node = new Node(1)
+int value = node.next.value
+`
+	errors := checkSource(t, input)
+	expected := []string{
+		"line 14: 'this.next' may be nil, test it against nil before using it",
+		"line 17: cannot assign int? value to 'total' of type int",
+		"line 22: 'node.next' may be nil, test it against nil before using it",
+	}
+	var got []string
+	for _, err := range errors {
+		got = append(got, err.Error())
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected errors:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestCheckStructs(t *testing.T) {
+	input := `struct Point:
+    int x
+    int y
+
+Point a = Point(1, 2)
+a.x = a.y + 1
+Point b = Point(1)
+Point c = new Point(1, 2)
+int z = a.z
+Point d = 3
+`
+	errors := checkSource(t, input)
+	expected := []string{
+		"line 7: struct 'Point' expects 2 arguments, but 1 were provided",
+		"line 8: struct 'Point' is created by value as Point(...), not with new",
+		"line 9: struct 'Point' has no field 'z'",
+		"line 10: cannot assign int value to 'd' of type Point",
+	}
+	var got []string
+	for _, err := range errors {
+		got = append(got, err.Error())
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected errors:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestCheckConstructorDefaults(t *testing.T) {
+	input := `class Rect:
+    init(int w = 10, int h = 10):
+        int this.w = w
+        int this.h = h
+
+class Label:
+    init(string text, int size = "big"):
+        string this.text = text
+
+Rect a = new Rect()
+Rect b = new Rect(1, 2, 3)
+Label c = new Label()
+`
+	errors := checkSource(t, input)
+	expected := []string{
+		"line 6: cannot assign string value to 'size' of type int",
+		"line 11: constructor for class 'Rect' expects 0 to 2 arguments, but 3 were provided",
+		"line 12: constructor for class 'Label' expects 1 to 2 arguments, but 0 were provided",
+	}
+	var got []string
+	for _, err := range errors {
+		got = append(got, err.Error())
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected errors:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestCheckDelete(t *testing.T) {
+	input := `struct Point:
+    int x
+
+class Handle:
+    init(int id):
+        int this.id = id
+        Handle? this.next = nil
+
+    deinit:
+        print "closing {this.id}"
+        delete this.next
+        int missing = this.count
+
+Handle h = new Handle(1)
+delete h
+int n = 3
+delete n
+Point p = Point(1)
+delete p
+`
+	errors := checkSource(t, input)
+	expected := []string{
+		"line 12: class 'Handle' has no field 'count'",
+		"line 17: cannot delete 'n' of type int, only class instances can be deleted",
+		"line 19: cannot delete 'p' of type Point, only class instances can be deleted",
+	}
+	var got []string
+	for _, err := range errors {
+		got = append(got, err.Error())
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected errors:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestCheckConsts(t *testing.T) {
+	input := `const int MAX = 4
+const int DOUBLE = MAX * 2
+const string NAME = "scar"
+int n = 3
+const int SIZE = n * 2
+const int LOOP = LOOP + 1
+const int BAD = "x"
+MAX = 5
+int MAX = 2
+int[0] empty
+int[n] dynamic
+int[DOUBLE] buf
+buf[1] = MAX
+string s = NAME
+const int SHIFT = 1 << -1
+int[1 << 3] shifted
+`
+	errors := checkSource(t, input)
+	expected := []string{
+		"line 5: const 'SIZE' must be initialised with a constant expression",
+		"line 6: const 'LOOP' does not fold to an integer",
+		"line 7: cannot assign string value to 'BAD' of type int",
+		"line 8: cannot assign to constant 'MAX'",
+		"line 9: cannot redeclare constant 'MAX'",
+		"line 10: size of array 'empty' must be a positive integer constant, got '0'",
+		"line 11: size of array 'dynamic' must be a positive integer constant, got 'n'",
+		"line 15: const 'SHIFT' does not fold to an integer",
+	}
+	var got []string
+	for _, err := range errors {
+		got = append(got, err.Error())
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected errors:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestCheckCharBuiltins(t *testing.T) {
+	input := `char c = 'a'
+int code = ord(c)
+char next = chr(code + 1)
+string s = 'b'
+int bad = ord(c, c)
+char d = chr("x")
+int e = ord("y")
+`
+	errors := checkSource(t, input)
+	expected := []string{
+		"line 4: cannot assign char value to 's' of type string",
+		"line 5: ord() takes exactly 1 argument, got 2",
+		"line 6: chr() expects int, got string",
+		"line 7: ord() expects char, got string",
+	}
+	var got []string
+	for _, err := range errors {
+		got = append(got, err.Error())
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected errors:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestCheckEnums(t *testing.T) {
+	input := `enum Color:
+    Red = 1
+    Green
+
+Color c = Color::Red
+int n = c
+Color d = 2
+Color e = Color(n)
+Color f = Color("x")
+Color g = Color(1, 2)
+string s = c.to_string()
+string t = c.name()
+string u = Color.to_string(n)
+`
+	errors := checkSource(t, strings.ReplaceAll(input, "::", "_"))
+	expected := []string{
+		"line 7: cannot assign int value to 'd' of type Color",
+		"line 9: cannot convert string value to enum 'Color'",
+		"line 10: conversion to enum 'Color' takes exactly 1 argument, got 2",
+		"line 12: enum 'Color' has no method 'name'",
+	}
+	var got []string
+	for _, err := range errors {
+		got = append(got, err.Error())
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected errors:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestCheckSuggestsNames(t *testing.T) {
+	input := `class Counter:
+    init(int start):
+        this.count = start
+
+    fn increment() -> void:
+        this.count = this.count + 1
+
+fn double(int x) -> int:
+    return x * 2
+
+int total = 1
+Counter c = new Countr(1)
+print "%d" | totl
+int y = doubel(total)
+c.incremnt()
+print "%d" | c.cont
+print "%d" | q
+`
+	errors := checkSource(t, input)
+	expected := []string{
+		"line 12: undefined class 'Countr', did you mean 'Counter'?",
+		"line 13: undefined identifier 'totl', did you mean 'total'?",
+		"line 14: undefined function 'doubel', did you mean 'double'?",
+		"line 15: class 'Counter' has no method 'incremnt', did you mean 'increment'?",
+		"line 16: class 'Counter' has no field 'cont', did you mean 'count'?",
+		"line 17: undefined identifier 'q'",
+	}
+	var got []string
+	for _, err := range errors {
+		got = append(got, err.Error())
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected errors:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := map[[2]string]int{
+		{"counter", "counter"}: 0,
+		{"countr", "counter"}:  1,
+		{"doubel", "double"}:   1,
+		{"kitten", "sitting"}:  3,
+		{"", "abc"}:            3,
+	}
+	for pair, expected := range tests {
+		if got := editDistance(pair[0], pair[1]); got != expected {
+			t.Errorf("editDistance(%q, %q) = %d, expected %d", pair[0], pair[1], got, expected)
+		}
+	}
+}
+
+func TestCheckDuplicateDefinitions(t *testing.T) {
+	input := `fn area() -> int:
+    return 1
+
+class Box:
+    init(int v):
+        this.v = v
+
+fn Box() -> int:
+    return 2
+
+fn area() -> int:
+    return 3
+
+pub int area = 4
+`
+	errors := checkSource(t, input)
+	expected := []string{
+		"line 8: duplicate definition of function 'Box', first defined as class at line 4",
+		"line 11: duplicate definition of function 'area', first defined as function at line 1",
+		"line 14: duplicate definition of variable 'area', first defined as function at line 1",
+	}
+	var got []string
+	for _, err := range errors {
+		got = append(got, err.Error())
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected errors:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestCheckAsserts(t *testing.T) {
+	errs := checkSource(t, `int n = 3
+assert n > 0, "n is " + to_string(n)
+assert n > 0, n
+assert m > 0
+`)
+	expected := []string{
+		"line 3: assert message must be a string, got int",
+		"line 4: undefined identifier 'm'",
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("expected %d errors, got %v", len(expected), errs)
+	}
+	for i, err := range errs {
+		if err.Error() != expected[i] {
+			t.Errorf("expected %q, got %q", expected[i], err.Error())
+		}
+	}
+}
+
+func TestCheckTestBlocks(t *testing.T) {
+	input := `int x = 2
+assert_eq!(x, "two")
+if x == 2:
+    test "nested":
+        assert!(x == 2)
+test "a":
+    int y = 1
+    assert_eq!(y, x)
+test "a":
+    assert!(y == 1)
+bench "a":
+    int z = x
+bench "a":
+    int z = x
+`
+	errors := checkSource(t, input)
+	expected := []string{
+		"line 2: assert_eq! cannot compare int with string",
+		"line 4: test \"nested\" must be at the top level",
+		"line 9: duplicate test \"a\", first defined at line 6",
+		"line 10: undefined identifier 'y'",
+		"line 13: duplicate bench \"a\", first defined at line 11",
+	}
+	var got []string
+	for _, err := range errors {
+		got = append(got, err.Error())
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected errors:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestSymbols(t *testing.T) {
+	program, err := lexer.ParseWithIndentation(`class Animal:
+    init(string name):
+        this.name = name
+
+    fn speak(int times) -> string:
+        return this.name
+
+class Dog(Animal):
+    init(string name, int age):
+        super(name)
+        this.age = age
+        list[string] this.tricks = []
+
+fn add(int a, int b) -> int:
+    return a + b
+
+Dog d = new Dog("rex", 3)
+int years = d.age + 1
+`)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	c := New()
+	if errs := c.Check(program); len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	data, _ := json.Marshal(c.Symbols())
+	expected := `{"classes":[` +
+		`{"name":"Animal","kind":"class","constructor":[{"name":"name","type":"string"}],"fields":[{"name":"name","type":"string"}],` +
+		`"methods":[{"name":"speak","parameters":[{"name":"times","type":"int"}],"return_type":"string"}]},` +
+		`{"name":"Dog","kind":"class","base":"Animal","constructor":[{"name":"name","type":"string"},{"name":"age","type":"int"}],` +
+		`"fields":[{"name":"age","type":"int"},{"name":"name","type":"string"},{"name":"tricks","type":"list[string]"}],` +
+		`"methods":[{"name":"speak","parameters":[{"name":"times","type":"int"}],"return_type":"string"}]}],` +
+		`"functions":[{"name":"add","parameters":[{"name":"a","type":"int"},{"name":"b","type":"int"}],"return_type":"int"}]}`
+	if string(data) != expected {
+		t.Errorf("expected symbols:\n%s\ngot:\n%s", expected, data)
+	}
+}
+
+func TestForeachOverFileLines(t *testing.T) {
+	lexer.LoadedModules["io"] = &lexer.ModuleInfo{
+		Name: "io",
+		PublicClasses: map[string]*lexer.ClassDeclStmt{
+			"File": {Name: "File", Constructor: &lexer.ConstructorStmt{Parameters: []*lexer.MethodParameter{
+				{Type: "string", Name: "path"},
+				{Type: "string", Name: "mode"},
+			}}},
+		},
+	}
+	defer delete(lexer.LoadedModules, "io")
+
+	errs := checkSource(t, `import "std/io"
+
+var f = new io::File("data.txt", "r")
+foreach (string line in f.lines):
+    print "{line}"
+foreach (int n in f.lines):
+    print "{n}"
+`)
+	if len(errs) != 1 || errs[0].Error() != "line 6: foreach over the lines of a file must use 'string' variable type" {
+		t.Errorf("expected only the int loop variable to be reported, got %v", errs)
+	}
+}
+
+func TestSpawnAndJoin(t *testing.T) {
+	errs := checkSource(t, `fn work(int id):
+    print "{id}"
+
+var a = spawn work(1)
+thread b = spawn work(2)
+spawn work(3)
+join a
+join b
+int n = 4
+join n
+spawn len("x")
+`)
+	want := []string{
+		"line 10: cannot join 'n' of type int, only threads started by spawn can be joined",
+		"line 11: spawn requires a function of the program or of a module, but 'len' is a builtin",
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("expected %d errors, got %v", len(want), errs)
+	}
+	for i, err := range errs {
+		if err.Error() != want[i] {
+			t.Errorf("expected %q, got %q", want[i], err.Error())
+		}
+	}
+}
+
+func TestReduceClause(t *testing.T) {
+	errs := checkSource(t, `int total = 0
+string name = "x"
+parallel for i = 1 to 10 reduce(+: total) reduce(+: name) reduce(+: missing):
+    total = total + i
+`)
+	if len(errs) != 2 || !strings.Contains(errs[0].Error(), "cannot reduce 'name' of type string") || !strings.Contains(errs[1].Error(), "missing") {
+		t.Errorf("expected the string and undefined reductions to be reported, got %v", errs)
+	}
+}
+
+func TestParallelForThreads(t *testing.T) {
+	errs := checkSource(t, `set_threads(4)
+set_threads(4, 2)
+parallel for i = 1 to 10 threads(workers) schedule(static, 2):
+    print "{i}"
+`)
+	if len(errs) != 2 || !strings.Contains(errs[0].Error(), "set_threads() takes exactly 1 argument, got 2") || !strings.Contains(errs[1].Error(), "workers") {
+		t.Errorf("expected the extra argument and the undefined thread count to be reported, got %v", errs)
+	}
+}
+
+func TestExternFunctionCalls(t *testing.T) {
+	errs := checkSource(t, `extern fn mylib_add(int a, int b) -> int
+int n = mylib_add(1, 2)
+int m = mylib_add(1)
+`)
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "line 3") || !strings.Contains(errs[0].Error(), "mylib_add") {
+		t.Errorf("expected the missing argument of mylib_add to be reported, got %v", errs)
+	}
+}
+
+func TestClassReturnTypes(t *testing.T) {
+	errs := checkSource(t, `class Node:
+    init(int v):
+        this.value = v
+    fn get() -> int:
+        return this.value
+
+fn make_node(int v) -> Node:
+    return new Node(v)
+
+var n = make_node(5)
+Node m = make_node(6)
+int x = n.get() + m.get()
+int y = make_node(1)
+`)
+	if len(errs) != 1 || errs[0].Error() != "line 13: cannot assign Node value to 'y' of type int" {
+		t.Errorf("expected only the assignment of a Node to an int to be reported, got %v", errs)
+	}
+}
+
+func TestRanges(t *testing.T) {
+	errs := checkSource(t, `int n = 3
+foreach (int i in 0..n):
+    print "{i}"
+list[int] xs = range(0, n)
+list[string] names = 1..missing
+`)
+	if len(errs) != 2 {
+		t.Fatalf("expected 2 errors, got %v", errs)
+	}
+	if !strings.Contains(errs[0].Error(), "line 5") || !strings.Contains(errs[0].Error(), "missing") {
+		t.Errorf("expected the undefined bound to be reported, got %v", errs[0])
+	}
+	if errs[1].Error() != "line 5: a range can only be held by a list[int], not list[string]" {
+		t.Errorf("expected the list of strings to be reported, got %v", errs[1])
+	}
+}
+
+func TestListTransforms(t *testing.T) {
+	errs := checkSource(t, `fn twice(int x) -> int:
+    return x * 2
+fn is_even(int x) -> bool:
+    return x % 2 == 0
+list[int] xs = [1, 2, 3]
+list[int] doubled = map!(xs, twice)
+list[int] evens = filter!(xs, is_even)
+list[string] names = map!(xs, twice)
+list[int] odd = filter!(xs, twice)
+list[int] none = map!(xs, missing)
+`)
+	expected := []string{
+		"line 8: function 'twice' given to map! returns int, which a list[string] cannot hold",
+		"line 9: function 'twice' given to filter! must return bool, not int",
+		"line 10: map! expects the name of a function, got 'missing'",
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("expected %d errors, got %v", len(expected), errs)
+	}
+	for i, err := range errs {
+		if err.Error() != expected[i] {
+			t.Errorf("expected %q, got %q", expected[i], err.Error())
+		}
+	}
+}
+
+func TestSort(t *testing.T) {
+	errs := checkSource(t, `class P:
+    init(int x):
+        this.x = x
+fn one(int a) -> int:
+    return a
+fn by_name(string a, string b) -> int:
+    return 0
+fn longer(string a, string b) -> string:
+    return a
+list[P] ps = [new P(1)]
+list[int] xs = [1]
+list[string] names = ["a"]
+int n = 3
+sort!(xs)
+sort!(names, by_name)
+sort!(ps)
+sort!(xs, one)
+sort!(xs, by_name)
+sort!(names, longer)
+sort!(n)
+`)
+	expected := []string{
+		"line 16: sort! cannot order the P elements of 'ps' by itself, pass it a comparator",
+		"line 17: function 'one' given to sort! must take 2 arguments, not 1",
+		"line 18: function 'by_name' given to sort! must take two int elements of 'xs'",
+		"line 19: function 'longer' given to sort! must return int or bool, not string",
+		"line 20: sort! expects a list, but 'n' is int",
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("expected %d errors, got %v", len(expected), errs)
+	}
+	for i, err := range errs {
+		if err.Error() != expected[i] {
+			t.Errorf("expected %q, got %q", expected[i], err.Error())
+		}
+	}
+}
+
+func TestListBuiltins(t *testing.T) {
+	errs := checkSource(t, `class P:
+    init(int x):
+        this.x = x
+list[P] ps = [new P(1)]
+list[int] xs = [3, 1]
+list[string] names = ["a"]
+list[list[int]] grid = [[1]]
+set[int] seen = [1]
+int n = 3
+int total = sum!(xs) + max!(xs)
+bool found = contains!(names, "a") and contains!(seen, 1)
+reverse!(xs)
+bool a = contains!(ps, ps[0])
+int b = index_of!(xs, "a")
+string c = sum!(names)
+int d = max!(n)
+reverse!(grid)
+int e = sum!(xs, 1)
+`)
+	expected := []string{
+		"line 13: contains! cannot compare the P elements of 'ps'",
+		"line 14: index_of! looks for string in 'xs', whose elements are int",
+		"line 15: sum! expects a list of numbers, but the elements of 'names' are string",
+		"line 16: max! expects a list, but 'n' is int",
+		"line 17: reverse! cannot reverse 'grid', a list of lists",
+		"line 18: sum! takes a list, got 2 arguments",
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("expected %d errors, got %v", len(expected), errs)
+	}
+	for i, err := range errs {
+		if err.Error() != expected[i] {
+			t.Errorf("expected %q, got %q", expected[i], err.Error())
+		}
+	}
+}
+
+func TestConversions(t *testing.T) {
+	errs := checkSource(t, `class P:
+    init(int x):
+        this.x = x
+P p = new P(1)
+int n = to_int("42") + 1
+float f = to_float("2.5")
+string s = to_string(n) + to_string(f) + to_string(true)
+int a = to_int(n)
+string b = to_string(p)
+int c = to_int("1", "2")
+`)
+	expected := []string{
+		"line 8: to_int() expects string, got int",
+		"line 9: to_string() expects a number, char, bool or string, got P",
+		"line 10: to_int() takes exactly 1 argument, got 2",
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("expected %d errors, got %v", len(expected), errs)
+	}
+	for i, err := range errs {
+		if err.Error() != expected[i] {
+			t.Errorf("expected %q, got %q", expected[i], err.Error())
+		}
+	}
+}
+
+func TestCasts(t *testing.T) {
+	errs := checkSource(t, `enum Color:
+    Red
+    Green
+int n = 7
+float f = n as f64 / 2
+Color c = 1 as Color
+int i = c as int + -f as i32
+float g = "1.5" as f64
+string s = to_string(n as string)
+Color d = f as Color
+float h = c as float
+`)
+	expected := []string{
+		"line 8: cannot cast string to f64, use to_int or to_float instead",
+		"line 9: cannot cast to string, use to_string instead",
+		"line 10: cannot cast float to enum Color, only integers can be",
+		"line 11: cannot cast enum Color to float, only to integer types",
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("expected %d errors, got %v", len(expected), errs)
+	}
+	for i, err := range errs {
+		if err.Error() != expected[i] {
+			t.Errorf("expected %q, got %q", expected[i], err.Error())
+		}
+	}
+}
+
+func TestPanic(t *testing.T) {
+	errs := checkSource(t, `fn first(list[int] xs) -> int:
+    if xs.length == 0:
+        panic("no elements in " + to_string(xs.length))
+    return xs[0]
+int? found = nil
+if found == nil:
+    panic("not found")
+int n = found + 1
+panic(n)
+panic("a", "b")
+`)
+	expected := []string{
+		"line 9: panic() expects a string message, got int",
+		"line 10: panic() takes exactly 1 argument, got 2",
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("expected %d errors, got %v", len(expected), errs)
+	}
+	for i, err := range errs {
+		if err.Error() != expected[i] {
+			t.Errorf("expected %q, got %q", expected[i], err.Error())
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	errs := checkSource(t, `string name = "Ada"
+string ok = format!("%s is %d, %5.1f%% [%-*s] %c", name, 36, 99.5, 8, name, 'x')
+string a = format!("%s is %d", name)
+string b = format!("%d", name)
+string c = format!("%s", 3)
+string d = format!(b)
+string e = format!(36)
+string nested = format!("[%s] %s", format!("%d", 1), format!("%s", name))
+string n = format!("%d", format!("%d", 1))
+fn f(int x) -> string:
+    return "x %d" | x
+`)
+	expected := []string{
+		"line 3: format! expects 2 values for \"%s is %d\", got 1",
+		"line 4: format! expects a number for %d, got string",
+		"line 5: format! expects a string for %s, got int",
+		"line 7: format! expects a string format, got int",
+		"line 9: format! expects a number for %d, got string",
+		"line 11: cannot return \"format\" | values, use format!(\"format\", values) instead",
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("expected %d errors, got %v", len(expected), errs)
+	}
+	for i, err := range errs {
+		if err.Error() != expected[i] {
+			t.Errorf("expected %q, got %q", expected[i], err.Error())
+		}
+	}
+
+	defer lexer.SetLangVersion(lexer.CurrentLangVersion)
+	lexer.SetLangVersion("0.2")
+	errs = checkSource(t, `fn f(int x) -> string:
+    return "x %d" | x
+fn g(string s) -> string:
+    return "%d" | s
+`)
+	if len(errs) != 1 || errs[0].Error() != "line 4: format! expects a number for %d, got string" {
+		t.Errorf("expected the pipe returns of 0.2 to be checked as format!, got %v", errs)
+	}
+}
+
+func TestUnicode(t *testing.T) {
+	errs := checkSource(t, `string word = "héllo"
+int n = ulen(word)
+int m = ulen(5)
+foreach (string ch in word):
+    print "{ch}"
+foreach (char b in word):
+    print "{b}"
+`)
+	expected := []string{
+		"line 3: ulen() expects string, got int",
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("expected %d errors, got %v", len(expected), errs)
+	}
+	for i, err := range errs {
+		if err.Error() != expected[i] {
+			t.Errorf("expected %q, got %q", expected[i], err.Error())
+		}
+	}
+}
+
+func TestInterpolationHoles(t *testing.T) {
+	lexer.LoadedModules["geo"] = &lexer.ModuleInfo{
+		Name: "geo",
+		PublicVars: map[string]*lexer.VarDeclStmt{
+			"SCALE": {Type: "float", Name: "SCALE", Value: "2.5"},
+		},
+	}
+	defer delete(lexer.LoadedModules, "geo")
+	errs := checkSource(t, `import geo as g
+map[string: float] prices = ["tea": 2.5]
+int mask = 7
+try:
+    throw "boom"
+catch e:
+    print "{e.message} ({e.code})"
+print "{get!(prices, "tea")} {mask & 0b0011} {mask << 1} {INT_MAX} {sqrt(2.0)}"
+print "{g.SCALE} {geo.SCALE} {geo::SCALE}"
+print "{stdout}"
+print "{malloc(8)} {malloc(8) as int}"
+`)
+	expected := []string{
+		"line 10: cannot infer the type of 'stdout' to print it, cast it with 'as'",
+		"line 11: cannot infer the type of 'malloc(8)' to print it, cast it with 'as'",
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("expected %d errors, got %v", len(expected), errs)
+	}
+	for i, err := range errs {
+		if err.Error() != expected[i] {
+			t.Errorf("expected %q, got %q", expected[i], err.Error())
+		}
+	}
+}
@@ -0,0 +1,103 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains the checks for constants and the fixed-size arrays they size.
+//
+// A constant must be initialised with a constant expression built from
+// literals and other constants, can never be assigned or redeclared, and an
+// integer constant expression sizing an array must fold to a positive number.
+
+package checker
+
+import (
+	"scar/lexer"
+	"strings"
+)
+
+// Records a constant under the name it is referenced by.
+func (c *Checker) registerConst(name string, decl *lexer.ConstDeclStmt) {
+	c.globals.vars[name] = normalizeType(decl.Type)
+	c.consts[name] = decl
+}
+
+func (c *Checker) checkConst(decl *lexer.ConstDeclStmt, line int) {
+	c.checkExpr(decl.Value, line)
+	c.checkAssignable(decl.Name, decl.Type, decl.Value, line)
+	if !c.isConstExpr(decl.Value) {
+		c.errorf(line, "const '%s' must be initialised with a constant expression", decl.Name)
+		return
+	}
+	if lexer.IsIntegerConstType(decl.Type) && c.compatible(decl.Type, c.inferType(decl.Value)) {
+		if _, ok := c.foldConst(decl.Value); !ok {
+			c.errorf(line, "const '%s' does not fold to an integer", decl.Name)
+		}
+	}
+}
+
+// Reports whether a value is built only from literals, constants and operators.
+func (c *Checker) isConstExpr(value string) bool {
+	expr, err := lexer.ParseExpr(value)
+	if err != nil {
+		return false
+	}
+	return c.isConstNode(expr)
+}
+
+func (c *Checker) isConstNode(expr lexer.Expr) bool {
+	switch e := expr.(type) {
+	case *lexer.LiteralExpr:
+		return e.Kind != lexer.NilLiteral
+	case *lexer.IdentExpr:
+		return c.consts[e.Name] != nil
+	case *lexer.MemberExpr:
+		module, ok := e.Object.(*lexer.IdentExpr)
+		return ok && c.consts[module.Name+"_"+e.Member] != nil
+	case *lexer.ParenExpr:
+		return c.isConstNode(e.Inner)
+	case *lexer.CastExpr:
+		return c.isConstNode(e.Value)
+	case *lexer.UnaryExpr:
+		return c.isConstNode(e.Operand)
+	case *lexer.BinaryExpr:
+		return c.isConstNode(e.Left) && c.isConstNode(e.Right)
+	}
+	return false
+}
+
+// Folds an integer constant expression, following constants to their values.
+func (c *Checker) foldConst(value string) (int64, bool) {
+	return lexer.FoldConst(value, "", func(name string) *lexer.ConstDeclStmt {
+		return c.consts[name]
+	})
+}
+
+func (c *Checker) checkArrayDecl(decl *lexer.ArrayDeclStmt, line int) {
+	c.checkNotConst(decl.Name, line)
+	if size, ok := c.foldConst(decl.Size); !ok || size <= 0 {
+		c.errorf(line, "size of array '%s' must be a positive integer constant, got '%s'", decl.Name, decl.Size)
+	}
+	c.declare(decl.Name, "list["+decl.Type+"]")
+}
+
+// Reports an error when a declaration reuses the name of a constant.
+func (c *Checker) checkNotConst(name string, line int) {
+	if c.consts[name] != nil {
+		c.errorf(line, "cannot redeclare constant '%s'", name)
+	}
+}
+
+// Reports an error when an assignment targets a constant.
+func (c *Checker) checkConstAssign(target string, line int) {
+	if c.consts[rootName(target)] != nil {
+		c.errorf(line, "cannot assign to constant '%s'", rootName(target))
+	}
+}
+
+// Returns the variable an assignment target such as xs[i] or p.x stores into.
+func rootName(target string) string {
+	if i := strings.IndexAny(target, ".["); i >= 0 {
+		return strings.TrimSpace(target[:i])
+	}
+	return strings.TrimSpace(target)
+}
@@ -0,0 +1,47 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains the checks for enums.
+//
+// An enum value widens to an integer, but an integer only becomes an enum
+// through a conversion such as Color(n), which the generated code checks at
+// run time. The only method of an enum value is to_string.
+
+package checker
+
+// Records an enum and its members, which are referenced as Enum_Member.
+func (c *Checker) registerEnum(name string, members []string) {
+	c.enums[name] = true
+	for _, member := range members {
+		c.members[name+"_"+member] = name
+	}
+}
+
+// Returns the enum a value of the given type belongs to, or the enum named by
+// path when the value is the enum itself as in Color.to_string(n).
+func (c *Checker) enumOf(typ, path string) (string, bool) {
+	if typ = normalizeType(typ); c.enums[typ] {
+		return typ, true
+	}
+	if typ == "" && c.enums[path] {
+		return path, true
+	}
+	return "", false
+}
+
+// Reports whether an enum value is stored into a number.
+func (c *Checker) widensEnum(expected, actual string) bool {
+	return isNumeric(normalizeType(expected)) && c.enums[normalizeType(actual)]
+}
+
+// Checks a conversion such as Color(n), which takes a single integer.
+func (c *Checker) checkEnumConversion(name string, args []string, line int) {
+	if len(args) != 1 {
+		c.errorf(line, "conversion to enum '%s' takes exactly 1 argument, got %d", name, len(args))
+		return
+	}
+	if typ := c.inferType(args[0]); typ != "" && !c.compatible("int", typ) {
+		c.errorf(line, "cannot convert %s value to enum '%s'", typ, name)
+	}
+}
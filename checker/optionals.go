@@ -0,0 +1,200 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains the nil checks for optional types such as int? and Node?.
+//
+// A variable or field of an optional type may be nil, so its members can only
+// be used once a nil test has narrowed it to the type it wraps. Narrowing is
+// recorded in the scope the test applies to, keyed by the variable or by the
+// path of the field such as this.head, and hides the declared type from
+// lookups in that scope and the scopes inside it. Tests narrow the body of
+// an if or while whose condition compares the value with nil, the operands
+// after them in an and chain, and the statements after an if that leaves the
+// block when the value is nil.
+
+package checker
+
+import (
+	"scar/lexer"
+	"strings"
+)
+
+// Returns the values a condition tests to be non-nil when it is true and when
+// it is false, as paths such as n or this.head.
+func nilTests(condition string) (whenTrue, whenFalse []string) {
+	tokens := tokenize(condition)
+	for _, operand := range splitTokens(tokens, "and", "&&") {
+		if path, op, ok := nilTest(operand); ok && op == "!=" {
+			whenTrue = append(whenTrue, path)
+		}
+	}
+	for _, operand := range splitTokens(tokens, "or", "||") {
+		if path, op, ok := nilTest(operand); ok && op == "==" {
+			whenFalse = append(whenFalse, path)
+		}
+	}
+	return whenTrue, whenFalse
+}
+
+// Splits tokens at the top level occurrences of a logical operator.
+func splitTokens(tokens []token, word, op string) [][]token {
+	var (
+		parts [][]token
+		depth = 0
+		last  = 0
+	)
+	for i, tok := range tokens {
+		switch tok.text {
+		case "(", "[", "{":
+			depth++
+		case ")", "]", "}":
+			depth--
+		case word, op:
+			if depth == 0 {
+				parts = append(parts, tokens[last:i])
+				last = i + 1
+			}
+		}
+	}
+	return append(parts, tokens[last:])
+}
+
+// Matches a comparison of a path with nil, such as n != nil or nil == this.head.
+func nilTest(tokens []token) (string, string, bool) {
+	if len(tokens) < 3 {
+		return "", "", false
+	}
+	op := tokens[len(tokens)-2].text
+	path := tokens[:len(tokens)-2]
+	if !isNilToken(tokens[len(tokens)-1]) {
+		op, path = tokens[1].text, tokens[2:]
+		if !isNilToken(tokens[0]) {
+			return "", "", false
+		}
+	}
+	if op != "==" && op != "!=" {
+		return "", "", false
+	}
+	name, ok := tokenPath(path)
+	return name, op, ok
+}
+
+func isNilToken(tok token) bool {
+	return tok.kind == tokIdent && (tok.text == "nil" || tok.text == "NULL" || tok.text == "null")
+}
+
+// Returns the source text of a chain of field accesses such as this.head.next.
+func tokenPath(tokens []token) (string, bool) {
+	if len(tokens)%2 == 0 {
+		return "", false
+	}
+	var path strings.Builder
+	for i, tok := range tokens {
+		if i%2 == 0 && tok.kind != tokIdent || i%2 == 1 && tok.text != "." {
+			return "", false
+		}
+		path.WriteString(tok.text)
+	}
+	return path.String(), true
+}
+
+// Narrows optional values known not to be nil to the types they wrap for the
+// rest of the current scope.
+func (c *Checker) narrow(paths []string) {
+	for _, path := range paths {
+		if typ := normalizeType(c.inferType(path)); isOptional(typ) {
+			c.scope.narrowed[path] = optionalElem(typ)
+		}
+	}
+}
+
+// Checks a condition, narrowing the values tested against nil for the
+// operands that follow them in an and chain.
+func (c *Checker) checkCondition(condition string, line int) {
+	c.pushScope()
+	for _, operand := range splitTokens(tokenize(condition), "and", "&&") {
+		c.checkTokens(operand, line)
+		if path, op, ok := nilTest(operand); ok && op == "!=" {
+			c.narrow([]string{path})
+		}
+	}
+	c.popScope()
+}
+
+// Checks an if statement, narrowing its branches by the nil tests of their
+// conditions. An if without branches that leaves the block when a value is
+// nil narrows the value for the statements after it.
+func (c *Checker) checkIf(stmt *lexer.IfStmt, line int) {
+	whenTrue, whenFalse := nilTests(stmt.Condition)
+	c.checkCondition(stmt.Condition, line)
+	c.checkBlock(stmt.Body, line, func() { c.narrow(whenTrue) })
+
+	c.pushScope()
+	c.narrow(whenFalse)
+	for _, elif := range stmt.ElseIfs {
+		elifTrue, elifFalse := nilTests(elif.Condition)
+		c.checkCondition(elif.Condition, line)
+		c.checkBlock(elif.Body, line, func() { c.narrow(elifTrue) })
+		c.narrow(elifFalse)
+	}
+	if stmt.Else != nil {
+		c.checkBlock(stmt.Else.Body, line, nil)
+	}
+	c.popScope()
+
+	if len(stmt.ElseIfs) == 0 && stmt.Else == nil && lexer.LeavesBlock(stmt.Body) {
+		c.narrow(whenFalse)
+	}
+}
+
+// Returns the declared type of a variable or field path, ignoring narrowing.
+func (c *Checker) declaredType(path string) string {
+	if !strings.Contains(path, ".") {
+		for s := c.scope; s != nil; s = s.parent {
+			if typ, ok := s.vars[path]; ok {
+				return normalizeType(typ)
+			}
+		}
+		return ""
+	}
+	names := strings.Split(path, ".")
+	current, _ := c.lookupVar(names[0])
+	for _, member := range names[1:] {
+		class := c.classes[optionalElem(normalizeType(current))]
+		if class == nil {
+			return ""
+		}
+		current = class.fields[member]
+	}
+	return normalizeType(current)
+}
+
+// Narrows or widens an optional variable or field after an assignment, so it
+// needs a nil test again once it may have been set to nil.
+func (c *Checker) assignNarrowing(target, value string) {
+	typ := c.declaredType(target)
+	if !isOptional(typ) {
+		return
+	}
+	valueType := normalizeType(c.inferType(value))
+	if valueType != "" && valueType != "nil" && !isOptional(valueType) {
+		c.scope.narrowed[target] = optionalElem(typ)
+		return
+	}
+	for s := c.scope; s != nil; s = s.parent {
+		delete(s.narrowed, target)
+	}
+}
+
+// Returns the type of a field of the value at path, narrowed if a nil test
+// has narrowed the field.
+func (c *Checker) narrowedField(path, member, fieldType string) string {
+	if path == "" {
+		return fieldType
+	}
+	if narrowed, ok := c.lookupVar(path + "." + member); ok {
+		return narrowed
+	}
+	return fieldType
+}
@@ -0,0 +1,107 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains the did-you-mean suggestions for misspelled names.
+
+package checker
+
+import (
+	"maps"
+	"slices"
+)
+
+// Returns the candidate closest to a misspelled name, or "" when none is
+// close enough to be what was meant. Short names need to be closer, and
+// single letters are never corrected. Ties go to the candidate sorting first,
+// so suggestions do not depend on map order.
+func suggest(name string, candidates []string) string {
+	limit := min(2, len(name)-1)
+	if len(name) <= 3 {
+		limit = min(1, limit)
+	}
+	best, bestDistance := "", limit+1
+	for _, candidate := range candidates {
+		if candidate == name || candidate == "" {
+			continue
+		}
+		distance := editDistance(name, candidate)
+		if distance < bestDistance || distance == bestDistance && candidate < best {
+			best, bestDistance = candidate, distance
+		}
+	}
+	return best
+}
+
+// Returns the suffix of a message about a misspelled name suggesting the
+// closest candidate, if any.
+func didYouMean(name string, candidates []string) string {
+	if s := suggest(name, candidates); s != "" {
+		return ", did you mean '" + s + "'?"
+	}
+	return ""
+}
+
+// Returns the Levenshtein distance between two names, counting a swap of two
+// adjacent letters as a single edit.
+func editDistance(a, b string) int {
+	var (
+		prev2 []int
+		prev  = make([]int, len(b)+1)
+		cur   = make([]int, len(b)+1)
+	)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if prev2 != nil && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				cur[j] = min(cur[j], prev2[j-2]+1)
+			}
+		}
+		prev2 = append(prev2[:0], prev...)
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// Returns the names of the variables visible from the current scope.
+func (c *Checker) visibleVars() []string {
+	var names []string
+	for s := c.scope; s != nil; s = s.parent {
+		names = slices.AppendSeq(names, maps.Keys(s.vars))
+	}
+	return names
+}
+
+// Returns the names an identifier may refer to.
+func (c *Checker) identCandidates() []string {
+	names := c.visibleVars()
+	names = slices.AppendSeq(names, maps.Keys(c.functions))
+	names = slices.AppendSeq(names, maps.Keys(c.classes))
+	names = slices.AppendSeq(names, maps.Keys(c.enums))
+	names = slices.AppendSeq(names, maps.Keys(c.members))
+	names = slices.AppendSeq(names, maps.Keys(c.consts))
+	return append(names, builtinConstants...)
+}
+
+// Returns the names a call may refer to.
+func (c *Checker) callCandidates() []string {
+	names := slices.Collect(maps.Keys(c.functions))
+	names = slices.AppendSeq(names, maps.Keys(c.classes))
+	return append(names, builtinFunctions...)
+}
+
+// Returns the names of the members of a class, the methods only for a call.
+func (info *classInfo) memberCandidates(isCall bool) []string {
+	if isCall {
+		return slices.Collect(maps.Keys(info.methods))
+	}
+	return slices.Collect(maps.Keys(info.fields))
+}
@@ -0,0 +1,93 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains the symbols the checker resolved, exported for -dump-symbols and
+// for tools built on the compiler.
+
+package checker
+
+import (
+	"maps"
+	"slices"
+
+	"scar/lexer"
+)
+
+// The classes and functions of a checked program, with their resolved types.
+type Symbols struct {
+	Classes   []ClassSymbol    `json:"classes"`
+	Functions []FunctionSymbol `json:"functions"`
+}
+
+// A class, struct or interface.
+type ClassSymbol struct {
+	Name       string   `json:"name"`
+	Kind       string   `json:"kind"`
+	Base       string   `json:"base,omitempty"`
+	Interfaces []string `json:"interfaces,omitempty"`
+	// The parameters of the constructor, or the fields of a struct.
+	Constructor []VariableSymbol `json:"constructor,omitempty"`
+	Fields      []VariableSymbol `json:"fields"`
+	Methods     []FunctionSymbol `json:"methods"`
+}
+
+// A function or a method.
+type FunctionSymbol struct {
+	Name       string           `json:"name"`
+	Parameters []VariableSymbol `json:"parameters"`
+	ReturnType string           `json:"return_type"`
+}
+
+// A field or a parameter.
+type VariableSymbol struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// Returns the symbols of the program the checker last checked, sorted by
+// name. The built in Exception class is left out.
+func (c *Checker) Symbols() *Symbols {
+	symbols := &Symbols{Classes: []ClassSymbol{}, Functions: []FunctionSymbol{}}
+	for _, name := range slices.Sorted(maps.Keys(c.classes)) {
+		info := c.classes[name]
+		if name == exceptionClass {
+			continue
+		}
+		class := ClassSymbol{
+			Name:        name,
+			Kind:        info.kind(),
+			Base:        info.base,
+			Interfaces:  info.interfaces,
+			Constructor: parameterSymbols(info.ctor),
+			Fields:      []VariableSymbol{},
+			Methods:     []FunctionSymbol{},
+		}
+		if info.isInterface {
+			class.Kind = "interface"
+		}
+		for _, field := range slices.Sorted(maps.Keys(info.fields)) {
+			class.Fields = append(class.Fields, VariableSymbol{Name: field, Type: info.fields[field]})
+		}
+		for _, method := range slices.Sorted(maps.Keys(info.methods)) {
+			class.Methods = append(class.Methods, functionSymbol(method, info.methods[method]))
+		}
+		symbols.Classes = append(symbols.Classes, class)
+	}
+	for _, name := range slices.Sorted(maps.Keys(c.functions)) {
+		symbols.Functions = append(symbols.Functions, functionSymbol(name, c.functions[name]))
+	}
+	return symbols
+}
+
+func functionSymbol(name string, fn *funcInfo) FunctionSymbol {
+	return FunctionSymbol{Name: name, Parameters: parameterSymbols(fn.params), ReturnType: fn.returnType}
+}
+
+func parameterSymbols(params []*lexer.MethodParameter) []VariableSymbol {
+	symbols := []VariableSymbol{}
+	for _, param := range params {
+		symbols = append(symbols, VariableSymbol{Name: param.Name, Type: param.Type})
+	}
+	return symbols
+}
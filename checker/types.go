@@ -0,0 +1,474 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains expression tokenizing and type inference for the checker.
+
+package checker
+
+import (
+	"scar/lexer"
+	"slices"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokIdent tokenKind = iota
+	tokNumber
+	tokString
+	tokChar
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+var (
+	numericTypes = []string{
+		"int", "float", "double", "char", "bool", "long",
+		"i8", "i16", "i32", "i64", "u8", "u16", "u32", "u64", "f32", "f64",
+	}
+	floatTypes  = []string{"float", "double", "f32", "f64"}
+	stringTypes = []string{"string", "cstring", "char*"}
+	keywords    = []string{
+		"true", "false", "nil", "NULL", "null", "this", "and", "or", "not", "new",
+		"int", "float", "double", "char", "bool", "string", "void", "ref",
+	}
+	twoCharOps = []string{"->", "==", "!=", "<=", ">=", "&&", "||", "<<", ">>", "::"}
+)
+
+// Splits an expression into identifiers, literals and operators.
+func tokenize(expr string) []token {
+	var tokens []token
+	i := 0
+	for i < len(expr) {
+		ch := expr[i]
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\r' || ch == '\n' || ch == ';':
+			i++
+		case ch == '"' || ch == '\'':
+			j := i + 1
+			for j < len(expr) && expr[j] != ch {
+				if expr[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(expr) {
+				j = len(expr) - 1
+			}
+			kind := tokString
+			if ch == '\'' {
+				kind = tokChar
+			}
+			tokens = append(tokens, token{kind, expr[i : j+1]})
+			i = j + 1
+		case isDigit(ch) || (ch == '.' && i+1 < len(expr) && isDigit(expr[i+1])):
+			j := i
+			for j < len(expr) && (isIdentChar(expr[j]) || expr[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, token{tokNumber, expr[i:j]})
+			i = j
+		case isIdentStart(ch):
+			j := i
+			for j < len(expr) && isIdentChar(expr[j]) {
+				j++
+			}
+			// Builtin macros such as fmt!(...) keep their bang, also when
+			// the arguments of a call are rejoined as format! ( ... ).
+			if j < len(expr) && expr[j] == '!' && strings.HasPrefix(strings.TrimLeft(expr[j+1:], " \t"), "(") {
+				j++
+			}
+			tokens = append(tokens, token{tokIdent, expr[i:j]})
+			i = j
+		default:
+			if i+1 < len(expr) && slices.Contains(twoCharOps, expr[i:i+2]) {
+				tokens = append(tokens, token{tokOp, expr[i : i+2]})
+				i += 2
+			} else {
+				tokens = append(tokens, token{tokOp, string(ch)})
+				i++
+			}
+		}
+	}
+	return tokens
+}
+
+func isDigit(ch byte) bool {
+	return ch >= '0' && ch <= '9'
+}
+
+func isIdentStart(ch byte) bool {
+	return ch == '_' || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z')
+}
+
+// Reports whether s is a single identifier.
+func isName(s string) bool {
+	if s == "" || !isIdentStart(s[0]) {
+		return false
+	}
+	for i := 1; i < len(s); i++ {
+		if !isIdentChar(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isIdentChar(ch byte) bool {
+	return isIdentStart(ch) || isDigit(ch)
+}
+
+// Reports whether the brackets from open to close hold a slice such as [lo:hi].
+func isSlice(tokens []token, open, close int) bool {
+	depth := 0
+	for i := open + 1; i < close; i++ {
+		switch tokens[i].text {
+		case "(", "[", "{":
+			depth++
+		case ")", "]", "}":
+			depth--
+		case ":":
+			if depth == 0 && tokens[i].kind == tokOp {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Returns the index of the token closing the bracket opened at start, or -1.
+func matchingClose(tokens []token, start int) int {
+	var (
+		open  = tokens[start].text
+		close = map[string]string{"(": ")", "[": "]", "{": "}"}[open]
+		depth = 0
+	)
+	for i := start; i < len(tokens); i++ {
+		if tokens[i].kind != tokOp {
+			continue
+		}
+		switch tokens[i].text {
+		case open:
+			depth++
+		case close:
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// Joins the possibly module qualified class name leading a constructor call.
+func className(tokens []token) string {
+	var name strings.Builder
+	for _, tok := range tokens {
+		if tok.text == "(" {
+			break
+		}
+		name.WriteString(tok.text)
+	}
+	return name.String()
+}
+
+// Strips the ref qualifier and surrounding whitespace from a declared type.
+func normalizeType(t string) string {
+	t = strings.TrimSpace(t)
+	t = strings.TrimPrefix(t, "ref ")
+	return strings.TrimSpace(t)
+}
+
+func isNumeric(t string) bool {
+	return slices.Contains(numericTypes, t)
+}
+
+func isString(t string) bool {
+	return slices.Contains(stringTypes, t)
+}
+
+func isOptional(t string) bool {
+	return lexer.IsOptionalType(t)
+}
+
+// Returns the type an optional type wraps, or the type itself when it is not optional.
+func optionalElem(t string) string {
+	if isOptional(t) {
+		return strings.TrimSuffix(t, "?")
+	}
+	return t
+}
+
+func isList(t string) bool {
+	return strings.HasPrefix(t, "list[") && strings.HasSuffix(t, "]")
+}
+
+func listElemType(t string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(t, "list["), "]")
+}
+
+// Reports whether a value of type actual may be stored in a slot of type expected.
+// Unknown types on either side are always compatible.
+func compatible(expected, actual string) bool {
+	expected, actual = normalizeType(expected), normalizeType(actual)
+	switch {
+	case expected == "" || actual == "" || expected == actual:
+		return true
+	case isOptional(expected):
+		return actual == "nil" || compatible(optionalElem(expected), optionalElem(actual))
+	case isOptional(actual):
+		return false
+	case expected == "void":
+		return false
+	case isNumeric(expected) && isNumeric(actual):
+		return true
+	case isString(expected) && isString(actual):
+		return true
+	case actual == "nil":
+		return !isNumeric(expected)
+	case isList(expected) && isList(actual):
+		return compatible(listElemType(expected), listElemType(actual))
+	}
+	return false
+}
+
+// Infers the type of an expression, returning "" when it cannot be determined.
+func (c *Checker) inferType(expr string) string {
+	tokens := tokenize(strings.TrimSpace(expr))
+	if len(tokens) == 0 {
+		return ""
+	}
+	return c.inferTokens(tokens)
+}
+
+func (c *Checker) inferTokens(tokens []token) string {
+	if len(tokens) == 0 {
+		return ""
+	}
+	if len(tokens) == 1 {
+		return c.inferPrimary(tokens[0])
+	}
+
+	if tokens[0].kind == tokOp && tokens[0].text == "(" && matchingClose(tokens, 0) == len(tokens)-1 {
+		return c.inferTokens(tokens[1 : len(tokens)-1])
+	}
+
+	if typ, ok := castType(tokens); ok {
+		return typ
+	}
+
+	if tokens[0].kind == tokIdent && tokens[0].text == "new" && len(tokens) > 1 {
+		if end := c.primaryEnd(tokens, 1); end == len(tokens) {
+			return className(tokens[1:])
+		}
+	}
+
+	if end := c.primaryEnd(tokens, 0); end == len(tokens) {
+		return c.inferPostfix(tokens)
+	}
+
+	var operands [][]token
+	depth, last := 0, 0
+	for i, tok := range tokens {
+		if tok.kind == tokIdent && (tok.text == "and" || tok.text == "or" || tok.text == "not") {
+			return "bool"
+		}
+		if tok.kind != tokOp {
+			continue
+		}
+		switch tok.text {
+		case "(", "[", "{":
+			depth++
+		case ")", "]", "}":
+			depth--
+		case "==", "!=", "<", ">", "<=", ">=", "&&", "||", "!":
+			if depth == 0 {
+				return "bool"
+			}
+		case "+", "-", "*", "/", "%", "&", "|", "^", "<<", ">>":
+			if depth == 0 {
+				if i > last {
+					operands = append(operands, tokens[last:i])
+				}
+				last = i + 1
+			}
+		}
+	}
+	if last == 0 {
+		return ""
+	}
+	operands = append(operands, tokens[last:])
+
+	result := "int"
+	for _, operand := range operands {
+		t := normalizeType(c.inferTokens(operand))
+		switch {
+		case t == "":
+			return ""
+		case slices.Contains(floatTypes, t):
+			result = "float"
+		case !isNumeric(t):
+			return t
+		}
+	}
+	return result
+}
+
+// Returns the value type of a map type such as map[string:int], or "".
+func mapValueType(t string) string {
+	inner, ok := strings.CutPrefix(t, "map[")
+	if !ok || !strings.HasSuffix(inner, "]") {
+		return ""
+	}
+	_, value, _ := strings.Cut(strings.TrimSuffix(inner, "]"), ":")
+	return strings.TrimSpace(value)
+}
+
+func (c *Checker) inferPrimary(tok token) string {
+	switch tok.kind {
+	case tokString:
+		return "string"
+	case tokChar:
+		return "char"
+	case tokNumber:
+		if strings.ContainsAny(tok.text, ".eE") && !strings.HasPrefix(tok.text, "0x") {
+			return "float"
+		}
+		return "int"
+	case tokIdent:
+		switch tok.text {
+		case "true", "false":
+			return "bool"
+		case "nil", "NULL", "null":
+			return "nil"
+		}
+		if t, ok := c.lookupVar(tok.text); ok {
+			return t
+		}
+		if enum := c.members[tok.text]; enum != "" {
+			return enum
+		}
+		if slices.Contains(builtinConstants, tok.text) {
+			return lexer.LibraryTypes[tok.text]
+		}
+	}
+	return ""
+}
+
+// Returns the index just past the postfix chain (calls, indexing and member
+// access) starting at start.
+func (c *Checker) primaryEnd(tokens []token, start int) int {
+	if start >= len(tokens) || tokens[start].kind == tokOp {
+		return start + 1
+	}
+	i := start + 1
+	for i < len(tokens) && tokens[i].kind == tokOp {
+		switch tokens[i].text {
+		case "(", "[":
+			close := matchingClose(tokens, i)
+			if close == -1 {
+				return len(tokens)
+			}
+			i = close + 1
+		case ".", "->":
+			if i+1 < len(tokens) && tokens[i+1].kind == tokIdent {
+				i += 2
+			} else {
+				return i
+			}
+		default:
+			return i
+		}
+	}
+	return i
+}
+
+// Infers the type of a single postfix chain such as a.b.c(x)[i].
+func (c *Checker) inferPostfix(tokens []token) string {
+	var (
+		current = ""
+		i       = 1
+		name    = tokens[0].text
+		path    = ""
+	)
+	if i < len(tokens) && tokens[i].text == "(" {
+		if fn, ok := c.functions[name]; ok {
+			current = fn.returnType
+		} else if class, ok := c.classes[name]; ok && class.isStruct {
+			current = class.name
+		} else if c.enums[name] {
+			current = name
+		} else if t, ok := c.listBuiltinType(name, splitArgs(tokens, i, matchingClose(tokens, i))); ok {
+			current = t
+		} else if args := splitArgs(tokens, i, matchingClose(tokens, i)); name == "get!" && len(args) == 2 {
+			current = mapValueType(normalizeType(c.inferType(args[0])))
+		} else if t, ok := builtinReturnTypes[name]; ok {
+			current = t
+		} else if t, ok := lexer.LibraryTypes[name]; ok {
+			current = t
+		}
+		i = matchingClose(tokens, i) + 1
+	} else {
+		current = c.inferPrimary(tokens[0])
+		path = name
+	}
+
+	for i < len(tokens) {
+		switch tokens[i].text {
+		case "[":
+			close := matchingClose(tokens, i)
+			switch t := normalizeType(current); {
+			case isSlice(tokens, i, close):
+				// Slicing keeps the type of the list or string.
+			case isList(t):
+				current = listElemType(t)
+			case isString(t):
+				current = "char"
+			default:
+				current = ""
+			}
+			path = ""
+			i = close + 1
+		case ".", "->":
+			member := tokens[i+1].text
+			class := c.classes[optionalElem(normalizeType(current))]
+			if _, isEnum := c.enumOf(current, path); isEnum && member == "to_string" {
+				class, current = nil, "string"
+				i = matchingClose(tokens, i+2) + 1
+				path = ""
+				continue
+			}
+			current = ""
+			if i+2 < len(tokens) && tokens[i+2].text == "(" {
+				if class != nil {
+					if method, ok := class.methods[member]; ok {
+						current = method.returnType
+					}
+				} else if fn, ok := c.functions[lexer.GenerateUniqueSymbol(member, name)]; ok && i == 1 && c.modules[name] {
+					current = fn.returnType
+				}
+				path = ""
+				i = matchingClose(tokens, i+2) + 1
+			} else {
+				if class != nil {
+					current = c.narrowedField(path, member, class.fields[member])
+				} else if i == 1 && c.modules[name] {
+					current, _ = c.lookupVar(lexer.GenerateUniqueSymbol(member, name))
+				}
+				if path != "" {
+					path += "." + member
+				}
+				i += 2
+			}
+		default:
+			return ""
+		}
+	}
+	return current
+}
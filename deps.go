@@ -0,0 +1,132 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains the scar get and scar vendor subcommands.
+//
+// scar get <git-url> clones a repository of scar modules into deps/<name>,
+// adds it to the dependencies of scar.toml when the project has one and
+// records the commit it fetched in scar.lock. scar vendor fetches every
+// repository scar.toml depends on, checking out the commits scar.lock
+// records, or the latest ones for dependencies it does not record yet, and
+// rewrites scar.lock with the dependencies scar.toml still has.
+
+package main
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"scar/logging"
+	"scar/manifest"
+)
+
+// Runs git in dir, returning its trimmed output.
+func git(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s failed: %v", strings.Join(args, " "), err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// Fetches a dependency into the deps directory of a project and checks out
+// version, or the default branch when version is empty. Returns the commit
+// checked out.
+func fetchDependency(dir, name, source, version string) (string, error) {
+	depDir := filepath.Join(dir, manifest.DepsDirName, name)
+	if _, err := os.Stat(depDir); os.IsNotExist(err) {
+		if err := os.MkdirAll(filepath.Dir(depDir), 0o755); err != nil {
+			return "", err
+		}
+		if _, err := git(dir, "clone", "--quiet", "--", source, depDir); err != nil {
+			return "", err
+		}
+	} else if version != "" {
+		if current, err := git(depDir, "rev-parse", "HEAD"); err == nil && current == version {
+			return version, nil
+		}
+		if _, err := git(depDir, "fetch", "--quiet", "origin"); err != nil {
+			return "", err
+		}
+	}
+	if version != "" {
+		if _, err := git(depDir, "checkout", "--quiet", "--detach", version, "--"); err != nil {
+			return "", err
+		}
+	}
+	return git(depDir, "rev-parse", "HEAD")
+}
+
+// Implements scar get <git-url>.
+func getDependency(dir, source string) error {
+	if !manifest.IsRemote(source) {
+		return fmt.Errorf("'%s' is not a git repository url", source)
+	}
+	name := manifest.DependencyName(source)
+	if name == "" {
+		return fmt.Errorf("could not name the dependency fetched from '%s'", source)
+	}
+	depDir := filepath.Join(dir, manifest.DepsDirName, name)
+	if _, err := os.Stat(depDir); err == nil {
+		return fmt.Errorf("dependency '%s' already exists in %s", name, manifest.DepsDirName)
+	}
+	// The project files are only updated once the dependency is fetched, and
+	// what was fetched is removed again when they cannot be.
+	version, err := fetchDependency(dir, name, source, "")
+	if err != nil {
+		os.RemoveAll(depDir)
+		return err
+	}
+	if _, err := os.Stat(filepath.Join(dir, manifest.FileName)); err == nil {
+		if err := manifest.AddDependency(dir, name, source); err != nil {
+			os.RemoveAll(depDir)
+			return err
+		}
+	}
+	locked, err := manifest.ReadLock(dir)
+	if err != nil {
+		return err
+	}
+	locked[name] = manifest.LockedDependency{Name: name, Source: source, Version: version}
+	logging.Infof("Fetched %s at %s", name, version)
+	return manifest.WriteLock(dir, locked)
+}
+
+// Implements scar vendor.
+func vendorDependencies(dir string) error {
+	project, err := manifest.Load(dir)
+	if err != nil {
+		return err
+	}
+	locked, err := manifest.ReadLock(dir)
+	if err != nil {
+		return err
+	}
+	vendored := make(map[string]manifest.LockedDependency)
+	for _, name := range slices.Sorted(maps.Keys(project.Dependencies)) {
+		source := project.Dependencies[name]
+		if !manifest.IsRemote(source) {
+			continue
+		}
+		version := ""
+		if dep, exists := locked[name]; exists && dep.Source == source {
+			version = dep.Version
+		}
+		version, err = fetchDependency(dir, name, source, version)
+		if err != nil {
+			return err
+		}
+		vendored[name] = manifest.LockedDependency{Name: name, Source: source, Version: version}
+		logging.Infof("Vendored %s at %s", name, version)
+	}
+	return manifest.WriteLock(dir, vendored)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"scar/manifest"
+)
+
+func TestGetDependency(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("needs git")
+	}
+	dir := t.TempDir()
+	project := "name = \"app\"\n"
+	if err := os.WriteFile(filepath.Join(dir, manifest.FileName), []byte(project), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// A dependency that cannot be fetched leaves the project as it was.
+	if err := getDependency(dir, filepath.Join(t.TempDir(), "missing.git")); err == nil {
+		t.Fatal("expected an error for a repository that does not exist")
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, manifest.FileName)); string(data) != project {
+		t.Errorf("expected %s to be left unchanged, got %q", manifest.FileName, data)
+	}
+	for _, name := range []string{manifest.LockFileName, filepath.Join(manifest.DepsDirName, "missing")} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			t.Errorf("expected no %s after a failed fetch", name)
+		}
+	}
+
+	repo := filepath.Join(t.TempDir(), "geo")
+	for _, args := range [][]string{
+		{"init", "--quiet", repo},
+		{"-C", repo, "-c", "user.name=scar", "-c", "user.email=scar@localhost", "commit", "--quiet", "--allow-empty", "-m", "init"},
+	} {
+		if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %s failed: %v\n%s", strings.Join(args, " "), err, out)
+		}
+	}
+	source := filepath.Join(repo, ".git")
+	if err := getDependency(dir, source); err != nil {
+		t.Fatalf("getDependency failed: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, manifest.FileName)); !strings.Contains(string(data), "geo = ") {
+		t.Errorf("expected geo to be added to %s, got %q", manifest.FileName, data)
+	}
+	if locked, err := manifest.ReadLock(dir); err != nil || locked["geo"].Source != source {
+		t.Errorf("expected geo to be locked, got %v, %v", locked, err)
+	}
+}
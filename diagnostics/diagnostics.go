@@ -0,0 +1,274 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains the diagnostics reported by the parser and the checker.
+//
+// A diagnostic carries the position it refers to, its severity and its
+// message, and is printed together with the offending source line and a
+// caret under the part of the line it is about:
+//
+//	error: undefined identifier 'counter'
+//	  --> main.scar:3:7
+//	   |
+//	 3 | print counter
+//	   |       ^^^^^^^
+
+package diagnostics
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type Severity string
+
+const (
+	Error   Severity = "error"
+	Warning Severity = "warning"
+	Note    Severity = "note"
+)
+
+type Diagnostic struct {
+	File string
+	// The line and column the diagnostic refers to, starting at 1. Either is
+	// 0 when it is not known.
+	Line     int
+	Column   int
+	Length   int
+	Severity Severity
+	Message  string
+	// Identifies the kind of the diagnostic for tools reading it. The compiler
+	// sets it to the phase of the build that found it, parse or check.
+	Code string
+	// The error the diagnostic was made from, if any.
+	cause error
+}
+
+// Diagnostics reported together, such as all the errors of a parse.
+type List []*Diagnostic
+
+func (l List) Error() string {
+	messages := make([]string, len(l))
+	for i, d := range l {
+		messages[i] = d.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+// Returns the errors an error stands for, which are those of a list or the
+// error itself.
+func Split(err error) []error {
+	var list List
+	if !errors.As(err, &list) {
+		return []error{err}
+	}
+	errs := make([]error, len(list))
+	for i, d := range list {
+		errs[i] = d
+	}
+	return errs
+}
+
+// Creates an error diagnostic for a line.
+func Errorf(line int, format string, args ...any) *Diagnostic {
+	return &Diagnostic{Line: line, Severity: Error, Message: fmt.Sprintf(format, args...)}
+}
+
+func (d *Diagnostic) Error() string {
+	if position := d.Position(); position != "" {
+		return position + ": " + d.Message
+	}
+	return d.Message
+}
+
+func (d *Diagnostic) Unwrap() error {
+	return d.cause
+}
+
+// Returns the position of the diagnostic as file:line:column, leaving out what
+// is not known. Without a file the line reads as "line N".
+func (d *Diagnostic) Position() string {
+	if d.File == "" {
+		if d.Line > 0 {
+			return fmt.Sprintf("line %d", d.Line)
+		}
+		return ""
+	}
+	position := d.File
+	if d.Line > 0 {
+		position += ":" + strconv.Itoa(d.Line)
+		if d.Column > 0 {
+			position += ":" + strconv.Itoa(d.Column)
+		}
+	}
+	return position
+}
+
+// A position in a source, with the line and column starting at 1.
+type jsonPosition struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// The part of a line a diagnostic refers to, ending after its last byte.
+type jsonRange struct {
+	Start jsonPosition `json:"start"`
+	End   jsonPosition `json:"end"`
+}
+
+// Encodes the diagnostic as a JSON object holding its file, range, severity,
+// message and code. The range is null when the line is not known.
+func (d *Diagnostic) MarshalJSON() ([]byte, error) {
+	var r *jsonRange
+	if d.Line > 0 {
+		column := max(d.Column, 1)
+		r = &jsonRange{
+			Start: jsonPosition{d.Line, column},
+			End:   jsonPosition{d.Line, column + d.Length},
+		}
+	}
+	return json.Marshal(struct {
+		File     string     `json:"file"`
+		Range    *jsonRange `json:"range"`
+		Severity Severity   `json:"severity"`
+		Message  string     `json:"message"`
+		Code     string     `json:"code"`
+	}{d.File, r, d.Severity, d.Message, d.Code})
+}
+
+var (
+	lineSuffix = regexp.MustCompile(`\s*(?:at|on) line (\d+)`)
+	linePrefix = regexp.MustCompile(`^line (\d+):\s*`)
+	quotedName = regexp.MustCompile(`'([^']+)'`)
+)
+
+// Converts an error into a diagnostic of the given file. Errors that are not
+// diagnostics yet, such as those of the parser that mention the line they
+// are about in their message, have the line taken out of it.
+func FromError(err error, file string) *Diagnostic {
+	var d *Diagnostic
+	if errors.As(err, &d) {
+		if d.File == "" {
+			d.File = file
+		}
+		return d
+	}
+	d = &Diagnostic{File: file, Severity: Error, Message: err.Error(), cause: err}
+	if m := linePrefix.FindStringSubmatchIndex(d.Message); m != nil {
+		d.Line, _ = strconv.Atoi(d.Message[m[2]:m[3]])
+		d.Message = d.Message[m[1]:]
+	} else if m := lineSuffix.FindStringSubmatchIndex(d.Message); m != nil {
+		d.Line, _ = strconv.Atoi(d.Message[m[2]:m[3]])
+		d.Message = d.Message[:m[0]] + d.Message[m[1]:]
+	}
+	return d
+}
+
+// Fills in the column of a diagnostic from the source it refers to, pointing
+// at the first name the message quotes that occurs on the line, or at the
+// whole line otherwise.
+func (d *Diagnostic) Locate(source string) {
+	line, ok := sourceLine(source, d.Line)
+	if !ok || d.Column > 0 {
+		return
+	}
+	for _, m := range quotedName.FindAllStringSubmatch(d.Message, -1) {
+		if i := IndexName(line, m[1]); i >= 0 {
+			d.Column, d.Length = i+1, len(m[1])
+			return
+		}
+	}
+	trimmed := strings.TrimLeft(line, " \t")
+	d.Column = len(line) - len(trimmed) + 1
+	d.Length = len(strings.TrimRight(trimmed, " \t\r"))
+}
+
+// Formats the diagnostic together with the line of the source it refers to,
+// coloring it for a terminal when color is set.
+func (d *Diagnostic) Format(source string, color bool) string {
+	d.Locate(source)
+	paint := func(code, text string) string {
+		if !color {
+			return text
+		}
+		return "\033[" + code + "m" + text + "\033[0m"
+	}
+	severityColor := "1;31"
+	switch d.Severity {
+	case Warning:
+		severityColor = "1;33"
+	case Note:
+		severityColor = "1;36"
+	}
+
+	var b strings.Builder
+	b.WriteString(paint(severityColor, string(d.Severity)+":") + " " + paint("1", d.Message) + "\n")
+	if d.File == "" && d.Line == 0 {
+		return b.String()
+	}
+	if d.File != "" {
+		b.WriteString(paint("34", "  --> ") + d.Position() + "\n")
+	}
+	line, ok := sourceLine(source, d.Line)
+	if !ok {
+		return b.String()
+	}
+	var (
+		number = strconv.Itoa(d.Line)
+		gutter = strings.Repeat(" ", len(number)+1)
+		caret  = strings.Repeat("^", max(d.Length, 1))
+		margin = expandMargin(line, max(d.Column-1, 0))
+	)
+	fmt.Fprintf(&b, "%s%s\n", gutter, paint("34", "|"))
+	fmt.Fprintf(&b, "%s %s %s\n", paint("34", number), paint("34", "|"), strings.TrimRight(line, "\r"))
+	fmt.Fprintf(&b, "%s%s %s%s\n", gutter, paint("34", "|"), margin, paint(severityColor, caret))
+	return b.String()
+}
+
+// Returns the index of the first occurrence of a name in a line that is not
+// part of a longer identifier, or -1.
+func IndexName(line, name string) int {
+	isIdent := func(b byte) bool {
+		return b == '_' || b >= '0' && b <= '9' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z'
+	}
+	for offset := 0; ; {
+		i := strings.Index(line[offset:], name)
+		if i < 0 {
+			return -1
+		}
+		start, end := offset+i, offset+i+len(name)
+		if (start == 0 || !isIdent(line[start-1])) && (end == len(line) || !isIdent(line[end])) {
+			return start
+		}
+		offset = start + 1
+	}
+}
+
+// Returns the blank margin under the first width bytes of a line, keeping its
+// tabs so the caret lines up with the source.
+func expandMargin(line string, width int) string {
+	margin := []byte(strings.Repeat(" ", width))
+	for i := range margin {
+		if i < len(line) && line[i] == '\t' {
+			margin[i] = '\t'
+		}
+	}
+	return string(margin)
+}
+
+// Returns a line of a source, counting from 1.
+func sourceLine(source string, line int) (string, bool) {
+	if line <= 0 {
+		return "", false
+	}
+	lines := strings.Split(source, "\n")
+	if line > len(lines) {
+		return "", false
+	}
+	return lines[line-1], true
+}
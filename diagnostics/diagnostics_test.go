@@ -0,0 +1,95 @@
+package diagnostics
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestFromError(t *testing.T) {
+	tests := []struct {
+		err      error
+		line     int
+		message  string
+		expected string
+	}{
+		{errors.New("while statement format error at line 4"), 4, "while statement format error", "main.scar:4: while statement format error"},
+		{errors.New("unexpected indentation at line 2 (expected 0, got 4)"), 2, "unexpected indentation (expected 0, got 4)", "main.scar:2: unexpected indentation (expected 0, got 4)"},
+		{errors.New("line 7: undefined identifier 'y'"), 7, "undefined identifier 'y'", "main.scar:7: undefined identifier 'y'"},
+		{errors.New("function name 'main' is reserved"), 0, "function name 'main' is reserved", "main.scar: function name 'main' is reserved"},
+	}
+	for _, test := range tests {
+		d := FromError(test.err, "main.scar")
+		if d.Line != test.line || d.Message != test.message || d.Error() != test.expected {
+			t.Errorf("FromError(%q) = %d %q %q", test.err, d.Line, d.Message, d.Error())
+		}
+	}
+
+	inner := &Diagnostic{Line: 3, Severity: Error, Message: "bad"}
+	if d := FromError(fmt.Errorf("failed to parse module: %w", inner), "main.scar"); d != inner || d.File != "main.scar" {
+		t.Errorf("expected the wrapped diagnostic, got %+v", d)
+	}
+	cause := errors.New("import cycle")
+	if d := FromError(cause, ""); !errors.Is(d, cause) {
+		t.Error("expected a diagnostic to unwrap to the error it was made from")
+	}
+}
+
+func TestFormat(t *testing.T) {
+	source := "int max = 3\nprint \"%d\" | x + max\n"
+	d := &Diagnostic{File: "main.scar", Line: 2, Severity: Error, Message: "undefined identifier 'x'"}
+	expected := `error: undefined identifier 'x'
+  --> main.scar:2:14
+  |
+2 | print "%d" | x + max
+  |              ^
+`
+	if got := d.Format(source, false); got != expected {
+		t.Errorf("unexpected diagnostic:\n%s\nexpected:\n%s", got, expected)
+	}
+
+	d = &Diagnostic{Line: 1, Severity: Warning, Message: "unused value"}
+	expected = `warning: unused value
+  |
+1 | int max = 3
+  | ^^^^^^^^^^^
+`
+	if got := d.Format(source, false); got != expected {
+		t.Errorf("unexpected diagnostic:\n%s\nexpected:\n%s", got, expected)
+	}
+}
+
+func TestSplit(t *testing.T) {
+	list := List{Errorf(1, "first"), Errorf(4, "second")}
+	if list.Error() != "line 1: first\nline 4: second" {
+		t.Errorf("unexpected list error %q", list.Error())
+	}
+	if errs := Split(fmt.Errorf("failed to parse module: %w", list)); len(errs) != 2 || errs[1] != list[1] {
+		t.Errorf("expected the diagnostics of a wrapped list, got %v", errs)
+	}
+	err := errors.New("plain")
+	if errs := Split(err); len(errs) != 1 || errs[0] != err {
+		t.Errorf("expected a plain error to stand for itself, got %v", errs)
+	}
+}
+
+func TestMarshalJSON(t *testing.T) {
+	d := &Diagnostic{File: "main.scar", Line: 2, Column: 14, Length: 1, Severity: Error, Message: "undefined identifier 'x'", Code: "check"}
+	data, err := json.Marshal(d)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	expected := `{"file":"main.scar","range":{"start":{"line":2,"column":14},"end":{"line":2,"column":15}},"severity":"error","message":"undefined identifier 'x'","code":"check"}`
+	if string(data) != expected {
+		t.Errorf("unexpected JSON:\n%s\nexpected:\n%s", data, expected)
+	}
+
+	data, err = json.Marshal(&Diagnostic{Severity: Warning, Message: "no line"})
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if expected := `{"file":"","range":null,"severity":"warning","message":"no line","code":""}`; string(data) != expected {
+		t.Errorf("unexpected JSON:\n%s\nexpected:\n%s", data, expected)
+	}
+}
@@ -0,0 +1,177 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains the generation of the API documentation of scar doc.
+//
+// The documentation of a module lists its public functions, classes,
+// variables, constants and enums in source order, each with its declaration
+// and its doc comment, and the public methods of each class. It is written
+// as Markdown or as a standalone HTML page.
+
+package docgen
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	"scar/lexer"
+)
+
+// The documentation of a module.
+type Module struct {
+	Name  string
+	Doc   string
+	Items []*Item
+}
+
+// A documented declaration.
+type Item struct {
+	Kind        string
+	Name        string
+	Declaration string
+	Doc         string
+	// The constructor and methods of a class.
+	Members []*Item
+}
+
+// Collects the public declarations of a program parsed from module name,
+// with the doc comments attached by lexer.AttachDocComments.
+func Collect(name string, program *lexer.Program) *Module {
+	module := &Module{Name: name, Doc: program.Doc}
+	for _, stmt := range program.Statements {
+		var item *Item
+		switch {
+		case stmt.PubTopLevelFuncDecl != nil:
+			fn := stmt.PubTopLevelFuncDecl
+			item = &Item{Kind: "function", Name: fn.Name, Declaration: "pub " + signature(fn.Name, fn.Parameters, fn.ReturnType)}
+		case stmt.PubClassDecl != nil:
+			item = classItem(stmt.PubClassDecl)
+		case stmt.PubVarDecl != nil:
+			item = &Item{Kind: "variable", Name: stmt.PubVarDecl.Name, Declaration: fmt.Sprintf("pub %s %s", stmt.PubVarDecl.Type, stmt.PubVarDecl.Name)}
+		case stmt.ConstDecl != nil && stmt.ConstDecl.Public:
+			c := stmt.ConstDecl
+			item = &Item{Kind: "constant", Name: c.Name, Declaration: fmt.Sprintf("pub const %s %s = %s", c.Type, c.Name, c.Value)}
+		case stmt.PubEnumDecl != nil:
+			item = enumItem(stmt.PubEnumDecl.Name, stmt.PubEnumDecl.Values, stmt.PubEnumDecl.Discriminants)
+		case stmt.EnumDecl != nil && stmt.EnumDecl.IsPublic:
+			item = enumItem(stmt.EnumDecl.Name, stmt.EnumDecl.Values, stmt.EnumDecl.Discriminants)
+		default:
+			continue
+		}
+		item.Doc = stmt.Doc
+		module.Items = append(module.Items, item)
+	}
+	return module
+}
+
+func classItem(class *lexer.PubClassDeclStmt) *Item {
+	declaration := "pub class " + class.Name
+	if class.Base != "" {
+		declaration += "(" + class.Base + ")"
+	}
+	if len(class.Interfaces) > 0 {
+		declaration += " implements " + strings.Join(class.Interfaces, ", ")
+	}
+	item := &Item{Kind: "class", Name: class.Name, Declaration: declaration}
+	if class.Constructor != nil {
+		item.Members = append(item.Members, &Item{Kind: "constructor", Name: "init", Declaration: "init(" + parameters(class.Constructor.Parameters) + ")"})
+	}
+	for _, method := range class.Methods {
+		item.Members = append(item.Members, &Item{
+			Kind:        "method",
+			Name:        method.Name,
+			Declaration: signature(method.Name, method.Parameters, method.ReturnType),
+			Doc:         method.Doc,
+		})
+	}
+	return item
+}
+
+func enumItem(name string, values []string, discriminants map[string]string) *Item {
+	var b strings.Builder
+	fmt.Fprintf(&b, "pub enum %s:", name)
+	for _, value := range values {
+		b.WriteString("\n    " + value)
+		if discriminant, ok := discriminants[value]; ok {
+			b.WriteString(" = " + discriminant)
+		}
+	}
+	return &Item{Kind: "enum", Name: name, Declaration: b.String()}
+}
+
+// Returns the header of a function or a method, without its colon.
+func signature(name string, params []*lexer.MethodParameter, returnType string) string {
+	header := "fn " + name + "(" + parameters(params) + ")"
+	if returnType != "" && returnType != "void" {
+		header += " -> " + returnType
+	}
+	return header
+}
+
+func parameters(params []*lexer.MethodParameter) string {
+	list := make([]string, len(params))
+	for i, param := range params {
+		list[i] = param.Type + " " + param.Name
+		if param.IsRef {
+			list[i] = "ref " + list[i]
+		}
+		if param.Default != "" {
+			list[i] += " = " + param.Default
+		}
+	}
+	return strings.Join(list, ", ")
+}
+
+// Returns the documentation of a module as Markdown.
+func Markdown(module *Module) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", module.Name)
+	if module.Doc != "" {
+		fmt.Fprintf(&b, "%s\n\n", module.Doc)
+	}
+	for _, item := range module.Items {
+		fmt.Fprintf(&b, "## %s\n\n```scar\n%s\n```\n\n", item.Name, item.Declaration)
+		if item.Doc != "" {
+			fmt.Fprintf(&b, "%s\n\n", item.Doc)
+		}
+		for _, member := range item.Members {
+			fmt.Fprintf(&b, "### %s.%s\n\n```scar\n%s\n```\n\n", item.Name, member.Name, member.Declaration)
+			if member.Doc != "" {
+				fmt.Fprintf(&b, "%s\n\n", member.Doc)
+			}
+		}
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// Returns the documentation of a module as an HTML page.
+func HTML(module *Module) string {
+	var b strings.Builder
+	name := html.EscapeString(module.Name)
+	fmt.Fprintf(&b, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n</head>\n<body>\n<h1>%s</h1>\n", name, name)
+	writeDoc(&b, module.Doc)
+	for _, item := range module.Items {
+		fmt.Fprintf(&b, "<h2 id=\"%s\">%s</h2>\n<pre><code>%s</code></pre>\n",
+			html.EscapeString(item.Name), html.EscapeString(item.Name), html.EscapeString(item.Declaration))
+		writeDoc(&b, item.Doc)
+		for _, member := range item.Members {
+			id := html.EscapeString(item.Name + "." + member.Name)
+			fmt.Fprintf(&b, "<h3 id=\"%s\">%s</h3>\n<pre><code>%s</code></pre>\n", id, id, html.EscapeString(member.Declaration))
+			writeDoc(&b, member.Doc)
+		}
+	}
+	b.WriteString("</body>\n</html>\n")
+	return b.String()
+}
+
+// Writes a doc comment as HTML paragraphs, which are separated by blank
+// lines like in Markdown.
+func writeDoc(b *strings.Builder, doc string) {
+	for paragraph := range strings.SplitSeq(doc, "\n\n") {
+		if paragraph = strings.TrimSpace(paragraph); paragraph != "" {
+			fmt.Fprintf(b, "<p>%s</p>\n", html.EscapeString(paragraph))
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package docgen
+
+import (
+	"strings"
+	"testing"
+
+	"scar/lexer"
+)
+
+const source = `## Shapes.
+
+## A square.
+pub class Square(Shape) implements Drawable:
+    init(int side = 1):
+        this.side = side
+
+    ## The area.
+    fn area() -> int:
+        return this.side * this.side
+
+## Doubles n.
+pub fn twice(ref int n):
+    n = n * 2
+
+pub enum Color:
+    Red
+    Green = 5
+
+fn hidden() -> int:
+    return 1
+`
+
+func collect(t *testing.T) *Module {
+	t.Helper()
+	program, err := lexer.ParseWithIndentation(lexer.RemoveComments(source))
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	lexer.AttachDocComments(program, source)
+	return Collect("shapes", program)
+}
+
+func TestMarkdown(t *testing.T) {
+	expected := "# shapes\n\nShapes.\n\n" +
+		"## Square\n\n```scar\npub class Square(Shape) implements Drawable\n```\n\nA square.\n\n" +
+		"### Square.init\n\n```scar\ninit(int side = 1)\n```\n\n" +
+		"### Square.area\n\n```scar\nfn area() -> int\n```\n\nThe area.\n\n" +
+		"## twice\n\n```scar\npub fn twice(ref int n)\n```\n\nDoubles n.\n\n" +
+		"## Color\n\n```scar\npub enum Color:\n    Red\n    Green = 5\n```\n"
+	if markdown := Markdown(collect(t)); markdown != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, markdown)
+	}
+}
+
+func TestHTML(t *testing.T) {
+	page := HTML(collect(t))
+	for _, expected := range []string{
+		"<title>shapes</title>",
+		"<p>Shapes.</p>",
+		`<h3 id="Square.area">Square.area</h3>`,
+		"<pre><code>fn area() -&gt; int</code></pre>",
+		"<p>Doubles n.</p>",
+	} {
+		if !strings.Contains(page, expected) {
+			t.Errorf("expected %s in the page:\n%s", expected, page)
+		}
+	}
+	if strings.Contains(page, "hidden") {
+		t.Errorf("expected private functions to be left out:\n%s", page)
+	}
+}
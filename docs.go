@@ -0,0 +1,79 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains scar doc, which writes the API documentation of each module of a
+// directory tree from its doc comments.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"scar/buildlog"
+	"scar/docgen"
+	"scar/lexer"
+	"scar/preprocessor"
+)
+
+// The directory scar doc writes to unless given another with -outdir.
+const docDirName = "docs"
+
+// Writes the documentation of the modules at the given paths, or under the
+// working directory when none are given, to dir, as one Markdown or HTML
+// file per module. Test files and files without public declarations are
+// left out. Returns the exit code of the command, which is 1 when a module
+// failed to parse or its documentation could not be written.
+func writeDocs(events *buildlog.Logger, paths []string, dir string, asHTML bool) int {
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	files, err := findFiles(paths, ".scar")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if dir == "" {
+		dir = docDirName
+	}
+
+	code := 0
+	for _, file := range files {
+		if strings.HasSuffix(file, testFileSuffix) {
+			continue
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			code = 1
+			continue
+		}
+		program, err := lexer.ParseWithIndentation(preprocessor.ProcessSourceLevelMacros(string(data)))
+		if err != nil {
+			reportDiagnostics(events, "parse", []error{err}, file, string(data))
+			code = 1
+			continue
+		}
+		lexer.AttachDocComments(program, string(data))
+
+		module := docgen.Collect(strings.TrimSuffix(filepath.Base(file), ".scar"), program)
+		if len(module.Items) == 0 {
+			continue
+		}
+		content, ext := docgen.Markdown(module), ".md"
+		if asHTML {
+			content, ext = docgen.HTML(module), ".html"
+		}
+		path := filepath.Join(dir, module.Name+ext)
+		if err := writeFile(path, content); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			code = 1
+			continue
+		}
+		fmt.Println(path)
+	}
+	return code
+}
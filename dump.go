@@ -0,0 +1,76 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains -dump-ast and -dump-symbols, which print what the compiler knows
+// about a program as JSON, for debugging the compiler and for external tools.
+
+package main
+
+import (
+	"encoding/json"
+	"io"
+
+	"scar/lexer"
+)
+
+// Writes value to w as indented JSON, leaving the operators in expressions
+// unescaped.
+func writeJSON(w io.Writer, value any) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
+
+// Returns the syntax tree of a program as JSON values. A statement only holds
+// the one kind of statement it is, so the fields without a value are left
+// out, which leaves each statement with its kind and its line.
+func syntaxTree(program *lexer.Program) (any, error) {
+	data, err := json.Marshal(program)
+	if err != nil {
+		return nil, err
+	}
+	var tree any
+	if err := json.Unmarshal(data, &tree); err != nil {
+		return nil, err
+	}
+	return withoutEmptyFields(tree), nil
+}
+
+// Removes the null, false, zero and empty fields of the objects in value.
+func withoutEmptyFields(value any) any {
+	switch value := value.(type) {
+	case map[string]any:
+		for key, field := range value {
+			if field = withoutEmptyFields(field); isEmpty(field) {
+				delete(value, key)
+			} else {
+				value[key] = field
+			}
+		}
+	case []any:
+		for i, elem := range value {
+			value[i] = withoutEmptyFields(elem)
+		}
+	}
+	return value
+}
+
+func isEmpty(value any) bool {
+	switch value := value.(type) {
+	case nil:
+		return true
+	case bool:
+		return !value
+	case float64:
+		return value == 0
+	case string:
+		return value == ""
+	case []any:
+		return len(value) == 0
+	case map[string]any:
+		return len(value) == 0
+	}
+	return false
+}
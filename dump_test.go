@@ -0,0 +1,30 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"scar/lexer"
+)
+
+func TestSyntaxTree(t *testing.T) {
+	program, err := lexer.ParseWithIndentation("int x = 1\nif x > 0:\n    x = 2\n")
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	tree, err := syntaxTree(program)
+	if err != nil {
+		t.Fatalf("syntaxTree failed: %v", err)
+	}
+	var out, data bytes.Buffer
+	if err := writeJSON(&out, tree); err != nil {
+		t.Fatalf("writeJSON failed: %v", err)
+	}
+	json.Compact(&data, out.Bytes())
+	expected := `{"Statements":[{"Line":1,"VarDecl":{"Name":"x","Type":"int","Value":"1"}},` +
+		`{"If":{"Body":[{"Line":3,"VarAssign":{"Name":"x","Value":"2"}}],"Condition":"x > 0"},"Line":2}]}`
+	if data.String() != expected {
+		t.Errorf("expected %s, got %s", expected, data.String())
+	}
+}
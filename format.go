@@ -0,0 +1,60 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains scar fmt, which formats the scar files of a directory tree in
+// place, or with -check only lists the files that are not formatted, so CI
+// can fail on them.
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"scar/buildlog"
+	"scar/formatter"
+)
+
+// Formats the scar files at the given paths, or under the working directory
+// when none are given, printing the files it changed. With check, the files
+// are left as they are and the ones that are not formatted are printed
+// instead. Returns the exit code of the command, which is 1 when a file
+// failed to parse or, with check, was not formatted.
+func formatFiles(events *buildlog.Logger, paths []string, check bool) int {
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	files, err := findFiles(paths, ".scar")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	code := 0
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			code = 1
+			continue
+		}
+		formatted, err := formatter.Format(string(data))
+		if err != nil {
+			reportDiagnostics(events, "parse", []error{err}, file, string(data))
+			code = 1
+			continue
+		}
+		if formatted == string(data) {
+			continue
+		}
+		fmt.Println(file)
+		if check {
+			code = 1
+		} else if err := os.WriteFile(file, []byte(formatted), 0o644); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			code = 1
+		}
+	}
+	return code
+}
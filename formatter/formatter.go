@@ -0,0 +1,425 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains the formatter of scar fmt, which prints sources in a canonical
+// layout.
+//
+// A source is parsed before it is formatted, so only valid programs are
+// formatted, and the result is parsed again to make sure formatting kept it
+// valid. Formatting works on the lines of the source rather than on its
+// syntax tree, which keeps comments where they are: blocks are indented by
+// four spaces per level, the tokens of a line are spaced canonically, runs of
+// blank lines are collapsed and the imports of each group of imports at the
+// top level are sorted. Comments and $raw blocks of C code are kept as they
+// are, apart from their indentation.
+
+package formatter
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"scar/lexer"
+	"scar/preprocessor"
+)
+
+// The indentation of one block level.
+const indentUnit = "    "
+
+// Returns source formatted canonically, or the error that parsing it failed
+// with.
+func Format(source string) (string, error) {
+	if err := parse(source); err != nil {
+		return "", err
+	}
+	formatted := format(source)
+	if err := parse(formatted); err != nil {
+		return "", fmt.Errorf("formatting produced an invalid program: %w", err)
+	}
+	return formatted, nil
+}
+
+func parse(source string) error {
+	_, err := lexer.ParseWithIndentation(preprocessor.ProcessSourceLevelMacros(source))
+	return err
+}
+
+func format(source string) string {
+	var (
+		lines = strings.Split(strings.ReplaceAll(source, "\r\n", "\n"), "\n")
+		out   []string
+		// The indentation widths of the blocks enclosing the current line.
+		levels []int
+		// The indentation of the statement the current line may continue,
+		// the brackets it leaves open and whether it ends in a backslash.
+		statementIndent string
+		open            int
+		continued       bool
+	)
+	for i := 0; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if trimmed == "" {
+			if len(out) > 0 && out[len(out)-1] != "" {
+				out = append(out, "")
+			}
+			continue
+		}
+		width := indentWidth(lines[i])
+		if strings.HasPrefix(trimmed, "#") {
+			// Comments are indented like the code they are in, without
+			// opening or closing blocks.
+			depth := 0
+			for _, level := range levels {
+				if level < width {
+					depth++
+				}
+			}
+			out = append(out, strings.Repeat(indentUnit, depth)+trimmed)
+			continue
+		}
+		if open > 0 || continued {
+			// Lines continuing a statement are indented one level deeper
+			// than it, apart from the brackets closing it.
+			indent := statementIndent + indentUnit
+			if open > 0 && strings.ContainsAny(trimmed[:1], ")]}") {
+				indent = statementIndent
+			}
+			out = append(out, indent+formatLine(trimmed))
+			open, continued = continuation(trimmed, open)
+			continue
+		}
+		for len(levels) > 0 && levels[len(levels)-1] > width {
+			levels = levels[:len(levels)-1]
+		}
+		if len(levels) == 0 || levels[len(levels)-1] < width {
+			levels = append(levels, width)
+		}
+		indent := strings.Repeat(indentUnit, len(levels)-1)
+
+		if strings.HasPrefix(trimmed, "$raw") {
+			end := rawBlockEnd(lines, i)
+			out = append(out, indent+trimmed)
+			// The C code keeps its indentation relative to the block.
+			shift := len(indent) - width
+			for _, raw := range lines[i+1 : end+1] {
+				if strings.TrimSpace(raw) == "" {
+					out = append(out, "")
+					continue
+				}
+				out = append(out, strings.Repeat(" ", max(0, indentWidth(raw)+shift))+strings.TrimSpace(raw))
+			}
+			i = end
+			continue
+		}
+		out = append(out, indent+formatLine(trimmed))
+		statementIndent = indent
+		open, continued = continuation(trimmed, 0)
+	}
+	for len(out) > 0 && out[len(out)-1] == "" {
+		out = out[:len(out)-1]
+	}
+	if len(out) == 0 {
+		return ""
+	}
+	return strings.Join(sortImports(out), "\n") + "\n"
+}
+
+// Returns the width of the indentation of a line, counting a tab as four
+// spaces like the parser does.
+func indentWidth(line string) int {
+	width := 0
+	for _, char := range line {
+		switch char {
+		case ' ':
+			width++
+		case '\t':
+			width += 4
+		default:
+			return width
+		}
+	}
+	return width
+}
+
+// Returns the brackets left open after a line of a statement which had open
+// brackets left open before it, and whether the line ends in a backslash.
+// The statement continues on the next line in either case.
+func continuation(line string, open int) (int, bool) {
+	code, _ := splitComment(line)
+	tokens := tokenize(code)
+	for _, tok := range tokens {
+		switch tok.text {
+		case "(", "[", "{":
+			open++
+		case ")", "]", "}":
+			open--
+		}
+	}
+	return open, len(tokens) > 0 && tokens[len(tokens)-1].text == `\`
+}
+
+// Returns the last line of the $raw block starting at line start, which ends
+// where its parentheses are balanced.
+func rawBlockEnd(lines []string, start int) int {
+	depth := 0
+	for i := start; i < len(lines); i++ {
+		depth += strings.Count(lines[i], "(") - strings.Count(lines[i], ")")
+		if depth <= 0 {
+			return i
+		}
+	}
+	return len(lines) - 1
+}
+
+// Formats a line without its indentation, spacing its tokens and keeping its
+// comment apart from them.
+func formatLine(line string) string {
+	code, comment := splitComment(line)
+	keyword, rest, _ := strings.Cut(code, " ")
+	switch {
+	// The text of print and put is printed as it is written unless quoted.
+	case slices.Contains(printKeywords, keyword) && !strings.HasPrefix(strings.TrimSpace(rest), "\""):
+		code = keyword + " " + strings.TrimSpace(rest)
+	// The / of a module path such as std/string is not a division.
+	case keyword == "import" || keyword == "from":
+		code = strings.Join(strings.Fields(code), " ")
+	default:
+		code = spaceTokens(tokenize(code))
+	}
+	if comment != "" {
+		return code + "  " + comment
+	}
+	return code
+}
+
+// Splits a line into its code and its inline comment, which starts at the
+// first # outside of a string or a character.
+func splitComment(line string) (code, comment string) {
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '"', '\'':
+			i = literalEnd(line, i)
+		case '#':
+			return strings.TrimSpace(line[:i]), line[i:]
+		}
+	}
+	return line, ""
+}
+
+// Returns the index of the quote closing the string or the character
+// literal opened at start, or the last index of s when it is not closed.
+func literalEnd(s string, start int) int {
+	for i := start + 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case s[start]:
+			return i
+		}
+	}
+	return len(s) - 1
+}
+
+type tokenKind int
+
+const (
+	word tokenKind = iota
+	number
+	literal
+	punct
+)
+
+type token struct {
+	text string
+	kind tokenKind
+	// Whether the token was preceded by whitespace.
+	spaced bool
+}
+
+// The operators of two characters, which are tokens of their own.
+var twoCharOperators = []string{"==", "!=", "<=", ">=", "->", "+=", "-=", "*=", "/=", "%=", "::", "..", "&&", "||", "<<", ">>", "++", "--"}
+
+func tokenize(code string) []token {
+	var tokens []token
+	for i := 0; i < len(code); {
+		spaced := false
+		for i < len(code) && (code[i] == ' ' || code[i] == '\t') {
+			spaced = true
+			i++
+		}
+		if i == len(code) {
+			break
+		}
+		start := i
+		kind := punct
+		switch c := code[i]; {
+		case c == '"' || c == '\'':
+			kind = literal
+			i = literalEnd(code, i) + 1
+		case isDigit(c):
+			kind = number
+			i = numberEnd(code, i)
+		case c == '_' || isLetter(c):
+			kind = word
+			for i < len(code) && (code[i] == '_' || isLetter(code[i]) || isDigit(code[i])) {
+				i++
+			}
+		case i+1 < len(code) && slices.Contains(twoCharOperators, code[i:i+2]):
+			i += 2
+		default:
+			i++
+		}
+		tokens = append(tokens, token{text: code[start:i], kind: kind, spaced: spaced})
+	}
+	return tokens
+}
+
+// Returns the end of the number literal starting at start, which takes in
+// prefixes, digit separators, fractions and exponents but not the .. of a
+// range.
+func numberEnd(code string, start int) int {
+	i := start
+	hex := strings.HasPrefix(code[start:], "0x") || strings.HasPrefix(code[start:], "0X")
+	for i < len(code) {
+		switch c := code[i]; {
+		case isDigit(c) || isLetter(c) || c == '_':
+			i++
+		case c == '.' && i+1 < len(code) && isDigit(code[i+1]):
+			i++
+		case (c == '-' || c == '+') && !hex && (code[i-1] == 'e' || code[i-1] == 'E'):
+			i++
+		default:
+			return i
+		}
+	}
+	return i
+}
+
+// Joins tokens with canonical spacing: binary operators are surrounded by
+// spaces, commas are followed by one, and nothing separates brackets,
+// member accesses, ranges and unary operators from their operands. Other
+// tokens are separated by one space where they were separated at all.
+func spaceTokens(tokens []token) string {
+	var b strings.Builder
+	for i, tok := range tokens {
+		if i > 0 && spaceBefore(tokens, i) {
+			b.WriteByte(' ')
+		}
+		b.WriteString(tok.text)
+	}
+	return b.String()
+}
+
+func spaceBefore(tokens []token, i int) bool {
+	prev, tok := tokens[i-1].text, tokens[i].text
+	switch {
+	case tok == "," || tok == ")" || tok == "]" || prev == "(" || prev == "[":
+		return false
+	case prev == ",":
+		return true
+	case slices.Contains([]string{".", "::", ".."}, tok) || slices.Contains([]string{".", "::", ".."}, prev):
+		return false
+	case tok == ":" && i == len(tokens)-1:
+		// The colon opening a block.
+		return false
+	case isBinary(tokens, i) || isBinary(tokens, i-1):
+		return true
+	case isUnary(tokens, i-1):
+		return false
+	}
+	return tokens[i].spaced
+}
+
+// Operators that are always binary, and those that are binary between two
+// operands.
+var (
+	binaryOperators      = []string{"=", "==", "!=", "<=", ">=", "->", "+=", "-=", "*=", "/=", "%=", "&&", "||"}
+	arithmeticOperators  = []string{"+", "-", "*", "/", "%", "<", ">", "<<", ">>", "&", "|", "^"}
+	keywordsBeforeValues = []string{"return", "if", "elif", "while", "and", "or", "not", "to", "in", "case", "throw", "print", "put", "eprint", "eput", "step"}
+	printKeywords        = []string{"print", "put", "eprint", "eput"}
+	typeNames            = []string{"int", "float", "double", "char", "bool", "string", "void", "long", "i8", "i16", "i32", "i64", "u8", "u16", "u32", "u64", "f32", "f64"}
+)
+
+func isBinary(tokens []token, i int) bool {
+	tok := tokens[i]
+	if tok.kind != punct {
+		return false
+	}
+	if slices.Contains(binaryOperators, tok.text) {
+		return true
+	}
+	if !slices.Contains(arithmeticOperators, tok.text) || i == 0 || i == len(tokens)-1 {
+		return false
+	}
+	// A pointer type such as char* is not a multiplication.
+	if tok.text == "*" && slices.Contains(typeNames, tokens[i-1].text) {
+		return false
+	}
+	return endsOperand(tokens[i-1]) && startsOperand(tokens[i+1])
+}
+
+func isUnary(tokens []token, i int) bool {
+	switch tokens[i].text {
+	case "-", "+", "!":
+		return !isBinary(tokens, i) && (i == 0 || !endsOperand(tokens[i-1]))
+	}
+	return false
+}
+
+// Reports whether a token can end the operand on the left of an operator.
+func endsOperand(tok token) bool {
+	switch tok.kind {
+	case number, literal:
+		return true
+	case word:
+		return !slices.Contains(keywordsBeforeValues, tok.text)
+	}
+	return tok.text == ")" || tok.text == "]"
+}
+
+// Reports whether a token can start the operand on the right of an operator.
+func startsOperand(tok token) bool {
+	return tok.kind != punct || slices.Contains([]string{"(", "[", "-", "+", "!"}, tok.text)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// Sorts each group of consecutive top level imports by module, dropping
+// repeated imports.
+func sortImports(lines []string) []string {
+	for start := 0; start < len(lines); start++ {
+		if importedModule(lines[start]) == "" {
+			continue
+		}
+		end := start
+		for end < len(lines) && importedModule(lines[end]) != "" {
+			end++
+		}
+		group := slices.Clone(lines[start:end])
+		slices.SortStableFunc(group, func(a, b string) int {
+			return strings.Compare(importedModule(a), importedModule(b))
+		})
+		group = slices.Compact(group)
+		lines = slices.Replace(lines, start, end, group...)
+		start += len(group)
+	}
+	return lines
+}
+
+// Returns the module a top level import imports, or the first of the
+// modules it imports, and "" for other lines.
+func importedModule(line string) string {
+	fields := strings.Fields(strings.ReplaceAll(line, ",", " "))
+	if len(fields) < 2 || line[0] == ' ' || (fields[0] != "import" && fields[0] != "from") {
+		return ""
+	}
+	return strings.Trim(fields[1], "\"")
+}
@@ -0,0 +1,133 @@
+package formatter
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	source := `import "std/strings"
+import "std/io"
+import "std/io"
+
+
+fn area(int w,int h)->int:
+      # the area
+    int a = w*h  # inline
+    if a>10 and -w<0 :
+        return a-1
+    return -a
+
+
+class Box:
+	init(int size):
+		int  this.size  = size
+	fn grow(int by) -> char*:
+		print growing   by
+		this.size = this.size+by*2
+		$raw (
+		    return "grown";
+		)
+for i = 0 to 4:
+    put!(counts, i, xs[i]-1)
+print "%d items" |len(xs)
+`
+	expected := `import "std/io"
+import "std/strings"
+
+fn area(int w, int h) -> int:
+    # the area
+    int a = w * h  # inline
+    if a > 10 and -w < 0:
+        return a - 1
+    return -a
+
+class Box:
+    init(int size):
+        int this.size = size
+    fn grow(int by) -> char*:
+        print growing   by
+        this.size = this.size + by * 2
+        $raw (
+            return "grown";
+        )
+for i = 0 to 4:
+    put!(counts, i, xs[i] - 1)
+print "%d items" | len(xs)
+`
+	formatted, err := Format(source)
+	if err != nil {
+		t.Fatalf("Format failed: %v", err)
+	}
+	if formatted != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, formatted)
+	}
+	if again, _ := Format(formatted); again != formatted {
+		t.Errorf("expected formatting to be idempotent, got:\n%s", again)
+	}
+}
+
+func TestFormatLiterals(t *testing.T) {
+	for source, expected := range map[string]string{
+		`string s = "a+b  #  {x*2}"`: `string s = "a+b  #  {x*2}"`,
+		`char c = '#'  # hash`:       `char c = '#'  # hash`,
+		`float f = 1.5e-3*2`:         `float f = 1.5e-3 * 2`,
+		`int x = 0xFF+1_000`:         `int x = 0xFF + 1_000`,
+		`Node? n = nil`:              `Node? n = nil`,
+		`int y = f(-1, -x)`:          `int y = f(-1, -x)`,
+		`int c = Color :: Green`:     `int c = Color::Green`,
+	} {
+		if formatted := formatLine(source); formatted != expected {
+			t.Errorf("formatLine(%q) = %q, expected %q", source, formatted, expected)
+		}
+	}
+}
+
+func TestFormatMatchRanges(t *testing.T) {
+	formatted, err := Format("match n:\n    case 4..9:\n        print \"medium\"\n    else:\n        print \"big\"\n")
+	if err != nil {
+		t.Fatalf("Format failed: %v", err)
+	}
+	if !strings.Contains(formatted, "case 4..9:") {
+		t.Errorf("expected the range to be kept, got:\n%s", formatted)
+	}
+}
+
+func TestFormatContinuedLines(t *testing.T) {
+	formatted, err := Format("int total = add(\n  1,\n        2\n)\nif total > 3 and \\\n  total < 9:\n    print total\n")
+	if err != nil {
+		t.Fatalf("Format failed: %v", err)
+	}
+	expected := "int total = add(\n    1,\n    2\n)\nif total > 3 and \\\n    total < 9:\n    print total\n"
+	if formatted != expected {
+		t.Errorf("Format() = %q, expected %q", formatted, expected)
+	}
+}
+
+func TestFormatStderrPrints(t *testing.T) {
+	formatted, err := Format("eprint   warning:  low\neput \"%d left\" |n\n")
+	if err != nil {
+		t.Fatalf("Format failed: %v", err)
+	}
+	expected := "eprint warning:  low\neput \"%d left\" | n\n"
+	if formatted != expected {
+		t.Errorf("Format() = %q, expected %q", formatted, expected)
+	}
+}
+
+func TestFormatImports(t *testing.T) {
+	formatted, err := Format("import std/string\nimport   std/math\nimport \"std/io\"\nimport std/math\nimport std/fs\n\nprint done\n")
+	if err != nil {
+		t.Fatalf("Format failed: %v", err)
+	}
+	expected := "import std/fs\nimport \"std/io\"\nimport std/math\nimport std/string\n\nprint done\n"
+	if formatted != expected {
+		t.Errorf("Format() = %q, expected %q", formatted, expected)
+	}
+}
+
+func TestFormatInvalid(t *testing.T) {
+	if _, err := Format("fn broken(:\n    return\n"); err == nil {
+		t.Error("expected an error for a source that does not parse")
+	}
+}
@@ -95,6 +95,10 @@ func (av *ArgumentValidator) ValidateFunctionCall(funcCall *FunctionCallStmt, li
 	actualCount := len(funcCall.Args)
 
 	if actualCount != expectedCount {
+		// Functions of modules are named as they are written, module::name.
+		if signature.Module != "" {
+			funcName = signature.Module + "::" + signature.Name
+		}
 		return fmt.Errorf("line %d: function '%s' expects %d arguments, but %d were provided",
 			line, funcName, expectedCount, actualCount)
 	}
@@ -144,7 +148,7 @@ func (av *ArgumentValidator) ValidateStringFunctionCall(expr string, line int) e
 	}
 	funcName := strings.TrimSpace(expr[:parenStart])
 	argsStr := strings.TrimSpace(expr[parenStart+1 : parenEnd])
-	args := parseArguments(argsStr)
+	args := parseArgumentsRespectingNesting(argsStr)
 	tempCall := &FunctionCallStmt{
 		Name: funcName,
 		Args: args,
@@ -161,43 +165,6 @@ func (av *ArgumentValidator) ValidateStringFunctionCall(expr string, line int) e
 	return nil
 }
 
-// Parses function arguments while respecting nested parentheses
-func parseArguments(argsStr string) []string {
-	if strings.TrimSpace(argsStr) == "" {
-		return []string{}
-	}
-
-	var args []string
-	var current strings.Builder
-	parenDepth := 0
-
-	for _, char := range argsStr {
-		switch char {
-		case '(':
-			parenDepth++
-			current.WriteRune(char)
-		case ')':
-			parenDepth--
-			current.WriteRune(char)
-		case ',':
-			if parenDepth == 0 {
-				args = append(args, strings.TrimSpace(current.String()))
-				current.Reset()
-			} else {
-				current.WriteRune(char)
-			}
-		default:
-			current.WriteRune(char)
-		}
-	}
-
-	if current.Len() > 0 {
-		args = append(args, strings.TrimSpace(current.String()))
-	}
-
-	return args
-}
-
 // Validates all function calls in a program
 func ValidateProgram(program *Program) []error {
 	validator := NewArgumentValidator()
@@ -230,6 +197,9 @@ func ValidateProgram(program *Program) []error {
 				"",
 			)
 		}
+		if stmt.ExternFunc != nil {
+			validator.RegisterFunction(stmt.ExternFunc.Name, stmt.ExternFunc.Parameters, stmt.ExternFunc.ReturnType, "")
+		}
 		if stmt.PubTopLevelFuncDecl != nil {
 			if stmt.PubTopLevelFuncDecl.Name == "main" {
 				errors = append(errors, fmt.Errorf("function name 'main' is reserved and cannot be used. use top-level statements."))
@@ -261,6 +231,9 @@ func ValidateProgram(program *Program) []error {
 // Validates function calls in a statement and its nested statements
 func validateStatementRecursive(stmt *Statement, validator *ArgumentValidator, line int) []error {
 	var errors []error
+	if stmt.Line > 0 {
+		line = stmt.Line
+	}
 
 	if stmt.FunctionCall != nil {
 		if err := validator.ValidateFunctionCall(stmt.FunctionCall, line); err != nil {
@@ -316,6 +289,21 @@ func validateStatementRecursive(stmt *Statement, validator *ArgumentValidator, l
 		}
 	}
 
+	if stmt.Match != nil {
+		for _, arm := range stmt.Match.Cases {
+			for _, nestedStmt := range arm.Body {
+				nestedErrors := validateStatementRecursive(nestedStmt, validator, line)
+				errors = append(errors, nestedErrors...)
+			}
+		}
+		if stmt.Match.Else != nil {
+			for _, nestedStmt := range stmt.Match.Else.Body {
+				nestedErrors := validateStatementRecursive(nestedStmt, validator, line)
+				errors = append(errors, nestedErrors...)
+			}
+		}
+	}
+
 	if stmt.While != nil {
 		for _, nestedStmt := range stmt.While.Body {
 			nestedErrors := validateStatementRecursive(nestedStmt, validator, line)
@@ -330,6 +318,20 @@ func validateStatementRecursive(stmt *Statement, validator *ArgumentValidator, l
 		}
 	}
 
+	if stmt.Test != nil {
+		for _, nestedStmt := range stmt.Test.Body {
+			nestedErrors := validateStatementRecursive(nestedStmt, validator, line)
+			errors = append(errors, nestedErrors...)
+		}
+	}
+
+	if stmt.Bench != nil {
+		for _, nestedStmt := range stmt.Bench.Body {
+			nestedErrors := validateStatementRecursive(nestedStmt, validator, line)
+			errors = append(errors, nestedErrors...)
+		}
+	}
+
 	if stmt.TopLevelFuncDecl != nil {
 		for _, nestedStmt := range stmt.TopLevelFuncDecl.Body {
 			nestedErrors := validateStatementRecursive(nestedStmt, validator, line)
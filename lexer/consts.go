@@ -0,0 +1,186 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains the parsing of constant and fixed-size array declarations, and the
+// folding of integer constant expressions such as MAX * 2 used as array sizes.
+
+package lexer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Types a constant may have.
+var constTypes = map[string]bool{
+	"int": true, "float": true, "double": true, "bool": true, "char": true, "string": true,
+	"u16": true, "u32": true, "u64": true, "i16": true, "i32": true, "i64": true, "f32": true, "f64": true,
+}
+
+// Reports whether a constant of a type can size an array.
+func IsIntegerConstType(typ string) bool {
+	switch typ {
+	case "int", "u16", "u32", "u64", "i16", "i32", "i64":
+		return true
+	}
+	return false
+}
+
+// Parses const type NAME = value, which is only allowed at the top level.
+func parseConstDeclaration(line string, lineNum, currentIndent int, public bool) (*Statement, int, error) {
+	if currentIndent > 0 {
+		return nil, lineNum + 1, fmt.Errorf("const declarations are only allowed at the top level at line %d", lineNum+1)
+	}
+	decl, value, found := strings.Cut(line, "=")
+	parts := strings.Fields(decl)
+	value = strings.TrimSpace(value)
+	if !found || len(parts) != 3 || parts[0] != "const" || value == "" {
+		return nil, lineNum + 1, fmt.Errorf("const declaration format error at line %d (expected: const type NAME = value)", lineNum+1)
+	}
+	if !constTypes[parts[1]] {
+		return nil, lineNum + 1, fmt.Errorf("invalid const type '%s' at line %d", parts[1], lineNum+1)
+	}
+	return &Statement{ConstDecl: &ConstDeclStmt{
+		Type:   parts[1],
+		Name:   parts[2],
+		Value:  value,
+		Public: public,
+	}}, lineNum + 1, nil
+}
+
+// Splits an array type such as int[MAX] into its element type and size.
+func ParseArrayType(typ string) (string, string, bool) {
+	open := strings.Index(typ, "[")
+	if open <= 0 || !strings.HasSuffix(typ, "]") || strings.HasPrefix(typ, "list[") {
+		return "", "", false
+	}
+	elemType, size := typ[:open], strings.TrimSpace(typ[open+1:len(typ)-1])
+	if size == "" || !isValidType(elemType) {
+		return "", "", false
+	}
+	return elemType, size, true
+}
+
+// Parses an array declaration such as int[MAX] buf, whose elements start zeroed.
+func parseArrayDeclaration(line string, lineNum int) (*Statement, int, error) {
+	open, close := strings.Index(line, "["), strings.Index(line, "]")
+	parts := strings.Fields(line[close+1:])
+	if len(parts) != 1 {
+		return nil, lineNum + 1, fmt.Errorf("array declaration format error at line %d (expected: type[size] name)", lineNum+1)
+	}
+	return &Statement{ArrayDecl: &ArrayDeclStmt{
+		Type: strings.TrimSpace(line[:open]),
+		Size: strings.TrimSpace(line[open+1 : close]),
+		Name: parts[0],
+	}}, lineNum + 1, nil
+}
+
+// Folds an integer constant expression, resolving names and module members
+// such as limits.MAX through lookup.
+func FoldConstInt(src string, lookup func(name string) (int64, bool)) (int64, bool) {
+	expr, err := ParseExpr(src)
+	if err != nil {
+		return 0, false
+	}
+	return foldInt(expr, lookup)
+}
+
+// Folds the value of a constant of a module, following the integer constants
+// it names, found by their C names through decl, to their values. Names refer
+// to the other constants of the module unless they are qualified.
+func FoldConst(value, module string, decl func(name string) *ConstDeclStmt) (int64, bool) {
+	return foldConstIn(value, module, decl, make(map[string]bool))
+}
+
+func foldConstIn(value, module string, decl func(name string) *ConstDeclStmt, visiting map[string]bool) (int64, bool) {
+	return FoldConstInt(value, func(name string) (int64, bool) {
+		key, declModule := name, module
+		if owner, member, qualified := strings.Cut(name, "."); qualified {
+			key, declModule = GenerateUniqueSymbol(member, owner), owner
+		} else {
+			key = GenerateUniqueSymbol(name, module)
+		}
+		d := decl(key)
+		if d == nil || visiting[key] || !IsIntegerConstType(d.Type) {
+			return 0, false
+		}
+		visiting[key] = true
+		defer delete(visiting, key)
+		return foldConstIn(d.Value, declModule, decl, visiting)
+	})
+}
+
+func foldInt(expr Expr, lookup func(name string) (int64, bool)) (int64, bool) {
+	switch e := expr.(type) {
+	case *LiteralExpr:
+		if e.Kind != IntLiteral {
+			return 0, false
+		}
+		n, err := strconv.ParseInt(e.Value, 0, 64)
+		return n, err == nil
+	case *IdentExpr:
+		return lookup(e.Name)
+	case *MemberExpr:
+		if module, ok := e.Object.(*IdentExpr); ok {
+			return lookup(module.Name + "." + e.Member)
+		}
+	case *ParenExpr:
+		return foldInt(e.Inner, lookup)
+	case *UnaryExpr:
+		n, ok := foldInt(e.Operand, lookup)
+		switch {
+		case !ok:
+			return 0, false
+		case e.Op == "-":
+			return -n, true
+		case e.Op == "+":
+			return n, true
+		case e.Op == "~":
+			return ^n, true
+		}
+	case *BinaryExpr:
+		left, ok := foldInt(e.Left, lookup)
+		if !ok {
+			return 0, false
+		}
+		right, ok := foldInt(e.Right, lookup)
+		if !ok {
+			return 0, false
+		}
+		switch e.Op {
+		case "+":
+			return left + right, true
+		case "-":
+			return left - right, true
+		case "*":
+			return left * right, true
+		case "/", "%":
+			if right == 0 {
+				return 0, false
+			}
+			if e.Op == "/" {
+				return left / right, true
+			}
+			return left % right, true
+		case "<<", ">>":
+			// Shifting by a negative count or by the width of the value or
+			// more is undefined in C, so such shifts are left unfolded.
+			if right < 0 || right >= 64 {
+				return 0, false
+			}
+			if e.Op == "<<" {
+				return left << right, true
+			}
+			return left >> right, true
+		case "&":
+			return left & right, true
+		case "|":
+			return left | right, true
+		case "^":
+			return left ^ right, true
+		}
+	}
+	return 0, false
+}
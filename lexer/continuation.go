@@ -0,0 +1,107 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains the joining of statements written over several lines.
+//
+// A line ending in a backslash continues on the next line, as does a line
+// leaving a parenthesis, bracket or brace open, until it is closed. The lines
+// of a statement are joined into its first line and the lines it continued
+// on are left empty, so statements keep the line numbers they are written at.
+
+package lexer
+
+import "strings"
+
+// Joins the statements continued over several lines into their first line.
+// The C code of $raw blocks is left as it is.
+func joinContinuedLines(lines []string) []string {
+	for i := 0; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "$raw") {
+			for depth := 0; i < len(lines); i++ {
+				if depth += bracketDepth(lines[i]); depth <= 0 {
+					break
+				}
+			}
+			continue
+		}
+
+		var (
+			indent = getIndentation(lines[i])
+			joined = strings.TrimRight(lines[i], " \t\r")
+			depth  = bracketDepth(joined)
+		)
+		for next := i + 1; next < len(lines); next++ {
+			explicit := strings.HasSuffix(joined, `\`) && !endsInString(joined)
+			if !explicit && depth <= 0 {
+				break
+			}
+			part := strings.TrimSpace(lines[next])
+			if part == "" || strings.HasPrefix(part, "#") {
+				continue
+			}
+			// A bracket left open by mistake does not swallow the statements
+			// following it, which are indented no deeper than it.
+			closing := strings.ContainsAny(part[:1], ")]}")
+			if !explicit && !closing && getIndentation(lines[next]) <= indent {
+				break
+			}
+			joined = strings.TrimRight(strings.TrimSuffix(joined, `\`), " \t")
+			if joined == "" || closing || strings.ContainsAny(joined[len(joined)-1:], "([{") {
+				joined += part
+			} else {
+				joined += " " + part
+			}
+			lines[next] = ""
+			depth += bracketDepth(part)
+		}
+		lines[i] = joined
+	}
+	return lines
+}
+
+// Returns the number of parentheses, brackets and braces a line opens minus
+// the number it closes, leaving out those in string and character literals.
+func bracketDepth(line string) int {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch ch := line[i]; {
+		case quote != 0 && ch == '\\':
+			i++
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '"' || ch == '\'':
+			quote = ch
+		case ch == '(' || ch == '[' || ch == '{':
+			depth++
+		case ch == ')' || ch == ']' || ch == '}':
+			depth--
+		}
+	}
+	return depth
+}
+
+// Reports whether a line ends inside a string or character literal.
+func endsInString(line string) bool {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch ch := line[i]; {
+		case quote != 0 && ch == '\\':
+			i++
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '"' || ch == '\'':
+			quote = ch
+		}
+	}
+	return quote != 0
+}
@@ -0,0 +1,74 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains the detection of names defined more than once at the top level of
+// a program or module. Classes, interfaces, structs, enums, functions, public
+// variables and constants share a single namespace, as they become C symbols
+// of the same name.
+
+package lexer
+
+import "scar/diagnostics"
+
+// A top-level declaration of a program or module.
+type Definition struct {
+	Kind string
+	Name string
+	Line int
+}
+
+// Returns the top-level declarations among statements, in source order.
+func Definitions(statements []*Statement) []Definition {
+	var defs []Definition
+	for _, stmt := range statements {
+		var kind, name string
+		switch {
+		case stmt.ClassDecl != nil:
+			kind, name = "class", stmt.ClassDecl.Name
+		case stmt.PubClassDecl != nil:
+			kind, name = "class", stmt.PubClassDecl.Name
+		case stmt.InterfaceDecl != nil:
+			kind, name = "interface", stmt.InterfaceDecl.Name
+		case stmt.StructDecl != nil:
+			kind, name = "struct", stmt.StructDecl.Name
+		case stmt.EnumDecl != nil:
+			kind, name = "enum", stmt.EnumDecl.Name
+		case stmt.PubEnumDecl != nil:
+			kind, name = "enum", stmt.PubEnumDecl.Name
+		case stmt.TopLevelFuncDecl != nil:
+			kind, name = "function", stmt.TopLevelFuncDecl.Name
+		case stmt.PubTopLevelFuncDecl != nil:
+			kind, name = "function", stmt.PubTopLevelFuncDecl.Name
+		case stmt.ExternFunc != nil:
+			kind, name = "function", stmt.ExternFunc.Name
+		case stmt.PubVarDecl != nil:
+			kind, name = "variable", stmt.PubVarDecl.Name
+		case stmt.ConstDecl != nil:
+			kind, name = "constant", stmt.ConstDecl.Name
+		default:
+			continue
+		}
+		defs = append(defs, Definition{Kind: kind, Name: name, Line: stmt.Line})
+	}
+	return defs
+}
+
+// Reports every top-level name defined more than once, at each definition
+// after the first.
+func CheckDuplicateDefinitions(statements []*Statement) []error {
+	var (
+		errs  []error
+		first = make(map[string]Definition)
+	)
+	for _, def := range Definitions(statements) {
+		previous, exists := first[def.Name]
+		if !exists {
+			first[def.Name] = def
+			continue
+		}
+		errs = append(errs, diagnostics.Errorf(def.Line, "duplicate definition of %s '%s', first defined as %s at line %d",
+			def.Kind, def.Name, previous.Kind, previous.Line))
+	}
+	return errs
+}
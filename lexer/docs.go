@@ -0,0 +1,82 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains the collection of doc comments.
+//
+// A doc comment is a run of lines starting with ## right above a declaration,
+// which it documents:
+//
+//	## Returns the area of a square.
+//	pub fn area(int side) -> int:
+//
+// A run at the top of a source that is followed by a blank line documents the
+// module instead. Comments are removed before a source is parsed, so the doc
+// comments are read from the original source and attached to the parsed
+// program afterwards.
+
+package lexer
+
+import (
+	"strings"
+)
+
+// Attaches the doc comments of source to the declarations of the program
+// parsed from it: the top level statements, the methods of classes and the
+// program itself for the doc comment of the module.
+func AttachDocComments(program *Program, source string) {
+	var (
+		docs  = docComments(source)
+		lines = strings.Split(source, "\n")
+	)
+	program.Doc = docs[0]
+	for _, stmt := range program.Statements {
+		stmt.Doc = docs[stmt.Line]
+		var methods []*MethodDeclStmt
+		switch {
+		case stmt.ClassDecl != nil:
+			methods = stmt.ClassDecl.Methods
+		case stmt.PubClassDecl != nil:
+			methods = stmt.PubClassDecl.Methods
+		}
+		// Methods have no line of their own, so they are found by their
+		// header below the class.
+		for _, method := range methods {
+			for i := stmt.Line; i < len(lines); i++ {
+				if strings.HasPrefix(strings.TrimSpace(lines[i]), "fn "+method.Name+"(") && getIndentation(lines[i]) > 0 {
+					method.Doc = docs[i+1]
+					break
+				}
+			}
+		}
+	}
+}
+
+// Returns the doc comments of a source by the line, counted from 1, of the
+// declaration each documents, with the doc comment of the module at line 0.
+func docComments(source string) map[int]string {
+	var (
+		docs    = make(map[int]string)
+		pending []string
+		code    bool
+	)
+	for i, line := range strings.Split(source, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if text, ok := strings.CutPrefix(trimmed, "##"); ok && !strings.HasPrefix(text, "#") {
+			pending = append(pending, strings.TrimPrefix(text, " "))
+			continue
+		}
+		switch {
+		case len(pending) == 0:
+		case trimmed == "" && !code && docs[0] == "":
+			docs[0] = strings.Join(pending, "\n")
+		case trimmed != "" && !strings.HasPrefix(trimmed, "#"):
+			docs[i+1] = strings.Join(pending, "\n")
+		}
+		pending = nil
+		if trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+			code = true
+		}
+	}
+	return docs
+}
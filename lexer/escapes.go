@@ -0,0 +1,129 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains the escape sequences of string literals.
+//
+// A backslash in a string literal starts one of the escape sequences \n, \t,
+// \r, \\, \" and \', an octal escape of one to three digits such as \0 or
+// \033, or a hex escape of two digits such as \x1b. Any other character after
+// a backslash is an error from language version 0.3, and is kept as written
+// by older versions. Statements keep their string literals as written, escape
+// sequences included. These mean the same in C, so a literal can be emitted
+// as it is, while printed text is decoded with Unescape and escaped again for
+// printf. As C reads every hex digit after \x, a hex escape followed by one is
+// rejected rather than read differently.
+
+package lexer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The characters the escape sequences of string literals stand for, by the
+// character following the backslash.
+var escapes = map[byte]byte{
+	'n':  '\n',
+	't':  '\t',
+	'r':  '\r',
+	'\\': '\\',
+	'"':  '"',
+	'\'': '\'',
+}
+
+// Returns the text the body of a string literal stands for, with its escape
+// sequences decoded.
+func Unescape(body string) (string, error) {
+	if !strings.Contains(body, `\`) {
+		return body, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(body); i++ {
+		if body[i] != '\\' {
+			b.WriteByte(body[i])
+			continue
+		}
+		if i+1 == len(body) {
+			return "", fmt.Errorf("string literal ends in an unfinished escape sequence")
+		}
+		if ch, ok := escapes[body[i+1]]; ok {
+			b.WriteByte(ch)
+			i++
+			continue
+		}
+		ch, size, err := numericEscape(body[i+1:])
+		switch {
+		case err != nil:
+			return "", err
+		case size > 0:
+			b.WriteByte(ch)
+			i += size
+		case LangVersionAtLeast("0.3"):
+			return "", fmt.Errorf("unknown escape sequence '\\%c' in string literal", body[i+1])
+		default:
+			b.WriteByte('\\')
+		}
+	}
+	return b.String(), nil
+}
+
+// Decodes the octal or hex escape at the start of s, which follows a
+// backslash, returning the byte it stands for and its length. The length is
+// zero when s does not start a numeric escape.
+func numericEscape(s string) (byte, int, error) {
+	isOctal := func(ch byte) bool { return ch >= '0' && ch <= '7' }
+	isHex := func(ch byte) bool { return strings.IndexByte("0123456789abcdefABCDEF", ch) >= 0 }
+	switch {
+	case isOctal(s[0]):
+		size := 1
+		for size < 3 && size < len(s) && isOctal(s[size]) {
+			size++
+		}
+		value, _ := strconv.ParseUint(s[:size], 8, 16)
+		if value > 0377 {
+			return 0, 0, fmt.Errorf("octal escape sequence '\\%s' in string literal is out of range", s[:size])
+		}
+		return byte(value), size, nil
+	case s[0] == 'x':
+		if len(s) < 3 || !isHex(s[1]) || !isHex(s[2]) {
+			return 0, 0, fmt.Errorf("hex escape sequence in string literal must have two digits, as in '\\x1b'")
+		}
+		if len(s) > 3 && isHex(s[3]) {
+			return 0, 0, fmt.Errorf("hex escape sequence '\\%s' in string literal is followed by a hex digit, use an octal escape instead", s[:3])
+		}
+		value, _ := strconv.ParseUint(s[1:3], 16, 8)
+		return byte(value), 3, nil
+	}
+	return 0, 0, nil
+}
+
+// Reports an error for the first string literal of a line holding an invalid
+// escape sequence. Character literals are skipped, and a literal the line
+// does not close is left for the parser to report.
+func checkEscapes(line string) error {
+	for i := 0; i < len(line); i++ {
+		quote := line[i]
+		if quote != '"' && quote != '\'' {
+			continue
+		}
+		end := i + 1
+		for end < len(line) && line[end] != quote {
+			if line[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(line) {
+			return nil
+		}
+		if quote == '"' {
+			if _, err := Unescape(line[i+1 : end]); err != nil {
+				return err
+			}
+		}
+		i = end
+	}
+	return nil
+}
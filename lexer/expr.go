@@ -0,0 +1,494 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains the expression parser, which turns expression source text into an
+// Expr tree of literals, identifiers, operators, calls, member and index access.
+
+package lexer
+
+import (
+	"fmt"
+	"strings"
+)
+
+type Expr interface {
+	exprNode()
+}
+
+type LiteralKind int
+
+const (
+	IntLiteral LiteralKind = iota
+	FloatLiteral
+	StringLiteral
+	CharLiteral
+	BoolLiteral
+	NilLiteral
+)
+
+type LiteralExpr struct {
+	Kind  LiteralKind
+	Value string
+}
+
+type IdentExpr struct {
+	Name string
+}
+
+type BinaryExpr struct {
+	Op    string
+	Left  Expr
+	Right Expr
+}
+
+type UnaryExpr struct {
+	Op      string
+	Operand Expr
+}
+
+type CallExpr struct {
+	Callee Expr
+	Args   []Expr
+}
+
+type MemberExpr struct {
+	Object Expr
+	Member string
+}
+
+type IndexExpr struct {
+	Object Expr
+	Index  Expr
+}
+
+// A slice such as items[lo:hi]; Low and High are nil when omitted.
+type SliceExpr struct {
+	Object Expr
+	Low    Expr
+	High   Expr
+}
+
+type NewExpr struct {
+	Class string
+	Args  []Expr
+}
+
+type ParenExpr struct {
+	Inner Expr
+}
+
+// A cast such as x as f64, converting a value to a number or enum type.
+type CastExpr struct {
+	Value Expr
+	Type  string
+}
+
+// A list literal such as [1, 2, 3], whose element type comes from where it
+// is used.
+type ListExpr struct {
+	Elements []Expr
+}
+
+func (*LiteralExpr) exprNode() {}
+func (*IdentExpr) exprNode()   {}
+func (*BinaryExpr) exprNode()  {}
+func (*UnaryExpr) exprNode()   {}
+func (*CallExpr) exprNode()    {}
+func (*MemberExpr) exprNode()  {}
+func (*IndexExpr) exprNode()   {}
+func (*SliceExpr) exprNode()   {}
+func (*NewExpr) exprNode()     {}
+func (*ParenExpr) exprNode()   {}
+func (*CastExpr) exprNode()    {}
+func (*ListExpr) exprNode()    {}
+
+// Binding power of each binary operator; higher binds tighter.
+var binaryPrecedence = map[string]int{
+	"or": 1, "||": 1,
+	"and": 2, "&&": 2,
+	"|":  3,
+	"^":  4,
+	"&":  5,
+	"==": 6, "!=": 6,
+	"<": 7, ">": 7, "<=": 7, ">=": 7,
+	"<<": 8, ">>": 8,
+	"+": 9, "-": 9,
+	"*": 10, "/": 10, "%": 10,
+}
+
+// Returns the binding power of a binary operator, or 0 if it is not one.
+func BinaryPrecedence(op string) int {
+	return binaryPrecedence[op]
+}
+
+type exprToken struct {
+	kind  string // "ident", "number", "string", "char", "op", "eof"
+	text  string
+	start int
+}
+
+type exprParser struct {
+	src    string
+	tokens []exprToken
+	pos    int
+}
+
+// Reports whether src is a single character literal such as 'a' or '\n'.
+func IsCharLiteral(src string) bool {
+	expr, err := ParseExpr(strings.TrimSpace(src))
+	if err != nil {
+		return false
+	}
+	literal, ok := expr.(*LiteralExpr)
+	return ok && literal.Kind == CharLiteral
+}
+
+// Parses a scar expression into an Expr tree.
+func ParseExpr(src string) (Expr, error) {
+	tokens, err := tokenizeExpr(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{src: src, tokens: tokens}
+	if p.peek().kind == "eof" {
+		return nil, fmt.Errorf("empty expression")
+	}
+	expr, err := p.parseBinary(1)
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != "eof" {
+		return nil, fmt.Errorf("unexpected '%s' in expression '%s'", tok.text, src)
+	}
+	return expr, nil
+}
+
+func tokenizeExpr(src string) ([]exprToken, error) {
+	var (
+		tokens []exprToken
+		i      = 0
+	)
+	for i < len(src) {
+		ch := src[i]
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\r' || ch == '\n':
+			i++
+		case ch == '"' || ch == '\'':
+			j := i + 1
+			for j < len(src) && src[j] != ch {
+				if src[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(src) {
+				return nil, fmt.Errorf("unterminated literal in expression '%s'", src)
+			}
+			kind := "string"
+			if ch == '\'' {
+				kind = "char"
+			}
+			tokens = append(tokens, exprToken{kind, src[i : j+1], i})
+			i = j + 1
+		case isExprDigit(ch) || (ch == '.' && i+1 < len(src) && isExprDigit(src[i+1])):
+			j := i
+			for j < len(src) && (isExprIdentChar(src[j]) || src[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, exprToken{"number", src[i:j], i})
+			i = j
+		case isExprIdentStart(ch):
+			j := i
+			for j < len(src) && isExprIdentChar(src[j]) {
+				j++
+			}
+			// Builtin macros such as get!(...) keep their bang.
+			if j+1 < len(src) && src[j] == '!' && src[j+1] == '(' {
+				j++
+			}
+			tokens = append(tokens, exprToken{"ident", src[i:j], i})
+			i = j
+		default:
+			op := string(ch)
+			if i+1 < len(src) {
+				switch two := src[i : i+2]; two {
+				case "==", "!=", "<=", ">=", "&&", "||", "<<", ">>", "->":
+					op = two
+				}
+			}
+			if !strings.Contains("+-*/%<>=!&|^~()[],.:", op[:1]) {
+				return nil, fmt.Errorf("unexpected character '%c' in expression '%s'", ch, src)
+			}
+			if op == "=" {
+				return nil, fmt.Errorf("assignment is not an expression in '%s'", src)
+			}
+			tokens = append(tokens, exprToken{"op", op, i})
+			i += len(op)
+		}
+	}
+	return append(tokens, exprToken{"eof", "", len(src)}), nil
+}
+
+func isExprDigit(ch byte) bool {
+	return ch >= '0' && ch <= '9'
+}
+
+func isExprIdentStart(ch byte) bool {
+	return ch == '_' || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z')
+}
+
+func isExprIdentChar(ch byte) bool {
+	return isExprIdentStart(ch) || isExprDigit(ch)
+}
+
+func (p *exprParser) peek() exprToken {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() exprToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != "eof" {
+		p.pos++
+	}
+	return tok
+}
+
+// Reports whether the current token is the given operator.
+func (p *exprParser) peekOp(op string) bool {
+	tok := p.peek()
+	return tok.kind == "op" && tok.text == op
+}
+
+func (p *exprParser) expect(op string) error {
+	if tok := p.next(); tok.kind != "op" || tok.text != op {
+		return fmt.Errorf("expected '%s' in expression '%s'", op, p.src)
+	}
+	return nil
+}
+
+// Returns the operator at the current position if it is a binary operator.
+func (p *exprParser) binaryOp() string {
+	tok := p.peek()
+	if tok.kind == "op" || (tok.kind == "ident" && (tok.text == "and" || tok.text == "or")) {
+		if binaryPrecedence[tok.text] > 0 {
+			return tok.text
+		}
+	}
+	return ""
+}
+
+func (p *exprParser) parseBinary(minPrec int) (Expr, error) {
+	left, err := p.parseCast()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.binaryOp()
+		prec := binaryPrecedence[op]
+		if op == "" || prec < minPrec {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseBinary(prec + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpr{Op: op, Left: left, Right: right}
+	}
+}
+
+// Parses an operand of a binary operator along with the casts applied to it.
+// As in Rust, as binds tighter than binary operators and looser than unary
+// ones, so a + b as f64 casts b and -x as i32 casts -x.
+func (p *exprParser) parseCast() (Expr, error) {
+	expr, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for tok := p.peek(); tok.kind == "ident" && tok.text == "as"; tok = p.peek() {
+		p.next()
+		typ := p.next()
+		if typ.kind != "ident" {
+			return nil, fmt.Errorf("expected a type after 'as' in expression '%s'", p.src)
+		}
+		expr = &CastExpr{Value: expr, Type: typ.text}
+	}
+	return expr, nil
+}
+
+func (p *exprParser) parseUnary() (Expr, error) {
+	tok := p.peek()
+	if tok.kind == "ident" && tok.text == "not" {
+		// As in Python, not binds looser than comparisons, so not a == b
+		// negates the whole comparison.
+		p.next()
+		operand, err := p.parseBinary(binaryPrecedence["and"] + 1)
+		if err != nil {
+			return nil, err
+		}
+		return &UnaryExpr{Op: tok.text, Operand: operand}, nil
+	}
+	if tok.kind == "op" && strings.Contains("-!~&*+", tok.text) && len(tok.text) == 1 {
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &UnaryExpr{Op: tok.text, Operand: operand}, nil
+	}
+	return p.parsePostfix()
+}
+
+func (p *exprParser) parsePostfix() (Expr, error) {
+	expr, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok := p.peek()
+		if tok.kind != "op" {
+			return expr, nil
+		}
+		switch tok.text {
+		case "(":
+			p.next()
+			args, err := p.parseArgs(")")
+			if err != nil {
+				return nil, err
+			}
+			expr = &CallExpr{Callee: expr, Args: args}
+		case "[":
+			p.next()
+			var index Expr
+			if !p.peekOp(":") {
+				if index, err = p.parseBinary(1); err != nil {
+					return nil, err
+				}
+			}
+			if p.peekOp(":") {
+				p.next()
+				slice := &SliceExpr{Object: expr, Low: index}
+				if !p.peekOp("]") {
+					if slice.High, err = p.parseBinary(1); err != nil {
+						return nil, err
+					}
+				}
+				if err := p.expect("]"); err != nil {
+					return nil, err
+				}
+				expr = slice
+				continue
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			expr = &IndexExpr{Object: expr, Index: index}
+		case ".", "->":
+			p.next()
+			member := p.next()
+			if member.kind != "ident" {
+				return nil, fmt.Errorf("expected member name after '%s' in expression '%s'", tok.text, p.src)
+			}
+			expr = &MemberExpr{Object: expr, Member: member.text}
+		default:
+			return expr, nil
+		}
+	}
+}
+
+// Parses a comma separated argument list up to the close token; the opening
+// paren or bracket is already consumed.
+func (p *exprParser) parseArgs(close string) ([]Expr, error) {
+	var args []Expr
+	if tok := p.peek(); tok.kind == "op" && tok.text == close {
+		p.next()
+		return args, nil
+	}
+	for {
+		arg, err := p.parseBinary(1)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		tok := p.next()
+		if tok.kind == "op" && tok.text == close {
+			return args, nil
+		}
+		if tok.kind != "op" || tok.text != "," {
+			return nil, fmt.Errorf("expected ',' or '%s' in expression '%s'", close, p.src)
+		}
+	}
+}
+
+func (p *exprParser) parsePrimary() (Expr, error) {
+	tok := p.next()
+	switch tok.kind {
+	case "number":
+		if strings.ContainsAny(tok.text, ".eE") && !strings.HasPrefix(tok.text, "0x") {
+			return &LiteralExpr{Kind: FloatLiteral, Value: tok.text}, nil
+		}
+		return &LiteralExpr{Kind: IntLiteral, Value: tok.text}, nil
+	case "string":
+		return &LiteralExpr{Kind: StringLiteral, Value: tok.text}, nil
+	case "char":
+		return &LiteralExpr{Kind: CharLiteral, Value: tok.text}, nil
+	case "ident":
+		switch tok.text {
+		case "true", "false":
+			return &LiteralExpr{Kind: BoolLiteral, Value: tok.text}, nil
+		case "nil":
+			return &LiteralExpr{Kind: NilLiteral, Value: tok.text}, nil
+		case "new":
+			return p.parseNew()
+		}
+		return &IdentExpr{Name: tok.text}, nil
+	case "op":
+		if tok.text == "(" {
+			inner, err := p.parseBinary(1)
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return &ParenExpr{Inner: inner}, nil
+		}
+		if tok.text == "[" {
+			elements, err := p.parseArgs("]")
+			if err != nil {
+				return nil, err
+			}
+			return &ListExpr{Elements: elements}, nil
+		}
+	}
+	if tok.kind == "eof" {
+		return nil, fmt.Errorf("unexpected end of expression '%s'", p.src)
+	}
+	return nil, fmt.Errorf("unexpected '%s' in expression '%s'", tok.text, p.src)
+}
+
+// Parses `new Class(args)`, where the class may be module qualified.
+func (p *exprParser) parseNew() (Expr, error) {
+	name := p.next()
+	if name.kind != "ident" {
+		return nil, fmt.Errorf("expected class name after 'new' in expression '%s'", p.src)
+	}
+	class := name.text
+	for tok := p.peek(); tok.kind == "op" && tok.text == "."; tok = p.peek() {
+		p.next()
+		part := p.next()
+		if part.kind != "ident" {
+			return nil, fmt.Errorf("expected class name after 'new' in expression '%s'", p.src)
+		}
+		class += "." + part.text
+	}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	args, err := p.parseArgs(")")
+	if err != nil {
+		return nil, err
+	}
+	return &NewExpr{Class: class, Args: args}, nil
+}
@@ -55,6 +55,18 @@ func processFunctionDependencies(body []*Statement) map[string]bool {
 				}
 			}
 
+		case stmt.Match != nil:
+			for _, arm := range stmt.Match.Cases {
+				for _, s := range arm.Body {
+					processStmt(s)
+				}
+			}
+			if stmt.Match.Else != nil {
+				for _, s := range stmt.Match.Else.Body {
+					processStmt(s)
+				}
+			}
+
 		case stmt.While != nil:
 			for _, s := range stmt.While.Body {
 				processStmt(s)
@@ -77,6 +89,9 @@ func processFunctionDependencies(body []*Statement) map[string]bool {
 			for _, s := range stmt.TryCatch.CatchBody {
 				processStmt(s)
 			}
+			for _, s := range stmt.TryCatch.FinallyBody {
+				processStmt(s)
+			}
 
 		case stmt.ClassDecl != nil:
 			for _, method := range stmt.ClassDecl.Methods {
@@ -0,0 +1,197 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains the aliased and selective forms of import.
+//
+// import geo as g lets the symbols of geo be referenced as g.Square or
+// g::area, and from geo import Square, area lets them be referenced by their
+// bare names. Both are resolved on the source text before it is parsed: every
+// alias is replaced by the module name and every selectively imported name is
+// qualified with its module, so the rest of the compiler only ever sees
+// geo.Square and geo::area.
+
+package lexer
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// The module a source refers to by an alias, and the module each selectively
+// imported name belongs to.
+type importAliases struct {
+	modules map[string]string
+	names   map[string]string
+}
+
+// Returns the name the symbols of a module are qualified with, which is the
+// module path without std/ or any directories.
+func ModuleBaseName(module string) string {
+	return path.Base(strings.TrimPrefix(strings.Trim(module, "\""), "std/"))
+}
+
+// Parses import module as alias, reporting false for other lines.
+func parseAliasedImport(line string) (*ImportStmt, bool) {
+	parts := strings.Fields(line)
+	if len(parts) != 4 || parts[0] != "import" || parts[2] != "as" || !isIdentifier(parts[3]) {
+		return nil, false
+	}
+	return &ImportStmt{Module: strings.Trim(parts[1], "\""), Alias: parts[3]}, true
+}
+
+// Parses from module import a, b.
+func parseFromImport(line string, lineNum int) (*ImportStmt, error) {
+	head, list, found := strings.Cut(line, " import ")
+	parts := strings.Fields(head)
+	if !found || len(parts) != 2 || parts[0] != "from" {
+		return nil, fmt.Errorf("from import format error at line %d (expected: from module import name, ...)", lineNum+1)
+	}
+	imp := &ImportStmt{Module: strings.Trim(parts[1], "\"")}
+	for name := range strings.SplitSeq(list, ",") {
+		name = strings.TrimSpace(name)
+		if !isIdentifier(name) {
+			return nil, fmt.Errorf("invalid name '%s' in from import at line %d", name, lineNum+1)
+		}
+		imp.Names = append(imp.Names, name)
+	}
+	return imp, nil
+}
+
+// Collects the aliases and selectively imported names of the top level
+// imports of a source.
+func collectImportAliases(lines []string) importAliases {
+	aliases := importAliases{modules: make(map[string]string), names: make(map[string]string)}
+	for i, line := range lines {
+		if getIndentation(line) > 0 {
+			continue
+		}
+		line = strings.TrimSpace(line)
+		if imp, ok := parseAliasedImport(line); ok {
+			aliases.modules[imp.Alias] = ModuleBaseName(imp.Module)
+		} else if strings.HasPrefix(line, "from ") {
+			if imp, err := parseFromImport(line, i); err == nil {
+				for _, name := range imp.Names {
+					aliases.names[name] = ModuleBaseName(imp.Module)
+				}
+			}
+		}
+	}
+	return aliases
+}
+
+// Replaces the import aliases of a source with the modules they stand for and
+// qualifies the names imported with from, leaving the import lines as they are.
+func ResolveImportAliases(source string) string {
+	lines := strings.Split(source, "\n")
+	aliases := collectImportAliases(lines)
+	if len(aliases.modules) == 0 && len(aliases.names) == 0 {
+		return source
+	}
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "import ") || strings.HasPrefix(trimmed, "from ") {
+			continue
+		}
+		lines[i] = aliases.rewrite(line, false)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Rewrites the references of a line, including those in the {expr} holes of
+// its strings. Names in holes become their C names such as geo_name, since
+// holes are not rewritten from geo::name.
+func (a importAliases) rewrite(line string, inHole bool) string {
+	var (
+		b        strings.Builder
+		inString = false
+	)
+	for i := 0; i < len(line); {
+		ch := line[i]
+		switch {
+		case ch == '\\' && inString && i+1 < len(line):
+			b.WriteString(line[i : i+2])
+			i += 2
+		case ch == '"':
+			inString = !inString
+			b.WriteByte(ch)
+			i++
+		case ch == '{' && inString && i+1 < len(line) && line[i+1] == '{':
+			b.WriteString("{{")
+			i += 2
+		case ch == '{' && inString:
+			end := holeEnd(line, i)
+			if end < 0 {
+				b.WriteByte(ch)
+				i++
+				continue
+			}
+			b.WriteString("{" + a.rewrite(line[i+1:end], true) + "}")
+			i = end + 1
+		case ch == '\'' && !inString:
+			j := i + 1
+			for j < len(line) && line[j] != '\'' {
+				if line[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			j = min(j+1, len(line))
+			b.WriteString(line[i:j])
+			i = j
+		case isExprIdentStart(ch) && !inString:
+			j := i
+			for j < len(line) && isExprIdentChar(line[j]) {
+				j++
+			}
+			b.WriteString(a.resolve(line, i, j, inHole))
+			i = j
+		case isExprDigit(ch) && !inString:
+			j := i
+			for j < len(line) && isExprIdentChar(line[j]) {
+				j++
+			}
+			b.WriteString(line[i:j])
+			i = j
+		default:
+			b.WriteByte(ch)
+			i++
+		}
+	}
+	return b.String()
+}
+
+// Returns the replacement of the identifier at line[start:end].
+func (a importAliases) resolve(line string, start, end int, inHole bool) string {
+	ident := line[start:end]
+	if start > 0 && line[start-1] == '.' || strings.HasSuffix(line[:start], "::") {
+		return ident
+	}
+	rest := line[end:]
+	if module, ok := a.modules[ident]; ok && (strings.HasPrefix(rest, ".") || strings.HasPrefix(rest, "::")) {
+		return module
+	}
+	if module, ok := a.names[ident]; ok && !strings.HasPrefix(rest, "::") {
+		if inHole {
+			return GenerateUniqueSymbol(ident, module)
+		}
+		return module + "::" + ident
+	}
+	return ident
+}
+
+// Reports an error when a name imported with from is not a public symbol of
+// its module.
+func CheckImportedNames(imp *ImportStmt, module *ModuleInfo) error {
+	for _, name := range imp.Names {
+		_, isVar := module.PublicVars[name]
+		_, isClass := module.PublicClasses[name]
+		_, isFunc := module.PublicFuncs[name]
+		_, isConst := module.PublicConsts[name]
+		if !isVar && !isClass && !isFunc && !isConst {
+			return fmt.Errorf("module '%s' has no public symbol '%s'", imp.Module, name)
+		}
+	}
+	return nil
+}
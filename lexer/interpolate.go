@@ -0,0 +1,75 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains the splitting of interpolated strings such as "Hello {name}" into
+// literal text and the expressions of their holes.
+
+package lexer
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Splits the body of a string literal into the literal segments around its
+// {expr} holes and the hole expressions, so len(segments) == len(holes)+1.
+// Doubled braces stand for literal braces, and empty or unclosed braces are
+// kept as they are. A hole names module members as module::name, as code
+// outside of strings does. Reports false when the text has neither holes nor
+// doubled braces, and an error when a hole is not a valid expression.
+func Interpolate(text string) (segments, holes []string, ok bool, err error) {
+	var literal strings.Builder
+	for i := 0; i < len(text); i++ {
+		switch ch := text[i]; {
+		case (ch == '{' || ch == '}') && i+1 < len(text) && text[i+1] == ch:
+			literal.WriteByte(ch)
+			i++
+			ok = true
+		case ch == '{':
+			end := holeEnd(text, i)
+			if end < 0 {
+				literal.WriteByte(ch)
+				continue
+			}
+			hole := ReplaceDoubleColonsOutsideStrings(strings.TrimSpace(text[i+1 : end]))
+			if hole == "" {
+				literal.WriteByte(ch)
+				continue
+			}
+			if _, err := ParseExpr(hole); err != nil {
+				return nil, nil, false, fmt.Errorf("invalid expression '%s' in string interpolation, write {{ and }} for literal braces", strings.TrimSpace(text[i+1:end]))
+			}
+			segments = append(segments, literal.String())
+			holes = append(holes, hole)
+			literal.Reset()
+			i = end
+			ok = true
+		default:
+			literal.WriteByte(ch)
+		}
+	}
+	return append(segments, literal.String()), holes, ok, nil
+}
+
+// Returns the index of the brace closing the hole opened at start, or -1.
+func holeEnd(text string, start int) int {
+	depth, inString := 0, false
+	for i := start; i < len(text); i++ {
+		switch ch := text[i]; {
+		case inString && ch == '\\':
+			i++
+		case ch == '"':
+			inString = !inString
+		case inString:
+		case ch == '{':
+			depth++
+		case ch == '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
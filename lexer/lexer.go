@@ -10,10 +10,16 @@ import (
 	"fmt"
 	"slices"
 	"strings"
+
+	"scar/diagnostics"
 )
 
+// An import of a module, optionally under an alias as in import geo as g, or
+// of some of its names as in from geo import Square, area.
 type ImportStmt struct {
 	Module string
+	Alias  string
+	Names  []string
 }
 
 type ModuleInfo struct {
@@ -22,11 +28,20 @@ type ModuleInfo struct {
 	PublicVars    map[string]*VarDeclStmt
 	PublicClasses map[string]*ClassDeclStmt
 	PublicFuncs   map[string]*MethodDeclStmt
+	PublicConsts  map[string]*ConstDeclStmt
+	// Names of the modules this module imports.
+	Imports []string
+	// Whether the module is one of the standard library, imported as std/name.
+	Std bool
+	// The C functions the module declares with extern fn.
+	Externs []*ExternFuncStmt
 }
 
 type Program struct {
 	Imports    []*ImportStmt
 	Statements []*Statement
+	// The doc comment of the module, see AttachDocComments.
+	Doc string
 }
 
 type Statement struct {
@@ -37,6 +52,7 @@ type Statement struct {
 	For                  *ForStmt
 	Put                  *PutStmt
 	If                   *IfStmt
+	Match                *MatchStmt
 	Break                *BreakStmt
 	Continue             *ContinueStmt
 	VarDecl              *VarDeclStmt
@@ -44,7 +60,12 @@ type Statement struct {
 	IndexAssign          *IndexAssignStmt
 	ListDecl             *ListDeclStmt
 	ClassDecl            *ClassDeclStmt
+	InterfaceDecl        *InterfaceDeclStmt
 	EnumDecl             *EnumDeclStmt
+	StructDecl           *StructDeclStmt
+	ConstDecl            *ConstDeclStmt
+	ArrayDecl            *ArrayDeclStmt
+	Delete               *DeleteStmt
 	MethodCall           *MethodCallStmt
 	ObjectDecl           *ObjectDeclStmt
 	Return               *ReturnStmt
@@ -55,6 +76,7 @@ type Statement struct {
 	PubClassDecl         *PubClassDeclStmt
 	PubEnumDecl          *PubEnumDeclStmt
 	TopLevelFuncDecl     *TopLevelFuncDeclStmt
+	ExternFunc           *ExternFuncStmt
 	FunctionCall         *FunctionCallStmt
 	TryCatch             *TryCatchStmt
 	Throw                *ThrowStmt
@@ -66,6 +88,10 @@ type Statement struct {
 	PubTopLevelFuncDecl  *PubTopLevelFuncDeclStmt
 	PutMap               *PutMapStmt
 	GetMap               *GetMapStmt
+	DelMap               *DelMapStmt
+	SetDecl              *SetDeclStmt
+	SetAdd               *SetElemStmt
+	SetRemove            *SetElemStmt
 	Foreach              *ForeachStmt
 	CatString            *CatStringStmt
 	CatList              *CatListStmt
@@ -73,6 +99,15 @@ type Statement struct {
 	ListDeclFunctionCall *ListDeclFunctionCallStmt
 	ListOf               *ListOfStmt
 	ListOfDecl           *ListOfDeclStmt
+	Test                 *TestStmt
+	Bench                *BenchStmt
+	Assert               *AssertStmt
+	Spawn                *SpawnStmt
+	Join                 *JoinStmt
+	Breakpoint           *BreakpointStmt
+	Line                 int
+	// The doc comment of a declaration, see AttachDocComments.
+	Doc string
 }
 
 type ListOfDeclStmt struct {
@@ -100,12 +135,18 @@ type ForeachStmt struct {
 	VarName    string
 	Collection string
 	Body       []*Statement
+	Label      string
 }
 
 type PutStmt struct {
 	Put       string
 	Format    string
 	Variables []string
+	// Literal text around the holes of an interpolated string, with one
+	// more segment than there are holes in Variables.
+	Segments []string
+	// Whether the statement is an eput, writing to stderr.
+	Stderr bool
 }
 
 type PutMapStmt struct {
@@ -119,6 +160,11 @@ type GetMapStmt struct {
 	Key     string
 }
 
+type DelMapStmt struct {
+	MapName string
+	Key     string
+}
+
 type PubTopLevelFuncDeclStmt struct {
 	Name       string
 	Parameters []*MethodParameter
@@ -131,29 +177,74 @@ type ParallelForStmt struct {
 	Start string
 	End   string
 	Body  []*Statement
+	// The reduce(op: vars) clauses of the loop, such as "+: total".
+	Reductions []string
+	// The number of threads from threads(n), empty for the runtime default.
+	Threads string
+	// The schedule from schedule(kind, chunk), such as "dynamic, 4", empty
+	// for the runtime default.
+	Schedule string
 }
 
 type PubVarDeclStmt struct {
 	Type  string
 	Name  string
 	Value string
+	// Whether the variable was declared atomic, see VarDeclStmt.
+	Atomic bool
 }
 
+// An enum names integer constants. Values holds the member names in order and
+// Discriminants the explicit values of members declared as NAME = value.
 type EnumDeclStmt struct {
-	IsPublic bool
-	Name     string
-	Values   []string
+	IsPublic      bool
+	Name          string
+	Values        []string
+	Discriminants map[string]string
 }
 
-type PubEnumDeclStmt struct {
+// A struct is a plain record of fields that is copied by value, unlike class
+// instances which are heap allocated and passed by pointer.
+type StructDeclStmt struct {
 	Name   string
-	Values []string
+	Fields []StructField
+}
+
+type StructField struct {
+	Type string
+	Name string
+}
+
+// A constant is a top level value fixed at compile time, which may size
+// arrays when it is an integer.
+type ConstDeclStmt struct {
+	Type   string
+	Name   string
+	Value  string
+	Public bool
+}
+
+// An array is a fixed-size buffer such as int[64] buf, whose size is an
+// integer constant expression.
+type ArrayDeclStmt struct {
+	Type string
+	Size string
+	Name string
+}
+
+type PubEnumDeclStmt struct {
+	Name          string
+	Values        []string
+	Discriminants map[string]string
 }
 
 type PubClassDeclStmt struct {
 	Name        string
+	Base        string
+	Interfaces  []string
 	Constructor *ConstructorStmt
 	Methods     []*MethodDeclStmt
+	Deinit      []*Statement
 }
 
 type VarDeclMethodCallStmt struct {
@@ -184,6 +275,18 @@ type MapDeclStmt struct {
 	Pairs     []MapPair
 }
 
+type SetDeclStmt struct {
+	ElemType string
+	Name     string
+	Elements []string
+}
+
+// An add!(set, value) or remove!(set, value) statement.
+type SetElemStmt struct {
+	SetName string
+	Value   string
+}
+
 type ListOfStmt struct {
 	Type  string
 	Value string
@@ -213,15 +316,42 @@ type PrintStmt struct {
 	Print     string
 	Format    string
 	Variables []string
+	// Literal text around the holes of an interpolated string, with one
+	// more segment than there are holes in Variables.
+	Segments []string
+	// Whether the statement is an eprint, writing to stderr.
+	Stderr bool
 }
 
 type SleepStmt struct {
 	Duration string
+	// The unit of the duration: "s" for sleep, "ms" for sleep_ms and "us"
+	// for sleep_us.
+	Unit string
+}
+
+// Starts a function call on a new thread: spawn f(...), or with a handle to
+// join it later, var t = spawn f(...) or thread t = spawn f(...).
+type SpawnStmt struct {
+	// The variable the thread is declared as, empty for a thread that is
+	// never joined.
+	Handle string
+	Call   string
+}
+
+// Waits for the thread a handle declared by spawn to finish.
+type JoinStmt struct {
+	Handle string
 }
 
+// Stops the program in the debugger it runs under. Breakpoints are only
+// compiled into builds made with --debug.
+type BreakpointStmt struct{}
+
 type WhileStmt struct {
 	Condition string
 	Body      []*Statement
+	Label     string
 }
 
 type RawCodeStmt struct {
@@ -233,6 +363,7 @@ type ForStmt struct {
 	Start string
 	End   string
 	Body  []*Statement
+	Label string
 }
 
 type IfStmt struct {
@@ -251,24 +382,55 @@ type ElseStmt struct {
 	Body []*Statement
 }
 
+type MatchStmt struct {
+	Value string
+	Cases []*CaseStmt
+	Else  *ElseStmt
+}
+
+type CaseStmt struct {
+	Values []string
+	Body   []*Statement
+	Line   int
+}
+
+// Frees the object held by a variable or field, running its deinit block.
+type DeleteStmt struct {
+	Target string
+}
+
 type BreakStmt struct {
-	Break string
+	Break  string
+	Target LoopTarget
+}
+
+// Names the loop a break or continue applies to, either by label or by how
+// many loops out it is. The zero value is the innermost loop.
+type LoopTarget struct {
+	Label  string
+	Levels int
 }
 
 type ContinueStmt struct {
 	Continue string
+	Target   LoopTarget
 }
 
 type VarDeclStmt struct {
-	Type  string
-	Name  string
-	Value string
-	IsRef bool
+	Type   string
+	Name   string
+	Value  string
+	IsRef  bool
+	Quoted bool
+	// Whether the variable was declared atomic int, so assignments to it
+	// are safe from the iterations of a parallel for and other threads.
+	Atomic bool
 }
 
 type VarAssignStmt struct {
-	Name  string
-	Value string
+	Name   string
+	Value  string
+	Quoted bool
 }
 
 type IndexAssignStmt struct {
@@ -285,8 +447,18 @@ type ListDeclStmt struct {
 
 type ClassDeclStmt struct {
 	Name        string
+	Base        string
+	Interfaces  []string
 	Constructor *ConstructorStmt
 	Methods     []*MethodDeclStmt
+	Deinit      []*Statement
+}
+
+// An interface lists the method signatures a class must provide. Its methods
+// have no body.
+type InterfaceDeclStmt struct {
+	Name    string
+	Methods []*MethodDeclStmt
 }
 
 type ConstructorStmt struct {
@@ -300,6 +472,7 @@ type MethodParameter struct {
 	ListType string
 	Name     string
 	IsRef    bool
+	Default  string
 }
 
 type MethodDeclStmt struct {
@@ -307,6 +480,7 @@ type MethodDeclStmt struct {
 	Parameters []*MethodParameter
 	ReturnType string
 	Body       []*Statement
+	Doc        string
 }
 
 type MethodCallStmt struct {
@@ -332,6 +506,16 @@ type IndexAccess struct {
 	Index    string
 }
 
+// A C function declared with extern fn name(params) -> type from "header.h",
+// which is called directly. Header is empty when the function is declared by
+// a prototype instead of a header, such as one of a library linked with --link.
+type ExternFuncStmt struct {
+	Name       string
+	Parameters []*MethodParameter
+	ReturnType string
+	Header     string
+}
+
 type TopLevelFuncDeclStmt struct {
 	Name       string
 	Parameters []*MethodParameter
@@ -345,12 +529,39 @@ type FunctionCallStmt struct {
 }
 
 type TryCatchStmt struct {
-	TryBody   []*Statement
-	CatchBody []*Statement
+	TryBody     []*Statement
+	CatchVar    string
+	CatchBody   []*Statement
+	FinallyBody []*Statement
 }
 
 type ThrowStmt struct {
-	Value string
+	Value   string
+	Message string
+}
+
+// A test "name": block, which is only compiled by scar test.
+type TestStmt struct {
+	Name string
+	Body []*Statement
+}
+
+// A bench "name": block, which is only compiled by scar bench.
+type BenchStmt struct {
+	Name string
+	Body []*Statement
+}
+
+// An assert!(condition), assert_eq!(left, right) or assert condition,
+// "message" statement.
+type AssertStmt struct {
+	Condition string
+	// The operands compared by assert_eq!, which leaves Condition empty.
+	Left, Right string
+	// Whether the statement is an assert, which release builds leave out, and
+	// the message it fails with, if any.
+	DebugOnly bool
+	Message   string
 }
 
 type VarDeclReadStmt struct {
@@ -361,11 +572,64 @@ type VarDeclReadStmt struct {
 
 var LoadedModules = make(map[string]*ModuleInfo)
 
+// Names of the structs declared in the sources parsed so far, which are valid
+// types anywhere in a program regardless of where they are declared.
+var structTypes = make(map[string]bool)
+
+// Names of the enums declared in the sources parsed so far, which are valid
+// types like structs.
+var enumTypes = make(map[string]bool)
+
+// Names of the classes declared in the sources parsed so far, so variables of
+// a class type can be declared from any value, such as a call returning one.
+var classTypes = make(map[string]bool)
+
+// Base names of the modules imported by the sources parsed so far, so a class
+// of one may be named module::Class, which reads as module_Class once the ::
+// are replaced.
+var importedModules = make(map[string]bool)
+
+// Parses a program. The parser goes on with the next statement after an
+// error, so up to MaxParseErrors errors are reported at once as a list of
+// diagnostics.
 func ParseWithIndentation(input string) (*Program, error) {
-	var (
-		lines           = strings.Split(input, "\n")
-		statements, err = parseStatements(lines, 0, 0)
-	)
+	// Modules are parsed while their importer is, so the errors of the
+	// importer are put aside meanwhile.
+	saved := parseErrors
+	parseErrors = nil
+	defer func() { parseErrors = saved }()
+
+	program, err := parseProgram(input)
+	if err != nil {
+		parseErrors = append(parseErrors, err)
+	}
+	if len(parseErrors) == 0 {
+		return program, nil
+	}
+	list := make(diagnostics.List, len(parseErrors))
+	for i, err := range parseErrors {
+		list[i] = diagnostics.FromError(err, "")
+	}
+	if len(list) == 1 {
+		return nil, list[0]
+	}
+	return nil, list
+}
+
+func parseProgram(input string) (*Program, error) {
+	lines := joinContinuedLines(strings.Split(input, "\n"))
+	for i, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		normalized, err := normalizeNumberLiterals(line, i)
+		if err != nil {
+			return nil, err
+		}
+		lines[i] = normalized
+	}
+	registerStructTypes(lines)
+	statements, err := parseStatements(lines, 0, 0)
 	if err != nil {
 		return nil, err
 	}
@@ -450,23 +714,18 @@ func handleTypeCasting(symbolName string) string {
 			}
 		}
 
-		for i := 0; i < len(result); i++ {
-			markerPrefix := fmt.Sprintf("__TEMP_MARKER_%s_", typecast)
-			if strings.Contains(result, markerPrefix) {
-				for {
-					markerStart := strings.Index(result, markerPrefix)
-					if markerStart == -1 {
-						break
-					}
-					markerEnd := strings.Index(result[markerStart:], "__") + markerStart + 2
-					if markerEnd > markerStart+2 {
-						result = result[:markerStart] + originalPattern + result[markerEnd:]
-					} else {
-						break
-					}
-				}
+		markerPrefix := fmt.Sprintf("__TEMP_MARKER_%s_", typecast)
+		for {
+			markerStart := strings.Index(result, markerPrefix)
+			if markerStart == -1 {
+				break
+			}
+			// The marker ends with the __ after its index.
+			markerEnd := strings.Index(result[markerStart+len(markerPrefix):], "__")
+			if markerEnd == -1 {
 				break
 			}
+			result = result[:markerStart] + originalPattern + result[markerStart+len(markerPrefix)+markerEnd+2:]
 		}
 	}
 
@@ -487,6 +746,11 @@ func ResolveSymbol(symbolName string, currentModule string) string {
 				replacement := fmt.Sprintf("%s_%s", moduleName, symbolName)
 				result = strings.ReplaceAll(result, pattern, replacement)
 			}
+			for symbolName := range module.PublicConsts {
+				pattern := moduleName + "." + symbolName
+				replacement := fmt.Sprintf("%s_%s", moduleName, symbolName)
+				result = strings.ReplaceAll(result, pattern, replacement)
+			}
 			for symbolName := range module.PublicClasses {
 				pattern := moduleName + "." + symbolName
 				replacement := fmt.Sprintf("%s_%s", moduleName, symbolName)
@@ -538,11 +802,33 @@ func isValidType(s string) bool {
 	if numericTypes[s] {
 		return true
 	}
+	if structTypes[s] || enumTypes[s] {
+		return true
+	}
 	if strings.HasPrefix(s, "list[") && strings.HasSuffix(s, "]") {
 		innerType := strings.TrimPrefix(strings.TrimSuffix(s, "]"), "list[")
 		return isValidType(innerType)
 	}
-	return false
+	// Optional types may wrap classes, which are not known while parsing.
+	return IsOptionalType(s)
+}
+
+// Reports whether a type is an optional type such as int? or Node?, whose
+// values may be nil.
+func IsOptionalType(s string) bool {
+	inner, ok := strings.CutSuffix(s, "?")
+	return ok && inner != "" && !strings.HasSuffix(inner, "?")
+}
+
+// Reports whether a block always ends by leaving it, through a return, break,
+// continue, throw or panic.
+func LeavesBlock(body []*Statement) bool {
+	if len(body) == 0 {
+		return false
+	}
+	last := body[len(body)-1]
+	return last.Return != nil || last.Break != nil || last.Continue != nil || last.Throw != nil ||
+		last.FunctionCall != nil && last.FunctionCall.Name == "panic"
 }
 
 func IsOperator(s string) bool {
@@ -1,7 +1,14 @@
 package lexer
 
 import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
+
+	"scar/diagnostics"
 )
 
 func TestParseSimpleVariableDeclaration(t *testing.T) {
@@ -336,3 +343,1179 @@ while i < 10:
 		})
 	}
 }
+
+func TestParseVersionPragma(t *testing.T) {
+	version, ok := ParseVersionPragma("\n#!scar 0.2\nprint \"hi\"\n")
+	if !ok || version != "0.2" {
+		t.Fatalf("expected pragma version 0.2, got %q (found=%v)", version, ok)
+	}
+	if _, ok := ParseVersionPragma("print \"hi\"\n#!scar 0.2\n"); ok {
+		t.Error("expected pragma after the first statement to be ignored")
+	}
+
+	defer SetLangVersion(CurrentLangVersion)
+	if err := SetLangVersion("0.2"); err != nil {
+		t.Fatalf("SetLangVersion failed: %v", err)
+	}
+	if LangVersionAtLeast("0.3") {
+		t.Error("expected 0.2 to be older than 0.3")
+	}
+	if err := SetLangVersion("9.0"); err == nil {
+		t.Error("expected an error for a version newer than the compiler")
+	}
+}
+
+func TestPipeFormatCall(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{`"%s is %d" | name, age`, `format!("%s is %d", name, age)`},
+		{`"%d %d" | x | x * 2`, `format!("%d %d", x, x * 2)`},
+		{`"a \" | b" | s`, `format!("a \" | b", s)`},
+	}
+	for _, tt := range tests {
+		if got, ok := PipeFormatCall(tt.input); !ok || got != tt.want {
+			t.Errorf("PipeFormatCall(%q) = %q, %v, want %q", tt.input, got, ok, tt.want)
+		}
+	}
+	for _, input := range []string{`"plain"`, `"a" || b`, `name | x`, `"open | x`} {
+		if got, ok := PipeFormatCall(input); ok {
+			t.Errorf("PipeFormatCall(%q) = %q, want no call", input, got)
+		}
+	}
+}
+
+func TestParseExpr(t *testing.T) {
+	expr, err := ParseExpr("a + b * this.size(2)[i] and not done")
+	if err != nil {
+		t.Fatalf("ParseExpr failed: %v", err)
+	}
+	and, ok := expr.(*BinaryExpr)
+	if !ok || and.Op != "and" {
+		t.Fatalf("expected 'and' at the root, got %#v", expr)
+	}
+	if not, ok := and.Right.(*UnaryExpr); !ok || not.Op != "not" {
+		t.Errorf("expected 'not done' on the right, got %#v", and.Right)
+	}
+	sum, ok := and.Left.(*BinaryExpr)
+	if !ok || sum.Op != "+" {
+		t.Fatalf("expected '+' below 'and', got %#v", and.Left)
+	}
+	product, ok := sum.Right.(*BinaryExpr)
+	if !ok || product.Op != "*" {
+		t.Fatalf("expected '*' to bind tighter than '+', got %#v", sum.Right)
+	}
+	index, ok := product.Right.(*IndexExpr)
+	if !ok {
+		t.Fatalf("expected an index expression, got %#v", product.Right)
+	}
+	call, ok := index.Object.(*CallExpr)
+	if !ok || len(call.Args) != 1 {
+		t.Fatalf("expected a call with one argument, got %#v", index.Object)
+	}
+	if member, ok := call.Callee.(*MemberExpr); !ok || member.Member != "size" {
+		t.Errorf("expected a call to this.size, got %#v", call.Callee)
+	}
+
+	expr, err = ParseExpr("not a == b and c")
+	if err != nil {
+		t.Fatalf("ParseExpr failed: %v", err)
+	}
+	and, ok = expr.(*BinaryExpr)
+	if !ok || and.Op != "and" {
+		t.Fatalf("expected 'and' to bind looser than 'not', got %#v", expr)
+	}
+	if not, ok := and.Left.(*UnaryExpr); !ok || not.Op != "not" {
+		t.Errorf("expected 'not' on the left, got %#v", and.Left)
+	} else if cmp, ok := not.Operand.(*BinaryExpr); !ok || cmp.Op != "==" {
+		t.Errorf("expected 'not' to negate the comparison, got %#v", not.Operand)
+	}
+
+	expr, err = ParseExpr("items[len(items) - 2:]")
+	if err != nil {
+		t.Fatalf("ParseExpr failed: %v", err)
+	}
+	if slice, ok := expr.(*SliceExpr); !ok {
+		t.Errorf("expected a slice expression, got %#v", expr)
+	} else if _, ok := slice.Low.(*BinaryExpr); !ok || slice.High != nil {
+		t.Errorf("expected a slice with only a low bound, got %#v", slice)
+	}
+	expr, err = ParseExpr("s[:3]")
+	if err != nil {
+		t.Fatalf("ParseExpr failed: %v", err)
+	}
+	if slice, ok := expr.(*SliceExpr); !ok || slice.Low != nil || slice.High == nil {
+		t.Errorf("expected a slice with only a high bound, got %#v", expr)
+	}
+
+	expr, err = ParseExpr("a + -b as f64 as i32 * 2")
+	if err != nil {
+		t.Fatalf("ParseExpr failed: %v", err)
+	}
+	sum, ok = expr.(*BinaryExpr)
+	if !ok || sum.Op != "+" {
+		t.Fatalf("expected '+' at the root, got %#v", expr)
+	}
+	product, ok = sum.Right.(*BinaryExpr)
+	if !ok || product.Op != "*" {
+		t.Fatalf("expected 'as' to bind tighter than '*', got %#v", sum.Right)
+	}
+	if outer, ok := product.Left.(*CastExpr); !ok || outer.Type != "i32" {
+		t.Errorf("expected a cast to i32, got %#v", product.Left)
+	} else if inner, ok := outer.Value.(*CastExpr); !ok || inner.Type != "f64" {
+		t.Errorf("expected casts to chain, got %#v", outer.Value)
+	} else if neg, ok := inner.Value.(*UnaryExpr); !ok || neg.Op != "-" {
+		t.Errorf("expected 'as' to bind looser than unary minus, got %#v", inner.Value)
+	}
+
+	expr, err = ParseExpr("sum([1, n + 1], [])")
+	if err != nil {
+		t.Fatalf("ParseExpr failed: %v", err)
+	}
+	call, ok = expr.(*CallExpr)
+	if !ok || len(call.Args) != 2 {
+		t.Fatalf("expected a call with 2 arguments, got %#v", expr)
+	}
+	if list, ok := call.Args[0].(*ListExpr); !ok || len(list.Elements) != 2 {
+		t.Errorf("expected a list literal of 2 elements, got %#v", call.Args[0])
+	}
+	if list, ok := call.Args[1].(*ListExpr); !ok || len(list.Elements) != 0 {
+		t.Errorf("expected an empty list literal, got %#v", call.Args[1])
+	}
+
+	if _, err := ParseExpr("new geo.Point(1, 2)"); err != nil {
+		t.Errorf("expected module qualified constructor to parse: %v", err)
+	}
+	for _, bad := range []string{"", "a +", "f(a, b", "x = 1", "a ? b : c", "x as", "x as 2", "[1, 2", "[1 2]"} {
+		if _, err := ParseExpr(bad); err == nil {
+			t.Errorf("expected ParseExpr(%q) to fail", bad)
+		}
+	}
+}
+
+func TestParseClassInheritance(t *testing.T) {
+	input := `class Animal:
+    fn speak():
+        print "..."
+
+pub class Dog(Animal):
+    fn speak():
+        print "woof"
+`
+	program, err := ParseWithIndentation(input)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	if base := program.Statements[0].ClassDecl.Base; base != "" {
+		t.Errorf("Expected Animal to have no base class, got %q", base)
+	}
+	dog := program.Statements[1].PubClassDecl
+	if dog.Name != "Dog" || dog.Base != "Animal" {
+		t.Errorf("Expected class Dog with base Animal, got %q with base %q", dog.Name, dog.Base)
+	}
+
+	for _, header := range []string{"class Dog(Animal:", "class Dog():", "class Dog(A, B):", "class Dog(Dog):"} {
+		if _, err := ParseWithIndentation(header + "\n    fn f():\n        print \"x\"\n"); err == nil {
+			t.Errorf("Expected an error for %q", header)
+		}
+	}
+}
+
+func TestParseInterface(t *testing.T) {
+	input := `interface Shape:
+    fn area() -> float
+    fn scale(float factor)
+
+class Square(Rect) implements Shape, Printable:
+    fn area() -> float:
+        return 1.0
+`
+	program, err := ParseWithIndentation(input)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	shape := program.Statements[0].InterfaceDecl
+	if shape == nil || shape.Name != "Shape" || len(shape.Methods) != 2 {
+		t.Fatalf("Expected interface Shape with 2 methods, got %+v", shape)
+	}
+	if scale := shape.Methods[1]; scale.Name != "scale" || scale.ReturnType != "void" || len(scale.Parameters) != 1 || scale.Body != nil {
+		t.Errorf("Expected signature scale(float) -> void without a body, got %+v", scale)
+	}
+	square := program.Statements[1].ClassDecl
+	if square.Name != "Square" || square.Base != "Rect" || strings.Join(square.Interfaces, ",") != "Shape,Printable" {
+		t.Errorf("Expected Square(Rect) implementing Shape and Printable, got %+v", square)
+	}
+
+	if _, err := ParseWithIndentation("interface Shape:\n    fn area() -> float:\n        return 1.0\n"); err == nil {
+		t.Errorf("Expected an error for an interface method with a body")
+	}
+}
+
+func TestParseMatch(t *testing.T) {
+	input := `match c:
+    case Color::Red:
+        print "red"
+    case 1, 2..5:
+        print "small"
+    case _:
+        print "other"
+`
+	program, err := ParseWithIndentation(input)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	match := program.Statements[0].Match
+	if match == nil || match.Value != "c" || len(match.Cases) != 2 || match.Else == nil {
+		t.Fatalf("Expected match on c with 2 cases and a default, got %+v", match)
+	}
+	if values := strings.Join(match.Cases[1].Values, "|"); values != "1|2..5" {
+		t.Errorf("Expected case values 1 and 2..5, got %s", values)
+	}
+	if low, high, ok := CaseRange(match.Cases[1].Values[1]); !ok || low != "2" || high != "5" {
+		t.Errorf("Expected range 2..5, got %s..%s", low, high)
+	}
+
+	if _, err := ParseWithIndentation("match c:\n    when 1:\n        print \"one\"\n"); err == nil {
+		t.Errorf("Expected an error for an arm that is not case or else")
+	}
+}
+
+func TestParseLabeledLoops(t *testing.T) {
+	input := `outer: for i = 0 to 3:
+    while i < 2:
+        break outer
+    continue 1
+`
+	program, err := ParseWithIndentation(input)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	loop := program.Statements[0].For
+	if loop == nil || loop.Label != "outer" || len(loop.Body) != 2 {
+		t.Fatalf("Expected for loop labeled outer, got %+v", loop)
+	}
+	if target := loop.Body[0].While.Body[0].Break.Target; target.Label != "outer" {
+		t.Errorf("Expected break outer, got %+v", target)
+	}
+	if target := loop.Body[1].Continue.Target; target.Levels != 1 {
+		t.Errorf("Expected continue 1, got %+v", target)
+	}
+
+	for _, bad := range []string{
+		"outer: print \"x\"\n",
+		"for i = 0 to 3:\n    break 0\n",
+		"for i = 0 to 3:\n    break 1x\n",
+		"for i = 0 to 3:\n    continue a b\n",
+	} {
+		if _, err := ParseWithIndentation(bad); err == nil {
+			t.Errorf("Expected an error for %q", bad)
+		}
+	}
+}
+
+func TestParseTryCatchFinally(t *testing.T) {
+	input := `try:
+    throw 2, "bad input"
+catch err:
+    print "caught"
+finally:
+    print "done"
+`
+	program, err := ParseWithIndentation(input)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	tryCatch := program.Statements[0].TryCatch
+	if tryCatch == nil || tryCatch.CatchVar != "err" || len(tryCatch.CatchBody) != 1 || len(tryCatch.FinallyBody) != 1 {
+		t.Fatalf("Expected try with catch err and a finally block, got %+v", tryCatch)
+	}
+	if throw := tryCatch.TryBody[0].Throw; throw.Value != "2" || throw.Message != `"bad input"` {
+		t.Errorf("Expected throw 2 with a message, got %+v", throw)
+	}
+
+	if _, err := ParseWithIndentation("try:\n    throw 1\ncatch 1e:\n    print \"x\"\n"); err == nil {
+		t.Errorf("Expected an error for an invalid catch variable")
+	}
+}
+
+func TestInterpolate(t *testing.T) {
+	segments, holes, ok, err := Interpolate(`Hi {name}, {{x}} is {f(a, "}")} max {math::max(2, "a::b")} {unclosed`)
+	if !ok || err != nil {
+		t.Fatalf("expected the string to be interpolated, got %v", err)
+	}
+	wantSegments := []string{"Hi ", ", {x} is ", " max ", " {unclosed"}
+	wantHoles := []string{"name", `f(a, "}")`, `math_max(2, "a::b")`}
+	if strings.Join(segments, "|") != strings.Join(wantSegments, "|") || strings.Join(holes, "|") != strings.Join(wantHoles, "|") {
+		t.Errorf("got segments %q and holes %q", segments, holes)
+	}
+	if _, _, ok, _ := Interpolate("plain {} text"); ok {
+		t.Error("expected text without holes not to be interpolated")
+	}
+	for _, input := range []string{
+		"print \"{not valid!}\"",
+		"eput \"x {a b}\"",
+		"string s = \"{1 +}\"",
+		"s = \"{)}\"",
+	} {
+		if _, err := ParseWithIndentation(input); err == nil || !strings.Contains(err.Error(), "in string interpolation") {
+			t.Errorf("expected %q to be rejected for its hole, got %v", input, err)
+		}
+	}
+
+	program, err := ParseWithIndentation("print \"{a} and {b}\"\nput \"{a}\"\n")
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	if print := program.Statements[0].Print; len(print.Segments) != 3 || len(print.Variables) != 2 {
+		t.Errorf("expected an interpolated print, got %+v", print)
+	}
+	if put := program.Statements[1].Put; len(put.Segments) != 2 || put.Variables[0] != "a" {
+		t.Errorf("expected an interpolated put, got %+v", put)
+	}
+}
+
+func TestParseNestedList(t *testing.T) {
+	program, err := ParseWithIndentation(`list[list[string]] names = [["ada", "alan"], [], ["grace"]]`)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	decl := program.Statements[0].ListDecl
+	if decl == nil {
+		t.Fatal("expected a list declaration")
+	}
+	if decl.Type != "list[string]" {
+		t.Errorf("expected element type list[string], got %s", decl.Type)
+	}
+	want := []string{`["ada", "alan"]`, `[]`, `["grace"]`}
+	if len(decl.Elements) != len(want) {
+		t.Fatalf("expected elements %v, got %v", want, decl.Elements)
+	}
+	for i := range want {
+		if decl.Elements[i] != want[i] {
+			t.Errorf("element %d: expected %s, got %s", i, want[i], decl.Elements[i])
+		}
+	}
+
+	if _, err := ParseWithIndentation("list[list[list[int]]] cube = []"); err == nil {
+		t.Error("expected an error for a list nested three levels deep")
+	}
+}
+
+func TestParseSet(t *testing.T) {
+	program, err := ParseWithIndentation("set[string] tags = [\"a\", \"b\"]\nadd!(tags, \"c\")\nremove!(tags, \"a\")")
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	decl := program.Statements[0].SetDecl
+	if decl == nil {
+		t.Fatal("expected a set declaration")
+	}
+	if decl.ElemType != "string" || decl.Name != "tags" || strings.Join(decl.Elements, ",") != "a,b" {
+		t.Errorf("unexpected set declaration %+v", decl)
+	}
+	if add := program.Statements[1].SetAdd; add == nil || add.SetName != "tags" || add.Value != `"c"` {
+		t.Errorf("unexpected add! statement %+v", add)
+	}
+	if remove := program.Statements[2].SetRemove; remove == nil || remove.SetName != "tags" || remove.Value != `"a"` {
+		t.Errorf("unexpected remove! statement %+v", remove)
+	}
+
+	if _, err := ParseWithIndentation("add!(tags)"); err == nil {
+		t.Error("expected an error for add! with one argument")
+	}
+}
+
+func TestParseOptional(t *testing.T) {
+	program, err := ParseWithIndentation("int? count = nil\nNode? head = new Node(1)")
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	if decl := program.Statements[0].VarDecl; decl == nil || decl.Type != "int?" || decl.Name != "count" || decl.Value != "nil" {
+		t.Errorf("unexpected optional declaration %+v", decl)
+	}
+	if decl := program.Statements[1].VarDecl; decl == nil || decl.Type != "Node?" || decl.Value != "new Node(1)" {
+		t.Errorf("unexpected optional declaration %+v", decl)
+	}
+
+	if IsOptionalType("int??") || IsOptionalType("?") {
+		t.Error("expected int?? and ? not to be optional types")
+	}
+}
+
+func TestParseStruct(t *testing.T) {
+	program, err := ParseWithIndentation("Color bg = Color(1, 2, 3)\n\nstruct Color:\n    int r\n    int g\n    int b\n")
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	if decl := program.Statements[0].VarDecl; decl == nil || decl.Type != "Color" || decl.Value != "Color(1, 2, 3)" {
+		t.Errorf("unexpected struct value declaration %+v", decl)
+	}
+	decl := program.Statements[1].StructDecl
+	if decl == nil || decl.Name != "Color" || len(decl.Fields) != 3 {
+		t.Fatalf("unexpected struct declaration %+v", decl)
+	}
+	if field := decl.Fields[2]; field.Type != "int" || field.Name != "b" {
+		t.Errorf("unexpected struct field %+v", field)
+	}
+
+	for _, input := range []string{"struct Empty:\n", "struct Pair:\n    int a\n    int a\n", "struct Bad:\n    int\n"} {
+		if _, err := ParseWithIndentation(input); err == nil {
+			t.Errorf("expected an error for %q", input)
+		}
+	}
+}
+
+func TestParseConstructorDefaults(t *testing.T) {
+	program, err := ParseWithIndentation("class Box:\n    init(string name, int w = 10, string tag = \"a, b\"):\n        int this.w = w\n")
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	params := program.Statements[0].ClassDecl.Constructor.Parameters
+	if len(params) != 3 {
+		t.Fatalf("expected 3 constructor parameters, got %d", len(params))
+	}
+	if params[0].Default != "" || params[1].Name != "w" || params[1].Default != "10" || params[2].Default != `"a, b"` {
+		t.Errorf("unexpected constructor parameters %+v %+v %+v", params[0], params[1], params[2])
+	}
+
+	if _, err := ParseWithIndentation("class Box:\n    init(int w = 10, int h):\n        int this.w = w\n"); err == nil {
+		t.Error("expected an error for a required parameter after a default")
+	}
+}
+
+func TestParseDeinitAndDelete(t *testing.T) {
+	program, err := ParseWithIndentation("class File:\n    init():\n        int this.fd = 0\n\n    deinit:\n        print \"closing\"\n\nFile f = new File()\ndelete f\n")
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	if deinit := program.Statements[0].ClassDecl.Deinit; len(deinit) != 1 || deinit[0].Print == nil {
+		t.Errorf("unexpected deinit block %+v", deinit)
+	}
+	if del := program.Statements[2].Delete; del == nil || del.Target != "f" {
+		t.Errorf("unexpected delete statement %+v", del)
+	}
+
+	if _, err := ParseWithIndentation("delete"); err == nil {
+		t.Error("expected an error for delete without a target")
+	}
+	if _, err := ParseWithIndentation("class File:\n    deinit:\n        print \"a\"\n    deinit:\n        print \"b\"\n"); err == nil {
+		t.Error("expected an error for a second deinit block")
+	}
+}
+
+func TestParseConstsAndArrays(t *testing.T) {
+	program, err := ParseWithIndentation("const int MAX = 64\npub const string NAME = \"a  b\"\nint[MAX * 2] buf\n")
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	if decl := program.Statements[0].ConstDecl; decl == nil || decl.Type != "int" || decl.Name != "MAX" || decl.Value != "64" || decl.Public {
+		t.Errorf("unexpected const declaration %+v", decl)
+	}
+	if decl := program.Statements[1].ConstDecl; decl == nil || decl.Value != `"a  b"` || !decl.Public {
+		t.Errorf("unexpected pub const declaration %+v", decl)
+	}
+	if decl := program.Statements[2].ArrayDecl; decl == nil || decl.Type != "int" || decl.Size != "MAX * 2" || decl.Name != "buf" {
+		t.Errorf("unexpected array declaration %+v", decl)
+	}
+
+	for _, input := range []string{"const int MAX", "const list[int] XS = 1", "fn f():\n    const int MAX = 1\n"} {
+		if _, err := ParseWithIndentation(input); err == nil {
+			t.Errorf("expected an error for %q", input)
+		}
+	}
+	if n, ok := FoldConstInt("(MAX + 2) * 4 % 7", func(string) (int64, bool) { return 64, true }); !ok || n != 5 {
+		t.Errorf("FoldConstInt() = %d, %v, want 5, true", n, ok)
+	}
+	for _, input := range []string{"1 << -1", "1 >> -2", "1 << 64", "1 << (0 - 3)"} {
+		if n, ok := FoldConstInt(input, func(string) (int64, bool) { return 0, false }); ok {
+			t.Errorf("FoldConstInt(%q) = %d, want it left unfolded", input, n)
+		}
+	}
+	if n, ok := FoldConstInt("1 << 4 >> 1", func(string) (int64, bool) { return 0, false }); !ok || n != 8 {
+		t.Errorf("FoldConstInt() = %d, %v, want 8, true", n, ok)
+	}
+}
+
+func TestNormalizeNumberLiterals(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"int mask = 0xFF", "int mask = 0xFF"},
+		{"int flags = 0b1010 | 0B1", "int flags = 0xA | 0x1"},
+		{"int perms = 0o755", "int perms = 0755"},
+		{"int big = 1_000_000 + 0xFF_FF", "int big = 1000000 + 0xFFFF"},
+		{"float f = 1_000.5", "float f = 1000.5"},
+		{"int x_1 = var_2", "int x_1 = var_2"},
+		{`print "0b1_0 {mask & 0b0000_1111} {{0o7}}"`, `print "0b1_0 {mask & 0xF} {{0o7}}"`},
+		{"char c = '1'", "char c = '1'"},
+	}
+	for _, tt := range tests {
+		got, err := normalizeNumberLiterals(tt.input, 0)
+		if err != nil || got != tt.want {
+			t.Errorf("normalizeNumberLiterals(%q) = %q, %v, want %q", tt.input, got, err, tt.want)
+		}
+	}
+	for _, input := range []string{"int x = 0b102", "int x = 1__0", "int x = 10_", "int x = 0o9"} {
+		if _, err := ParseWithIndentation(input); err == nil {
+			t.Errorf("expected an error for %q", input)
+		}
+	}
+}
+
+func TestHandleTypeCasting(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"float(x) / 2", "(float)(x) / 2"},
+		{"read_float()", "read_float()"},
+		{"to_float(s) + float(n)", "to_float(s) + (float)(n)"},
+	}
+	for _, tt := range tests {
+		if got := handleTypeCasting(tt.input); got != tt.want {
+			t.Errorf("handleTypeCasting(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestParseEnumDiscriminants(t *testing.T) {
+	program, err := ParseWithIndentation("enum Color:\n    Red = 1\n    Green\n    Blue = Red + 4\npub enum Level { Low, High = 5 }\nColor c = Color_Red\n")
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	decl := program.Statements[0].EnumDecl
+	if decl == nil || strings.Join(decl.Values, ",") != "Red,Green,Blue" || decl.Discriminants["Red"] != "1" || decl.Discriminants["Blue"] != "Red + 4" {
+		t.Errorf("unexpected enum declaration %+v", decl)
+	}
+	if _, explicit := decl.Discriminants["Green"]; explicit {
+		t.Error("Green should not have an explicit value")
+	}
+	if pub := program.Statements[1].PubEnumDecl; pub == nil || strings.Join(pub.Values, ",") != "Low,High" || pub.Discriminants["High"] != "5" {
+		t.Errorf("unexpected pub enum declaration %+v", pub)
+	}
+	if stmt := program.Statements[2].VarDecl; stmt == nil || stmt.Type != "Color" {
+		t.Errorf("expected a variable declared with an enum type, got %+v", program.Statements[2])
+	}
+
+	for _, input := range []string{"enum E:\n    A =\n", "enum E:\n    A\n    A\n", "enum E:\n    1A\n"} {
+		if _, err := ParseWithIndentation(input); err == nil {
+			t.Errorf("expected an error for %q", input)
+		}
+	}
+}
+
+func TestResolveImportAliases(t *testing.T) {
+	source := `import "std/geo" as g
+from geo import Square, area, SIDES
+
+g.Square sq = new g::Square(SIDES)
+Square other = new Square(2)
+int a = area(3) + g::area(4) + sq.area()
+print "{SIDES} {g.SIDES} SIDES"
+`
+	want := `import "std/geo" as g
+from geo import Square, area, SIDES
+
+geo.Square sq = new geo::Square(geo::SIDES)
+geo::Square other = new geo::Square(2)
+int a = geo::area(3) + geo::area(4) + sq.area()
+print "{geo_SIDES} {geo.SIDES} SIDES"
+`
+	if got := ResolveImportAliases(source); got != want {
+		t.Errorf("ResolveImportAliases() =\n%s\nwant:\n%s", got, want)
+	}
+
+	program, err := ParseWithIndentation("import \"std/geo\" as g\nfrom geo import Square, area\n")
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	if imp := program.Imports[0]; imp.Module != "std/geo" || imp.Alias != "g" {
+		t.Errorf("unexpected aliased import %+v", imp)
+	}
+	if imp := program.Imports[1]; imp.Module != "geo" || strings.Join(imp.Names, ",") != "Square,area" {
+		t.Errorf("unexpected from import %+v", imp)
+	}
+	for _, input := range []string{"from geo import", "from geo import a b", "from geo"} {
+		if _, err := ParseWithIndentation(input); err == nil {
+			t.Errorf("expected an error for %q", input)
+		}
+	}
+}
+
+func TestLoadModuleTransitively(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"tbase.scar":   "pub fn unit() -> int:\n    return 10\n",
+		"tmid.scar":    "import tbase\n\npub fn scaled(int n) -> int:\n    return n * tbase::unit()\n",
+		"ttop.scar":    "import tmid\nimport tbase\n\npub fn total() -> int:\n    return tmid::scaled(2)\n",
+		"tcycle1.scar": "import tcycle2\n",
+		"tcycle2.scar": "import tcycle1\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Cleanup(func() {
+		for _, name := range []string{"tbase", "tmid", "ttop", "tcycle1", "tcycle2"} {
+			delete(LoadedModules, name)
+		}
+	})
+
+	module, err := LoadModule("ttop", dir)
+	if err != nil {
+		t.Fatalf("LoadModule failed: %v", err)
+	}
+	if strings.Join(module.Imports, ",") != "tmid,tbase" {
+		t.Errorf("unexpected imports %v", module.Imports)
+	}
+	var order []string
+	for _, module := range SortedModules() {
+		if strings.HasPrefix(module.Name, "t") {
+			order = append(order, module.Name)
+		}
+	}
+	if strings.Join(order, ",") != "tbase,tmid,ttop" {
+		t.Errorf("SortedModules() order = %v, want tbase,tmid,ttop", order)
+	}
+
+	_, err = LoadModule("tcycle1", dir)
+	if err == nil || err.Error() != "import cycle: tcycle1 -> tcycle2 -> tcycle1" {
+		t.Errorf("expected an import cycle error, got %v", err)
+	}
+	if _, loaded := LoadedModules["tcycle1"]; loaded {
+		t.Error("a module in an import cycle should not be loaded")
+	}
+}
+
+func TestParseReportsMultipleErrors(t *testing.T) {
+	input := `int x = 3
+while
+print "ok"
+if x > 1:
+    while
+    print "a"
+        print "b"
+`
+	_, err := ParseWithIndentation(input)
+	var list diagnostics.List
+	if !errors.As(err, &list) {
+		t.Fatalf("expected a list of diagnostics, got %v", err)
+	}
+	var lines []int
+	for _, d := range list {
+		lines = append(lines, d.Line)
+	}
+	if !slices.Equal(lines, []int{2, 5, 7}) {
+		t.Errorf("expected errors on lines 2, 5 and 7, got %v:\n%v", lines, err)
+	}
+
+	input = strings.Repeat("while\n", MaxParseErrors+5)
+	_, err = ParseWithIndentation(input)
+	if errs := diagnostics.Split(err); len(errs) != MaxParseErrors {
+		t.Errorf("expected parsing to stop after %d errors, got %d", MaxParseErrors, len(errs))
+	}
+}
+
+func TestValidateProgramReportsCallSites(t *testing.T) {
+	input := `fn twice(int x) -> int:
+    return x * 2
+
+print "start"
+if true:
+    twice(1, 2)
+`
+	program, err := ParseWithIndentation(input)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	errs := ValidateProgram(program)
+	if len(errs) != 1 || errs[0].Error() != "line 6: function 'twice' expects 1 arguments, but 2 were provided" {
+		t.Errorf("expected an error at the call site, got %v", errs)
+	}
+}
+
+func TestParseTestBlocks(t *testing.T) {
+	input := `test "adds numbers":
+    int x = 2
+    assert!(x > 1)
+    assert_eq!(add(x, 2), 4)
+print "done"
+`
+	program, err := ParseWithIndentation(input)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	if len(program.Statements) != 2 || program.Statements[0].Test == nil {
+		t.Fatalf("expected a test block followed by a print, got %d statements", len(program.Statements))
+	}
+	test := program.Statements[0].Test
+	if test.Name != "adds numbers" || len(test.Body) != 3 {
+		t.Fatalf("expected test 'adds numbers' with 3 statements, got %q with %d", test.Name, len(test.Body))
+	}
+	if assert := test.Body[1].Assert; assert == nil || assert.Condition != "x > 1" {
+		t.Errorf("expected assert! of 'x > 1', got %+v", assert)
+	}
+	if assert := test.Body[2].Assert; assert == nil || assert.Left != "add(x, 2)" || assert.Right != "4" {
+		t.Errorf("expected assert_eq! of 'add(x, 2)' and '4', got %+v", assert)
+	}
+
+	if _, err := ParseWithIndentation("assert_eq!(1)\n"); err == nil || !strings.Contains(err.Error(), "assert_eq! requires exactly 2 arguments") {
+		t.Errorf("expected an error for assert_eq! with one argument, got %v", err)
+	}
+	if _, err := ParseWithIndentation("test adds:\n    assert!(true)\n"); err == nil || !strings.Contains(err.Error(), "test block requires a quoted name") {
+		t.Errorf("expected an error for an unquoted test name, got %v", err)
+	}
+}
+
+func TestParseAssertStatements(t *testing.T) {
+	program, err := ParseWithIndentation(`assert x > 1
+assert f(a, b) == 2, "f is " + name
+`)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	if assert := program.Statements[0].Assert; assert == nil || !assert.DebugOnly || assert.Condition != "x > 1" || assert.Message != "" {
+		t.Errorf("expected assert of 'x > 1' without a message, got %+v", assert)
+	}
+	if assert := program.Statements[1].Assert; assert == nil || assert.Condition != "f(a, b) == 2" || assert.Message != `"f is " + name` {
+		t.Errorf("expected assert of 'f(a, b) == 2' with a message, got %+v", assert)
+	}
+
+	for _, bad := range []string{"assert ,\n", "assert x, y, z\n"} {
+		if _, err := ParseWithIndentation(bad); err == nil || !strings.Contains(err.Error(), "assert requires a condition") {
+			t.Errorf("expected an error for %q, got %v", bad, err)
+		}
+	}
+}
+
+func TestParsePanic(t *testing.T) {
+	program, err := ParseWithIndentation(`class A:
+    fn f():
+        panic("x = " + this.name)
+`)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	call := program.Statements[0].ClassDecl.Methods[0].Body[0].FunctionCall
+	if call == nil || call.Name != "panic" || len(call.Args) != 1 || call.Args[0] != `"x = " + this.name` {
+		t.Errorf("expected a panic with one message, got %+v", call)
+	}
+}
+
+func TestParseStderrPrints(t *testing.T) {
+	program, err := ParseWithIndentation(`eprint "low on {n}"
+eput "%d left" | n
+print "done"
+`)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	if p := program.Statements[0].Print; p == nil || !p.Stderr || len(p.Segments) != 2 {
+		t.Errorf("expected an interpolated eprint, got %+v", p)
+	}
+	if p := program.Statements[1].Put; p == nil || !p.Stderr || p.Format != "%d left" {
+		t.Errorf("expected a formatted eput, got %+v", p)
+	}
+	if p := program.Statements[2].Print; p == nil || p.Stderr {
+		t.Errorf("expected a print to stdout, got %+v", p)
+	}
+}
+
+func TestParseBenchBlocks(t *testing.T) {
+	input := `bench "map inserts":
+    map[int: int] m = []
+    put!(m, 1, 2)
+`
+	program, err := ParseWithIndentation(input)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	if len(program.Statements) != 1 || program.Statements[0].Bench == nil {
+		t.Fatalf("expected a bench block, got %d statements", len(program.Statements))
+	}
+	if bench := program.Statements[0].Bench; bench.Name != "map inserts" || len(bench.Body) != 2 {
+		t.Errorf("expected bench 'map inserts' with 2 statements, got %q with %d", bench.Name, len(bench.Body))
+	}
+	if _, err := ParseWithIndentation("bench inserts:\n    int x = 1\n"); err == nil || !strings.Contains(err.Error(), "bench block requires a quoted name") {
+		t.Errorf("expected an error for an unquoted bench name, got %v", err)
+	}
+}
+
+func TestAttachDocComments(t *testing.T) {
+	source := `## Geometry helpers.
+
+## A square.
+## With sides.
+pub class Square:
+    init(int side):
+        this.side = side
+
+    ## The area.
+    fn area() -> int:
+        return this.side * this.side
+
+    fn perimeter() -> int:
+        return this.side * 4
+
+## Detached, by the blank line.
+
+pub fn twice(int n) -> int:
+    return n * 2
+
+#### A banner, not a doc comment.
+int x = 1
+`
+	program, err := ParseWithIndentation(RemoveComments(source))
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	AttachDocComments(program, source)
+
+	if program.Doc != "Geometry helpers." {
+		t.Errorf("expected the doc comment of the module, got %q", program.Doc)
+	}
+	class := program.Statements[0].PubClassDecl
+	if program.Statements[0].Doc != "A square.\nWith sides." {
+		t.Errorf("expected the doc comment of Square, got %q", program.Statements[0].Doc)
+	}
+	if class.Methods[0].Doc != "The area." || class.Methods[1].Doc != "" {
+		t.Errorf("expected only area to be documented, got %q and %q", class.Methods[0].Doc, class.Methods[1].Doc)
+	}
+	for _, stmt := range program.Statements[1:] {
+		if stmt.Doc != "" {
+			t.Errorf("expected no doc comment at line %d, got %q", stmt.Line, stmt.Doc)
+		}
+	}
+}
+
+func TestConstructorArgumentsWithCommasInStrings(t *testing.T) {
+	source := `class Box:
+    init(string text, int n):
+        int this.n = n
+
+Box a = new Box("[1, 2]", 3)
+var b = new Box("{\"x\": 1, \"y\": 2}", 4)
+`
+	program, err := ParseWithIndentation(source)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	want := [][]string{
+		{"Box", `"[1, 2]"`, "3"},
+		{"Box", `"{\"x\": 1, \"y\": 2}"`, "4"},
+	}
+	for i, stmt := range program.Statements[1:] {
+		if stmt.ObjectDecl == nil {
+			t.Fatalf("statement %d is not an object declaration", i+1)
+		}
+		if !slices.Equal(stmt.ObjectDecl.Args, want[i]) {
+			t.Errorf("expected arguments %q, got %q", want[i], stmt.ObjectDecl.Args)
+		}
+	}
+}
+
+func TestSplitArgumentsWithEscapedBackslash(t *testing.T) {
+	input := `"a, b", "\\1:\\2", f(1, 2)`
+	want := []string{`"a, b"`, `"\\1:\\2"`, "f(1, 2)"}
+	if got := SplitArguments(input); !slices.Equal(got, want) {
+		t.Errorf("SplitArguments(%q) = %q, want %q", input, got, want)
+	}
+	if got := splitRespectingParens(input); !slices.Equal(got, want) {
+		t.Errorf("splitRespectingParens(%q) = %q, want %q", input, got, want)
+	}
+}
+
+func TestParseSpawnAndJoin(t *testing.T) {
+	program, err := ParseWithIndentation(`var a = spawn work(1, "x")
+thread b = spawn work(2, "y")
+spawn work(3, "z")
+join a
+`)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	want := []SpawnStmt{
+		{Handle: "a", Call: `work(1, "x")`},
+		{Handle: "b", Call: `work(2, "y")`},
+		{Call: `work(3, "z")`},
+	}
+	for i, w := range want {
+		if spawn := program.Statements[i].Spawn; spawn == nil || *spawn != w {
+			t.Errorf("statement %d: expected %+v, got %+v", i+1, w, spawn)
+		}
+	}
+	if join := program.Statements[3].Join; join == nil || join.Handle != "a" {
+		t.Errorf("expected join a, got %+v", join)
+	}
+	if _, err := ParseWithIndentation("spawn x.run()\n"); err == nil {
+		t.Error("expected spawning a method call to be rejected")
+	}
+}
+
+func TestParseAtomicAndReduce(t *testing.T) {
+	program, err := ParseWithIndentation(`atomic int hits = 0
+parallel for i = 1 to 10 reduce(+: total, count) reduce(max: top):
+    hits = hits + 1
+`)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	if decl := program.Statements[0].VarDecl; decl == nil || !decl.Atomic || decl.Type != "int" {
+		t.Errorf("expected an atomic int declaration, got %+v", decl)
+	}
+	loop := program.Statements[1].ParallelFor
+	if loop == nil || loop.End != "10" || !slices.Equal(loop.Reductions, []string{"+: total, count", "max: top"}) {
+		t.Errorf("expected a parallel for to 10 with two reductions, got %+v", loop)
+	}
+	for _, input := range []string{
+		"atomic string s = \"x\"\n",
+		"parallel for i = 1 to 10 reduce(%: total):\n    print \"x\"\n",
+		"parallel for i = 1 to 10 reduce(+ total):\n    print \"x\"\n",
+	} {
+		if _, err := ParseWithIndentation(input); err == nil {
+			t.Errorf("expected %q to be rejected", input)
+		}
+	}
+}
+
+func TestParseParallelForThreadsAndSchedule(t *testing.T) {
+	program, err := ParseWithIndentation(`parallel for i = 0 to n - 1 threads(max(2, n)) schedule(dynamic, 4):
+    print "x"
+`)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	loop := program.Statements[0].ParallelFor
+	if loop == nil || loop.End != "n - 1" || loop.Threads != "max(2, n)" || loop.Schedule != "dynamic, 4" {
+		t.Errorf("expected a parallel for to n - 1 on max(2, n) threads with a dynamic schedule, got %+v", loop)
+	}
+	for _, clauses := range []string{"schedule(often)", "schedule(auto, 2)", "threads(2) threads(4)", "threads()", "threads(2) extra"} {
+		input := "parallel for i = 1 to 10 " + clauses + ":\n    print \"x\"\n"
+		if _, err := ParseWithIndentation(input); err == nil {
+			t.Errorf("expected %q to be rejected", clauses)
+		}
+	}
+}
+
+func TestParseExternFunction(t *testing.T) {
+	program, err := ParseWithIndentation(`extern fn strlen(string s) -> int from "string.h"
+extern fn seed(ref u32 state)
+`)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	strlen := program.Statements[0].ExternFunc
+	if strlen == nil || strlen.Name != "strlen" || strlen.ReturnType != "int" || strlen.Header != "string.h" || len(strlen.Parameters) != 1 {
+		t.Errorf("expected strlen from string.h, got %+v", strlen)
+	}
+	seed := program.Statements[1].ExternFunc
+	if seed == nil || seed.ReturnType != "void" || seed.Header != "" || !seed.Parameters[0].IsRef {
+		t.Errorf("expected seed without a header, got %+v", seed)
+	}
+	for _, input := range []string{
+		"extern fn sum(list[int] xs) -> int\n",
+		"extern fn f() -> int from string.h\n",
+		"extern fn f() -> int using \"f.h\"\n",
+		"extern fn f() -> list[int]\n",
+	} {
+		if _, err := ParseWithIndentation(input); err == nil {
+			t.Errorf("expected %q to be rejected", input)
+		}
+	}
+}
+
+func TestParseBreakpoint(t *testing.T) {
+	program, err := ParseWithIndentation("while true:\n    breakpoint\n")
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	if body := program.Statements[0].While.Body; len(body) != 1 || body[0].Breakpoint == nil {
+		t.Errorf("expected a breakpoint in the loop, got %+v", body)
+	}
+	if _, err := ParseWithIndentation("breakpoint here\n"); err == nil {
+		t.Error("expected a breakpoint with arguments to be rejected")
+	}
+}
+
+func TestParseClassTypedDeclaration(t *testing.T) {
+	program, err := ParseWithIndentation("Node n = make_node(5)\nclass Node:\n    init(int v):\n        this.value = v\n")
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	decl := program.Statements[0].VarDecl
+	if decl == nil || decl.Type != "Node" || decl.Name != "n" || decl.Value != "make_node(5)" {
+		t.Errorf("expected a Node declaration from a call, got %+v", program.Statements[0])
+	}
+}
+
+func TestParseObjectParameters(t *testing.T) {
+	program, err := ParseWithIndentation(`fn process(Task t, geometry.Point p) -> int:
+    return 0
+
+class Task:
+    init(int cost):
+        this.cost = cost
+`)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	params := program.Statements[0].TopLevelFuncDecl.Parameters
+	if len(params) != 2 || params[0].Type != "Task" || params[1].Type != "geometry_Point" {
+		t.Errorf("expected Task and geometry_Point parameters, got %+v", params)
+	}
+	for _, input := range []string{
+		"fn f(Unknown u):\n    return\n",
+		"class Task:\n    init():\n        this.x = 1\nextern fn f(Task t) -> int\n",
+	} {
+		if _, err := ParseWithIndentation(input); err == nil {
+			t.Errorf("expected %q to be rejected", input)
+		}
+	}
+}
+
+func TestParseMethodChains(t *testing.T) {
+	program, err := ParseWithIndentation(`a = a + o.owner().age
+o.owner().older(2).describe()
+`)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	if assign := program.Statements[0].VarAssign; assign == nil || assign.Value != "a + o.owner().age" {
+		t.Errorf("expected an assignment of a + o.owner().age, got %+v", program.Statements[0])
+	}
+	call := program.Statements[1].MethodCall
+	if call == nil || call.Object != "o.owner().older(2)" || call.Method != "describe" {
+		t.Errorf("expected describe called on o.owner().older(2), got %+v", program.Statements[1])
+	}
+}
+
+func TestParseBuiltinCallOnField(t *testing.T) {
+	program, err := ParseWithIndentation("append!(this.cells, x)\n")
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	call := program.Statements[0].FunctionCall
+	if call == nil || call.Name != "append!" || len(call.Args) != 2 || call.Args[0] != "this.cells" {
+		t.Errorf("expected append! called on this.cells, got %+v", program.Statements[0])
+	}
+}
+
+func TestUnescape(t *testing.T) {
+	for body, want := range map[string]string{
+		`plain`:               "plain",
+		`a\tb\nc`:             "a\tb\nc",
+		`say \"hi\" \\ back`:  `say "hi" \ back`,
+		`it\'s\r`:             "it's\r",
+		`\033[0;32mok\033[0m`: "\033[0;32mok\033[0m",
+		`nul\0 \x1b! \1234`:   "nul\x00 \x1b! \x534",
+	} {
+		if got, err := Unescape(body); err != nil || got != want {
+			t.Errorf("Unescape(%q) = %q, %v, want %q", body, got, err, want)
+		}
+	}
+	for _, body := range []string{`bad \q`, `trailing \`, `\400`, `\x1`, `\x1bad`} {
+		if _, err := Unescape(body); err == nil {
+			t.Errorf("expected Unescape(%q) to fail", body)
+		}
+	}
+}
+
+func TestUnescapeOlderLangVersions(t *testing.T) {
+	defer func(version string) { LangVersion = version }(LangVersion)
+	LangVersion = "0.2"
+	if got, err := Unescape(`C:\dir\n`); err != nil || got != "C:\\dir\n" {
+		t.Errorf("Unescape() = %q, %v, want the unknown escape kept as written", got, err)
+	}
+}
+
+func TestParseRejectsUnknownEscapes(t *testing.T) {
+	_, err := ParseWithIndentation("string s = \"fine\\t\"\nprint \"bad \\d\"\nchar c = '\"'\n")
+	if err == nil || !strings.Contains(err.Error(), `unknown escape sequence '\d'`) || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("expected an unknown escape sequence error at line 2, got %v", err)
+	}
+}
+
+func TestRemoveCommentsAfterEscapedBackslash(t *testing.T) {
+	got := RemoveComments("print \"dir\\\\\" # note\nprint \"a \\\" # b\"\n")
+	if want := "print \"dir\\\\\" \nprint \"a \\\" # b\"\n"; got != want {
+		t.Errorf("RemoveComments() = %q, want %q", got, want)
+	}
+}
+
+func TestParseContinuedLines(t *testing.T) {
+	program, err := ParseWithIndentation(`int total = add(
+    1,
+    2
+)
+list[int] xs = [1,
+    2, 3]
+if total > 3 and \
+    total < 9:
+    print "in range"
+int sum = total + \
+    1
+$raw (
+int z = (1 +
+  2);
+)
+`)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	stmts := program.Statements
+	if len(stmts) != 5 {
+		t.Fatalf("expected 5 statements, got %d", len(stmts))
+	}
+	if decl := stmts[0].VarDecl; decl == nil || decl.Value != "add(1, 2)" {
+		t.Errorf("expected total to be declared as add(1, 2), got %+v", stmts[0])
+	}
+	if list := stmts[1].ListDecl; list == nil || len(list.Elements) != 3 || stmts[1].Line != 5 {
+		t.Errorf("expected a list of 3 elements at line 5, got %+v", stmts[1])
+	}
+	if cond := stmts[2].If; cond == nil || cond.Condition != "total > 3 and total < 9" || stmts[2].Line != 7 {
+		t.Errorf("expected an if statement at line 7 with a joined condition, got %+v", stmts[2])
+	}
+	if decl := stmts[3].VarDecl; decl == nil || decl.Value != "total + 1" {
+		t.Errorf("expected sum to be declared as total + 1, got %+v", stmts[3])
+	}
+	if raw := stmts[4].RawCode; raw == nil || !strings.Contains(raw.Code, "(1 +\n") {
+		t.Errorf("expected the $raw block to keep its lines, got %+v", stmts[4])
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	for value, want := range map[string][2]string{
+		"0..n":               {"0", "n"},
+		"1 .. len(xs)":       {"1", "len(xs)"},
+		"range(0, n)":        {"0", "n - 1"},
+		"range(a, b + 1)":    {"a", "(b + 1) - 1"},
+		"range(f(1, 2), 10)": {"f(1, 2)", "10 - 1"},
+	} {
+		low, high, ok := ParseRange(value)
+		if !ok || low != want[0] || high != want[1] {
+			t.Errorf("ParseRange(%q) = %q, %q, %v, want %q, %q", value, low, high, ok, want[0], want[1])
+		}
+	}
+	for _, value := range []string{"range(1)", "xs", "1..", `"a..b"`, "f(x)"} {
+		if _, _, ok := ParseRange(value); ok {
+			t.Errorf("expected %q not to be a range", value)
+		}
+	}
+}
+
+func TestParseForeachOverRange(t *testing.T) {
+	program, err := ParseWithIndentation("foreach (int i in range(0, n)):\n    print \"{i}\"\n")
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	loop := program.Statements[0].For
+	if loop == nil || loop.Var != "i" || loop.Start != "0" || loop.End != "n - 1" || len(loop.Body) != 1 {
+		t.Errorf("expected a for loop from 0 to n - 1, got %+v", program.Statements[0])
+	}
+	if _, err := ParseWithIndentation("foreach (char c in 0..9):\n    print \"{c}\"\n"); err == nil || !strings.Contains(err.Error(), "'int'") {
+		t.Errorf("expected foreach over a range with a char variable to fail, got %v", err)
+	}
+}
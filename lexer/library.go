@@ -0,0 +1,31 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains the scar types of the C library functions and constants that scar
+// code may use directly.
+
+package lexer
+
+// The scar types of the values of C library constants and of the results of
+// C library functions, so that checking and printing agree on them.
+var LibraryTypes = map[string]string{
+	// Constants.
+	"EOF": "int", "RAND_MAX": "int", "INT_MAX": "int", "INT_MIN": "int",
+	"M_PI": "double", "M_E": "double",
+
+	// Functions.
+	"strlen": "int", "strcmp": "int", "strncmp": "int", "memcmp": "int", "atoi": "int",
+	"abs": "int", "getchar": "int", "putchar": "int", "puts": "int", "printf": "int",
+	"toupper": "int", "tolower": "int", "isdigit": "int", "isalpha": "int", "isalnum": "int",
+	"isspace": "int", "isupper": "int", "islower": "int",
+	"omp_get_thread_num": "int", "omp_get_num_threads": "int",
+	"labs": "long", "atol": "long", "strtol": "long", "time": "long", "clock": "long",
+	"atof": "double", "strtod": "double", "sqrt": "double", "pow": "double", "sin": "double",
+	"cos": "double", "tan": "double", "asin": "double", "acos": "double", "atan": "double",
+	"atan2": "double", "exp": "double", "log": "double", "log10": "double", "floor": "double",
+	"ceil": "double", "round": "double", "fabs": "double", "fmod": "double",
+	"getenv": "string", "strdup": "string", "strcpy": "string", "strncpy": "string",
+	"strcat": "string", "strncat": "string", "strchr": "string", "strrchr": "string",
+	"strstr": "string", "strtok": "string",
+}
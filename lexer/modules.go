@@ -0,0 +1,79 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains the dependency graph of the loaded modules.
+//
+// Modules form a graph through their imports. LoadModule walks it depth
+// first, loading the imports of a module before the module itself and
+// tracking the modules still loading to report import cycles, and
+// SortedModules orders the loaded modules so every module comes after the
+// modules it imports.
+
+package lexer
+
+import (
+	"errors"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Names of the modules being loaded, from the outermost import inwards.
+var loadingModules []string
+
+// Directories searched for modules not found next to the importing file, such
+// as the dependencies of a project.
+var ModuleSearchDirs []string
+
+// An import that leads back to a module that is still loading.
+type ImportCycleError struct {
+	// The modules of the cycle, starting and ending with the same module.
+	Chain []string
+}
+
+func (e *ImportCycleError) Error() string {
+	return "import cycle: " + strings.Join(e.Chain, " -> ")
+}
+
+// Returns the cycle closed by importing module while it is still loading.
+func importCycle(module string) error {
+	start := slices.Index(loadingModules, module)
+	if start < 0 {
+		return nil
+	}
+	return &ImportCycleError{Chain: append(slices.Clone(loadingModules[start:]), module)}
+}
+
+// Reports whether an error is an import cycle, which is passed up unchanged
+// by the modules importing each other.
+func isImportCycle(err error) bool {
+	var cycle *ImportCycleError
+	return errors.As(err, &cycle)
+}
+
+// Returns the loaded modules in dependency order, so that a module always
+// comes after the modules it imports. Modules that do not depend on each
+// other are ordered by name.
+func SortedModules() []*ModuleInfo {
+	var (
+		sorted  []*ModuleInfo
+		visited = make(map[string]bool)
+		visit   func(name string)
+	)
+	visit = func(name string) {
+		module, exists := LoadedModules[name]
+		if !exists || visited[name] {
+			return
+		}
+		visited[name] = true
+		for _, dependency := range module.Imports {
+			visit(dependency)
+		}
+		sorted = append(sorted, module)
+	}
+	for _, name := range slices.Sorted(maps.Keys(LoadedModules)) {
+		visit(name)
+	}
+	return sorted
+}
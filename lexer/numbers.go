@@ -0,0 +1,128 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains the normalisation of number literals C does not accept.
+//
+// Scar allows hexadecimal 0xFF, binary 0b1010 and octal 0o755 integers, and
+// underscores between digits such as 1_000_000. Before a line is parsed its
+// binary literals are rewritten in hexadecimal, its octal literals with the
+// leading 0 C expects and its underscores are dropped, so every later stage
+// only sees literals C understands.
+
+package lexer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Rewrites the number literals of a line outside string and char literals.
+func normalizeNumberLiterals(line string, lineNum int) (string, error) {
+	var (
+		b strings.Builder
+		i = 0
+	)
+	for i < len(line) {
+		ch := line[i]
+		switch {
+		case ch == '"':
+			i = normalizeStringHoles(&b, line, i, lineNum)
+		case ch == '\'':
+			j := i + 1
+			for j < len(line) && line[j] != ch {
+				if line[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			j = min(j+1, len(line))
+			b.WriteString(line[i:j])
+			i = j
+		case isExprIdentStart(ch):
+			j := i
+			for j < len(line) && isExprIdentChar(line[j]) {
+				j++
+			}
+			b.WriteString(line[i:j])
+			i = j
+		case isExprDigit(ch):
+			j := i
+			for j < len(line) && (isExprIdentChar(line[j]) || line[j] == '.') {
+				j++
+			}
+			literal, err := normalizeNumber(line[i:j])
+			if err != nil {
+				return "", fmt.Errorf("%v at line %d", err, lineNum+1)
+			}
+			b.WriteString(literal)
+			i = j
+		default:
+			b.WriteByte(ch)
+			i++
+		}
+	}
+	return b.String(), nil
+}
+
+// Copies the string literal starting at start, rewriting the number literals
+// of its {expr} holes, and returns the index just past it. A hole whose
+// literals are invalid is kept as it is, since it is then literal text.
+func normalizeStringHoles(b *strings.Builder, line string, start, lineNum int) int {
+	b.WriteByte('"')
+	for i := start + 1; i < len(line); i++ {
+		switch ch := line[i]; {
+		case ch == '\\' && i+1 < len(line):
+			b.WriteString(line[i : i+2])
+			i++
+		case ch == '"':
+			b.WriteByte(ch)
+			return i + 1
+		case ch == '{' && i+1 < len(line) && line[i+1] == '{':
+			b.WriteString("{{")
+			i++
+		case ch == '{':
+			end := holeEnd(line, i)
+			if end < 0 {
+				b.WriteByte(ch)
+				continue
+			}
+			hole, err := normalizeNumberLiterals(line[i+1:end], lineNum)
+			if err != nil {
+				hole = line[i+1 : end]
+			}
+			b.WriteString("{" + hole + "}")
+			i = end
+		default:
+			b.WriteByte(ch)
+		}
+	}
+	return len(line)
+}
+
+// Rewrites a single number literal, leaving those C accepts as they are.
+func normalizeNumber(literal string) (string, error) {
+	lower := strings.ToLower(literal)
+	isBinary, isOctal := strings.HasPrefix(lower, "0b"), strings.HasPrefix(lower, "0o")
+	if !isBinary && !isOctal && !strings.Contains(literal, "_") {
+		return literal, nil
+	}
+	if strings.ContainsAny(literal, ".") || (!strings.HasPrefix(lower, "0x") && strings.Contains(lower, "e")) {
+		if _, err := strconv.ParseFloat(literal, 64); err != nil {
+			return "", fmt.Errorf("invalid number literal '%s'", literal)
+		}
+		return strings.ReplaceAll(literal, "_", ""), nil
+	}
+	n, err := strconv.ParseUint(literal, 0, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid number literal '%s'", literal)
+	}
+	switch {
+	case isBinary:
+		return fmt.Sprintf("0x%X", n), nil
+	case isOctal:
+		return fmt.Sprintf("0%o", n), nil
+	}
+	return strings.ReplaceAll(literal, "_", ""), nil
+}
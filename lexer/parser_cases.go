@@ -8,10 +8,16 @@
 package lexer
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+
+	"scar/diagnostics"
+	"scar/manifest"
 )
 
 // RemoveComments removes both full-line and inline comments from source code
@@ -24,7 +30,13 @@ func RemoveComments(source string) string {
 	lineStart := 0
 
 	for i := 0; i < len(source); i++ {
-		if source[i] == '"' && (i == 0 || source[i-1] != '\\') {
+		// An escaped character cannot end a string, even when it is a quote.
+		if inString && source[i] == '\\' && i+1 < len(source) {
+			result.WriteString(source[i : i+2])
+			i++
+			continue
+		}
+		if source[i] == '"' {
 			inString = !inString
 		}
 
@@ -139,6 +151,69 @@ func parseAllImports(lines []string, startLine int) ([]*ImportStmt, error) {
 	return imports, nil
 }
 
+// Returns the label of a line starting with label: followed by a loop.
+func loopLabel(line string) (string, bool) {
+	colon := strings.Index(line, ":")
+	if colon <= 0 || strings.HasPrefix(line[colon:], "::") {
+		return "", false
+	}
+	label, rest := line[:colon], strings.Fields(line[colon+1:])
+	if len(rest) == 0 || !slices.Contains([]string{"for", "while", "foreach", "parallel"}, rest[0]) {
+		return "", false
+	}
+	expr, err := ParseExpr(label)
+	_, isIdent := expr.(*IdentExpr)
+	return label, err == nil && isIdent
+}
+
+// Parses a loop preceded by a label, as in outer: for i = 0 to 9:, which break
+// and continue statements inside nested loops can name.
+func parseLabeledLoop(lines []string, lineNum, currentIndent int, label string) (*Statement, int, error) {
+	var (
+		line      = lines[lineNum]
+		prefix    = line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		unlabeled = slices.Clone(lines)
+	)
+	unlabeled[lineNum] = prefix + strings.TrimSpace(strings.TrimSpace(line)[len(label)+1:])
+
+	stmt, nextLine, err := parseStatement(unlabeled, lineNum, currentIndent)
+	if err != nil {
+		return nil, nextLine, err
+	}
+	switch {
+	case stmt.For != nil:
+		stmt.For.Label = label
+	case stmt.While != nil:
+		stmt.While.Label = label
+	case stmt.Foreach != nil:
+		stmt.Foreach.Label = label
+	default:
+		return nil, lineNum + 1, fmt.Errorf("label '%s' must be followed by a for, while or foreach loop at line %d", label, lineNum+1)
+	}
+	return stmt, nextLine, nil
+}
+
+// Parses the optional label or level count after break or continue.
+func parseLoopTarget(parts []string, lineNum int) (LoopTarget, error) {
+	if len(parts) == 1 {
+		return LoopTarget{}, nil
+	}
+	if len(parts) > 2 {
+		return LoopTarget{}, fmt.Errorf("%s takes at most one label or loop count at line %d", parts[0], lineNum+1)
+	}
+	if levels, err := strconv.Atoi(parts[1]); err == nil {
+		if levels < 1 {
+			return LoopTarget{}, fmt.Errorf("%s loop count must be at least 1 at line %d", parts[0], lineNum+1)
+		}
+		return LoopTarget{Levels: levels}, nil
+	}
+	expr, err := ParseExpr(parts[1])
+	if _, isIdent := expr.(*IdentExpr); err != nil || !isIdent {
+		return LoopTarget{}, fmt.Errorf("invalid loop label '%s' at line %d", parts[1], lineNum+1)
+	}
+	return LoopTarget{Label: parts[1]}, nil
+}
+
 func parseTryCatchStatement(lines []string, lineNum, currentIndent int) (*Statement, int, error) {
 	line := strings.TrimSpace(lines[lineNum])
 	if line != "try:" {
@@ -171,31 +246,226 @@ func parseTryCatchStatement(lines []string, lineNum, currentIndent int) (*Statem
 	}
 
 	nextTrimmed := strings.TrimSpace(lines[nextLine])
-	if nextTrimmed != "catch:" {
+	if nextTrimmed != "catch:" && !strings.HasPrefix(nextTrimmed, "catch ") {
 		return nil, nextLine, fmt.Errorf("expected catch statement after try block at line %d", nextLine+1)
 	}
-
-	bodyStartLine = nextLine + 1
-	for bodyStartLine < len(lines) {
-		bodyLine := lines[bodyStartLine]
-		if strings.TrimSpace(bodyLine) != "" && !strings.HasPrefix(strings.TrimSpace(bodyLine), "#") {
-			expectedBodyIndent = getIndentation(bodyLine)
-			break
-		}
-		bodyStartLine++
+	if !strings.HasSuffix(nextTrimmed, ":") {
+		return nil, nextLine, fmt.Errorf("catch statement must end with ':' at line %d", nextLine+1)
 	}
-	if expectedBodyIndent <= currentIndent {
-		expectedBodyIndent = currentIndent + 4
+	catchVar := strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(nextTrimmed, "catch"), ":"))
+	if catchVar != "" {
+		expr, err := ParseExpr(catchVar)
+		if _, isIdent := expr.(*IdentExpr); err != nil || !isIdent {
+			return nil, nextLine, fmt.Errorf("invalid catch variable '%s' at line %d", catchVar, nextLine+1)
+		}
 	}
 
+	expectedBodyIndent = nestedIndent(lines, nextLine, currentIndent)
 	catchBody, err := parseStatements(lines, nextLine+1, expectedBodyIndent)
 	if err != nil {
 		return nil, nextLine + 1, err
 	}
 
 	nextLine = findEndOfBlock(lines, nextLine+1, expectedBodyIndent)
+	tryCatch := &TryCatchStmt{TryBody: tryBody, CatchVar: catchVar, CatchBody: catchBody}
+
+	// An optional finally block runs after the try or catch block completes.
+	finallyLine := nextLine
+	for finallyLine < len(lines) && (strings.TrimSpace(lines[finallyLine]) == "" || strings.HasPrefix(strings.TrimSpace(lines[finallyLine]), "#")) {
+		finallyLine++
+	}
+	if finallyLine < len(lines) && getIndentation(lines[finallyLine]) == currentIndent && strings.TrimSpace(lines[finallyLine]) == "finally:" {
+		expectedBodyIndent = nestedIndent(lines, finallyLine, currentIndent)
+		tryCatch.FinallyBody, err = parseStatements(lines, finallyLine+1, expectedBodyIndent)
+		if err != nil {
+			return nil, finallyLine + 1, err
+		}
+		nextLine = findEndOfBlock(lines, finallyLine+1, expectedBodyIndent)
+	}
 
-	return &Statement{TryCatch: &TryCatchStmt{TryBody: tryBody, CatchBody: catchBody}}, nextLine, nil
+	return &Statement{TryCatch: tryCatch}, nextLine, nil
+}
+
+// Parses a test "name": or bench "name": block.
+func parseNamedBlock(lines []string, lineNum, currentIndent int) (*Statement, int, error) {
+	line := strings.TrimSpace(lines[lineNum])
+	keyword, name, _ := strings.Cut(strings.TrimSuffix(line, ":"), " ")
+	name = strings.TrimSpace(name)
+	if len(name) < 2 || !strings.HasPrefix(name, "\"") || !strings.HasSuffix(name, "\"") {
+		return nil, lineNum + 1, fmt.Errorf("%s block requires a quoted name at line %d", keyword, lineNum+1)
+	}
+	name = name[1 : len(name)-1]
+
+	bodyIndent := nestedIndent(lines, lineNum, currentIndent)
+	body, err := parseStatements(lines, lineNum+1, bodyIndent)
+	if err != nil {
+		return nil, lineNum + 1, err
+	}
+	nextLine := findEndOfBlock(lines, lineNum+1, bodyIndent)
+	if keyword == "bench" {
+		return &Statement{Bench: &BenchStmt{Name: name, Body: body}}, nextLine, nil
+	}
+	return &Statement{Test: &TestStmt{Name: name, Body: body}}, nextLine, nil
+}
+
+// Parses an assert!(condition) or assert_eq!(left, right) statement.
+func parseAssertStatement(line string, lineNum int) (*Statement, int, error) {
+	macro, args, _ := strings.Cut(line, "(")
+	args = strings.TrimSpace(strings.TrimSuffix(args, ")"))
+	operands := parseArgumentsRespectingNesting(args)
+	switch {
+	case macro == "assert!" && len(operands) == 1 && args != "":
+		return &Statement{Assert: &AssertStmt{Condition: args}}, lineNum + 1, nil
+	case macro == "assert_eq!" && len(operands) == 2:
+		left, right := strings.TrimSpace(operands[0]), strings.TrimSpace(operands[1])
+		if left != "" && right != "" {
+			return &Statement{Assert: &AssertStmt{Left: left, Right: right}}, lineNum + 1, nil
+		}
+	}
+	if macro == "assert!" {
+		return nil, lineNum + 1, fmt.Errorf("assert! requires exactly 1 argument at line %d", lineNum+1)
+	}
+	return nil, lineNum + 1, fmt.Errorf("assert_eq! requires exactly 2 arguments at line %d", lineNum+1)
+}
+
+// Parses the condition and optional message of an assert condition, "message"
+// statement.
+func parseDebugAssertStatement(args string, lineNum int) (*Statement, int, error) {
+	operands := parseArgumentsRespectingNesting(strings.TrimSpace(args))
+	if len(operands) == 0 || len(operands) > 2 || strings.TrimSpace(operands[0]) == "" {
+		return nil, lineNum + 1, fmt.Errorf("assert requires a condition and an optional message at line %d", lineNum+1)
+	}
+	assert := &AssertStmt{Condition: strings.TrimSpace(operands[0]), DebugOnly: true}
+	if len(operands) == 2 {
+		if assert.Message = strings.TrimSpace(operands[1]); assert.Message == "" {
+			return nil, lineNum + 1, fmt.Errorf("assert has an empty message at line %d", lineNum+1)
+		}
+	}
+	return &Statement{Assert: assert}, lineNum + 1, nil
+}
+
+// The types a variable declared atomic may have.
+var atomicTypes = []string{"int", "long", "i8", "i16", "i32", "i64", "u8", "u16", "u32", "u64"}
+
+// Parses atomic int name = value, or pub atomic int name = value when pub is
+// set, by parsing the declaration without its qualifier.
+func parseAtomicDeclaration(lines []string, lineNum, currentIndent int, pub bool) (*Statement, int, error) {
+	patched := slices.Clone(lines)
+	patched[lineNum] = strings.Replace(lines[lineNum], "atomic ", "", 1)
+	var (
+		stmt *Statement
+		next int
+		err  error
+	)
+	if pub {
+		stmt, next, err = parsePubStatement(patched, lineNum, currentIndent)
+	} else {
+		stmt, next, err = parseStatement(patched, lineNum, currentIndent)
+	}
+	if err != nil {
+		return nil, next, err
+	}
+	switch {
+	case stmt.VarDecl != nil && slices.Contains(atomicTypes, stmt.VarDecl.Type):
+		stmt.VarDecl.Atomic = true
+	case stmt.PubVarDecl != nil && slices.Contains(atomicTypes, stmt.PubVarDecl.Type):
+		stmt.PubVarDecl.Atomic = true
+	default:
+		return nil, next, fmt.Errorf("atomic requires an integer variable declaration at line %d (expected: atomic int name = value)", lineNum+1)
+	}
+	return stmt, next, nil
+}
+
+// The operators reduce(op: vars) accepts, with and and or for && and ||.
+var reductionOps = map[string]string{
+	"+": "+", "-": "-", "*": "*", "&": "&", "|": "|", "^": "^",
+	"&&": "&&", "||": "||", "and": "&&", "or": "||", "min": "min", "max": "max",
+}
+
+// The schedules schedule(kind, chunk) accepts.
+var scheduleKinds = []string{"static", "dynamic", "guided", "auto", "runtime"}
+
+// Parses the range of a parallel for, up to the colon, into loop: its end
+// followed by any of the reduce(op: vars), threads(n) and schedule(kind, chunk)
+// clauses.
+func parseParallelClauses(loop *ParallelForStmt, end string, lineNum int) error {
+	clauseFormat := fmt.Errorf("parallel for clause format error at line %d (expected: reduce(op: vars), threads(n) or schedule(kind, chunk))", lineNum+1)
+	index := len(end)
+	for _, clause := range []string{"reduce(", "threads(", "schedule("} {
+		if i := strings.Index(end, clause); i != -1 && i < index {
+			index = i
+		}
+	}
+	rest := strings.TrimSpace(end[index:])
+	loop.End = strings.TrimSpace(end[:index])
+	for rest != "" {
+		open := strings.Index(rest, "(")
+		if open == -1 {
+			return clauseFormat
+		}
+		closing := findMatchingParen(rest, open)
+		if closing == -1 {
+			return clauseFormat
+		}
+		name, inner := rest[:open], strings.TrimSpace(rest[open+1:closing])
+		rest = strings.TrimSpace(rest[closing+1:])
+		switch name {
+		case "reduce":
+			op, vars, hasColon := strings.Cut(inner, ":")
+			cOp, known := reductionOps[strings.TrimSpace(op)]
+			if !hasColon || !known {
+				return fmt.Errorf("parallel for reduce clause format error at line %d (expected: reduce(op: vars) with op one of + - * & | ^ and or min max)", lineNum+1)
+			}
+			names := strings.Split(vars, ",")
+			for i, name := range names {
+				names[i] = strings.TrimSpace(name)
+				if !isIdentifier(names[i]) {
+					return fmt.Errorf("parallel for reduce clause names an invalid variable '%s' at line %d", names[i], lineNum+1)
+				}
+			}
+			loop.Reductions = append(loop.Reductions, cOp+": "+strings.Join(names, ", "))
+		case "threads":
+			if inner == "" || loop.Threads != "" {
+				return fmt.Errorf("parallel for takes a single threads(n) clause at line %d", lineNum+1)
+			}
+			loop.Threads = inner
+		case "schedule":
+			kind, chunk, hasChunk := strings.Cut(inner, ",")
+			kind, chunk = strings.TrimSpace(kind), strings.TrimSpace(chunk)
+			if !slices.Contains(scheduleKinds, kind) || loop.Schedule != "" || (hasChunk && (chunk == "" || kind == "auto" || kind == "runtime")) {
+				return fmt.Errorf("parallel for schedule clause format error at line %d (expected: schedule(kind) or schedule(kind, chunk) with kind one of static dynamic guided auto runtime)", lineNum+1)
+			}
+			loop.Schedule = kind
+			if hasChunk {
+				loop.Schedule += ", " + chunk
+			}
+		default:
+			return clauseFormat
+		}
+	}
+	return nil
+}
+
+// Reports whether line declares a thread handle, as var t = spawn f(...) or
+// thread t = spawn f(...).
+func isSpawnDecl(line string) bool {
+	fields := strings.Fields(line)
+	return len(fields) >= 4 && (fields[0] == "var" || fields[0] == "thread") && fields[2] == "=" && fields[3] == "spawn"
+}
+
+func parseSpawnStatement(line string, lineNum int) (*Statement, int, error) {
+	handle := ""
+	if isSpawnDecl(line) {
+		left, right, _ := strings.Cut(line, "=")
+		handle = strings.Fields(left)[1]
+		line = strings.TrimSpace(right)
+	}
+	call := strings.TrimSpace(strings.TrimPrefix(line, "spawn"))
+	name, _, ok := strings.Cut(call, "(")
+	if !ok || !strings.HasSuffix(call, ")") || !isIdentifier(strings.TrimSpace(name)) || (handle != "" && !isIdentifier(handle)) {
+		return nil, lineNum + 1, fmt.Errorf("spawn requires a function call at line %d (expected: spawn f(...) or var t = spawn f(...))", lineNum+1)
+	}
+	return &Statement{Spawn: &SpawnStmt{Handle: handle, Call: call}}, lineNum + 1, nil
 }
 
 func parsePubStatement(lines []string, lineNum, currentIndent int) (*Statement, int, error) {
@@ -207,10 +477,14 @@ func parsePubStatement(lines []string, lineNum, currentIndent int) (*Statement,
 	}
 
 	switch parts[1] {
+	case "atomic":
+		return parseAtomicDeclaration(lines, lineNum, currentIndent, true)
 	case "class":
 		return parsePubClassStatement(lines, lineNum, currentIndent)
 	case "fn":
 		return parsePubFunctionStatement(lines, lineNum, currentIndent)
+	case "const":
+		return parseConstDeclaration(strings.TrimSpace(strings.TrimPrefix(line, "pub")), lineNum, currentIndent, true)
 	default:
 		if len(parts) >= 5 && parts[3] == "=" && isValidType(parts[1]) {
 			varType := parts[1]
@@ -234,10 +508,11 @@ func parsePubClassStatement(lines []string, lineNum, currentIndent int) (*Statem
 	if len(parts) < 3 || !strings.HasSuffix(line, ":") {
 		return nil, lineNum + 1, fmt.Errorf("pub class declaration format error at line %d", lineNum+1)
 	}
-	var (
-		className          = strings.TrimSuffix(parts[2], ":")
-		expectedBodyIndent = currentIndent + 4
-	)
+	className, baseName, interfaces, err := parseClassHeader(strings.Join(parts[2:], " "), lineNum)
+	if err != nil {
+		return nil, lineNum + 1, err
+	}
+	expectedBodyIndent := currentIndent + 4
 	if currentIndent == 0 {
 		bodyStartLine := lineNum + 1
 		for bodyStartLine < len(lines) {
@@ -255,6 +530,7 @@ func parsePubClassStatement(lines []string, lineNum, currentIndent int) (*Statem
 
 	var constructor *ConstructorStmt
 	var methods []*MethodDeclStmt
+	var deinit []*Statement
 	nextLine := lineNum + 1
 
 	for nextLine < len(lines) {
@@ -276,63 +552,25 @@ func parsePubClassStatement(lines []string, lineNum, currentIndent int) (*Statem
 		}
 
 		if strings.HasPrefix(trimmed, "init") {
-			var (
-				parameters     []*MethodParameter
-				initBody       []*Statement
-				initBodyIndent int
-				initStartLine  int
-			)
-			if strings.Contains(trimmed, "(") && strings.Contains(trimmed, ")") {
-				parenStart := strings.Index(trimmed, "(")
-				parenEnd := strings.Index(trimmed, ")")
-				if parenStart != -1 && parenEnd != -1 && parenEnd > parenStart {
-					paramsStr := strings.TrimSpace(trimmed[parenStart+1 : parenEnd])
-					if paramsStr != "" {
-						paramList := strings.SplitSeq(paramsStr, ",")
-						for paramStr := range paramList {
-							paramStr = strings.TrimSpace(paramStr)
-							paramParts := strings.Fields(paramStr)
-
-							param := &MethodParameter{}
-
-							if len(paramParts) >= 3 && paramParts[0] == "ref" {
-								param.IsRef = true
-								param.Type = paramParts[1]
-								param.Name = paramParts[2]
-								parameters = append(parameters, param)
-							} else if len(paramParts) == 2 {
-								param.Type = paramParts[0]
-								param.Name = paramParts[1]
-								param.IsRef = false
-								parameters = append(parameters, param)
-							} else if len(paramParts) == 1 {
-								param.Type = "int"
-								param.Name = paramParts[0]
-								param.IsRef = false
-								parameters = append(parameters, param)
-							}
-						}
-					}
-				}
-			}
-			initBodyIndent = expectedBodyIndent + 4
-			initStartLine = nextLine + 1
-			for initStartLine < len(lines) {
-				initLine := lines[initStartLine]
-				if strings.TrimSpace(initLine) != "" && !strings.HasPrefix(strings.TrimSpace(initLine), "#") {
-					initBodyIndent = getIndentation(initLine)
-					break
-				}
-				initStartLine++
+			parameters, err := parseConstructorParams(trimmed, nextLine)
+			if err != nil {
+				return nil, nextLine + 1, err
 			}
-
-			initBody, err := parseStatements(lines, initStartLine, initBodyIndent)
+			initBody, endLine, err := parseMemberBody(lines, nextLine, expectedBodyIndent)
 			if err != nil {
 				return nil, nextLine + 1, err
 			}
-
 			constructor = &ConstructorStmt{Parameters: parameters, Fields: initBody}
-			nextLine = findEndOfBlock(lines, initStartLine, initBodyIndent)
+			nextLine = endLine
+		} else if trimmed == "deinit:" {
+			if deinit != nil {
+				return nil, nextLine + 1, fmt.Errorf("class '%s' has more than one deinit block at line %d", className, nextLine+1)
+			}
+			body, endLine, err := parseMemberBody(lines, nextLine, expectedBodyIndent)
+			if err != nil {
+				return nil, nextLine + 1, err
+			}
+			deinit, nextLine = body, endLine
 		} else if strings.HasPrefix(trimmed, "fn ") {
 			method, newNextLine, err := parseMethodStatement(lines, nextLine, expectedBodyIndent)
 			if err != nil {
@@ -347,13 +585,117 @@ func parsePubClassStatement(lines []string, lineNum, currentIndent int) (*Statem
 
 	pubClassStmt := &PubClassDeclStmt{
 		Name:        className,
+		Base:        baseName,
+		Interfaces:  interfaces,
 		Constructor: constructor,
 		Methods:     methods,
+		Deinit:      deinit,
 	}
 
 	return &Statement{PubClassDecl: pubClassStmt}, nextLine, nil
 }
 
+// Parses the indented body of the init or deinit block whose header is at
+// headerLine, returning the statements and the line after the block.
+func parseMemberBody(lines []string, headerLine, memberIndent int) ([]*Statement, int, error) {
+	bodyIndent := memberIndent + 4
+	bodyStart := headerLine + 1
+	for bodyStart < len(lines) {
+		bodyLine := lines[bodyStart]
+		if strings.TrimSpace(bodyLine) != "" && !strings.HasPrefix(strings.TrimSpace(bodyLine), "#") {
+			bodyIndent = getIndentation(bodyLine)
+			break
+		}
+		bodyStart++
+	}
+	body, err := parseStatements(lines, bodyStart, bodyIndent)
+	if err != nil {
+		return nil, headerLine + 1, err
+	}
+	return body, findEndOfBlock(lines, bodyStart, bodyIndent), nil
+}
+
+// Parses the parameters of a constructor header such as
+// `init(string name, int w = 10):`. Parameters with default values must come
+// after those without, so callers can leave them out from the end.
+func parseConstructorParams(header string, lineNum int) ([]*MethodParameter, error) {
+	var (
+		parameters []*MethodParameter
+		parenStart = strings.Index(header, "(")
+		parenEnd   = strings.LastIndex(header, ")")
+	)
+	if parenStart == -1 || parenEnd <= parenStart {
+		return nil, nil
+	}
+	paramsStr := strings.TrimSpace(header[parenStart+1 : parenEnd])
+	if paramsStr == "" {
+		return nil, nil
+	}
+	for _, paramStr := range SplitArguments(paramsStr) {
+		param := &MethodParameter{}
+		if decl, value, ok := strings.Cut(paramStr, "="); ok {
+			paramStr, param.Default = strings.TrimSpace(decl), strings.TrimSpace(value)
+			if param.Default == "" {
+				return nil, fmt.Errorf("missing default value for constructor parameter '%s' at line %d", paramStr, lineNum+1)
+			}
+		}
+		paramParts := strings.Fields(paramStr)
+		if len(paramParts) >= 3 && paramParts[0] == "ref" {
+			param.IsRef = true
+			param.Type = paramParts[1]
+			param.Name = paramParts[2]
+		} else if len(paramParts) == 2 {
+			param.Type = paramParts[0]
+			param.Name = paramParts[1]
+		} else if len(paramParts) == 1 {
+			param.Type = "int"
+			param.Name = paramParts[0]
+		}
+		if param.Default == "" && len(parameters) > 0 && parameters[len(parameters)-1].Default != "" {
+			return nil, fmt.Errorf("constructor parameter '%s' without a default value follows one with a default at line %d", param.Name, lineNum+1)
+		}
+		parameters = append(parameters, param)
+	}
+	return parameters, nil
+}
+
+// Splits a class header such as `Dog(Animal) implements Pet:` into the class
+// name, the base class name and the implemented interfaces.
+func parseClassHeader(header string, lineNum int) (string, string, []string, error) {
+	header = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(header), ":"))
+
+	var interfaces []string
+	if before, after, found := strings.Cut(header, " implements "); found {
+		for name := range strings.SplitSeq(after, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" || strings.ContainsAny(name, " ()") {
+				return "", "", nil, fmt.Errorf("invalid interface list in class declaration at line %d", lineNum+1)
+			}
+			interfaces = append(interfaces, name)
+		}
+		header = strings.TrimSpace(before)
+	}
+
+	open := strings.Index(header, "(")
+	if open == -1 {
+		return header, "", interfaces, nil
+	}
+	if !strings.HasSuffix(header, ")") {
+		return "", "", nil, fmt.Errorf("class declaration missing closing parenthesis at line %d", lineNum+1)
+	}
+	var (
+		className = strings.TrimSpace(header[:open])
+		baseName  = strings.TrimSpace(header[open+1 : len(header)-1])
+	)
+	if baseName == "" || strings.ContainsAny(baseName, " ,()") {
+		return "", "", nil, fmt.Errorf("class '%s' must name exactly one base class at line %d", className, lineNum+1)
+	}
+	if baseName == className {
+		return "", "", nil, fmt.Errorf("class '%s' cannot inherit from itself at line %d", className, lineNum+1)
+	}
+	return className, baseName, interfaces, nil
+}
+
 func parseClassStatement(lines []string, lineNum, currentIndent int) (*Statement, int, error) {
 	line := strings.TrimSpace(lines[lineNum])
 	parts := strings.Fields(line)
@@ -362,10 +704,11 @@ func parseClassStatement(lines []string, lineNum, currentIndent int) (*Statement
 		return nil, lineNum + 1, fmt.Errorf("class declaration format error at line %d", lineNum+1)
 	}
 
-	var (
-		className          = strings.TrimSuffix(parts[1], ":")
-		expectedBodyIndent = currentIndent + 4
-	)
+	className, baseName, interfaces, err := parseClassHeader(strings.Join(parts[1:], " "), lineNum)
+	if err != nil {
+		return nil, lineNum + 1, err
+	}
+	expectedBodyIndent := currentIndent + 4
 	if currentIndent == 0 {
 		bodyStartLine := lineNum + 1
 		for bodyStartLine < len(lines) {
@@ -383,6 +726,7 @@ func parseClassStatement(lines []string, lineNum, currentIndent int) (*Statement
 
 	var constructor *ConstructorStmt
 	var methods []*MethodDeclStmt
+	var deinit []*Statement
 	nextLine := lineNum + 1
 
 	for nextLine < len(lines) {
@@ -404,60 +748,25 @@ func parseClassStatement(lines []string, lineNum, currentIndent int) (*Statement
 		}
 
 		if strings.HasPrefix(trimmed, "init") {
-			var parameters []*MethodParameter
-			var initBody []*Statement
-			var initBodyIndent int
-			var initStartLine int
-
-			if strings.Contains(trimmed, "(") && strings.Contains(trimmed, ")") {
-				parenStart := strings.Index(trimmed, "(")
-				parenEnd := strings.Index(trimmed, ")")
-				if parenStart != -1 && parenEnd != -1 && parenEnd > parenStart {
-					paramsStr := strings.TrimSpace(trimmed[parenStart+1 : parenEnd])
-					if paramsStr != "" {
-						paramList := strings.SplitSeq(paramsStr, ",")
-						for paramStr := range paramList {
-							paramStr = strings.TrimSpace(paramStr)
-							paramParts := strings.Fields(paramStr)
-
-							param := &MethodParameter{}
-
-							if len(paramParts) >= 3 && paramParts[0] == "ref" {
-								param.IsRef = true
-								param.Type = paramParts[1]
-								param.Name = paramParts[2]
-							} else if len(paramParts) == 2 {
-								param.Type = paramParts[0]
-								param.Name = paramParts[1]
-							} else if len(paramParts) == 1 {
-								param.Type = "int"
-								param.Name = paramParts[0]
-							}
-
-							parameters = append(parameters, param)
-						}
-					}
-				}
-			}
-
-			initBodyIndent = expectedBodyIndent + 4
-			initStartLine = nextLine + 1
-			for initStartLine < len(lines) {
-				initLine := lines[initStartLine]
-				if strings.TrimSpace(initLine) != "" && !strings.HasPrefix(strings.TrimSpace(initLine), "#") {
-					initBodyIndent = getIndentation(initLine)
-					break
-				}
-				initStartLine++
+			parameters, err := parseConstructorParams(trimmed, nextLine)
+			if err != nil {
+				return nil, nextLine + 1, err
 			}
-
-			initBody, err := parseStatements(lines, initStartLine, initBodyIndent)
+			initBody, endLine, err := parseMemberBody(lines, nextLine, expectedBodyIndent)
 			if err != nil {
 				return nil, nextLine + 1, err
 			}
-
 			constructor = &ConstructorStmt{Parameters: parameters, Fields: initBody}
-			nextLine = findEndOfBlock(lines, initStartLine, initBodyIndent)
+			nextLine = endLine
+		} else if trimmed == "deinit:" {
+			if deinit != nil {
+				return nil, nextLine + 1, fmt.Errorf("class '%s' has more than one deinit block at line %d", className, nextLine+1)
+			}
+			body, endLine, err := parseMemberBody(lines, nextLine, expectedBodyIndent)
+			if err != nil {
+				return nil, nextLine + 1, err
+			}
+			deinit, nextLine = body, endLine
 		} else if strings.HasPrefix(trimmed, "fn ") {
 			method, newNextLine, err := parseMethodStatement(lines, nextLine, expectedBodyIndent)
 			if err != nil {
@@ -472,8 +781,11 @@ func parseClassStatement(lines []string, lineNum, currentIndent int) (*Statement
 
 	classStmt := &ClassDeclStmt{
 		Name:        className,
+		Base:        baseName,
+		Interfaces:  interfaces,
 		Constructor: constructor,
 		Methods:     methods,
+		Deinit:      deinit,
 	}
 
 	return &Statement{ClassDecl: classStmt}, nextLine, nil
@@ -507,8 +819,125 @@ func parseTopLevelFunctionStatement(lines []string, lineNum, currentIndent int)
 		funcName = strings.TrimSpace(funcName[4:])
 	}
 
-	// Parse parameters
-	paramsStr := strings.TrimSpace(line[parenStart+1 : parenEnd])
+	parameters, err := parseFunctionParameters(strings.TrimSpace(line[parenStart+1:parenEnd]), lineNum)
+	if err != nil {
+		return nil, lineNum + 1, err
+	}
+
+	// Parse function body
+	expectedBodyIndent := currentIndent + 4
+	if currentIndent == 0 {
+		bodyStartLine := lineNum + 1
+		for bodyStartLine < len(lines) {
+			bodyLine := lines[bodyStartLine]
+			if strings.TrimSpace(bodyLine) != "" && !strings.HasPrefix(strings.TrimSpace(bodyLine), "#") {
+				expectedBodyIndent = getIndentation(bodyLine)
+				break
+			}
+			bodyStartLine++
+		}
+		if expectedBodyIndent <= currentIndent {
+			expectedBodyIndent = currentIndent + 4
+		}
+	}
+
+	body, err := parseStatements(lines, lineNum+1, expectedBodyIndent)
+	if err != nil {
+		return nil, lineNum + 1, err
+	}
+
+	nextLine := findEndOfBlock(lines, lineNum+1, expectedBodyIndent)
+
+	stmt := &Statement{}
+	if strings.HasPrefix(line, "pub fn ") {
+		stmt.PubTopLevelFuncDecl = &PubTopLevelFuncDeclStmt{
+			Name:       funcName,
+			Parameters: parameters,
+			ReturnType: returnType,
+			Body:       body,
+		}
+	} else {
+		stmt.TopLevelFuncDecl = &TopLevelFuncDeclStmt{
+			Name:       funcName,
+			Parameters: parameters,
+			ReturnType: returnType,
+			Body:       body,
+		}
+	}
+
+	return stmt, nextLine, nil
+}
+
+// Parses extern fn name(params) -> type from "header.h", where the return type
+// and the header are optional.
+func parseExternFunction(line string, lineNum int) (*ExternFuncStmt, error) {
+	formatErr := fmt.Errorf("extern function declaration format error at line %d (expected: extern fn name(params) -> type from \"header.h\")", lineNum+1)
+	rest, ok := strings.CutPrefix(line, "extern fn ")
+	parenStart := strings.Index(rest, "(")
+	if !ok || parenStart == -1 {
+		return nil, formatErr
+	}
+	parenEnd := findMatchingParen(rest, parenStart)
+	name := strings.TrimSpace(rest[:parenStart])
+	if parenEnd == -1 || !isIdentifier(name) {
+		return nil, formatErr
+	}
+	extern := &ExternFuncStmt{Name: name, ReturnType: "void"}
+	params := strings.TrimSpace(rest[parenStart+1 : parenEnd])
+	rest = strings.TrimSpace(rest[parenEnd+1:])
+	if returnType, ok := strings.CutPrefix(rest, "->"); ok {
+		returnType, rest, _ = strings.Cut(strings.TrimSpace(returnType), " ")
+		extern.ReturnType = returnType
+		rest = strings.TrimSpace(rest)
+	}
+	if header, ok := strings.CutPrefix(rest, "from "); ok {
+		header = strings.TrimSpace(header)
+		if len(header) < 3 || !strings.HasPrefix(header, "\"") || !strings.HasSuffix(header, "\"") {
+			return nil, formatErr
+		}
+		extern.Header = header[1 : len(header)-1]
+	} else if rest != "" {
+		return nil, formatErr
+	}
+	if extern.ReturnType != "void" && !isValidType(extern.ReturnType) || strings.HasPrefix(extern.ReturnType, "list[") {
+		return nil, fmt.Errorf("invalid return type '%s' of extern function '%s' at line %d", extern.ReturnType, name, lineNum+1)
+	}
+
+	parameters, err := parseFunctionParameters(params, lineNum)
+	if err != nil {
+		return nil, err
+	}
+	for _, param := range parameters {
+		if param.IsList {
+			return nil, fmt.Errorf("extern function '%s' cannot take the list '%s' at line %d, C functions take pointers and lengths instead", name, param.Name, lineNum+1)
+		}
+		if isClassType(param.Type) {
+			return nil, fmt.Errorf("invalid parameter type '%s' at line %d", param.Type, lineNum+1)
+		}
+	}
+	extern.Parameters = parameters
+	return extern, nil
+}
+
+// Reports whether a type names a class, which may be qualified by the module
+// declaring it as in geometry.Point or geometry::Point.
+func isClassType(s string) bool {
+	if classTypes[s] {
+		return true
+	}
+	if module, class, qualified := strings.Cut(s, "."); qualified {
+		return isIdentifier(module) && isIdentifier(class)
+	}
+	for module := range importedModules {
+		if class, ok := strings.CutPrefix(s, module+"_"); ok && isIdentifier(class) {
+			return true
+		}
+	}
+	return false
+}
+
+// Parses the parameters of a function declaration, as in "int a, ref string b".
+func parseFunctionParameters(paramsStr string, lineNum int) ([]*MethodParameter, error) {
 	var parameters []*MethodParameter
 	if paramsStr != "" {
 		paramList := strings.Split(paramsStr, ",")
@@ -519,7 +948,7 @@ func parseTopLevelFunctionStatement(lines []string, lineNum, currentIndent int)
 			}
 			paramParts := strings.Fields(param)
 			if len(paramParts) < 2 {
-				return nil, lineNum + 1, fmt.Errorf("invalid parameter format at line %d", lineNum+1)
+				return nil, fmt.Errorf("invalid parameter format at line %d", lineNum+1)
 			}
 
 			var paramType, paramName string
@@ -535,7 +964,7 @@ func parseTopLevelFunctionStatement(lines []string, lineNum, currentIndent int)
 				paramType = paramParts[0]
 				paramName = paramParts[1]
 			} else {
-				return nil, lineNum + 1, fmt.Errorf("invalid parameter format at line %d", lineNum+1)
+				return nil, fmt.Errorf("invalid parameter format at line %d", lineNum+1)
 			}
 
 			if strings.HasPrefix(paramType, "list[") && strings.HasSuffix(paramType, "]") {
@@ -544,8 +973,12 @@ func parseTopLevelFunctionStatement(lines []string, lineNum, currentIndent int)
 				paramType = listType
 			}
 
-			if !isValidType(paramType) && !isList {
-				return nil, lineNum + 1, fmt.Errorf("invalid parameter type '%s' at line %d", paramType, lineNum+1)
+			if !isValidType(paramType) && !isList && !isClassType(paramType) {
+				return nil, fmt.Errorf("invalid parameter type '%s' at line %d", paramType, lineNum+1)
+			}
+			// geometry.Point names the same class as geometry::Point.
+			if module, class, qualified := strings.Cut(paramType, "."); qualified && !isList {
+				paramType = GenerateUniqueSymbol(class, module)
 			}
 
 			parameters = append(parameters, &MethodParameter{
@@ -557,68 +990,52 @@ func parseTopLevelFunctionStatement(lines []string, lineNum, currentIndent int)
 			})
 		}
 	}
+	return parameters, nil
+}
 
-	// Parse function body
-	expectedBodyIndent := currentIndent + 4
-	if currentIndent == 0 {
-		bodyStartLine := lineNum + 1
-		for bodyStartLine < len(lines) {
-			bodyLine := lines[bodyStartLine]
-			if strings.TrimSpace(bodyLine) != "" && !strings.HasPrefix(strings.TrimSpace(bodyLine), "#") {
-				expectedBodyIndent = getIndentation(bodyLine)
-				break
-			}
-			bodyStartLine++
-		}
-		if expectedBodyIndent <= currentIndent {
-			expectedBodyIndent = currentIndent + 4
-		}
+func parseMethodStatement(lines []string, lineNum, currentIndent int) (*MethodDeclStmt, int, error) {
+	line := strings.TrimSpace(lines[lineNum])
+
+	if !strings.HasPrefix(line, "fn ") || !strings.HasSuffix(line, ":") {
+		return nil, lineNum + 1, fmt.Errorf("invalid method declaration at line %d", lineNum+1)
 	}
 
-	body, err := parseStatements(lines, lineNum+1, expectedBodyIndent)
+	method, err := parseMethodSignature(strings.TrimSpace(line[3:len(line)-1]), lineNum)
 	if err != nil {
 		return nil, lineNum + 1, err
 	}
 
-	nextLine := findEndOfBlock(lines, lineNum+1, expectedBodyIndent)
-
-	stmt := &Statement{}
-	if strings.HasPrefix(line, "pub fn ") {
-		stmt.PubTopLevelFuncDecl = &PubTopLevelFuncDeclStmt{
-			Name:       funcName,
-			Parameters: parameters,
-			ReturnType: returnType,
-			Body:       body,
-		}
-	} else {
-		stmt.TopLevelFuncDecl = &TopLevelFuncDeclStmt{
-			Name:       funcName,
-			Parameters: parameters,
-			ReturnType: returnType,
-			Body:       body,
+	expectedBodyIndent := currentIndent + 4
+	bodyStartLine := lineNum + 1
+	for bodyStartLine < len(lines) {
+		bodyLine := lines[bodyStartLine]
+		if strings.TrimSpace(bodyLine) != "" && !strings.HasPrefix(strings.TrimSpace(bodyLine), "#") {
+			expectedBodyIndent = getIndentation(bodyLine)
+			break
 		}
+		bodyStartLine++
 	}
 
-	return stmt, nextLine, nil
-}
-
-func parseMethodStatement(lines []string, lineNum, currentIndent int) (*MethodDeclStmt, int, error) {
-	line := strings.TrimSpace(lines[lineNum])
-
-	if !strings.HasPrefix(line, "fn ") || !strings.HasSuffix(line, ":") {
-		return nil, lineNum + 1, fmt.Errorf("invalid method declaration at line %d", lineNum+1)
+	body, err := parseStatements(lines, bodyStartLine, expectedBodyIndent)
+	if err != nil {
+		return nil, lineNum + 1, err
 	}
+	method.Body = body
 
-	signature := strings.TrimSpace(line[3 : len(line)-1])
+	return method, findEndOfBlock(lines, bodyStartLine, expectedBodyIndent), nil
+}
+
+// Parses the `name(params) -> type` part of a method declaration.
+func parseMethodSignature(signature string, lineNum int) (*MethodDeclStmt, error) {
 	parenStart := strings.Index(signature, "(")
 	if parenStart == -1 {
-		return nil, lineNum + 1, fmt.Errorf("method declaration missing parameters at line %d", lineNum+1)
+		return nil, fmt.Errorf("method declaration missing parameters at line %d", lineNum+1)
 	}
 
 	methodName := strings.TrimSpace(signature[:parenStart])
 	parenEnd := strings.Index(signature, ")")
 	if parenEnd == -1 || parenEnd <= parenStart {
-		return nil, lineNum + 1, fmt.Errorf("method declaration missing closing parenthesis at line %d", lineNum+1)
+		return nil, fmt.Errorf("method declaration missing closing parenthesis at line %d", lineNum+1)
 	}
 
 	paramsStr := strings.TrimSpace(signature[parenStart+1 : parenEnd])
@@ -658,30 +1075,51 @@ func parseMethodStatement(lines []string, lineNum, currentIndent int) (*MethodDe
 		returnType = "void"
 	}
 
-	expectedBodyIndent := currentIndent + 4
-	bodyStartLine := lineNum + 1
-	for bodyStartLine < len(lines) {
-		bodyLine := lines[bodyStartLine]
-		if strings.TrimSpace(bodyLine) != "" && !strings.HasPrefix(strings.TrimSpace(bodyLine), "#") {
-			expectedBodyIndent = getIndentation(bodyLine)
+	return &MethodDeclStmt{
+		Name:       methodName,
+		Parameters: parameters,
+		ReturnType: returnType,
+	}, nil
+}
+
+// Parses an interface declaration whose body lists method signatures.
+func parseInterfaceStatement(lines []string, lineNum, currentIndent int) (*Statement, int, error) {
+	line := strings.TrimSpace(lines[lineNum])
+	parts := strings.Fields(line)
+
+	if len(parts) != 2 || !strings.HasSuffix(line, ":") {
+		return nil, lineNum + 1, fmt.Errorf("interface declaration format error at line %d", lineNum+1)
+	}
+
+	var (
+		interfaceName = strings.TrimSuffix(parts[1], ":")
+		methods       []*MethodDeclStmt
+		nextLine      = lineNum + 1
+	)
+	for nextLine < len(lines) {
+		trimmed := strings.TrimSpace(lines[nextLine])
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			nextLine++
+			continue
+		}
+		if getIndentation(lines[nextLine]) <= currentIndent {
 			break
 		}
-		bodyStartLine++
+		if !strings.HasPrefix(trimmed, "fn ") || strings.HasSuffix(trimmed, ":") {
+			return nil, nextLine + 1, fmt.Errorf("interface '%s' may only declare method signatures at line %d", interfaceName, nextLine+1)
+		}
+		method, err := parseMethodSignature(strings.TrimSpace(trimmed[3:]), nextLine)
+		if err != nil {
+			return nil, nextLine + 1, err
+		}
+		methods = append(methods, method)
+		nextLine++
 	}
-
-	body, err := parseStatements(lines, bodyStartLine, expectedBodyIndent)
-	if err != nil {
-		return nil, lineNum + 1, err
+	if len(methods) == 0 {
+		return nil, lineNum + 1, fmt.Errorf("interface '%s' declares no methods at line %d", interfaceName, lineNum+1)
 	}
 
-	nextLine := findEndOfBlock(lines, bodyStartLine, expectedBodyIndent)
-
-	return &MethodDeclStmt{
-		Name:       methodName,
-		Parameters: parameters,
-		ReturnType: returnType,
-		Body:       body,
-	}, nextLine, nil
+	return &Statement{InterfaceDecl: &InterfaceDeclStmt{Name: interfaceName, Methods: methods}}, nextLine, nil
 }
 
 // TODO: Replace placeholder for handling index assignment.
@@ -728,6 +1166,100 @@ func parseElifStatement(lines []string, lineNum, currentIndent int) (*ElifStmt,
 	return &ElifStmt{Condition: condition, Body: body}, nextLine, nil
 }
 
+// Returns the indentation of the block following a line, taken from its first
+// non-blank line.
+func nestedIndent(lines []string, lineNum, currentIndent int) int {
+	for i := lineNum + 1; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if indent := getIndentation(lines[i]); indent > currentIndent {
+			return indent
+		}
+		break
+	}
+	return currentIndent + 4
+}
+
+// Parses a match statement. Each arm is either case followed by one or more
+// comma separated values or lo..hi ranges, or a final else (or case _) arm.
+func parseMatchStatement(lines []string, lineNum, currentIndent int) (*Statement, int, error) {
+	line := strings.TrimSpace(lines[lineNum])
+	if !strings.HasSuffix(line, ":") || len(strings.TrimSpace(line[5:len(line)-1])) == 0 {
+		return nil, lineNum + 1, fmt.Errorf("match statement format error at line %d", lineNum+1)
+	}
+
+	var (
+		match     = &MatchStmt{Value: strings.TrimSpace(line[5 : len(line)-1])}
+		armIndent = nestedIndent(lines, lineNum, currentIndent)
+		nextLine  = lineNum + 1
+	)
+	for nextLine < len(lines) {
+		trimmed := strings.TrimSpace(lines[nextLine])
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			nextLine++
+			continue
+		}
+		indent := getIndentation(lines[nextLine])
+		if indent < armIndent {
+			break
+		}
+		if indent > armIndent {
+			return nil, nextLine + 1, fmt.Errorf("unexpected indentation at line %d (expected %d, got %d)", nextLine+1, armIndent, indent)
+		}
+		if match.Else != nil {
+			return nil, nextLine + 1, fmt.Errorf("match arm after else at line %d", nextLine+1)
+		}
+
+		isElse := trimmed == "else:" || trimmed == "case _:"
+		if !isElse && (!strings.HasPrefix(trimmed, "case ") || !strings.HasSuffix(trimmed, ":")) {
+			return nil, nextLine + 1, fmt.Errorf("expected case or else in match at line %d", nextLine+1)
+		}
+		var values []string
+		if !isElse {
+			for _, value := range parseArgumentsRespectingNesting(strings.TrimSpace(trimmed[5 : len(trimmed)-1])) {
+				if value = strings.TrimSpace(value); value == "" {
+					return nil, nextLine + 1, fmt.Errorf("empty case value at line %d", nextLine+1)
+				}
+				values = append(values, value)
+			}
+			if len(values) == 0 {
+				return nil, nextLine + 1, fmt.Errorf("case requires at least one value at line %d", nextLine+1)
+			}
+		}
+
+		bodyIndent := nestedIndent(lines, nextLine, armIndent)
+		body, err := parseStatements(lines, nextLine+1, bodyIndent)
+		if err != nil {
+			return nil, nextLine + 1, err
+		}
+		if len(body) == 0 {
+			return nil, nextLine + 1, fmt.Errorf("match arm has no body at line %d", nextLine+1)
+		}
+		if isElse {
+			match.Else = &ElseStmt{Body: body}
+		} else {
+			match.Cases = append(match.Cases, &CaseStmt{Values: values, Body: body, Line: nextLine + 1})
+		}
+		nextLine = findEndOfBlock(lines, nextLine+1, bodyIndent)
+	}
+
+	if len(match.Cases) == 0 && match.Else == nil {
+		return nil, lineNum + 1, fmt.Errorf("match statement has no arms at line %d", lineNum+1)
+	}
+	return &Statement{Match: match}, nextLine, nil
+}
+
+// Splits a lo..hi case value into its inclusive bounds.
+func CaseRange(value string) (string, string, bool) {
+	low, high, found := strings.Cut(value, "..")
+	if !found {
+		return "", "", false
+	}
+	return strings.TrimSpace(low), strings.TrimSpace(high), true
+}
+
 func parseElseStatement(lines []string, lineNum, currentIndent int) (*ElseStmt, int, error) {
 	line := strings.TrimSpace(lines[lineNum])
 
@@ -762,13 +1294,25 @@ func parseElseStatement(lines []string, lineNum, currentIndent int) (*ElseStmt,
 	return &ElseStmt{Body: body}, nextLine, nil
 }
 
+// Loads a module and, before it, every module it imports. Each module is
+// loaded once, and an import that leads back to a module still loading is
+// reported as a cycle.
 func LoadModule(moduleName string, baseDir string) (*ModuleInfo, error) {
-	if module, exists := LoadedModules[moduleName]; exists {
+	key := ModuleBaseName(moduleName)
+	if module, exists := LoadedModules[key]; exists {
 		return module, nil
 	}
+	if err := importCycle(key); err != nil {
+		return nil, err
+	}
+	loadingModules = append(loadingModules, key)
+	defer func() { loadingModules = loadingModules[:len(loadingModules)-1] }()
 
-	var modulePath string
-	if strings.HasPrefix(moduleName, "std/") {
+	var (
+		modulePath string
+		std        = strings.HasPrefix(moduleName, "std/")
+	)
+	if std {
 		exePath, err := os.Executable()
 		if err != nil {
 			return nil, fmt.Errorf("could not resolve std module path: %v", err)
@@ -783,8 +1327,12 @@ func LoadModule(moduleName string, baseDir string) (*ModuleInfo, error) {
 		possiblePaths := []string{
 			filepath.Join(baseDir, moduleName+".scar"),
 			filepath.Join(baseDir, "modules", moduleName+".scar"),
-			filepath.Join(".", moduleName+".scar"),
+			filepath.Join(baseDir, manifest.DepsDirName, moduleName, moduleName+".scar"),
+		}
+		for _, dir := range ModuleSearchDirs {
+			possiblePaths = append(possiblePaths, filepath.Join(dir, moduleName+".scar"))
 		}
+		possiblePaths = append(possiblePaths, filepath.Join(".", moduleName+".scar"))
 
 		for _, path := range possiblePaths {
 			if _, err := os.Stat(path); err == nil {
@@ -806,9 +1354,24 @@ func LoadModule(moduleName string, baseDir string) (*ModuleInfo, error) {
 	// Remove comments from the imported module source
 	sourceWithoutComments := RemoveComments(string(data))
 
-	program, err := ParseWithIndentation(ReplaceDoubleColonsOutsideStrings(sourceWithoutComments))
+	program, err := ParseWithIndentation(ReplaceDoubleColonsOutsideStrings(ResolveImportAliases(sourceWithoutComments)))
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse module '%s': %v", moduleName, err)
+		for _, err := range diagnostics.Split(err) {
+			var d *diagnostics.Diagnostic
+			if errors.As(err, &d) {
+				d.File = modulePath
+			}
+		}
+		return nil, fmt.Errorf("failed to parse module '%s': %w", moduleName, err)
+	}
+	AttachDocComments(program, string(data))
+
+	if errs := CheckDuplicateDefinitions(program.Statements); len(errs) > 0 {
+		list := make(diagnostics.List, len(errs))
+		for i, err := range errs {
+			list[i] = diagnostics.FromError(err, modulePath)
+		}
+		return nil, fmt.Errorf("invalid module '%s': %w", moduleName, list)
 	}
 
 	// Reorder function declarations to handle hoisting
@@ -818,28 +1381,53 @@ func LoadModule(moduleName string, baseDir string) (*ModuleInfo, error) {
 	}
 	program.Statements = hoistedStatements
 
+	var imports []string
+	for _, imp := range program.Imports {
+		dependency, err := LoadModule(imp.Module, filepath.Dir(modulePath))
+		if isImportCycle(err) {
+			return nil, err
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to load module '%s' imported by '%s': %v", imp.Module, moduleName, err)
+		}
+		imports = append(imports, dependency.Name)
+	}
+
 	module := &ModuleInfo{
 		Name:          moduleName,
 		FilePath:      modulePath,
 		PublicVars:    make(map[string]*VarDeclStmt),
 		PublicClasses: make(map[string]*ClassDeclStmt),
 		PublicFuncs:   make(map[string]*MethodDeclStmt),
+		PublicConsts:  make(map[string]*ConstDeclStmt),
+		Imports:       imports,
+		Std:           std,
 	}
 
 	for _, stmt := range program.Statements {
+		if stmt.ConstDecl != nil && stmt.ConstDecl.Public {
+			module.PublicConsts[stmt.ConstDecl.Name] = stmt.ConstDecl
+		}
+		if stmt.ExternFunc != nil {
+			module.Externs = append(module.Externs, stmt.ExternFunc)
+		}
 		if stmt.PubVarDecl != nil {
 			varDecl := &VarDeclStmt{
-				Type:  stmt.PubVarDecl.Type,
-				Name:  stmt.PubVarDecl.Name,
-				Value: stmt.PubVarDecl.Value,
+				Type:   stmt.PubVarDecl.Type,
+				Name:   stmt.PubVarDecl.Name,
+				Value:  stmt.PubVarDecl.Value,
+				Atomic: stmt.PubVarDecl.Atomic,
 			}
 			module.PublicVars[stmt.PubVarDecl.Name] = varDecl
 		}
 		if stmt.PubClassDecl != nil {
 			classDecl := &ClassDeclStmt{
 				Name:        stmt.PubClassDecl.Name,
+				Base:        stmt.PubClassDecl.Base,
+				Interfaces:  stmt.PubClassDecl.Interfaces,
 				Constructor: stmt.PubClassDecl.Constructor,
 				Methods:     stmt.PubClassDecl.Methods,
+				Deinit:      stmt.PubClassDecl.Deinit,
 			}
 			module.PublicClasses[stmt.PubClassDecl.Name] = classDecl
 		}
@@ -849,12 +1437,13 @@ func LoadModule(moduleName string, baseDir string) (*ModuleInfo, error) {
 				Parameters: stmt.PubTopLevelFuncDecl.Parameters,
 				ReturnType: stmt.PubTopLevelFuncDecl.ReturnType,
 				Body:       stmt.PubTopLevelFuncDecl.Body,
+				Doc:        stmt.Doc,
 			}
 			module.PublicFuncs[stmt.PubTopLevelFuncDecl.Name] = funcDecl
 		}
 	}
 
-	LoadedModules[moduleName] = module
+	LoadedModules[key] = module
 	return module, nil
 }
 
@@ -863,11 +1452,12 @@ func ReplaceDoubleColonsOutsideStrings(input string) string {
 	inString := false
 	for i := 0; i < len(input); i++ {
 		ch := input[i]
+		if inString && ch == '\\' && i+1 < len(input) {
+			result.WriteString(input[i : i+2])
+			i++
+			continue
+		}
 		if ch == '"' {
-			if i > 0 && input[i-1] == '\\' {
-				result.WriteByte(ch)
-				continue
-			}
 			inString = !inString
 			result.WriteByte(ch)
 			continue
@@ -976,14 +1566,18 @@ func splitRespectingParens(input string) []string {
 		current    strings.Builder
 		parenCount = 0
 		inQuotes   = false
+		escaped    = false
 	)
 
-	for i, char := range input {
+	for _, char := range input {
+		if inQuotes && (escaped || char == '\\') {
+			escaped = !escaped
+			current.WriteRune(char)
+			continue
+		}
 		switch char {
 		case '"':
-			if i == 0 || input[i-1] != '\\' {
-				inQuotes = !inQuotes
-			}
+			inQuotes = !inQuotes
 			current.WriteRune(char)
 		case '(':
 			if !inQuotes {
@@ -1045,3 +1639,68 @@ func parseBulkImport(lines []string, lineNum int) (*Statement, int, error) {
 	}
 	return &Statement{Import: imports[0]}, currentLine, nil
 }
+
+// Returns the element type of a list type such as list[int] or list[list[int]].
+// Lists nest at most two levels deep.
+func parseListType(typ string, lineNum int) (string, error) {
+	if !strings.HasPrefix(typ, "list[") || !strings.HasSuffix(typ, "]") || len(typ) == len("list[]") {
+		return "", fmt.Errorf("invalid list type declaration at line %d", lineNum+1)
+	}
+	elemType := typ[5 : len(typ)-1]
+	if inner, ok := strings.CutPrefix(elemType, "list["); ok && strings.HasPrefix(inner, "list[") {
+		return "", fmt.Errorf("lists can be nested at most two levels deep at line %d", lineNum+1)
+	}
+	return elemType, nil
+}
+
+// Parses the bracketed elements after the '=' of a list declaration. String
+// elements lose their quotes, while nested list elements are kept whole.
+func parseListElements(line string, lineNum int) ([]string, error) {
+	start := -1
+	if eq := strings.Index(line, "="); eq != -1 {
+		if start = strings.Index(line[eq:], "["); start != -1 {
+			start += eq
+		}
+	}
+	if start == -1 {
+		return nil, fmt.Errorf("list declaration missing elements at line %d", lineNum+1)
+	}
+	end := strings.LastIndex(line, "]")
+	if end <= start {
+		return nil, fmt.Errorf("list declaration missing closing bracket at line %d", lineNum+1)
+	}
+
+	var elements []string
+	for _, elem := range parseArgumentsRespectingNesting(line[start+1 : end]) {
+		if elem == "" {
+			continue
+		}
+		if len(elem) >= 2 && strings.HasPrefix(elem, "\"") && strings.HasSuffix(elem, "\"") {
+			elem = elem[1 : len(elem)-1]
+		}
+		elements = append(elements, elem)
+	}
+	return elements, nil
+}
+
+// Parses a set declaration such as set[int] seen = [1, 2, 3].
+func parseSetDecl(line string, lineNum int) (*Statement, int, error) {
+	typeEnd := strings.Index(line, "]")
+	if typeEnd == -1 || typeEnd == len("set[") {
+		return nil, lineNum + 1, fmt.Errorf("invalid set type declaration at line %d", lineNum+1)
+	}
+	elemType := strings.TrimSpace(line[len("set["):typeEnd])
+	parts := strings.Fields(line[typeEnd+1:])
+	if len(parts) < 3 || parts[1] != "=" {
+		return nil, lineNum + 1, fmt.Errorf("set declaration format error at line %d (expected: set[type] name = [elements])", lineNum+1)
+	}
+	elements, err := parseListElements(line, lineNum)
+	if err != nil {
+		return nil, lineNum + 1, err
+	}
+	return &Statement{SetDecl: &SetDeclStmt{
+		ElemType: elemType,
+		Name:     parts[0],
+		Elements: elements,
+	}}, lineNum + 1, nil
+}
@@ -0,0 +1,48 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains range expressions, which stand for a run of consecutive integers.
+//
+// range(lo, hi) stands for the integers from lo up to hi excluded, and lo..hi
+// for those from lo up to hi included, like the ranges of match cases and the
+// bounds of for loops. A foreach over a range is parsed as a for loop
+// counting over it, and a list can be declared from a range to hold its
+// integers.
+
+package lexer
+
+import "strings"
+
+// Splits a range expression into its first and last integer. Reports false
+// when value is not a range.
+func ParseRange(value string) (low, high string, ok bool) {
+	value = strings.TrimSpace(value)
+	if inner, isCall := strings.CutPrefix(value, "range("); isCall && strings.HasSuffix(inner, ")") {
+		args := SplitArguments(inner[:len(inner)-1])
+		if len(args) != 2 || !isRangeBound(args[0]) || !isRangeBound(args[1]) {
+			return "", "", false
+		}
+		end := strings.TrimSpace(args[1])
+		if strings.ContainsAny(end, " +-*/%<>=!&|^?") {
+			end = "(" + end + ")"
+		}
+		return strings.TrimSpace(args[0]), end + " - 1", true
+	}
+
+	low, high, found := strings.Cut(value, "..")
+	if !found || strings.Contains(high, "..") || strings.ContainsAny(value, `"'`) || !isRangeBound(low) || !isRangeBound(high) {
+		return "", "", false
+	}
+	return strings.TrimSpace(low), strings.TrimSpace(high), true
+}
+
+// Reports whether a bound of a range is an expression.
+func isRangeBound(bound string) bool {
+	bound = strings.TrimSpace(bound)
+	if bound == "" {
+		return false
+	}
+	_, err := ParseExpr(bound)
+	return err == nil
+}
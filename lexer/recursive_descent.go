@@ -12,6 +12,22 @@ import (
 	"strings"
 )
 
+// The number of errors the parser reports at most before giving up.
+const MaxParseErrors = 20
+
+// The errors found so far in the program being parsed.
+var parseErrors []error
+
+// Records an error the parser recovered from. Reports false when the limit
+// of errors is reached, in which case the error aborts parsing instead.
+func recordParseError(err error) bool {
+	if len(parseErrors) >= MaxParseErrors-1 {
+		return false
+	}
+	parseErrors = append(parseErrors, err)
+	return true
+}
+
 func parseStatements(lines []string, startLine, expectedIndent int) ([]*Statement, error) {
 	var statements []*Statement
 	i := startLine
@@ -36,13 +52,30 @@ func parseStatements(lines []string, startLine, expectedIndent int) ([]*Statemen
 		}
 
 		if indent > expectedIndent {
-			return nil, fmt.Errorf("unexpected indentation at line %d (expected %d, got %d)", i+1, expectedIndent, indent)
+			err := fmt.Errorf("unexpected indentation at line %d (expected %d, got %d)", i+1, expectedIndent, indent)
+			if !recordParseError(err) {
+				return nil, err
+			}
+			i = findEndOfBlock(lines, i+1, indent)
+			continue
 		}
 
 		stmt, nextLine, err := parseStatement(lines, i, indent)
+		if err == nil && !strings.HasPrefix(trimmed, "$raw") {
+			if escapeErr := checkEscapes(trimmed); escapeErr != nil {
+				err = fmt.Errorf("%v at line %d", escapeErr, i+1)
+			}
+		}
 		if err != nil {
-			return nil, err
+			// The parser recovers at the next statement of the block, skipping
+			// the lines indented under the one it failed on.
+			if !recordParseError(err) {
+				return nil, err
+			}
+			i = findEndOfBlock(lines, i+1, indent+1)
+			continue
 		}
+		stmt.Line = i + 1
 
 		statements = append(statements, stmt)
 		i = nextLine
@@ -56,24 +89,23 @@ func splitRespectingQuotes(input string) []string {
 		result   []string
 		current  strings.Builder
 		inQuotes = false
+		escaped  = false
 	)
 
-	for i, char := range input {
-		switch char {
-		case '"':
-			if i > 0 && input[i-1] == '\\' {
-				current.WriteRune(char)
-			} else {
-				inQuotes = !inQuotes
-				current.WriteRune(char)
-			}
-		case ',':
-			if !inQuotes {
-				result = append(result, strings.TrimSpace(current.String()))
-				current.Reset()
-			} else {
-				current.WriteRune(char)
-			}
+	for _, char := range input {
+		switch {
+		case escaped:
+			escaped = false
+			current.WriteRune(char)
+		case inQuotes && char == '\\':
+			escaped = true
+			current.WriteRune(char)
+		case char == '"':
+			inQuotes = !inQuotes
+			current.WriteRune(char)
+		case char == ',' && !inQuotes:
+			result = append(result, strings.TrimSpace(current.String()))
+			current.Reset()
 		default:
 			current.WriteRune(char)
 		}
@@ -100,14 +132,16 @@ func parseEnumDeclaration(lines []string, startLine, indentLevel int) (*Statemen
 	if enumName == "" {
 		return nil, startLine, fmt.Errorf("missing enum name in declaration: %s", line)
 	}
-	values := []string{}
-	nextLine := startLine + 1
+	var (
+		members  []string
+		nextLine = startLine + 1
+	)
 	if strings.Contains(line, "{") && strings.Contains(line, "}") {
 		valuesStr := line[strings.Index(line, "{")+1 : strings.Index(line, "}")]
 		for _, val := range strings.Split(valuesStr, ",") {
 			val = strings.TrimSpace(val)
 			if val != "" {
-				values = append(values, val)
+				members = append(members, val)
 			}
 		}
 	} else if nextLine < len(lines) {
@@ -126,28 +160,146 @@ func parseEnumDeclaration(lines []string, startLine, indentLevel int) (*Statemen
 				continue
 			}
 			line = strings.TrimSuffix(line, ",")
-			values = append(values, line)
+			members = append(members, line)
 			nextLine++
 		}
 	}
+	values, discriminants, err := parseEnumMembers(members, startLine)
+	if err != nil {
+		return nil, nextLine, err
+	}
 	if isPublic {
 		return &Statement{
 			PubEnumDecl: &PubEnumDeclStmt{
-				Name:   enumName,
-				Values: values,
+				Name:          enumName,
+				Values:        values,
+				Discriminants: discriminants,
 			},
 		}, nextLine, nil
 	} else {
 		return &Statement{
 			EnumDecl: &EnumDeclStmt{
-				IsPublic: false,
-				Name:     enumName,
-				Values:   values,
+				IsPublic:      false,
+				Name:          enumName,
+				Values:        values,
+				Discriminants: discriminants,
 			},
 		}, nextLine, nil
 	}
 }
 
+// Splits enum members such as RED = 1 into their names and the explicit
+// values of those that have one.
+func parseEnumMembers(members []string, startLine int) ([]string, map[string]string, error) {
+	var (
+		names         []string
+		discriminants = make(map[string]string)
+	)
+	for _, member := range members {
+		name, value, explicit := strings.Cut(member, "=")
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if !isIdentifier(name) || (explicit && value == "") {
+			return nil, nil, fmt.Errorf("enum member format error in '%s' of the enum at line %d (expected: NAME or NAME = value)", member, startLine+1)
+		}
+		if slices.Contains(names, name) {
+			return nil, nil, fmt.Errorf("duplicate enum member '%s' in the enum at line %d", name, startLine+1)
+		}
+		names = append(names, name)
+		if explicit {
+			discriminants[name] = value
+		}
+	}
+	return names, discriminants, nil
+}
+
+// Reports whether s is a plain identifier such as RED or max_size.
+func isIdentifier(s string) bool {
+	if s == "" || !isExprIdentStart(s[0]) {
+		return false
+	}
+	for i := 1; i < len(s); i++ {
+		if !isExprIdentChar(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Records the names of the structs, enums and classes declared at the top
+// level of a source, and of the modules it imports, so declarations using
+// them parse before the type itself is reached.
+func registerStructTypes(lines []string) {
+	for _, line := range lines {
+		if getIndentation(line) > 0 {
+			continue
+		}
+		line = strings.TrimSpace(line)
+		if module, ok := strings.CutPrefix(line, "import "); ok {
+			if fields := strings.Fields(module); len(fields) > 0 {
+				importedModules[ModuleBaseName(fields[0])] = true
+			}
+		}
+		if name, ok := strings.CutPrefix(line, "struct "); ok {
+			structTypes[strings.TrimSpace(strings.TrimSuffix(name, ":"))] = true
+		}
+		if name, ok := strings.CutPrefix(strings.TrimPrefix(line, "pub "), "enum "); ok {
+			if fields := strings.Fields(strings.NewReplacer(":", " ", "{", " ").Replace(name)); len(fields) > 0 {
+				enumTypes[fields[0]] = true
+			}
+		}
+		if name, ok := strings.CutPrefix(strings.TrimPrefix(line, "pub "), "class "); ok {
+			if fields := strings.Fields(strings.NewReplacer(":", " ", "(", " ").Replace(name)); len(fields) > 0 {
+				classTypes[fields[0]] = true
+			}
+		}
+	}
+}
+
+func parseStructDeclaration(lines []string, startLine, indentLevel int) (*Statement, int, error) {
+	line := strings.TrimSpace(lines[startLine])
+	if !strings.HasSuffix(line, ":") {
+		return nil, startLine + 1, fmt.Errorf("struct declaration must end with ':' at line %d", startLine+1)
+	}
+	name := strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(line, "struct"), ":"))
+	if name == "" || strings.ContainsAny(name, " ()") {
+		return nil, startLine + 1, fmt.Errorf("struct declaration format error at line %d (expected: struct Name:)", startLine+1)
+	}
+	structTypes[name] = true
+
+	var (
+		fields   []StructField
+		seen     = make(map[string]bool)
+		nextLine = startLine + 1
+	)
+	for nextLine < len(lines) {
+		fieldLine := strings.TrimSpace(lines[nextLine])
+		if fieldLine == "" || strings.HasPrefix(fieldLine, "#") {
+			nextLine++
+			continue
+		}
+		if getIndentation(lines[nextLine]) <= indentLevel {
+			break
+		}
+		parts := strings.Fields(fieldLine)
+		if len(parts) != 2 {
+			return nil, nextLine + 1, fmt.Errorf("struct field format error at line %d (expected: type name)", nextLine+1)
+		}
+		if !isValidType(parts[0]) {
+			return nil, nextLine + 1, fmt.Errorf("invalid field type '%s' at line %d", parts[0], nextLine+1)
+		}
+		if seen[parts[1]] {
+			return nil, nextLine + 1, fmt.Errorf("duplicate field '%s' in struct '%s' at line %d", parts[1], name, nextLine+1)
+		}
+		seen[parts[1]] = true
+		fields = append(fields, StructField{Type: parts[0], Name: parts[1]})
+		nextLine++
+	}
+	if len(fields) == 0 {
+		return nil, startLine + 1, fmt.Errorf("struct '%s' must declare at least one field at line %d", name, startLine+1)
+	}
+	return &Statement{StructDecl: &StructDeclStmt{Name: name, Fields: fields}}, nextLine, nil
+}
+
 func parseStatement(lines []string, lineNum, currentIndent int) (*Statement, int, error) {
 	line := strings.TrimSpace(lines[lineNum])
 
@@ -155,6 +307,36 @@ func parseStatement(lines []string, lineNum, currentIndent int) (*Statement, int
 		return parseEnumDeclaration(lines, lineNum, currentIndent)
 	}
 
+	if label, ok := loopLabel(line); ok {
+		return parseLabeledLoop(lines, lineNum, currentIndent, label)
+	}
+
+	if (strings.HasPrefix(line, "test ") || strings.HasPrefix(line, "bench ")) && strings.HasSuffix(line, ":") {
+		return parseNamedBlock(lines, lineNum, currentIndent)
+	}
+
+	if (strings.HasPrefix(line, "assert!(") || strings.HasPrefix(line, "assert_eq!(")) && strings.HasSuffix(line, ")") {
+		return parseAssertStatement(line, lineNum)
+	}
+
+	// The message of a panic may hold any expression, such as a field.
+	if strings.HasPrefix(line, "panic(") && strings.HasSuffix(line, ")") {
+		args := parseArgumentsRespectingNesting(strings.TrimSpace(line[len("panic(") : len(line)-1]))
+		return &Statement{FunctionCall: &FunctionCallStmt{Name: "panic", Args: args}}, lineNum + 1, nil
+	}
+
+	if rest, ok := strings.CutPrefix(line, "assert "); ok && !strings.HasPrefix(strings.TrimSpace(rest), "=") {
+		return parseDebugAssertStatement(rest, lineNum)
+	}
+
+	if strings.HasPrefix(line, "atomic ") {
+		return parseAtomicDeclaration(lines, lineNum, currentIndent, false)
+	}
+
+	if strings.HasPrefix(line, "spawn ") || isSpawnDecl(line) {
+		return parseSpawnStatement(line, lineNum)
+	}
+
 	if strings.HasPrefix(line, "catlist!(") && strings.HasSuffix(line, ")") {
 		argsStr := strings.TrimSpace(line[9 : len(line)-1]) // Remove "catlist!(" and ")"
 		args := splitRespectingQuotes(argsStr)
@@ -342,24 +524,47 @@ func parseStatement(lines []string, lineNum, currentIndent int) (*Statement, int
 		}}, lineNum + 1, nil
 	}
 
+	if strings.HasPrefix(line, "set[") && strings.Contains(line, "=") {
+		return parseSetDecl(line, lineNum)
+	}
+
 	parts := strings.Fields(strings.TrimSuffix(line, ":"))
 
+	if IsOptionalType(parts[0]) {
+		if len(parts) < 4 || parts[2] != "=" {
+			return nil, lineNum + 1, fmt.Errorf("optional declaration format error at line %d (expected: type? name = value)", lineNum+1)
+		}
+		return &Statement{VarDecl: &VarDeclStmt{
+			Type:  parts[0],
+			Name:  parts[1],
+			Value: strings.TrimSpace(line[strings.Index(line, "=")+1:]),
+		}}, lineNum + 1, nil
+	}
+
 	if strings.HasPrefix(parts[0], "list[") && strings.Contains(parts[0], "]") {
 		if len(parts) < 4 || parts[2] != "=" {
 			return nil, lineNum + 1, fmt.Errorf("list declaration format error at line %d (expected: list[type] name = [elements] or list[type] name = function_call())", lineNum+1)
 		}
 
-		typeStart := strings.Index(parts[0], "[")
-		typeEnd := strings.Index(parts[0], "]")
-		if typeStart == -1 || typeEnd == -1 || typeEnd <= typeStart {
-			return nil, lineNum + 1, fmt.Errorf("invalid list type declaration at line %d", lineNum+1)
+		listType, err := parseListType(parts[0], lineNum)
+		if err != nil {
+			return nil, lineNum + 1, err
 		}
-
-		listType := parts[0][typeStart+1 : typeEnd]
 		listName := parts[1]
 		value := strings.Join(parts[3:], " ")
 
-		if strings.Contains(value, "(") && strings.Contains(value, ")") && !strings.HasPrefix(value, "[") {
+		// A slice of another list, such as list[int] tail = items[1:]
+		if expr, err := ParseExpr(value); err == nil {
+			if _, isSlice := expr.(*SliceExpr); isSlice {
+				return &Statement{ListDecl: &ListDeclStmt{
+					Type:     listType,
+					Name:     listName,
+					Elements: []string{value},
+				}}, lineNum + 1, nil
+			}
+		}
+
+		if _, _, isRange := ParseRange(value); isRange || strings.Contains(value, "(") && strings.Contains(value, ")") && !strings.HasPrefix(value, "[") {
 			return &Statement{ListDeclFunctionCall: &ListDeclFunctionCallStmt{
 				Type:         listType,
 				Name:         listName,
@@ -377,35 +582,10 @@ func parseStatement(lines []string, lineNum, currentIndent int) (*Statement, int
 			}}, lineNum + 1, nil
 		}
 
-		elementsStart := strings.Index(line, "[")
-		secondBracketPos := strings.Index(line[elementsStart+1:], "[")
-		if secondBracketPos != -1 {
-			elementsStart = elementsStart + 1 + secondBracketPos
-		} else {
-			return nil, lineNum + 1, fmt.Errorf("list declaration missing elements at line %d", lineNum+1)
-		}
-
-		elementsEnd := strings.LastIndex(line, "]")
-		if elementsEnd == -1 || elementsEnd <= elementsStart {
-			return nil, lineNum + 1, fmt.Errorf("list declaration missing closing bracket at line %d", lineNum+1)
-		}
-
-		elementsStr := strings.TrimSpace(line[elementsStart+1 : elementsEnd])
-		var elements []string
-
-		if elementsStr != "" {
-			elementsList := strings.Split(elementsStr, ",")
-			for _, elem := range elementsList {
-				elem = strings.TrimSpace(elem)
-				if elem != "" {
-					if strings.HasPrefix(elem, "\"") && strings.HasSuffix(elem, "\"") {
-						elem = elem[1 : len(elem)-1]
-					}
-					elements = append(elements, elem)
-				}
-			}
+		elements, err := parseListElements(line, lineNum)
+		if err != nil {
+			return nil, lineNum + 1, err
 		}
-
 		return &Statement{ListDecl: &ListDeclStmt{Type: listType, Name: listName, Elements: elements}}, lineNum + 1, nil
 	}
 
@@ -457,6 +637,34 @@ func parseStatement(lines []string, lineNum, currentIndent int) (*Statement, int
 			MapName: mapName,
 			Key:     key,
 		}}, lineNum + 1, nil
+	} else if (strings.HasPrefix(line, "add!(") || strings.HasPrefix(line, "remove!(")) && strings.HasSuffix(line, ")") {
+		name, argsStr, _ := strings.Cut(line[:len(line)-1], "(")
+		args := splitRespectingQuotes(argsStr)
+		if len(args) != 2 {
+			return nil, lineNum + 1, fmt.Errorf("%s statement requires exactly 2 arguments at line %d (setName, value)", name, lineNum+1)
+		}
+		elem := &SetElemStmt{
+			SetName: strings.TrimSpace(args[0]),
+			Value:   strings.TrimSpace(args[1]),
+		}
+		if name == "add!" {
+			return &Statement{SetAdd: elem}, lineNum + 1, nil
+		}
+		return &Statement{SetRemove: elem}, lineNum + 1, nil
+	} else if strings.HasPrefix(line, "del!(") && strings.HasSuffix(line, ")") {
+		argsStr := strings.TrimSpace(line[5 : len(line)-1])
+		args := splitRespectingQuotes(argsStr)
+		if len(args) != 2 {
+			return nil, lineNum + 1, fmt.Errorf("del! statement requires exactly 2 arguments at line %d (mapName, key)", lineNum+1)
+		}
+		var (
+			mapName = strings.TrimSpace(args[0])
+			key     = strings.TrimSpace(args[1])
+		)
+		return &Statement{DelMap: &DelMapStmt{
+			MapName: mapName,
+			Key:     key,
+		}}, lineNum + 1, nil
 	}
 	switch parts[0] {
 	case "u16", "u32", "u64", "i16", "i32", "i64", "f32", "f64":
@@ -493,7 +701,11 @@ func parseStatement(lines []string, lineNum, currentIndent int) (*Statement, int
 			end     = strings.TrimSpace(line[toIndex+len("to") : colonIndex])
 		)
 
-		if varName == "" || start == "" || end == "" {
+		loop := &ParallelForStmt{Var: varName, Start: start}
+		if err := parseParallelClauses(loop, end, lineNum); err != nil {
+			return nil, lineNum + 1, err
+		}
+		if varName == "" || start == "" || loop.End == "" {
 			return nil, lineNum + 1, fmt.Errorf("parallel for statement missing variable, start, or end expression at line %d", lineNum+1)
 		}
 
@@ -520,12 +732,16 @@ func parseStatement(lines []string, lineNum, currentIndent int) (*Statement, int
 
 		nextLine := findEndOfBlock(lines, lineNum+1, expectedBodyIndent)
 
-		return &Statement{ParallelFor: &ParallelForStmt{Var: varName, Start: start, End: end, Body: body}}, nextLine, nil
+		loop.Body = body
+		return &Statement{ParallelFor: loop}, nextLine, nil
 
 	case "import":
 		if len(parts) < 2 {
 			return nil, lineNum + 1, fmt.Errorf("import statement requires a module name at line %d", lineNum+1)
 		}
+		if imp, ok := parseAliasedImport(line); ok {
+			return &Statement{Import: imp}, lineNum + 1, nil
+		}
 
 		if strings.Contains(line, ",") {
 			importLine := strings.TrimSpace(line[6:])
@@ -552,6 +768,12 @@ func parseStatement(lines []string, lineNum, currentIndent int) (*Statement, int
 			moduleName := strings.Trim(strings.Join(parts[1:], " "), "\"")
 			return &Statement{Import: &ImportStmt{Module: moduleName}}, lineNum + 1, nil
 		}
+	case "from":
+		imp, err := parseFromImport(line, lineNum)
+		if err != nil {
+			return nil, lineNum + 1, err
+		}
+		return &Statement{Import: imp}, lineNum + 1, nil
 	case "ref":
 		if len(parts) < 5 || parts[3] != "=" {
 			return nil, lineNum + 1, fmt.Errorf("ref declaration format error at line %d (expected: ref type name = value)", lineNum+1)
@@ -621,10 +843,7 @@ func parseStatement(lines []string, lineNum, currentIndent int) (*Statement, int
 			if argsStart != -1 && argsEnd != -1 && argsEnd > argsStart+1 {
 				constructorArgsStr := strings.TrimSpace(value[argsStart+1 : argsEnd])
 				if constructorArgsStr != "" {
-					constructorArgsList := strings.Split(constructorArgsStr, ",")
-					for _, arg := range constructorArgsList {
-						constructorArgs = append(constructorArgs, strings.TrimSpace(arg))
-					}
+					constructorArgs = append(constructorArgs, parseArgumentsRespectingNesting(constructorArgsStr)...)
 				}
 			}
 
@@ -656,6 +875,9 @@ func parseStatement(lines []string, lineNum, currentIndent int) (*Statement, int
 
 		return &Statement{VarDeclInferred: &VarDeclInferredStmt{Name: varName, Value: value}}, lineNum + 1, nil
 
+	case "const":
+		return parseConstDeclaration(line, lineNum, currentIndent, false)
+
 	case "pub":
 		return parsePubStatement(lines, lineNum, currentIndent)
 
@@ -673,18 +895,31 @@ func parseStatement(lines []string, lineNum, currentIndent int) (*Statement, int
 	case "class":
 		return parseClassStatement(lines, lineNum, currentIndent)
 
+	case "struct":
+		return parseStructDeclaration(lines, lineNum, currentIndent)
+	case "interface":
+		return parseInterfaceStatement(lines, lineNum, currentIndent)
+
 	case "fn":
 		return parseTopLevelFunctionStatement(lines, lineNum, currentIndent)
 
-	case "print":
+	case "extern":
+		extern, err := parseExternFunction(line, lineNum)
+		if err != nil {
+			return nil, lineNum + 1, err
+		}
+		return &Statement{ExternFunc: extern}, lineNum + 1, nil
+
+	case "print", "eprint":
 		if len(parts) < 2 {
-			return nil, lineNum + 1, fmt.Errorf("print statement requires a string at line %d", lineNum+1)
+			return nil, lineNum + 1, fmt.Errorf("%s statement requires a string at line %d", parts[0], lineNum+1)
 		}
 
+		stderr := parts[0] == "eprint"
 		if strings.Contains(line, "|") {
 			var (
 				pipeIndex  = strings.Index(line, "|")
-				formatPart = strings.TrimSpace(line[5:pipeIndex])
+				formatPart = strings.TrimSpace(line[len(parts[0]):pipeIndex])
 				varPart    = strings.TrimSpace(line[pipeIndex+1:])
 			)
 			if strings.HasPrefix(formatPart, "\"") && strings.HasSuffix(formatPart, "\"") {
@@ -700,7 +935,7 @@ func parseStatement(lines []string, lineNum, currentIndent int) (*Statement, int
 				}
 			}
 
-			return &Statement{Print: &PrintStmt{Format: formatPart, Variables: variables}}, lineNum + 1, nil
+			return &Statement{Print: &PrintStmt{Format: formatPart, Variables: variables, Stderr: stderr}}, lineNum + 1, nil
 		} else if strings.Contains(line, ",") && strings.Contains(line, "\"") {
 			quoteStart := strings.Index(line, "\"")
 			quoteEnd := strings.LastIndex(line, "\"")
@@ -720,28 +955,65 @@ func parseStatement(lines []string, lineNum, currentIndent int) (*Statement, int
 						}
 					}
 
-					return &Statement{Print: &PrintStmt{Format: formatPart, Variables: variables}}, lineNum + 1, nil
+					return &Statement{Print: &PrintStmt{Format: formatPart, Variables: variables, Stderr: stderr}}, lineNum + 1, nil
 				}
 			}
 		}
 
-		str := strings.TrimSpace(line[5:])
+		str := strings.TrimSpace(line[len(parts[0]):])
 		if strings.HasPrefix(str, "\"") && strings.HasSuffix(str, "\"") {
 			str = str[1 : len(str)-1]
+			segments, holes, ok, err := Interpolate(str)
+			if err != nil {
+				return nil, lineNum + 1, fmt.Errorf("%v at line %d", err, lineNum+1)
+			}
+			if ok {
+				return &Statement{Print: &PrintStmt{Segments: segments, Variables: holes, Stderr: stderr}}, lineNum + 1, nil
+			}
 		}
-		return &Statement{Print: &PrintStmt{Print: str}}, lineNum + 1, nil
+		return &Statement{Print: &PrintStmt{Print: str, Stderr: stderr}}, lineNum + 1, nil
 
-	case "sleep":
+	case "sleep", "sleep_ms", "sleep_us":
 		if len(parts) < 2 {
-			return nil, lineNum + 1, fmt.Errorf("sleep statement requires a number at line %d", lineNum+1)
+			return nil, lineNum + 1, fmt.Errorf("%s statement requires a number at line %d", parts[0], lineNum+1)
+		}
+		unit := "s"
+		if _, suffix, ok := strings.Cut(parts[0], "_"); ok {
+			unit = suffix
+		}
+		return &Statement{Sleep: &SleepStmt{Duration: strings.Join(parts[1:], " "), Unit: unit}}, lineNum + 1, nil
+
+	case "join":
+		if len(parts) != 2 || !isIdentifier(parts[1]) {
+			return nil, lineNum + 1, fmt.Errorf("join statement format error at line %d (expected: join t)", lineNum+1)
+		}
+		return &Statement{Join: &JoinStmt{Handle: parts[1]}}, lineNum + 1, nil
+
+	case "breakpoint":
+		if len(parts) != 1 {
+			return nil, lineNum + 1, fmt.Errorf("breakpoint statement takes no arguments at line %d", lineNum+1)
+		}
+		return &Statement{Breakpoint: &BreakpointStmt{}}, lineNum + 1, nil
+
+	case "delete":
+		if len(parts) != 2 {
+			return nil, lineNum + 1, fmt.Errorf("delete statement format error at line %d (expected: delete name)", lineNum+1)
 		}
-		return &Statement{Sleep: &SleepStmt{Duration: parts[1]}}, lineNum + 1, nil
+		return &Statement{Delete: &DeleteStmt{Target: parts[1]}}, lineNum + 1, nil
 
 	case "break":
-		return &Statement{Break: &BreakStmt{Break: "break"}}, lineNum + 1, nil
+		target, err := parseLoopTarget(parts, lineNum)
+		if err != nil {
+			return nil, lineNum + 1, err
+		}
+		return &Statement{Break: &BreakStmt{Break: "break", Target: target}}, lineNum + 1, nil
 
 	case "continue":
-		return &Statement{Continue: &ContinueStmt{Continue: "continue"}}, lineNum + 1, nil
+		target, err := parseLoopTarget(parts, lineNum)
+		if err != nil {
+			return nil, lineNum + 1, err
+		}
+		return &Statement{Continue: &ContinueStmt{Continue: "continue", Target: target}}, lineNum + 1, nil
 
 	case "run":
 		if len(parts) < 2 {
@@ -812,18 +1084,9 @@ func parseStatement(lines []string, lineNum, currentIndent int) (*Statement, int
 		varType := varParts[0]
 		varName := varParts[1]
 
-		// Check if it's a valid collection type: map.keys, map.values, or string variable
-		isMapCollection := strings.HasSuffix(collection, ".keys") || strings.HasSuffix(collection, ".values")
-		isStringCollection := !isMapCollection // For now, assume any other identifier is a string variable
-
-		if !isMapCollection && !isStringCollection {
-			return nil, lineNum + 1, fmt.Errorf("foreach statement collection must be 'mapname.keys', 'mapname.values', or a string variable at line %d", lineNum+1)
-		}
-
-		// For string iteration, ensure the variable type is char
-		if isStringCollection && varType != "char" {
-			return nil, lineNum + 1, fmt.Errorf("foreach statement over string must use 'char' variable type at line %d", lineNum+1)
-		}
+		// The collection is a range, map.keys, map.values, a set or a string
+		// variable. Which of the last two it is depends on its declaration, so
+		// the element type of string iteration is checked by the checker.
 		expectedBodyIndent := currentIndent + 4
 		if currentIndent == 0 {
 			bodyStartLine := lineNum + 1
@@ -847,6 +1110,13 @@ func parseStatement(lines []string, lineNum, currentIndent int) (*Statement, int
 
 		nextLine := findEndOfBlock(lines, lineNum+1, expectedBodyIndent)
 
+		if low, high, ok := ParseRange(collection); ok {
+			if varType != "int" {
+				return nil, lineNum + 1, fmt.Errorf("foreach over a range must use 'int' variable type at line %d", lineNum+1)
+			}
+			return &Statement{For: &ForStmt{Var: varName, Start: low, End: high, Body: body}}, nextLine, nil
+		}
+
 		return &Statement{Foreach: &ForeachStmt{
 			VarType:    varType,
 			VarName:    varName,
@@ -896,6 +1166,9 @@ func parseStatement(lines []string, lineNum, currentIndent int) (*Statement, int
 
 		return &Statement{For: &ForStmt{Var: varName, Start: start, End: end, Body: body}}, nextLine, nil
 
+	case "match":
+		return parseMatchStatement(lines, lineNum, currentIndent)
+
 	case "if":
 		if len(parts) < 2 || !strings.HasSuffix(line, ":") {
 			return nil, lineNum + 1, fmt.Errorf("if statement format error at line %d", lineNum+1)
@@ -971,15 +1244,16 @@ func parseStatement(lines []string, lineNum, currentIndent int) (*Statement, int
 
 		return &Statement{If: &IfStmt{Condition: condition, Body: body, ElseIfs: elseIfs, Else: elseStmt}}, nextLine, nil
 
-	case "put":
+	case "put", "eput":
 		if len(parts) < 2 {
-			return nil, lineNum + 1, fmt.Errorf("put statement requires a string at line %d", lineNum+1)
+			return nil, lineNum + 1, fmt.Errorf("%s statement requires a string at line %d", parts[0], lineNum+1)
 		}
 
+		stderr := parts[0] == "eput"
 		if strings.Contains(line, "|") {
 			var (
 				pipeIndex  = strings.Index(line, "|")
-				formatPart = strings.TrimSpace(line[3:pipeIndex])
+				formatPart = strings.TrimSpace(line[len(parts[0]):pipeIndex])
 				varPart    = strings.TrimSpace(line[pipeIndex+1:])
 			)
 			if strings.HasPrefix(formatPart, "\"") && strings.HasSuffix(formatPart, "\"") {
@@ -994,7 +1268,7 @@ func parseStatement(lines []string, lineNum, currentIndent int) (*Statement, int
 				}
 			}
 
-			return &Statement{Put: &PutStmt{Format: formatPart, Variables: variables}}, lineNum + 1, nil
+			return &Statement{Put: &PutStmt{Format: formatPart, Variables: variables, Stderr: stderr}}, lineNum + 1, nil
 		} else if strings.Contains(line, ",") && strings.Contains(line, "\"") {
 			quoteStart := strings.Index(line, "\"")
 			quoteEnd := strings.LastIndex(line, "\"")
@@ -1013,16 +1287,23 @@ func parseStatement(lines []string, lineNum, currentIndent int) (*Statement, int
 						}
 					}
 
-					return &Statement{Put: &PutStmt{Format: formatPart, Variables: variables}}, lineNum + 1, nil
+					return &Statement{Put: &PutStmt{Format: formatPart, Variables: variables, Stderr: stderr}}, lineNum + 1, nil
 				}
 			}
 		}
 
-		str := strings.TrimSpace(line[3:])
+		str := strings.TrimSpace(line[len(parts[0]):])
 		if strings.HasPrefix(str, "\"") && strings.HasSuffix(str, "\"") {
 			str = str[1 : len(str)-1]
+			segments, holes, ok, err := Interpolate(str)
+			if err != nil {
+				return nil, lineNum + 1, fmt.Errorf("%v at line %d", err, lineNum+1)
+			}
+			if ok {
+				return &Statement{Put: &PutStmt{Segments: segments, Variables: holes, Stderr: stderr}}, lineNum + 1, nil
+			}
 		}
-		return &Statement{Put: &PutStmt{Put: str}}, lineNum + 1, nil
+		return &Statement{Put: &PutStmt{Put: str, Stderr: stderr}}, lineNum + 1, nil
 	case "try":
 		if !strings.HasSuffix(line, ":") {
 			return nil, lineNum + 1, fmt.Errorf("try statement must end with ':' at line %d", lineNum+1)
@@ -1032,8 +1313,15 @@ func parseStatement(lines []string, lineNum, currentIndent int) (*Statement, int
 		if len(parts) < 2 {
 			return nil, lineNum + 1, fmt.Errorf("throw statement requires a value at line %d", lineNum+1)
 		}
-		value := strings.Join(parts[1:], " ")
-		return &Statement{Throw: &ThrowStmt{Value: value}}, lineNum + 1, nil
+		args := parseArgumentsRespectingNesting(strings.TrimSpace(line[5:]))
+		if len(args) > 2 {
+			return nil, lineNum + 1, fmt.Errorf("throw statement takes a value and an optional message at line %d", lineNum+1)
+		}
+		throw := &ThrowStmt{Value: strings.TrimSpace(args[0])}
+		if len(args) == 2 {
+			throw.Message = strings.TrimSpace(args[1])
+		}
+		return &Statement{Throw: throw}, lineNum + 1, nil
 
 	// Handle standard assignment (var = expr)
 	case "elif":
@@ -1096,35 +1384,13 @@ func parseStatement(lines []string, lineNum, currentIndent int) (*Statement, int
 			if strings.HasSuffix(value, ";") {
 				value = strings.TrimSpace(value[:len(value)-1])
 			}
-			if strings.Contains(value, ".") && strings.Contains(value, "(") && strings.Contains(value, ")") && !strings.HasPrefix(value, "new ") {
-				dotIndex := strings.Index(value, ".")
-				parenIndex := strings.Index(value, "(")
-				if dotIndex < parenIndex {
-					var (
-						objectName     = strings.TrimSpace(value[:dotIndex])
-						methodPart     = strings.TrimSpace(value[dotIndex+1:])
-						methodEndIndex = strings.Index(methodPart, "(")
-						methodName     = strings.TrimSpace(methodPart[:methodEndIndex])
-						argsStart      = strings.Index(value, "(")
-						argsEnd        = strings.LastIndex(value, ")")
-						args           []string
-					)
-					if argsEnd > argsStart+1 {
-						argsStr := strings.TrimSpace(value[argsStart+1 : argsEnd])
-						if argsStr != "" {
-							argsList := strings.SplitSeq(argsStr, ",")
-							for arg := range argsList {
-								args = append(args, strings.TrimSpace(arg))
-							}
-						}
-					}
-					return &Statement{VarAssignMethodCall: &VarAssignMethodCallStmt{
-						Name:   varName,
-						Object: objectName,
-						Method: methodName,
-						Args:   args,
-					}}, lineNum + 1, nil
-				}
+			if objectName, methodName, args, ok := splitMethodCall(value); ok {
+				return &Statement{VarAssignMethodCall: &VarAssignMethodCallStmt{
+					Name:   varName,
+					Object: objectName,
+					Method: methodName,
+					Args:   args,
+				}}, lineNum + 1, nil
 			}
 			if strings.Contains(varName, "[") && strings.Contains(varName, "]") {
 				bracketStart := strings.Index(varName, "[")
@@ -1142,11 +1408,17 @@ func parseStatement(lines []string, lineNum, currentIndent int) (*Statement, int
 					Index:    index,
 					Value:    value,
 				}}, lineNum + 1, nil
-			} else if strings.HasPrefix(value, "\"") && strings.HasSuffix(value, "\"") {
+			}
+
+			quoted := strings.HasPrefix(value, "\"") && strings.HasSuffix(value, "\"")
+			if quoted {
 				value = value[1 : len(value)-1]
+				if _, _, _, err := Interpolate(value); err != nil {
+					return nil, lineNum + 1, fmt.Errorf("%v at line %d", err, lineNum+1)
+				}
 			}
 
-			return &Statement{VarAssign: &VarAssignStmt{Name: varName, Value: value}}, lineNum + 1, nil
+			return &Statement{VarAssign: &VarAssignStmt{Name: varName, Value: value, Quoted: quoted}}, lineNum + 1, nil
 		}
 		if strings.Contains(line, "=") && (strings.Contains(line, "[") && strings.Contains(line, "]")) {
 			eqIndex := strings.Index(line, "=")
@@ -1180,7 +1452,10 @@ func parseStatement(lines []string, lineNum, currentIndent int) (*Statement, int
 			return &Statement{VarAssign: &VarAssignStmt{Name: "this." + fieldName, Value: value}}, lineNum + 1, nil
 		}
 
-		if strings.Contains(line, "(") && strings.Contains(line, ")") && !strings.Contains(line, "=") && !strings.Contains(line, ".") {
+		// Builtins such as append! may take fields, as in append!(this.cells, x).
+		callee, _, _ := strings.Cut(line, "(")
+		isBuiltinCall := strings.HasSuffix(callee, "!") && !strings.Contains(callee, ".")
+		if strings.Contains(line, "(") && strings.Contains(line, ")") && !strings.Contains(line, "=") && (!strings.Contains(line, ".") || isBuiltinCall) {
 			parenStart := strings.Index(line, "(")
 			parenEnd := strings.LastIndex(line, ")")
 
@@ -1199,35 +1474,8 @@ func parseStatement(lines []string, lineNum, currentIndent int) (*Statement, int
 			}
 		}
 
-		if strings.Contains(line, ".") && strings.Contains(line, "(") && strings.Contains(line, ")") && !strings.Contains(line, "=") {
-			dotIndex := strings.Index(line, ".")
-			parenIndex := strings.Index(line, "(")
-			if dotIndex < parenIndex {
-				objectName := strings.TrimSpace(line[:dotIndex])
-				methodPart := strings.TrimSpace(line[dotIndex+1:])
-				methodEndIndex := strings.Index(methodPart, "(")
-
-				if methodEndIndex == -1 {
-					return nil, lineNum + 1, fmt.Errorf("invalid method call syntax at line %d", lineNum+1)
-				}
-
-				var (
-					methodName = strings.TrimSpace(methodPart[:methodEndIndex])
-					argsStart  = strings.Index(line, "(")
-					argsEnd    = strings.LastIndex(line, ")")
-				)
-
-				var args []string
-				if argsEnd > argsStart+1 {
-					argsStr := strings.TrimSpace(line[argsStart+1 : argsEnd])
-					if argsStr != "" {
-						argsList := strings.SplitSeq(argsStr, ",")
-						for arg := range argsList {
-							args = append(args, strings.TrimSpace(arg))
-						}
-					}
-				}
-
+		if !strings.Contains(line, "=") {
+			if objectName, methodName, args, ok := splitMethodCall(line); ok {
 				return &Statement{MethodCall: &MethodCallStmt{Object: objectName, Method: methodName, Args: args}}, lineNum + 1, nil
 			}
 		}
@@ -1259,59 +1507,39 @@ func parseStatement(lines []string, lineNum, currentIndent int) (*Statement, int
 			if argsStart != -1 && argsEnd != -1 && argsEnd > argsStart+1 {
 				constructorArgsStr := strings.TrimSpace(line[argsStart+1 : argsEnd])
 				if constructorArgsStr != "" {
-					constructorArgsList := strings.SplitSeq(constructorArgsStr, ",")
-					for arg := range constructorArgsList {
-						args = append(args, strings.TrimSpace(arg))
-					}
+					args = append(args, parseArgumentsRespectingNesting(constructorArgsStr)...)
 				}
 			}
 
 			return &Statement{ObjectDecl: &ObjectDeclStmt{Type: typeName, Name: varName, Args: args}}, lineNum + 1, nil
 		}
 
+		if len(parts) >= 4 && parts[2] == "=" && classTypes[parts[0]] {
+			value := strings.TrimSpace(line[strings.Index(line, "=")+1:])
+			return &Statement{VarDecl: &VarDeclStmt{Type: parts[0], Name: parts[1], Value: value}}, lineNum + 1, nil
+		}
+
+		if end := strings.Index(line, "]"); end > 0 && !strings.Contains(line, "=") {
+			if _, _, ok := ParseArrayType(line[:end+1]); ok {
+				return parseArrayDeclaration(line, lineNum)
+			}
+		}
+
 		if strings.HasPrefix(parts[0], "list[") && strings.Contains(parts[0], "]") {
 			if len(parts) < 4 || parts[2] != "=" {
 				return nil, lineNum + 1, fmt.Errorf("list declaration format error at line %d (expected: list[type] name = [elements])", lineNum+1)
 			}
 
-			typeStart := strings.Index(parts[0], "[")
-			typeEnd := strings.Index(parts[0], "]")
-			if typeStart == -1 || typeEnd == -1 || typeEnd <= typeStart {
-				return nil, lineNum + 1, fmt.Errorf("invalid list type declaration at line %d", lineNum+1)
+			listType, err := parseListType(parts[0], lineNum)
+			if err != nil {
+				return nil, lineNum + 1, err
 			}
-
-			listType := parts[0][typeStart+1 : typeEnd]
 			listName := parts[1]
 
-			elementsStart := strings.Index(line, "[")
-			secondBracketPos := strings.Index(line[elementsStart+1:], "[")
-			if secondBracketPos != -1 {
-				elementsStart = elementsStart + 1 + secondBracketPos
-			} else {
-				return nil, lineNum + 1, fmt.Errorf("list declaration missing elements at line %d", lineNum+1)
-			}
-
-			elementsEnd := strings.LastIndex(line, "]")
-			if elementsEnd == -1 || elementsEnd <= elementsStart {
-				return nil, lineNum + 1, fmt.Errorf("list declaration missing closing bracket at line %d", lineNum+1)
-			}
-
-			elementsStr := strings.TrimSpace(line[elementsStart+1 : elementsEnd])
-			var elements []string
-
-			if elementsStr != "" {
-				elementsList := strings.Split(elementsStr, ",")
-				for _, elem := range elementsList {
-					elem = strings.TrimSpace(elem)
-					if elem != "" {
-						if strings.HasPrefix(elem, "\"") && strings.HasSuffix(elem, "\"") {
-							elem = elem[1 : len(elem)-1]
-						}
-						elements = append(elements, elem)
-					}
-				}
+			elements, err := parseListElements(line, lineNum)
+			if err != nil {
+				return nil, lineNum + 1, err
 			}
-
 			return &Statement{ListDecl: &ListDeclStmt{Type: listType, Name: listName, Elements: elements}}, lineNum + 1, nil
 		}
 
@@ -1319,36 +1547,14 @@ func parseStatement(lines []string, lineNum, currentIndent int) (*Statement, int
 			varType := parts[0]
 			varName := parts[1]
 			value := strings.Join(parts[3:], " ")
-			if strings.Contains(value, ".") && strings.Contains(value, "(") && strings.Contains(value, ")") && !strings.HasPrefix(value, "new ") {
-				dotIndex := strings.Index(value, ".")
-				parenIndex := strings.Index(value, "(")
-				if dotIndex < parenIndex {
-					objectName := strings.TrimSpace(value[:dotIndex])
-					methodPart := strings.TrimSpace(value[dotIndex+1:])
-					methodEndIndex := strings.Index(methodPart, "(")
-					methodName := strings.TrimSpace(methodPart[:methodEndIndex])
-
-					argsStart := strings.Index(value, "(")
-					argsEnd := strings.LastIndex(value, ")")
-					var args []string
-					if argsEnd > argsStart+1 {
-						argsStr := strings.TrimSpace(value[argsStart+1 : argsEnd])
-						if argsStr != "" {
-							argsList := strings.Split(argsStr, ",")
-							for _, arg := range argsList {
-								args = append(args, strings.TrimSpace(arg))
-							}
-						}
-					}
-
-					return &Statement{VarDeclMethodCall: &VarDeclMethodCallStmt{
-						Type:   varType,
-						Name:   varName,
-						Object: objectName,
-						Method: methodName,
-						Args:   args,
-					}}, lineNum + 1, nil
-				}
+			if objectName, methodName, args, ok := splitMethodCall(value); ok {
+				return &Statement{VarDeclMethodCall: &VarDeclMethodCallStmt{
+					Type:   varType,
+					Name:   varName,
+					Object: objectName,
+					Method: methodName,
+					Args:   args,
+				}}, lineNum + 1, nil
 			}
 
 			if strings.Contains(value, "read(") {
@@ -1360,11 +1566,15 @@ func parseStatement(lines []string, lineNum, currentIndent int) (*Statement, int
 				}
 			}
 
-			if strings.HasPrefix(value, "\"") && strings.HasSuffix(value, "\"") {
+			quoted := strings.HasPrefix(value, "\"") && strings.HasSuffix(value, "\"")
+			if quoted {
 				value = value[1 : len(value)-1]
+				if _, _, _, err := Interpolate(value); err != nil {
+					return nil, lineNum + 1, fmt.Errorf("%v at line %d", err, lineNum+1)
+				}
 			}
 
-			return &Statement{VarDecl: &VarDeclStmt{Type: varType, Name: varName, Value: value}}, lineNum + 1, nil
+			return &Statement{VarDecl: &VarDeclStmt{Type: varType, Name: varName, Value: value, Quoted: quoted}}, lineNum + 1, nil
 		}
 
 		if strings.HasPrefix(line, "write(") && strings.HasSuffix(line, ")") {
@@ -1402,9 +1612,9 @@ func parseStatement(lines []string, lineNum, currentIndent int) (*Statement, int
 		!strings.Contains(line, "*") {
 		firstWord := strings.Fields(line)[0]
 		isKeyword := false
-		keywords := []string{"if", "for", "while", "fn", "class",
+		keywords := []string{"if", "match", "for", "while", "fn", "class", "interface",
 			"var", "return", "import", "pub", "ref", "u16", "u32", "u64",
-			"i16", "i32", "i64", "f32", "f64", "print", "sleep", "break",
+			"i16", "i32", "i64", "f32", "f64", "print", "eprint", "sleep", "sleep_ms", "sleep_us", "spawn", "join", "atomic", "extern", "break",
 			"continue", "foreach", "parallel", "char*"}
 		if slices.Contains(keywords, firstWord) {
 			isKeyword = true
@@ -1424,16 +1634,21 @@ func splitMapPairs(input string) []string {
 	var pairs []string
 	var currentPair strings.Builder
 	inQuotes := false
+	escaped := false
 	parenCount := 0
 
 	for _, char := range input {
+		if escaped {
+			escaped = false
+			currentPair.WriteRune(char)
+			continue
+		}
 		switch char {
+		case '\\':
+			escaped = inQuotes
+			currentPair.WriteRune(char)
 		case '"':
-			if inQuotes && currentPair.Len() > 0 && currentPair.String()[currentPair.Len()-1] != '\\' {
-				inQuotes = false
-			} else if !inQuotes {
-				inQuotes = true
-			}
+			inQuotes = !inQuotes
 			currentPair.WriteRune(char)
 		case ',':
 			if !inQuotes && parenCount == 0 {
@@ -1470,6 +1685,64 @@ func splitMapPairs(input string) []string {
 	return pairs
 }
 
+// Splits a call of a method, as in obj.method(args), into its receiver, name
+// and arguments. The receiver may itself be a chain of fields and calls, as in
+// order.owner().rename(name), but a value the call is only part of, such as
+// total + obj.method(), is not a method call.
+func splitMethodCall(value string) (string, string, []string, bool) {
+	value = strings.TrimSpace(value)
+	if expr, err := ParseExpr(value); err == nil {
+		call, isCall := expr.(*CallExpr)
+		if !isCall {
+			return "", "", nil, false
+		}
+		if _, isMember := call.Callee.(*MemberExpr); !isMember {
+			return "", "", nil, false
+		}
+	}
+	var (
+		dot, open = -1, -1
+		depth     = 0
+		quote     = byte(0)
+	)
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '(' || c == '[':
+			if depth == 0 && c == '(' {
+				open = i
+			}
+			depth++
+		case c == ')' || c == ']':
+			depth--
+		case c == '.' && depth == 0:
+			dot = i
+		}
+	}
+	if dot <= 0 || open < dot || findMatchingParen(value, open) != len(value)-1 {
+		return "", "", nil, false
+	}
+	method := strings.TrimSpace(value[dot+1 : open])
+	if !isIdentifier(method) {
+		return "", "", nil, false
+	}
+	return strings.TrimSpace(value[:dot]), method, parseArgumentsRespectingNesting(value[open+1 : len(value)-1]), true
+}
+
+// Splits comma separated arguments, ignoring commas nested in brackets or
+// string literals.
+func SplitArguments(argsStr string) []string {
+	return parseArgumentsRespectingNesting(argsStr)
+}
+
 func parseArgumentsRespectingNesting(argsStr string) []string {
 	if strings.TrimSpace(argsStr) == "" {
 		return []string{}
@@ -1478,16 +1751,29 @@ func parseArgumentsRespectingNesting(argsStr string) []string {
 	var args []string
 	var current strings.Builder
 	parenDepth := 0
+	inQuotes := false
+	escaped := false
 
 	for _, char := range argsStr {
-		switch char {
-		case '(':
+		switch {
+		case inQuotes && escaped:
+			escaped = false
+			current.WriteRune(char)
+		case inQuotes && char == '\\':
+			escaped = true
+			current.WriteRune(char)
+		case char == '"':
+			inQuotes = !inQuotes
+			current.WriteRune(char)
+		case inQuotes:
+			current.WriteRune(char)
+		case char == '(' || char == '[':
 			parenDepth++
 			current.WriteRune(char)
-		case ')':
+		case char == ')' || char == ']':
 			parenDepth--
 			current.WriteRune(char)
-		case ',':
+		case char == ',':
 			if parenDepth == 0 {
 				args = append(args, strings.TrimSpace(current.String()))
 				current.Reset()
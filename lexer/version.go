@@ -0,0 +1,126 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains language version pragma handling and compatibility checks.
+
+package lexer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The language version implemented by this compiler.
+const CurrentLangVersion = "0.3"
+
+// Every language version the compiler accepts, oldest first. Compiling for a
+// version before 0.3 keeps the source level behavior it removed: unknown
+// escapes in strings keep their backslash, and a string function may return
+// "format" | values, which is read as format!("format", values). Other changes,
+// such as string variables growing instead of being truncated at 256 bytes,
+// apply to every version.
+var SupportedLangVersions = []string{"0.1", "0.2", "0.3"}
+
+// The language version the current build is compiled against.
+var LangVersion = CurrentLangVersion
+
+// Returns the version named by a leading `#!scar X.Y` pragma, if any.
+func ParseVersionPragma(input string) (string, bool) {
+	for _, line := range strings.Split(input, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+		if !strings.HasPrefix(trimmed, "#!scar") {
+			return "", false
+		}
+		version := strings.TrimSpace(strings.TrimPrefix(trimmed, "#!scar"))
+		return version, version != ""
+	}
+	return "", false
+}
+
+// Sets the language version for the current build.
+func SetLangVersion(version string) error {
+	for _, v := range SupportedLangVersions {
+		if v == version {
+			LangVersion = version
+			return nil
+		}
+	}
+	if _, ok := parseVersion(version); ok && CompareLangVersions(version, CurrentLangVersion) > 0 {
+		return fmt.Errorf("language version %s is newer than this compiler supports (%s)", version, CurrentLangVersion)
+	}
+	return fmt.Errorf("unknown language version %q, supported versions are %s", version, strings.Join(SupportedLangVersions, ", "))
+}
+
+// Reports whether the current build targets the given language version or later.
+func LangVersionAtLeast(version string) bool {
+	return CompareLangVersions(LangVersion, version) >= 0
+}
+
+// Returns the format! call a value written as "format" | values stands for,
+// reporting whether it is written so. Values may be separated by commas or
+// by further pipes.
+func PipeFormatCall(value string) (string, bool) {
+	value = strings.TrimSpace(value)
+	if !strings.HasPrefix(value, "\"") {
+		return "", false
+	}
+	i := 1
+	for i < len(value) && value[i] != '"' {
+		if value[i] == '\\' {
+			i++
+		}
+		i++
+	}
+	if i >= len(value) {
+		return "", false
+	}
+	rest, ok := strings.CutPrefix(strings.TrimSpace(value[i+1:]), "|")
+	if !ok || strings.HasPrefix(rest, "|") {
+		return "", false
+	}
+	values := strings.Split(rest, " | ")
+	for j := range values {
+		values[j] = strings.TrimSpace(values[j])
+	}
+	return fmt.Sprintf("format!(%s, %s)", value[:i+1], strings.Join(values, ", ")), true
+}
+
+// Compares two language versions, returning -1, 0 or 1.
+func CompareLangVersions(a, b string) int {
+	av, _ := parseVersion(a)
+	bv, _ := parseVersion(b)
+	for i := 0; i < len(av) || i < len(bv); i++ {
+		var x, y int
+		if i < len(av) {
+			x = av[i]
+		}
+		if i < len(bv) {
+			y = bv[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+func parseVersion(version string) ([]int, bool) {
+	parts := strings.Split(version, ".")
+	nums := make([]int, len(parts))
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, false
+		}
+		nums[i] = n
+	}
+	return nums, true
+}
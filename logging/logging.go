@@ -0,0 +1,73 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains the leveled logging of the scar compiler.
+//
+// Messages meant for the user, such as the binary a build produced, are
+// printed at the normal level and left out with -quiet. What the compiler
+// does along the way is printed with -verbose, and the internals of code
+// generation only with -trace. Verbose and trace messages go to stderr, so
+// they never end up in the C code printed by -c.
+
+package logging
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+type Level int
+
+const (
+	Quiet Level = iota
+	Normal
+	Verbose
+	Trace
+)
+
+var (
+	level = Normal
+	// Where messages of the normal level and of the verbose levels go.
+	Stdout io.Writer = os.Stdout
+	Stderr io.Writer = os.Stderr
+)
+
+// Sets the level of the messages printed.
+func SetLevel(l Level) {
+	level = l
+}
+
+// Reports whether messages of a level are printed.
+func Enabled(l Level) bool {
+	return l <= level
+}
+
+// Prints a message for the user.
+func Infof(format string, args ...any) {
+	if Enabled(Normal) {
+		fmt.Fprintf(Stdout, format+"\n", args...)
+	}
+}
+
+// Prints a warning that does not stop the build.
+func Warnf(format string, args ...any) {
+	if Enabled(Normal) {
+		fmt.Fprintf(Stdout, "Warning: "+format+"\n", args...)
+	}
+}
+
+// Prints what the compiler is doing.
+func Verbosef(format string, args ...any) {
+	if Enabled(Verbose) {
+		fmt.Fprintf(Stderr, format+"\n", args...)
+	}
+}
+
+// Prints internals of the compiler, for debugging it.
+func Tracef(format string, args ...any) {
+	if Enabled(Trace) {
+		fmt.Fprintf(Stderr, "trace: "+format+"\n", args...)
+	}
+}
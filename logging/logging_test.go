@@ -0,0 +1,38 @@
+package logging
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestLevels(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	Stdout, Stderr = &stdout, &stderr
+	defer SetLevel(Normal)
+
+	SetLevel(Normal)
+	Infof("Compiled %s", "main")
+	Verbosef("loaded module %s", "geo")
+	Tracef("rendering %s", "main")
+	if stdout.String() != "Compiled main\n" || stderr.String() != "" {
+		t.Errorf("unexpected output at the normal level: %q %q", stdout.String(), stderr.String())
+	}
+
+	stdout.Reset()
+	SetLevel(Verbose)
+	Warnf("unused %s", "x")
+	Verbosef("loaded module %s", "geo")
+	Tracef("rendering %s", "main")
+	if stdout.String() != "Warning: unused x\n" || stderr.String() != "loaded module geo\n" {
+		t.Errorf("unexpected output at the verbose level: %q %q", stdout.String(), stderr.String())
+	}
+
+	stdout.Reset()
+	stderr.Reset()
+	SetLevel(Quiet)
+	Infof("Compiled %s", "main")
+	Warnf("unused %s", "x")
+	if stdout.Len() != 0 || stderr.Len() != 0 {
+		t.Errorf("expected nothing to be printed when quiet, got %q %q", stdout.String(), stderr.String())
+	}
+}
@@ -0,0 +1,405 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains the symbol index of a scar file, which maps the names declared in
+// it to where they are declared.
+//
+// Top-level declarations are visible in the whole file. Parameters and local
+// variables are visible from their declaration to the end of the top-level
+// declaration or statement they are in, which is close enough to their block
+// for going to their definition and completing them.
+
+package lsp
+
+import (
+	"regexp"
+	"strings"
+
+	"scar/diagnostics"
+	"scar/lexer"
+)
+
+type Symbol struct {
+	Name string
+	Kind string
+	// The declared type of a variable, field or parameter, or the return type
+	// of a function or method.
+	Type string
+	// The class, interface, struct or enum a member belongs to.
+	Container string
+	// The position of the name, starting at 1.
+	Line, Column int
+	// The last line of a class, which this refers to up to it.
+	End int
+	// The lines the symbol is visible on, or 0 for the whole file.
+	ScopeStart, ScopeEnd int
+}
+
+type Index struct {
+	symbols []*Symbol
+	lines   []string
+}
+
+// Builds the index of a parsed program from its source.
+func NewIndex(program *lexer.Program, source string) *Index {
+	idx := &Index{lines: strings.Split(source, "\n")}
+	statements := program.Statements
+	for i, stmt := range statements {
+		end := len(idx.lines)
+		if i+1 < len(statements) && statements[i+1].Line > 0 {
+			end = statements[i+1].Line - 1
+		}
+		idx.addTopLevel(stmt, end)
+	}
+	return idx
+}
+
+// Returns the symbols named name, in the order they are declared.
+func (idx *Index) Lookup(name string) []*Symbol {
+	var found []*Symbol
+	for _, sym := range idx.symbols {
+		if sym.Name == name {
+			found = append(found, sym)
+		}
+	}
+	return found
+}
+
+// Returns the symbols visible on a line.
+func (idx *Index) Visible(line int) []*Symbol {
+	var found []*Symbol
+	for _, sym := range idx.symbols {
+		if sym.visibleOn(line) && sym.Kind != "method" && sym.Kind != "field" && sym.Kind != "enum member" {
+			found = append(found, sym)
+		}
+	}
+	return found
+}
+
+// Returns the methods and fields of a class or struct, and the members of an
+// enum.
+func (idx *Index) Members(container string) []*Symbol {
+	var found []*Symbol
+	for _, sym := range idx.symbols {
+		if sym.Container == container {
+			found = append(found, sym)
+		}
+	}
+	return found
+}
+
+// Returns the declaration a name used on a line refers to. A name accessed on
+// a receiver, as in shape.area, refers to a member of the type of the
+// receiver, and other names to the innermost declaration visible on the line,
+// which for local variables is the closest one before it.
+func (idx *Index) Definition(name string, line int, receiver string) *Symbol {
+	if receiver != "" {
+		var (
+			container = idx.TypeOf(receiver, line)
+			best      *Symbol
+		)
+		for _, sym := range idx.Lookup(name) {
+			if sym.Container != "" && (best == nil || sym.Container == container && best.Container != container) {
+				best = sym
+			}
+		}
+		return best
+	}
+	var best *Symbol
+	for _, sym := range idx.Lookup(name) {
+		if sym.Container != "" || !sym.visibleOn(line) {
+			continue
+		}
+		if best == nil || sym.ScopeStart > 0 && (best.ScopeStart == 0 || sym.Line > best.Line) {
+			best = sym
+		}
+	}
+	return best
+}
+
+// Returns the name of the type whose members a receiver used on a line has,
+// which is the class around the line for this, the type itself for a type,
+// and the declared type of a variable.
+func (idx *Index) TypeOf(receiver string, line int) string {
+	if receiver == "this" {
+		for _, sym := range idx.symbols {
+			if sym.Kind == "class" && sym.Line <= line && line <= sym.End {
+				return sym.Name
+			}
+		}
+		return ""
+	}
+	sym := idx.Definition(receiver, line, "")
+	if sym == nil {
+		return ""
+	}
+	switch sym.Kind {
+	case "class", "interface", "struct", "enum":
+		return sym.Name
+	}
+	typ := strings.TrimSuffix(sym.Type, "?")
+	if i := strings.LastIndexAny(typ, ".:"); i >= 0 {
+		typ = typ[i+1:]
+	}
+	return typ
+}
+
+func (sym *Symbol) visibleOn(line int) bool {
+	if sym.ScopeStart == 0 {
+		return true
+	}
+	return line >= sym.ScopeStart && line <= sym.ScopeEnd && line >= sym.Line
+}
+
+func (idx *Index) addTopLevel(stmt *lexer.Statement, end int) {
+	line := stmt.Line
+	switch {
+	case stmt.ClassDecl != nil:
+		decl := stmt.ClassDecl
+		idx.addClass(decl.Name, decl.Constructor, decl.Methods, line, end)
+	case stmt.PubClassDecl != nil:
+		decl := stmt.PubClassDecl
+		idx.addClass(decl.Name, decl.Constructor, decl.Methods, line, end)
+	case stmt.InterfaceDecl != nil:
+		idx.add(&Symbol{Name: stmt.InterfaceDecl.Name, Kind: "interface", Line: line})
+		for _, method := range stmt.InterfaceDecl.Methods {
+			idx.addMethod(stmt.InterfaceDecl.Name, method, line, end)
+		}
+	case stmt.StructDecl != nil:
+		idx.add(&Symbol{Name: stmt.StructDecl.Name, Kind: "struct", Line: line})
+		for _, field := range stmt.StructDecl.Fields {
+			idx.add(&Symbol{Name: field.Name, Kind: "field", Type: field.Type, Container: stmt.StructDecl.Name, Line: idx.findLine(field.Name, line, end)})
+		}
+	case stmt.EnumDecl != nil:
+		idx.addEnum(stmt.EnumDecl.Name, stmt.EnumDecl.Values, line, end)
+	case stmt.PubEnumDecl != nil:
+		idx.addEnum(stmt.PubEnumDecl.Name, stmt.PubEnumDecl.Values, line, end)
+	case stmt.TopLevelFuncDecl != nil:
+		decl := stmt.TopLevelFuncDecl
+		idx.addFunction(&Symbol{Name: decl.Name, Kind: "function", Type: decl.ReturnType, Line: line}, decl.Parameters, decl.Body, end)
+	case stmt.PubTopLevelFuncDecl != nil:
+		decl := stmt.PubTopLevelFuncDecl
+		idx.addFunction(&Symbol{Name: decl.Name, Kind: "function", Type: decl.ReturnType, Line: line}, decl.Parameters, decl.Body, end)
+	case stmt.ExternFunc != nil:
+		decl := stmt.ExternFunc
+		idx.addFunction(&Symbol{Name: decl.Name, Kind: "function", Type: decl.ReturnType, Line: line}, decl.Parameters, nil, end)
+	case stmt.PubVarDecl != nil:
+		idx.add(&Symbol{Name: stmt.PubVarDecl.Name, Kind: "variable", Type: stmt.PubVarDecl.Type, Line: line})
+	case stmt.ConstDecl != nil:
+		idx.add(&Symbol{Name: stmt.ConstDecl.Name, Kind: "constant", Type: stmt.ConstDecl.Type, Line: line})
+	default:
+		// Variables declared by the statements of the program are visible
+		// in the statements after them.
+		idx.addLocals([]*lexer.Statement{stmt}, line, len(idx.lines))
+	}
+}
+
+func (idx *Index) addClass(name string, ctor *lexer.ConstructorStmt, methods []*lexer.MethodDeclStmt, line, end int) {
+	idx.add(&Symbol{Name: name, Kind: "class", Line: line, End: end})
+	fields := make(map[string]bool)
+	if ctor != nil {
+		idx.addFields(name, ctor.Fields, fields)
+		initLine := idx.findLine("init", line, end)
+		for _, param := range ctor.Parameters {
+			idx.add(&Symbol{Name: param.Name, Kind: "parameter", Type: param.Type, Line: initLine, ScopeStart: initLine, ScopeEnd: end})
+		}
+	}
+	for _, method := range methods {
+		idx.addFields(name, method.Body, fields)
+	}
+	for _, method := range methods {
+		idx.addMethod(name, method, line, end)
+	}
+}
+
+// Adds the fields of a class, which are declared by the first statement
+// declaring or assigning this.field.
+func (idx *Index) addFields(class string, statements []*lexer.Statement, fields map[string]bool) {
+	for _, stmt := range statements {
+		name, typ, ok := declaration(stmt)
+		if !ok && stmt.VarAssign != nil {
+			name, ok = stmt.VarAssign.Name, true
+		}
+		if field, isField := strings.CutPrefix(name, "this."); ok && isField && !fields[field] {
+			fields[field] = true
+			idx.add(&Symbol{Name: field, Kind: "field", Type: typ, Container: class, Line: stmt.Line})
+		}
+		for _, body := range nestedBodies(stmt) {
+			idx.addFields(class, body, fields)
+		}
+	}
+}
+
+func (idx *Index) addMethod(container string, method *lexer.MethodDeclStmt, line, end int) {
+	methodLine := idx.findLine(method.Name, line, end)
+	idx.add(&Symbol{Name: method.Name, Kind: "method", Type: method.ReturnType, Container: container, Line: methodLine})
+	for _, param := range method.Parameters {
+		idx.add(&Symbol{Name: param.Name, Kind: "parameter", Type: param.Type, Line: methodLine, ScopeStart: methodLine, ScopeEnd: end})
+	}
+	idx.addLocals(method.Body, methodLine, end)
+}
+
+func (idx *Index) addEnum(name string, values []string, line, end int) {
+	idx.add(&Symbol{Name: name, Kind: "enum", Line: line})
+	for _, value := range values {
+		idx.add(&Symbol{Name: value, Kind: "enum member", Type: name, Container: name, Line: idx.findLine(value, line, end)})
+	}
+}
+
+func (idx *Index) addFunction(fn *Symbol, params []*lexer.MethodParameter, body []*lexer.Statement, end int) {
+	idx.add(fn)
+	for _, param := range params {
+		idx.add(&Symbol{Name: param.Name, Kind: "parameter", Type: param.Type, Line: fn.Line, ScopeStart: fn.Line, ScopeEnd: end})
+	}
+	idx.addLocals(body, fn.Line, end)
+}
+
+// Adds the variables declared by statements and the blocks nested in them,
+// visible up to the line end.
+func (idx *Index) addLocals(statements []*lexer.Statement, line, end int) {
+	for _, stmt := range statements {
+		if stmt.Line > 0 {
+			line = stmt.Line
+		}
+		if name, typ, ok := declaration(stmt); ok && !strings.HasPrefix(name, "this.") {
+			idx.add(&Symbol{Name: name, Kind: "variable", Type: typ, Line: line, ScopeStart: line, ScopeEnd: end})
+		}
+		for _, body := range nestedBodies(stmt) {
+			idx.addLocals(body, line, end)
+		}
+	}
+}
+
+// Returns the variable a statement declares, together with its type.
+func declaration(stmt *lexer.Statement) (name, typ string, ok bool) {
+	switch {
+	case stmt.VarDecl != nil:
+		return stmt.VarDecl.Name, stmt.VarDecl.Type, true
+	case stmt.VarDeclInferred != nil:
+		return stmt.VarDeclInferred.Name, "", true
+	case stmt.VarDeclMethodCall != nil:
+		return stmt.VarDeclMethodCall.Name, stmt.VarDeclMethodCall.Type, true
+	case stmt.VarDeclRead != nil:
+		return stmt.VarDeclRead.Name, stmt.VarDeclRead.Type, true
+	case stmt.ObjectDecl != nil:
+		return stmt.ObjectDecl.Name, stmt.ObjectDecl.Type, true
+	case stmt.ListDecl != nil:
+		return stmt.ListDecl.Name, "list[" + stmt.ListDecl.Type + "]", true
+	case stmt.ListDeclFunctionCall != nil:
+		return stmt.ListDeclFunctionCall.Name, "list[" + stmt.ListDeclFunctionCall.Type + "]", true
+	case stmt.ListOfDecl != nil:
+		return stmt.ListOfDecl.Name, "list[" + stmt.ListOfDecl.Type + "]", true
+	case stmt.ArrayDecl != nil:
+		return stmt.ArrayDecl.Name, stmt.ArrayDecl.Type, true
+	case stmt.MapDecl != nil:
+		return stmt.MapDecl.Name, "map[" + stmt.MapDecl.KeyType + ":" + stmt.MapDecl.ValueType + "]", true
+	case stmt.SetDecl != nil:
+		return stmt.SetDecl.Name, "set[" + stmt.SetDecl.ElemType + "]", true
+	case stmt.For != nil:
+		return stmt.For.Var, "int", true
+	case stmt.ParallelFor != nil:
+		return stmt.ParallelFor.Var, "int", true
+	case stmt.Foreach != nil:
+		return stmt.Foreach.VarName, stmt.Foreach.VarType, true
+	case stmt.TryCatch != nil && stmt.TryCatch.CatchVar != "":
+		return stmt.TryCatch.CatchVar, "Exception", true
+	}
+	return "", "", false
+}
+
+// Returns the blocks nested directly inside a statement.
+func nestedBodies(stmt *lexer.Statement) [][]*lexer.Statement {
+	var bodies [][]*lexer.Statement
+	switch {
+	case stmt.If != nil:
+		bodies = append(bodies, stmt.If.Body)
+		for _, elif := range stmt.If.ElseIfs {
+			bodies = append(bodies, elif.Body)
+		}
+		if stmt.If.Else != nil {
+			bodies = append(bodies, stmt.If.Else.Body)
+		}
+	case stmt.Match != nil:
+		for _, arm := range stmt.Match.Cases {
+			bodies = append(bodies, arm.Body)
+		}
+		if stmt.Match.Else != nil {
+			bodies = append(bodies, stmt.Match.Else.Body)
+		}
+	case stmt.While != nil:
+		bodies = append(bodies, stmt.While.Body)
+	case stmt.For != nil:
+		bodies = append(bodies, stmt.For.Body)
+	case stmt.ParallelFor != nil:
+		bodies = append(bodies, stmt.ParallelFor.Body)
+	case stmt.Foreach != nil:
+		bodies = append(bodies, stmt.Foreach.Body)
+	case stmt.TryCatch != nil:
+		bodies = append(bodies, stmt.TryCatch.TryBody, stmt.TryCatch.CatchBody, stmt.TryCatch.FinallyBody)
+	case stmt.Test != nil:
+		bodies = append(bodies, stmt.Test.Body)
+	case stmt.Bench != nil:
+		bodies = append(bodies, stmt.Bench.Body)
+	}
+	return bodies
+}
+
+func (idx *Index) add(sym *Symbol) {
+	if sym.Name == "" {
+		return
+	}
+	if sym.Line > 0 && sym.Line <= len(idx.lines) {
+		if column := diagnostics.IndexName(idx.lines[sym.Line-1], sym.Name); column >= 0 {
+			sym.Column = column + 1
+		}
+	}
+	idx.symbols = append(idx.symbols, sym)
+}
+
+// Returns the first line between start and end that declares a member, as
+// the parser does not record the lines of methods, struct fields and enum
+// members.
+func (idx *Index) findLine(name string, start, end int) int {
+	declares := regexp.MustCompile(`^\s*(?:pub\s+)?(?:fn\s+|[\w\[\]:]+\s+)?` + regexp.QuoteMeta(name) + `\b`)
+	for line := start + 1; line <= min(end, len(idx.lines)); line++ {
+		if declares.MatchString(idx.lines[line-1]) {
+			return line
+		}
+	}
+	return start
+}
+
+func isIdentByte(b byte) bool {
+	return b == '_' || b >= '0' && b <= '9' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z'
+}
+
+// Returns the identifier around a column of a line, starting at 0, and the
+// identifier before the dot or :: it follows, if it names a member of a type
+// or of a module.
+func wordAt(line string, column int) (word, receiver string) {
+	column = min(max(column, 0), len(line))
+	start, end := column, column
+	for start > 0 && isIdentByte(line[start-1]) {
+		start--
+	}
+	for end < len(line) && isIdentByte(line[end]) {
+		end++
+	}
+	separator := 0
+	switch {
+	case strings.HasSuffix(line[:start], "::"):
+		separator = 2
+	case strings.HasSuffix(line[:start], "."):
+		separator = 1
+	}
+	if separator > 0 {
+		receiverEnd := start - separator
+		receiverStart := receiverEnd
+		for receiverStart > 0 && isIdentByte(line[receiverStart-1]) {
+			receiverStart--
+		}
+		receiver = line[receiverStart:receiverEnd]
+	}
+	return line[start:end], receiver
+}
@@ -0,0 +1,211 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"scar/lexer"
+)
+
+const shapes = `class Square:
+    init(int side):
+        this.side = side
+    fn area() -> int:
+        return this.side * this.side
+
+fn twice(int n) -> int:
+    int doubled = n * 2
+    return doubled
+
+Square sq = new Square(3)
+int a = sq.area()
+print "{twice(a)}"
+`
+
+// Frames requests the way an editor sends them.
+func frame(messages ...string) string {
+	var b strings.Builder
+	for _, msg := range messages {
+		fmt.Fprintf(&b, "Content-Length: %d\r\n\r\n%s", len(msg), msg)
+	}
+	return b.String()
+}
+
+// Runs the server over requests and returns the messages it wrote.
+func serve(t *testing.T, requests ...string) []map[string]any {
+	t.Helper()
+	var out bytes.Buffer
+	if err := NewServer(strings.NewReader(frame(requests...)), &out).Run(); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	var messages []map[string]any
+	for _, frame := range strings.Split(out.String(), "Content-Length: ")[1:] {
+		_, body, _ := strings.Cut(frame, "\r\n\r\n")
+		var msg map[string]any
+		if err := json.Unmarshal([]byte(body), &msg); err != nil {
+			t.Fatalf("invalid message %q: %v", body, err)
+		}
+		messages = append(messages, msg)
+	}
+	return messages
+}
+
+func didOpen(uri, text string) string {
+	params, _ := json.Marshal(map[string]any{"textDocument": map[string]any{"uri": uri, "languageId": "scar", "version": 1, "text": text}})
+	return `{"jsonrpc":"2.0","method":"textDocument/didOpen","params":` + string(params) + `}`
+}
+
+func positionRequest(id int, method, uri string, line, character int) string {
+	return fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"%s","params":{"textDocument":{"uri":"%s"},"position":{"line":%d,"character":%d}}}`,
+		id, method, uri, line, character)
+}
+
+func TestPublishDiagnostics(t *testing.T) {
+	var out bytes.Buffer
+	server := NewServer(strings.NewReader(frame(
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`,
+		didOpen("file:///tmp/main.scar", "int count = 1\nint next = coutn + 1\n"),
+		`{"jsonrpc":"2.0","id":2,"method":"shutdown"}`,
+		`{"jsonrpc":"2.0","method":"exit"}`,
+	)), &out)
+	if err := server.Run(); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	output := out.String()
+	for _, expected := range []string{
+		`"definitionProvider":true`,
+		`"method":"textDocument/publishDiagnostics"`,
+		`"uri":"file:///tmp/main.scar"`,
+		`"range":{"start":{"line":1,"character":11},"end":{"line":1,"character":16}}`,
+		`undefined identifier 'coutn', did you mean 'count'?`,
+		`{"jsonrpc":"2.0","id":2,"result":null}`,
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("expected %s in the output of the server:\n%s", expected, output)
+		}
+	}
+}
+
+func TestDefinition(t *testing.T) {
+	uri := "file:///tmp/shapes.scar"
+	messages := serve(t,
+		didOpen(uri, shapes),
+		positionRequest(1, "textDocument/definition", uri, 12, 9),  // twice
+		positionRequest(2, "textDocument/definition", uri, 11, 12), // area, on sq
+		positionRequest(3, "textDocument/definition", uri, 8, 12),  // doubled
+		positionRequest(4, "textDocument/definition", uri, 4, 22),  // side, on this
+		positionRequest(5, "textDocument/definition", uri, 12, 1),  // print
+	)
+	expected := map[float64]string{
+		1: `{"range":{"end":{"character":8,"line":6},"start":{"character":3,"line":6}},"uri":"file:///tmp/shapes.scar"}`,
+		2: `{"range":{"end":{"character":11,"line":3},"start":{"character":7,"line":3}},"uri":"file:///tmp/shapes.scar"}`,
+		3: `{"range":{"end":{"character":15,"line":7},"start":{"character":8,"line":7}},"uri":"file:///tmp/shapes.scar"}`,
+		4: `{"range":{"end":{"character":17,"line":2},"start":{"character":13,"line":2}},"uri":"file:///tmp/shapes.scar"}`,
+		5: `null`,
+	}
+	for _, msg := range messages {
+		id, ok := msg["id"].(float64)
+		if !ok {
+			continue
+		}
+		result, _ := json.Marshal(msg["result"])
+		if string(result) != expected[id] {
+			t.Errorf("definition %v: expected %s, got %s", id, expected[id], result)
+		}
+		delete(expected, id)
+	}
+	if len(expected) > 0 {
+		t.Errorf("missing responses to definitions %v", expected)
+	}
+}
+
+func TestDefinitionInModule(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "geo.scar"), []byte("pub fn twice(int n) -> int:\n    return n * 2\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	defer clear(lexer.LoadedModules)
+
+	uri := pathURI(filepath.Join(dir, "main.scar"))
+	messages := serve(t,
+		didOpen(uri, "import geo\n\nint x = geo::twice(2)\n"),
+		positionRequest(1, "textDocument/definition", uri, 2, 14),
+	)
+	for _, msg := range messages {
+		if msg["id"] == nil {
+			if diagnostics := msg["params"].(map[string]any)["diagnostics"].([]any); len(diagnostics) > 0 {
+				t.Errorf("expected no diagnostics, got %v", diagnostics)
+			}
+			continue
+		}
+		result, _ := json.Marshal(msg["result"])
+		expected := `{"range":{"end":{"character":12,"line":0},"start":{"character":7,"line":0}},"uri":"` + pathURI(filepath.Join(dir, "geo.scar")) + `"}`
+		if string(result) != expected {
+			t.Errorf("expected %s, got %s", expected, result)
+		}
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	uri := "file:///tmp/shapes.scar"
+	messages := serve(t,
+		didOpen(uri, shapes),
+		positionRequest(1, "textDocument/completion", uri, 11, 11), // sq.
+		positionRequest(2, "textDocument/completion", uri, 12, 0),
+	)
+	labels := make(map[float64][]string)
+	for _, msg := range messages {
+		id, ok := msg["id"].(float64)
+		if !ok {
+			continue
+		}
+		for _, item := range msg["result"].([]any) {
+			labels[id] = append(labels[id], item.(map[string]any)["label"].(string))
+		}
+	}
+	if !slices.Equal(labels[1], []string{"area", "side"}) {
+		t.Errorf("expected the members of Square, got %v", labels[1])
+	}
+	for _, name := range []string{"Square", "a", "sq", "twice", "while"} {
+		if !slices.Contains(labels[2], name) {
+			t.Errorf("expected %s among the completions, got %v", name, labels[2])
+		}
+	}
+	if slices.Contains(labels[2], "doubled") || slices.Contains(labels[2], "n") {
+		t.Errorf("expected the locals of twice not to be completed outside of it, got %v", labels[2])
+	}
+}
+
+func TestWordAt(t *testing.T) {
+	for _, tc := range []struct {
+		line           string
+		column         int
+		word, receiver string
+	}{
+		{"int a = sq.area()", 12, "area", "sq"},
+		{"int a = sq.area()", 8, "sq", ""},
+		{"x = geo::twice(1)", 11, "twice", "geo"},
+		{"print x", 7, "x", ""},
+	} {
+		word, receiver := wordAt(tc.line, tc.column)
+		if word != tc.word || receiver != tc.receiver {
+			t.Errorf("wordAt(%q, %d) = %q, %q, expected %q, %q", tc.line, tc.column, word, receiver, tc.word, tc.receiver)
+		}
+	}
+}
+
+func TestReadMessage(t *testing.T) {
+	server := NewServer(bufio.NewReader(strings.NewReader("Content-Type: x\r\ncontent-length: 17\r\n\r\n{\"method\":\"exit\"}")), nil)
+	msg, err := server.read()
+	if err != nil || msg.Method != "exit" {
+		t.Errorf("expected an exit message, got %+v, %v", msg, err)
+	}
+}
@@ -0,0 +1,507 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains the language server of scar, which scar lsp runs over stdin and
+// stdout.
+//
+// The server keeps the files an editor has open, and parses and checks a file
+// each time it is opened or changed, publishing the errors found as the
+// diagnostics of the file. Going to a definition and completing a name look
+// the names up in the symbol index of the last version of the file that
+// parsed, so they keep working while the file being typed does not parse.
+
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"scar/checker"
+	"scar/diagnostics"
+	"scar/lexer"
+	"scar/meta"
+	"scar/preprocessor"
+)
+
+// The JSON-RPC error codes the server replies with.
+const (
+	codeParseError     = -32700
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+)
+
+// The words completed in addition to the names of a file.
+var keywords = []string{
+	"import", "pub", "class", "interface", "struct", "enum", "fn", "init", "deinit", "const", "var",
+	"if", "elif", "else", "while", "for", "foreach", "parallel", "match", "case", "break", "continue",
+	"return", "try", "catch", "finally", "throw", "new", "delete", "print", "put", "eprint", "eput", "sleep", "sleep_ms", "sleep_us", "spawn", "join", "breakpoint", "atomic", "reduce", "test", "bench", "assert",
+	"int", "float", "double", "bool", "char", "string", "list", "map", "set", "true", "false", "nil",
+}
+
+type Server struct {
+	in       *bufio.Reader
+	out      io.Writer
+	docs     map[string]*document
+	shutdown bool
+}
+
+// A file open in the editor.
+type document struct {
+	path  string
+	text  string
+	index *Index
+	// The files of the modules the file imports, by the names they are
+	// referred to with.
+	modules map[string]string
+}
+
+type message struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+}
+
+type response struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id"`
+	Result  any              `json:"result"`
+}
+
+type errorResponse struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id"`
+	Error   responseError    `json:"error"`
+}
+
+type responseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type notification struct {
+	JSONRPC string `json:"jsonrpc"`
+	Method  string `json:"method"`
+	Params  any    `json:"params"`
+}
+
+type Position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type Range struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+type Location struct {
+	URI   string `json:"uri"`
+	Range Range  `json:"range"`
+}
+
+type Diagnostic struct {
+	Range    Range  `json:"range"`
+	Severity int    `json:"severity"`
+	Source   string `json:"source"`
+	Message  string `json:"message"`
+}
+
+type CompletionItem struct {
+	Label  string `json:"label"`
+	Kind   int    `json:"kind"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type textDocumentPosition struct {
+	TextDocument struct {
+		URI string `json:"uri"`
+	} `json:"textDocument"`
+	Position Position `json:"position"`
+}
+
+// Creates a server reading requests from in and writing responses to out.
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{in: bufio.NewReader(in), out: out, docs: make(map[string]*document)}
+}
+
+// Serves requests until the client asks the server to exit, or closes its
+// input.
+func (s *Server) Run() error {
+	for {
+		msg, err := s.read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			s.replyError(nil, codeParseError, err.Error())
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if msg.Method == "exit" {
+			if !s.shutdown {
+				return errors.New("exit before shutdown")
+			}
+			return nil
+		}
+		if err := s.handle(msg); err != nil {
+			return err
+		}
+	}
+}
+
+// Reads a message framed by a Content-Length header.
+func (s *Server) read() (*message, error) {
+	length := -1
+	for {
+		line, err := s.in.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		if name, value, ok := strings.Cut(line, ":"); ok && strings.EqualFold(name, "Content-Length") {
+			if length, err = strconv.Atoi(strings.TrimSpace(value)); err != nil {
+				return nil, fmt.Errorf("invalid Content-Length header '%s'", line)
+			}
+		}
+	}
+	if length < 0 {
+		return nil, errors.New("message without a Content-Length header")
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(s.in, body); err != nil {
+		return nil, err
+	}
+	msg := &message{}
+	return msg, json.Unmarshal(body, msg)
+}
+
+func (s *Server) write(v any) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	return err
+}
+
+func (s *Server) reply(id *json.RawMessage, result any) error {
+	return s.write(response{JSONRPC: "2.0", ID: id, Result: result})
+}
+
+func (s *Server) replyError(id *json.RawMessage, code int, message string) error {
+	return s.write(errorResponse{JSONRPC: "2.0", ID: id, Error: responseError{Code: code, Message: message}})
+}
+
+func (s *Server) notify(method string, params any) error {
+	return s.write(notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+func (s *Server) handle(msg *message) error {
+	switch msg.Method {
+	case "initialize":
+		return s.reply(msg.ID, map[string]any{
+			"capabilities": map[string]any{
+				"textDocumentSync":   1,
+				"definitionProvider": true,
+				"completionProvider": map[string]any{"triggerCharacters": []string{".", ":"}},
+			},
+			"serverInfo": map[string]any{"name": "scar", "version": meta.Version},
+		})
+	case "shutdown":
+		s.shutdown = true
+		return s.reply(msg.ID, nil)
+	case "textDocument/didOpen":
+		var params struct {
+			TextDocument struct {
+				URI  string `json:"uri"`
+				Text string `json:"text"`
+			} `json:"textDocument"`
+		}
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil
+		}
+		return s.update(params.TextDocument.URI, params.TextDocument.Text)
+	case "textDocument/didChange":
+		var params struct {
+			TextDocument struct {
+				URI string `json:"uri"`
+			} `json:"textDocument"`
+			ContentChanges []struct {
+				Text string `json:"text"`
+			} `json:"contentChanges"`
+		}
+		if err := json.Unmarshal(msg.Params, &params); err != nil || len(params.ContentChanges) == 0 {
+			return nil
+		}
+		// The server asks for the whole text with every change.
+		return s.update(params.TextDocument.URI, params.ContentChanges[len(params.ContentChanges)-1].Text)
+	case "textDocument/didClose":
+		var params textDocumentPosition
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil
+		}
+		delete(s.docs, params.TextDocument.URI)
+		return s.notify("textDocument/publishDiagnostics", map[string]any{"uri": params.TextDocument.URI, "diagnostics": []Diagnostic{}})
+	case "textDocument/definition":
+		var params textDocumentPosition
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return s.replyError(msg.ID, codeInvalidParams, err.Error())
+		}
+		location, ok := s.definition(params.TextDocument.URI, params.Position)
+		if !ok {
+			return s.reply(msg.ID, nil)
+		}
+		return s.reply(msg.ID, location)
+	case "textDocument/completion":
+		var params textDocumentPosition
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return s.replyError(msg.ID, codeInvalidParams, err.Error())
+		}
+		return s.reply(msg.ID, s.completion(params.TextDocument.URI, params.Position))
+	}
+	if msg.ID != nil {
+		return s.replyError(msg.ID, codeMethodNotFound, "method not supported: "+msg.Method)
+	}
+	// Other notifications, such as initialized, need no answer.
+	return nil
+}
+
+// Analyzes a new version of a file and publishes its diagnostics.
+func (s *Server) update(uri, text string) error {
+	doc, exists := s.docs[uri]
+	if !exists {
+		doc = &document{path: uriPath(uri)}
+		s.docs[uri] = doc
+	}
+	doc.text = text
+	diagnostics := doc.analyze()
+	return s.notify("textDocument/publishDiagnostics", map[string]any{"uri": uri, "diagnostics": diagnostics})
+}
+
+// Parses and checks the text of a document, indexing it when it parses, and
+// returns the errors found as diagnostics. A crash of the parser on a file
+// being typed is reported rather than stopping the server.
+func (doc *document) analyze() (result []Diagnostic) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = append(result, Diagnostic{Severity: 1, Source: "scar", Message: fmt.Sprint("internal compiler error: ", r)})
+		}
+	}()
+
+	program, err := lexer.ParseWithIndentation(preprocessor.ProcessSourceLevelMacros(doc.text))
+	if err != nil {
+		return doc.diagnostics([]error{err})
+	}
+	doc.index = NewIndex(program, doc.text)
+
+	// Modules are loaded again, as they may have changed since the last
+	// analysis, and relative to the file rather than to the server.
+	clear(lexer.LoadedModules)
+	doc.modules = make(map[string]string)
+	var errs []error
+	for _, imp := range program.Imports {
+		module, err := lexer.LoadModule(imp.Module, filepath.Dir(doc.path))
+		if err != nil {
+			// Errors in the module keep the file they are in.
+			if d := diagnostics.FromError(err, doc.path); d.File != doc.path {
+				errs = append(errs, d)
+			} else {
+				errs = append(errs, diagnostics.Errorf(doc.importLine(imp.Module), "failed to load module '%s': %v", imp.Module, err))
+			}
+			continue
+		}
+		name := imp.Alias
+		if name == "" {
+			name = lexer.ModuleBaseName(imp.Module)
+		}
+		doc.modules[name] = module.FilePath
+	}
+	errs = append(errs, lexer.ValidateProgram(program)...)
+	errs = append(errs, checker.Check(program)...)
+	return doc.diagnostics(errs)
+}
+
+// Converts errors into diagnostics of the document. Errors in the modules it
+// imports are shown on the import of the module.
+func (doc *document) diagnostics(errs []error) []Diagnostic {
+	result := []Diagnostic{}
+	for _, err := range errs {
+		for _, err := range diagnostics.Split(err) {
+			d := diagnostics.FromError(err, doc.path)
+			message := d.Message
+			if d.File != doc.path {
+				message = d.Error()
+				d.Line, d.Column, d.Length = doc.importLine(strings.TrimSuffix(filepath.Base(d.File), ".scar")), 0, 0
+			}
+			d.Locate(doc.text)
+			start := Position{Line: max(d.Line-1, 0), Character: max(d.Column-1, 0)}
+			end := Position{Line: start.Line, Character: start.Character + max(d.Length, 1)}
+			result = append(result, Diagnostic{Range: Range{Start: start, End: end}, Severity: 1, Source: "scar", Message: message})
+		}
+	}
+	return result
+}
+
+// Returns the line a module is imported on, or 1 when it is not imported.
+func (doc *document) importLine(module string) int {
+	for i, line := range strings.Split(doc.text, "\n") {
+		if fields := strings.Fields(line); len(fields) >= 2 && fields[0] == "import" && lexer.ModuleBaseName(fields[1]) == lexer.ModuleBaseName(module) {
+			return i + 1
+		}
+	}
+	return 1
+}
+
+// Returns where the name at a position of a file is declared.
+func (s *Server) definition(uri string, pos Position) (Location, bool) {
+	doc, exists := s.docs[uri]
+	if !exists || doc.index == nil {
+		return Location{}, false
+	}
+	word, receiver := doc.wordAt(pos)
+	if word == "" {
+		return Location{}, false
+	}
+	if modulePath, isModule := doc.modules[receiver]; isModule {
+		index, err := fileIndex(modulePath)
+		if err != nil {
+			return Location{}, false
+		}
+		if sym := index.Definition(word, 0, ""); sym != nil {
+			return symbolLocation(pathURI(modulePath), sym), true
+		}
+		return Location{}, false
+	}
+	if sym := doc.index.Definition(word, pos.Line+1, receiver); sym != nil {
+		return symbolLocation(uri, sym), true
+	}
+	return Location{}, false
+}
+
+// Returns the completions at a position of a file: the members of the type of
+// the receiver after a dot, the public names of a module after ::, and the
+// names visible on the line and the keywords otherwise.
+func (s *Server) completion(uri string, pos Position) []CompletionItem {
+	items := []CompletionItem{}
+	doc, exists := s.docs[uri]
+	if !exists {
+		return items
+	}
+	_, receiver := doc.wordAt(pos)
+	var symbols []*Symbol
+	switch modulePath, isModule := doc.modules[receiver]; {
+	case doc.index == nil:
+	case isModule:
+		if index, err := fileIndex(modulePath); err == nil {
+			symbols = index.Visible(0)
+		}
+	case receiver != "":
+		symbols = doc.index.Members(doc.index.TypeOf(receiver, pos.Line+1))
+	default:
+		symbols = doc.index.Visible(pos.Line + 1)
+	}
+
+	seen := make(map[string]bool)
+	for _, sym := range symbols {
+		if !seen[sym.Name] {
+			seen[sym.Name] = true
+			items = append(items, CompletionItem{Label: sym.Name, Kind: completionKind(sym.Kind), Detail: strings.TrimSpace(sym.Kind + " " + sym.Type)})
+		}
+	}
+	if receiver == "" {
+		for _, keyword := range keywords {
+			if !seen[keyword] {
+				items = append(items, CompletionItem{Label: keyword, Kind: 14})
+			}
+		}
+	}
+	slices.SortStableFunc(items, func(a, b CompletionItem) int { return strings.Compare(a.Label, b.Label) })
+	return items
+}
+
+// Returns the word at a position of a document and the receiver it is
+// accessed on, if any.
+func (doc *document) wordAt(pos Position) (word, receiver string) {
+	lines := strings.Split(doc.text, "\n")
+	if pos.Line < 0 || pos.Line >= len(lines) {
+		return "", ""
+	}
+	return wordAt(strings.TrimRight(lines[pos.Line], "\r"), pos.Character)
+}
+
+// Parses and indexes a file, such as a module a document imports.
+func fileIndex(path string) (*Index, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	program, err := lexer.ParseWithIndentation(preprocessor.ProcessSourceLevelMacros(string(data)))
+	if err != nil {
+		return nil, err
+	}
+	return NewIndex(program, string(data)), nil
+}
+
+func symbolLocation(uri string, sym *Symbol) Location {
+	start := Position{Line: max(sym.Line-1, 0), Character: max(sym.Column-1, 0)}
+	end := Position{Line: start.Line, Character: start.Character + len(sym.Name)}
+	return Location{URI: uri, Range: Range{Start: start, End: end}}
+}
+
+// Returns the LSP completion item kind of a kind of symbol.
+func completionKind(kind string) int {
+	switch kind {
+	case "method":
+		return 2
+	case "function":
+		return 3
+	case "field":
+		return 5
+	case "variable", "parameter":
+		return 6
+	case "class", "struct":
+		return 7
+	case "interface":
+		return 8
+	case "enum":
+		return 13
+	case "enum member":
+		return 20
+	case "constant":
+		return 21
+	}
+	return 1
+}
+
+// Returns the path of a file URI.
+func uriPath(uri string) string {
+	if u, err := url.Parse(uri); err == nil && u.Scheme == "file" {
+		return filepath.FromSlash(u.Path)
+	}
+	return uri
+}
+
+// Returns the file URI of a path.
+func pathURI(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
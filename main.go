@@ -7,6 +7,8 @@
 package main
 
 import (
+	"cmp"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
@@ -14,18 +16,67 @@ import (
 	"os/exec"
 	"path"
 	"path/filepath"
-	"runtime"
+	"scar/buildlog"
+	"scar/checker"
+	"scar/diagnostics"
 	"scar/lexer"
+	"scar/logging"
+	"scar/lsp"
 	"scar/meta"
 	"scar/preprocessor"
 	"scar/renderer"
+	"scar/renderer/llvm"
+	"slices"
 	"strings"
+	"time"
 )
 
 func main() {
 	flag.Usage = meta.ShowUsage
 	asm := flag.Bool("asm", false, "show assembly output")
 	c := flag.Bool("c", false, "show IL")
+	logFormat := flag.String("log", "", "emit build events to stderr in the given format (json)")
+	showStats := flag.Bool("stats", false, "print build statistics after linking")
+	leakCheck := flag.Bool("leak-check", false, "track allocations and report leaks at exit")
+	langVersion := flag.String("lang-version", "", "compile files without a #!scar pragma against this language version")
+	memMode := flag.String("mem", renderer.MemManual, "object memory management: manual, rc (reference counting) or arena")
+	output := flag.String("o", "", "write the binary, or the C code with -c, to this path")
+	outDir := flag.String("outdir", "", "write the binary, or the C code with -c, to this directory, or with doc, the documentation")
+	keepC := flag.Bool("keep-c", false, "keep the generated C code next to the binary")
+	emitC := flag.String("emit-c", "", "keep the generated C code in this file")
+	ccFlag := flag.String("cc", "", "C compiler to use instead of the default of the platform (defaults to $CC)")
+	cflagsFlag := flag.String("cflags", "", "extra flags passed to the C compiler")
+	ldflagsFlag := flag.String("ldflags", "", "extra flags passed to the C compiler when linking")
+	optLevels := make(map[string]*bool)
+	for _, level := range []string{"0", "1", "2", "3", "s"} {
+		optLevels[level] = flag.Bool("O"+level, false, "optimize the C code with -O"+level)
+	}
+	debugInfo := flag.Bool("g", false, "build the binary with debug information")
+	debug := flag.Bool("debug", false, "build the binary for stepping through the scar source in a debugger, without optimization and with breakpoint statements")
+	release := flag.Bool("release", false, "build an optimized binary without runtime assertions")
+	quiet := flag.Bool("quiet", false, "only print errors")
+	verbose := flag.Bool("verbose", false, "print what the compiler does, such as the C compiler invocations")
+	trace := flag.Bool("trace", false, "print the internals of code generation, for debugging the compiler")
+	testMode := flag.Bool("test", false, "compile the test blocks of the program and report their results")
+	benchMode := flag.Bool("bench", false, "compile the bench blocks of the program and report their timings")
+	benchIterations := flag.Int("bench-iterations", 0, "run each bench block this many times instead of for about a second")
+	dumpAST := flag.Bool("dump-ast", false, "print the syntax tree of the program as JSON instead of compiling it")
+	dumpSymbols := flag.Bool("dump-symbols", false, "print the classes and functions of the program with their types as JSON instead of compiling it")
+	docHTML := flag.Bool("html", false, "with doc, write the documentation as HTML instead of Markdown")
+	check := flag.Bool("check", false, "only report the errors of the program without compiling it, or with fmt, list the files that are not formatted")
+	target := flag.String("target", "", "platform to build for, such as linux/amd64, windows/amd64 or darwin/arm64")
+	boundsCheck := flag.Bool("bounds-check", false, "check list indexes at runtime, aborting with the scar line of an index out of range")
+	safe := flag.Bool("safe", false, "check integer arithmetic and narrowing casts at runtime, throwing an exception on overflow, a lossy cast or division by zero")
+	noOpenMP := flag.Bool("no-openmp", false, "compile without OpenMP, running parallel for loops serially")
+	emit := flag.String("emit", "c", "the backend generating code: c, or the experimental llvm, writing LLVM IR next to where the binary would go")
+	flag.BoolVar(&jsonDiagnostics, "json-diagnostics", false, "print diagnostics as JSON lines holding their file, range, severity, message and code, which is the phase that found them")
+	watchRun := flag.Bool("run", false, "with watch, run the program after each build")
+	emitLib := flag.String("emit-lib", "", "build a static or shared library with a header declaring the pub functions and classes, instead of a binary")
+	var links []string
+	flag.Func("link", "link against a C library, as in -link -lfoo or -link foo (repeatable)", func(library string) error {
+		links = append(links, linkFlags(library)...)
+		return nil
+	})
 
 	flag.Parse()
 
@@ -35,45 +86,416 @@ func main() {
 	}
 
 	var (
-		input   string
-		baseDir string
-		ptf     string
+		input        string
+		baseDir      string
+		ptf          string
+		outputBinary string
+		events       = buildlog.New(*logFormat, os.Stderr)
+		wd, _        = os.Getwd()
+		cleanedName  string
 	)
 
-	if len(flag.Args()) > 0 {
-		wd, _ := os.Getwd()
-		ptf = path.Join(wd, flag.Arg(0))
-		baseDir = filepath.Dir(ptf)
-		data, err := os.ReadFile(ptf + ".scar")
+	switch flag.Arg(0) {
+	case "get":
+		if len(flag.Args()) != 2 {
+			log.Fatal("Usage: scar get <git-url>")
+		}
+		if err := getDependency(wd, flag.Arg(1)); err != nil {
+			log.Fatal(err)
+		}
+		return
+	case "vendor":
+		if err := vendorDependencies(wd); err != nil {
+			log.Fatal(err)
+		}
+		return
+	case "lsp":
+		// The messages of the compiler would corrupt the protocol on stdout.
+		logging.Stdout = os.Stderr
+		if err := lsp.NewServer(os.Stdin, os.Stdout).Run(); err != nil {
+			log.Fatal(err)
+		}
+		return
+	case "fmt":
+		// scar fmt [-check] [paths] formats the scar files under the paths.
+		flag.CommandLine.Parse(flag.Args()[1:])
+		os.Exit(formatFiles(events, flag.Args(), *check))
+	case "doc":
+		// scar doc [-html] [-outdir dir] [paths] documents the modules under
+		// the paths.
+		flag.CommandLine.Parse(flag.Args()[1:])
+		os.Exit(writeDocs(events, flag.Args(), *outDir, *docHTML))
+	case "watch":
+		// scar watch [-run] [flags] program [-- args] rebuilds the program,
+		// and with -run runs it, whenever it or a module it imports changes.
+		flag.CommandLine.Parse(flag.Args()[1:])
+		if flag.NArg() < 1 {
+			log.Fatal("Usage: scar watch [-run] [flags] <program> [-- args]")
+		}
+		programArgs := flag.Args()[1:]
+		if len(programArgs) > 0 && programArgs[0] == "--" {
+			programArgs = programArgs[1:]
+		}
+		os.Exit(watchProgram(flag.Arg(0), programArgs, *watchRun))
+	case "test", "bench":
+		// scar test [flags] [paths] runs the tests of the test files under
+		// the paths, and scar bench their bench blocks.
+		mode := flag.Arg(0)
+		flag.CommandLine.Parse(flag.Args()[1:])
+		os.Exit(runTests(flag.Args(), mode))
+	}
+
+	var (
+		running     bool
+		programArgs []string
+	)
+	switch flag.Arg(0) {
+	case "build":
+		// Flags may also follow the subcommand, as in scar build -stats.
+		flag.CommandLine.Parse(flag.Args()[1:])
+		project, err := loadProject(filepath.Join(wd, flag.Arg(0)))
 		if err != nil {
-			log.Fatal("Could not find file.")
+			events.Emit("error", map[string]any{"phase": "read", "message": err.Error()})
+			log.Fatal(err)
+		}
+		ptf = project.EntryPath()
+		cleanedName = project.Name
+		outputBinary = project.OutputPath()
+	case "check":
+		// scar check [flags] program reports the errors of the program
+		// without compiling it, like -check does.
+		flag.CommandLine.Parse(flag.Args()[1:])
+		if flag.NArg() < 1 {
+			log.Fatal("Usage: scar check [flags] <program>")
+		}
+		*check = true
+		ptf = path.Join(wd, flag.Arg(0))
+		cleanedName = strings.ReplaceAll(filepath.Base(ptf), ".scar", "")
+	case "run":
+		// scar run [flags] program [-- args] builds the program in a
+		// temporary directory and runs it with the arguments after --.
+		flag.CommandLine.Parse(flag.Args()[1:])
+		if flag.NArg() < 1 {
+			log.Fatal("Usage: scar run [flags] <program> [-- args]")
+		}
+		programArgs = flag.Args()[1:]
+		if len(programArgs) > 0 && programArgs[0] == "--" {
+			programArgs = programArgs[1:]
+		}
+		ptf = path.Join(wd, flag.Arg(0))
+		cleanedName = strings.ReplaceAll(filepath.Base(ptf), ".scar", "")
+		running = true
+	default:
+		ptf = path.Join(wd, flag.Arg(0))
+		cleanedName = strings.ReplaceAll(filepath.Base(ptf), ".scar", "")
+		outputBinary = "./" + cleanedName
+	}
+
+	switch {
+	case *trace:
+		logging.SetLevel(logging.Trace)
+	case *verbose:
+		logging.SetLevel(logging.Verbose)
+	case *quiet:
+		logging.SetLevel(logging.Quiet)
+	}
+
+	selectedCC = *ccFlag
+	if selectedCC == "" {
+		selectedCC = os.Getenv("CC")
+	}
+	extraCFlags = append(extraCFlags, strings.Fields(*cflagsFlag)...)
+	extraLDFlags = append(append(extraLDFlags, strings.Fields(*ldflagsFlag)...), links...)
+	optLevel := ""
+	for _, level := range []string{"0", "1", "2", "3", "s"} {
+		if *optLevels[level] {
+			optLevel = level
+		}
+	}
+	if *debug {
+		if *release {
+			log.Fatal("-debug and -release cannot be combined")
+		}
+		*debugInfo = true
+		if optLevel == "" {
+			optLevel = "0"
+		}
+	}
+	extraCFlags = append(optimizationFlags(optLevel, *debugInfo, *release), extraCFlags...)
+	if *target != "" {
+		if err := setTarget(*target); err != nil {
+			log.Fatal(err)
+		}
+		if running && targetPlatform != "" {
+			log.Fatalf("scar run cannot run a program built for %s", targetPlatform)
+		}
+	}
+
+	if *emitLib != "" && *emitLib != "static" && *emitLib != "shared" {
+		log.Fatalf("unknown library kind '%s', expected static or shared", *emitLib)
+	}
+	if *emitLib != "" && running {
+		log.Fatal("scar run cannot run a library")
+	}
+	if *emit != "c" && *emit != "llvm" {
+		log.Fatalf("unknown backend '%s', expected c or llvm", *emit)
+	}
+	if *emit == "llvm" && (running || *emitLib != "") {
+		log.Fatal("the llvm backend only writes LLVM IR, so it cannot be combined with run or -emit-lib")
+	}
+
+	baseDir = filepath.Dir(ptf)
+	data, err := os.ReadFile(ptf + ".scar")
+	if err != nil {
+		events.Emit("error", map[string]any{"phase": "read", "message": err.Error()})
+		log.Fatal("Could not find file.")
+	}
+	input = string(data)
+
+	events.Emit("build_started", map[string]any{"file": ptf + ".scar"})
+
+	version := *langVersion
+	if pragma, ok := lexer.ParseVersionPragma(input); ok {
+		if version != "" && version != pragma {
+			logging.Warnf("#!scar %s pragma overrides --lang-version=%s", pragma, version)
+		}
+		version = pragma
+	}
+	if version != "" {
+		if err := lexer.SetLangVersion(version); err != nil {
+			log.Fatal(err)
+		}
+		if lexer.CompareLangVersions(version, lexer.CurrentLangVersion) < 0 {
+			logging.Warnf("compiling with scar %s semantics, current language version is %s", version, lexer.CurrentLangVersion)
 		}
-		input = string(data)
 	}
 
-	cleanedName := strings.ReplaceAll(filepath.Base(ptf), ".scar", "")
+	if err := renderer.CheckMemoryMode(*memMode); err != nil {
+		log.Fatal(err)
+	}
+
+	phaseStart := time.Now()
 	input = preprocessor.ProcessSourceLevelMacros(input)
 	program, err := lexer.ParseWithIndentation(input)
 	if err != nil {
-		log.Fatal(err)
+		reportDiagnostics(events, "parse", []error{err}, ptf+".scar", string(data))
+		log.Fatal("Failed to compile.")
+	}
+	events.Phase("parse", phaseStart)
+	if *dumpAST {
+		tree, err := syntaxTree(program)
+		if err == nil {
+			err = writeJSON(os.Stdout, tree)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
 	}
 
-	validationErrors := lexer.ValidateProgram(program)
-	if len(validationErrors) > 0 {
-		for _, err := range validationErrors {
-			fmt.Fprintf(os.Stderr, "\033[31m%v\033[0m\n", err)
+	// Modules are loaded before the program is checked, so their own errors
+	// are reported rather than the undefined symbols they leave behind, and
+	// their symbols can be dumped.
+	var moduleErrors []error
+	for _, imp := range program.Imports {
+		if _, err := lexer.LoadModule(imp.Module, baseDir); err != nil {
+			moduleErrors = append(moduleErrors, err)
 		}
+	}
+
+	phaseStart = time.Now()
+	validationErrors := append(moduleErrors, lexer.ValidateProgram(program)...)
+	events.Phase("validate", phaseStart)
+
+	// The errors of validation and checking are reported together.
+	phaseStart = time.Now()
+	programChecker := checker.New()
+	if errs := append(validationErrors, programChecker.Check(program)...); len(errs) > 0 {
+		reportDiagnostics(events, "check", errs, ptf+".scar", string(data))
 		log.Fatal("Failed to compile.")
 	}
+	events.Phase("check", phaseStart)
+	if *dumpSymbols {
+		if err := writeJSON(os.Stdout, programChecker.Symbols()); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if *check {
+		events.Emit("build_finished", map[string]any{"success": true})
+		file, _ := filepath.Rel(wd, ptf+".scar")
+		logging.Infof("No errors in %s", file)
+		return
+	}
+
+	switch {
+	case running:
+		tmpDir, err := os.MkdirTemp("", "scar-run-*")
+		if err != nil {
+			log.Fatalf("Failed to create temp directory: %v", err)
+		}
+		outputBinary = filepath.Join(tmpDir, cleanedName)
+	case *outDir != "":
+		outputBinary = filepath.Join(*outDir, filepath.Base(outputBinary))
+	}
+	outputBinary = binaryName(outputBinary)
+	if *output != "" && !running {
+		outputBinary = *output
+	}
+	if !*c && !*asm {
+		if err := os.MkdirAll(filepath.Dir(outputBinary), 0o755); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	finish := func(cCode string, success bool) {
+		if running && !success {
+			os.RemoveAll(filepath.Dir(outputBinary))
+		}
+		finishBuild(events, program, cCode, outputBinary, *showStats, success, running)
+		if running {
+			code := runBinary(outputBinary, programArgs)
+			os.RemoveAll(filepath.Dir(outputBinary))
+			os.Exit(code)
+		}
+	}
+
+	render := renderer.NewRenderer(renderer.Options{
+		SourceFile:      ptf + ".scar",
+		Debug:           *debug,
+		Memory:          *memMode,
+		BoundsCheck:     *boundsCheck,
+		LeakCheck:       *leakCheck,
+		SafeMode:        *safe,
+		TestMode:        *testMode,
+		BenchMode:       *benchMode,
+		BenchIterations: *benchIterations,
+		NoOpenMP:        *noOpenMP,
+	})
+	// Fails the build with the errors code generation found, if any.
+	checkRender := func() {
+		if errs := render.Errors(); len(errs) > 0 {
+			reportDiagnostics(events, "render", errs, ptf+".scar", string(data))
+			finish("", false)
+		}
+	}
+
+	if *emit == "llvm" {
+		phaseStart = time.Now()
+		ir, errs := llvm.Render(program)
+		if len(errs) > 0 {
+			reportDiagnostics(events, "render", errs, ptf+".scar", string(data))
+			finish("", false)
+		}
+		events.Phase("render", phaseStart)
+		irPath := strings.TrimSuffix(outputBinary, ".exe") + ".ll"
+		if *output != "" {
+			irPath = *output
+		}
+		if err := writeFile(irPath, ir); err != nil {
+			log.Fatalf("Failed to write LLVM IR: %v", err)
+		}
+		events.Emit("file_generated", map[string]any{"path": irPath, "bytes": len(ir)})
+		outputBinary = irPath
+		finish("", true)
+		return
+	}
+
+	// The C code of the program is kept in this file rather than a temporary one.
+	keptCPath := *emitC
+	if keptCPath == "" && *keepC {
+		keptCPath = strings.TrimSuffix(outputBinary, ".exe") + ".c"
+	}
+
+	if *emitLib != "" {
+		phaseStart = time.Now()
+		code, header := render.RenderLibrary(program, baseDir, cleanedName)
+		cCode := preprocessor.InsertMacros(code)
+		checkRender()
+		linkStdModuleLibraries()
+		openMP = !*noOpenMP && usesOpenMP(cCode)
+		events.Phase("render", phaseStart)
+
+		library := filepath.Join(filepath.Dir(outputBinary), libraryFileName(cleanedName, *emitLib))
+		if *output != "" {
+			library = *output
+		}
+		headerPath := filepath.Join(filepath.Dir(library), cleanedName+".h")
+		if err := writeFile(headerPath, header); err != nil {
+			log.Fatalf("Failed to write header: %v", err)
+		}
+		events.Emit("file_generated", map[string]any{"path": headerPath, "bytes": len(header)})
+
+		cPath := keptCPath
+		if cPath == "" {
+			tmpDir, err := os.MkdirTemp("", "scar-lib-*")
+			if err != nil {
+				log.Fatalf("Failed to create temp directory: %v", err)
+			}
+			defer os.RemoveAll(tmpDir)
+			cPath = filepath.Join(tmpDir, cleanedName+".c")
+		}
+		if err := writeFile(cPath, cCode); err != nil {
+			log.Fatalf("Failed to write C code: %v", err)
+		}
+		phaseStart = time.Now()
+		err := buildLibrary(events, cPath, *emitLib, library)
+		events.Phase("cc", phaseStart)
+		outputBinary = library
+		if err != nil {
+			log.Print(err)
+			if keptCPath == "" {
+				os.RemoveAll(filepath.Dir(cPath))
+			}
+		}
+		finish(cCode, err == nil)
+		return
+	}
+
+	// Programs importing modules are compiled module by module, unless the
+	// generated code is shown or kept, or allocations are tracked across all
+	// of it.
+	if len(program.Imports) > 0 && !*asm && !*c && keptCPath == "" && !*leakCheck {
+		phaseStart = time.Now()
+		units := render.RenderUnits(program, baseDir)
+		checkRender()
+		linkStdModuleLibraries()
+		for _, module := range lexer.LoadedModules {
+			events.Emit("module_loaded", map[string]any{"module": module.Name, "path": module.FilePath})
+			logging.Verbosef("loaded module %s from %s", module.Name, module.FilePath)
+		}
+		events.Phase("render", phaseStart)
+
+		phaseStart = time.Now()
+		cCode, err := buildUnits(events, units, filepath.Join(baseDir, cacheDirName), cleanedName, outputBinary, *noOpenMP)
+		events.Phase("cc", phaseStart)
+		if err != nil {
+			log.Print(err)
+		}
+		finish(cCode, err == nil)
+		return
+	}
 
-	cCode := preprocessor.InsertMacros(renderer.RenderC(program, baseDir))
+	phaseStart = time.Now()
+	cCode := preprocessor.InsertMacros(render.RenderC(program, baseDir))
+	checkRender()
+	linkStdModuleLibraries()
+	if *leakCheck {
+		cCode = preprocessor.InsertLeakCheck(cCode)
+	}
+	for _, module := range lexer.LoadedModules {
+		events.Emit("module_loaded", map[string]any{"module": module.Name, "path": module.FilePath})
+		logging.Verbosef("loaded module %s from %s", module.Name, module.FilePath)
+	}
+	events.Phase("render", phaseStart)
+	openMP = !*noOpenMP && usesOpenMP(cCode)
 
 	if *asm {
-		cplr := "clang"
-		if runtime.GOOS == "windows" {
-			cplr = "gcc"
+		cc, cflags, _, err := toolchain()
+		if err != nil {
+			log.Fatal(err)
 		}
-		cmd := exec.Command(cplr, "-w", "-S", "-x", "c", "-o", "-", "-")
+		cmd := exec.Command(cc, append(cflags, "-w", "-S", "-x", "c", "-o", "-", "-")...)
 		cmd.Stdin = strings.NewReader(cCode)
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = os.Stderr
@@ -85,59 +507,128 @@ func main() {
 	}
 
 	if *c {
+		if cPath := cOutputPath(*output, *outDir, cleanedName); cPath != "" {
+			if err := writeFile(cPath, cCode); err != nil {
+				log.Fatalf("Failed to write C code: %v", err)
+			}
+			events.Emit("file_generated", map[string]any{"path": cPath, "bytes": len(cCode)})
+			return
+		}
 		fmt.Println(cCode)
 		return
 	}
 
-	tmpCPath := cleanedName + ".c"
-	err = os.WriteFile(tmpCPath, []byte(cCode), 0644)
+	var cPath string
+	if keptCPath != "" {
+		cPath = keptCPath
+		if err := writeFile(cPath, cCode); err != nil {
+			log.Fatalf("Failed to write C code: %v", err)
+		}
+	} else {
+		tmpCFile, err := os.CreateTemp("", cleanedName+"-*.c")
+		if err != nil {
+			log.Fatalf("Failed to create temp file: %v", err)
+		}
+		cPath = tmpCFile.Name()
+		defer os.Remove(cPath)
+
+		_, err = tmpCFile.WriteString(cCode)
+		if closeErr := tmpCFile.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(cPath)
+			log.Fatalf("Failed to write temp file: %v", err)
+		}
+	}
+	events.Emit("file_generated", map[string]any{"path": cPath, "bytes": len(cCode)})
+
+	cc, cflags, ldflags, err := toolchain()
 	if err != nil {
-		log.Fatalf("Failed to write temp file: %v", err)
+		events.Emit("error", map[string]any{"phase": "cc", "message": err.Error()})
+		log.Fatal(err)
 	}
-	defer os.Remove(tmpCPath)
+	compileArgs := append(append(append(cflags, cPath), ldflags...), "-o", outputBinary)
 
+	phaseStart = time.Now()
+	err = runCompiler(events, cc, compileArgs)
+	events.Phase("cc", phaseStart)
+
+	if err != nil && keptCPath == "" {
+		// log.Fatal skips deferred calls, so the temp file is removed explicitly.
+		os.Remove(cPath)
+	}
+	finish(cCode, err == nil)
+}
+
+// Whether diagnostics are printed as JSON lines for editors and CI to read,
+// instead of being formatted for people.
+var jsonDiagnostics bool
+
+// Prints the errors of a compilation phase as diagnostics of the program in
+// file, in source order and without duplicates, showing the source lines they
+// refer to. Colors are left out when the NO_COLOR environment variable is set.
+// The code of a diagnostic is the phase, parse or check, as the errors of the
+// compiler carry no finer codes.
+func reportDiagnostics(events *buildlog.Logger, phase string, errs []error, file, source string) {
 	var (
-		outputBinary = "./" + cleanedName
-		cmpPath      = "clang"
-		compileArgs  = []string{"-w", "-fopenmp", tmpCPath, "-o", outputBinary}
+		color = os.Getenv("NO_COLOR") == ""
+		seen  = make(map[string]bool)
+		diags []*diagnostics.Diagnostic
 	)
-	switch runtime.GOOS {
-	case "darwin":
-		cmpPath = "/opt/homebrew/opt/llvm/bin/clang"
-		compileArgs = []string{
-			"-w",
-			"-fopenmp",
-			tmpCPath,
-			"-I/opt/homebrew/opt/libomp/include",
-			"-L/opt/homebrew/opt/libomp/lib",
-			"-o", outputBinary,
-		}
-	case "linux":
-		compileArgs = []string{
-			"-fopenmp",
-			tmpCPath,
-			"-o", outputBinary,
-		}
-	case "windows":
-		cmpPath = "gcc"
-		outputBinary += ".exe"
-		compileArgs = []string{
-			"-fopenmp",
-			"-w",
-			tmpCPath,
-			"-o", outputBinary,
-		}
-	}
-
-	cmd := exec.Command(cmpPath, compileArgs...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	err = cmd.Run()
-	success := false
-
-	if err == nil {
-		fmt.Printf("Compiled %s\n", outputBinary)
-		success = true
+	for _, err := range errs {
+		for _, err := range diagnostics.Split(err) {
+			if d := diagnostics.FromError(err, file); !seen[d.Error()] {
+				seen[d.Error()] = true
+				diags = append(diags, d)
+			}
+		}
+	}
+	// The diagnostics of the program come before those of its modules.
+	inModule := func(d *diagnostics.Diagnostic) int {
+		if d.File == file {
+			return 0
+		}
+		return 1
+	}
+	slices.SortStableFunc(diags, func(a, b *diagnostics.Diagnostic) int {
+		return cmp.Or(cmp.Compare(inModule(a), inModule(b)), strings.Compare(a.File, b.File), cmp.Compare(a.Line, b.Line))
+	})
+	wd, _ := os.Getwd()
+	for _, d := range diags {
+		text := source
+		if d.File != file {
+			data, _ := os.ReadFile(d.File)
+			text = string(data)
+		}
+		d.Locate(text)
+		if d.Code == "" {
+			d.Code = phase
+		}
+		events.Emit("error", map[string]any{"phase": phase, "message": d.Message, "file": d.File, "line": d.Line, "column": d.Column})
+		if rel, err := filepath.Rel(wd, d.File); err == nil && !strings.HasPrefix(rel, "..") {
+			d.File = rel
+		}
+		if jsonDiagnostics {
+			json.NewEncoder(os.Stderr).Encode(d)
+			continue
+		}
+		fmt.Fprint(os.Stderr, d.Format(text, color))
+	}
+}
+
+// Reports the outcome of a build, exiting when it failed. The binary of scar
+// run is not reported, since it is only there to be run.
+func finishBuild(events *buildlog.Logger, program *lexer.Program, cCode, outputBinary string, showStats, success, quiet bool) {
+	if success && !quiet {
+		logging.Infof("Compiled %s", outputBinary)
+	}
+	events.Emit("build_finished", map[string]any{"success": success, "output": outputBinary})
+
+	if showStats && success {
+		stats := meta.CollectStats(program, lexer.LoadedModules, cCode)
+		stats.SetBinary(outputBinary)
+		stats.Print(os.Stdout)
 	}
 
 	if !success {
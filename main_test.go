@@ -3,7 +3,9 @@ package main
 import (
 	"os"
 	"path/filepath"
+	"scar/checker"
 	"scar/lexer"
+	"scar/preprocessor"
 	"scar/renderer"
 	"strings"
 	"testing"
@@ -19,10 +21,10 @@ while 1:
 int main(int argc, char** argv) {
 	__global_argc = argc;
 	__global_argv = argv;
-	printf("This will print forever: \n");
+	fputs("This will print forever: \n", stdout);
 	sleep(3);
 	while (1) {
-		printf("Hello\n");
+		fputs("Hello\n", stdout);
 	}
 	return 0;
 }
@@ -56,42 +58,22 @@ print "done..."`
 	expected := `#include <stdio.h>
 #include <string.h>
 #include <unistd.h>
-#include <omp.h>
 #include <stdlib.h>
 #include <stdbool.h>
 #include <stdint.h>
 
-int _exception = 0;
 int __global_argc = 0;
 char** __global_argv = NULL;
 
-bool __check_string_key_exists(char keys[][256], int size, char* key) {
-	for (int i = 0; i < size; i++) {
-		if (strcmp(keys[i], key) == 0) {
-			return true;
-		}
-	}
-	return false;
-}
-
-bool __check_key_exists(int* keys, int size, int key) {
-	for (int i = 0; i < size; i++) {
-		if (keys[i] == key) {
-			return true;
-		}
-	}
-	return false;
-}
-
 int main(int argc, char** argv) {
 	__global_argc = argc;
 	__global_argv = argv;
-    printf("start...\n");
+    fputs("start...\n", stdout);
     for (int i = 0; i <= 3; i++) {
-        printf("looping\n");
+        fputs("looping\n", stdout);
         sleep(1);
     }
-    printf("done...\n");
+    fputs("done...\n", stdout);
     return 0;
 }
 `
@@ -123,46 +105,26 @@ print "All done"`
 	expected := `#include <stdio.h>
 #include <string.h>
 #include <unistd.h>
-#include <omp.h>
 #include <stdlib.h>
 #include <stdbool.h>
 #include <stdint.h>
 
-int _exception = 0;
 int __global_argc = 0;
 char** __global_argv = NULL;
 
-bool __check_string_key_exists(char keys[][256], int size, char* key) {
-	for (int i = 0; i < size; i++) {
-		if (strcmp(keys[i], key) == 0) {
-			return true;
-		}
-	}
-	return false;
-}
-
-bool __check_key_exists(int* keys, int size, int key) {
-	for (int i = 0; i < size; i++) {
-		if (keys[i] == key) {
-			return true;
-		}
-	}
-	return false;
-}
-
 int main(int argc, char** argv) {
 	__global_argc = argc;
 	__global_argv = argv;
-    printf("Starting nested test\n");
+    fputs("Starting nested test\n", stdout);
     for (int i = 1; i <= 2; i++) {
-        printf("Outer loop\n");
+        fputs("Outer loop\n", stdout);
         while (1) {
-            printf("Inner while\n");
+            fputs("Inner while\n", stdout);
             sleep(1);
         }
-        printf("After while\n");
+        fputs("After while\n", stdout);
     }
-    printf("All done\n");
+    fputs("All done\n", stdout);
     return 0;
 }
 `
@@ -293,6 +255,108 @@ func TestCompileAllTestFiles(t *testing.T) {
 	}
 }
 
+func TestModuleClassParameters(t *testing.T) {
+	dir := t.TempDir()
+	module := `pub class Point:
+    init(int x):
+        int this.x = x
+
+    fn get() -> int:
+        return this.x
+`
+	if err := os.WriteFile(filepath.Join(dir, "geometry.scar"), []byte(module), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, paramType := range []string{"geometry::Point", "geometry.Point"} {
+		t.Run(paramType, func(t *testing.T) {
+			src := `import geometry
+
+fn show(` + paramType + ` p) -> void:
+    print "{p.get()}"
+
+geometry::Point q = new geometry::Point(3)
+show(q)
+`
+			program, err := lexer.ParseWithIndentation(preprocessor.ProcessSourceLevelMacros(src))
+			if err != nil {
+				t.Fatalf("Failed to parse: %v", err)
+			}
+			for _, imp := range program.Imports {
+				if _, err := lexer.LoadModule(imp.Module, dir); err != nil {
+					t.Fatalf("Failed to load module %s: %v", imp.Module, err)
+				}
+			}
+			if errs := checker.New().Check(program); len(errs) > 0 {
+				t.Fatalf("Unexpected check errors: %v", errs)
+			}
+
+			output := renderer.RenderC(program, dir)
+			for _, expected := range []string{
+				"void show(geometry_Point* p) {",
+				"geometry_Point* q = geometry_Point_new(3);",
+				"show(q);",
+			} {
+				if !strings.Contains(output, expected) {
+					t.Errorf("Expected C code to contain '%s', but it didn't:\n%s", expected, output)
+				}
+			}
+		})
+	}
+}
+
+func TestModuleFunctionCalls(t *testing.T) {
+	dir := t.TempDir()
+	module := `pub fn twice(int x) -> int:
+    return x * 2
+`
+	if err := os.WriteFile(filepath.Join(dir, "geo.scar"), []byte(module), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	src := `import geo as g
+
+fn quad(int x) -> int:
+    return g.twice(g.twice(x))
+
+int a = g.twice(2)
+int b = geo.twice(3)
+a = g.twice(b)
+g.twice(5)
+print "{g.twice(4)} {quad(a)}"
+`
+	program, err := lexer.ParseWithIndentation(preprocessor.ProcessSourceLevelMacros(src))
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	for _, imp := range program.Imports {
+		if _, err := lexer.LoadModule(imp.Module, dir); err != nil {
+			t.Fatalf("Failed to load module %s: %v", imp.Module, err)
+		}
+	}
+	if errs := checker.New().Check(program); len(errs) > 0 {
+		t.Fatalf("Unexpected check errors: %v", errs)
+	}
+
+	render := renderer.NewRenderer(renderer.Options{})
+	output := render.RenderC(program, dir)
+	if errs := render.Errors(); len(errs) > 0 {
+		t.Fatalf("Unexpected render errors: %v", errs)
+	}
+	for _, expected := range []string{
+		"return geo_twice(geo_twice(x));",
+		"int a = geo_twice(2);",
+		"int b = geo_twice(3);",
+		"a = geo_twice(b);",
+		"geo_twice(5);",
+		`printf("%d %d\n", geo_twice(4), quad(a));`,
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected C code to contain '%s', but it didn't:\n%s", expected, output)
+		}
+	}
+}
+
 func normalizeWhitespace(s string) string {
 	lines := strings.Split(s, "\n")
 	var normalized []string
@@ -0,0 +1,124 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains the lockfile recording the versions of fetched dependencies.
+//
+// A dependency whose source is a git repository rather than a directory is
+// fetched into deps/<name> by scar get and scar vendor, which record the
+// commit they checked out in scar.lock, one dependency per line:
+//
+//	geo https://github.com/someone/geo.git 3f2a9c...
+//
+// scar vendor checks out the recorded commits again, so every checkout of a
+// project builds against the same versions of its dependencies.
+
+package manifest
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const (
+	LockFileName = "scar.lock"
+	// The directory fetched dependencies are kept in.
+	DepsDirName = "deps"
+)
+
+type LockedDependency struct {
+	Name    string
+	Source  string
+	Version string
+}
+
+// Reports whether the source of a dependency is a git repository to fetch
+// rather than a directory of the project. A source starting with - would be
+// read by git as an option, so it is never one.
+func IsRemote(source string) bool {
+	if strings.HasPrefix(source, "-") {
+		return false
+	}
+	return strings.Contains(source, "://") || strings.HasPrefix(source, "git@") || strings.HasSuffix(source, ".git")
+}
+
+// Reports whether a version is a commit hash, the only versions the lockfile
+// records.
+func isCommit(version string) bool {
+	return version != "" && strings.Trim(version, "0123456789abcdef") == ""
+}
+
+// Returns the name a dependency fetched from a repository gets by default,
+// which is the last element of its path.
+func DependencyName(source string) string {
+	source = strings.TrimRight(strings.TrimSuffix(strings.TrimRight(source, "/"), ".git"), "/")
+	if i := strings.LastIndexAny(source, "/:"); i >= 0 {
+		source = source[i+1:]
+	}
+	return source
+}
+
+// Reads the lockfile of the project in dir. A project without one has no
+// locked dependencies.
+func ReadLock(dir string) (map[string]LockedDependency, error) {
+	locked := make(map[string]LockedDependency)
+	data, err := os.ReadFile(filepath.Join(dir, LockFileName))
+	if os.IsNotExist(err) {
+		return locked, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("%s:%d: expected name, source and version", LockFileName, i+1)
+		}
+		if !isCommit(fields[2]) {
+			return nil, fmt.Errorf("%s:%d: '%s' is not a commit", LockFileName, i+1, fields[2])
+		}
+		locked[fields[0]] = LockedDependency{Name: fields[0], Source: fields[1], Version: fields[2]}
+	}
+	return locked, nil
+}
+
+// Writes the lockfile of the project in dir, sorted by dependency name.
+func WriteLock(dir string, locked map[string]LockedDependency) error {
+	var b strings.Builder
+	b.WriteString("# Generated by scar get and scar vendor, do not edit.\n")
+	for _, name := range slices.Sorted(maps.Keys(locked)) {
+		dep := locked[name]
+		fmt.Fprintf(&b, "%s %s %s\n", dep.Name, dep.Source, dep.Version)
+	}
+	return os.WriteFile(filepath.Join(dir, LockFileName), []byte(b.String()), 0o644)
+}
+
+// Adds a dependency to the manifest of the project in dir. The dependencies
+// table is the only table of a manifest, so it always comes last.
+func AddDependency(dir, name, source string) error {
+	path := filepath.Join(dir, FileName)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("could not read %s: %v", FileName, err)
+	}
+	src := string(data)
+	if m, err := Parse(src); err == nil && m.Dependencies[name] != "" {
+		return fmt.Errorf("%s already has a dependency named '%s'", FileName, name)
+	}
+	if !strings.HasSuffix(src, "\n") && src != "" {
+		src += "\n"
+	}
+	if !strings.Contains(src, "[dependencies]") {
+		src += "\n[dependencies]\n"
+	}
+	src += fmt.Sprintf("%s = %q\n", name, source)
+	return os.WriteFile(path, []byte(src), 0o644)
+}
@@ -0,0 +1,77 @@
+package manifest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDependencyName(t *testing.T) {
+	tests := map[string]string{
+		"https://github.com/someone/geo.git": "geo",
+		"https://github.com/someone/geo/":    "geo",
+		"git@github.com:someone/json.git":    "json",
+		"file:///tmp/repos/util/.git":        "util",
+	}
+	for source, expected := range tests {
+		if name := DependencyName(source); name != expected {
+			t.Errorf("DependencyName(%q) = %q, expected %q", source, name, expected)
+		}
+	}
+	if IsRemote("libs/geo") || IsRemote("--upload-pack=touch x.git") || !IsRemote("git@github.com:someone/json.git") {
+		t.Error("expected only repository urls to be remote")
+	}
+}
+
+func TestLockRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	locked, err := ReadLock(dir)
+	if err != nil || len(locked) != 0 {
+		t.Fatalf("expected a project without a lockfile to have no locked dependencies, got %v %v", locked, err)
+	}
+	locked["geo"] = LockedDependency{Name: "geo", Source: "https://example.com/geo.git", Version: "3f2a9c"}
+	if err := WriteLock(dir, locked); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadLock(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read["geo"] != locked["geo"] {
+		t.Errorf("expected %+v, got %+v", locked["geo"], read["geo"])
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, LockFileName), []byte("geo https://example.com/geo.git --orphan=x\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadLock(dir); err == nil || err.Error() != "scar.lock:1: '--orphan=x' is not a commit" {
+		t.Errorf("expected a version that is not a commit to be rejected, got %v", err)
+	}
+}
+
+func TestAddDependency(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, FileName), []byte(`entry = "main.scar"`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddDependency(dir, "geo", "https://example.com/geo.git"); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddDependency(dir, "util", "libs/util"); err != nil {
+		t.Fatal(err)
+	}
+	m, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Dependencies["geo"] != "https://example.com/geo.git" || m.Dependencies["util"] != "libs/util" {
+		t.Errorf("unexpected dependencies %v", m.Dependencies)
+	}
+	dirs := m.DependencyDirs()
+	if len(dirs) != 2 || dirs[0] != filepath.Join(dir, "deps", "geo") || dirs[1] != filepath.Join(dir, "libs", "util") {
+		t.Errorf("unexpected dependency directories %v", dirs)
+	}
+	if err := AddDependency(dir, "geo", "https://example.com/other.git"); err == nil {
+		t.Error("expected adding a dependency twice to fail")
+	}
+}
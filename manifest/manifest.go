@@ -0,0 +1,196 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains the project manifest read by scar build.
+//
+// A project is described by a scar.toml at its root:
+//
+//	name = "shapes"
+//	entry = "src/main.scar"
+//	output = "bin/shapes"
+//	cflags = ["-O2"]
+//	ldflags = ["-lm"]
+//
+//	[dependencies]
+//	geo = "libs/geo"
+//	json = "https://github.com/someone/json.git"
+//
+// Only the subset of TOML a manifest needs is understood: comments, string
+// values, arrays of strings and the dependencies table, whose entries name
+// the directories modules are looked up in or the git repositories fetched
+// into deps/ by scar get and scar vendor.
+
+package manifest
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// The name of the manifest file.
+const FileName = "scar.toml"
+
+type Manifest struct {
+	// The directory holding the manifest, which relative paths start from.
+	Dir          string
+	Name         string
+	Entry        string
+	Output       string
+	CFlags       []string
+	LDFlags      []string
+	Dependencies map[string]string
+}
+
+// Reads the manifest of the project in dir.
+func Load(dir string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, FileName))
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s: %v", FileName, err)
+	}
+	m, err := Parse(string(data))
+	if err != nil {
+		return nil, err
+	}
+	m.Dir = dir
+	if m.Name == "" {
+		m.Name = filepath.Base(dir)
+	}
+	if m.Output == "" {
+		m.Output = m.Name
+	}
+	return m, nil
+}
+
+// Parses the content of a manifest.
+func Parse(src string) (*Manifest, error) {
+	var (
+		m     = &Manifest{Dependencies: make(map[string]string)}
+		table = ""
+	)
+	for i, line := range strings.Split(src, "\n") {
+		line = strings.TrimSpace(stripComment(line))
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			table = strings.TrimSpace(strings.Trim(line, "[]"))
+			if table != "dependencies" {
+				return nil, fmt.Errorf("%s:%d: unknown table '%s'", FileName, i+1, table)
+			}
+			continue
+		}
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			return nil, fmt.Errorf("%s:%d: expected key = value", FileName, i+1)
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if err := m.set(table, key, value); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", FileName, i+1, err)
+		}
+	}
+	if m.Entry == "" {
+		return nil, fmt.Errorf("%s: missing entry", FileName)
+	}
+	return m, nil
+}
+
+func (m *Manifest) set(table, key, value string) error {
+	if table == "dependencies" {
+		path, err := parseString(value)
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(path, "-") {
+			return fmt.Errorf("the source of dependency '%s' must not start with '-'", key)
+		}
+		m.Dependencies[key] = path
+		return nil
+	}
+	var err error
+	switch key {
+	case "name":
+		m.Name, err = parseString(value)
+	case "entry":
+		m.Entry, err = parseString(value)
+	case "output":
+		m.Output, err = parseString(value)
+	case "cflags":
+		m.CFlags, err = parseStringArray(value)
+	case "ldflags":
+		m.LDFlags, err = parseStringArray(value)
+	default:
+		err = fmt.Errorf("unknown key '%s'", key)
+	}
+	return err
+}
+
+// Returns the path of the entry point without its .scar extension, which is
+// how the compiler names the program it builds.
+func (m *Manifest) EntryPath() string {
+	return strings.TrimSuffix(filepath.Join(m.Dir, m.Entry), ".scar")
+}
+
+func (m *Manifest) OutputPath() string {
+	return filepath.Join(m.Dir, m.Output)
+}
+
+// Returns the directories of the dependencies, sorted by name. Those fetched
+// from a repository live in deps/<name>.
+func (m *Manifest) DependencyDirs() []string {
+	var dirs []string
+	for _, name := range slices.Sorted(maps.Keys(m.Dependencies)) {
+		if source := m.Dependencies[name]; IsRemote(source) {
+			dirs = append(dirs, filepath.Join(m.Dir, DepsDirName, name))
+		} else {
+			dirs = append(dirs, filepath.Join(m.Dir, source))
+		}
+	}
+	return dirs
+}
+
+// Removes a # comment outside of strings.
+func stripComment(line string) string {
+	inString := false
+	for i, ch := range line {
+		switch {
+		case ch == '"' && (i == 0 || line[i-1] != '\\'):
+			inString = !inString
+		case ch == '#' && !inString:
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func parseString(value string) (string, error) {
+	s, err := strconv.Unquote(value)
+	if err != nil || !strings.HasPrefix(value, "\"") {
+		return "", fmt.Errorf("expected a string, got %s", value)
+	}
+	return s, nil
+}
+
+func parseStringArray(value string) ([]string, error) {
+	if !strings.HasPrefix(value, "[") || !strings.HasSuffix(value, "]") {
+		return nil, fmt.Errorf("expected an array of strings, got %s", value)
+	}
+	var items []string
+	for item := range strings.SplitSeq(value[1:len(value)-1], ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		s, err := parseString(item)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, s)
+	}
+	return items, nil
+}
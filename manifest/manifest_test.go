@@ -0,0 +1,71 @@
+package manifest
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	m, err := Parse(`# the shapes project
+name = "shapes"
+entry = "src/main.scar"
+cflags = ["-O2", "-DNDEBUG"] # optimised
+ldflags = []
+
+[dependencies]
+geo = "libs/geo"
+`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if m.Name != "shapes" || m.Entry != "src/main.scar" || m.Output != "" {
+		t.Errorf("unexpected manifest %+v", m)
+	}
+	if strings.Join(m.CFlags, " ") != "-O2 -DNDEBUG" || len(m.LDFlags) != 0 {
+		t.Errorf("unexpected flags %v %v", m.CFlags, m.LDFlags)
+	}
+	if m.Dependencies["geo"] != "libs/geo" {
+		t.Errorf("unexpected dependencies %v", m.Dependencies)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := map[string]string{
+		`name = "x"`:                      "scar.toml: missing entry",
+		"entry = \"a\"\nversion = \"1\"":  "scar.toml:2: unknown key 'version'",
+		"entry = main":                    "scar.toml:1: expected a string, got main",
+		"entry = \"a\"\ncflags = \"-O2\"": "scar.toml:2: expected an array of strings, got \"-O2\"",
+		"entry = \"a\"\n[package]":        "scar.toml:2: unknown table 'package'",
+		"entry":                           "scar.toml:1: expected key = value",
+		"entry = \"a\"\n[dependencies]\ngeo = \"--upload-pack=x.git\"": "scar.toml:3: the source of dependency 'geo' must not start with '-'",
+	}
+	for src, expected := range tests {
+		if _, err := Parse(src); err == nil || err.Error() != expected {
+			t.Errorf("Parse(%q): expected error %q, got %v", src, expected, err)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	src := "entry = \"src/main.scar\"\n\n[dependencies]\nutil = \"vendor/util\"\ngeo = \"libs/geo\"\n"
+	if err := os.WriteFile(filepath.Join(dir, FileName), []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if m.Name != filepath.Base(dir) || m.OutputPath() != filepath.Join(dir, m.Name) {
+		t.Errorf("expected name and output to default to the directory, got %q and %q", m.Name, m.OutputPath())
+	}
+	if m.EntryPath() != filepath.Join(dir, "src", "main") {
+		t.Errorf("unexpected entry path %q", m.EntryPath())
+	}
+	dirs := m.DependencyDirs()
+	if len(dirs) != 2 || dirs[0] != filepath.Join(dir, "libs/geo") || dirs[1] != filepath.Join(dir, "vendor/util") {
+		t.Errorf("unexpected dependency directories %v", dirs)
+	}
+}
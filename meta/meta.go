@@ -14,7 +14,18 @@ import (
 const Version = "v0.0.1"
 
 func ShowUsage() {
-	fmt.Println("Usage: scar [-asm | -c] [program]")
+	fmt.Println("Usage: scar [-asm | -c] [-o path | -outdir dir] [-keep-c | -emit-c=file] [-cc=compiler] [-cflags=flags] [-ldflags=flags] [-link=library] [-target=os/arch] [-O0|-O1|-O2|-O3|-Os] [-g | -debug] [-release] [-quiet | -verbose | -trace] [-log=json] [-json-diagnostics] [-stats] [-leak-check] [-bounds-check] [-safe] [-no-openmp] [-emit-lib=static|shared] [-emit=c|llvm] [-mem=manual|rc|arena] [-lang-version=X.Y] [program]")
+	fmt.Println("       scar build [flags] [project directory]    build the project described by its scar.toml")
+	fmt.Println("       scar run [flags] <program> [-- args]      build a program in a temp directory and run it")
+	fmt.Println("       scar check [flags] <program>              report the errors of a program without compiling it")
+	fmt.Println("       scar watch [-run] [flags] <program>       rebuild, or rebuild and run, a program whenever its files change")
+	fmt.Println("       scar test [flags] [paths]                  build and run the *_test.scar files under the paths")
+	fmt.Println("       scar bench [flags] [paths]                 run the bench blocks of the *_test.scar files")
+	fmt.Println("       scar fmt [-check] [paths]                  format the scar files under the paths in place")
+	fmt.Println("       scar doc [-html] [-outdir dir] [paths]     write the documentation of the modules under the paths")
+	fmt.Println("       scar lsp                                   run the language server over stdin and stdout")
+	fmt.Println("       scar get <git-url>                         fetch a module repository into deps/")
+	fmt.Println("       scar vendor                                fetch the dependencies locked in scar.lock")
 	flag.PrintDefaults()
 	fmt.Printf("\nScar %v - By Navid M (c) 2025", Version)
 }
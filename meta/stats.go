@@ -0,0 +1,89 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains build statistics collection and reporting for the --stats flag.
+
+package meta
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"scar/lexer"
+	"strings"
+)
+
+type BuildStats struct {
+	Modules    int
+	Classes    int
+	Functions  int
+	Methods    int
+	CLines     int
+	BinarySize int64
+}
+
+// Collects declaration counts from the program, its loaded modules and the generated C.
+func CollectStats(program *lexer.Program, modules map[string]*lexer.ModuleInfo, cCode string) *BuildStats {
+	stats := &BuildStats{Modules: len(modules)}
+
+	for _, stmt := range program.Statements {
+		switch {
+		case stmt.ClassDecl != nil:
+			stats.Classes++
+			stats.Methods += len(stmt.ClassDecl.Methods)
+		case stmt.PubClassDecl != nil:
+			stats.Classes++
+			stats.Methods += len(stmt.PubClassDecl.Methods)
+		case stmt.TopLevelFuncDecl != nil, stmt.PubTopLevelFuncDecl != nil:
+			stats.Functions++
+		}
+	}
+
+	for _, module := range modules {
+		stats.Classes += len(module.PublicClasses)
+		stats.Functions += len(module.PublicFuncs)
+		for _, class := range module.PublicClasses {
+			stats.Methods += len(class.Methods)
+		}
+	}
+
+	if cCode != "" {
+		stats.CLines = strings.Count(cCode, "\n")
+		if !strings.HasSuffix(cCode, "\n") {
+			stats.CLines++
+		}
+	}
+
+	return stats
+}
+
+// Records the size of the linked binary, leaving it at zero if the file is missing.
+func (s *BuildStats) SetBinary(path string) {
+	if info, err := os.Stat(path); err == nil {
+		s.BinarySize = info.Size()
+	}
+}
+
+// Writes the statistics report.
+func (s *BuildStats) Print(w io.Writer) {
+	fmt.Fprintln(w, "Build statistics:")
+	fmt.Fprintf(w, "  modules:     %d\n", s.Modules)
+	fmt.Fprintf(w, "  classes:     %d\n", s.Classes)
+	fmt.Fprintf(w, "  functions:   %d\n", s.Functions)
+	fmt.Fprintf(w, "  methods:     %d\n", s.Methods)
+	fmt.Fprintf(w, "  C lines:     %d\n", s.CLines)
+	if s.BinarySize > 0 {
+		fmt.Fprintf(w, "  binary size: %s\n", formatBytes(s.BinarySize))
+	}
+}
+
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MiB (%d bytes)", float64(n)/(1<<20), n)
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KiB (%d bytes)", float64(n)/(1<<10), n)
+	}
+	return fmt.Sprintf("%d bytes", n)
+}
@@ -0,0 +1,48 @@
+package meta
+
+import (
+	"scar/lexer"
+	"strings"
+	"testing"
+)
+
+func TestCollectStats(t *testing.T) {
+	input := `
+class Dog:
+    init(string name):
+        this.name = name
+
+    fn bark():
+        print "woof"
+
+fn add(int a, int b) -> int:
+    return a + b
+`
+	program, err := lexer.ParseWithIndentation(input)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+
+	stats := CollectStats(program, nil, "int main() {\n    return 0;\n}\n")
+	if stats.Classes != 1 {
+		t.Errorf("expected 1 class, got %d", stats.Classes)
+	}
+	if stats.Functions != 1 {
+		t.Errorf("expected 1 function, got %d", stats.Functions)
+	}
+	if stats.Methods != 1 {
+		t.Errorf("expected 1 method, got %d", stats.Methods)
+	}
+	if stats.CLines != 3 {
+		t.Errorf("expected 3 C lines, got %d", stats.CLines)
+	}
+
+	var out strings.Builder
+	stats.Print(&out)
+	if !strings.Contains(out.String(), "classes:     1") {
+		t.Errorf("expected report to list classes, got:\n%s", out.String())
+	}
+	if strings.Contains(out.String(), "binary size") {
+		t.Errorf("expected no binary size before linking, got:\n%s", out.String())
+	}
+}
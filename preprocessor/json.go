@@ -0,0 +1,363 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains the JSON document runtime used by std/json.
+
+package preprocessor
+
+// Inserts the JSON document runtime: a recursive descent parser building a
+// tree of nodes, dotted path lookup for reads and writes, and a serializer
+// returning a heap string.
+func insertJSONRuntime(output string) string {
+	return jsonRuntime + "\n" + output
+}
+
+const jsonRuntime = `#include <ctype.h>
+#include <math.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+enum { __SCAR_JSON_NULL, __SCAR_JSON_BOOL, __SCAR_JSON_NUMBER, __SCAR_JSON_STRING, __SCAR_JSON_LIST, __SCAR_JSON_OBJECT };
+typedef struct __scar_json {
+    int type;
+    double number;
+    char* string;
+    struct __scar_json** items;
+    char** keys;
+    int count, cap;
+} __scar_json;
+typedef struct { char* data; size_t len, cap; } __scar_json_buf;
+static void __scar_json_write(__scar_json_buf* b, const char* s, size_t n) {
+    if (b->len + n + 1 > b->cap) {
+        size_t cap = b->cap ? b->cap : 64;
+        while (b->len + n + 1 > cap) cap *= 2;
+        char* data = realloc(b->data, cap);
+        if (!data) return;
+        b->data = data; b->cap = cap;
+    }
+    memcpy(b->data + b->len, s, n);
+    b->len += n;
+    b->data[b->len] = '\0';
+}
+static __scar_json* __scar_json_new(int type) {
+    __scar_json* node = calloc(1, sizeof(__scar_json));
+    if (node) node->type = type;
+    return node;
+}
+static void __scar_json_free(__scar_json* node);
+static void __scar_json_clear(__scar_json* node) {
+    for (int i = 0; i < node->count; i++) {
+        __scar_json_free(node->items[i]);
+        if (node->keys) free(node->keys[i]);
+    }
+    free(node->items); free(node->keys); free(node->string);
+    memset(node, 0, sizeof(__scar_json));
+}
+static void __scar_json_free(__scar_json* node) {
+    if (!node) return;
+    __scar_json_clear(node);
+    free(node);
+}
+static int __scar_json_add(__scar_json* node, char* key, __scar_json* item) {
+    if (node->count == node->cap) {
+        int cap = node->cap ? node->cap * 2 : 4;
+        __scar_json** items = realloc(node->items, cap * sizeof(__scar_json*));
+        if (!items) return 0;
+        node->items = items;
+        if (node->type == __SCAR_JSON_OBJECT) {
+            char** keys = realloc(node->keys, cap * sizeof(char*));
+            if (!keys) return 0;
+            node->keys = keys;
+        }
+        node->cap = cap;
+    }
+    if (node->type == __SCAR_JSON_OBJECT) node->keys[node->count] = key;
+    node->items[node->count++] = item;
+    return 1;
+}
+static void __scar_json_skip(const char** s) {
+    while (isspace((unsigned char)**s)) (*s)++;
+}
+static int __scar_json_hex(const char** s, unsigned* out) {
+    *out = 0;
+    for (int i = 0; i < 4; i++) {
+        char c = *(*s)++;
+        *out <<= 4;
+        if (c >= '0' && c <= '9') *out |= c - '0';
+        else if (c >= 'a' && c <= 'f') *out |= c - 'a' + 10;
+        else if (c >= 'A' && c <= 'F') *out |= c - 'A' + 10;
+        else return 0;
+    }
+    return 1;
+}
+static void __scar_json_utf8(__scar_json_buf* b, unsigned cp) {
+    char bytes[4];
+    size_t n;
+    if (cp < 0x80) { bytes[0] = (char)cp; n = 1; }
+    else if (cp < 0x800) { bytes[0] = (char)(0xC0 | (cp >> 6)); bytes[1] = (char)(0x80 | (cp & 0x3F)); n = 2; }
+    else if (cp < 0x10000) { bytes[0] = (char)(0xE0 | (cp >> 12)); bytes[1] = (char)(0x80 | ((cp >> 6) & 0x3F)); bytes[2] = (char)(0x80 | (cp & 0x3F)); n = 3; }
+    else { bytes[0] = (char)(0xF0 | (cp >> 18)); bytes[1] = (char)(0x80 | ((cp >> 12) & 0x3F)); bytes[2] = (char)(0x80 | ((cp >> 6) & 0x3F)); bytes[3] = (char)(0x80 | (cp & 0x3F)); n = 4; }
+    __scar_json_write(b, bytes, n);
+}
+static char* __scar_json_parse_string(const char** s) {
+    __scar_json_buf b = {0};
+    __scar_json_write(&b, "", 0);
+    (*s)++;
+    while (**s != '"') {
+        char c = *(*s)++;
+        if (c == '\0' || (unsigned char)c < 0x20) { free(b.data); return NULL; }
+        if (c != '\\') { __scar_json_write(&b, &c, 1); continue; }
+        c = *(*s)++;
+        switch (c) {
+            case '"': case '\\': case '/': break;
+            case 'b': c = '\b'; break;
+            case 'f': c = '\f'; break;
+            case 'n': c = '\n'; break;
+            case 'r': c = '\r'; break;
+            case 't': c = '\t'; break;
+            case 'u': {
+                unsigned cp, low;
+                if (!__scar_json_hex(s, &cp)) { free(b.data); return NULL; }
+                if (cp >= 0xD800 && cp < 0xDC00 && (*s)[0] == '\\' && (*s)[1] == 'u') {
+                    *s += 2;
+                    if (!__scar_json_hex(s, &low) || low < 0xDC00 || low > 0xDFFF) { free(b.data); return NULL; }
+                    cp = 0x10000 + ((cp - 0xD800) << 10) + (low - 0xDC00);
+                }
+                __scar_json_utf8(&b, cp);
+                continue;
+            }
+            default: free(b.data); return NULL;
+        }
+        __scar_json_write(&b, &c, 1);
+    }
+    (*s)++;
+    return b.data;
+}
+static __scar_json* __scar_json_parse_value(const char** s, int depth) {
+    __scar_json_skip(s);
+    if (depth > 512) return NULL;
+    __scar_json* node = NULL;
+    switch (**s) {
+        case '{':
+            node = __scar_json_new(__SCAR_JSON_OBJECT);
+            (*s)++;
+            __scar_json_skip(s);
+            if (**s == '}') { (*s)++; return node; }
+            for (;;) {
+                __scar_json_skip(s);
+                if (**s != '"') goto fail;
+                char* key = __scar_json_parse_string(s);
+                if (!key) goto fail;
+                __scar_json_skip(s);
+                if (**s != ':') { free(key); goto fail; }
+                (*s)++;
+                __scar_json* item = __scar_json_parse_value(s, depth + 1);
+                if (!item || !__scar_json_add(node, key, item)) { free(key); __scar_json_free(item); goto fail; }
+                __scar_json_skip(s);
+                if (**s == ',') { (*s)++; continue; }
+                if (**s == '}') { (*s)++; return node; }
+                goto fail;
+            }
+        case '[':
+            node = __scar_json_new(__SCAR_JSON_LIST);
+            (*s)++;
+            __scar_json_skip(s);
+            if (**s == ']') { (*s)++; return node; }
+            for (;;) {
+                __scar_json* item = __scar_json_parse_value(s, depth + 1);
+                if (!item || !__scar_json_add(node, NULL, item)) { __scar_json_free(item); goto fail; }
+                __scar_json_skip(s);
+                if (**s == ',') { (*s)++; continue; }
+                if (**s == ']') { (*s)++; return node; }
+                goto fail;
+            }
+        case '"':
+            node = __scar_json_new(__SCAR_JSON_STRING);
+            if (!(node->string = __scar_json_parse_string(s))) goto fail;
+            return node;
+        case 't':
+            if (strncmp(*s, "true", 4) != 0) return NULL;
+            *s += 4;
+            node = __scar_json_new(__SCAR_JSON_BOOL);
+            node->number = 1;
+            return node;
+        case 'f':
+            if (strncmp(*s, "false", 5) != 0) return NULL;
+            *s += 5;
+            return __scar_json_new(__SCAR_JSON_BOOL);
+        case 'n':
+            if (strncmp(*s, "null", 4) != 0) return NULL;
+            *s += 4;
+            return __scar_json_new(__SCAR_JSON_NULL);
+        default: {
+            if (**s != '-' && !isdigit((unsigned char)**s)) return NULL;
+            char* end;
+            double number = strtod(*s, &end);
+            if (end == *s) return NULL;
+            *s = end;
+            node = __scar_json_new(__SCAR_JSON_NUMBER);
+            node->number = number;
+            return node;
+        }
+    }
+fail:
+    __scar_json_free(node);
+    return NULL;
+}
+static __scar_json* __scar_json_parse(const char* text) {
+    const char* s = text;
+    __scar_json* root = __scar_json_parse_value(&s, 0);
+    __scar_json_skip(&s);
+    if (root && *s != '\0') { __scar_json_free(root); return NULL; }
+    return root;
+}
+static int __scar_json_index(const char* seg, size_t n) {
+    if (n == 0) return -1;
+    int index = 0;
+    for (size_t i = 0; i < n; i++) {
+        if (!isdigit((unsigned char)seg[i])) return -1;
+        index = index * 10 + (seg[i] - '0');
+    }
+    return index;
+}
+static __scar_json* __scar_json_child(__scar_json* node, const char* seg, size_t n, int create) {
+    if (create && node->type == __SCAR_JSON_NULL) {
+        node->type = __scar_json_index(seg, n) == 0 ? __SCAR_JSON_LIST : __SCAR_JSON_OBJECT;
+    }
+    if (node->type == __SCAR_JSON_OBJECT) {
+        for (int i = 0; i < node->count; i++) {
+            if (strlen(node->keys[i]) == n && memcmp(node->keys[i], seg, n) == 0) return node->items[i];
+        }
+        if (!create) return NULL;
+        char* key = malloc(n + 1);
+        __scar_json* item = __scar_json_new(__SCAR_JSON_NULL);
+        if (!key || !item) { free(key); free(item); return NULL; }
+        memcpy(key, seg, n);
+        key[n] = '\0';
+        if (!__scar_json_add(node, key, item)) { free(key); free(item); return NULL; }
+        return item;
+    }
+    if (node->type == __SCAR_JSON_LIST) {
+        int index = __scar_json_index(seg, n);
+        if (index < 0) return NULL;
+        if (index < node->count) return node->items[index];
+        if (!create || index != node->count) return NULL;
+        __scar_json* item = __scar_json_new(__SCAR_JSON_NULL);
+        if (!item || !__scar_json_add(node, NULL, item)) { free(item); return NULL; }
+        return item;
+    }
+    return NULL;
+}
+static __scar_json* __scar_json_at(void* root, const char* path, int create) {
+    __scar_json* node = root;
+    while (node && *path) {
+        const char* dot = strchr(path, '.');
+        size_t n = dot ? (size_t)(dot - path) : strlen(path);
+        node = __scar_json_child(node, path, n, create);
+        path += dot ? n + 1 : n;
+    }
+    return node;
+}
+static const char* __scar_json_kind(void* root, const char* path) {
+    static const char* names[] = {"null", "bool", "number", "string", "list", "object"};
+    __scar_json* node = __scar_json_at(root, path, 0);
+    return node ? names[node->type] : "";
+}
+static int __scar_json_length(void* root, const char* path) {
+    __scar_json* node = __scar_json_at(root, path, 0);
+    if (!node) return 0;
+    if (node->type == __SCAR_JSON_STRING) return (int)strlen(node->string);
+    return node->count;
+}
+static const char* __scar_json_key(void* root, const char* path, int index) {
+    __scar_json* node = __scar_json_at(root, path, 0);
+    if (!node || node->type != __SCAR_JSON_OBJECT || index < 0 || index >= node->count) return "";
+    return node->keys[index];
+}
+static const char* __scar_json_get_string(void* root, const char* path) {
+    __scar_json* node = __scar_json_at(root, path, 0);
+    return node && node->type == __SCAR_JSON_STRING ? node->string : "";
+}
+static double __scar_json_get_number(void* root, const char* path) {
+    __scar_json* node = __scar_json_at(root, path, 0);
+    return node && (node->type == __SCAR_JSON_NUMBER || node->type == __SCAR_JSON_BOOL) ? node->number : 0;
+}
+static __scar_json* __scar_json_put(void* root, const char* path, int type) {
+    __scar_json* node = __scar_json_at(root, path, 1);
+    if (!node) return NULL;
+    __scar_json_clear(node);
+    node->type = type;
+    return node;
+}
+static int __scar_json_put_string(void* root, const char* path, const char* value) {
+    __scar_json* node = __scar_json_put(root, path, __SCAR_JSON_STRING);
+    return node && (node->string = strdup(value)) != NULL;
+}
+static int __scar_json_put_number(void* root, const char* path, int type, double value) {
+    __scar_json* node = __scar_json_put(root, path, type);
+    if (node) node->number = value;
+    return node != NULL;
+}
+static int __scar_json_put_float(void* root, const char* path, float value) {
+    char digits[32];
+    snprintf(digits, sizeof(digits), "%.7g", value);
+    return __scar_json_put_number(root, path, __SCAR_JSON_NUMBER, strtod(digits, NULL));
+}
+static void __scar_json_dump_string(__scar_json_buf* b, const char* s) {
+    __scar_json_write(b, "\"", 1);
+    for (; *s; s++) {
+        char escape[8];
+        switch (*s) {
+            case '"': __scar_json_write(b, "\\\"", 2); break;
+            case '\\': __scar_json_write(b, "\\\\", 2); break;
+            case '\b': __scar_json_write(b, "\\b", 2); break;
+            case '\f': __scar_json_write(b, "\\f", 2); break;
+            case '\n': __scar_json_write(b, "\\n", 2); break;
+            case '\r': __scar_json_write(b, "\\r", 2); break;
+            case '\t': __scar_json_write(b, "\\t", 2); break;
+            default:
+                if ((unsigned char)*s < 0x20) {
+                    snprintf(escape, sizeof(escape), "\\u%04x", (unsigned char)*s);
+                    __scar_json_write(b, escape, 6);
+                } else {
+                    __scar_json_write(b, s, 1);
+                }
+        }
+    }
+    __scar_json_write(b, "\"", 1);
+}
+static void __scar_json_dump(__scar_json_buf* b, __scar_json* node) {
+    char number[32];
+    switch (node->type) {
+        case __SCAR_JSON_NULL: __scar_json_write(b, "null", 4); break;
+        case __SCAR_JSON_BOOL: node->number ? __scar_json_write(b, "true", 4) : __scar_json_write(b, "false", 5); break;
+        case __SCAR_JSON_NUMBER:
+            if (!isfinite(node->number)) { __scar_json_write(b, "null", 4); break; }
+            snprintf(number, sizeof(number), "%.15g", node->number);
+            if (strtod(number, NULL) != node->number) snprintf(number, sizeof(number), "%.17g", node->number);
+            __scar_json_write(b, number, strlen(number));
+            break;
+        case __SCAR_JSON_STRING: __scar_json_dump_string(b, node->string); break;
+        case __SCAR_JSON_LIST:
+        case __SCAR_JSON_OBJECT:
+            __scar_json_write(b, node->type == __SCAR_JSON_LIST ? "[" : "{", 1);
+            for (int i = 0; i < node->count; i++) {
+                if (i > 0) __scar_json_write(b, ",", 1);
+                if (node->type == __SCAR_JSON_OBJECT) {
+                    __scar_json_dump_string(b, node->keys[i]);
+                    __scar_json_write(b, ":", 1);
+                }
+                __scar_json_dump(b, node->items[i]);
+            }
+            __scar_json_write(b, node->type == __SCAR_JSON_LIST ? "]" : "}", 1);
+            break;
+    }
+}
+static char* __scar_json_to_string(void* root, const char* path) {
+    __scar_json_buf b = {0};
+    __scar_json* node = __scar_json_at(root, path, 0);
+    if (node) __scar_json_dump(&b, node);
+    else __scar_json_write(&b, "", 0);
+    return b.data;
+}`
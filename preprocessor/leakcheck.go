@@ -0,0 +1,99 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains the allocation tracking runtime used by the --leak-check build mode.
+
+package preprocessor
+
+// Routes malloc, calloc, realloc, strdup and free through tracking wrappers
+// which report every allocation still live when the program exits. The real
+// allocator is still used underneath, so the binary also runs under valgrind.
+// __scar_new_at records an object at the scar line of the new expression
+// creating it, rather than at the malloc of its constructor.
+func InsertLeakCheck(output string) string {
+	return leakCheckRuntime + output
+}
+
+const leakCheckRuntime = `#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+typedef struct __scar_alloc_rec {
+    void* ptr;
+    size_t size;
+    const char* file;
+    const char* func;
+    int line;
+    struct __scar_alloc_rec* next;
+} __scar_alloc_rec;
+static __scar_alloc_rec* __scar_allocs = NULL;
+static void __scar_track(void* ptr, size_t size, const char* file, const char* func, int line) {
+    if (!ptr) return;
+    __scar_alloc_rec* rec = malloc(sizeof(__scar_alloc_rec));
+    if (!rec) return;
+    rec->ptr = ptr; rec->size = size; rec->file = file; rec->func = func; rec->line = line;
+    #pragma omp critical(__scar_alloc)
+    { rec->next = __scar_allocs; __scar_allocs = rec; }
+}
+static void __scar_untrack(void* ptr) {
+    if (!ptr) return;
+    __scar_alloc_rec* found = NULL;
+    #pragma omp critical(__scar_alloc)
+    {
+        for (__scar_alloc_rec** cur = &__scar_allocs; *cur; cur = &(*cur)->next) {
+            if ((*cur)->ptr == ptr) { found = *cur; *cur = found->next; break; }
+        }
+    }
+    free(found);
+}
+static void* __scar_malloc(size_t size, const char* file, const char* func, int line) {
+    void* ptr = malloc(size);
+    __scar_track(ptr, size, file, func, line);
+    return ptr;
+}
+static void* __scar_calloc(size_t count, size_t size, const char* file, const char* func, int line) {
+    void* ptr = calloc(count, size);
+    __scar_track(ptr, count * size, file, func, line);
+    return ptr;
+}
+static void* __scar_realloc(void* old, size_t size, const char* file, const char* func, int line) {
+    void* ptr = realloc(old, size);
+    if (ptr || size == 0) __scar_untrack(old);
+    __scar_track(ptr, size, file, func, line);
+    return ptr;
+}
+static char* __scar_strdup(const char* s, const char* file, const char* func, int line) {
+    char* ptr = strdup(s);
+    __scar_track(ptr, ptr ? strlen(ptr) + 1 : 0, file, func, line);
+    return ptr;
+}
+static void* __scar_alloc_at(void* ptr, const char* file, const char* func, int line) {
+    #pragma omp critical(__scar_alloc)
+    {
+        for (__scar_alloc_rec* rec = __scar_allocs; rec; rec = rec->next) {
+            if (rec->ptr == ptr) { rec->file = file; rec->func = func; rec->line = line; break; }
+        }
+    }
+    return ptr;
+}
+#define __scar_new_at(object) ((__typeof__(object))__scar_alloc_at((object), __FILE__, __func__, __LINE__))
+static void __scar_free(void* ptr) {
+    __scar_untrack(ptr);
+    free(ptr);
+}
+static void __scar_report_leaks(void) {
+    size_t count = 0, bytes = 0;
+    for (__scar_alloc_rec* rec = __scar_allocs; rec; rec = rec->next) { count++; bytes += rec->size; }
+    if (count == 0) return;
+    fprintf(stderr, "leak-check: %zu allocation(s), %zu byte(s) still live at exit\n", count, bytes);
+    for (__scar_alloc_rec* rec = __scar_allocs; rec; rec = rec->next) {
+        fprintf(stderr, "  %zu byte(s) allocated in %s at %s:%d\n", rec->size, rec->func, rec->file, rec->line);
+    }
+}
+__attribute__((constructor)) static void __scar_leak_check_init(void) { atexit(__scar_report_leaks); }
+#define malloc(n) __scar_malloc((n), __FILE__, __func__, __LINE__)
+#define calloc(c, n) __scar_calloc((c), (n), __FILE__, __func__, __LINE__)
+#define realloc(p, n) __scar_realloc((p), (n), __FILE__, __func__, __LINE__)
+#define strdup(s) __scar_strdup((s), __FILE__, __func__, __LINE__)
+#define free(p) __scar_free((p))
+`
@@ -0,0 +1,194 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains the TCP socket and HTTP client runtimes used by std/net and std/http.
+
+package preprocessor
+
+// Inserts the TCP socket runtime over BSD sockets, or Winsock on Windows.
+// Sockets are passed around as ints, with -1 standing for none.
+func insertNetRuntime(output string) string {
+	return netRuntime + "\n" + output
+}
+
+const netRuntime = `#ifdef _WIN32
+#include <winsock2.h>
+#include <ws2tcpip.h>
+#define __scar_net_closesocket closesocket
+static int __scar_net_init(void) {
+    static int started = 0;
+    WSADATA data;
+    if (!started && WSAStartup(MAKEWORD(2, 2), &data) == 0) started = 1;
+    return started;
+}
+#else
+#include <netdb.h>
+#include <netinet/in.h>
+#include <signal.h>
+#include <sys/socket.h>
+#include <unistd.h>
+#define __scar_net_closesocket close
+static int __scar_net_init(void) {
+    static int started = 0;
+    if (!started) {
+        signal(SIGPIPE, SIG_IGN);
+        started = 1;
+    }
+    return started;
+}
+#endif
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+static struct addrinfo* __scar_net_resolve(const char* host, int port, int passive) {
+    struct addrinfo hints, *info = NULL;
+    char service[16];
+    if (!__scar_net_init()) return NULL;
+    snprintf(service, sizeof(service), "%d", port);
+    memset(&hints, 0, sizeof(hints));
+    hints.ai_family = AF_UNSPEC;
+    hints.ai_socktype = SOCK_STREAM;
+    if (passive) hints.ai_flags = AI_PASSIVE;
+    if (getaddrinfo(host[0] ? host : NULL, service, &hints, &info) != 0) return NULL;
+    return info;
+}
+static int __scar_net_listen(const char* host, int port) {
+    struct addrinfo* info = __scar_net_resolve(host, port, 1);
+    int fd = -1, yes = 1;
+    for (struct addrinfo* ai = info; ai; ai = ai->ai_next) {
+        fd = (int)socket(ai->ai_family, ai->ai_socktype, ai->ai_protocol);
+        if (fd < 0) continue;
+        setsockopt(fd, SOL_SOCKET, SO_REUSEADDR, (const char*)&yes, sizeof(yes));
+        if (bind(fd, ai->ai_addr, (int)ai->ai_addrlen) == 0 && listen(fd, SOMAXCONN) == 0) break;
+        __scar_net_closesocket(fd);
+        fd = -1;
+    }
+    if (info) freeaddrinfo(info);
+    return fd;
+}
+static int __scar_net_connect(const char* host, int port) {
+    struct addrinfo* info = __scar_net_resolve(host, port, 0);
+    int fd = -1;
+    for (struct addrinfo* ai = info; ai; ai = ai->ai_next) {
+        fd = (int)socket(ai->ai_family, ai->ai_socktype, ai->ai_protocol);
+        if (fd < 0) continue;
+        if (connect(fd, ai->ai_addr, (int)ai->ai_addrlen) == 0) break;
+        __scar_net_closesocket(fd);
+        fd = -1;
+    }
+    if (info) freeaddrinfo(info);
+    return fd;
+}
+static int __scar_net_local_port(int fd) {
+    struct sockaddr_storage addr;
+    socklen_t len = sizeof(addr);
+    if (fd < 0 || getsockname(fd, (struct sockaddr*)&addr, &len) != 0) return -1;
+    if (addr.ss_family == AF_INET6) return ntohs(((struct sockaddr_in6*)&addr)->sin6_port);
+    return ntohs(((struct sockaddr_in*)&addr)->sin_port);
+}
+static int __scar_net_accept(int fd) {
+    if (fd < 0) return -1;
+    int client = (int)accept(fd, NULL, NULL);
+    return client < 0 ? -1 : client;
+}
+static char* __scar_net_read(int fd, int max) {
+    if (max <= 0) max = 4096;
+    char* buffer = malloc(max + 1);
+    if (!buffer) return NULL;
+    int n = fd < 0 ? -1 : (int)recv(fd, buffer, max, 0);
+    buffer[n > 0 ? n : 0] = '\0';
+    return buffer;
+}
+static char* __scar_net_read_line(int fd) {
+    size_t len = 0, cap = 128;
+    char* line = malloc(cap);
+    char c;
+    if (!line) return NULL;
+    while (fd >= 0 && recv(fd, &c, 1, 0) == 1 && c != '\n') {
+        if (len + 2 > cap) {
+            char* grown = realloc(line, cap *= 2);
+            if (!grown) break;
+            line = grown;
+        }
+        line[len++] = c;
+    }
+    if (len > 0 && line[len - 1] == '\r') len--;
+    line[len] = '\0';
+    return line;
+}
+static int __scar_net_write(int fd, const char* data) {
+    size_t len = strlen(data), sent = 0;
+    while (fd >= 0 && sent < len) {
+        int n = (int)send(fd, data + sent, (int)(len - sent), 0);
+        if (n <= 0) return -1;
+        sent += n;
+    }
+    return fd < 0 ? -1 : (int)sent;
+}
+static int __scar_net_close(int fd) {
+    if (fd >= 0) __scar_net_closesocket(fd);
+    return -1;
+}`
+
+// Inserts the HTTP/1.0 client behind std/http, built on the TCP runtime. Only
+// plain http URLs are supported, and the response body is returned whole.
+func insertHTTPRuntime(output string) string {
+	return httpRuntime + "\n" + output
+}
+
+const httpRuntime = `__attribute__((weak)) int __scar_http_status = 0;
+static char* __scar_http_request(const char* method, const char* url, const char* body) {
+    char host[256], request_head[1024];
+    const char* path;
+    int port = 80;
+    __scar_http_status = 0;
+    if (strncmp(url, "http://", 7) != 0) {
+        fprintf(stderr, "http: only http:// URLs are supported, got %s\n", url);
+        return strdup("");
+    }
+    url += 7;
+    path = strchr(url, '/');
+    if (!path) path = url + strlen(url);
+    size_t host_len = path - url;
+    if (host_len >= sizeof(host)) return strdup("");
+    memcpy(host, url, host_len);
+    host[host_len] = '\0';
+    char* colon = strrchr(host, ':');
+    if (colon && !strchr(colon, ']')) {
+        *colon = '\0';
+        port = atoi(colon + 1);
+    }
+    int fd = __scar_net_connect(host, port);
+    if (fd < 0) return strdup("");
+    snprintf(request_head, sizeof(request_head),
+        "%s %s HTTP/1.0\r\nHost: %s\r\nUser-Agent: scar\r\nConnection: close\r\n",
+        method, *path ? path : "/", host);
+    __scar_net_write(fd, request_head);
+    if (body) {
+        snprintf(request_head, sizeof(request_head),
+            "Content-Type: application/x-www-form-urlencoded\r\nContent-Length: %zu\r\n", strlen(body));
+        __scar_net_write(fd, request_head);
+    }
+    __scar_net_write(fd, "\r\n");
+    if (body) __scar_net_write(fd, body);
+    size_t len = 0, cap = 4096;
+    char* response = malloc(cap);
+    int n;
+    while (response && (n = (int)recv(fd, response + len, (int)(cap - len - 1), 0)) > 0) {
+        len += n;
+        if (cap - len < 1024) {
+            char* grown = realloc(response, cap *= 2);
+            if (!grown) break;
+            response = grown;
+        }
+    }
+    __scar_net_close(fd);
+    if (!response) return strdup("");
+    response[len] = '\0';
+    sscanf(response, "HTTP/%*s %d", &__scar_http_status);
+    char* start = strstr(response, "\r\n\r\n");
+    start = start ? start + 4 : response + len;
+    memmove(response, start, strlen(start) + 1);
+    return response;
+}`
@@ -1,7 +1,11 @@
 package preprocessor
 
 import (
+	"os"
+	"os/exec"
+	"path/filepath"
 	"scar/lexer"
+	"strings"
 	"testing"
 )
 
@@ -93,3 +97,338 @@ func TestRemoveComments(t *testing.T) {
 		})
 	}
 }
+
+func TestInsertLeakCheck(t *testing.T) {
+	input := "int main() { char* p = malloc(4); free(p); return 0; }"
+	got := InsertLeakCheck(input)
+	if !strings.HasSuffix(got, input) {
+		t.Errorf("InsertLeakCheck() should leave the program intact, got %q", got)
+	}
+	for _, want := range []string{"#define malloc(n)", "#define free(p)", "atexit(__scar_report_leaks)", "#define __scar_new_at(object)"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("InsertLeakCheck() missing %q", want)
+		}
+	}
+	if strings.Index(got, "#include <stdlib.h>") > strings.Index(got, "#define malloc(n)") {
+		t.Error("InsertLeakCheck() must include stdlib.h before redefining malloc")
+	}
+}
+
+func TestInsertMemoryRuntimes(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{"void f() { Node* n = __scar_rc_alloc(sizeof(Node), 0); __scar_release(n); }", []string{"static void* __scar_retain(void* object)", "#define __scar_rc_set(target, value)"}},
+		{"void f() { Node* n = __scar_arena_alloc(sizeof(Node)); }", []string{"static void* __scar_arena_alloc(size_t size)", "atexit(__scar_arena_release)"}},
+	}
+	for _, tt := range tests {
+		got := InsertMacros(tt.input)
+		if !strings.HasSuffix(got, tt.input) {
+			t.Errorf("InsertMacros() should leave the program intact, got %q", got)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(got, want) {
+				t.Errorf("InsertMacros(%q) missing %q", tt.input, want)
+			}
+		}
+	}
+}
+
+func TestInsertStringLibRuntime(t *testing.T) {
+	input := "char* string_trim(char* s) { char* _output_buffer = __scar_str_alloc(4096); __scar_string_trim(_output_buffer, s); return _output_buffer; }"
+	got := InsertMacros(input)
+	for _, want := range []string{"#include <ctype.h>", "static inline void __scar_string_trim(char* out, const char* s)", "static inline int __scar_string_split(char out[][256], int max_size"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("InsertMacros(%q) missing %q", input, want)
+		}
+	}
+	if strings.Contains(InsertMacros("char* s = __scar_str_new(\"a\");"), "__scar_string_trim") {
+		t.Error("expected the string runtime not to pull in the std/string helpers")
+	}
+}
+
+func TestInsertMathRuntime(t *testing.T) {
+	input := "float math_sqrt(float x) { return __scar_math_sqrt(x); }"
+	got := InsertMacros(input)
+	for _, want := range []string{"#include <math.h>", "static inline double __scar_math_sqrt(double x) { return sqrt(x); }"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("InsertMacros(%q) missing %q", input, want)
+		}
+	}
+}
+
+func TestInsertRandomRuntime(t *testing.T) {
+	input := "random_seed(42); int x = rand(1, 6); float f = random_rand_float();"
+	got := InsertMacros(input)
+	for _, want := range []string{
+		"__attribute__((weak)) int __scar_random_seeded = 0;",
+		"static inline void __scar_random_shuffle(int* items, int len)",
+		"#define rand__internal(x, y) __scar_random_int((x), (y))",
+		"int x = rand__internal(1, 6);",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("InsertMacros(%q) missing %q", input, want)
+		}
+	}
+}
+
+func TestInsertIORuntime(t *testing.T) {
+	input := "while (__scar_io_getline(&line, &__cap, (FILE*)f->handle)) {}"
+	got := InsertMacros(input)
+	for _, want := range []string{"static inline int __scar_io_getline(char** line, size_t* cap, FILE* file)", "static inline char* __scar_io_read_line(FILE* file)"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("InsertMacros(%q) missing %q", input, want)
+		}
+	}
+}
+
+func TestInsertInputRuntime(t *testing.T) {
+	input := "char* name = __scar_input(); int n = __scar_read_int();"
+	got := InsertMacros(input)
+	for _, want := range []string{"static inline char* __scar_input(void)", "static inline int __scar_read_int(void)", "static inline double __scar_read_float(void)"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("InsertMacros(%q) missing %q", input, want)
+		}
+	}
+}
+
+func TestReadNumberThenInput(t *testing.T) {
+	cc, err := exec.LookPath("cc")
+	if err != nil {
+		t.Skip("needs a C compiler")
+	}
+	var (
+		dir    = t.TempDir()
+		source = filepath.Join(dir, "read.c")
+		binary = filepath.Join(dir, "read")
+	)
+	code := InsertMacros(`int main(void) {
+    int n = __scar_read_int();
+    char* rest = __scar_input();
+    double x = __scar_read_float();
+    char* last = __scar_input();
+    printf("%d [%s] %g [%s]\n", n, rest, x, last);
+    return 0;
+}`)
+	if err := os.WriteFile(source, []byte(code), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := exec.Command(cc, source, "-o", binary).CombinedOutput(); err != nil {
+		t.Fatalf("%s failed: %v\n%s", cc, err, out)
+	}
+	cmd := exec.Command(binary)
+	cmd.Stdin = strings.NewReader("42 left over\nhello\n2.5\nbye\n")
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "42 [hello] 2.5 [bye]\n"; string(out) != expected {
+		t.Errorf("expected input() to read the line after the number, got %q", out)
+	}
+}
+
+func TestInsertOSRuntime(t *testing.T) {
+	input := "this->output = __scar_os_capture(command, &this->code);"
+	got := InsertMacros(input)
+	for _, want := range []string{
+		"static inline char* __scar_os_capture(const char* command, int* code)",
+		"static inline int __scar_exit_code(int status)",
+		"static inline int __scar_os_set_env(const char* name, const char* value)",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("InsertMacros(%q) missing %q", input, want)
+		}
+	}
+}
+
+func TestInsertRegexRuntime(t *testing.T) {
+	input := "return __scar_regex_match(pattern, s);"
+	got := InsertMacros(input)
+	for _, want := range []string{
+		"#include <regex.h>",
+		"static inline int __scar_regex_find_all(char out[][256], int max_size, const char* pattern, const char* s)",
+		"static inline void __scar_regex_replace(char* out, const char* pattern, const char* s, const char* with)",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("InsertMacros(%q) missing %q", input, want)
+		}
+	}
+}
+
+func TestInsertNetRuntime(t *testing.T) {
+	input := "this->fd = __scar_net_connect(host, port);"
+	got := InsertMacros(input)
+	for _, want := range []string{
+		"#include <winsock2.h>",
+		"#include <sys/socket.h>",
+		"static int __scar_net_listen(const char* host, int port)",
+		"static char* __scar_net_read_line(int fd)",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("InsertMacros(%q) missing %q", input, want)
+		}
+	}
+}
+
+func TestInsertHTTPRuntime(t *testing.T) {
+	input := `return __scar_http_request("GET", url, NULL);`
+	got := InsertMacros(input)
+	http := strings.Index(got, "static char* __scar_http_request(")
+	connect := strings.Index(got, "static int __scar_net_connect(")
+	if http == -1 || connect == -1 || connect > http {
+		t.Errorf("expected InsertMacros(%q) to insert the TCP runtime before the HTTP client:\n%s", input, got)
+	}
+}
+
+func TestInsertThreadRuntime(t *testing.T) {
+	for _, input := range []string{"__scar_thread_join(t);", "this->handle = __scar_mutex_new();"} {
+		got := InsertMacros(input)
+		for _, want := range []string{"#include <pthread.h>", "CreateThread(", "static inline void* __scar_mutex_new(void)"} {
+			if !strings.Contains(got, want) {
+				t.Errorf("InsertMacros(%q) missing %q", input, want)
+			}
+		}
+	}
+}
+
+func TestInsertOpenMPRuntime(t *testing.T) {
+	got := InsertMacros("__scar_throw(1, \"x\");")
+	if !strings.HasPrefix(got, "#ifdef _OPENMP\n#include <omp.h>\n#else") || !strings.Contains(got, "static inline int omp_get_level(void) { return 0; }") {
+		t.Errorf("expected the exception runtime to come with the OpenMP runtime or its stand-ins:\n%s", got)
+	}
+	if got := InsertMacros(`printf("%d\n", 1);`); strings.Contains(got, "omp") {
+		t.Errorf("expected a program without OpenMP calls to leave OpenMP out:\n%s", got)
+	}
+}
+
+func TestInsertJSONRuntime(t *testing.T) {
+	input := "this->root = (char*)__scar_json_parse(text);"
+	got := InsertMacros(input)
+	for _, want := range []string{
+		"static __scar_json* __scar_json_parse(const char* text)",
+		"static int __scar_json_put_string(void* root, const char* path, const char* value)",
+		"static char* __scar_json_to_string(void* root, const char* path)",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("InsertMacros(%q) missing %q", input, want)
+		}
+	}
+}
+
+func TestInsertCharCasts(t *testing.T) {
+	input := "char c = chr(ord('a') + 1);"
+	got := InsertMacros(input)
+	for _, want := range []string{"#define ord(x) ((int)(x))", "#define chr(x) ((char)(x))"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("InsertMacros(%q) missing %q", input, want)
+		}
+	}
+}
+
+func TestInsertCommandLineBuiltins(t *testing.T) {
+	input := "if (argc() > 1) { args_len = __scar_args(args, args_cap); }"
+	got := InsertMacros(input)
+	for _, want := range []string{"#define argc() __global_argc", "static inline int __scar_args(char output[][256], int max_size) {"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("InsertMacros(%q) missing %q", input, want)
+		}
+	}
+	if strings.Contains(InsertMacros("int main(int argc, char** argv) {}"), "#define argc()") {
+		t.Error("expected the argc parameter of main not to pull in the argc() builtin")
+	}
+}
+
+func TestInsertListUtilsRuntime(t *testing.T) {
+	input := "int s = __scar_list_sum_int(xs, xs_len); __scar_list_reverse(xs, xs_len);"
+	got := InsertMacros(input)
+	for _, want := range []string{
+		"__SCAR_LIST_UTILS(int)\n",
+		"static inline bool __scar_list_contains_str(char (*list)[256], int len, const char* value) {",
+		"#define __scar_list_reverse(list, len) __scar_list_reverse_n((list), (len), sizeof(*(list)))",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("InsertMacros(%q) missing %q", input, want)
+		}
+	}
+}
+
+func TestInsertConversionRuntime(t *testing.T) {
+	input := `int n = __scar_to_int("42");`
+	got := InsertMacros(input)
+	for _, want := range []string{
+		"static inline int __scar_to_int(const char* value) {",
+		"static inline float __scar_to_float(const char* value) {",
+		"static void __scar_throw(int code, const char* message) {",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("InsertMacros(%q) missing %q", input, want)
+		}
+	}
+	if strings.Index(got, "__scar_throw(int code") > strings.Index(got, "__scar_conversion_failed(const") {
+		t.Errorf("InsertMacros(%q) defines the conversions before the exception runtime they use", input)
+	}
+}
+
+func TestInsertCheckedArithmeticRuntime(t *testing.T) {
+	input := `int n = __scar_checked_add_int(a, 1);`
+	got := InsertMacros(input)
+	for _, want := range []string{
+		"static inline type __scar_checked_add_##type(type a, type b) {",
+		"if (b == 0) __scar_throw(1, \"division by zero\");",
+		"static inline type __scar_checked_cast_##type(long long value) {",
+		"__SCAR_CHECKED(uint8_t)",
+		"static void __scar_throw(int code, const char* message) {",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("InsertMacros(%q) missing %q", input, want)
+		}
+	}
+	if strings.Index(got, "__scar_throw(int code") > strings.Index(got, "__scar_overflow(const") {
+		t.Errorf("InsertMacros(%q) defines the checked arithmetic before the exception runtime it uses", input)
+	}
+}
+
+func TestInsertBoundsCheckRuntime(t *testing.T) {
+	input := `int x = xs[__scar_check_index(i, xs_len)];`
+	got := InsertMacros(input)
+	for _, want := range []string{
+		"#define __scar_check_index(index, len) __scar_check_index_at((index), (len), __FILE__, __LINE__)",
+		"fflush(stdout);\n        fprintf(stderr, \"%s:%d: index %lld out of range",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("InsertMacros(%q) missing %q", input, want)
+		}
+	}
+}
+
+func TestInsertPanicRuntime(t *testing.T) {
+	input := `__scar_context_enter("main"); __scar_panic("boom");`
+	got := InsertMacros(input)
+	for _, want := range []string{
+		"__attribute__((weak)) _Thread_local __scar_context* __scar_context_top = NULL;",
+		"__attribute__((cleanup(__scar_context_leave)))",
+		"#define __scar_panic(message) __scar_panic_at((message), __FILE__, __LINE__)",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("InsertMacros(%q) missing %q", input, want)
+		}
+	}
+}
+
+func TestInsertUTF8Runtime(t *testing.T) {
+	input := `int n = __scar_utf8_len("héllo");`
+	got := InsertMacros(input)
+	for _, want := range []string{
+		"static inline int __scar_utf8_size(const char* s) {",
+		"static inline int __scar_utf8_len(const char* s) {",
+		"static inline int __scar_utf8_offset(const char* s, int index) {",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("InsertMacros(%q) missing %q", input, want)
+		}
+	}
+	if strings.Contains(InsertMacros("char* s = __scar_str_new(\"a\");"), "__scar_utf8_size") {
+		t.Error("expected the string runtime not to pull in the UTF-8 helpers")
+	}
+}
@@ -23,6 +23,15 @@ func InsertMacros(output string) string {
 	if strings.Contains(output, "ord") {
 		outp = insertOrd(outp)
 	}
+	if strings.Contains(output, "chr(") {
+		outp = insertChr(outp)
+	}
+	if strings.Contains(output, "argc()") {
+		outp = insertArgc(outp)
+	}
+	if strings.Contains(output, "__scar_args(") {
+		outp = insertArgs(outp)
+	}
 	if strings.Contains(output, "rand") {
 		outp = replaceRandCalls(outp)
 		outp = insertRand(outp)
@@ -33,16 +42,95 @@ func InsertMacros(output string) string {
 	if strings.Contains(output, "this.") {
 		outp = replaceOutsideStringLiterals(outp, "this.", "this->")
 	}
-	if strings.Contains(output, " and ") {
-		outp = replaceOutsideStringLiterals(outp, " and ", " && ")
-	}
-	if strings.Contains(output, " or ") {
-		outp = replaceOutsideStringLiterals(outp, " or ", " || ")
-	}
 	if strings.Contains(output, "fmt!") {
 		outp = strings.ReplaceAll(outp, "fmt!", "fmt")
 		outp = insertSprintf(outp)
 	}
+	if strings.Contains(output, "__scar_str_") {
+		outp = insertStringRuntime(outp)
+	}
+	if strings.Contains(output, "__scar_string_") {
+		outp = insertStringLibRuntime(outp)
+	}
+	if strings.Contains(output, "__scar_json_") {
+		outp = insertJSONRuntime(outp)
+	}
+	if strings.Contains(output, "__scar_regex_") {
+		outp = insertRegexRuntime(outp)
+	}
+	if strings.Contains(output, "__scar_http_") {
+		outp = insertHTTPRuntime(outp)
+	}
+	if strings.Contains(output, "__scar_net_") || strings.Contains(output, "__scar_http_") {
+		outp = insertNetRuntime(outp)
+	}
+	if strings.Contains(output, "__scar_thread_") || strings.Contains(output, "__scar_mutex_") {
+		outp = insertThreadRuntime(outp)
+	}
+	if strings.Contains(output, "__scar_os_") {
+		outp = insertOSRuntime(outp)
+	}
+	if strings.Contains(output, "__scar_input(") || strings.Contains(output, "__scar_read_") {
+		outp = insertInputRuntime(outp)
+	}
+	if strings.Contains(output, "__scar_io_") {
+		outp = insertIORuntime(outp)
+	}
+	if strings.Contains(output, "__scar_sleep_") {
+		outp = insertSleepRuntime(outp)
+	}
+	if strings.Contains(output, "__scar_math_") {
+		outp = insertMathRuntime(outp)
+	}
+	if strings.Contains(output, "__scar_list_") {
+		outp = insertListRuntime(outp)
+	}
+	if strings.Contains(output, "__scar_cmp_") {
+		outp = insertSortRuntime(outp)
+	}
+	if listUtilsPattern.MatchString(output) {
+		outp = insertListUtilsRuntime(outp)
+	}
+	if strings.Contains(output, "__scar_check_index") {
+		outp = insertBoundsCheckRuntime(outp)
+	}
+	if strings.Contains(output, "__scar_map") {
+		outp = insertMapRuntime(outp)
+	}
+	if strings.Contains(output, "__scar_unwrap") || strings.Contains(output, "__scar_box") {
+		outp = insertOptionalRuntime(outp)
+	}
+	if strings.Contains(output, "__scar_to_") {
+		outp = insertConversionRuntime(outp)
+	}
+	if strings.Contains(output, "__scar_utf8_") {
+		outp = insertUTF8Runtime(outp)
+	}
+	if strings.Contains(output, "__scar_checked_") {
+		outp = insertCheckedArithmeticRuntime(outp)
+	}
+	if strings.Contains(output, "__scar_throw") || strings.Contains(output, "__scar_try_") || strings.Contains(output, "__scar_to_") ||
+		strings.Contains(output, "__scar_checked_") {
+		outp = insertExceptionRuntime(outp)
+	}
+	if strings.Contains(output, "__scar_assert") || strings.Contains(output, "__scar_test_") {
+		outp = insertTestRuntime(outp)
+	}
+	if strings.Contains(output, "__scar_panic") || strings.Contains(output, "__scar_context") {
+		outp = insertPanicRuntime(outp)
+	}
+	if strings.Contains(output, "__scar_breakpoint") {
+		outp = insertBreakpointRuntime(outp)
+	}
+	if strings.Contains(output, "__scar_bench_") {
+		outp = insertBenchRuntime(outp)
+	}
+	if strings.Contains(output, "__scar_rc_") {
+		outp = insertRCRuntime(outp)
+	}
+	if strings.Contains(output, "__scar_arena_") {
+		outp = insertArenaRuntime(outp)
+	}
 	if strings.Contains(output, "cstring") {
 		outp = insertCstring(outp)
 	}
@@ -54,9 +142,1327 @@ func InsertMacros(output string) string {
 			"typedef uint64_t u64;\ntypedef int16_t i16;\ntypedef uint16_t u16;\ntypedef uint8_t u8;\ntypedef int8_t i8;\n" +
 			"typedef double f64;\ntypedef float f32;\n" + outp
 	}
+	if strings.Contains(outp, "omp_") {
+		outp = insertOpenMPRuntime(outp)
+	}
 	return outp
 }
 
+// Inserts the check of list indexes made with --bounds-check, which aborts
+// with the file and line of the indexing when an index is out of range,
+// flushing what the program printed before so it is not lost.
+func insertBoundsCheckRuntime(output string) string {
+	return `#include <stdio.h>
+#include <stdlib.h>
+static inline long long __scar_check_index_at(long long index, long long len, const char* file, int line) {
+    if (index < 0 || index >= len) {
+        fflush(stdout);
+        fprintf(stderr, "%s:%d: index %lld out of range for a list of length %lld\n", file, line, index, len);
+        abort();
+    }
+    return index;
+}
+#define __scar_check_index(index, len) __scar_check_index_at((index), (len), __FILE__, __LINE__)
+` + output
+}
+
+func insertListRuntime(output string) string {
+	return `#include <stdarg.h>
+#include <stdlib.h>
+#include <string.h>
+#define __scar_list_reserve(list, cap, n) \
+    do { \
+        if ((n) > (cap)) { \
+            int __scar_cap = (cap) > 0 ? (cap) * 2 : 8; \
+            while (__scar_cap < (n)) __scar_cap *= 2; \
+            (list) = realloc((list), __scar_cap * sizeof(*(list))); \
+            (cap) = __scar_cap; \
+        } \
+    } while (0)
+#define __scar_list_push(list, len, cap, ...) \
+    do { \
+        __scar_list_reserve(list, cap, (len) + 1); \
+        (list)[(len)++] = (__VA_ARGS__); \
+    } while (0)
+#define __scar_list_push_str(list, len, cap, value) \
+    do { \
+        __scar_list_reserve(list, cap, (len) + 1); \
+        strcpy((list)[(len)++], (value)); \
+    } while (0)
+#define __scar_list_add_row(list, lens, len, cap, n) \
+    do { \
+        int __scar_old_cap = (cap); \
+        __scar_list_reserve(list, cap, (len) + 1); \
+        if ((cap) != __scar_old_cap) (lens) = realloc((lens), (cap) * sizeof(int)); \
+        (list)[len] = calloc((n) > 0 ? (n) : 1, sizeof(*(list)[0])); \
+        (lens)[(len)++] = (n); \
+    } while (0)
+#define __scar_list_push_row(list, lens, len, cap, row, n) \
+    do { \
+        int __scar_row_len = (n); \
+        __scar_list_add_row(list, lens, len, cap, __scar_row_len); \
+        if (__scar_row_len > 0) memcpy((list)[(len) - 1], (row), __scar_row_len * sizeof(*(list)[0])); \
+    } while (0)
+#define __scar_list_pop(list, len) ((list)[--(len)])
+static inline int __scar_list_bound(int index, int len) {
+    if (index < 0) index += len;
+    return index < 0 ? 0 : index > len ? len : index;
+}
+static inline char (*__scar_list_strs(char (*out)[256], int n, ...))[256] {
+    va_list args;
+    va_start(args, n);
+    for (int i = 0; i < n; i++) strcpy(out[i], va_arg(args, const char*));
+    va_end(args);
+    return out;
+}` + "\n" + output
+}
+
+// The comparators sort! passes qsort for lists of numbers, chars and
+// strings, ordering them in ascending order.
+func insertSortRuntime(output string) string {
+	return `#include <stdbool.h>
+#include <stdint.h>
+#include <string.h>
+#define __SCAR_CMP(type) \
+    static inline int __scar_cmp_##type(const void* a, const void* b) { \
+        type x = *(const type*)a, y = *(const type*)b; \
+        return (x > y) - (x < y); \
+    }
+__SCAR_CMP(int)
+__SCAR_CMP(float)
+__SCAR_CMP(double)
+__SCAR_CMP(char)
+__SCAR_CMP(bool)
+__SCAR_CMP(long)
+__SCAR_CMP(int8_t)
+__SCAR_CMP(int16_t)
+__SCAR_CMP(int32_t)
+__SCAR_CMP(int64_t)
+__SCAR_CMP(uint8_t)
+__SCAR_CMP(uint16_t)
+__SCAR_CMP(uint32_t)
+__SCAR_CMP(uint64_t)
+static inline int __scar_cmp_str(const void* a, const void* b) {
+    return strcmp((const char*)a, (const char*)b);
+}` + "\n" + output
+}
+
+// The helpers of the list builtins, which the renderer names after the
+// builtin and the element type of the list, as in __scar_list_sum_int.
+var listUtilsPattern = regexp.MustCompile(`__scar_list_(contains|index_of|sum|min|max|reverse)`)
+
+// The helpers of contains!, index_of!, sum!, min!, max! and reverse!, made for
+// lists of each number type, chars and bools by __SCAR_LIST_UTILS. Lists of
+// strings hold arrays of 256 chars and only have contains! and index_of!.
+func insertListUtilsRuntime(output string) string {
+	return `#include <stdbool.h>
+#include <stdint.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+static inline void __scar_list_empty(const char* builtin) {
+    fflush(stdout);
+    fprintf(stderr, "%s of an empty list\n", builtin);
+    abort();
+}
+#define __SCAR_LIST_UTILS(type) \
+    static inline bool __scar_list_contains_##type(const type* list, int len, type value) { \
+        for (int i = 0; i < len; i++) if (list[i] == value) return true; \
+        return false; \
+    } \
+    static inline int __scar_list_index_of_##type(const type* list, int len, type value) { \
+        for (int i = 0; i < len; i++) if (list[i] == value) return i; \
+        return -1; \
+    } \
+    static inline type __scar_list_sum_##type(const type* list, int len) { \
+        type sum = 0; \
+        for (int i = 0; i < len; i++) sum += list[i]; \
+        return sum; \
+    } \
+    static inline type __scar_list_min_##type(const type* list, int len) { \
+        if (len == 0) __scar_list_empty("min!"); \
+        type min = list[0]; \
+        for (int i = 1; i < len; i++) if (list[i] < min) min = list[i]; \
+        return min; \
+    } \
+    static inline type __scar_list_max_##type(const type* list, int len) { \
+        if (len == 0) __scar_list_empty("max!"); \
+        type max = list[0]; \
+        for (int i = 1; i < len; i++) if (list[i] > max) max = list[i]; \
+        return max; \
+    }
+__SCAR_LIST_UTILS(int)
+__SCAR_LIST_UTILS(float)
+__SCAR_LIST_UTILS(double)
+__SCAR_LIST_UTILS(char)
+__SCAR_LIST_UTILS(bool)
+__SCAR_LIST_UTILS(long)
+__SCAR_LIST_UTILS(int8_t)
+__SCAR_LIST_UTILS(int16_t)
+__SCAR_LIST_UTILS(int32_t)
+__SCAR_LIST_UTILS(int64_t)
+__SCAR_LIST_UTILS(uint8_t)
+__SCAR_LIST_UTILS(uint16_t)
+__SCAR_LIST_UTILS(uint32_t)
+__SCAR_LIST_UTILS(uint64_t)
+static inline int __scar_list_index_of_str(char (*list)[256], int len, const char* value) {
+    for (int i = 0; i < len; i++) if (strcmp(list[i], value) == 0) return i;
+    return -1;
+}
+static inline bool __scar_list_contains_str(char (*list)[256], int len, const char* value) {
+    return __scar_list_index_of_str(list, len, value) != -1;
+}
+static inline void __scar_list_reverse_n(void* list, int len, size_t size) {
+    char* bytes = list;
+    for (int i = 0, j = len - 1; i < j; i++, j--) {
+        for (size_t k = 0; k < size; k++) {
+            char byte = bytes[i * size + k];
+            bytes[i * size + k] = bytes[j * size + k];
+            bytes[j * size + k] = byte;
+        }
+    }
+}
+#define __scar_list_reverse(list, len) __scar_list_reverse_n((list), (len), sizeof(*(list)))` + "\n" + output
+}
+
+func insertStringRuntime(output string) string {
+	return `#include <limits.h>
+#include <stdarg.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+static inline char* __scar_str_alloc(size_t size) {
+    return calloc(size, 1);
+}
+static inline char* __scar_str_new(const char* value) {
+    size_t len = strlen(value);
+    char* str = malloc(len + 1);
+    memcpy(str, value, len + 1);
+    return str;
+}
+static inline char* __scar_str_bool(int value) {
+    return __scar_str_new(value ? "true" : "false");
+}
+static inline void __scar_str_set(char** target, const char* value) {
+    char* str = __scar_str_new(value);
+    free(*target);
+    *target = str;
+}
+static inline void __scar_str_cat(char** target, const char* value) {
+    size_t len = strlen(*target), extra = strlen(value);
+    char* str = malloc(len + extra + 1);
+    memcpy(str, *target, len);
+    memcpy(str + len, value, extra + 1);
+    free(*target);
+    *target = str;
+}
+static inline char* __scar_str_concat(const char* a, const char* b) {
+    size_t len = strlen(a), extra = strlen(b);
+    char* str = malloc(len + extra + 1);
+    memcpy(str, a, len);
+    memcpy(str + len, b, extra + 1);
+    return str;
+}
+static inline char* __scar_str_format(const char* format, ...) {
+    va_list args;
+    va_start(args, format);
+    int len = vsnprintf(NULL, 0, format, args);
+    va_end(args);
+    char* str = malloc(len + 1);
+    va_start(args, format);
+    vsnprintf(str, len + 1, format, args);
+    va_end(args);
+    return str;
+}
+static inline void __scar_str_take(char** target, char* value) {
+    free(*target);
+    *target = value;
+}
+static inline char* __scar_str_slice(const char* value, int low, int high) {
+    int len = strlen(value);
+    if (low < 0) low += len;
+    if (high < 0) high += len;
+    low = low < 0 ? 0 : low > len ? len : low;
+    high = high < low ? low : high > len ? len : high;
+    char* str = malloc(high - low + 1);
+    memcpy(str, value + low, high - low);
+    str[high - low] = '\0';
+    return str;
+}` + "\n" + output
+}
+
+// The helpers behind std/string. Results are written to the output buffers of
+// the functions returning strings, and are cut short to 256 bytes at the start
+// of a UTF-8 sequence, so a character is never left half written.
+func insertStringLibRuntime(output string) string {
+	return `#include <ctype.h>
+#include <string.h>
+#define __SCAR_STRING_CAP 256
+static inline size_t __scar_string_fit(const char* value, size_t len, size_t room) {
+    if (len <= room) return len;
+    while (room > 0 && ((unsigned char)value[room] & 0xC0) == 0x80) room--;
+    return room;
+}
+static inline void __scar_string_copy(char* out, const char* value, size_t len) {
+    len = __scar_string_fit(value, len, __SCAR_STRING_CAP - 1);
+    memcpy(out, value, len);
+    out[len] = '\0';
+}
+static inline size_t __scar_string_append(char* out, size_t used, const char* value, size_t len) {
+    len = __scar_string_fit(value, len, __SCAR_STRING_CAP - 1 - used);
+    memcpy(out + used, value, len);
+    out[used + len] = '\0';
+    return used + len;
+}
+static inline int __scar_string_split(char out[][256], int max_size, const char* s, const char* sep) {
+    int count = 0;
+    size_t sep_len = strlen(sep);
+    if (sep_len == 0) {
+        for (; *s && count < max_size; s++) __scar_string_copy(out[count++], s, 1);
+        return count;
+    }
+    const char* next;
+    while (count < max_size - 1 && (next = strstr(s, sep)) != NULL) {
+        __scar_string_copy(out[count++], s, next - s);
+        s = next + sep_len;
+    }
+    if (count < max_size) __scar_string_copy(out[count++], s, strlen(s));
+    return count;
+}
+static inline void __scar_string_join(char* out, char parts[][256], int parts_len, const char* sep) {
+    size_t used = 0;
+    out[0] = '\0';
+    for (int i = 0; i < parts_len; i++) {
+        if (i > 0) used = __scar_string_append(out, used, sep, strlen(sep));
+        used = __scar_string_append(out, used, parts[i], strlen(parts[i]));
+    }
+}
+static inline void __scar_string_trim(char* out, const char* s) {
+    const char* end = s + strlen(s);
+    while (isspace((unsigned char)*s)) s++;
+    while (end > s && isspace((unsigned char)end[-1])) end--;
+    __scar_string_copy(out, s, end - s);
+}
+static inline void __scar_string_replace(char* out, const char* s, const char* old, const char* new_) {
+    size_t used = 0, old_len = strlen(old);
+    out[0] = '\0';
+    if (old_len == 0) {
+        __scar_string_copy(out, s, strlen(s));
+        return;
+    }
+    const char* next;
+    while ((next = strstr(s, old)) != NULL) {
+        used = __scar_string_append(out, used, s, next - s);
+        used = __scar_string_append(out, used, new_, strlen(new_));
+        s = next + old_len;
+    }
+    __scar_string_append(out, used, s, strlen(s));
+}
+static inline void __scar_string_to_upper(char* out, const char* s) {
+    __scar_string_copy(out, s, strlen(s));
+    for (char* c = out; *c; c++) *c = toupper((unsigned char)*c);
+}
+static inline void __scar_string_to_lower(char* out, const char* s) {
+    __scar_string_copy(out, s, strlen(s));
+    for (char* c = out; *c; c++) *c = tolower((unsigned char)*c);
+}
+static inline int __scar_string_starts_with(const char* s, const char* prefix) {
+    return strncmp(s, prefix, strlen(prefix)) == 0;
+}
+static inline int __scar_string_ends_with(const char* s, const char* suffix) {
+    size_t len = strlen(s), suffix_len = strlen(suffix);
+    return suffix_len <= len && strcmp(s + len - suffix_len, suffix) == 0;
+}
+static inline int __scar_string_find(const char* s, const char* sub) {
+    const char* found = strstr(s, sub);
+    return found ? (int)(found - s) : -1;
+}
+static inline void __scar_string_substring(char* out, const char* s, int start, int end) {
+    int len = strlen(s);
+    if (start < 0) start += len;
+    if (end < 0) end += len;
+    start = start < 0 ? 0 : start > len ? len : start;
+    end = end < start ? start : end > len ? len : end;
+    __scar_string_copy(out, s + start, end - start);
+}` + "\n" + output
+}
+
+// The helpers behind std/regex, built on POSIX extended regular expressions.
+// A pattern that fails to compile matches nothing.
+func insertRegexRuntime(output string) string {
+	return `#include <regex.h>
+#include <string.h>
+#define __SCAR_REGEX_CAP 256
+static inline size_t __scar_regex_append(char* out, size_t used, const char* value, size_t len) {
+    if (used + len > __SCAR_REGEX_CAP - 1) len = __SCAR_REGEX_CAP - 1 - used;
+    memcpy(out + used, value, len);
+    out[used + len] = '\0';
+    return used + len;
+}
+static inline int __scar_regex_valid(const char* pattern) {
+    regex_t re;
+    if (regcomp(&re, pattern, REG_EXTENDED) != 0) return 0;
+    regfree(&re);
+    return 1;
+}
+static inline int __scar_regex_match(const char* pattern, const char* s) {
+    regex_t re;
+    if (regcomp(&re, pattern, REG_EXTENDED | REG_NOSUB) != 0) return 0;
+    int found = regexec(&re, s, 0, NULL, 0) == 0;
+    regfree(&re);
+    return found;
+}
+static inline int __scar_regex_find_all(char out[][256], int max_size, const char* pattern, const char* s) {
+    regex_t re;
+    regmatch_t m;
+    int count = 0, flags = 0;
+    if (regcomp(&re, pattern, REG_EXTENDED) != 0) return 0;
+    while (count < max_size && regexec(&re, s, 1, &m, flags) == 0) {
+        out[count][0] = '\0';
+        __scar_regex_append(out[count++], 0, s + m.rm_so, m.rm_eo - m.rm_so);
+        if (m.rm_eo == m.rm_so) {
+            if (s[m.rm_eo] == '\0') break;
+            m.rm_eo++;
+        }
+        s += m.rm_eo;
+        flags = REG_NOTBOL;
+    }
+    regfree(&re);
+    return count;
+}
+static inline void __scar_regex_find(char* out, const char* pattern, const char* s) {
+    char found[1][256];
+    out[0] = '\0';
+    if (__scar_regex_find_all(found, 1, pattern, s) == 1) strcpy(out, found[0]);
+}
+static inline void __scar_regex_replace(char* out, const char* pattern, const char* s, const char* with) {
+    regex_t re;
+    regmatch_t m[10];
+    size_t used = 0;
+    int flags = 0;
+    out[0] = '\0';
+    if (regcomp(&re, pattern, REG_EXTENDED) != 0) {
+        __scar_regex_append(out, 0, s, strlen(s));
+        return;
+    }
+    while (regexec(&re, s, 10, m, flags) == 0) {
+        used = __scar_regex_append(out, used, s, m[0].rm_so);
+        for (const char* w = with; *w; w++) {
+            if (w[0] == '\\' && w[1] >= '0' && w[1] <= '9') {
+                regmatch_t g = m[w[1] - '0'];
+                if (g.rm_so != -1) used = __scar_regex_append(out, used, s + g.rm_so, g.rm_eo - g.rm_so);
+                w++;
+            } else {
+                used = __scar_regex_append(out, used, w, 1);
+            }
+        }
+        if (m[0].rm_eo == m[0].rm_so) {
+            if (s[m[0].rm_eo] == '\0') {
+                s += m[0].rm_eo;
+                break;
+            }
+            used = __scar_regex_append(out, used, s + m[0].rm_eo, 1);
+            m[0].rm_eo++;
+        }
+        s += m[0].rm_eo;
+        flags = REG_NOTBOL;
+    }
+    __scar_regex_append(out, used, s, strlen(s));
+    regfree(&re);
+}` + "\n" + output
+}
+
+// The threads started by spawn and the mutexes of std/sync, over pthreads or
+// the Windows API. Threads and mutexes are handled as void pointers.
+func insertThreadRuntime(output string) string {
+	return `#include <stdlib.h>
+#ifdef _WIN32
+#include <windows.h>
+#define __SCAR_THREAD_FN(name) DWORD WINAPI name(LPVOID __arg)
+#define __SCAR_THREAD_RETURN 0
+static inline void* __scar_thread_start(LPTHREAD_START_ROUTINE fn, void* arg) {
+    return CreateThread(NULL, 0, fn, arg, 0, NULL);
+}
+static inline void __scar_thread_join(void* thread) {
+    if (!thread) return;
+    WaitForSingleObject((HANDLE)thread, INFINITE);
+    CloseHandle((HANDLE)thread);
+}
+static inline void __scar_thread_detach(void* thread) {
+    if (thread) CloseHandle((HANDLE)thread);
+}
+static inline void* __scar_mutex_new(void) {
+    CRITICAL_SECTION* mutex = malloc(sizeof(CRITICAL_SECTION));
+    if (mutex) InitializeCriticalSection(mutex);
+    return mutex;
+}
+static inline void __scar_mutex_lock(void* mutex) { EnterCriticalSection((CRITICAL_SECTION*)mutex); }
+static inline int __scar_mutex_try_lock(void* mutex) { return TryEnterCriticalSection((CRITICAL_SECTION*)mutex) != 0; }
+static inline void __scar_mutex_unlock(void* mutex) { LeaveCriticalSection((CRITICAL_SECTION*)mutex); }
+static inline void __scar_mutex_free(void* mutex) {
+    if (!mutex) return;
+    DeleteCriticalSection((CRITICAL_SECTION*)mutex);
+    free(mutex);
+}
+#else
+#include <pthread.h>
+#define __SCAR_THREAD_FN(name) void* name(void* __arg)
+#define __SCAR_THREAD_RETURN NULL
+static inline void* __scar_thread_start(void* (*fn)(void*), void* arg) {
+    pthread_t* thread = malloc(sizeof(pthread_t));
+    if (thread && pthread_create(thread, NULL, fn, arg) != 0) {
+        free(thread);
+        thread = NULL;
+    }
+    return thread;
+}
+static inline void __scar_thread_join(void* thread) {
+    if (!thread) return;
+    pthread_join(*(pthread_t*)thread, NULL);
+    free(thread);
+}
+static inline void __scar_thread_detach(void* thread) {
+    if (!thread) return;
+    pthread_detach(*(pthread_t*)thread);
+    free(thread);
+}
+static inline void* __scar_mutex_new(void) {
+    pthread_mutex_t* mutex = malloc(sizeof(pthread_mutex_t));
+    if (mutex) pthread_mutex_init(mutex, NULL);
+    return mutex;
+}
+static inline void __scar_mutex_lock(void* mutex) { pthread_mutex_lock((pthread_mutex_t*)mutex); }
+static inline int __scar_mutex_try_lock(void* mutex) { return pthread_mutex_trylock((pthread_mutex_t*)mutex) == 0; }
+static inline void __scar_mutex_unlock(void* mutex) { pthread_mutex_unlock((pthread_mutex_t*)mutex); }
+static inline void __scar_mutex_free(void* mutex) {
+    if (!mutex) return;
+    pthread_mutex_destroy((pthread_mutex_t*)mutex);
+    free(mutex);
+}
+#endif` + "\n" + output
+}
+
+// The helpers behind the commands and environment of std/os. Exit codes are
+// those the commands exited with, or -1 when they could not be run.
+func insertOSRuntime(output string) string {
+	return `#include <stdio.h>
+#include <stdlib.h>
+#ifdef _WIN32
+#define __scar_popen _popen
+#define __scar_pclose _pclose
+static inline int __scar_exit_code(int status) {
+    return status;
+}
+#else
+#include <sys/wait.h>
+#define __scar_popen popen
+#define __scar_pclose pclose
+static inline int __scar_exit_code(int status) {
+    return status != -1 && WIFEXITED(status) ? WEXITSTATUS(status) : -1;
+}
+#endif
+static inline int __scar_os_exec(const char* command) {
+    fflush(stdout);
+    return __scar_exit_code(system(command));
+}
+static inline char* __scar_os_capture(const char* command, int* code) {
+    size_t len = 0, cap = 256;
+    char* output = malloc(cap);
+    output[0] = '\0';
+    fflush(stdout);
+    FILE* pipe = __scar_popen(command, "r");
+    if (pipe == NULL) {
+        *code = -1;
+        return output;
+    }
+    size_t n;
+    while ((n = fread(output + len, 1, cap - len - 1, pipe)) > 0) {
+        len += n;
+        if (len + 1 == cap) output = realloc(output, cap *= 2);
+    }
+    output[len] = '\0';
+    *code = __scar_exit_code(__scar_pclose(pipe));
+    return output;
+}
+static inline int __scar_os_set_env(const char* name, const char* value) {
+#ifdef _WIN32
+    return _putenv_s(name, value) == 0;
+#else
+    return setenv(name, value, 1) == 0;
+#endif
+}` + "\n" + output
+}
+
+// input() reads a line of standard input into a new heap string, without its
+// line ending. read_int() and read_float() read the next number, skipping
+// whitespace like scanf. Input that is not a number is skipped up to the end
+// of its line and reads as 0.
+func insertInputRuntime(output string) string {
+	return `#include <stdio.h>
+#include <stdlib.h>
+static inline char* __scar_input(void) {
+    size_t len = 0, cap = 128;
+    char* line = malloc(cap);
+    int c;
+    fflush(stdout);
+    while ((c = getchar()) != EOF && c != '\n') {
+        if (len + 1 >= cap) line = realloc(line, cap *= 2);
+        line[len++] = (char)c;
+    }
+    if (len > 0 && line[len - 1] == '\r') len--;
+    line[len] = '\0';
+    return line;
+}
+static inline void __scar_skip_line(void) {
+    int c;
+    while ((c = getchar()) != EOF && c != '\n') {
+    }
+}
+static inline int __scar_read_int(void) {
+    int value = 0;
+    fflush(stdout);
+    if (scanf("%d", &value) != 1) {
+        value = 0;
+    }
+    __scar_skip_line();
+    return value;
+}
+static inline double __scar_read_float(void) {
+    double value = 0;
+    fflush(stdout);
+    if (scanf("%lf", &value) != 1) {
+        value = 0;
+    }
+    __scar_skip_line();
+    return value;
+}` + "\n" + output
+}
+
+// The helpers behind the files of std/io. Lines are read into heap buffers
+// that grow to fit them, and lose their line endings, \n or \r\n.
+func insertIORuntime(output string) string {
+	return `#include <stdio.h>
+#include <stdlib.h>
+static inline int __scar_io_getline(char** line, size_t* cap, FILE* file) {
+    size_t len = 0;
+    int c = EOF;
+    if (*line == NULL || *cap == 0) {
+        *cap = 128;
+        *line = realloc(*line, *cap);
+    }
+    if (file != NULL) {
+        while ((c = fgetc(file)) != EOF && c != '\n') {
+            if (len + 1 >= *cap) {
+                *cap *= 2;
+                *line = realloc(*line, *cap);
+            }
+            (*line)[len++] = (char)c;
+        }
+    }
+    if (len > 0 && (*line)[len - 1] == '\r') len--;
+    (*line)[len] = '\0';
+    return c != EOF || len > 0;
+}
+static inline char* __scar_io_read_line(FILE* file) {
+    char* line = NULL;
+    size_t cap = 0;
+    __scar_io_getline(&line, &cap, file);
+    return line;
+}
+static inline int __scar_io_at_end(FILE* file) {
+    if (file == NULL) return 1;
+    int c = fgetc(file);
+    if (c == EOF) return 1;
+    ungetc(c, file);
+    return 0;
+}` + "\n" + output
+}
+
+// Sleeps for a number of microseconds, which may be fractional, for sleep
+// statements that are not in whole seconds. Sleeps interrupted by a signal
+// are resumed.
+// Inserts the trap breakpoint statements are compiled to, which stops the
+// program in the debugger like a breakpoint set on the line.
+func insertBreakpointRuntime(output string) string {
+	return `#ifdef _WIN32
+#include <intrin.h>
+#define __scar_breakpoint() __debugbreak()
+#else
+#include <signal.h>
+#define __scar_breakpoint() raise(SIGTRAP)
+#endif
+` + output
+}
+
+func insertSleepRuntime(output string) string {
+	return `#ifdef _WIN32
+__declspec(dllimport) void __stdcall Sleep(unsigned long ms);
+static inline void __scar_sleep_us(double us) {
+    if (us > 0) Sleep((unsigned long)(us / 1000.0));
+}
+#else
+#include <errno.h>
+#include <time.h>
+static inline void __scar_sleep_us(double us) {
+    if (us <= 0) return;
+    struct timespec ts;
+    ts.tv_sec = (time_t)(us / 1000000.0);
+    ts.tv_nsec = (long)((us - ts.tv_sec * 1000000.0) * 1000.0);
+    while (nanosleep(&ts, &ts) != 0 && errno == EINTR) {
+    }
+}
+#endif` + "\n" + output
+}
+
+// The helpers behind std/math, which call the C math library. Programs
+// importing std/math are linked against it.
+func insertMathRuntime(output string) string {
+	return `#include <math.h>
+static inline double __scar_math_sqrt(double x) { return sqrt(x); }
+static inline double __scar_math_pow(double base, double exp) { return pow(base, exp); }
+static inline double __scar_math_sin(double x) { return sin(x); }
+static inline double __scar_math_cos(double x) { return cos(x); }
+static inline double __scar_math_abs(double x) { return fabs(x); }
+static inline double __scar_math_floor(double x) { return floor(x); }
+static inline double __scar_math_ceil(double x) { return ceil(x); }` + "\n" + output
+}
+
+// Maps are hash tables with open addressing and linear probing. Entries are
+// stored densely in insertion order, which is also the iteration order, and
+// the slots of the table hold entry numbers. Keys and values are stored by
+// value; string keys and values are owned heap copies.
+func insertMapRuntime(output string) string {
+	return `#include <stdint.h>
+#include <stdlib.h>
+#include <string.h>
+typedef struct {
+    char* keys;
+    char* values;
+    unsigned char* live;
+    int* slots;
+    int len, count, cap;
+    int key_size, value_size;
+    int string_keys, string_values;
+} __scar_map;
+static const char* __scar_map_empty = "";
+static const union { long double f; void* p; long long i; } __scar_map_zero;
+#define __scar_map_key(map, entry) ((map)->keys + (size_t)(entry) * (map)->key_size)
+#define __scar_map_value(map, entry) ((map)->values + (size_t)(entry) * (map)->value_size)
+static inline __scar_map __scar_map_new(int key_size, int value_size, int string_keys, int string_values) {
+    __scar_map map = {0};
+    map.key_size = key_size;
+    map.value_size = value_size;
+    map.string_keys = string_keys;
+    map.string_values = string_values;
+    return map;
+}
+static inline char* __scar_map_str(const char* value) {
+    size_t len = strlen(value);
+    char* str = malloc(len + 1);
+    memcpy(str, value, len + 1);
+    return str;
+}
+static inline int __scar_map_slot(const __scar_map* map, const void* key) {
+    const unsigned char* bytes = key;
+    size_t n = map->key_size;
+    if (map->string_keys) {
+        bytes = *(const unsigned char* const*)key;
+        n = strlen((const char*)bytes);
+    }
+    uint64_t hash = 14695981039346656037ULL;
+    for (size_t i = 0; i < n; i++) {
+        hash = (hash ^ bytes[i]) * 1099511628211ULL;
+    }
+    return (int)(hash & (uint64_t)(map->cap - 1));
+}
+static inline int __scar_map_equal(const __scar_map* map, const void* a, const void* b) {
+    if (map->string_keys) {
+        return strcmp(*(char* const*)a, *(char* const*)b) == 0;
+    }
+    return memcmp(a, b, map->key_size) == 0;
+}
+// Returns the slot holding key, or -1. Slots are -1 when empty and -2 when
+// their entry was deleted.
+static inline int __scar_map_find(const __scar_map* map, const void* key) {
+    if (map->cap == 0) {
+        return -1;
+    }
+    for (int i = __scar_map_slot(map, key);; i = (i + 1) & (map->cap - 1)) {
+        int entry = map->slots[i];
+        if (entry == -1) {
+            return -1;
+        }
+        if (entry >= 0 && __scar_map_equal(map, __scar_map_key(map, entry), key)) {
+            return i;
+        }
+    }
+}
+// Rebuilds the table with room for twice the live entries, dropping deleted ones.
+static inline void __scar_map_rebuild(__scar_map* map) {
+    __scar_map old = *map;
+    int cap = 8;
+    while (cap < (old.len + 1) * 2) {
+        cap *= 2;
+    }
+    map->keys = calloc(cap, map->key_size);
+    map->values = calloc(cap, map->value_size);
+    map->live = calloc(cap, 1);
+    map->slots = malloc(cap * sizeof(int));
+    memset(map->slots, 0xff, cap * sizeof(int));
+    map->cap = cap;
+    map->count = 0;
+    for (int entry = 0; entry < old.count; entry++) {
+        if (!old.live[entry]) {
+            continue;
+        }
+        int n = map->count++;
+        memcpy(__scar_map_key(map, n), __scar_map_key(&old, entry), map->key_size);
+        memcpy(__scar_map_value(map, n), __scar_map_value(&old, entry), map->value_size);
+        map->live[n] = 1;
+        int i = __scar_map_slot(map, __scar_map_key(map, n));
+        while (map->slots[i] != -1) {
+            i = (i + 1) & (cap - 1);
+        }
+        map->slots[i] = n;
+    }
+    free(old.keys);
+    free(old.values);
+    free(old.live);
+    free(old.slots);
+}
+// Returns the value of key, adding the key with a zero value if it is missing.
+static inline void* __scar_map_entry(__scar_map* map, const void* key) {
+    int i = __scar_map_find(map, key);
+    if (i >= 0) {
+        return __scar_map_value(map, map->slots[i]);
+    }
+    if ((map->count + 1) * 4 > map->cap * 3) {
+        __scar_map_rebuild(map);
+    }
+    i = __scar_map_slot(map, key);
+    while (map->slots[i] >= 0) {
+        i = (i + 1) & (map->cap - 1);
+    }
+    int entry = map->count++;
+    map->slots[i] = entry;
+    map->live[entry] = 1;
+    map->len++;
+    if (map->string_keys) {
+        *(char**)__scar_map_key(map, entry) = __scar_map_str(*(char* const*)key);
+    } else {
+        memcpy(__scar_map_key(map, entry), key, map->key_size);
+    }
+    memset(__scar_map_value(map, entry), 0, map->value_size);
+    return __scar_map_value(map, entry);
+}
+static inline void __scar_map_put(__scar_map* map, const void* key, const void* value) {
+    void* slot = __scar_map_entry(map, key);
+    if (map->string_values) {
+        char* str = __scar_map_str(*(char* const*)value);
+        free(*(char**)slot);
+        *(char**)slot = str;
+    } else {
+        memcpy(slot, value, map->value_size);
+    }
+}
+// Returns the value of key, or a zero value if it is missing.
+static inline const void* __scar_map_get(const __scar_map* map, const void* key) {
+    int i = __scar_map_find(map, key);
+    if (i < 0) {
+        return map->string_values ? (const void*)&__scar_map_empty : (const void*)&__scar_map_zero;
+    }
+    return __scar_map_value(map, map->slots[i]);
+}
+static inline int __scar_map_has(const __scar_map* map, const void* key) {
+    return __scar_map_find(map, key) >= 0;
+}
+// Removes key, reporting whether it was present. Its slot is left as a
+// tombstone so probing continues past it until the next rebuild.
+static inline int __scar_map_del(__scar_map* map, const void* key) {
+    int i = __scar_map_find(map, key);
+    if (i < 0) {
+        return 0;
+    }
+    int entry = map->slots[i];
+    if (map->string_keys) {
+        free(*(char**)__scar_map_key(map, entry));
+    }
+    if (map->string_values) {
+        free(*(char**)__scar_map_value(map, entry));
+    }
+    map->live[entry] = 0;
+    map->slots[i] = -2;
+    map->len--;
+    return 1;
+}
+static inline void __scar_map_free(__scar_map* map) {
+    for (int entry = 0; entry < map->count; entry++) {
+        if (map->live[entry] && map->string_keys) {
+            free(*(char**)__scar_map_key(map, entry));
+        }
+        if (map->live[entry] && map->string_values) {
+            free(*(char**)__scar_map_value(map, entry));
+        }
+    }
+    free(map->keys);
+    free(map->values);
+    free(map->live);
+    free(map->slots);
+    *map = __scar_map_new(map->key_size, map->value_size, map->string_keys, map->string_values);
+}
+// Replaces the contents of target with a copy of source.
+static inline void __scar_map_copy(__scar_map* target, const __scar_map* source) {
+    __scar_map copy = __scar_map_new(source->key_size, source->value_size, source->string_keys, source->string_values);
+    for (int entry = 0; entry < source->count; entry++) {
+        if (source->live[entry]) {
+            __scar_map_put(&copy, __scar_map_key(source, entry), __scar_map_value(source, entry));
+        }
+    }
+    __scar_map_free(target);
+    *target = copy;
+}` + "\n" + output
+}
+
+// Optionals are pointers that are NULL when nil. Unwrapping a nil optional
+// stops the program with the name of the value rather than crashing on the
+// dereference, and optional numbers are stored in heap boxes.
+func insertOptionalRuntime(output string) string {
+	return `#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+static inline void* __scar_unwrap_at(void* value, const char* name) {
+    if (value == NULL) {
+        fprintf(stderr, "error: '%s' is nil\n", name);
+        exit(1);
+    }
+    return value;
+}
+#define __scar_unwrap(value, name) ((__typeof__(value))__scar_unwrap_at((void*)(value), name))
+#define __scar_box(type, value) ((type*)memcpy(malloc(sizeof(type)), &(type){value}, sizeof(type)))` + "\n" + output
+}
+
+// Includes the OpenMP runtime when the program is compiled with OpenMP, and
+// otherwise defines the functions of it the generated code calls as those of
+// a program running on a single thread.
+func insertOpenMPRuntime(output string) string {
+	return `#ifdef _OPENMP
+#include <omp.h>
+#else
+static inline int omp_get_thread_num(void) { return 0; }
+static inline int omp_get_num_threads(void) { return 1; }
+static inline int omp_get_max_threads(void) { return 1; }
+static inline int omp_get_num_procs(void) { return 1; }
+static inline int omp_get_level(void) { return 0; }
+static inline int omp_in_parallel(void) { return 0; }
+static inline void omp_set_num_threads(int n) { (void)n; }
+#endif` + "\n" + output
+}
+
+// to_int and to_float take a whole string holding a number, allowing spaces
+// around it, and otherwise throw an exception naming the string. They rely on
+// the exception runtime, which is inserted above them.
+func insertConversionRuntime(output string) string {
+	return `#include <ctype.h>
+#include <errno.h>
+#include <limits.h>
+#include <math.h>
+#include <stdio.h>
+#include <stdlib.h>
+static void __scar_conversion_failed(const char* value, const char* type) {
+    char message[256];
+    snprintf(message, sizeof(message), "cannot convert '%.200s' to %s", value, type);
+    __scar_throw(1, message);
+}
+static inline int __scar_to_int(const char* value) {
+    char* end;
+    errno = 0;
+    long result = strtol(value, &end, 10);
+    while (isspace((unsigned char)*end)) end++;
+    if (end == value || *end != '\0' || errno == ERANGE || result < INT_MIN || result > INT_MAX) {
+        __scar_conversion_failed(value, "int");
+    }
+    return (int)result;
+}
+static inline float __scar_to_float(const char* value) {
+    char* end;
+    errno = 0;
+    double result = strtod(value, &end);
+    while (isspace((unsigned char)*end)) end++;
+    if (end == value || *end != '\0' || (errno == ERANGE && (result == HUGE_VAL || result == -HUGE_VAL))) {
+        __scar_conversion_failed(value, "float");
+    }
+    return (float)result;
+}` + "\n" + output
+}
+
+// The helpers behind ulen, foreach over the code points of a string and
+// string::usubstring. A byte that does not start a valid UTF-8 sequence is
+// taken as a code point of its own, so invalid text is still walked to its end.
+func insertUTF8Runtime(output string) string {
+	return `static inline int __scar_utf8_size(const char* s) {
+    unsigned char c = (unsigned char)s[0];
+    int size = c == 0 ? 0 : c < 0x80 ? 1 : c >= 0xC2 && c < 0xE0 ? 2 : c >= 0xE0 && c < 0xF0 ? 3 : c >= 0xF0 && c < 0xF5 ? 4 : 1;
+    for (int i = 1; i < size; i++) {
+        if (((unsigned char)s[i] & 0xC0) != 0x80) return 1;
+    }
+    return size;
+}
+static inline int __scar_utf8_len(const char* s) {
+    int count = 0;
+    for (int n; (n = __scar_utf8_size(s)) > 0; s += n) count++;
+    return count;
+}
+static inline int __scar_utf8_offset(const char* s, int index) {
+    if (index < 0) index += __scar_utf8_len(s);
+    int offset = 0;
+    for (int n; index > 0 && (n = __scar_utf8_size(s + offset)) > 0; index--) offset += n;
+    return offset;
+}` + "\n" + output
+}
+
+// Inserts the integer arithmetic and casts checked with --safe. Each helper
+// throws an exception when the result does not fit its type, or when dividing
+// by zero. The quotient of the smallest signed value and -1 is computed as a
+// negation so it overflows instead of trapping. A cast takes its value as the
+// widest integer of its signedness, which holds any value cast to it.
+func insertCheckedArithmeticRuntime(output string) string {
+	return `#include <stdint.h>
+static void __scar_overflow(const char* op, const char* type) {
+    char message[64];
+    snprintf(message, sizeof(message), "%s overflow in %s arithmetic", op, type);
+    __scar_throw(1, message);
+}
+static void __scar_cast_failed(const char* type) {
+    char message[64];
+    snprintf(message, sizeof(message), "value out of range of %s in cast", type);
+    __scar_throw(1, message);
+}
+#define __SCAR_CHECKED(type) \
+    static inline type __scar_checked_cast_##type(long long value) { \
+        type result; \
+        if (__builtin_add_overflow(value, 0, &result)) __scar_cast_failed(#type); \
+        return result; \
+    } \
+    static inline type __scar_checked_ucast_##type(unsigned long long value) { \
+        type result; \
+        if (__builtin_add_overflow(value, 0, &result)) __scar_cast_failed(#type); \
+        return result; \
+    } \
+    static inline type __scar_checked_add_##type(type a, type b) { \
+        type result; \
+        if (__builtin_add_overflow(a, b, &result)) __scar_overflow("addition", #type); \
+        return result; \
+    } \
+    static inline type __scar_checked_sub_##type(type a, type b) { \
+        type result; \
+        if (__builtin_sub_overflow(a, b, &result)) __scar_overflow("subtraction", #type); \
+        return result; \
+    } \
+    static inline type __scar_checked_mul_##type(type a, type b) { \
+        type result; \
+        if (__builtin_mul_overflow(a, b, &result)) __scar_overflow("multiplication", #type); \
+        return result; \
+    } \
+    static inline type __scar_checked_div_##type(type a, type b) { \
+        if (b == 0) __scar_throw(1, "division by zero"); \
+        if ((type)-1 < 0 && b == (type)-1) return __scar_checked_sub_##type(0, a); \
+        return a / b; \
+    } \
+    static inline type __scar_checked_mod_##type(type a, type b) { \
+        if (b == 0) __scar_throw(1, "modulo by zero"); \
+        if ((type)-1 < 0 && b == (type)-1) return 0; \
+        return a % b; \
+    }
+__SCAR_CHECKED(int)
+__SCAR_CHECKED(long)
+__SCAR_CHECKED(int8_t)
+__SCAR_CHECKED(int16_t)
+__SCAR_CHECKED(uint8_t)
+__SCAR_CHECKED(uint16_t)
+__SCAR_CHECKED(uint32_t)
+__SCAR_CHECKED(uint64_t)
+` + output
+}
+
+// A panic prints its message and the functions on the context stack, which
+// --debug builds push every function on, then aborts. A function pops itself
+// through a cleanup attribute however it returns. The stack is a weak symbol
+// so the units of separately compiled modules share it.
+func insertPanicRuntime(output string) string {
+	return `#include <stdio.h>
+#include <stdlib.h>
+typedef struct __scar_context {
+    const char* name;
+    struct __scar_context* prev;
+} __scar_context;
+__attribute__((weak)) _Thread_local __scar_context* __scar_context_top = NULL;
+static inline void __scar_context_leave(__scar_context* context) {
+    __scar_context_top = context->prev;
+}
+#define __scar_context_enter(name) \
+    __attribute__((cleanup(__scar_context_leave))) __scar_context __scar_context_here = {(name), __scar_context_top}; \
+    __scar_context_top = &__scar_context_here
+static void __scar_panic_at(const char* message, const char* file, int line) {
+    fflush(stdout);
+    fprintf(stderr, "%s:%d: panic: %s\n", file, line, message);
+    for (__scar_context* context = __scar_context_top; context != NULL; context = context->prev) {
+        fprintf(stderr, "    in %s\n", context->name);
+    }
+    abort();
+}
+#define __scar_panic(message) __scar_panic_at((message), __FILE__, __LINE__)
+` + output
+}
+
+// Every try block pushes a frame on a thread local stack and throw longjmps to
+// the innermost one. Frames remember the OpenMP nesting level they were pushed
+// at, so an exception never unwinds out of a parallel region. The stack is a
+// weak symbol so the units of separately compiled modules share it.
+func insertExceptionRuntime(output string) string {
+	return `#include <setjmp.h>
+#include <stdio.h>
+#include <stdlib.h>
+typedef struct __scar_exception {
+    int code;
+    char message[256];
+} __scar_exception;
+typedef struct __scar_try_frame {
+    jmp_buf env;
+    int level;
+    struct __scar_try_frame* prev;
+} __scar_try_frame;
+__attribute__((weak)) _Thread_local __scar_try_frame* __scar_try_top = NULL;
+__attribute__((weak)) _Thread_local __scar_exception __scar_current_exception;
+static inline void __scar_try_push(__scar_try_frame* frame) {
+    frame->level = omp_get_level();
+    frame->prev = __scar_try_top;
+    __scar_try_top = frame;
+}
+static void __scar_rethrow(void) {
+    if (__scar_try_top == NULL || __scar_try_top->level != omp_get_level()) {
+        fflush(stdout);
+        fprintf(stderr, "Uncaught exception: %s\n", __scar_current_exception.message);
+        exit(1);
+    }
+    longjmp(__scar_try_top->env, 1);
+}
+static void __scar_throw(int code, const char* message) {
+    __scar_current_exception.code = code;
+    if (message != NULL) {
+        snprintf(__scar_current_exception.message, sizeof(__scar_current_exception.message), "%s", message);
+    } else {
+        snprintf(__scar_current_exception.message, sizeof(__scar_current_exception.message), "exception %d", code);
+    }
+    __scar_rethrow();
+}` + "\n" + output
+}
+
+// A failing assertion prints the scar line it is on. Inside a test it records
+// the failure and longjmps back to the test block, which skips the rest of
+// the test, and outside of one it stops the program. assert_eq! picks the
+// comparison by the type of its left operand, comparing floating point
+// numbers within the precision of their type. The state of the tests is weak
+// so assertions in separately compiled modules share it.
+func insertTestRuntime(output string) string {
+	return `#include <setjmp.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+__attribute__((weak)) jmp_buf __scar_test_env;
+__attribute__((weak)) const char* __scar_test_name = NULL;
+__attribute__((weak)) int __scar_tests_passed = 0;
+__attribute__((weak)) int __scar_tests_failed = 0;
+static void __scar_test_start(const char* name) {
+    __scar_test_name = name;
+}
+static void __scar_test_pass(void) {
+    __scar_tests_passed++;
+    printf("test %s ... ok\n", __scar_test_name);
+    __scar_test_name = NULL;
+}
+static void __scar_assert_fail(const char* file, int line, const char* source, const char* detail) {
+    fflush(stdout);
+    fprintf(stderr, "%s:%d: %s failed%s\n", file, line, source, detail);
+    if (__scar_test_name == NULL) {
+        exit(1);
+    }
+    __scar_tests_failed++;
+    printf("test %s ... FAILED\n", __scar_test_name);
+    __scar_test_name = NULL;
+    longjmp(__scar_test_env, 1);
+}
+static void __scar_assert_message(const char* file, int line, const char* source, const char* message) {
+    char detail[512] = "";
+    if (message != NULL) {
+        snprintf(detail, sizeof(detail), ": %s", message);
+    }
+    __scar_assert_fail(file, line, source, detail);
+}
+#ifdef NDEBUG
+#define __scar_assert_debug(condition, source, message) ((void)0)
+#else
+#define __scar_assert_debug(condition, source, message) \
+    do { \
+        if (!(condition)) __scar_assert_message(__FILE__, __LINE__, source, message); \
+    } while (0)
+#endif
+static void __scar_assert_eq_int(long long left, long long right, const char* source, const char* file, int line) {
+    if (left != right) {
+        char detail[96];
+        snprintf(detail, sizeof(detail), ": left is %lld, right is %lld", left, right);
+        __scar_assert_fail(file, line, source, detail);
+    }
+}
+static void __scar_assert_eq_char(char left, char right, const char* source, const char* file, int line) {
+    if (left != right) {
+        char detail[64];
+        snprintf(detail, sizeof(detail), ": left is '%c', right is '%c'", left, right);
+        __scar_assert_fail(file, line, source, detail);
+    }
+}
+static void __scar_assert_eq_real(double left, double right, double epsilon, const char* source, const char* file, int line) {
+    double difference = left > right ? left - right : right - left;
+    double scale = left < 0 ? -left : left;
+    if ((right < 0 ? -right : right) > scale) {
+        scale = right < 0 ? -right : right;
+    }
+    if (difference > epsilon * (scale > 1 ? scale : 1)) {
+        char detail[96];
+        snprintf(detail, sizeof(detail), ": left is %g, right is %g", left, right);
+        __scar_assert_fail(file, line, source, detail);
+    }
+}
+static void __scar_assert_eq_float(float left, double right, const char* source, const char* file, int line) {
+    __scar_assert_eq_real(left, right, 1e-6, source, file, line);
+}
+static void __scar_assert_eq_double(double left, double right, const char* source, const char* file, int line) {
+    __scar_assert_eq_real(left, right, 1e-9, source, file, line);
+}
+static void __scar_assert_eq_str(const char* left, const char* right, const char* source, const char* file, int line) {
+    if (left == NULL || right == NULL ? left != right : strcmp(left, right) != 0) {
+        char detail[512];
+        snprintf(detail, sizeof(detail), ": left is \"%s\", right is \"%s\"", left ? left : "nil", right ? right : "nil");
+        __scar_assert_fail(file, line, source, detail);
+    }
+}
+#define __scar_assert_eq(left, right, source) _Generic((left), \
+    char*: __scar_assert_eq_str, const char*: __scar_assert_eq_str, char: __scar_assert_eq_char, \
+    float: __scar_assert_eq_float, double: __scar_assert_eq_double, \
+    default: __scar_assert_eq_int)((left), (right), source, __FILE__, __LINE__)
+static int __scar_test_summary(void) {
+    printf("test result: %s. %d passed; %d failed\n", __scar_tests_failed > 0 ? "FAILED" : "ok", __scar_tests_passed, __scar_tests_failed);
+    return __scar_tests_failed > 0;
+}` + "\n" + output
+}
+
+// A bench block reports how long an iteration of its body took once its
+// iterations ran for at least a second, or right away when their number was
+// fixed.
+func insertBenchRuntime(output string) string {
+	return `#include <stdio.h>
+#include <time.h>
+static long long __scar_bench_now(void) {
+    struct timespec now;
+    clock_gettime(CLOCK_MONOTONIC, &now);
+    return (long long)now.tv_sec * 1000000000LL + now.tv_nsec;
+}
+static int __scar_bench_report(const char* name, long long iterations, long long elapsed, int fixed) {
+    if (!fixed && elapsed < 1000000000LL && iterations < (1LL << 40)) {
+        return 0;
+    }
+    printf("bench %-24s %12lld iterations %14.1f ns/op\n", name, iterations, (double)elapsed / iterations);
+    return 1;
+}` + "\n" + output
+}
+
+// Objects of --mem=rc programs are preceded by a header holding their
+// reference count and their deinit function. The count is updated atomically
+// so objects may be shared with parallel loops, and an object is deinitialised
+// and freed once its last reference is released.
+func insertRCRuntime(output string) string {
+	return `#include <stdlib.h>
+typedef struct __scar_rc_header {
+    long count;
+    void (*deinit)(void*);
+} __scar_rc_header;
+static void* __scar_rc_alloc(size_t size, void (*deinit)(void*)) {
+    __scar_rc_header* header = malloc(sizeof(__scar_rc_header) + size);
+    if (header == NULL) {
+        return NULL;
+    }
+    header->count = 1;
+    header->deinit = deinit;
+    return header + 1;
+}
+static void* __scar_retain(void* object) {
+    if (object != NULL) {
+        __atomic_add_fetch(&((__scar_rc_header*)object - 1)->count, 1, __ATOMIC_RELAXED);
+    }
+    return object;
+}
+static void __scar_release(void* object) {
+    if (object == NULL) {
+        return;
+    }
+    __scar_rc_header* header = (__scar_rc_header*)object - 1;
+    if (__atomic_sub_fetch(&header->count, 1, __ATOMIC_ACQ_REL) > 0) {
+        return;
+    }
+    if (header->deinit != NULL) {
+        header->deinit(object);
+    }
+    free(header);
+}
+#define __scar_rc_set(target, value) do { void* __scar_rc_value = (value); __scar_retain(__scar_rc_value); __scar_release(target); (target) = __scar_rc_value; } while (0)
+#define __scar_rc_move(target, value) do { void* __scar_rc_value = (value); __scar_release(target); (target) = __scar_rc_value; } while (0)` + "\n" + output
+}
+
+// Objects of --mem=arena programs are carved out of large blocks which are
+// only returned to the system when the program exits.
+func insertArenaRuntime(output string) string {
+	return `#include <stddef.h>
+#include <stdlib.h>
+#include <string.h>
+#define __SCAR_ARENA_BLOCK 65536
+typedef struct __scar_arena_block {
+    struct __scar_arena_block* next;
+    size_t used;
+    size_t size;
+    max_align_t data[];
+} __scar_arena_block;
+static __scar_arena_block* __scar_arena = NULL;
+static void __scar_arena_release(void) {
+    while (__scar_arena != NULL) {
+        __scar_arena_block* next = __scar_arena->next;
+        free(__scar_arena);
+        __scar_arena = next;
+    }
+}
+static void* __scar_arena_alloc(size_t size) {
+    void* ptr = NULL;
+    size = (size + sizeof(max_align_t) - 1) / sizeof(max_align_t) * sizeof(max_align_t);
+    #pragma omp critical(__scar_arena)
+    {
+        if (__scar_arena == NULL || __scar_arena->used + size > __scar_arena->size) {
+            size_t capacity = size > __SCAR_ARENA_BLOCK ? size : __SCAR_ARENA_BLOCK;
+            __scar_arena_block* block = malloc(sizeof(__scar_arena_block) + capacity);
+            if (block != NULL) {
+                block->next = __scar_arena;
+                block->used = 0;
+                block->size = capacity;
+                __scar_arena = block;
+            }
+        }
+        if (__scar_arena != NULL && __scar_arena->used + size <= __scar_arena->size) {
+            ptr = (char*)__scar_arena->data + __scar_arena->used;
+            __scar_arena->used += size;
+        }
+    }
+    return ptr == NULL ? NULL : memset(ptr, 0, size);
+}
+__attribute__((constructor)) static void __scar_arena_init(void) { atexit(__scar_arena_release); }` + "\n" + output
+}
+
 func insertCstring(output string) string {
 	return "typedef char* cstring;\n" + output
 }
@@ -87,9 +1493,65 @@ func insertOrd(output string) string {
 	return "#define ord(x) ((int)(x))\n" + output
 }
 
+func insertChr(output string) string {
+	return "#define chr(x) ((char)(x))\n" + output
+}
+
+func insertArgc(output string) string {
+	return "#define argc() __global_argc\n" + output
+}
+
+// list[string] a = args() copies the command line of the program, including
+// its own path, into the list.
+func insertArgs(output string) string {
+	return `#include <stdio.h>
+extern int __global_argc;
+extern char** __global_argv;
+static inline int __scar_args(char output[][256], int max_size) {
+    int count = 0;
+    for (; count < __global_argc && count < max_size; count++) {
+        snprintf(output[count], 256, "%s", __global_argv[count]);
+    }
+    return count;
+}` + "\n" + output
+}
+
+// The random numbers of the rand builtin and of std/random, drawn from rand()
+// and seeded from the clock unless a seed is given. The seeded flag is weak
+// so that every unit of a program shares it, and a seed given in one is not
+// overwritten by another.
 func insertRand(output string) string {
-	return "#include <stdlib.h>\n#include <time.h>\nstatic int __scar_rand_seeded = 0;\nstatic inline int __scar_rand(int x, int y) { if (!__scar_rand_seeded)" +
-		" { srand(time(NULL)); __scar_rand_seeded = 1; } return (rand() % ((y) - (x) + 1)) + (x); }\n#define rand__internal(x, y) __scar_rand((x), (y))\n" + output
+	return `#include <stdlib.h>
+#include <time.h>
+__attribute__((weak)) int __scar_random_seeded = 0;
+static inline void __scar_random_seed(unsigned int seed) {
+    srand(seed);
+    __scar_random_seeded = 1;
+}
+static inline void __scar_random_init(void) {
+    if (!__scar_random_seeded) __scar_random_seed((unsigned int)time(NULL));
+}
+static inline int __scar_random_int(int lo, int hi) {
+    __scar_random_init();
+    if (lo > hi) {
+        int tmp = lo;
+        lo = hi;
+        hi = tmp;
+    }
+    return lo + (int)(rand() / ((double)RAND_MAX + 1.0) * ((double)hi - lo + 1));
+}
+static inline double __scar_random_float(void) {
+    __scar_random_init();
+    return rand() / ((double)RAND_MAX + 1.0);
+}
+static inline void __scar_random_shuffle(int* items, int len) {
+    for (int i = len - 1; i > 0; i--) {
+        int j = __scar_random_int(0, i), tmp = items[i];
+        items[i] = items[j];
+        items[j] = tmp;
+    }
+}
+#define rand__internal(x, y) __scar_random_int((x), (y))` + "\n" + output
 }
 
 func replaceRandCalls(output string) string {
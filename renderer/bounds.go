@@ -0,0 +1,57 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains the runtime checks of list indexing made with --bounds-check.
+//
+// A checked index is wrapped in __scar_check_index, which aborts naming the
+// scar file and line through the #line directives when the index is out of
+// range. Map lookups need no check, as missing keys read as zero values.
+
+package renderer
+
+import (
+	"fmt"
+
+	"scar/lexer"
+)
+
+func (r *Renderer) renderIndexExpr(e *lexer.IndexExpr) string {
+	index := r.renderExpr(e.Index)
+	if length, ok := r.indexedLength(e.Object); ok {
+		index = r.checkedIndex(index, length)
+	}
+	return fmt.Sprintf("%s[%s]", r.renderExpr(e.Object), index)
+}
+
+// Returns the C expression of an index, checked against length with
+// --bounds-check.
+func (r *Renderer) checkedIndex(index, length string) string {
+	if !r.opts.BoundsCheck {
+		return index
+	}
+	return fmt.Sprintf("__scar_check_index(%s, %s)", index, length)
+}
+
+// Returns the length of the list an index expression indexes, for lists
+// list fields and the rows of nested lists.
+func (r *Renderer) indexedLength(object lexer.Expr) (string, bool) {
+	switch o := object.(type) {
+	case *lexer.IdentExpr:
+		return r.listLength(o.Name)
+	case *lexer.MemberExpr:
+		if _, ok := r.listFieldType(o); ok {
+			return r.renderExpr(o) + "_len", true
+		}
+	case *lexer.IndexExpr:
+		if ident, ok := o.Object.(*lexer.IdentExpr); ok {
+			return r.rowLength(ident.Name, r.renderExpr(o.Index))
+		}
+		if elemType, ok := r.listFieldType(o.Object); ok {
+			if _, nested := nestedListType(elemType); nested {
+				return fmt.Sprintf("%s_lens[%s]", r.renderExpr(o.Object), r.renderExpr(o.Index)), true
+			}
+		}
+	}
+	return "", false
+}
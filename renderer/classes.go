@@ -0,0 +1,336 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains code generation for class inheritance.
+//
+// A derived class embeds its base struct as its first member through an
+// anonymous union, so inherited fields stay reachable as this->field while
+// &obj->base_Base is a valid pointer to the base part for upcasts.
+
+package renderer
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"scar/lexer"
+)
+
+// Resolves the C name of a base class named in a class header.
+func resolveBaseName(base, moduleName string) string {
+	if base == "" {
+		return ""
+	}
+	if parts := strings.SplitN(base, ".", 2); len(parts) == 2 {
+		return lexer.GenerateUniqueSymbol(parts[1], parts[0])
+	}
+	if moduleName != "" {
+		return lexer.GenerateUniqueSymbol(base, moduleName)
+	}
+	return base
+}
+
+// Returns the ancestors of a class, nearest first.
+func (r *Renderer) classAncestors(className string) []string {
+	var (
+		ancestors []string
+		seen      = map[string]bool{className: true}
+	)
+	for class := r.globalClasses[className]; class != nil && class.Base != ""; class = r.globalClasses[class.Base] {
+		if seen[class.Base] {
+			break
+		}
+		seen[class.Base] = true
+		ancestors = append(ancestors, class.Base)
+	}
+	return ancestors
+}
+
+// Returns the field of a class with the given name, searching base classes.
+func (r *Renderer) findField(className, fieldName string) (FieldInfo, bool) {
+	for _, name := range append([]string{className}, r.classAncestors(className)...) {
+		if class, exists := r.globalClasses[name]; exists {
+			for _, field := range class.Fields {
+				if field.Name == fieldName {
+					return field, true
+				}
+			}
+		}
+	}
+	return FieldInfo{}, false
+}
+
+// Returns the class whose implementation of a method applies to instances of
+// className, so overrides in derived classes win over inherited methods.
+func (r *Renderer) methodOwner(className, methodName string) (string, bool) {
+	for _, name := range append([]string{className}, r.classAncestors(className)...) {
+		if class, exists := r.globalClasses[name]; exists {
+			for _, method := range class.Methods {
+				if method.Name == methodName {
+					return name, true
+				}
+			}
+		}
+	}
+	return "", false
+}
+
+// Removes fields a derived class redeclares from its own field list, since
+// they are already part of the embedded base struct.
+func (r *Renderer) resolveInheritedFields() {
+	for className, class := range r.globalClasses {
+		if class.Base == "" {
+			continue
+		}
+		fields := class.Fields[:0]
+		for _, field := range class.Fields {
+			if _, inherited := r.findField(class.Base, field.Name); !inherited {
+				fields = append(fields, field)
+			}
+		}
+		r.globalClasses[className].Fields = fields
+	}
+}
+
+// Returns the class names ordered so that every base precedes its subclasses.
+func (r *Renderer) sortedClassNames() []string {
+	names := make([]string, 0, len(r.globalClasses))
+	for name := range r.globalClasses {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		di, dj := len(r.classAncestors(names[i])), len(r.classAncestors(names[j]))
+		if di != dj {
+			return di < dj
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+// Emits helpers converting a pointer to a class into pointers to its ancestors.
+func (r *Renderer) generateUpcastHelpers(b *strings.Builder, className string) {
+	for _, ancestor := range r.classAncestors(className) {
+		fmt.Fprintf(b, "static inline %s* %s_as_%s(%s* obj) { return &obj->base_%s; }\n", ancestor, className, ancestor, className, ancestor)
+	}
+}
+
+// Returns the declaration of a class from the program or a loaded module.
+func findClassDecl(className string, program *lexer.Program) *lexer.ClassDeclStmt {
+	for _, stmt := range program.Statements {
+		if stmt.ClassDecl != nil && stmt.ClassDecl.Name == className {
+			return stmt.ClassDecl
+		}
+		if stmt.PubClassDecl != nil && stmt.PubClassDecl.Name == className {
+			return &lexer.ClassDeclStmt{
+				Name:        stmt.PubClassDecl.Name,
+				Base:        stmt.PubClassDecl.Base,
+				Interfaces:  stmt.PubClassDecl.Interfaces,
+				Constructor: stmt.PubClassDecl.Constructor,
+				Methods:     stmt.PubClassDecl.Methods,
+				Deinit:      stmt.PubClassDecl.Deinit,
+			}
+		}
+	}
+	for _, module := range lexer.SortedModules() {
+		for name, classDecl := range module.PublicClasses {
+			if name == className || lexer.GenerateUniqueSymbol(name, module.Name) == className {
+				return classDecl
+			}
+		}
+	}
+	return nil
+}
+
+// Returns the constructor used to build a class. Classes without their own
+// constructor take the constructor of their nearest ancestor that has one.
+func (r *Renderer) findConstructor(className string, program *lexer.Program) *lexer.ConstructorStmt {
+	for _, name := range append([]string{className}, r.classAncestors(className)...) {
+		if classDecl := findClassDecl(name, program); classDecl != nil && classDecl.Constructor != nil {
+			return classDecl.Constructor
+		}
+	}
+	return nil
+}
+
+// Returns the parameters of the constructor that creates instances of a class,
+// which may be inherited from an ancestor.
+func (r *Renderer) constructorParams(className string) []*lexer.MethodParameter {
+	for _, name := range append([]string{className}, r.classAncestors(className)...) {
+		if class, exists := r.globalClasses[name]; exists && class.Constructor != nil {
+			return class.Constructor.Parameters
+		}
+	}
+	return nil
+}
+
+// Returns the C type of a constructor parameter. Objects are passed as
+// pointers to them, which the new object keeps a reference to.
+func (r *Renderer) constructorParamType(param *lexer.MethodParameter) string {
+	if className, ok := r.countedClass(param.Type); ok {
+		return className + "*"
+	}
+	if param.Type == "string" {
+		return "char*"
+	}
+	return r.mapTypeToCType(param.Type)
+}
+
+// Completes the rendered arguments of a constructor call with the default
+// values of the trailing parameters the call leaves out.
+func (r *Renderer) withDefaultArgs(className string, args []string) []string {
+	params := r.constructorParams(className)
+	for _, param := range params[min(len(args), len(params)):] {
+		if param.Default == "" {
+			break
+		}
+		args = append(args, r.convertThisReferencesGranular(lexer.ResolveSymbol(param.Default, r.currentModule)))
+	}
+	return args
+}
+
+// Returns the arguments of a super(...) call in a constructor body.
+func superCall(stmt *lexer.Statement) ([]string, bool) {
+	if stmt.FunctionCall == nil || stmt.FunctionCall.Name != "super" {
+		return nil, false
+	}
+	return stmt.FunctionCall.Args, true
+}
+
+// Emits code initialising the embedded base of a class from a call to the
+// base constructor.
+func (r *Renderer) initBase(b *strings.Builder, indent, base string, args []string) {
+	resolved := make([]string, len(args))
+	for i, arg := range args {
+		resolved[i] = r.convertThisReferencesGranular(lexer.ResolveSymbol(strings.TrimSpace(arg), r.currentModule))
+	}
+	fmt.Fprintf(b, "%s%s* __super = %s_new(%s);\n", indent, base, base, strings.Join(r.withDefaultArgs(base, resolved), ", "))
+	fmt.Fprintf(b, "%sthis->base_%s = *__super;\n", indent, base)
+	fmt.Fprintf(b, "%sfree(__super);\n", indent)
+}
+
+// Emits the default initialisation of the base of a class whose constructor
+// does not call super(...).
+func (r *Renderer) initDefaultBase(b *strings.Builder, classDecl *lexer.ClassDeclStmt, base string, program *lexer.Program) {
+	if classDecl.Constructor == nil {
+		// The inherited constructor is forwarded to the base unchanged.
+		var args []string
+		if constructor := r.findConstructor(base, program); constructor != nil {
+			for _, param := range constructor.Parameters {
+				args = append(args, param.Name)
+			}
+		}
+		r.initBase(b, "    ", base, args)
+		return
+	}
+	for _, stmt := range classDecl.Constructor.Fields {
+		if _, ok := superCall(stmt); ok {
+			return
+		}
+	}
+	if constructor := r.findConstructor(base, program); constructor == nil || len(constructor.Parameters) == 0 {
+		r.initBase(b, "    ", base, nil)
+		return
+	}
+	fmt.Fprintf(b, "    memset(&this->base_%s, 0, sizeof(%s));\n", base, base)
+}
+
+// Reports whether name is a parameter of the constructor of a class.
+func isCtorParam(classDecl *lexer.ClassDeclStmt, name string) bool {
+	if classDecl.Constructor == nil {
+		return false
+	}
+	for _, param := range classDecl.Constructor.Parameters {
+		if param.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Emits ClassName_deinit, which runs the deinit block of a class and releases
+// the memory owned by its fields before doing the same for its base, and
+// ClassName_free, which deinitialises an instance and frees it as the memory
+// mode dictates.
+func (r *Renderer) generateFree(b *strings.Builder, classDecl *lexer.ClassDeclStmt, className string, program *lexer.Program) {
+	fmt.Fprintf(b, "void %s_deinit(%s* this) {\n", className, className)
+	r.renderStatements(b, classDecl.Deinit, "    ", className, program, "")
+	r.endFunctionScope(b, classDecl.Deinit)
+	if classInfo, exists := r.globalClasses[className]; exists {
+		for _, field := range classInfo.Fields {
+			_, isMap := parseMapType(field.Type)
+			if _, isSet := parseSetType(field.Type); isMap || isSet {
+				fmt.Fprintf(b, "    __scar_map_free(&this->%s);\n", field.Name)
+			} else if elemType, isList := nestedListType(field.Type); isList {
+				freeListField(b, "    ", elemType, "this->"+field.Name)
+			}
+		}
+		r.releaseFields(b, classInfo)
+		if classInfo.Base != "" {
+			fmt.Fprintf(b, "    %s_deinit(&this->base_%s);\n", classInfo.Base, classInfo.Base)
+		}
+	}
+	b.WriteString("}\n\n")
+
+	fmt.Fprintf(b, "void %s_free(%s* this) {\n", className, className)
+	b.WriteString("    if (this == NULL) {\n        return;\n    }\n")
+	r.freeObject(b, className)
+	b.WriteString("}\n\n")
+}
+
+// Emits the delete statement, which frees an object and clears the variable
+// or field holding it.
+func (r *Renderer) renderDelete(b *strings.Builder, indent, target string) {
+	ref := lexer.ResolveSymbol(target, r.currentModule)
+	if fieldName, ok := strings.CutPrefix(target, "this."); ok {
+		ref = "this->" + fieldName
+	}
+	if className, ok := r.deleteClass(target); ok {
+		fmt.Fprintf(b, "%s%s_free(%s);\n", indent, className, ref)
+	} else {
+		fmt.Fprintf(b, "%sfree(%s);\n", indent, ref)
+	}
+	fmt.Fprintf(b, "%s%s = NULL;\n", indent, ref)
+}
+
+// Returns the class of the object a delete statement frees.
+func (r *Renderer) deleteClass(target string) (string, bool) {
+	var typ string
+	if fieldName, ok := strings.CutPrefix(target, "this."); ok {
+		field, exists := r.findField(r.currentClassName, fieldName)
+		if !exists {
+			return "", false
+		}
+		typ = field.Type
+	} else if obj, exists := r.globalObjects[target]; exists {
+		typ = obj.Type
+	} else {
+		typ = r.varTypes[target]
+	}
+	typ = strings.TrimSuffix(strings.TrimPrefix(typ, "ref "), "?")
+	if parts := strings.SplitN(typ, ".", 2); len(parts) == 2 {
+		typ = lexer.GenerateUniqueSymbol(parts[1], parts[0])
+	}
+	_, exists := r.globalClasses[typ]
+	return typ, exists
+}
+
+// Returns the class of the object a scar value evaluates to, such as a call of
+// a function or method returning one.
+func (r *Renderer) objectValueClass(value string) (string, bool) {
+	expr, err := lexer.ParseExpr(value)
+	if err != nil {
+		return "", false
+	}
+	return r.countedClass(r.exprType(expr))
+}
+
+// Declares a variable holding an object of the given class, which method
+// calls on the variable are then resolved against.
+func (r *Renderer) declareObject(b *strings.Builder, indent, name, className, value string) {
+	r.globalObjects[name] = &ObjectInfo{Name: name, Type: className}
+	fmt.Fprintf(b, "%s%s* %s = %s;\n", indent, className, lexer.ResolveSymbol(name, r.currentModule), r.countedValue(className, value))
+	r.trackLocal(name, className, indent)
+}
@@ -0,0 +1,108 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains code generation for constants and fixed-size arrays.
+//
+// A constant is emitted as a #define so it can size arrays and appear in other
+// constant expressions. An array such as int[MAX] buf becomes a zeroed C array
+// whose size is folded to a number, with buf_len holding its length so it is
+// indexed, printed and passed to list parameters like a list.
+
+package renderer
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+
+	"scar/lexer"
+)
+
+type constInfo struct {
+	decl   *lexer.ConstDeclStmt
+	module string
+}
+
+func (r *Renderer) collectConst(name, module string, decl *lexer.ConstDeclStmt) {
+	if _, exists := r.globalConsts[name]; !exists {
+		r.constOrder = append(r.constOrder, name)
+	}
+	r.globalConsts[name] = &constInfo{decl: decl, module: module}
+	r.varTypes[name] = decl.Type
+}
+
+// Collects the public constants of the loaded modules under their C names.
+func (r *Renderer) collectModuleConsts() {
+	for _, module := range lexer.SortedModules() {
+		for _, name := range slices.Sorted(maps.Keys(module.PublicConsts)) {
+			r.collectConst(lexer.GenerateUniqueSymbol(name, module.Name), module.Name, module.PublicConsts[name])
+		}
+	}
+}
+
+// Records the types of the public variables of the loaded modules under their
+// C names.
+func (r *Renderer) collectModuleVars() {
+	for _, module := range lexer.SortedModules() {
+		for name, decl := range module.PublicVars {
+			r.varTypes[lexer.GenerateUniqueSymbol(name, module.Name)] = decl.Type
+		}
+	}
+}
+
+// Emits a #define for every constant.
+func (r *Renderer) generateConsts(b *strings.Builder) {
+	for _, name := range r.constOrder {
+		info := r.globalConsts[name]
+		value := info.decl.Value
+		if info.module != "" {
+			value = qualifyModuleConsts(value, info.module)
+		}
+		if info.decl.Type == "string" {
+			fmt.Fprintf(b, "#define %s %s\n", name, value)
+		} else {
+			fmt.Fprintf(b, "#define %s (%s)\n", name, r.convertThisReferencesGranular(value))
+		}
+	}
+	if len(r.constOrder) > 0 {
+		b.WriteString("\n")
+	}
+}
+
+// Renames the constants of a module referenced by the value of another one.
+func qualifyModuleConsts(value, module string) string {
+	for name := range lexer.LoadedModules[module].PublicConsts {
+		re := regexp.MustCompile(`\b` + regexp.QuoteMeta(name) + `\b`)
+		value = re.ReplaceAllString(value, lexer.GenerateUniqueSymbol(name, module))
+	}
+	return value
+}
+
+// Folds an integer constant expression, following constants to their values.
+func (r *Renderer) foldConst(value string) (int64, bool) {
+	return lexer.FoldConst(value, r.currentModule, func(name string) *lexer.ConstDeclStmt {
+		if info := r.globalConsts[name]; info != nil {
+			return info.decl
+		}
+		return nil
+	})
+}
+
+// Emits the declaration of a fixed-size array.
+func (r *Renderer) declareArray(b *strings.Builder, indent string, decl *lexer.ArrayDeclStmt) {
+	name := lexer.ResolveSymbol(decl.Name, r.currentModule)
+	size := r.convertThisReferencesGranular(lexer.ResolveSymbol(decl.Size, r.currentModule))
+	if folded, ok := r.foldConst(decl.Size); ok {
+		size = fmt.Sprint(folded)
+	}
+	r.globalArrays[decl.Name] = decl.Type
+	if decl.Type == "string" {
+		fmt.Fprintf(b, "%schar %s[%s][256] = {{0}};\n", indent, name, size)
+	} else {
+		fmt.Fprintf(b, "%s%s %s[%s] = {0};\n", indent, r.mapTypeToCType(decl.Type), name, size)
+	}
+	fmt.Fprintf(b, "%sint %s_len = %s;\n", indent, name, size)
+}
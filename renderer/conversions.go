@@ -0,0 +1,76 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains the rendering of the conversion builtins to_int, to_float and
+// to_string, and of format!.
+//
+// to_int(s) and to_float(s) parse a whole string with strtol and strtod, and
+// throw an exception when it does not hold a number, so a bad value can be
+// caught like any other error instead of silently reading as zero.
+// to_string(x) formats a number, char or bool into a new heap string with
+// __scar_str_format, and format!(f, args) formats its arguments by a printf
+// format the same way, into a buffer as long as the text. A function of the
+// program with one of these names takes precedence over the builtin.
+
+package renderer
+
+import (
+	"fmt"
+	"strings"
+
+	"scar/lexer"
+)
+
+// The types of the values the conversion builtins return.
+var conversionTypes = map[string]string{
+	"to_int": "int", "to_float": "float", "to_string": "string", "format!": "string",
+}
+
+// Returns the type a call of a conversion builtin evaluates to.
+func (r *Renderer) conversionType(name string) (string, bool) {
+	if _, userDefined := r.globalFunctions[name]; userDefined {
+		return "", false
+	}
+	typ, ok := conversionTypes[name]
+	return typ, ok
+}
+
+// Renders to_int(s), to_float(s), to_string(x) and format!(f, args) inside
+// expressions.
+func (r *Renderer) renderConversion(name string, args []lexer.Expr) (string, bool) {
+	if _, ok := r.conversionType(name); !ok || len(args) == 0 {
+		return "", false
+	}
+	if name == "format!" {
+		values := make([]string, len(args))
+		for i, arg := range args {
+			values[i] = r.renderExpr(arg)
+		}
+		return fmt.Sprintf("__scar_str_format(%s)", strings.Join(values, ", ")), true
+	}
+	if len(args) != 1 {
+		return "", false
+	}
+	value := r.renderExpr(args[0])
+	switch name {
+	case "to_int", "to_float":
+		return fmt.Sprintf("__scar_%s(%s)", name, value), true
+	}
+
+	switch r.mapTypeToCType(r.exprType(args[0])) {
+	case "char*":
+		return fmt.Sprintf("__scar_str_new(%s)", value), true
+	case "bool":
+		return fmt.Sprintf("__scar_str_bool(%s)", value), true
+	case "char":
+		return fmt.Sprintf("__scar_str_format(\"%%c\", %s)", value), true
+	case "float", "double":
+		return fmt.Sprintf("__scar_str_format(\"%%g\", (double)(%s))", value), true
+	case "long", "short", "i8":
+		return fmt.Sprintf("__scar_str_format(\"%%lld\", (long long)(%s))", value), true
+	case "unsigned long", "unsigned int", "unsigned short", "u8":
+		return fmt.Sprintf("__scar_str_format(\"%%llu\", (unsigned long long)(%s))", value), true
+	}
+	return fmt.Sprintf("__scar_str_format(\"%%d\", %s)", value), true
+}
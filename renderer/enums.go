@@ -0,0 +1,199 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains code generation for enums.
+//
+// An enum becomes a C enum whose members are prefixed with the enum name, so
+// Color::Red is Color_Red. Every enum also gets Color_to_string, a switch
+// returning the name of a member, and Color_from_int, which converts an int
+// to the enum and throws an exception when it is not the value of a member.
+// Color(n) calls the latter, while int(c) converts back without a check.
+
+package renderer
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+
+	"scar/lexer"
+)
+
+func (r *Renderer) sortedEnumNames() []string {
+	return slices.Sorted(maps.Keys(r.globalEnums))
+}
+
+// Returns the enum a C name such as Color_Red is a member of.
+func (r *Renderer) enumOfMember(name string) (string, bool) {
+	for _, enumName := range r.sortedEnumNames() {
+		if member, ok := strings.CutPrefix(name, enumName+"_"); ok && slices.Contains(r.globalEnums[enumName].Values, member) {
+			return enumName, true
+		}
+	}
+	return "", false
+}
+
+// Emits the C enum of every enum.
+func (r *Renderer) generateEnumTypedefs(b *strings.Builder) {
+	for _, name := range r.sortedEnumNames() {
+		enumInfo := r.globalEnums[name]
+		b.WriteString("typedef enum {\n")
+		for i, member := range enumInfo.Values {
+			fmt.Fprintf(b, "    %s_%s", name, member)
+			if value, explicit := enumInfo.Discriminants[member]; explicit {
+				fmt.Fprintf(b, " = %s", qualifyEnumMembers(enumInfo, value))
+			}
+			if i < len(enumInfo.Values)-1 {
+				b.WriteString(",\n")
+			}
+		}
+		fmt.Fprintf(b, "\n} %s;\n\n", name)
+	}
+}
+
+// Prefixes the members of an enum referenced by the value of another one.
+func qualifyEnumMembers(enumInfo *EnumInfo, value string) string {
+	for _, member := range enumInfo.Values {
+		re := regexp.MustCompile(`\b` + regexp.QuoteMeta(member) + `\b`)
+		value = re.ReplaceAllString(value, enumInfo.Name+"_"+member)
+	}
+	return value
+}
+
+// Returns the members of an enum that get a case of their own in a switch,
+// leaving out those whose value is known to repeat an earlier member.
+func (r *Renderer) distinctEnumMembers(enumInfo *EnumInfo) []string {
+	var (
+		members []string
+		values  = make(map[string]int64)
+		seen    = make(map[int64]bool)
+		next    = int64(0)
+		known   = true
+	)
+	for _, member := range enumInfo.Values {
+		if value, explicit := enumInfo.Discriminants[member]; explicit {
+			next, known = lexer.FoldConstInt(value, func(name string) (int64, bool) {
+				if n, ok := values[name]; ok {
+					return n, true
+				}
+				return r.foldConst(name)
+			})
+		}
+		if known && seen[next] {
+			next++
+			continue
+		}
+		members = append(members, member)
+		if known {
+			values[member], seen[next] = next, true
+		}
+		next++
+	}
+	return members
+}
+
+// Emits Color_to_string and Color_from_int for every enum.
+func (r *Renderer) generateEnumFunctions(b *strings.Builder) {
+	for _, name := range r.sortedEnumNames() {
+		members := r.distinctEnumMembers(r.globalEnums[name])
+		fmt.Fprintf(b, "static inline char* %s_to_string(%s value) {\n", name, name)
+		b.WriteString("    switch (value) {\n")
+		for _, member := range members {
+			fmt.Fprintf(b, "    case %s_%s:\n", name, member)
+			fmt.Fprintf(b, "        return \"%s\";\n", member)
+		}
+		b.WriteString("    }\n")
+		fmt.Fprintf(b, "    return \"<invalid %s>\";\n", name)
+		b.WriteString("}\n\n")
+
+		fmt.Fprintf(b, "static inline %s %s_from_int(int value) {\n", name, name)
+		b.WriteString("    switch (value) {\n")
+		for _, member := range members {
+			fmt.Fprintf(b, "    case %s_%s:\n", name, member)
+		}
+		if len(members) > 0 {
+			fmt.Fprintf(b, "        return (%s)value;\n", name)
+		}
+		b.WriteString("    }\n")
+		b.WriteString("    char message[128];\n")
+		fmt.Fprintf(b, "    snprintf(message, sizeof(message), \"%%d is not a valid %s\", value);\n", name)
+		b.WriteString("    __scar_throw(1, message);\n")
+		fmt.Fprintf(b, "    return (%s)value;\n", name)
+		b.WriteString("}\n\n")
+	}
+}
+
+// Returns the enum an expression evaluates to, which is a member such as
+// Color_Red or a variable declared with an enum type.
+func (r *Renderer) enumTypeOf(expr lexer.Expr) (string, bool) {
+	switch e := expr.(type) {
+	case *lexer.IdentExpr:
+		if enumName, ok := r.enumOfMember(e.Name); ok {
+			return enumName, true
+		}
+		if typ := r.varTypes[e.Name]; r.isEnumType(typ) {
+			return typ, true
+		}
+	case *lexer.CallExpr:
+		if callee, ok := e.Callee.(*lexer.IdentExpr); ok && r.isEnumType(callee.Name) {
+			return callee.Name, true
+		}
+	case *lexer.ParenExpr:
+		return r.enumTypeOf(e.Inner)
+	case *lexer.CastExpr:
+		if r.isEnumType(e.Type) {
+			return e.Type, true
+		}
+	}
+	return "", false
+}
+
+// Renders the enum conversions Color(n), c.to_string() and
+// Color.to_string(n).
+func (r *Renderer) renderEnumCall(e *lexer.CallExpr) (string, bool) {
+	switch callee := e.Callee.(type) {
+	case *lexer.IdentExpr:
+		if r.isEnumType(callee.Name) && len(e.Args) == 1 {
+			return fmt.Sprintf("%s_from_int(%s)", callee.Name, r.renderExpr(e.Args[0])), true
+		}
+	case *lexer.MemberExpr:
+		if callee.Member != "to_string" {
+			return "", false
+		}
+		if ident, ok := callee.Object.(*lexer.IdentExpr); ok && r.isEnumType(ident.Name) && len(e.Args) == 1 {
+			return fmt.Sprintf("%s_to_string(%s)", ident.Name, r.renderExpr(e.Args[0])), true
+		}
+		if enumName, ok := r.enumTypeOf(callee.Object); ok && len(e.Args) == 0 {
+			return fmt.Sprintf("%s_to_string(%s)", enumName, r.renderExpr(callee.Object)), true
+		}
+	}
+	return "", false
+}
+
+// Renders the source of an enum conversion such as c.to_string(), which
+// statements holding calls as text pass in.
+func (r *Renderer) enumCallSource(src string) (string, bool) {
+	expr, err := lexer.ParseExpr(lexer.ReplaceDoubleColonsOutsideStrings(src))
+	if err != nil {
+		return "", false
+	}
+	call, ok := expr.(*lexer.CallExpr)
+	if !ok {
+		return "", false
+	}
+	return r.renderEnumCall(call)
+}
+
+// Renders a method call statement such as string s = c.to_string() when its
+// receiver is an enum.
+func (r *Renderer) enumMethodCall(object, method string, args []string) (string, bool) {
+	return r.enumCallSource(fmt.Sprintf("%s.%s(%s)", object, method, strings.Join(args, ", ")))
+}
+
+func (r *Renderer) isEnumMethodCall(object, method string, args []string) bool {
+	_, ok := r.enumMethodCall(object, method, args)
+	return ok
+}
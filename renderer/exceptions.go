@@ -0,0 +1,117 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains code generation for exceptions.
+//
+// A try block pushes a setjmp frame that throw unwinds to. Code leaving a try
+// block early through return, break or continue pops the frames it leaves and
+// runs their finally blocks first, so no frame outlives its block.
+
+package renderer
+
+import (
+	"fmt"
+	"strings"
+
+	"scar/lexer"
+)
+
+type tryFrame struct {
+	name    string
+	finally []*lexer.Statement
+}
+
+func (r *Renderer) renderTryCatch(b *strings.Builder, tryCatch *lexer.TryCatchStmt, indent, className string, program *lexer.Program, currentFunctionReturnType string) {
+	frame := fmt.Sprintf("__try_%d", len(r.tryFrames))
+	fmt.Fprintf(b, "%s{\n", indent)
+	fmt.Fprintf(b, "%s    __scar_try_frame %s;\n", indent, frame)
+	fmt.Fprintf(b, "%s    __scar_try_push(&%s);\n", indent, frame)
+	if r.opts.Debug {
+		fmt.Fprintf(b, "%s    __scar_context* %s_context = __scar_context_top;\n", indent, frame)
+	}
+	fmt.Fprintf(b, "%s    if (setjmp(%s.env) == 0) {\n", indent, frame)
+
+	r.tryFrames = append(r.tryFrames, tryFrame{name: frame, finally: tryCatch.FinallyBody})
+	r.renderStatements(b, tryCatch.TryBody, indent+"        ", className, program, currentFunctionReturnType)
+	r.tryFrames = r.tryFrames[:len(r.tryFrames)-1]
+
+	fmt.Fprintf(b, "%s        __scar_try_top = %s.prev;\n", indent, frame)
+	fmt.Fprintf(b, "%s    } else {\n", indent)
+	fmt.Fprintf(b, "%s        __scar_try_top = %s.prev;\n", indent, frame)
+	if r.opts.Debug {
+		fmt.Fprintf(b, "%s        __scar_context_top = %s_context;\n", indent, frame)
+	}
+	bound := r.exceptionVars[tryCatch.CatchVar]
+	if tryCatch.CatchVar != "" {
+		fmt.Fprintf(b, "%s        __scar_exception __caught = __scar_current_exception;\n", indent)
+		fmt.Fprintf(b, "%s        __scar_exception* %s = &__caught;\n", indent, tryCatch.CatchVar)
+		r.exceptionVars[tryCatch.CatchVar] = true
+	}
+
+	if len(tryCatch.FinallyBody) == 0 {
+		r.renderStatements(b, tryCatch.CatchBody, indent+"        ", className, program, currentFunctionReturnType)
+	} else {
+		// The frame is pushed again around the catch block, so the finally
+		// block also runs when the catch block throws.
+		fmt.Fprintf(b, "%s        __scar_try_push(&%s);\n", indent, frame)
+		fmt.Fprintf(b, "%s        if (setjmp(%s.env) == 0) {\n", indent, frame)
+		r.tryFrames = append(r.tryFrames, tryFrame{name: frame, finally: tryCatch.FinallyBody})
+		r.renderStatements(b, tryCatch.CatchBody, indent+"            ", className, program, currentFunctionReturnType)
+		r.tryFrames = r.tryFrames[:len(r.tryFrames)-1]
+		fmt.Fprintf(b, "%s            __scar_try_top = %s.prev;\n", indent, frame)
+		fmt.Fprintf(b, "%s        } else {\n", indent)
+		fmt.Fprintf(b, "%s            __scar_try_top = %s.prev;\n", indent, frame)
+		if r.opts.Debug {
+			fmt.Fprintf(b, "%s            __scar_context_top = %s_context;\n", indent, frame)
+		}
+		r.renderStatements(b, tryCatch.FinallyBody, indent+"            ", className, program, currentFunctionReturnType)
+		fmt.Fprintf(b, "%s            __scar_rethrow();\n", indent)
+		fmt.Fprintf(b, "%s        }\n", indent)
+	}
+	if tryCatch.CatchVar != "" {
+		r.exceptionVars[tryCatch.CatchVar] = bound
+	}
+	fmt.Fprintf(b, "%s    }\n", indent)
+
+	r.renderStatements(b, tryCatch.FinallyBody, indent+"    ", className, program, currentFunctionReturnType)
+	fmt.Fprintf(b, "%s}\n", indent)
+}
+
+// Emits code popping the innermost count try frames and running their
+// finally blocks before control leaves them.
+func (r *Renderer) leaveTryFrames(b *strings.Builder, count int, indent, className string, program *lexer.Program, currentFunctionReturnType string) {
+	saved := r.tryFrames
+	defer func() { r.tryFrames = saved }()
+
+	for i := len(saved) - 1; i >= len(saved)-count; i-- {
+		fmt.Fprintf(b, "%s__scar_try_top = %s.prev;\n", indent, saved[i].name)
+		r.tryFrames = saved[:i]
+		r.renderStatements(b, saved[i].finally, indent, className, program, currentFunctionReturnType)
+	}
+}
+
+// Emits a return from inside try blocks. The value is evaluated before the
+// frames are left, so exceptions it raises are still caught by them.
+func (r *Renderer) returnFromTry(b *strings.Builder, value, indent, className string, program *lexer.Program, currentFunctionReturnType string) {
+	fmt.Fprintf(b, "%s{\n", indent)
+	fmt.Fprintf(b, "%s    __auto_type __ret = %s;\n", indent, value)
+	r.leaveTryFrames(b, len(r.tryFrames), indent+"    ", className, program, currentFunctionReturnType)
+	fmt.Fprintf(b, "%s    return __ret;\n", indent)
+	fmt.Fprintf(b, "%s}\n", indent)
+}
+
+func (r *Renderer) renderThrow(b *strings.Builder, throw *lexer.ThrowStmt, indent string) {
+	value := r.convertThisReferencesGranular(lexer.ResolveSymbol(throw.Value, r.currentModule))
+	switch {
+	case throw.Message != "":
+		message := r.convertThisReferencesGranular(lexer.ResolveSymbol(throw.Message, r.currentModule))
+		fmt.Fprintf(b, "%s__scar_throw(%s, %s);\n", indent, value, message)
+	case r.exceptionVars[throw.Value]:
+		fmt.Fprintf(b, "%s__scar_throw(%s->code, %s->message);\n", indent, value, value)
+	case strings.HasPrefix(value, "\"") || r.isHeapString(value):
+		fmt.Fprintf(b, "%s__scar_throw(1, %s);\n", indent, value)
+	default:
+		fmt.Fprintf(b, "%s__scar_throw(%s, NULL);\n", indent, value)
+	}
+}
@@ -0,0 +1,413 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains C code generation from parsed expression trees.
+
+package renderer
+
+import (
+	"fmt"
+	"regexp"
+	"scar/lexer"
+	"strings"
+)
+
+var (
+	reConstantMember = regexp.MustCompile(`^[A-Z_][A-Z0-9_]*$`)
+	castTypes        = map[string]bool{"int": true, "float": true, "double": true, "char": true}
+	// The C type ord and chr cast their argument to.
+	charCasts = map[string]string{"ord": "int", "chr": "char"}
+	// The runtime functions of the builtins reading standard input, and the
+	// types they return.
+	inputBuiltins = map[string]inputBuiltin{
+		"input":      {"__scar_input", "string"},
+		"read_int":   {"__scar_read_int", "int"},
+		"read_float": {"__scar_read_float", "float"},
+	}
+)
+
+type inputBuiltin struct {
+	function, returnType string
+}
+
+// Returns the builtin reading standard input that value calls, if any.
+func (r *Renderer) inputBuiltinCall(value string) (inputBuiltin, bool) {
+	name, ok := strings.CutSuffix(strings.TrimSpace(value), "()")
+	if _, userDefined := r.globalFunctions[name]; !ok || userDefined {
+		return inputBuiltin{}, false
+	}
+	builtin, ok := inputBuiltins[name]
+	return builtin, ok
+}
+
+// Renders an expression tree as C.
+func (r *Renderer) renderExpr(expr lexer.Expr) string {
+	switch e := expr.(type) {
+	case *lexer.LiteralExpr:
+		switch e.Kind {
+		case lexer.NilLiteral:
+			return "NULL"
+		case lexer.StringLiteral:
+			if formatted, ok := r.interpolatedLiteral(e.Value); ok {
+				return formatted
+			}
+		}
+		return e.Value
+	case *lexer.IdentExpr:
+		if value, ok := r.unwrapValue(e); ok {
+			return value
+		}
+		return e.Name
+	case *lexer.ParenExpr:
+		return "(" + r.renderExpr(e.Inner) + ")"
+	case *lexer.CastExpr:
+		return r.renderCast(e)
+	case *lexer.ListExpr:
+		elemType := "int"
+		if len(e.Elements) > 0 {
+			elemType = r.exprType(e.Elements[0])
+		}
+		items, _ := r.renderListLiteral(elemType, e)
+		return items
+	case *lexer.UnaryExpr:
+		if e.Op == "not" {
+			if _, ok := e.Operand.(*lexer.BinaryExpr); ok {
+				return "!(" + r.renderExpr(e.Operand) + ")"
+			}
+			return "!" + r.renderExpr(e.Operand)
+		}
+		return e.Op + r.renderExpr(e.Operand)
+	case *lexer.BinaryExpr:
+		if isNilComparison(e) {
+			return fmt.Sprintf("%s %s %s", r.renderOptional(e.Left), e.Op, r.renderOptional(e.Right))
+		}
+		if e.Op == "+" && r.isStringExpr(e.Left) && r.isStringExpr(e.Right) {
+			return fmt.Sprintf("__scar_str_concat(%s, %s)", r.renderExpr(e.Left), r.renderExpr(e.Right))
+		}
+		if checked, ok := r.renderCheckedArithmetic(e); ok {
+			return checked
+		}
+		op := e.Op
+		switch op {
+		case "and":
+			op = "&&"
+		case "or":
+			op = "||"
+		}
+		return fmt.Sprintf("%s %s %s", r.renderExpr(e.Left), op, r.renderExpr(e.Right))
+	case *lexer.IndexExpr:
+		return r.renderIndexExpr(e)
+	case *lexer.SliceExpr:
+		return r.renderStringSlice(e)
+	case *lexer.MemberExpr:
+		return r.renderMemberExpr(e)
+	case *lexer.CallExpr:
+		return r.renderCallExpr(e)
+	case *lexer.NewExpr:
+		className := e.Class
+		if parts := strings.SplitN(className, ".", 2); len(parts) == 2 {
+			className = lexer.GenerateUniqueSymbol(parts[1], parts[0])
+		}
+		args := make([]string, len(e.Args))
+		for i, arg := range e.Args {
+			args[i] = r.renderExpr(arg)
+		}
+		return r.allocatedAt(fmt.Sprintf("%s_new(%s)", className, strings.Join(r.withDefaultArgs(className, args), ", ")))
+	}
+	return ""
+}
+
+// Renders a cast such as x as f64 as a C cast. A cast of an int to an enum
+// goes through the checked conversion of the enum, as Color(n) does, and a
+// narrowing integer cast through a checked helper with --safe.
+func (r *Renderer) renderCast(e *lexer.CastExpr) string {
+	value := r.renderExpr(e.Value)
+	if r.isEnumType(e.Type) {
+		if enumName, ok := r.enumTypeOf(e.Value); ok && enumName == e.Type {
+			return value
+		}
+		return fmt.Sprintf("%s_from_int(%s)", e.Type, value)
+	}
+	if checked, ok := r.renderCheckedCast(e, value); ok {
+		return checked
+	}
+	return fmt.Sprintf("((%s)(%s))", r.mapTypeToCType(e.Type), value)
+}
+
+func (r *Renderer) renderExprList(exprs []lexer.Expr) string {
+	rendered := make([]string, len(exprs))
+	for i, expr := range exprs {
+		rendered[i] = r.renderExpr(expr)
+	}
+	return strings.Join(rendered, ", ")
+}
+
+// Returns the module name if the expression names a loaded module.
+func exprModule(expr lexer.Expr) (string, bool) {
+	ident, ok := expr.(*lexer.IdentExpr)
+	if !ok {
+		return "", false
+	}
+	_, exists := lexer.LoadedModules[ident.Name]
+	return ident.Name, exists
+}
+
+// Renders a call such as geo.twice(2) whose receiver is a loaded module,
+// which makes it a call of a function of the module.
+func (r *Renderer) moduleCallSource(source string) (string, bool) {
+	expr, err := lexer.ParseExpr(source)
+	if err != nil {
+		return "", false
+	}
+	call, ok := expr.(*lexer.CallExpr)
+	if !ok {
+		return "", false
+	}
+	callee, ok := call.Callee.(*lexer.MemberExpr)
+	if !ok {
+		return "", false
+	}
+	if _, isModule := exprModule(callee.Object); !isModule {
+		return "", false
+	}
+	return r.renderExpr(call), true
+}
+
+// Renders a method call statement such as int n = geo.twice(2) when its
+// receiver is a loaded module.
+func (r *Renderer) moduleCall(object, method string, args []string) (string, bool) {
+	return r.moduleCallSource(fmt.Sprintf("%s.%s(%s)", object, method, strings.Join(args, ", ")))
+}
+
+func (r *Renderer) isModuleCall(object, method string, args []string) bool {
+	_, ok := r.moduleCall(object, method, args)
+	return ok
+}
+
+func (r *Renderer) renderMemberExpr(e *lexer.MemberExpr) string {
+	if module, ok := exprModule(e.Object); ok {
+		return lexer.GenerateUniqueSymbol(e.Member, module)
+	}
+	if ident, ok := e.Object.(*lexer.IdentExpr); ok && ident.Name != "this" && reConstantMember.MatchString(e.Member) {
+		return fmt.Sprintf("%s_%s", ident.Name, e.Member)
+	}
+	if value, ok := r.unwrapValue(e); ok {
+		return value
+	}
+	if object, ok := r.unwrapOptional(e.Object); ok {
+		return fmt.Sprintf("%s->%s", object, e.Member)
+	}
+	if r.isStructType(r.exprType(e.Object)) {
+		return fmt.Sprintf("%s.%s", r.renderExpr(e.Object), e.Member)
+	}
+	return fmt.Sprintf("%s->%s", r.renderExpr(e.Object), e.Member)
+}
+
+func (r *Renderer) renderCallExpr(e *lexer.CallExpr) string {
+	if conversion, ok := r.renderEnumCall(e); ok {
+		return conversion
+	}
+	switch callee := e.Callee.(type) {
+	case *lexer.IdentExpr:
+		if castTypes[callee.Name] && len(e.Args) == 1 {
+			return fmt.Sprintf("(%s)(%s)", callee.Name, r.renderExpr(e.Args[0]))
+		}
+		if charCasts[callee.Name] != "" && len(e.Args) == 1 {
+			return fmt.Sprintf("((%s)(%s))", charCasts[callee.Name], r.renderExpr(e.Args[0]))
+		}
+		if builtin, ok := r.inputBuiltinCall(callee.Name + "()"); ok && len(e.Args) == 0 {
+			return builtin.function + "()"
+		}
+		if callee.Name == "len" && len(e.Args) == 1 {
+			if index, ok := e.Args[0].(*lexer.IndexExpr); ok {
+				if ident, ok := index.Object.(*lexer.IdentExpr); ok {
+					if length, ok := r.rowLength(ident.Name, r.renderExpr(index.Index)); ok {
+						return length
+					}
+				}
+			}
+		}
+		if callee.Name == "len" && len(e.Args) == 1 {
+			if _, ok := r.listFieldType(e.Args[0]); ok {
+				return r.renderExpr(e.Args[0]) + "_len"
+			}
+		}
+		if list, ok := listArg(e.Args); ok {
+			switch callee.Name {
+			case "len":
+				if length, ok := r.listLength(list); ok {
+					return length
+				}
+				if r.isHeapString(list) {
+					return fmt.Sprintf("(int)strlen(%s)", list)
+				}
+			case "pop!":
+				return fmt.Sprintf("__scar_list_pop(%s, %s_len)", list, list)
+			}
+		}
+		if builtin, ok := r.renderMapBuiltin(callee.Name, e.Args); ok {
+			return builtin
+		}
+		if conversion, ok := r.renderConversion(callee.Name, e.Args); ok {
+			return conversion
+		}
+		if length, ok := r.renderUlen(callee.Name, e.Args); ok {
+			return length
+		}
+		if builtin, ok := r.renderListBuiltin(callee.Name, e.Args); ok {
+			return builtin
+		}
+		if builtin, ok := r.renderSetBuiltin(callee.Name, e.Args); ok {
+			return builtin
+		}
+		if literal, ok := r.renderStructLiteral(callee.Name, e.Args); ok {
+			return literal
+		}
+		if funcDecl, exists := r.globalFunctions[callee.Name]; exists && len(funcDecl.Parameters) == len(e.Args) {
+			return fmt.Sprintf("%s(%s)", callee.Name, r.renderListArgs(funcDecl.Parameters, e.Args))
+		}
+	case *lexer.MemberExpr:
+		if method, ok := r.renderMethodCall(callee, e.Args); ok {
+			return method
+		}
+	}
+	return fmt.Sprintf("%s(%s)", r.renderExpr(e.Callee), r.renderExprList(e.Args))
+}
+
+// Renders the arguments of a call, passing the lengths of list arguments
+// after them as list parameters expect.
+func (r *Renderer) renderListArgs(params []*lexer.MethodParameter, args []lexer.Expr) string {
+	var rendered []string
+	for i, arg := range args {
+		if list, ok := arg.(*lexer.ListExpr); ok && isFlatListParam(params[i]) {
+			items, n := r.renderListLiteral(listParamElemType(params[i]), list)
+			rendered = append(rendered, items, n)
+			continue
+		}
+		value := r.renderExpr(arg)
+		if elemType, ok := optionalElemType(params[i].Type); ok {
+			value = r.optionalExprValue(elemType, arg)
+		}
+		rendered = append(rendered, value)
+		if ident, ok := arg.(*lexer.IdentExpr); ok && (params[i].IsList || strings.HasPrefix(params[i].Type, "list[")) {
+			if _, ok := r.listLength(ident.Name); ok {
+				rendered = append(rendered, r.listLengthArgs(ident.Name, value)...)
+			}
+		}
+	}
+	return strings.Join(rendered, ", ")
+}
+
+// Returns the list named by the only argument of a list builtin.
+func listArg(args []lexer.Expr) (string, bool) {
+	if len(args) != 1 {
+		return "", false
+	}
+	ident, ok := args[0].(*lexer.IdentExpr)
+	if !ok {
+		return "", false
+	}
+	return ident.Name, true
+}
+
+// Renders obj.method(args) as Class_method(obj, args) when the class of the
+// receiver is known. The receiver may be a chain of fields and calls.
+func (r *Renderer) renderMethodCall(callee *lexer.MemberExpr, args []lexer.Expr) (string, bool) {
+	if index, ok := callee.Object.(*lexer.IndexExpr); ok {
+		receiver := r.renderExpr(index)
+		className, ok := r.listElementClass(receiver)
+		if !ok {
+			return "", false
+		}
+		return r.methodCall(className, callee.Member, receiver, r.renderExprList(args)), true
+	}
+	ident, ok := callee.Object.(*lexer.IdentExpr)
+	if !ok {
+		className, ok := r.receiverClass(callee.Object)
+		if !ok {
+			return "", false
+		}
+		return r.methodCall(className, callee.Member, r.renderExpr(callee.Object), r.renderExprList(args)), true
+	}
+	if ident.Name == "this" {
+		if r.currentClassName == "" {
+			return "", false
+		}
+		return r.methodCall(r.currentClassName, callee.Member, "this", r.renderExprList(args)), true
+	}
+
+	obj, exists := r.globalObjects[ident.Name]
+	if !exists {
+		return "", false
+	}
+	className := obj.Type
+	if parts := strings.SplitN(className, ".", 2); len(parts) == 2 {
+		className = lexer.GenerateUniqueSymbol(parts[1], parts[0])
+	}
+	receiver := lexer.ResolveSymbol(ident.Name, r.currentModule)
+	return r.methodCall(className, callee.Member, receiver, r.renderExprList(args)), true
+}
+
+// Renders a call of a method on a receiver of the given class. Inherited
+// methods are called on the receiver upcast to the class that defines them,
+// and interface methods through the vtable of the receiver.
+func (r *Renderer) methodCall(className, method, receiver, args string) string {
+	if r.isInterface(className) {
+		return interfaceMethodCall(method, receiver, args)
+	}
+	if owner, ok := r.methodOwner(className, method); ok && owner != className {
+		receiver = fmt.Sprintf("%s_as_%s(%s)", className, owner, receiver)
+		className = owner
+	}
+	if args == "" {
+		return fmt.Sprintf("%s_%s(%s)", className, method, receiver)
+	}
+	return fmt.Sprintf("%s_%s(%s, %s)", className, method, receiver, args)
+}
+
+// Resolves the class and the rendered receiver of a method call statement on
+// a receiver that is a chain of fields and calls, as in order.owner().rename().
+func (r *Renderer) chainedReceiver(object string) (string, string, bool) {
+	expr, err := lexer.ParseExpr(object)
+	if err != nil {
+		return "", "", false
+	}
+	className, ok := r.receiverClass(expr)
+	if !ok {
+		return "", "", false
+	}
+	return className, r.renderExpr(expr), true
+}
+
+// Parses a value that reaches a field or calls a method through the result of
+// another call, as in order.owner().name.
+func memberChain(value string) (lexer.Expr, bool) {
+	expr, err := lexer.ParseExpr(value)
+	if err != nil {
+		return nil, false
+	}
+	var object lexer.Expr
+	switch e := expr.(type) {
+	case *lexer.MemberExpr:
+		object = e.Object
+	case *lexer.CallExpr:
+		callee, ok := e.Callee.(*lexer.MemberExpr)
+		if !ok {
+			return nil, false
+		}
+		object = callee.Object
+	default:
+		return nil, false
+	}
+	for {
+		switch e := object.(type) {
+		case *lexer.CallExpr:
+			return expr, true
+		case *lexer.MemberExpr:
+			object = e.Object
+		default:
+			return nil, false
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package renderer
+
+import (
+	"scar/lexer"
+	"testing"
+)
+
+func TestRenderExpr(t *testing.T) {
+	r := NewRenderer(Options{})
+	r.currentClassName = "Counter"
+	r.globalObjects = map[string]*ObjectInfo{"c": {Name: "c", Type: "Counter"}}
+
+	tests := map[string]string{
+		"a+b*2":                      "a + b * 2",
+		"this.count + 1":             "this->count + 1",
+		"this.add(this.step, 2)":     "Counter_add(this, this->step, 2)",
+		"c.total() > 0 and not done": "Counter_total(c) > 0 && !done",
+		"p.next.value == nil":        "p->next->value == NULL",
+		"float(x) / 2":               "(float)(x) / 2",
+		"new Point(1, 2)":            "Point_new(1, 2)",
+		"Color.RED":                  "Color_RED",
+		"items[i + 1]":               "items[i + 1]",
+		"get!(m, \"a.b\")":           "(*(int*)__scar_map_get(&m, &(char*){\"a.b\"}))",
+		"(a or b) and c":             "(a || b) && c",
+		"not a == b or c":            "!(a == b) || c",
+		"not not done":               "!!done",
+		"n as f64 / 2":               "((double)(n)) / 2",
+		"-x as u8":                   "((u8)(-x))",
+	}
+	for input, want := range tests {
+		if got := r.convertThisReferencesGranular(input); got != want {
+			t.Errorf("convertThisReferencesGranular(%q) = %q, want %q", input, got, want)
+		}
+	}
+
+	// Raw C the expression parser rejects falls back to textual rewriting.
+	if got := r.convertThisReferencesGranular("x > 0 ? this.a : this.b"); got != "x > 0 ? this->a : this->b" {
+		t.Errorf("unexpected fallback rendering: %q", got)
+	}
+	if got := r.convertThisReferencesGranular("ready and not x ? a : b"); got != "ready && !x ? a : b" {
+		t.Errorf("unexpected fallback rendering of logical keywords: %q", got)
+	}
+	if _, err := lexer.ParseExpr("x > 0 ? a : b"); err == nil {
+		t.Error("expected the ternary operator to be rejected by the expression parser")
+	}
+}
@@ -0,0 +1,67 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains the rendering of the C functions declared with extern fn.
+//
+// An extern function is called directly, so every unit of a program includes
+// the headers extern functions are declared from, and declares those without
+// a header by a prototype of its own.
+
+package renderer
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Returns the C type an extern function takes or returns for a scar type.
+// Strings are passed as const char* like C libraries take them, and returned
+// as the char* C libraries return them as.
+func (r *Renderer) externCType(scarType string, isRef, param bool) string {
+	cType := r.mapTypeToCType(scarType)
+	switch {
+	case scarType == "string" && param && !isRef:
+		cType = "const char*"
+	case scarType == "string":
+		cType = "char*"
+	}
+	if isRef {
+		cType += "*"
+	}
+	return cType
+}
+
+// Emits the includes of the headers extern functions are declared from,
+// followed by the prototypes of those declared without one.
+func (r *Renderer) writeExternDeclarations(b *strings.Builder) {
+	var (
+		headers    []string
+		prototypes strings.Builder
+	)
+	for _, name := range slices.Sorted(maps.Keys(r.externFunctions)) {
+		extern := r.externFunctions[name]
+		if extern.Header != "" {
+			headers = append(headers, extern.Header)
+			continue
+		}
+		params := make([]string, len(extern.Parameters))
+		for i, param := range extern.Parameters {
+			params[i] = r.externCType(param.Type, param.IsRef, true) + " " + param.Name
+		}
+		if len(params) == 0 {
+			params = []string{"void"}
+		}
+		fmt.Fprintf(&prototypes, "%s %s(%s);\n", r.externCType(extern.ReturnType, false, false), name, strings.Join(params, ", "))
+	}
+	slices.Sort(headers)
+	for _, header := range slices.Compact(headers) {
+		fmt.Fprintf(b, "#include \"%s\"\n", header)
+	}
+	b.WriteString(prototypes.String())
+	if len(r.externFunctions) > 0 {
+		b.WriteString("\n")
+	}
+}
@@ -0,0 +1,50 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains code generation for iterating over the lines of a std/io file:
+//
+//	foreach (string line in f.lines):
+//
+// Each line is read into one heap buffer, which grows to fit the longest line
+// and is freed when the loop ends.
+
+package renderer
+
+import (
+	"fmt"
+	"strings"
+
+	"scar/lexer"
+)
+
+// Returns the object a foreach iterates over the lines of, if its collection
+// is the lines of a std/io File.
+func (r *Renderer) fileLines(collection string) (string, bool) {
+	object, ok := strings.CutSuffix(collection, ".lines")
+	if !ok {
+		return "", false
+	}
+	className, ok := r.receiverClass(&lexer.IdentExpr{Name: object})
+	if !ok {
+		return "", false
+	}
+	if module, name, found := strings.Cut(className, "."); found {
+		className = lexer.GenerateUniqueSymbol(name, module)
+	}
+	return object, className == lexer.GenerateUniqueSymbol("File", "io")
+}
+
+// Emits a foreach over the lines of a file, leaving its body to the caller.
+func (r *Renderer) renderFileLinesForeach(b *strings.Builder, indent, object, varName string) {
+	fmt.Fprintf(b, "%s{\n", indent)
+	fmt.Fprintf(b, "%s    char* %s = NULL;\n", indent, varName)
+	fmt.Fprintf(b, "%s    size_t __cap = 0;\n", indent)
+	fmt.Fprintf(b, "%s    while (__scar_io_getline(&%s, &__cap, (FILE*)%s->handle)) {\n", indent, varName, lexer.ResolveSymbol(object, r.currentModule))
+}
+
+// Closes a foreach over the lines of a file after its body.
+func endFileLinesForeach(b *strings.Builder, indent, varName string) {
+	fmt.Fprintf(b, "%s    free(%s);\n", indent, varName)
+	fmt.Fprintf(b, "%s}\n", indent)
+}
@@ -0,0 +1,180 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains code generation for interfaces.
+//
+// An interface value is a fat pointer holding the object and a vtable of
+// adapters for the class it was created from. Calling a method through it
+// dispatches on the vtable, so values of different classes can share a list.
+
+package renderer
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"scar/lexer"
+)
+
+// Reports whether a type names an interface.
+func (r *Renderer) isInterface(name string) bool {
+	_, exists := r.globalInterfaces[name]
+	return exists
+}
+
+// Returns the interfaces a class implements, including those of its ancestors.
+func (r *Renderer) classInterfaces(className string) []string {
+	var (
+		interfaces []string
+		seen       = make(map[string]bool)
+	)
+	for _, name := range append([]string{className}, r.classAncestors(className)...) {
+		class, exists := r.globalClasses[name]
+		if !exists {
+			continue
+		}
+		for _, iface := range class.Interfaces {
+			if !seen[iface] && r.isInterface(iface) {
+				seen[iface] = true
+				interfaces = append(interfaces, iface)
+			}
+		}
+	}
+	return interfaces
+}
+
+// Returns the interface names in a stable order.
+func (r *Renderer) sortedInterfaceNames() []string {
+	names := make([]string, 0, len(r.globalInterfaces))
+	for name := range r.globalInterfaces {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Returns the C type of a method parameter.
+func (r *Renderer) methodParamType(param *lexer.MethodParameter) string {
+	paramType := r.mapTypeToCType(param.Type)
+	if param.Type == "string" {
+		return "char*"
+	}
+	if _, isPrimitive := primitiveTypes[param.Type]; !isPrimitive && !r.isInterface(param.Type) {
+		return paramType + "*"
+	}
+	return paramType
+}
+
+// Returns the C return type of a function or method. Objects are returned as
+// pointers to them.
+func (r *Renderer) methodReturnType(returnType string) string {
+	if returnType == "" || returnType == "void" {
+		return "void"
+	}
+	if className, ok := r.countedClass(returnType); ok {
+		return className + "*"
+	}
+	return r.mapTypeToCType(returnType)
+}
+
+// Returns the C parameter list of a method after its receiver.
+func (r *Renderer) methodParamList(receiver string, params []*lexer.MethodParameter) string {
+	list := []string{receiver}
+	for _, param := range params {
+		list = append(list, fmt.Sprintf("%s %s", r.methodParamType(param), param.Name))
+	}
+	return strings.Join(list, ", ")
+}
+
+// Emits the vtable and value types of an interface.
+func (r *Renderer) generateInterfaceDefinition(b *strings.Builder, iface *lexer.InterfaceDeclStmt) {
+	fmt.Fprintf(b, "typedef struct %s_vtable {\n", iface.Name)
+	for _, method := range iface.Methods {
+		fmt.Fprintf(b, "    %s (*%s)(%s);\n", r.methodReturnType(method.ReturnType), method.Name, r.methodParamList("void* self", method.Parameters))
+	}
+	fmt.Fprintf(b, "} %s_vtable;\n\n", iface.Name)
+	fmt.Fprintf(b, "typedef struct %s {\n", iface.Name)
+	fmt.Fprintf(b, "    void* self;\n")
+	fmt.Fprintf(b, "    const %s_vtable* vtable;\n", iface.Name)
+	fmt.Fprintf(b, "} %s;\n\n", iface.Name)
+}
+
+// Emits the vtable of every interface a class implements together with the
+// helper converting an object of the class into an interface value. The
+// adapters the vtables point to are defined by generateInterfaceAdapters.
+func (r *Renderer) generateInterfaceVtables(b *strings.Builder, className string) {
+	for _, name := range r.classInterfaces(className) {
+		iface := r.globalInterfaces[name]
+		var entries []string
+		for _, method := range iface.Methods {
+			adapter := fmt.Sprintf("%s_%s_%s", className, name, method.Name)
+			fmt.Fprintf(b, "static %s %s(%s);\n", r.methodReturnType(method.ReturnType), adapter, r.methodParamList("void* self", method.Parameters))
+			entries = append(entries, fmt.Sprintf(".%s = %s", method.Name, adapter))
+		}
+		fmt.Fprintf(b, "static const %s_vtable %s_%s_vtable = { %s };\n", name, className, name, strings.Join(entries, ", "))
+		fmt.Fprintf(b, "static inline %s %s_as_%s(%s* obj) { return (%s){ obj, &%s_%s_vtable }; }\n\n", name, className, name, className, name, className, name)
+	}
+}
+
+// Emits the adapters forwarding interface calls to the methods of a class.
+func (r *Renderer) generateInterfaceAdapters(b *strings.Builder, className string) {
+	for _, name := range r.classInterfaces(className) {
+		for _, method := range r.globalInterfaces[name].Methods {
+			args := make([]string, len(method.Parameters))
+			for i, param := range method.Parameters {
+				args[i] = param.Name
+			}
+			call := r.methodCall(className, method.Name, fmt.Sprintf("(%s*)self", className), strings.Join(args, ", "))
+
+			fmt.Fprintf(b, "static %s %s_%s_%s(%s) {\n", r.methodReturnType(method.ReturnType), className, name, method.Name, r.methodParamList("void* self", method.Parameters))
+			if r.methodReturnType(method.ReturnType) == "void" {
+				fmt.Fprintf(b, "    %s;\n", call)
+			} else {
+				fmt.Fprintf(b, "    return %s;\n", call)
+			}
+			b.WriteString("}\n\n")
+		}
+	}
+}
+
+// Renders a call of an interface method through the vtable of the value.
+func interfaceMethodCall(method, receiver, args string) string {
+	if args == "" {
+		return fmt.Sprintf("%s.vtable->%s(%s.self)", receiver, method, receiver)
+	}
+	return fmt.Sprintf("%s.vtable->%s(%s.self, %s)", receiver, method, receiver, args)
+}
+
+// Converts a value to the given interface when it is an object of a class
+// implementing it. Other values are returned unchanged.
+func (r *Renderer) interfaceValue(ifaceName, value string) string {
+	className := ""
+	if obj, exists := r.globalObjects[value]; exists {
+		className = obj.Type
+	} else if expr, err := lexer.ParseExpr(value); err == nil {
+		if newExpr, ok := expr.(*lexer.NewExpr); ok {
+			className = newExpr.Class
+			value = r.renderExpr(newExpr)
+		}
+	}
+	if className == "" || className == ifaceName {
+		return value
+	}
+	return fmt.Sprintf("%s_as_%s(%s)", className, ifaceName, value)
+}
+
+// Returns the class or interface of the elements of an indexed list, such as
+// shapes[i].
+func (r *Renderer) listElementClass(object string) (string, bool) {
+	open := strings.Index(object, "[")
+	if open <= 0 || !strings.HasSuffix(object, "]") {
+		return "", false
+	}
+	elemType := r.globalArrays[strings.TrimSpace(object[:open])]
+	if _, isClass := r.globalClasses[elemType]; isClass || r.isInterface(elemType) {
+		return elemType, true
+	}
+	return "", false
+}
@@ -0,0 +1,288 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains code generation for interpolated strings such as "Hello {name}".
+//
+// Each hole becomes a printf argument whose conversion specifier is inferred
+// from the declared type of the variable, field or function it names.
+
+package renderer
+
+import (
+	"fmt"
+	"strings"
+
+	"scar/lexer"
+)
+
+// Records the declared types of function or method parameters.
+func (r *Renderer) declareParamTypes(params []*lexer.MethodParameter) {
+	for _, param := range params {
+		if param.IsList {
+			r.varTypes[param.Name] = "list[" + listParamElemType(param) + "]"
+		} else {
+			r.varTypes[param.Name] = param.Type
+		}
+		if _, isClass := r.countedClass(param.Type); isClass {
+			r.globalObjects[param.Name] = &ObjectInfo{Name: param.Name, Type: param.Type}
+		}
+	}
+}
+
+// Returns the printf format string for the segments of an interpolated string,
+// with a conversion specifier for each hole.
+func (r *Renderer) interpolationFormat(segments, holes []string) string {
+	var format strings.Builder
+	for i, segment := range segments {
+		format.WriteString(printfText(segment))
+		if i < len(holes) {
+			format.WriteString(r.formatSpec(holes[i]))
+		}
+	}
+	return format.String()
+}
+
+// Renders an interpolated string as a C expression evaluating to a new heap
+// string. Reports false when the value has no holes, or holes the parser
+// rejects.
+func (r *Renderer) interpolatedString(value string) (string, bool) {
+	segments, holes, ok, err := lexer.Interpolate(value)
+	if !ok || err != nil {
+		return "", false
+	}
+	args := []string{fmt.Sprintf("\"%s\"", r.interpolationFormat(segments, holes))}
+	for _, hole := range holes {
+		args = append(args, r.convertThisReferencesGranular(lexer.ResolveSymbol(hole, r.currentModule)))
+	}
+	return fmt.Sprintf("__scar_str_format(%s)", strings.Join(args, ", ")), true
+}
+
+// Renders a quoted string literal with holes as a new heap string.
+func (r *Renderer) interpolatedLiteral(value string) (string, bool) {
+	if len(value) < 2 || !strings.HasPrefix(value, "\"") || !strings.HasSuffix(value, "\"") {
+		return "", false
+	}
+	return r.interpolatedString(value[1 : len(value)-1])
+}
+
+// Returns the start of the C call writing a print or put statement, which
+// writes to stderr for eprint and eput.
+func printCall(stderr bool) string {
+	if stderr {
+		return "fprintf(stderr, "
+	}
+	return "printf("
+}
+
+// Emits a print or put statement without values, which writes its text with
+// fputs so a % in it is printed as it is.
+func writeText(b *strings.Builder, indent, text, newline string, stderr bool) {
+	stream := "stdout"
+	if stderr {
+		stream = "stderr"
+	}
+	fmt.Fprintf(b, "%sfputs(\"%s%s\", %s);\n", indent, cStringBody(text), newline, stream)
+}
+
+// Emits a printf call for an interpolated print or put statement.
+func (r *Renderer) renderInterpolatedPrint(b *strings.Builder, indent, newline string, segments, holes []string, stderr bool, program *lexer.Program) {
+	if len(holes) == 0 {
+		writeText(b, indent, strings.Join(segments, ""), newline, stderr)
+		return
+	}
+	format := r.interpolationFormat(segments, holes) + newline
+	args := make([]string, len(holes))
+	for i, hole := range holes {
+		args[i] = r.renderPrintArg(hole, program)
+	}
+	fmt.Fprintf(b, "%s%s\"%s\", %s);\n", indent, printCall(stderr), format, strings.Join(args, ", "))
+}
+
+// The scar types of the fields of a caught exception.
+var exceptionFieldTypes = map[string]string{"message": "string", "code": "int"}
+
+// Returns the printf conversion specifier for the value of an expression.
+func (r *Renderer) formatSpec(expr string) string {
+	tree, err := lexer.ParseExpr(expr)
+	if err != nil {
+		return "%d"
+	}
+	switch r.mapTypeToCType(strings.TrimSuffix(r.exprType(tree), "?")) {
+	case "char*", "cstring":
+		return "%s"
+	case "char":
+		return "%c"
+	case "float", "double":
+		return "%f"
+	case "unsigned int", "unsigned short":
+		return "%u"
+	case "unsigned long":
+		return "%lu"
+	case "long":
+		return "%ld"
+	}
+	return "%d"
+}
+
+// Infers the scar type of an expression from literals and the declared types
+// of the variables, fields and functions it uses. Returns "" when unknown.
+func (r *Renderer) exprType(expr lexer.Expr) string {
+	switch e := expr.(type) {
+	case *lexer.LiteralExpr:
+		switch e.Kind {
+		case lexer.IntLiteral:
+			return "int"
+		case lexer.FloatLiteral:
+			return "float"
+		case lexer.StringLiteral:
+			return "string"
+		case lexer.CharLiteral:
+			return "char"
+		case lexer.BoolLiteral:
+			return "bool"
+		}
+	case *lexer.IdentExpr:
+		if r.isHeapString(e.Name) {
+			return "string"
+		}
+		if enumName, ok := r.enumOfMember(e.Name); ok {
+			return enumName
+		}
+		if typ, exists := r.varTypes[e.Name]; exists {
+			return typ
+		}
+		if pubVar, exists := r.globalVars[e.Name]; exists {
+			return pubVar.Type
+		}
+		if elemType, exists := r.globalArrays[e.Name]; exists {
+			return "list[" + elemType + "]"
+		}
+		return lexer.LibraryTypes[e.Name]
+	case *lexer.ParenExpr:
+		return r.exprType(e.Inner)
+	case *lexer.CastExpr:
+		return e.Type
+	case *lexer.UnaryExpr:
+		if e.Op == "not" || e.Op == "!" {
+			return "bool"
+		}
+		return r.exprType(e.Operand)
+	case *lexer.BinaryExpr:
+		switch e.Op {
+		case "==", "!=", "<", ">", "<=", ">=", "and", "or", "&&", "||":
+			return "bool"
+		}
+		left, right := r.exprType(e.Left), r.exprType(e.Right)
+		for _, typ := range []string{"double", "f64", "float", "f32"} {
+			if left == typ || right == typ {
+				return typ
+			}
+		}
+		if left != "" {
+			return left
+		}
+		return right
+	case *lexer.IndexExpr:
+		objType := r.exprType(e.Object)
+		if elemType, ok := nestedListType(objType); ok {
+			return elemType
+		}
+		if objType == "string" {
+			return "char"
+		}
+	case *lexer.SliceExpr:
+		return r.exprType(e.Object)
+	case *lexer.MemberExpr:
+		if ident, ok := e.Object.(*lexer.IdentExpr); ok && r.exceptionVars[ident.Name] {
+			return exceptionFieldTypes[e.Member]
+		}
+		if module, ok := exprModule(e.Object); ok {
+			return r.varTypes[lexer.GenerateUniqueSymbol(e.Member, module)]
+		}
+		if fieldType, ok := r.structField(r.exprType(e.Object), e.Member); ok {
+			return fieldType
+		}
+		if className, ok := r.receiverClass(e.Object); ok {
+			if field, exists := r.findField(className, e.Member); exists {
+				// A reference to a char is a C string.
+				if field.IsRef && field.Type == "char" {
+					return "char*"
+				}
+				return strings.TrimPrefix(field.Type, "ref ")
+			}
+		}
+	case *lexer.CallExpr:
+		if _, ok := r.renderEnumCall(e); ok {
+			if callee, isMember := e.Callee.(*lexer.MemberExpr); isMember && callee.Member == "to_string" {
+				return "string"
+			}
+			return e.Callee.(*lexer.IdentExpr).Name
+		}
+		switch callee := e.Callee.(type) {
+		case *lexer.IdentExpr:
+			if typ, ok := r.conversionType(callee.Name); ok {
+				return typ
+			}
+			if typ, ok := r.listBuiltinType(callee.Name, e.Args); ok {
+				return typ
+			}
+			switch callee.Name {
+			case "len", "maplen!", "ulen":
+				return "int"
+			case "has!", "del!", "contains!":
+				return "bool"
+			case "get!":
+				if len(e.Args) == 2 {
+					if mapName, ok := exprVarName(e.Args[0]); ok {
+						if info, ok := r.lookupMap(mapName); ok {
+							return info.valueType
+						}
+					}
+				}
+			}
+			if castTypes[callee.Name] || r.isStructType(callee.Name) {
+				return callee.Name
+			}
+			if typ, ok := charCasts[callee.Name]; ok {
+				return typ
+			}
+			if funcDecl, exists := r.globalFunctions[callee.Name]; exists {
+				return funcDecl.ReturnType
+			}
+			return lexer.LibraryTypes[callee.Name]
+		case *lexer.MemberExpr:
+			if module, ok := exprModule(callee.Object); ok {
+				if funcDecl, exists := r.globalFunctions[lexer.GenerateUniqueSymbol(callee.Member, module)]; exists {
+					return funcDecl.ReturnType
+				}
+			}
+			if className, ok := r.receiverClass(callee.Object); ok {
+				if owner, ok := r.methodOwner(className, callee.Member); ok {
+					for _, method := range r.globalClasses[owner].Methods {
+						if method.Name == callee.Member {
+							return method.ReturnType
+						}
+					}
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// Returns the class of a receiver that is this, a known object or a chain of
+// fields and calls evaluating to an object, such as order.owner().
+func (r *Renderer) receiverClass(expr lexer.Expr) (string, bool) {
+	ident, ok := expr.(*lexer.IdentExpr)
+	if !ok {
+		return r.countedClass(r.exprType(expr))
+	}
+	if ident.Name == "this" {
+		return r.currentClassName, r.currentClassName != ""
+	}
+	if obj, exists := r.globalObjects[ident.Name]; exists {
+		return obj.Type, true
+	}
+	return "", false
+}
@@ -0,0 +1,23 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains the rendering of object creation for --leak-check.
+//
+// The allocation tracking of --leak-check records where malloc was called,
+// which for an object is inside its constructor. A new expression is wrapped
+// in __scar_new_at, which moves the record of the object to the scar file and
+// line of the expression through the #line directives.
+
+package renderer
+
+import "fmt"
+
+// Returns the constructor call of a new expression, tracked at the line of
+// the expression with --leak-check.
+func (r *Renderer) allocatedAt(call string) string {
+	if !r.opts.LeakCheck {
+		return call
+	}
+	return fmt.Sprintf("__scar_new_at(%s)", call)
+}
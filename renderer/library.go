@@ -0,0 +1,73 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains the rendering of programs built as C libraries with -emit-lib.
+//
+// A library has no main: the top-level statements of the program run when
+// the library is loaded instead, from a constructor function. Its header
+// declares the pub functions and pub classes of the program, classes being
+// opaque types used through their constructor, methods and free function.
+
+package renderer
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"scar/lexer"
+)
+
+// Renders a program as the C code of a library named name, returning the code
+// along with the header declaring its pub functions and classes.
+func (r *Renderer) RenderLibrary(program *lexer.Program, baseDir, name string) (code, header string) {
+	r.libraryMode = true
+	defer func() { r.libraryMode = false }()
+	code = r.RenderC(program, baseDir)
+	return code, r.libraryHeader(program, name)
+}
+
+// Returns the header of a library, which C and C++ code can include.
+func (r *Renderer) libraryHeader(program *lexer.Program, name string) string {
+	guard := "SCAR_LIB_" + strings.ToUpper(strings.Map(func(c rune) rune {
+		if unicode.IsLetter(c) || unicode.IsDigit(c) {
+			return c
+		}
+		return '_'
+	}, name)) + "_H"
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "#ifndef %s\n#define %s\n\n", guard, guard)
+	b.WriteString("#include <stdbool.h>\n#include <stdint.h>\n\n")
+	b.WriteString("#ifdef __cplusplus\nextern \"C\" {\n#endif\n\n")
+	b.WriteString("// Functions returning strings write them to a buffer of 256 bytes passed\n")
+	b.WriteString("// first, and lists are passed as a pointer followed by their length.\n\n")
+
+	var classes strings.Builder
+	for _, stmt := range program.Statements {
+		if stmt.PubClassDecl == nil {
+			continue
+		}
+		className := stmt.PubClassDecl.Name
+		fmt.Fprintf(&classes, "typedef struct %s %s;\n", className, className)
+		r.writeClassPrototypes(&classes, className, program)
+		classes.WriteString("\n")
+	}
+	// The parameter of methods is named self, as this is a keyword of C++.
+	b.WriteString(strings.ReplaceAll(classes.String(), "* this", "* self"))
+
+	for _, stmt := range program.Statements {
+		if decl := stmt.PubTopLevelFuncDecl; decl != nil {
+			fmt.Fprintf(&b, "%s;\n", r.generateFunctionPrototype(&lexer.TopLevelFuncDeclStmt{
+				Name:       decl.Name,
+				Parameters: decl.Parameters,
+				ReturnType: decl.ReturnType,
+			}))
+		}
+	}
+
+	b.WriteString("\n#ifdef __cplusplus\n}\n#endif\n\n")
+	fmt.Fprintf(&b, "#endif\n")
+	return b.String()
+}
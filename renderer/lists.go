@@ -0,0 +1,480 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains code generation for growable lists.
+//
+// A list named xs is lowered to a heap pointer xs together with xs_len and
+// xs_cap, grown with realloc by the list runtime the preprocessor inserts.
+//
+// A nested list such as list[list[int]] is lowered to a pointer to separately
+// allocated rows, with the length of each row kept in xs_lens, so grid[i][j]
+// indexes it directly.
+//
+// A list literal outside of a declaration is lowered to a temporary C array
+// and its length, such as ((int[]){1, 2}) and 2, which is passed to a list
+// parameter as it is, or copied into the list assigned or returned.
+
+package renderer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"scar/lexer"
+)
+
+// Capacity reserved for lists filled by list-returning functions.
+const listReturnCapacity = 1000
+
+// Returns the row type of a nested list element type such as list[int].
+func nestedListType(elemType string) (string, bool) {
+	if strings.HasPrefix(elemType, "list[") && strings.HasSuffix(elemType, "]") {
+		return elemType[5 : len(elemType)-1], true
+	}
+	return "", false
+}
+
+// Reports whether a list visible in the current scope holds lists.
+func (r *Renderer) isNestedList(name string) bool {
+	if elemType, exists := r.globalArrays[name]; exists {
+		_, nested := nestedListType(elemType)
+		return nested
+	}
+	if r.currentFunction != nil {
+		for _, param := range r.currentFunction.Parameters {
+			if param.Name == name && param.IsList {
+				_, nested := nestedListType(listParamElemType(param))
+				return nested
+			}
+		}
+	}
+	return false
+}
+
+// Returns the C declaration of a pointer to the elements of a list.
+func (r *Renderer) listPointer(elemType, name string) string {
+	if rowType, ok := nestedListType(elemType); ok {
+		if rowType == "string" {
+			return fmt.Sprintf("char (**%s)[256]", name)
+		}
+		return fmt.Sprintf("%s** %s", r.mapTypeToCType(rowType), name)
+	}
+	if elemType == "string" {
+		return fmt.Sprintf("char (*%s)[256]", name)
+	}
+	return fmt.Sprintf("%s* %s", r.mapTypeToCType(elemType), name)
+}
+
+// Returns the C parameters a list is passed as.
+func (r *Renderer) listParams(elemType, name string) []string {
+	if _, ok := nestedListType(elemType); ok {
+		return []string{r.listPointer(elemType, name), fmt.Sprintf("int* %s_lens", name), fmt.Sprintf("int %s_len", name)}
+	}
+	if elemType == "string" {
+		return []string{fmt.Sprintf("char %s[][256]", name), fmt.Sprintf("int %s_len", name)}
+	}
+	return []string{fmt.Sprintf("%s %s[]", r.mapTypeToCType(elemType), name), fmt.Sprintf("int %s_len", name)}
+}
+
+// Returns the element type of a list parameter.
+func listParamElemType(param *lexer.MethodParameter) string {
+	if param.ListType != "" {
+		return param.ListType
+	}
+	if elemType, ok := nestedListType(param.Type); ok {
+		return elemType
+	}
+	return param.Type
+}
+
+// Reports whether a parameter is a list of values rather than of lists.
+func isFlatListParam(param *lexer.MethodParameter) bool {
+	if !param.IsList && !strings.HasPrefix(param.Type, "list[") {
+		return false
+	}
+	_, nested := nestedListType(listParamElemType(param))
+	return !nested
+}
+
+// Emits the declaration of an empty list.
+func (r *Renderer) declareList(b *strings.Builder, indent, elemType, name string) {
+	fmt.Fprintf(b, "%s%s = NULL;\n", indent, r.listPointer(elemType, name))
+	if _, ok := nestedListType(elemType); ok {
+		fmt.Fprintf(b, "%sint* %s_lens = NULL;\n", indent, name)
+	}
+	fmt.Fprintf(b, "%sint %s_len = 0;\n", indent, name)
+	fmt.Fprintf(b, "%sint %s_cap = 0;\n", indent, name)
+}
+
+// Emits code appending a copy of a row of n elements to a nested list.
+func pushRow(b *strings.Builder, indent, name, row, n string) {
+	fmt.Fprintf(b, "%s__scar_list_push_row(%s, %s_lens, %s_len, %s_cap, %s, %s);\n", indent, name, name, name, name, row, n)
+}
+
+// Emits code appending a row to a nested list from a scar value, which is
+// either a list literal or the name of a list.
+func (r *Renderer) pushRowValue(b *strings.Builder, indent, elemType, name, value string) {
+	rowType, _ := nestedListType(elemType)
+	if !strings.HasPrefix(value, "[") || !strings.HasSuffix(value, "]") {
+		row := lexer.ResolveSymbol(value, r.currentModule)
+		pushRow(b, indent, name, row, row+"_len")
+		return
+	}
+	elements := lexer.SplitArguments(value[1 : len(value)-1])
+	if len(elements) == 0 {
+		pushRow(b, indent, name, "NULL", "0")
+		return
+	}
+	for i, elem := range elements {
+		elements[i] = r.convertThisReferencesGranular(lexer.ResolveSymbol(elem, r.currentModule))
+	}
+	cType := r.mapTypeToCType(rowType)
+	if rowType == "string" {
+		cType = "char"
+		for i, elem := range elements {
+			if !strings.HasPrefix(elem, "\"") {
+				elements[i] = fmt.Sprintf("\"%s\"", elem)
+			}
+		}
+		pushRow(b, indent, name, fmt.Sprintf("((%s[][256]){%s})", cType, strings.Join(elements, ", ")), strconv.Itoa(len(elements)))
+		return
+	}
+	pushRow(b, indent, name, fmt.Sprintf("((%s[]){%s})", cType, strings.Join(elements, ", ")), strconv.Itoa(len(elements)))
+}
+
+// Returns the list literal a scar value is, such as [1, 2, 3].
+func listLiteral(value string) (*lexer.ListExpr, bool) {
+	expr, err := lexer.ParseExpr(value)
+	if err != nil {
+		return nil, false
+	}
+	list, ok := expr.(*lexer.ListExpr)
+	return list, ok
+}
+
+// Renders a list literal as a temporary C array of elemType, which lives
+// until the end of the enclosing block, returning it along with its length.
+// Strings are copied into rows of 256 chars, as string lists hold them.
+func (r *Renderer) renderListLiteral(elemType string, list *lexer.ListExpr) (string, string) {
+	n := strconv.Itoa(len(list.Elements))
+	if len(list.Elements) == 0 {
+		return "NULL", n
+	}
+	elements := r.renderExprList(list.Elements)
+	if elemType == "string" {
+		return fmt.Sprintf("__scar_list_strs((char[%s][256]){0}, %s, %s)", n, n, elements), n
+	}
+	return fmt.Sprintf("((%s[]){%s})", r.mapTypeToCType(elemType), elements), n
+}
+
+// Opens a block holding the elements of a list literal in the list __items,
+// so they are evaluated before the list they are copied to changes.
+func (r *Renderer) openListItems(b *strings.Builder, indent, elemType string, list *lexer.ListExpr) {
+	items, n := r.renderListLiteral(elemType, list)
+	fmt.Fprintf(b, "%s{\n", indent)
+	fmt.Fprintf(b, "%s    %s = %s;\n", indent, r.listPointer(elemType, "__items"), items)
+	fmt.Fprintf(b, "%s    int __items_len = %s;\n", indent, n)
+}
+
+// Emits the assignment of a list literal to a list variable or field,
+// replacing its elements, and reports whether target is a list.
+func (r *Renderer) assignList(b *strings.Builder, indent, target string, list *lexer.ListExpr, line int) bool {
+	elemType, ok := r.globalArrays[target]
+	name := lexer.ResolveSymbol(target, r.currentModule)
+	if !ok {
+		field, err := lexer.ParseExpr(target)
+		if err != nil {
+			return false
+		}
+		if elemType, ok = r.listFieldType(field); !ok {
+			return false
+		}
+		name = r.renderExpr(field)
+	}
+	if _, nested := nestedListType(elemType); nested {
+		r.renderErrorf(line, "a list literal of lists can only initialise a declaration")
+		return true
+	}
+	r.openListItems(b, indent, elemType, list)
+	fmt.Fprintf(b, "%s    %s_len = 0;\n", indent, name)
+	reserveList(b, indent+"    ", name, "__items_len")
+	extendList(b, indent+"    ", elemType, name, "__items")
+	fmt.Fprintf(b, "%s}\n", indent)
+	return true
+}
+
+// Emits code growing a list so it can hold at least n elements.
+func reserveList(b *strings.Builder, indent, name, n string) {
+	fmt.Fprintf(b, "%s__scar_list_reserve(%s, %s_cap, %s);\n", indent, name, name, n)
+}
+
+// Emits code appending a value to the end of a list.
+func pushList(b *strings.Builder, indent, elemType, name, value string) {
+	if elemType == "string" {
+		fmt.Fprintf(b, "%s__scar_list_push_str(%s, %s_len, %s_cap, %s);\n", indent, name, name, name, value)
+	} else {
+		fmt.Fprintf(b, "%s__scar_list_push(%s, %s_len, %s_cap, %s);\n", indent, name, name, name, value)
+	}
+}
+
+// Emits code appending every element of source to target.
+func extendList(b *strings.Builder, indent, elemType, target, source string) {
+	copyListRange(b, indent, elemType, target, source, "0", source+"_len")
+}
+
+// Emits code appending the elements of source from index low up to but not
+// including high to target.
+func copyListRange(b *strings.Builder, indent, elemType, target, source, low, high string) {
+	fmt.Fprintf(b, "%sfor (int __i = %s; __i < %s; __i++) {\n", indent, low, high)
+	if _, ok := nestedListType(elemType); ok {
+		pushRow(b, indent+"    ", target, source+"[__i]", source+"_lens[__i]")
+	} else {
+		pushList(b, indent+"    ", elemType, target, source+"[__i]")
+	}
+	fmt.Fprintf(b, "%s}\n", indent)
+}
+
+// Emits code appending rows zero-filled rows of cols elements to a nested
+// list, as the grid!(rows, cols) builtin does.
+func allocateRows(b *strings.Builder, indent, name, rows, cols string) {
+	fmt.Fprintf(b, "%sfor (int __i = 0; __i < %s; __i++) {\n", indent, rows)
+	fmt.Fprintf(b, "%s    __scar_list_add_row(%s, %s_lens, %s_len, %s_cap, %s);\n", indent, name, name, name, name, cols)
+	fmt.Fprintf(b, "%s}\n", indent)
+}
+
+// Emits code appending the integers of a range, from low to high included, to
+// a list.
+func (r *Renderer) fillRange(b *strings.Builder, indent, name, low, high string) {
+	bound := func(value string) string {
+		value = r.convertThisReferencesGranular(lexer.ResolveSymbol(value, r.currentModule))
+		return r.resolveLenFunctionCalls(value)
+	}
+	fmt.Fprintf(b, "%sfor (int __i = %s; __i <= %s; __i++) {\n", indent, bound(low), bound(high))
+	pushList(b, indent+"    ", "int", name, "__i")
+	fmt.Fprintf(b, "%s}\n", indent)
+}
+
+// Emits code filling a list from map!(list, f), with the results of calling f
+// on each element of list, or from filter!(list, f), with the elements f
+// returns true for. The strings f returns are copied into the list and freed.
+func (r *Renderer) transformList(b *strings.Builder, indent, builtin, elemType, name string, args []string) {
+	if len(args) != 2 {
+		fmt.Fprintf(b, "%s// Error: %s expects a list and a function\n", indent, builtin)
+		return
+	}
+	var (
+		source = r.convertThisReferencesGranular(lexer.ResolveSymbol(strings.TrimSpace(args[0]), r.currentModule))
+		fn     = strings.ReplaceAll(strings.TrimSpace(args[1]), "::", "_")
+		call   = fmt.Sprintf("%s(%s[__i])", fn, source)
+	)
+	reserveList(b, indent, name, source+"_len")
+	fmt.Fprintf(b, "%sfor (int __i = 0; __i < %s_len; __i++) {\n", indent, source)
+	switch {
+	case builtin == "filter!":
+		fmt.Fprintf(b, "%s    if (%s) {\n", indent, call)
+		pushList(b, indent+"        ", elemType, name, source+"[__i]")
+		fmt.Fprintf(b, "%s    }\n", indent)
+	case elemType == "string":
+		fmt.Fprintf(b, "%s    char* __value = %s;\n", indent, call)
+		pushList(b, indent+"    ", elemType, name, "__value")
+		fmt.Fprintf(b, "%s    free(__value);\n", indent)
+	default:
+		pushList(b, indent+"    ", elemType, name, call)
+	}
+	fmt.Fprintf(b, "%s}\n", indent)
+}
+
+// Returns the length variable of a list visible in the current scope.
+func (r *Renderer) listLength(name string) (string, bool) {
+	if _, exists := r.globalArrays[name]; exists {
+		return name + "_len", true
+	}
+	if r.currentFunction != nil {
+		for _, param := range r.currentFunction.Parameters {
+			if param.Name == name && (param.IsList || strings.HasPrefix(param.Type, "list[")) {
+				return name + "_len", true
+			}
+		}
+	}
+	return "", false
+}
+
+// Returns the length of a list a foreach loop iterates over.
+func (r *Renderer) foreachListLength(collection string) (string, bool) {
+	expr, err := lexer.ParseExpr(collection)
+	if err != nil {
+		return "", false
+	}
+	return r.indexedLength(expr)
+}
+
+// Returns the length arguments passed after a list argument.
+func (r *Renderer) listLengthArgs(name, resolved string) []string {
+	if r.isNestedList(name) {
+		return []string{resolved + "_lens", resolved + "_len"}
+	}
+	return []string{resolved + "_len"}
+}
+
+// Returns the length of row index of a nested list.
+func (r *Renderer) rowLength(name, index string) (string, bool) {
+	if !r.isNestedList(name) {
+		return "", false
+	}
+	return fmt.Sprintf("%s_lens[%s]", name, index), true
+}
+
+// Renders the append! builtin as a statement.
+func (r *Renderer) renderAppend(b *strings.Builder, indent string, args []string) {
+	if len(args) != 2 {
+		fmt.Fprintf(b, "%s// Error: append! expects a list and a value\n", indent)
+		return
+	}
+	var (
+		name  = strings.TrimSpace(args[0])
+		value = lexer.ResolveSymbol(strings.TrimSpace(args[1]), r.currentModule)
+	)
+	if field, err := lexer.ParseExpr(name); err == nil {
+		if elemType, ok := r.listFieldType(field); ok {
+			r.appendListField(b, indent, elemType, r.renderExpr(field), strings.TrimSpace(args[1]))
+			return
+		}
+	}
+	if r.isNestedList(name) {
+		r.pushRowValue(b, indent, r.globalArrays[name], lexer.ResolveSymbol(name, r.currentModule), strings.TrimSpace(args[1]))
+		return
+	}
+	value = r.resolveLenFunctionCalls(r.convertThisReferencesGranular(value))
+	if r.isInterface(r.globalArrays[name]) {
+		value = r.interfaceValue(r.globalArrays[name], strings.TrimSpace(args[1]))
+	}
+	pushList(b, indent, r.globalArrays[name], lexer.ResolveSymbol(name, r.currentModule), value)
+}
+
+// Returns the name and element type of a list declared as a field of this in
+// a constructor, as in list[int] this.cells = [0, 0].
+func listField(stmt *lexer.Statement) (string, string, bool) {
+	switch {
+	case stmt.ListDecl != nil && strings.HasPrefix(stmt.ListDecl.Name, "this."):
+		return stmt.ListDecl.Name, stmt.ListDecl.Type, true
+	case stmt.ListDeclFunctionCall != nil && strings.HasPrefix(stmt.ListDeclFunctionCall.Name, "this."):
+		return stmt.ListDeclFunctionCall.Name, stmt.ListDeclFunctionCall.Type, true
+	}
+	return "", "", false
+}
+
+// Returns the element type of a list field reached through an object, such
+// as this.cells or board.grid.
+func (r *Renderer) listFieldType(expr lexer.Expr) (string, bool) {
+	if _, ok := expr.(*lexer.MemberExpr); !ok {
+		return "", false
+	}
+	return nestedListType(r.exprType(expr))
+}
+
+// Writes the struct members a list field is lowered to.
+func (r *Renderer) writeListField(b *strings.Builder, indent, elemType, name string) {
+	fmt.Fprintf(b, "%s%s;\n", indent, r.listPointer(elemType, name))
+	if _, ok := nestedListType(elemType); ok {
+		fmt.Fprintf(b, "%sint* %s_lens;\n", indent, name)
+	}
+	fmt.Fprintf(b, "%sint %s_len;\n", indent, name)
+	fmt.Fprintf(b, "%sint %s_cap;\n", indent, name)
+}
+
+// Emits code emptying a list field.
+func resetListField(b *strings.Builder, indent, elemType, name string) {
+	fmt.Fprintf(b, "%s%s = NULL;\n", indent, name)
+	if _, ok := nestedListType(elemType); ok {
+		fmt.Fprintf(b, "%s%s_lens = NULL;\n", indent, name)
+	}
+	fmt.Fprintf(b, "%s%s_len = 0;\n", indent, name)
+	fmt.Fprintf(b, "%s%s_cap = 0;\n", indent, name)
+}
+
+// Emits the initialisation of a list field of this in a constructor from a
+// list literal or another list.
+func (r *Renderer) initListField(b *strings.Builder, indent string, decl *lexer.ListDeclStmt) {
+	name := "this->" + strings.TrimPrefix(decl.Name, "this.")
+	resetListField(b, indent, decl.Type, name)
+	if _, nested := nestedListType(decl.Type); nested {
+		for _, elem := range decl.Elements {
+			r.pushRowValue(b, indent, decl.Type, name, elem)
+		}
+		return
+	}
+	if len(decl.Elements) == 1 {
+		if _, ok := r.listLength(decl.Elements[0]); ok {
+			source := lexer.ResolveSymbol(decl.Elements[0], r.currentModule)
+			reserveList(b, indent, name, source+"_len")
+			extendList(b, indent, decl.Type, name, source)
+			return
+		}
+	}
+	if len(decl.Elements) > 0 {
+		reserveList(b, indent, name, strconv.Itoa(len(decl.Elements)))
+	}
+	for _, elem := range decl.Elements {
+		elem = r.convertThisReferencesGranular(lexer.ResolveSymbol(elem, r.currentModule))
+		if decl.Type == "string" && !strings.HasPrefix(elem, "\"") {
+			elem = fmt.Sprintf("\"%s\"", elem)
+		}
+		pushList(b, indent, decl.Type, name, elem)
+	}
+}
+
+// Emits the initialisation of a list field of this in a constructor from a
+// range, grid!, map!, filter! or a list-returning function.
+func (r *Renderer) initListFieldCall(b *strings.Builder, indent string, decl *lexer.ListDeclFunctionCallStmt) {
+	name := "this->" + strings.TrimPrefix(decl.Name, "this.")
+	resetListField(b, indent, decl.Type, name)
+	if low, high, ok := lexer.ParseRange(decl.FunctionCall); ok {
+		r.fillRange(b, indent, name, low, high)
+		return
+	}
+	funcName, args := parseFunctionCall(decl.FunctionCall)
+	for i, arg := range args {
+		args[i] = r.convertThisReferencesGranular(lexer.ResolveSymbol(arg, r.currentModule))
+	}
+	if funcName == "map!" || funcName == "filter!" {
+		r.transformList(b, indent, funcName, decl.Type, name, args)
+		return
+	}
+	if funcName == "grid!" {
+		if len(args) == 2 {
+			allocateRows(b, indent, name, args[0], args[1])
+		} else {
+			fmt.Fprintf(b, "%s// Error: grid! expects a row and a column count\n", indent)
+		}
+		return
+	}
+	reserveList(b, indent, name, strconv.Itoa(listReturnCapacity))
+	callArgs := append([]string{name, name + "_cap"}, args...)
+	fmt.Fprintf(b, "%s%s_len = %s(%s);\n", indent, name, lexer.ResolveSymbol(funcName, r.currentModule), strings.Join(callArgs, ", "))
+}
+
+// Emits code freeing the elements of a list field.
+func freeListField(b *strings.Builder, indent, elemType, name string) {
+	if _, ok := nestedListType(elemType); ok {
+		fmt.Fprintf(b, "%sfor (int __i = 0; __i < %s_len; __i++) {\n", indent, name)
+		fmt.Fprintf(b, "%s    free(%s[__i]);\n", indent, name)
+		fmt.Fprintf(b, "%s}\n", indent)
+		fmt.Fprintf(b, "%sfree(%s_lens);\n", indent, name)
+	}
+	fmt.Fprintf(b, "%sfree(%s);\n", indent, name)
+}
+
+// Emits the append! builtin on a list field.
+func (r *Renderer) appendListField(b *strings.Builder, indent, elemType, name, value string) {
+	if _, nested := nestedListType(elemType); nested {
+		r.pushRowValue(b, indent, elemType, name, value)
+		return
+	}
+	value = r.resolveLenFunctionCalls(r.convertThisReferencesGranular(lexer.ResolveSymbol(value, r.currentModule)))
+	if elemType == "string" && !strings.HasPrefix(value, "\"") && !r.isHeapString(value) && !strings.Contains(value, "->") {
+		value = fmt.Sprintf("\"%s\"", value)
+	}
+	pushList(b, indent, elemType, name, value)
+}
@@ -0,0 +1,134 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains the rendering of the list builtins contains!, index_of!, sum!,
+// min!, max! and reverse!.
+//
+// Each is lowered to a helper of the list runtime made for the element type
+// of the list, such as __scar_list_sum_int, which takes the list and its
+// length. contains! and index_of! also take strings, which are compared with
+// strcmp; sum!, min! and max! take numbers and chars, and min! and max! abort
+// on an empty list. reverse! is a statement reversing a list in place.
+
+package renderer
+
+import (
+	"fmt"
+	"strings"
+
+	"scar/lexer"
+)
+
+// Returns the C expression of a list a builtin is given, which is a list
+// variable, parameter or field, along with its element type.
+func (r *Renderer) listOperand(expr lexer.Expr) (string, string, bool) {
+	if elemType, ok := r.listFieldType(expr); ok {
+		return r.renderExpr(expr), elemType, true
+	}
+	ident, ok := expr.(*lexer.IdentExpr)
+	if !ok {
+		return "", "", false
+	}
+	if elemType, ok := r.globalArrays[ident.Name]; ok {
+		return r.renderExpr(expr), elemType, true
+	}
+	if typ, ok := strings.CutPrefix(r.varTypes[ident.Name], "list["); ok {
+		return r.renderExpr(expr), strings.TrimSuffix(typ, "]"), true
+	}
+	return "", "", false
+}
+
+// Returns the name the list and sort runtimes give their helpers for the
+// elements of a scar type, as in __scar_cmp_int or __scar_list_sum_str.
+func runtimeTypeName(scarType string) (string, bool) {
+	switch scarType {
+	case "string":
+		return "str", true
+	case "int", "i32":
+		return "int", true
+	case "float", "f32":
+		return "float", true
+	case "double", "f64":
+		return "double", true
+	case "long", "i64":
+		return "long", true
+	case "char", "bool":
+		return scarType, true
+	case "i8", "i16":
+		return "int" + scarType[1:] + "_t", true
+	case "u8", "u16", "u32", "u64":
+		return "uint" + scarType[1:] + "_t", true
+	}
+	return "", false
+}
+
+// Renders contains!(list, value), index_of!(list, value), sum!(list),
+// min!(list) and max!(list) inside expressions. contains! of a set is left to
+// renderSetBuiltin.
+func (r *Renderer) renderListBuiltin(name string, args []lexer.Expr) (string, bool) {
+	var arity int
+	switch name {
+	case "contains!", "index_of!":
+		arity = 2
+	case "sum!", "min!", "max!":
+		arity = 1
+	default:
+		return "", false
+	}
+	if len(args) != arity {
+		return "", false
+	}
+	list, elemType, ok := r.listOperand(args[0])
+	if !ok {
+		return "", false
+	}
+	typeName, ok := runtimeTypeName(elemType)
+	if !ok || (arity == 1 && typeName == "str") {
+		return "", false
+	}
+	helper := fmt.Sprintf("__scar_list_%s_%s", strings.TrimSuffix(name, "!"), typeName)
+	if arity == 1 {
+		return fmt.Sprintf("%s(%s, %s_len)", helper, list, list), true
+	}
+	return fmt.Sprintf("%s(%s, %s_len, %s)", helper, list, list, r.renderExpr(args[1])), true
+}
+
+// Returns the type of a list builtin called in an expression.
+func (r *Renderer) listBuiltinType(name string, args []lexer.Expr) (string, bool) {
+	switch name {
+	case "index_of!":
+		return "int", true
+	case "sum!", "min!", "max!":
+		if len(args) == 1 {
+			if _, elemType, ok := r.listOperand(args[0]); ok {
+				return elemType, true
+			}
+		}
+	}
+	return "", false
+}
+
+// Emits the reversal of a list in place by reverse!(list).
+func (r *Renderer) renderReverse(b *strings.Builder, indent string, args []string, line int) {
+	if len(args) != 1 {
+		r.renderErrorf(line, "reverse! takes a list, got %d arguments", len(args))
+		return
+	}
+	name := strings.TrimSpace(args[0])
+	expr, err := lexer.ParseExpr(name)
+	if err != nil {
+		r.renderErrorf(line, "reverse! expects a list, but '%s' is not one", name)
+		return
+	}
+	list, elemType, ok := r.listOperand(expr)
+	if !ok {
+		r.renderErrorf(line, "reverse! expects a list, but '%s' is not one", name)
+		return
+	}
+	if _, nested := nestedListType(elemType); nested {
+		r.renderErrorf(line, "reverse! cannot reverse '%s', a list of lists", name)
+		return
+	}
+	fmt.Fprintf(b, "%s__scar_list_reverse(%s, %s_len);\n", indent, list, list)
+}
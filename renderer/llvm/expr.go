@@ -0,0 +1,622 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains the rendering of expressions and the mapping of scar types to the
+// types of LLVM IR.
+
+package llvm
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"scar/lexer"
+)
+
+// A value computed by an expression, ref being a constant or a temporary.
+type value struct {
+	ref string
+	typ string
+}
+
+// Maps the aliases of scar types to the names used by the backend.
+func normalizeType(typ string) string {
+	switch typ {
+	case "i32":
+		return "int"
+	case "long":
+		return "i64"
+	case "f32":
+		return "float"
+	case "f64":
+		return "double"
+	case "cstring":
+		return "string"
+	}
+	return typ
+}
+
+// Returns the IR type of a scar type, or "" when the backend has none.
+func irType(typ string) string {
+	switch normalizeType(typ) {
+	case "int", "u32":
+		return "i32"
+	case "i64", "u64":
+		return "i64"
+	case "i16", "u16":
+		return "i16"
+	case "i8", "u8", "char":
+		return "i8"
+	case "bool":
+		return "i1"
+	case "float":
+		return "float"
+	case "double":
+		return "double"
+	case "string":
+		return "i8*"
+	}
+	return ""
+}
+
+func returnIRType(typ string) string {
+	if typ == "void" {
+		return "void"
+	}
+	return irType(typ)
+}
+
+func isUnsigned(typ string) bool {
+	switch typ {
+	case "u8", "u16", "u32", "u64":
+		return true
+	}
+	return false
+}
+
+func isFloat(typ string) bool {
+	return typ == "float" || typ == "double"
+}
+
+func isInteger(typ string) bool {
+	switch irType(typ) {
+	case "i8", "i16", "i32", "i64":
+		return true
+	}
+	return false
+}
+
+// Returns the size in bits of an integer type.
+func bits(typ string) int {
+	n, _ := strconv.Atoi(strings.TrimPrefix(irType(typ), "i"))
+	return n
+}
+
+func zeroValue(typ string) string {
+	switch {
+	case typ == "string":
+		return "null"
+	case isFloat(typ):
+		return "0.0"
+	case typ == "bool":
+		return "false"
+	}
+	return "0"
+}
+
+// Returns the printf conversion specifier of a value, as the C backend does.
+func formatVerb(typ string) string {
+	switch typ {
+	case "string":
+		return "%s"
+	case "char":
+		return "%c"
+	case "float", "double":
+		return "%f"
+	case "u8", "u16", "u32":
+		return "%u"
+	case "u64":
+		return "%lu"
+	case "i64":
+		return "%ld"
+	}
+	return "%d"
+}
+
+// Promotes a value passed to a variadic function the way C does, floats
+// becoming doubles and integers narrower than an int becoming ints.
+func (g *generator) vararg(v value) value {
+	switch {
+	case v.typ == "float":
+		return g.convert(v, "double")
+	case v.typ == "bool" || (isInteger(v.typ) && bits(v.typ) < 32):
+		return g.convert(v, "int")
+	}
+	return v
+}
+
+// Encodes a float for IR, which takes the bits of the double it stands for
+// in hex. Floats are rounded to single precision first, as IR requires.
+func floatConstant(f float64, typ string) string {
+	if typ == "float" {
+		f = float64(float32(f))
+	}
+	return fmt.Sprintf("0x%016X", math.Float64bits(f))
+}
+
+// Returns a pointer to the first character of a string constant, emitting
+// the constant the first time it is used.
+func (g *generator) literal(s string) string {
+	name, ok := g.literals[s]
+	if !ok {
+		name = fmt.Sprintf("@.str.%d", len(g.literals))
+		g.literals[s] = name
+		fmt.Fprintf(&g.constants, "%s = private unnamed_addr constant [%d x i8] c\"%s\\00\"\n", name, len(s)+1, encode(s))
+	}
+	return fmt.Sprintf("getelementptr inbounds ([%d x i8], [%d x i8]* %s, i64 0, i64 0)", len(s)+1, len(s)+1, name)
+}
+
+// Encodes bytes for a string constant of IR, escaping all but printable ASCII.
+func encode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < ' ' || c > '~' || c == '"' || c == '\\' {
+			fmt.Fprintf(&b, "\\%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// Decodes the C escape sequences of a string literal.
+func unescape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n':
+			b.WriteByte('\n')
+		case 't':
+			b.WriteByte('\t')
+		case 'r':
+			b.WriteByte('\r')
+		case '0':
+			b.WriteByte(0)
+		case 'a':
+			b.WriteByte('\a')
+		case 'b':
+			b.WriteByte('\b')
+		case 'f':
+			b.WriteByte('\f')
+		case 'v':
+			b.WriteByte('\v')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// Restores the quotes the parser strips from string values.
+func quote(s string) string {
+	return `"` + s + `"`
+}
+
+// Returns the initializer of a global from a literal.
+func (g *generator) constant(typ, source string) (string, bool) {
+	if irType(typ) == "" {
+		return "", false
+	}
+	if source == "" {
+		return zeroValue(typ), true
+	}
+	expr, err := lexer.ParseExpr(source)
+	if err != nil {
+		return "", false
+	}
+	negative := false
+	if unary, ok := expr.(*lexer.UnaryExpr); ok && unary.Op == "-" {
+		negative = true
+		expr = unary.Operand
+	}
+	literal, ok := expr.(*lexer.LiteralExpr)
+	if !ok {
+		return "", false
+	}
+	switch {
+	case literal.Kind == lexer.StringLiteral && typ == "string" && !negative:
+		return g.literal(unescape(literal.Value[1 : len(literal.Value)-1])), true
+	case literal.Kind == lexer.BoolLiteral && typ == "bool" && !negative:
+		return literal.Value, true
+	case literal.Kind == lexer.CharLiteral && isInteger(typ) && !negative:
+		return strconv.Itoa(int(unescape(literal.Value[1 : len(literal.Value)-1])[0])), true
+	case (literal.Kind == lexer.IntLiteral || literal.Kind == lexer.FloatLiteral) && isFloat(typ):
+		f, err := strconv.ParseFloat(literal.Value, 64)
+		if negative {
+			f = -f
+		}
+		return floatConstant(f, typ), err == nil
+	case literal.Kind == lexer.IntLiteral && isInteger(typ):
+		n, err := strconv.ParseInt(literal.Value, 0, 64)
+		if negative {
+			n = -n
+		}
+		return strconv.FormatInt(n, 10), err == nil
+	}
+	return "", false
+}
+
+// Renders an expression given as source.
+func (g *generator) exprSource(source string) (value, bool) {
+	expr, err := lexer.ParseExpr(source)
+	if err != nil {
+		g.unsupported("the expression %s", source)
+		return value{}, false
+	}
+	return g.expr(expr)
+}
+
+// Loads the current value of a variable.
+func (g *generator) load(v *variable) value {
+	t := g.temp()
+	g.emit("%s = load %s, %s* %s", t, irType(v.typ), irType(v.typ), v.ref)
+	return value{ref: t, typ: v.typ}
+}
+
+func (g *generator) expr(expr lexer.Expr) (value, bool) {
+	switch e := expr.(type) {
+	case *lexer.LiteralExpr:
+		return g.literalExpr(e)
+	case *lexer.IdentExpr:
+		v, ok := g.lookup(e.Name)
+		if !ok {
+			g.unsupported("the name '%s'", e.Name)
+			return value{}, false
+		}
+		return g.load(v), true
+	case *lexer.ParenExpr:
+		return g.expr(e.Inner)
+	case *lexer.UnaryExpr:
+		return g.unary(e)
+	case *lexer.BinaryExpr:
+		return g.binary(e)
+	case *lexer.CallExpr:
+		return g.call(e, false)
+	case *lexer.CastExpr:
+		return g.cast(e)
+	}
+	switch expr.(type) {
+	case *lexer.MemberExpr:
+		g.unsupported("fields and methods")
+	case *lexer.IndexExpr, *lexer.SliceExpr, *lexer.ListExpr:
+		g.unsupported("lists and indexing")
+	default:
+		g.unsupported("objects")
+	}
+	return value{}, false
+}
+
+func (g *generator) literalExpr(e *lexer.LiteralExpr) (value, bool) {
+	switch e.Kind {
+	case lexer.IntLiteral:
+		n, err := strconv.ParseInt(e.Value, 0, 64)
+		if err != nil {
+			g.unsupported("the number %s", e.Value)
+			return value{}, false
+		}
+		if n > math.MaxInt32 || n < math.MinInt32 {
+			return value{ref: strconv.FormatInt(n, 10), typ: "i64"}, true
+		}
+		return value{ref: strconv.FormatInt(n, 10), typ: "int"}, true
+	case lexer.FloatLiteral:
+		f, err := strconv.ParseFloat(strings.TrimRight(e.Value, "fF"), 64)
+		if err != nil {
+			g.unsupported("the number %s", e.Value)
+			return value{}, false
+		}
+		return value{ref: floatConstant(f, "double"), typ: "double"}, true
+	case lexer.StringLiteral:
+		return value{ref: g.literal(unescape(e.Value[1 : len(e.Value)-1])), typ: "string"}, true
+	case lexer.CharLiteral:
+		c := unescape(e.Value[1 : len(e.Value)-1])
+		if len(c) != 1 {
+			g.unsupported("the character %s", e.Value)
+			return value{}, false
+		}
+		return value{ref: strconv.Itoa(int(int8(c[0]))), typ: "char"}, true
+	case lexer.BoolLiteral:
+		return value{ref: e.Value, typ: "bool"}, true
+	}
+	g.unsupported("nil")
+	return value{}, false
+}
+
+func (g *generator) unary(e *lexer.UnaryExpr) (value, bool) {
+	operand, ok := g.expr(e.Operand)
+	if !ok {
+		return value{}, false
+	}
+	t := g.temp()
+	switch {
+	case e.Op == "not" || e.Op == "!":
+		operand = g.convert(operand, "bool")
+		g.emit("%s = xor i1 %s, true", t, operand.ref)
+		return value{ref: t, typ: "bool"}, true
+	case e.Op == "-" && isFloat(operand.typ):
+		g.emit("%s = fneg %s %s", t, irType(operand.typ), operand.ref)
+		return value{ref: t, typ: operand.typ}, true
+	case e.Op == "-" && isInteger(operand.typ):
+		g.emit("%s = sub %s 0, %s", t, irType(operand.typ), operand.ref)
+		return value{ref: t, typ: operand.typ}, true
+	case e.Op == "~" && isInteger(operand.typ):
+		g.emit("%s = xor %s %s, -1", t, irType(operand.typ), operand.ref)
+		return value{ref: t, typ: operand.typ}, true
+	}
+	g.unsupported("the operator %s on %s", e.Op, operand.typ)
+	return value{}, false
+}
+
+// Returns the type both operands of an arithmetic operator are converted to,
+// following the usual arithmetic conversions of C.
+func commonType(a, b string) string {
+	switch {
+	case a == "double" || b == "double":
+		return "double"
+	case a == "float" || b == "float":
+		return "float"
+	}
+	size := max(bits(a), bits(b), 32)
+	unsigned := (isUnsigned(a) && bits(a) == size) || (isUnsigned(b) && bits(b) == size)
+	switch {
+	case size == 64 && unsigned:
+		return "u64"
+	case size == 64:
+		return "i64"
+	case unsigned:
+		return "u32"
+	}
+	return "int"
+}
+
+var (
+	integerOps = map[string]string{"+": "add", "-": "sub", "*": "mul", "&": "and", "|": "or", "^": "xor", "<<": "shl"}
+	floatOps   = map[string]string{"+": "fadd", "-": "fsub", "*": "fmul", "/": "fdiv", "%": "frem"}
+	comparison = map[string]string{"==": "eq", "!=": "ne", "<": "lt", "<=": "le", ">": "gt", ">=": "ge"}
+)
+
+// Returns the predicate of icmp for a comparison.
+func predicate(cond string, unsigned bool) string {
+	switch {
+	case cond == "eq" || cond == "ne":
+		return cond
+	case unsigned:
+		return "u" + cond
+	}
+	return "s" + cond
+}
+
+func (g *generator) binary(e *lexer.BinaryExpr) (value, bool) {
+	if e.Op == "and" || e.Op == "&&" || e.Op == "or" || e.Op == "||" {
+		return g.logical(e)
+	}
+	left, ok := g.expr(e.Left)
+	if !ok {
+		return value{}, false
+	}
+	right, ok := g.expr(e.Right)
+	if !ok {
+		return value{}, false
+	}
+	t := g.temp()
+	if left.typ == "string" || right.typ == "string" {
+		cond, isComparison := comparison[e.Op]
+		if left.typ != right.typ || !isComparison {
+			g.unsupported("the operator %s on %s and %s", e.Op, left.typ, right.typ)
+			return value{}, false
+		}
+		g.declared["strcmp"] = "declare i32 @strcmp(i8*, i8*)"
+		g.emit("%s = call i32 @strcmp(i8* %s, i8* %s)", t, left.ref, right.ref)
+		result := g.temp()
+		g.emit("%s = icmp %s i32 %s, 0", result, predicate(cond, false), t)
+		return value{ref: result, typ: "bool"}, true
+	}
+	if left.typ == "bool" && right.typ == "bool" {
+		if cond, ok := comparison[e.Op]; ok && (cond == "eq" || cond == "ne") {
+			g.emit("%s = icmp %s i1 %s, %s", t, cond, left.ref, right.ref)
+			return value{ref: t, typ: "bool"}, true
+		}
+	}
+	typ := commonType(left.typ, right.typ)
+	if !(isFloat(typ) || isInteger(typ)) || left.typ == "bool" || right.typ == "bool" {
+		g.unsupported("the operator %s on %s and %s", e.Op, left.typ, right.typ)
+		return value{}, false
+	}
+	left, right = g.convert(left, typ), g.convert(right, typ)
+	operands := fmt.Sprintf("%s %s, %s", irType(typ), left.ref, right.ref)
+	if cond, ok := comparison[e.Op]; ok {
+		switch {
+		case isFloat(typ):
+			g.emit("%s = fcmp o%s %s", t, cond, operands)
+		default:
+			g.emit("%s = icmp %s %s", t, predicate(cond, isUnsigned(typ)), operands)
+		}
+		return value{ref: t, typ: "bool"}, true
+	}
+	if isFloat(typ) {
+		op, ok := floatOps[e.Op]
+		if !ok {
+			g.unsupported("the operator %s on %s", e.Op, typ)
+			return value{}, false
+		}
+		g.emit("%s = %s %s", t, op, operands)
+		return value{ref: t, typ: typ}, true
+	}
+	op, ok := integerOps[e.Op]
+	switch {
+	case ok:
+	case e.Op == "/" || e.Op == "%":
+		op = map[string]string{"/": "div", "%": "rem"}[e.Op]
+		if isUnsigned(typ) {
+			op = "u" + op
+		} else {
+			op = "s" + op
+		}
+	case e.Op == ">>" && isUnsigned(typ):
+		op = "lshr"
+	case e.Op == ">>":
+		op = "ashr"
+	default:
+		g.unsupported("the operator %s", e.Op)
+		return value{}, false
+	}
+	g.emit("%s = %s %s", t, op, operands)
+	return value{ref: t, typ: typ}, true
+}
+
+// Renders and and or, which evaluate their right operand only when the left
+// one does not decide the result.
+func (g *generator) logical(e *lexer.BinaryExpr) (value, bool) {
+	left, ok := g.expr(e.Left)
+	if !ok {
+		return value{}, false
+	}
+	left = g.convert(left, "bool")
+	var (
+		from  = g.current
+		rhs   = g.label("logic.rhs")
+		end   = g.label("logic.end")
+		and   = e.Op == "and" || e.Op == "&&"
+		short = "true"
+	)
+	if and {
+		short = "false"
+		g.emit("br i1 %s, label %%%s, label %%%s", left.ref, rhs, end)
+	} else {
+		g.emit("br i1 %s, label %%%s, label %%%s", left.ref, end, rhs)
+	}
+	g.start(rhs)
+	right, ok := g.expr(e.Right)
+	if !ok {
+		return value{}, false
+	}
+	right = g.convert(right, "bool")
+	rhsEnd := g.current
+	g.block(end)
+	t := g.temp()
+	g.emit("%s = phi i1 [ %s, %%%s ], [ %s, %%%s ]", t, short, from, right.ref, rhsEnd)
+	return value{ref: t, typ: "bool"}, true
+}
+
+// Converts a value to a type the way an assignment in C does.
+func (g *generator) convert(v value, typ string) value {
+	from, to := irType(v.typ), irType(typ)
+	if from == to {
+		return value{ref: v.ref, typ: typ}
+	}
+	t := g.temp()
+	switch {
+	case typ == "bool" && v.typ == "string":
+		g.emit("%s = icmp ne i8* %s, null", t, v.ref)
+	case typ == "bool" && isFloat(v.typ):
+		g.emit("%s = fcmp une %s %s, 0.0", t, from, v.ref)
+	case typ == "bool" && isInteger(v.typ):
+		g.emit("%s = icmp ne %s %s, 0", t, from, v.ref)
+	case v.typ == "bool" && isInteger(typ):
+		g.emit("%s = zext i1 %s to %s", t, v.ref, to)
+	case v.typ == "bool" && isFloat(typ):
+		g.emit("%s = uitofp i1 %s to %s", t, v.ref, to)
+	case isInteger(v.typ) && isInteger(typ) && bits(v.typ) > bits(typ):
+		g.emit("%s = trunc %s %s to %s", t, from, v.ref, to)
+	case isInteger(v.typ) && isInteger(typ) && isUnsigned(v.typ):
+		g.emit("%s = zext %s %s to %s", t, from, v.ref, to)
+	case isInteger(v.typ) && isInteger(typ):
+		g.emit("%s = sext %s %s to %s", t, from, v.ref, to)
+	case isInteger(v.typ) && isFloat(typ) && isUnsigned(v.typ):
+		g.emit("%s = uitofp %s %s to %s", t, from, v.ref, to)
+	case isInteger(v.typ) && isFloat(typ):
+		g.emit("%s = sitofp %s %s to %s", t, from, v.ref, to)
+	case isFloat(v.typ) && isInteger(typ) && isUnsigned(typ):
+		g.emit("%s = fptoui %s %s to %s", t, from, v.ref, to)
+	case isFloat(v.typ) && isInteger(typ):
+		g.emit("%s = fptosi %s %s to %s", t, from, v.ref, to)
+	case v.typ == "float" && typ == "double":
+		g.emit("%s = fpext float %s to double", t, v.ref)
+	case v.typ == "double" && typ == "float":
+		g.emit("%s = fptrunc double %s to float", t, v.ref)
+	default:
+		g.unsupported("converting %s to %s", v.typ, typ)
+		return value{ref: zeroValue(typ), typ: typ}
+	}
+	return value{ref: t, typ: typ}
+}
+
+// Renders a cast such as x as f64 to a number type.
+func (g *generator) cast(e *lexer.CastExpr) (value, bool) {
+	typ := normalizeType(e.Type)
+	if irType(typ) == "" || typ == "string" {
+		g.unsupported("casting to %s", e.Type)
+		return value{}, false
+	}
+	v, ok := g.expr(e.Value)
+	if !ok {
+		return value{}, false
+	}
+	return g.convert(v, typ), true
+}
+
+// Renders a call to a function of the program, an extern function, or one
+// of the conversions to a number type such as int(x). A call made as a
+// statement may call a function returning nothing.
+func (g *generator) call(e *lexer.CallExpr, statement bool) (value, bool) {
+	ident, ok := e.Callee.(*lexer.IdentExpr)
+	if !ok {
+		g.unsupported("calling methods")
+		return value{}, false
+	}
+	sig, ok := g.functions[ident.Name]
+	if !ok {
+		typ := normalizeType(ident.Name)
+		if irType(typ) == "" || typ == "string" || len(e.Args) != 1 {
+			g.unsupported("the function '%s'", ident.Name)
+			return value{}, false
+		}
+		arg, ok := g.expr(e.Args[0])
+		if !ok {
+			return value{}, false
+		}
+		return g.convert(arg, typ), true
+	}
+	if len(e.Args) != len(sig.params) {
+		g.unsupported("calling '%s' with %d arguments, as it takes %d", ident.Name, len(e.Args), len(sig.params))
+		return value{}, false
+	}
+	args := make([]string, len(e.Args))
+	for i, arg := range e.Args {
+		v, ok := g.expr(arg)
+		if !ok {
+			return value{}, false
+		}
+		v = g.convert(v, sig.params[i])
+		args[i] = irType(v.typ) + " " + v.ref
+	}
+	if sig.returnType == "void" {
+		if !statement {
+			g.unsupported("using the result of '%s', which returns nothing", ident.Name)
+			return value{}, false
+		}
+		g.emit("call void @%s(%s)", ident.Name, strings.Join(args, ", "))
+		return value{}, true
+	}
+	t := g.temp()
+	g.emit("%s = call %s @%s(%s)", t, irType(sig.returnType), ident.Name, strings.Join(args, ", "))
+	return value{ref: t, typ: sig.returnType}, true
+}
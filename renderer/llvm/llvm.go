@@ -0,0 +1,574 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains the experimental LLVM backend, which renders programs as textual
+// LLVM IR rather than C.
+//
+// The backend covers the core of the language: numbers, bools, chars and
+// string literals, variables, functions, extern functions, print, if, while
+// and for. Everything else is reported as unsupported, naming the line it is
+// on. Variables live in stack slots allocated at the entry of their function,
+// which the mem2reg pass of LLVM turns into registers.
+
+package llvm
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"scar/diagnostics"
+	"scar/lexer"
+)
+
+// The signature of a function of the program or an extern function.
+type signature struct {
+	name       string
+	params     []string
+	returnType string
+}
+
+// A variable, held in the stack slot or global named by ref.
+type variable struct {
+	ref string
+	typ string
+}
+
+// The blocks break and continue jump to in a loop.
+type loop struct {
+	label               string
+	breakTo, continueTo string
+}
+
+type generator struct {
+	errs      []error
+	constants strings.Builder
+	literals  map[string]string
+	functions map[string]*signature
+	externs   []*lexer.ExternFuncStmt
+	globals   map[string]*variable
+	declared  map[string]string
+
+	// The state of the function being rendered.
+	allocas    strings.Builder
+	body       strings.Builder
+	temps      int
+	labels     int
+	scopes     []map[string]*variable
+	loops      []loop
+	returnType string
+	current    string
+	terminated bool
+	line       int
+}
+
+// Renders a program as a module of LLVM IR, returning the errors of the
+// constructs the backend does not support.
+func Render(program *lexer.Program) (string, []error) {
+	g := &generator{
+		literals:  make(map[string]string),
+		functions: make(map[string]*signature),
+		globals:   make(map[string]*variable),
+		declared:  map[string]string{"printf": "declare i32 @printf(i8*, ...)"},
+	}
+	var (
+		functions []*lexer.TopLevelFuncDeclStmt
+		lines     []int
+		main      []*lexer.Statement
+		globals   strings.Builder
+	)
+	for _, stmt := range program.Statements {
+		switch {
+		case stmt.TopLevelFuncDecl != nil:
+			functions = append(functions, stmt.TopLevelFuncDecl)
+			lines = append(lines, stmt.Line)
+		case stmt.PubTopLevelFuncDecl != nil:
+			decl := stmt.PubTopLevelFuncDecl
+			functions = append(functions, &lexer.TopLevelFuncDeclStmt{Name: decl.Name, Parameters: decl.Parameters, ReturnType: decl.ReturnType, Body: decl.Body})
+			lines = append(lines, stmt.Line)
+		case stmt.ExternFunc != nil:
+			g.externs = append(g.externs, stmt.ExternFunc)
+			g.functions[stmt.ExternFunc.Name] = g.signature(stmt.ExternFunc.Name, stmt.ExternFunc.Parameters, stmt.ExternFunc.ReturnType, stmt.Line)
+		case stmt.PubVarDecl != nil:
+			g.line = stmt.Line
+			g.global(&globals, stmt.PubVarDecl.Name, stmt.PubVarDecl.Type, stmt.PubVarDecl.Value, false)
+		case stmt.ConstDecl != nil:
+			g.line = stmt.Line
+			g.global(&globals, stmt.ConstDecl.Name, stmt.ConstDecl.Type, stmt.ConstDecl.Value, true)
+		default:
+			main = append(main, stmt)
+		}
+	}
+	for i, fn := range functions {
+		g.functions[fn.Name] = g.signature(fn.Name, fn.Parameters, fn.ReturnType, lines[i])
+	}
+
+	var definitions strings.Builder
+	for _, fn := range functions {
+		g.function(&definitions, fn)
+	}
+	g.mainFunction(&definitions, main)
+
+	var b strings.Builder
+	b.WriteString("; Generated by the experimental LLVM backend of scar.\n\n")
+	b.WriteString(g.constants.String())
+	b.WriteString(globals.String())
+	b.WriteString("\n")
+	b.WriteString(definitions.String())
+	for _, extern := range g.externs {
+		g.declare(extern.Name, g.functions[extern.Name])
+	}
+	for _, name := range slices.Sorted(maps.Keys(g.declared)) {
+		fmt.Fprintf(&b, "%s\n", g.declared[name])
+	}
+	return b.String(), g.errs
+}
+
+// Reports a construct the backend does not support on the current line.
+func (g *generator) unsupported(format string, args ...any) {
+	g.errs = append(g.errs, diagnostics.Errorf(g.line, "the llvm backend does not support %s", fmt.Sprintf(format, args...)))
+}
+
+// Returns the signature of a function, reporting the types of its parameters
+// and result the backend has no IR type for.
+func (g *generator) signature(name string, params []*lexer.MethodParameter, returnType string, line int) *signature {
+	g.line = line
+	sig := &signature{name: name, returnType: normalizeType(returnType)}
+	if sig.returnType == "" {
+		sig.returnType = "void"
+	}
+	if sig.returnType != "void" && irType(sig.returnType) == "" {
+		g.unsupported("functions returning %s", returnType)
+	}
+	for _, param := range params {
+		typ := normalizeType(param.Type)
+		if param.IsList || param.IsRef || irType(typ) == "" {
+			g.unsupported("the parameter '%s' of '%s'", param.Name, name)
+		}
+		sig.params = append(sig.params, typ)
+	}
+	return sig
+}
+
+// Declares an extern function for the module.
+func (g *generator) declare(name string, sig *signature) {
+	params := make([]string, len(sig.params))
+	for i, param := range sig.params {
+		params[i] = irType(param)
+	}
+	g.declared[name] = fmt.Sprintf("declare %s @%s(%s)", returnIRType(sig.returnType), name, strings.Join(params, ", "))
+}
+
+// Emits a global variable or constant, whose value has to be a literal.
+func (g *generator) global(b *strings.Builder, name, typ, value string, constant bool) {
+	typ = normalizeType(typ)
+	initializer, ok := g.constant(typ, value)
+	if !ok {
+		g.unsupported("the global '%s', which is not of a number, bool, char or string literal", name)
+		return
+	}
+	kind := "global"
+	if constant {
+		kind = "constant"
+	}
+	fmt.Fprintf(b, "@%s = internal %s %s %s\n", name, kind, irType(typ), initializer)
+	g.globals[name] = &variable{ref: "@" + name, typ: typ}
+}
+
+// Renders a function of the program.
+func (g *generator) function(b *strings.Builder, fn *lexer.TopLevelFuncDeclStmt) {
+	sig := g.functions[fn.Name]
+	g.begin(sig.returnType)
+	params := make([]string, len(fn.Parameters))
+	for i, param := range fn.Parameters {
+		typ := sig.params[i]
+		params[i] = fmt.Sprintf("%s %%%s.arg", irType(typ), param.Name)
+		slot := g.local(param.Name, typ)
+		g.emit("store %s %%%s.arg, %s* %s", irType(typ), param.Name, irType(typ), slot)
+	}
+	g.statements(fn.Body)
+	if !g.terminated {
+		if sig.returnType == "void" {
+			g.emit("ret void")
+		} else {
+			g.emit("ret %s %s", irType(sig.returnType), zeroValue(sig.returnType))
+		}
+	}
+	fmt.Fprintf(b, "define %s @%s(%s) {\n", returnIRType(sig.returnType), fn.Name, strings.Join(params, ", "))
+	g.end(b)
+}
+
+// Renders the top-level statements of the program as main.
+func (g *generator) mainFunction(b *strings.Builder, statements []*lexer.Statement) {
+	g.begin("int")
+	g.statements(statements)
+	if !g.terminated {
+		g.emit("ret i32 0")
+	}
+	b.WriteString("define i32 @main(i32 %argc, i8** %argv) {\n")
+	g.end(b)
+}
+
+// Starts rendering a function returning returnType.
+func (g *generator) begin(returnType string) {
+	g.allocas.Reset()
+	g.body.Reset()
+	g.temps, g.labels = 0, 0
+	g.scopes = []map[string]*variable{{}}
+	g.loops = nil
+	g.returnType = returnType
+	g.current = "entry"
+	g.terminated = false
+}
+
+// Writes the function being rendered, its stack slots coming first.
+func (g *generator) end(b *strings.Builder) {
+	b.WriteString("entry:\n")
+	b.WriteString(g.allocas.String())
+	b.WriteString(g.body.String())
+	b.WriteString("}\n\n")
+}
+
+// Emits an instruction of the current block. Instructions after the block
+// was terminated are unreachable and left out.
+func (g *generator) emit(format string, args ...any) {
+	if g.terminated {
+		return
+	}
+	fmt.Fprintf(&g.body, "  "+format+"\n", args...)
+	g.terminated = strings.HasPrefix(format, "br ") || strings.HasPrefix(format, "ret ") || format == "unreachable"
+}
+
+// Returns a fresh temporary.
+func (g *generator) temp() string {
+	g.temps++
+	return fmt.Sprintf("%%t%d", g.temps)
+}
+
+// Returns a fresh label starting with prefix.
+func (g *generator) label(prefix string) string {
+	g.labels++
+	return fmt.Sprintf("%s%d", prefix, g.labels)
+}
+
+// Starts a block, branching to it from the current one if that falls through.
+func (g *generator) block(label string) {
+	g.emit("br label %%%s", label)
+	g.start(label)
+}
+
+// Starts a block the current one has already branched to.
+func (g *generator) start(label string) {
+	fmt.Fprintf(&g.body, "%s:\n", label)
+	g.current = label
+	g.terminated = false
+}
+
+// Declares a local variable in the innermost scope, returning its stack slot.
+func (g *generator) local(name, typ string) string {
+	g.temps++
+	slot := fmt.Sprintf("%%%s.%d", name, g.temps)
+	fmt.Fprintf(&g.allocas, "  %s = alloca %s\n", slot, irType(typ))
+	g.scopes[len(g.scopes)-1][name] = &variable{ref: slot, typ: typ}
+	return slot
+}
+
+// Looks a variable up, innermost scope first.
+func (g *generator) lookup(name string) (*variable, bool) {
+	for i := len(g.scopes) - 1; i >= 0; i-- {
+		if v, ok := g.scopes[i][name]; ok {
+			return v, true
+		}
+	}
+	v, ok := g.globals[name]
+	return v, ok
+}
+
+// Renders a block of statements in a scope of its own.
+func (g *generator) statements(statements []*lexer.Statement) {
+	g.scopes = append(g.scopes, map[string]*variable{})
+	defer func() { g.scopes = g.scopes[:len(g.scopes)-1] }()
+	for _, stmt := range statements {
+		if stmt.Line > 0 {
+			g.line = stmt.Line
+		}
+		g.statement(stmt)
+	}
+}
+
+func (g *generator) statement(stmt *lexer.Statement) {
+	switch {
+	case stmt.VarDecl != nil:
+		decl := stmt.VarDecl
+		if decl.IsRef || strings.Contains(decl.Name, ".") {
+			g.unsupported("the declaration of '%s'", decl.Name)
+			return
+		}
+		typ := normalizeType(decl.Type)
+		if irType(typ) == "" {
+			g.unsupported("variables of type %s", decl.Type)
+			return
+		}
+		value := zeroValue(typ)
+		if decl.Value != "" {
+			source := decl.Value
+			if decl.Quoted {
+				source = quote(source)
+			}
+			v, ok := g.exprSource(source)
+			if !ok {
+				return
+			}
+			value = g.convert(v, typ).ref
+		}
+		slot := g.local(decl.Name, typ)
+		g.emit("store %s %s, %s* %s", irType(typ), value, irType(typ), slot)
+	case stmt.VarDeclInferred != nil:
+		v, ok := g.exprSource(stmt.VarDeclInferred.Value)
+		if !ok {
+			return
+		}
+		slot := g.local(stmt.VarDeclInferred.Name, v.typ)
+		g.emit("store %s %s, %s* %s", irType(v.typ), v.ref, irType(v.typ), slot)
+	case stmt.VarAssign != nil:
+		target, ok := g.lookup(stmt.VarAssign.Name)
+		if !ok {
+			g.unsupported("assigning to '%s'", stmt.VarAssign.Name)
+			return
+		}
+		source := stmt.VarAssign.Value
+		if stmt.VarAssign.Quoted {
+			source = quote(source)
+		}
+		v, ok := g.exprSource(source)
+		if !ok {
+			return
+		}
+		v = g.convert(v, target.typ)
+		g.emit("store %s %s, %s* %s", irType(target.typ), v.ref, irType(target.typ), target.ref)
+	case stmt.Print != nil:
+		g.print(stmt.Print)
+	case stmt.If != nil:
+		g.ifStatement(stmt.If)
+	case stmt.While != nil:
+		g.whileStatement(stmt.While)
+	case stmt.For != nil:
+		g.forStatement(stmt.For)
+	case stmt.Break != nil:
+		if l, ok := g.loopTarget(stmt.Break.Target, "break"); ok {
+			g.emit("br label %%%s", l.breakTo)
+		}
+	case stmt.Continue != nil:
+		if l, ok := g.loopTarget(stmt.Continue.Target, "continue"); ok {
+			g.emit("br label %%%s", l.continueTo)
+		}
+	case stmt.Return != nil:
+		g.returnStatement(stmt.Return.Value)
+	case stmt.FunctionCall != nil:
+		call := &lexer.CallExpr{Callee: &lexer.IdentExpr{Name: stmt.FunctionCall.Name}}
+		for _, arg := range stmt.FunctionCall.Args {
+			expr, err := lexer.ParseExpr(arg)
+			if err != nil {
+				g.unsupported("the argument %s", arg)
+				return
+			}
+			call.Args = append(call.Args, expr)
+		}
+		g.call(call, true)
+	case stmt.Run != nil:
+		expr, err := lexer.ParseExpr(stmt.Run.FunctionCall)
+		call, isCall := expr.(*lexer.CallExpr)
+		if err != nil || !isCall {
+			g.unsupported("the statement %s", stmt.Run.FunctionCall)
+			return
+		}
+		g.call(call, true)
+	case stmt.ExternFunc != nil:
+	case stmt.Import != nil:
+		g.unsupported("imports")
+	case stmt.ClassDecl != nil, stmt.PubClassDecl != nil, stmt.ObjectDecl != nil, stmt.MethodCall != nil:
+		g.unsupported("classes and objects")
+	case stmt.ListDecl != nil, stmt.ArrayDecl != nil, stmt.IndexAssign != nil, stmt.Foreach != nil, stmt.ListOfDecl != nil:
+		g.unsupported("lists")
+	case stmt.MapDecl != nil, stmt.SetDecl != nil:
+		g.unsupported("maps and sets")
+	default:
+		g.unsupported("this statement")
+	}
+}
+
+// Returns the loop a break or continue applies to.
+func (g *generator) loopTarget(target lexer.LoopTarget, keyword string) (loop, bool) {
+	if target.Label != "" {
+		for i := len(g.loops) - 1; i >= 0; i-- {
+			if g.loops[i].label == target.Label {
+				return g.loops[i], true
+			}
+		}
+		g.unsupported("%s to the unknown loop '%s'", keyword, target.Label)
+		return loop{}, false
+	}
+	index := len(g.loops) - 1 - target.Levels
+	if index < 0 || index >= len(g.loops) {
+		g.unsupported("%s outside of a loop", keyword)
+		return loop{}, false
+	}
+	return g.loops[index], true
+}
+
+func (g *generator) ifStatement(stmt *lexer.IfStmt) {
+	end := g.label("if.end")
+	conditions := []string{stmt.Condition}
+	bodies := [][]*lexer.Statement{stmt.Body}
+	for _, elif := range stmt.ElseIfs {
+		conditions = append(conditions, elif.Condition)
+		bodies = append(bodies, elif.Body)
+	}
+	for i, condition := range conditions {
+		v, ok := g.exprSource(condition)
+		if !ok {
+			return
+		}
+		then, next := g.label("if.then"), g.label("if.else")
+		g.emit("br i1 %s, label %%%s, label %%%s", g.convert(v, "bool").ref, then, next)
+		g.block(then)
+		g.statements(bodies[i])
+		g.emit("br label %%%s", end)
+		g.block(next)
+	}
+	if stmt.Else != nil {
+		g.statements(stmt.Else.Body)
+	}
+	g.block(end)
+}
+
+func (g *generator) whileStatement(stmt *lexer.WhileStmt) {
+	var (
+		cond = g.label("while.cond")
+		body = g.label("while.body")
+		end  = g.label("while.end")
+	)
+	g.block(cond)
+	v, ok := g.exprSource(stmt.Condition)
+	if !ok {
+		return
+	}
+	g.emit("br i1 %s, label %%%s, label %%%s", g.convert(v, "bool").ref, body, end)
+	g.block(body)
+	g.loops = append(g.loops, loop{label: stmt.Label, breakTo: end, continueTo: cond})
+	g.statements(stmt.Body)
+	g.loops = g.loops[:len(g.loops)-1]
+	g.emit("br label %%%s", cond)
+	g.block(end)
+}
+
+// Renders for i = start to end, which runs up to and including end.
+func (g *generator) forStatement(stmt *lexer.ForStmt) {
+	start, ok := g.exprSource(stmt.Start)
+	if !ok {
+		return
+	}
+	g.scopes = append(g.scopes, map[string]*variable{})
+	defer func() { g.scopes = g.scopes[:len(g.scopes)-1] }()
+	typ := "int"
+	if start.typ == "i64" {
+		typ = "i64"
+	}
+	slot := g.local(stmt.Var, typ)
+	g.emit("store %s %s, %s* %s", irType(typ), g.convert(start, typ).ref, irType(typ), slot)
+
+	var (
+		cond = g.label("for.cond")
+		body = g.label("for.body")
+		step = g.label("for.step")
+		end  = g.label("for.end")
+	)
+	g.block(cond)
+	limit, ok := g.exprSource(stmt.End)
+	if !ok {
+		return
+	}
+	current := g.load(&variable{ref: slot, typ: typ})
+	test := g.temp()
+	g.emit("%s = icmp sle %s %s, %s", test, irType(typ), current.ref, g.convert(limit, typ).ref)
+	g.emit("br i1 %s, label %%%s, label %%%s", test, body, end)
+	g.block(body)
+	g.loops = append(g.loops, loop{label: stmt.Label, breakTo: end, continueTo: step})
+	g.statements(stmt.Body)
+	g.loops = g.loops[:len(g.loops)-1]
+	g.block(step)
+	current = g.load(&variable{ref: slot, typ: typ})
+	next := g.temp()
+	g.emit("%s = add %s %s, 1", next, irType(typ), current.ref)
+	g.emit("store %s %s, %s* %s", irType(typ), next, irType(typ), slot)
+	g.emit("br label %%%s", cond)
+	g.block(end)
+}
+
+func (g *generator) returnStatement(value string) {
+	if value == "" {
+		if g.returnType == "void" {
+			g.emit("ret void")
+		} else {
+			g.emit("ret %s %s", irType(g.returnType), zeroValue(g.returnType))
+		}
+		return
+	}
+	v, ok := g.exprSource(value)
+	if !ok {
+		return
+	}
+	if g.returnType == "void" {
+		g.unsupported("returning a value from a function without a return type")
+		return
+	}
+	g.emit("ret %s %s", irType(g.returnType), g.convert(v, g.returnType).ref)
+}
+
+// Renders print, as a call to printf with the format followed by a newline.
+func (g *generator) print(stmt *lexer.PrintStmt) {
+	if stmt.Stderr {
+		g.unsupported("eprint")
+		return
+	}
+	var (
+		format string
+		args   []value
+	)
+	switch {
+	case len(stmt.Segments) > 0:
+		var b strings.Builder
+		for i, segment := range stmt.Segments {
+			b.WriteString(strings.ReplaceAll(segment, "%", "%%"))
+			if i >= len(stmt.Variables) {
+				continue
+			}
+			v, ok := g.exprSource(stmt.Variables[i])
+			if !ok {
+				return
+			}
+			b.WriteString(formatVerb(v.typ))
+			args = append(args, v)
+		}
+		format = b.String()
+	case stmt.Format != "" && len(stmt.Variables) > 0:
+		format = stmt.Format
+		for _, variable := range stmt.Variables {
+			v, ok := g.exprSource(variable)
+			if !ok {
+				return
+			}
+			args = append(args, v)
+		}
+	default:
+		format = strings.ReplaceAll(stmt.Print, "%", "%%")
+	}
+	operands := []string{"i8* " + g.literal(unescape(format)+"\n")}
+	for _, arg := range args {
+		arg = g.vararg(arg)
+		operands = append(operands, irType(arg.typ)+" "+arg.ref)
+	}
+	g.emit("%s = call i32 (i8*, ...) @printf(%s)", g.temp(), strings.Join(operands, ", "))
+}
@@ -0,0 +1,132 @@
+package llvm
+
+import (
+	"strings"
+	"testing"
+
+	"scar/lexer"
+)
+
+func render(t *testing.T, source string) (string, []error) {
+	t.Helper()
+	program, err := lexer.ParseWithIndentation(source)
+	if err != nil {
+		t.Fatalf("Failed to parse program: %v", err)
+	}
+	return Render(program)
+}
+
+func TestRenderFunctionsAndLoops(t *testing.T) {
+	input := `fn square(int n) -> int:
+    return n * n
+
+int total = 0
+for i = 1 to 3:
+    total = total + square(i)
+print "total {total}"`
+
+	ir, errs := render(t, input)
+	if len(errs) > 0 {
+		t.Fatalf("Unexpected errors: %v", errs)
+	}
+	for _, expected := range []string{
+		"define i32 @square(i32 %n.arg) {",
+		"mul i32",
+		"define i32 @main(i32 %argc, i8** %argv) {",
+		"icmp sle i32",
+		"call i32 @square(i32",
+		`c"total %d\0A\00"`,
+		"call i32 (i8*, ...) @printf(",
+		"declare i32 @printf(i8*, ...)",
+		"ret i32 0",
+	} {
+		if !strings.Contains(ir, expected) {
+			t.Errorf("Expected IR to contain '%s', but it didn't:\n%s", expected, ir)
+		}
+	}
+}
+
+func TestRenderConversions(t *testing.T) {
+	input := `u8 small = 200
+float f = 1.5
+double d = f + small
+bool done = d > 10.0 and not false
+print "{f} {done}"
+string s = "a"
+if s == "a":
+    print "same"`
+
+	ir, errs := render(t, input)
+	if len(errs) > 0 {
+		t.Fatalf("Unexpected errors: %v", errs)
+	}
+	for _, expected := range []string{
+		"uitofp i8",
+		"fpext float",
+		"fcmp ogt double",
+		"phi i1 [ false, %",
+		"call i32 @strcmp(i8*",
+		"declare i32 @strcmp(i8*, i8*)",
+	} {
+		if !strings.Contains(ir, expected) {
+			t.Errorf("Expected IR to contain '%s', but it didn't:\n%s", expected, ir)
+		}
+	}
+}
+
+func TestRenderExternFunction(t *testing.T) {
+	input := `extern fn labs(i64 n) -> i64 from "stdlib.h"
+i64 x = labs(-3)`
+
+	ir, errs := render(t, input)
+	if len(errs) > 0 {
+		t.Fatalf("Unexpected errors: %v", errs)
+	}
+	for _, expected := range []string{"declare i64 @labs(i64)", "call i64 @labs(i64"} {
+		if !strings.Contains(ir, expected) {
+			t.Errorf("Expected IR to contain '%s', but it didn't:\n%s", expected, ir)
+		}
+	}
+}
+
+func TestRenderCasts(t *testing.T) {
+	input := `int n = 7
+f64 f = n as f64 / 2.0
+i32 i = f as i32`
+
+	ir, errs := render(t, input)
+	if len(errs) > 0 {
+		t.Fatalf("Unexpected errors: %v", errs)
+	}
+	for _, expected := range []string{"sitofp i32", "fptosi double"} {
+		if !strings.Contains(ir, expected) {
+			t.Errorf("Expected IR to contain '%s', but it didn't:\n%s", expected, ir)
+		}
+	}
+}
+
+func TestRenderPlainPrintPercent(t *testing.T) {
+	ir, errs := render(t, `print "100% done"`)
+	if len(errs) > 0 {
+		t.Fatalf("Unexpected errors: %v", errs)
+	}
+	if expected := `c"100%% done\0A\00"`; !strings.Contains(ir, expected) {
+		t.Errorf("Expected IR to contain '%s', but it didn't:\n%s", expected, ir)
+	}
+}
+
+func TestRenderUnsupported(t *testing.T) {
+	input := `print "start"
+list[int] xs = [1, 2]
+int n = xs.length`
+
+	_, errs := render(t, input)
+	if len(errs) != 2 {
+		t.Fatalf("Expected 2 errors, got %d: %v", len(errs), errs)
+	}
+	for i, expected := range []string{"lists", "fields and methods"} {
+		if !strings.Contains(errs[i].Error(), "the llvm backend does not support "+expected) {
+			t.Errorf("Expected error %d to be about %s, got: %v", i, expected, errs[i])
+		}
+	}
+}
@@ -0,0 +1,79 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains code generation for loop bodies and the break and continue
+// statements that leave them.
+//
+// A break or continue naming an outer loop, by label or by count, is lowered
+// to a goto to a C label emitted after that loop or at the end of its body.
+
+package renderer
+
+import (
+	"fmt"
+	"strings"
+
+	"scar/lexer"
+)
+
+type loopFrame struct {
+	label        string
+	name         string
+	tries        int
+	locals       int
+	breakUsed    bool
+	continueUsed bool
+}
+
+// Renders the body of a loop and its closing brace. Break and continue
+// statements in the body leave only the try blocks entered inside the loop.
+func (r *Renderer) renderLoopBody(b *strings.Builder, label string, body []*lexer.Statement, indent, className string, program *lexer.Program, currentFunctionReturnType string) {
+	loop := &loopFrame{label: label, name: fmt.Sprintf("__loop_%d", r.loopCount), tries: len(r.tryFrames), locals: len(r.rcLocals)}
+	r.loopCount++
+
+	r.loopFrames = append(r.loopFrames, loop)
+	r.renderStatements(b, body, indent+"    ", className, program, currentFunctionReturnType)
+	r.loopFrames = r.loopFrames[:len(r.loopFrames)-1]
+
+	if loop.continueUsed {
+		fmt.Fprintf(b, "%s    %s_continue: ;\n", indent, loop.name)
+	}
+	fmt.Fprintf(b, "%s}\n", indent)
+	if loop.breakUsed {
+		fmt.Fprintf(b, "%s%s_break: ;\n", indent, loop.name)
+	}
+}
+
+// Emits a break or continue leaving the loop named by target.
+func (r *Renderer) renderLoopExit(b *strings.Builder, keyword string, target lexer.LoopTarget, indent, className string, program *lexer.Program, currentFunctionReturnType string) {
+	depth := len(r.loopFrames) - 1
+	switch {
+	case target.Label != "":
+		for depth >= 0 && r.loopFrames[depth].label != target.Label {
+			depth--
+		}
+	case target.Levels > 0:
+		depth = len(r.loopFrames) - target.Levels
+	}
+	if depth < 0 {
+		fmt.Fprintf(b, "%s%s;\n", indent, keyword)
+		return
+	}
+
+	loop := r.loopFrames[depth]
+	r.leaveTryFrames(b, len(r.tryFrames)-loop.tries, indent, className, program, currentFunctionReturnType)
+	if r.opts.Memory == MemRC {
+		r.releaseLocals(b, indent, loop.locals, "")
+	}
+	if depth == len(r.loopFrames)-1 {
+		fmt.Fprintf(b, "%s%s;\n", indent, keyword)
+		return
+	}
+	if keyword == "break" {
+		loop.breakUsed = true
+	} else {
+		loop.continueUsed = true
+	}
+	fmt.Fprintf(b, "%sgoto %s_%s;\n", indent, loop.name, keyword)
+}
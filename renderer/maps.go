@@ -0,0 +1,261 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains code generation for maps.
+//
+// A map is lowered to a __scar_map hash table from the map runtime the
+// preprocessor inserts. The runtime stores keys and values as raw bytes, so
+// keys and values are passed by address as compound literals of their C type
+// and results are read back through a pointer cast.
+
+package renderer
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"scar/lexer"
+)
+
+type mapInfo struct {
+	keyType   string
+	valueType string
+}
+
+// Returns the scar type of a map, as stored on map fields of classes.
+func mapTypeName(keyType, valueType string) string {
+	return fmt.Sprintf("map[%s:%s]", keyType, valueType)
+}
+
+// Splits a map type such as map[string:int] into its key and value types.
+func parseMapType(typ string) (mapInfo, bool) {
+	if !strings.HasPrefix(typ, "map[") || !strings.HasSuffix(typ, "]") {
+		return mapInfo{}, false
+	}
+	keyType, valueType, ok := strings.Cut(typ[4:len(typ)-1], ":")
+	if !ok {
+		return mapInfo{}, false
+	}
+	return mapInfo{strings.TrimSpace(keyType), strings.TrimSpace(valueType)}, true
+}
+
+// Returns the key and value types of a map visible in the current scope,
+// which is either a variable or a field of this.
+func (r *Renderer) lookupMap(name string) (mapInfo, bool) {
+	if fieldName, ok := strings.CutPrefix(name, "this."); ok {
+		if field, exists := r.findField(r.currentClassName, fieldName); exists {
+			return parseMapType(field.Type)
+		}
+		return mapInfo{}, false
+	}
+	info, exists := r.globalMaps[name]
+	return info, exists
+}
+
+// Returns the C type map keys or values of a scar type are stored as.
+func (r *Renderer) mapElemCType(typ string) string {
+	if typ == "string" {
+		return "char*"
+	}
+	return r.mapTypeToCType(typ)
+}
+
+// Returns a C expression creating an empty map.
+func (r *Renderer) newMap(info mapInfo) string {
+	return fmt.Sprintf("__scar_map_new(sizeof(%s), sizeof(%s), %d, %d)",
+		r.mapElemCType(info.keyType), r.mapElemCType(info.valueType), boolToInt(info.keyType == "string"), boolToInt(info.valueType == "string"))
+}
+
+func boolToInt(value bool) int {
+	if value {
+		return 1
+	}
+	return 0
+}
+
+// Returns a C pointer to a map variable or field.
+func (r *Renderer) mapRef(name string) string {
+	if fieldName, ok := strings.CutPrefix(name, "this."); ok {
+		return "&this->" + fieldName
+	}
+	return "&" + lexer.ResolveSymbol(name, r.currentModule)
+}
+
+// Renders a scar key or value as a C expression of the given scar type.
+func (r *Renderer) mapOperand(typ, value string) string {
+	switch {
+	case strings.HasPrefix(value, "\"") && strings.HasSuffix(value, "\""):
+		return value
+	case lexer.IsCharLiteral(value):
+		return value
+	case value != "" && (unicode.IsDigit(rune(value[0])) || (value[0] == '-' && len(value) > 1 && unicode.IsDigit(rune(value[1])))):
+		return value
+	}
+	return r.convertThisReferencesGranular(lexer.ResolveSymbol(value, r.currentModule))
+}
+
+// Returns a C pointer to a temporary holding a key or value of a map.
+func (r *Renderer) mapArg(typ, value string) string {
+	return r.mapArgC(typ, r.mapOperand(typ, value))
+}
+
+// Returns a C pointer to a temporary holding an already rendered key or value.
+func (r *Renderer) mapArgC(typ, value string) string {
+	return fmt.Sprintf("&(%s){%s}", r.mapElemCType(typ), value)
+}
+
+// Returns the key and value types of a map, guessing them from a key and
+// value when the map is unknown.
+func (r *Renderer) mapTypesOf(name, key, value string) mapInfo {
+	if info, ok := r.lookupMap(name); ok {
+		return info
+	}
+	info := mapInfo{keyType: "int", valueType: "int"}
+	switch {
+	case strings.HasPrefix(key, "\""):
+		info.keyType = "string"
+	case lexer.IsCharLiteral(key):
+		info.keyType = "char"
+	}
+	switch {
+	case value == "true" || value == "false":
+		info.valueType = "bool"
+	case strings.HasPrefix(value, "\""):
+		info.valueType = "string"
+	}
+	return info
+}
+
+// Emits the declaration of a map variable and its initial entries.
+func (r *Renderer) declareMap(b *strings.Builder, indent string, decl *lexer.MapDeclStmt) {
+	info := mapInfo{decl.KeyType, decl.ValueType}
+	r.globalMaps[decl.Name] = info
+	name := lexer.ResolveSymbol(decl.Name, r.currentModule)
+	fmt.Fprintf(b, "%s__scar_map %s = %s;\n", indent, name, r.newMap(info))
+	r.putMapPairs(b, indent, "&"+name, info, decl.Pairs)
+}
+
+// Emits the initialisation of a map field of this in a constructor.
+func (r *Renderer) initMapField(b *strings.Builder, indent string, decl *lexer.MapDeclStmt) {
+	info := mapInfo{decl.KeyType, decl.ValueType}
+	fieldName := strings.TrimPrefix(decl.Name, "this.")
+	fmt.Fprintf(b, "%sthis->%s = %s;\n", indent, fieldName, r.newMap(info))
+	r.putMapPairs(b, indent, "&this->"+fieldName, info, decl.Pairs)
+}
+
+func (r *Renderer) putMapPairs(b *strings.Builder, indent, ref string, info mapInfo, pairs []lexer.MapPair) {
+	for _, pair := range pairs {
+		key, value := pair.Key, pair.Value
+		if info.keyType == "string" && !strings.HasPrefix(key, "\"") {
+			key = fmt.Sprintf("\"%s\"", key)
+		}
+		if info.valueType == "string" && !strings.HasPrefix(value, "\"") {
+			value = fmt.Sprintf("\"%s\"", value)
+		}
+		fmt.Fprintf(b, "%s__scar_map_put(%s, %s, %s);\n", indent, ref, r.mapArg(info.keyType, key), r.mapArg(info.valueType, value))
+	}
+}
+
+// Emits the put!(map, key, value) builtin.
+func (r *Renderer) renderMapPut(b *strings.Builder, indent string, put *lexer.PutMapStmt) {
+	info := r.mapTypesOf(put.MapName, put.Key, put.Value)
+	fmt.Fprintf(b, "%s__scar_map_put(%s, %s, %s);\n", indent, r.mapRef(put.MapName), r.mapArg(info.keyType, put.Key), r.mapArg(info.valueType, put.Value))
+}
+
+// Emits the del!(map, key) builtin.
+func (r *Renderer) renderMapDel(b *strings.Builder, indent string, del *lexer.DelMapStmt) {
+	info := r.mapTypesOf(del.MapName, del.Key, "")
+	fmt.Fprintf(b, "%s%s;\n", indent, r.mapDel(del.MapName, r.mapArg(info.keyType, del.Key)))
+}
+
+// Generates a C expression for accessing a map value by key
+func (r *Renderer) renderMapAccess(mapName, key string) string {
+	info := r.mapTypesOf(mapName, key, "")
+	return r.mapGet(mapName, info, r.mapArg(info.keyType, key))
+}
+
+// Generates a C expression testing whether a map has a key
+func (r *Renderer) renderMapHas(mapName, key string) string {
+	info := r.mapTypesOf(mapName, key, "")
+	return r.mapHas(mapName, r.mapArg(info.keyType, key))
+}
+
+func (r *Renderer) mapGet(mapName string, info mapInfo, key string) string {
+	return fmt.Sprintf("(*(%s*)__scar_map_get(%s, %s))", r.mapElemCType(info.valueType), r.mapRef(mapName), key)
+}
+
+func (r *Renderer) mapHas(mapName, key string) string {
+	return fmt.Sprintf("__scar_map_has(%s, %s)", r.mapRef(mapName), key)
+}
+
+func (r *Renderer) mapDel(mapName, key string) string {
+	return fmt.Sprintf("__scar_map_del(%s, %s)", r.mapRef(mapName), key)
+}
+
+// Returns the name of the variable or field of this an expression refers to.
+func exprVarName(expr lexer.Expr) (string, bool) {
+	switch e := expr.(type) {
+	case *lexer.IdentExpr:
+		return e.Name, true
+	case *lexer.MemberExpr:
+		if ident, ok := e.Object.(*lexer.IdentExpr); ok && ident.Name == "this" {
+			return "this." + e.Member, true
+		}
+	}
+	return "", false
+}
+
+// Renders the map builtins get!(map, key), has!(map, key), del!(map, key)
+// and maplen!(map) inside expressions.
+func (r *Renderer) renderMapBuiltin(name string, args []lexer.Expr) (string, bool) {
+	if len(args) == 0 {
+		return "", false
+	}
+	mapName, ok := exprVarName(args[0])
+	if !ok {
+		return "", false
+	}
+	if name == "maplen!" && len(args) == 1 {
+		return fmt.Sprintf("(%s)->len", r.mapRef(mapName)), true
+	}
+	if len(args) != 2 {
+		return "", false
+	}
+	key := r.renderExpr(args[1])
+	info := r.mapTypesOf(mapName, key, "")
+	switch name {
+	case "get!":
+		return r.mapGet(mapName, info, r.mapArgC(info.keyType, key)), true
+	case "has!":
+		return r.mapHas(mapName, r.mapArgC(info.keyType, key)), true
+	case "del!":
+		return r.mapDel(mapName, r.mapArgC(info.keyType, key)), true
+	}
+	return "", false
+}
+
+// Emits an assignment of one map to another, which copies its entries.
+func (r *Renderer) assignMap(b *strings.Builder, indent, target, source string) {
+	fmt.Fprintf(b, "%s__scar_map_copy(%s, %s);\n", indent, r.mapRef(target), r.mapRef(source))
+}
+
+// Emits the head of a foreach loop over the keys or values of a map, up to
+// and including the declaration of the loop variable.
+func (r *Renderer) renderMapForeach(b *strings.Builder, indent, mapName, accessType, varType, varName string) {
+	ref := r.mapRef(mapName)
+	info, _ := r.lookupMap(mapName)
+	elemType := info.valueType
+	accessor := "__scar_map_value"
+	if accessType == "keys" {
+		elemType = info.keyType
+		accessor = "__scar_map_key"
+	}
+	if elemType == "" {
+		elemType = varType
+	}
+	fmt.Fprintf(b, "%sfor (int __i = 0; __i < (%s)->count; __i++) {\n", indent, ref)
+	fmt.Fprintf(b, "%s    if (!(%s)->live[__i]) continue;\n", indent, ref)
+	fmt.Fprintf(b, "%s    %s %s = *(%s*)%s(%s, __i);\n", indent, r.mapElemCType(varType), varName, r.mapElemCType(elemType), accessor, ref)
+}
@@ -0,0 +1,171 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains code generation for match statements.
+//
+// A match whose case values are all integer, character or enum constants is
+// lowered to a C switch. Matches on strings or ranges, and matches whose arms
+// break out of an enclosing loop, are lowered to an if-chain instead.
+
+package renderer
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"scar/lexer"
+)
+
+var (
+	reCaseConstant = regexp.MustCompile(`^(-?[0-9]+|0[xX][0-9a-fA-F]+|'(\\.|[^'\\])')$`)
+	reMatchSubject = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*(->[a-zA-Z_][a-zA-Z0-9_]*)*$`)
+)
+
+func (r *Renderer) renderMatch(b *strings.Builder, match *lexer.MatchStmt, indent, className string, program *lexer.Program, currentFunctionReturnType string) {
+	value := r.renderCondition(match.Value, program)
+	cases := make([][]string, len(match.Cases))
+	for i, arm := range match.Cases {
+		for _, caseValue := range arm.Values {
+			if low, high, ok := lexer.CaseRange(caseValue); ok {
+				caseValue = r.renderCondition(low, program) + ".." + r.renderCondition(high, program)
+			} else {
+				caseValue = r.renderCondition(caseValue, program)
+			}
+			cases[i] = append(cases[i], caseValue)
+		}
+	}
+
+	if r.canRenderSwitch(match, cases) {
+		fmt.Fprintf(b, "%sswitch (%s) {\n", indent, value)
+		for i, arm := range match.Cases {
+			for j, caseValue := range cases[i] {
+				if j == len(cases[i])-1 {
+					fmt.Fprintf(b, "%s    case %s: {\n", indent, caseValue)
+				} else {
+					fmt.Fprintf(b, "%s    case %s:\n", indent, caseValue)
+				}
+			}
+			r.renderStatements(b, arm.Body, indent+"        ", className, program, currentFunctionReturnType)
+			fmt.Fprintf(b, "%s        break;\n", indent)
+			fmt.Fprintf(b, "%s    }\n", indent)
+		}
+		if match.Else != nil {
+			fmt.Fprintf(b, "%s    default: {\n", indent)
+			r.renderStatements(b, match.Else.Body, indent+"        ", className, program, currentFunctionReturnType)
+			fmt.Fprintf(b, "%s        break;\n", indent)
+			fmt.Fprintf(b, "%s    }\n", indent)
+		}
+		fmt.Fprintf(b, "%s}\n", indent)
+		return
+	}
+
+	// The subject is evaluated once unless it is a plain variable or field.
+	bodyIndent := indent
+	if !reMatchSubject.MatchString(value) {
+		fmt.Fprintf(b, "%s{\n", indent)
+		bodyIndent = indent + "    "
+		fmt.Fprintf(b, "%s__auto_type __match = %s;\n", bodyIndent, value)
+		value = "__match"
+	}
+	for i, arm := range match.Cases {
+		conditions := make([]string, len(cases[i]))
+		for j, caseValue := range cases[i] {
+			conditions[j] = caseCondition(value, caseValue)
+		}
+		keyword := "if"
+		if i > 0 {
+			keyword = "else if"
+		}
+		fmt.Fprintf(b, "%s%s (%s) {\n", bodyIndent, keyword, strings.Join(conditions, " || "))
+		r.renderStatements(b, arm.Body, bodyIndent+"    ", className, program, currentFunctionReturnType)
+		fmt.Fprintf(b, "%s}\n", bodyIndent)
+	}
+	if match.Else != nil {
+		if len(match.Cases) == 0 {
+			fmt.Fprintf(b, "%s{\n", bodyIndent)
+		} else {
+			fmt.Fprintf(b, "%selse {\n", bodyIndent)
+		}
+		r.renderStatements(b, match.Else.Body, bodyIndent+"    ", className, program, currentFunctionReturnType)
+		fmt.Fprintf(b, "%s}\n", bodyIndent)
+	}
+	if bodyIndent != indent {
+		fmt.Fprintf(b, "%s}\n", indent)
+	}
+}
+
+// Renders the test of a single case value against the match subject.
+func caseCondition(value, caseValue string) string {
+	if low, high, ok := lexer.CaseRange(caseValue); ok {
+		return fmt.Sprintf("(%s >= %s && %s <= %s)", value, low, value, high)
+	}
+	if strings.HasPrefix(caseValue, "\"") {
+		return fmt.Sprintf("strcmp(%s, %s) == 0", value, caseValue)
+	}
+	return fmt.Sprintf("%s == %s", value, caseValue)
+}
+
+// Reports whether a match can be lowered to a C switch.
+func (r *Renderer) canRenderSwitch(match *lexer.MatchStmt, cases [][]string) bool {
+	if len(match.Cases) == 0 {
+		return false
+	}
+	for _, values := range cases {
+		for _, value := range values {
+			if !reCaseConstant.MatchString(value) && !r.isEnumMember(value) {
+				return false
+			}
+		}
+	}
+	for _, arm := range match.Cases {
+		if breaksLoop(arm.Body) {
+			return false
+		}
+	}
+	return match.Else == nil || !breaksLoop(match.Else.Body)
+}
+
+// Reports whether a name is the C name of an enum member.
+func (r *Renderer) isEnumMember(name string) bool {
+	_, ok := r.enumOfMember(name)
+	return ok
+}
+
+// Reports whether statements contain a break that leaves the enclosing loop,
+// which a C switch would capture instead.
+func breaksLoop(stmts []*lexer.Statement) bool {
+	for _, stmt := range stmts {
+		switch {
+		case stmt.Break != nil:
+			return true
+		case stmt.If != nil:
+			if breaksLoop(stmt.If.Body) {
+				return true
+			}
+			for _, elif := range stmt.If.ElseIfs {
+				if breaksLoop(elif.Body) {
+					return true
+				}
+			}
+			if stmt.If.Else != nil && breaksLoop(stmt.If.Else.Body) {
+				return true
+			}
+		case stmt.Match != nil:
+			for _, arm := range stmt.Match.Cases {
+				if breaksLoop(arm.Body) {
+					return true
+				}
+			}
+			if stmt.Match.Else != nil && breaksLoop(stmt.Match.Else.Body) {
+				return true
+			}
+		case stmt.TryCatch != nil:
+			if breaksLoop(stmt.TryCatch.TryBody) || breaksLoop(stmt.TryCatch.CatchBody) || breaksLoop(stmt.TryCatch.FinallyBody) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,278 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains code generation for the memory management modes chosen with --mem.
+//
+// In the default manual mode objects live until they are deleted. In rc mode
+// every object carries a reference count: storing an object into a variable or
+// field retains it, overwriting or leaving the variable releases it, and an
+// object whose count drops to zero is deinitialised and freed. New objects and
+// objects returned from calls start owned by the reference they are stored in,
+// while objects read from other variables and fields are retained. Cycles are
+// not collected. In arena mode objects are allocated from one arena that is
+// released when the program exits, and delete only runs their deinit blocks.
+
+package renderer
+
+import (
+	"fmt"
+	"strings"
+
+	"scar/lexer"
+)
+
+// Memory management modes of Options.Memory.
+const (
+	MemManual = "manual"
+	MemRC     = "rc"
+	MemArena  = "arena"
+)
+
+type rcLocal struct {
+	name   string
+	indent string
+}
+
+// Reports an error for a memory mode the generated program cannot use.
+func CheckMemoryMode(mode string) error {
+	switch mode {
+	case MemManual, MemRC, MemArena:
+		return nil
+	}
+	return fmt.Errorf("unknown memory mode %q, supported modes are %s, %s and %s", mode, MemManual, MemRC, MemArena)
+}
+
+// Returns the C expression allocating an instance of a class.
+func (r *Renderer) allocObject(className string) string {
+	switch r.opts.Memory {
+	case MemRC:
+		return fmt.Sprintf("__scar_rc_alloc(sizeof(%s), (void (*)(void*))%s_deinit)", className, className)
+	case MemArena:
+		return fmt.Sprintf("__scar_arena_alloc(sizeof(%s))", className)
+	}
+	return fmt.Sprintf("malloc(sizeof(%s))", className)
+}
+
+// Emits the body of ClassName_free after its NULL check.
+func (r *Renderer) freeObject(b *strings.Builder, className string) {
+	switch r.opts.Memory {
+	case MemRC:
+		b.WriteString("    __scar_release(this);\n")
+	case MemArena:
+		fmt.Fprintf(b, "    %s_deinit(this);\n", className)
+	default:
+		fmt.Fprintf(b, "    %s_deinit(this);\n", className)
+		b.WriteString("    free(this);\n")
+	}
+}
+
+// Returns the class of a type whose values are reference counted objects,
+// such as Node, ref Node or Node?.
+func (r *Renderer) countedClass(typ string) (string, bool) {
+	typ = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(typ), "ref "), "?")
+	if parts := strings.SplitN(typ, ".", 2); len(parts) == 2 {
+		typ = lexer.GenerateUniqueSymbol(parts[1], parts[0])
+	}
+	if _, exists := r.globalClasses[typ]; !exists || r.isInterface(typ) {
+		return "", false
+	}
+	return typ, true
+}
+
+// Emits the releases of the object fields of this in rc mode, run by
+// ClassName_deinit after the deinit block.
+func (r *Renderer) releaseFields(b *strings.Builder, classInfo *ClassInfo) {
+	if r.opts.Memory != MemRC {
+		return
+	}
+	for _, field := range classInfo.Fields {
+		if _, ok := r.countedClass(field.Type); ok {
+			fmt.Fprintf(b, "    __scar_release(this->%s);\n", field.Name)
+		}
+	}
+}
+
+// Reports whether a scar value creates an object the storing reference owns,
+// which is a new expression or a call, rather than reading one held elsewhere.
+func ownedValue(value string) bool {
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "new ") {
+		return true
+	}
+	expr, err := lexer.ParseExpr(value)
+	if err != nil {
+		return false
+	}
+	switch e := expr.(type) {
+	case *lexer.NewExpr, *lexer.CallExpr:
+		return true
+	case *lexer.LiteralExpr:
+		return e.Kind == lexer.NilLiteral
+	}
+	return false
+}
+
+// Renders an object stored into a new reference, retaining it in rc mode
+// unless the reference owns it already.
+func (r *Renderer) retainValue(value, rendered string) string {
+	if r.opts.Memory != MemRC || ownedValue(value) || rendered == "NULL" {
+		return rendered
+	}
+	return fmt.Sprintf("__scar_retain(%s)", rendered)
+}
+
+// Returns the declared type of an assignment target, which is a variable or
+// a field reached through this or object variables, as in order.customer.name.
+func (r *Renderer) targetType(target string) string {
+	dot := strings.LastIndex(target, ".")
+	if dot == -1 {
+		if obj, exists := r.globalObjects[target]; exists {
+			return obj.Type
+		}
+		return r.varTypes[target]
+	}
+	owner, fieldName := target[:dot], target[dot+1:]
+	className := r.currentClassName
+	if owner != "this" {
+		var ok bool
+		if className, ok = r.countedClass(r.targetType(owner)); !ok {
+			return ""
+		}
+	}
+	if field, exists := r.findField(className, fieldName); exists {
+		return field.Type
+	}
+	return ""
+}
+
+// Renders an assignment target as a C lvalue.
+func (r *Renderer) targetRef(target string) string {
+	if fieldName, ok := strings.CutPrefix(target, "this."); ok {
+		return "this->" + fieldName
+	}
+	if owner, fieldName, isField := strings.Cut(target, "."); isField {
+		ref := lexer.ResolveSymbol(owner, r.currentModule)
+		if _, isOptional := r.optionalVar(owner); isOptional {
+			ref = fmt.Sprintf("__scar_unwrap(%s, \"%s\")", ref, owner)
+		}
+		return ref + "->" + fieldName
+	}
+	return lexer.ResolveSymbol(target, r.currentModule)
+}
+
+// Emits an assignment to a variable or field holding an object in rc mode,
+// reporting whether the target was one. The new object is retained unless the
+// target owns it already, and the object it replaces is released.
+func (r *Renderer) assignCounted(b *strings.Builder, indent, target, value string) bool {
+	if r.opts.Memory != MemRC {
+		return false
+	}
+	typ := r.targetType(target)
+	if _, ok := r.countedClass(typ); !ok {
+		return false
+	}
+	var rendered string
+	if elemType, isOptional := optionalElemType(typ); isOptional {
+		rendered = r.optionalValue(elemType, value)
+	} else {
+		rendered = r.convertNewToConstructor(r.convertThisReferencesGranular(value))
+	}
+	macro := "__scar_rc_set"
+	if ownedValue(value) || rendered == "NULL" {
+		macro = "__scar_rc_move"
+	}
+	fmt.Fprintf(b, "%s%s(%s, %s);\n", indent, macro, r.targetRef(target), rendered)
+	return true
+}
+
+// Records a local holding an object, released when its block ends in rc mode.
+func (r *Renderer) trackLocal(name, typ, indent string) {
+	if _, ok := r.countedClass(typ); ok && r.opts.Memory == MemRC && !strings.HasPrefix(name, "this.") {
+		r.rcLocals = append(r.rcLocals, rcLocal{name: lexer.ResolveSymbol(name, r.currentModule), indent: indent})
+	}
+}
+
+// Emits the releases of the locals declared since the given point, innermost
+// first, skipping the one named keep.
+func (r *Renderer) releaseLocals(b *strings.Builder, indent string, since int, keep string) {
+	for i := len(r.rcLocals) - 1; i >= since; i-- {
+		if r.rcLocals[i].name != keep {
+			fmt.Fprintf(b, "%s__scar_release(%s);\n", indent, r.rcLocals[i].name)
+		}
+	}
+}
+
+// Releases the locals of a nested block when it ends. The locals of a function
+// body are released by endFunctionScope instead, since statements of the body
+// are sometimes rendered one at a time.
+func (r *Renderer) endBlockScope(b *strings.Builder, stmts []*lexer.Statement, indent string) {
+	if r.opts.Memory != MemRC || indent == "    " {
+		return
+	}
+	since := len(r.rcLocals)
+	for since > 0 && r.rcLocals[since-1].indent == indent {
+		since--
+	}
+	if !lexer.LeavesBlock(stmts) {
+		r.releaseLocals(b, indent, since, "")
+	}
+	r.rcLocals = r.rcLocals[:since]
+}
+
+// Releases the locals of a function body when it ends.
+func (r *Renderer) endFunctionScope(b *strings.Builder, stmts []*lexer.Statement) {
+	if r.opts.Memory == MemRC && !lexer.LeavesBlock(stmts) {
+		r.releaseLocals(b, "    ", 0, "")
+	}
+	r.rcLocals = nil
+}
+
+// Emits a return from the function being rendered, releasing its locals first
+// in rc mode. A returned object is handed to the caller as owned, so a local
+// holding it is not released and any other object is retained.
+func (r *Renderer) renderReturn(b *strings.Builder, indent, value, rendered, returnType string) {
+	if r.opts.Memory != MemRC || len(r.rcLocals) == 0 {
+		if rendered == "" {
+			fmt.Fprintf(b, "%sreturn;\n", indent)
+		} else {
+			fmt.Fprintf(b, "%sreturn %s;\n", indent, r.retainReturn(value, rendered, returnType))
+		}
+		return
+	}
+	if rendered == "" {
+		r.releaseLocals(b, indent, 0, "")
+		fmt.Fprintf(b, "%sreturn;\n", indent)
+		return
+	}
+	keep := ""
+	if _, ok := r.countedClass(returnType); ok {
+		keep = lexer.ResolveSymbol(strings.TrimSpace(value), r.currentModule)
+	}
+	if !r.isLocal(keep) {
+		keep = ""
+		rendered = r.retainReturn(value, rendered, returnType)
+	}
+	fmt.Fprintf(b, "%s{\n", indent)
+	fmt.Fprintf(b, "%s    __typeof__(%s) __scar_ret = %s;\n", indent, rendered, rendered)
+	r.releaseLocals(b, indent+"    ", 0, keep)
+	fmt.Fprintf(b, "%s    return __scar_ret;\n", indent)
+	fmt.Fprintf(b, "%s}\n", indent)
+}
+
+// Retains a returned object the function does not own in rc mode.
+func (r *Renderer) retainReturn(value, rendered, returnType string) string {
+	if _, ok := r.countedClass(returnType); !ok || r.isLocal(lexer.ResolveSymbol(strings.TrimSpace(value), r.currentModule)) {
+		return rendered
+	}
+	return r.retainValue(value, rendered)
+}
+
+func (r *Renderer) isLocal(name string) bool {
+	for _, local := range r.rcLocals {
+		if local.name == name {
+			return true
+		}
+	}
+	return false
+}
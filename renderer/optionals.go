@@ -0,0 +1,203 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains code generation for optional types such as int? and Node?.
+//
+// An optional is a pointer that is NULL when the value is nil. Optional
+// objects and strings are the pointer itself, while optional numbers, bools
+// and chars point to a heap box holding the value. Values are read through
+// __scar_unwrap, which stops the program naming the nil value instead of
+// letting it crash on a NULL dereference.
+
+package renderer
+
+import (
+	"fmt"
+	"strings"
+
+	"scar/lexer"
+)
+
+// Returns the type an optional type wraps.
+func optionalElemType(typ string) (string, bool) {
+	if !lexer.IsOptionalType(typ) {
+		return "", false
+	}
+	return strings.TrimSuffix(typ, "?"), true
+}
+
+// Reports whether optionals of a type hold their value in a heap box.
+func (r *Renderer) isBoxedOptional(elemType string) bool {
+	switch r.mapTypeToCType(elemType) {
+	case "int", "float", "double", "char", "bool", "short", "long", "unsigned short", "unsigned int", "unsigned long":
+		return true
+	}
+	return r.isEnumType(elemType)
+}
+
+// Returns the C type of an optional wrapping elemType.
+func (r *Renderer) optionalCType(elemType string) string {
+	if elemType == "string" || elemType == "cstring" {
+		return "char*"
+	}
+	return r.mapTypeToCType(elemType) + "*"
+}
+
+// Returns the wrapped type of a variable or field of this with an optional type.
+func (r *Renderer) optionalVar(name string) (string, bool) {
+	if fieldName, ok := strings.CutPrefix(name, "this."); ok {
+		if field, exists := r.findField(r.currentClassName, fieldName); exists {
+			return optionalElemType(field.Type)
+		}
+		return "", false
+	}
+	return optionalElemType(r.varTypes[name])
+}
+
+// Renders a scar value stored into an optional of the given wrapped type as C.
+// Optionals are stored as they are, while plain values are boxed as needed.
+func (r *Renderer) optionalValue(elemType, value string) string {
+	value = strings.TrimSpace(value)
+	if value == "nil" || value == "NULL" {
+		return "NULL"
+	}
+	expr, err := lexer.ParseExpr(value)
+	if err != nil {
+		return r.convertThisReferencesGranular(lexer.ResolveSymbol(value, r.currentModule))
+	}
+	return r.optionalExprValue(elemType, expr)
+}
+
+// Renders a scar value stored into a new optional, retaining objects in rc mode.
+func (r *Renderer) countedValue(elemType, value string) string {
+	rendered := r.optionalValue(elemType, value)
+	if _, counted := r.countedClass(elemType); counted {
+		return r.retainValue(value, rendered)
+	}
+	return rendered
+}
+
+// Renders an expression stored into an optional of the given wrapped type as C.
+func (r *Renderer) optionalExprValue(elemType string, expr lexer.Expr) string {
+	if isNilLiteral(expr) {
+		return "NULL"
+	}
+	if ref, ok := r.optionalRef(expr); ok {
+		return ref
+	}
+	rendered := r.renderExpr(expr)
+	// A call returning an optional is already boxed.
+	if _, isCall := expr.(*lexer.CallExpr); isCall && lexer.IsOptionalType(r.exprType(expr)) {
+		return rendered
+	}
+	if r.isBoxedOptional(elemType) {
+		return fmt.Sprintf("__scar_box(%s, %s)", r.mapTypeToCType(elemType), rendered)
+	}
+	return rendered
+}
+
+// Renders an expression naming an optional variable or field as the optional
+// itself rather than its unwrapped value.
+func (r *Renderer) optionalRef(expr lexer.Expr) (string, bool) {
+	name, ok := exprVarName(expr)
+	if !ok {
+		return "", false
+	}
+	if _, isOptional := r.optionalVar(name); !isOptional {
+		return "", false
+	}
+	if fieldName, ok := strings.CutPrefix(name, "this."); ok {
+		return "this->" + fieldName, true
+	}
+	return lexer.ResolveSymbol(name, r.currentModule), true
+}
+
+// Renders the unwrapped value of an optional variable or field, or reports
+// false when the expression is not one.
+func (r *Renderer) unwrapOptional(expr lexer.Expr) (string, bool) {
+	name, ok := exprVarName(expr)
+	if !ok {
+		return "", false
+	}
+	elemType, isOptional := r.optionalVar(name)
+	if !isOptional {
+		return "", false
+	}
+	ref, _ := r.optionalRef(expr)
+	unwrapped := fmt.Sprintf("__scar_unwrap(%s, \"%s\")", ref, name)
+	if r.isBoxedOptional(elemType) {
+		return "(*" + unwrapped + ")", true
+	}
+	return unwrapped, true
+}
+
+// Renders the value of an optional number, bool, char or string read in an
+// expression. Optional objects are only unwrapped when their members are used.
+func (r *Renderer) unwrapValue(expr lexer.Expr) (string, bool) {
+	name, ok := exprVarName(expr)
+	if !ok {
+		return "", false
+	}
+	if elemType, isOptional := r.optionalVar(name); !isOptional || !r.isBoxedOptional(elemType) && elemType != "string" {
+		return "", false
+	}
+	return r.unwrapOptional(expr)
+}
+
+// Renders an operand compared with nil, leaving optionals as pointers.
+func (r *Renderer) renderOptional(expr lexer.Expr) string {
+	if ref, ok := r.optionalRef(expr); ok {
+		return ref
+	}
+	return r.renderExpr(expr)
+}
+
+// Emits the declaration of a variable or field of this with an optional type.
+func (r *Renderer) declareOptional(b *strings.Builder, indent, name, typ, value string) {
+	elemType, _ := optionalElemType(typ)
+	if fieldName, ok := strings.CutPrefix(name, "this."); ok {
+		fmt.Fprintf(b, "%sthis->%s = %s;\n", indent, fieldName, r.countedValue(elemType, value))
+		return
+	}
+	r.varTypes[name] = typ
+	fmt.Fprintf(b, "%s%s %s = %s;\n", indent, r.optionalCType(elemType), lexer.ResolveSymbol(name, r.currentModule), r.countedValue(elemType, value))
+	r.trackLocal(name, typ, indent)
+}
+
+// Emits an assignment to an optional variable or field if the target is one,
+// reporting whether it was.
+func (r *Renderer) assignOptional(b *strings.Builder, indent, target, value string) bool {
+	elemType, ok := r.optionalVar(target)
+	if !ok {
+		return false
+	}
+	ref := lexer.ResolveSymbol(target, r.currentModule)
+	if fieldName, isField := strings.CutPrefix(target, "this."); isField {
+		ref = "this->" + fieldName
+	}
+	fmt.Fprintf(b, "%s%s = %s;\n", indent, ref, r.optionalValue(elemType, value))
+	return true
+}
+
+// Reports whether a binary expression compares a value with nil, in which
+// case an optional operand is compared as the pointer it is.
+func isNilComparison(e *lexer.BinaryExpr) bool {
+	if e.Op != "==" && e.Op != "!=" {
+		return false
+	}
+	return isNilLiteral(e.Left) || isNilLiteral(e.Right)
+}
+
+func isNilLiteral(expr lexer.Expr) bool {
+	literal, ok := expr.(*lexer.LiteralExpr)
+	return ok && literal.Kind == lexer.NilLiteral
+}
+
+// Restores the quotes the parser strips from string literal values.
+func quotedValue(value string, quoted bool) string {
+	if !quoted {
+		return value
+	}
+	return `"` + value + `"`
+}
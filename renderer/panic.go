@@ -0,0 +1,47 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains the rendering of panic(message) and of the call context it
+// reports.
+//
+// panic prints its message with the scar file and line through the #line
+// directives and aborts. In --debug builds every function, method and
+// constructor pushes its name on a thread local context stack when called,
+// which is popped by a cleanup attribute however it returns, so a panic also
+// prints the functions it happened in, innermost first. Try blocks restore
+// the stack when they catch an exception, as the longjmp skips the cleanups.
+
+package renderer
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Reports whether a call of name is the panic builtin rather than a function
+// of the program.
+func (r *Renderer) isPanic(name string) bool {
+	_, userDefined := r.globalFunctions[name]
+	return name == "panic" && !userDefined
+}
+
+// Emits panic(message).
+func (r *Renderer) renderPanic(b *strings.Builder, indent string, args []string, line int) {
+	if len(args) != 1 {
+		r.renderErrorf(line, "panic takes a message, got %d arguments", len(args))
+		return
+	}
+	message, ok := r.interpolatedLiteral(args[0])
+	if !ok {
+		message = r.convertThisReferencesGranular(args[0])
+	}
+	fmt.Fprintf(b, "%s__scar_panic(%s);\n", indent, message)
+}
+
+// Emits the push of a function on the context stack in --debug builds.
+func (r *Renderer) enterContext(b *strings.Builder, name string) {
+	if r.opts.Debug {
+		fmt.Fprintf(b, "    __scar_context_enter(%s);\n", cStringLiteral(name))
+	}
+}
@@ -44,15 +44,15 @@ if (fgets(buffer, sizeof(buffer), stdin) != NULL) {
 
 	result := RenderC(program, "")
 
-	if !strings.Contains(result, "void readln(char* _output_buffer);") {
-		t.Errorf("Expected function declaration 'void readln(char* _output_buffer);' but got:\n%s", result)
+	if !strings.Contains(result, "char* readln();") {
+		t.Errorf("Expected function declaration 'char* readln();' but got:\n%s", result)
 	}
 
-	if strings.Contains(result, "char* readln();") {
-		t.Error("Should not have old-style 'char* readln();' declaration")
+	if strings.Contains(result, "_output_buffer") {
+		t.Error("Should not pass a hidden output buffer to string functions")
 	}
 
-	if !strings.Contains(result, "void readln(char* _output_buffer) {") {
+	if !strings.Contains(result, "char* readln() {") {
 		t.Error("Expected function implementation with correct signature")
 	}
 
@@ -60,20 +60,16 @@ if (fgets(buffer, sizeof(buffer), stdin) != NULL) {
 		t.Error("Should not have 'return buffer;' - should be transformed")
 	}
 
-	if !strings.Contains(result, "strcpy(_output_buffer, buffer);") {
-		t.Error("Expected 'strcpy(_output_buffer, buffer);' transformation")
+	if !strings.Contains(result, "return __scar_str_new(buffer);") {
+		t.Error("Expected 'return __scar_str_new(buffer);' transformation")
 	}
 
-	if !strings.Contains(result, `strcpy(_output_buffer, "");`) {
+	if !strings.Contains(result, `return __scar_str_new("");`) {
 		t.Error("Expected empty string return to be transformed")
 	}
 
-	if !strings.Contains(result, "char asdf[256];") {
-		t.Error("Expected string variable declaration")
-	}
-
-	if !strings.Contains(result, "readln(asdf);") {
-		t.Error("Expected function call with buffer parameter")
+	if !strings.Contains(result, "char* asdf = readln();") {
+		t.Error("Expected string variable to take the returned string")
 	}
 
 	if strings.Contains(result, "strcpy(asdf, readln())") {
@@ -114,18 +110,18 @@ return buffer;`,
 
 	result := RenderC(program, "")
 
-	expectedDecl := "void formatString(char* _output_buffer, char* prefix, int value);"
+	expectedDecl := "char* formatString(char* prefix, int value);"
 	if !strings.Contains(result, expectedDecl) {
 		t.Errorf("Expected declaration: %s\nGot:\n%s", expectedDecl, result)
 	}
 
-	expectedImpl := "void formatString(char* _output_buffer, char* prefix, int value) {"
+	expectedImpl := "char* formatString(char* prefix, int value) {"
 	if !strings.Contains(result, expectedImpl) {
 		t.Error("Expected correct implementation signature")
 	}
 
-	if !strings.Contains(result, `formatString(result, "Number", 42);`) {
-		t.Errorf("Expected function call with all parameters including buffer. Got:\n%s", result)
+	if !strings.Contains(result, `char* result = formatString("Number", 42);`) {
+		t.Errorf("Expected function call with its own parameters only. Got:\n%s", result)
 	}
 }
 
@@ -214,14 +210,14 @@ func TestMixedStringAndNonStringFunctions(t *testing.T) {
 
 	result := RenderC(program, "")
 
-	if !strings.Contains(result, "void getString(char* _output_buffer);") {
-		t.Error("String function should have modified signature")
+	if !strings.Contains(result, "char* getString();") {
+		t.Error("String function should return char*")
 	}
 	if !strings.Contains(result, "int getInt();") {
 		t.Error("Int function should have normal signature")
 	}
-	if !strings.Contains(result, "getString(str);") {
-		t.Error("String variable should call function with buffer")
+	if !strings.Contains(result, "char* str = getString();") {
+		t.Error("String variable should take the returned string")
 	}
 	if !strings.Contains(result, "int num = getInt();") {
 		t.Error("Int variable should use normal assignment")
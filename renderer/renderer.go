@@ -8,26 +8,148 @@ package renderer
 
 import (
 	"fmt"
-	"os"
+	"maps"
+	"path/filepath"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"unicode"
 
+	"scar/diagnostics"
 	"scar/lexer"
+	"scar/logging"
 )
 
-var (
-	globalClasses    = make(map[string]*ClassInfo)
-	globalEnums      = make(map[string]*EnumInfo)
-	globalObjects    = make(map[string]*ObjectInfo)
-	globalFunctions  = make(map[string]*lexer.TopLevelFuncDeclStmt)
-	globalArrays     = make(map[string]string)
-	globalVars       = make(map[string]*lexer.PubVarDeclStmt)
-	currentModule    = ""
-	currentClassName = ""
+// A Renderer generates the C code of a program. It holds what is known about
+// the program and where rendering is in it, so separate Renderers can render
+// programs one after another in the same process.
+type Renderer struct {
+	globalClasses    map[string]*ClassInfo
+	globalEnums      map[string]*EnumInfo
+	globalObjects    map[string]*ObjectInfo
+	globalFunctions  map[string]*lexer.TopLevelFuncDeclStmt
+	globalArrays     map[string]string
+	globalVars       map[string]*lexer.PubVarDeclStmt
+	globalInterfaces map[string]*lexer.InterfaceDeclStmt
+	currentModule    string
+	currentClassName string
 	currentFunction  *lexer.TopLevelFuncDeclStmt
-	primitiveTypes   = map[string]string{
+
+	// Constants by C name, and their C names in declaration order.
+	globalConsts map[string]*constInfo
+	constOrder   []string
+	// Structs declared so far, and the order they were declared in.
+	globalStructs map[string]*lexer.StructDeclStmt
+	structOrder   []string
+	// Key and value types of the maps declared so far.
+	globalMaps map[string]mapInfo
+	// Element types of the sets declared so far.
+	globalSets map[string]string
+	// The extern functions of the program and of its modules, by name.
+	externFunctions map[string]*lexer.ExternFuncStmt
+
+	// Declared scar types of local variables and parameters seen so far.
+	varTypes map[string]string
+	// Local string variables currently lowered to heap strings.
+	heapStrings map[string]bool
+	// Whether each variable rendered so far was declared atomic, by C name.
+	atomicVars map[string]bool
+	// Reference counted locals of the function being rendered, innermost last.
+	rcLocals []rcLocal
+	// Loops enclosing the statement being rendered, innermost last.
+	loopFrames []*loopFrame
+	// Number of loops rendered so far, used to name their C labels.
+	loopCount int
+	// Try blocks enclosing the statement being rendered, innermost last.
+	tryFrames []tryFrame
+	// Variables bound by catch blocks enclosing the statement being rendered.
+	exceptionVars map[string]bool
+	// The functions started by spawn, whose wrappers are emitted once the
+	// whole program has been rendered.
+	spawnedFunctions map[string]bool
+	// The functions sort! was given as comparators, whose shims are emitted
+	// once the whole program has been rendered.
+	sortComparators map[string]bool
+
+	// How the program is rendered.
+	opts Options
+	// Whether the program is being rendered as a library.
+	libraryMode bool
+	// The scar file of the statements being rendered, if #line directives
+	// are emitted.
+	lineFile string
+	// The errors found while generating code. Generation goes on after an
+	// error, so all of them are reported at once.
+	renderErrors []error
+}
+
+// Options select how a program is rendered. The zero value renders a plain
+// build managing memory manually.
+type Options struct {
+	// The scar file of the main program. When it is set, statements are
+	// preceded by #line directives naming the scar lines they come from, so
+	// compiler diagnostics, assertion failures and debuggers point at the
+	// scar source.
+	SourceFile string
+	// Whether the program is built with --debug, which compiles breakpoint
+	// statements into traps stopping the debugger.
+	Debug bool
+	// How objects are allocated and freed, one of MemManual, MemRC and
+	// MemArena. Empty selects MemManual.
+	Memory string
+	// Whether list indexing is checked against the length of the list at
+	// runtime.
+	BoundsCheck bool
+	// Whether allocations are tracked and reported at exit.
+	LeakCheck bool
+	// Whether integer arithmetic is checked for overflow and division by
+	// zero at runtime.
+	SafeMode bool
+	// Whether test blocks are compiled into main and main reports the
+	// results of the tests. Test blocks are left out otherwise.
+	TestMode bool
+	// Whether bench blocks are compiled into main, and the number of
+	// iterations each runs. Without a number of iterations, the iterations
+	// are doubled until the bench block runs for at least a second.
+	BenchMode       bool
+	BenchIterations int
+	// Whether programs are compiled without OpenMP, parallel for loops
+	// running serially and atomic variables being updated with the atomic
+	// builtins of the C compiler instead.
+	NoOpenMP bool
+}
+
+// Returns a Renderer for a new program, rendered as opts select.
+func NewRenderer(opts Options) *Renderer {
+	if opts.Memory == "" {
+		opts.Memory = MemManual
+	}
+	return &Renderer{
+		opts:             opts,
+		globalClasses:    make(map[string]*ClassInfo),
+		globalEnums:      make(map[string]*EnumInfo),
+		globalObjects:    make(map[string]*ObjectInfo),
+		globalFunctions:  make(map[string]*lexer.TopLevelFuncDeclStmt),
+		globalArrays:     make(map[string]string),
+		globalVars:       make(map[string]*lexer.PubVarDeclStmt),
+		globalInterfaces: make(map[string]*lexer.InterfaceDeclStmt),
+		globalConsts:     make(map[string]*constInfo),
+		globalStructs:    make(map[string]*lexer.StructDeclStmt),
+		globalMaps:       make(map[string]mapInfo),
+		globalSets:       make(map[string]string),
+		externFunctions:  make(map[string]*lexer.ExternFuncStmt),
+		varTypes:         make(map[string]string),
+		heapStrings:      make(map[string]bool),
+		atomicVars:       make(map[string]bool),
+		exceptionVars:    make(map[string]bool),
+		spawnedFunctions: make(map[string]bool),
+		sortComparators:  make(map[string]bool),
+	}
+}
+
+var (
+	primitiveTypes = map[string]string{
 		"int":    "int",
 		"float":  "float",
 		"double": "double",
@@ -45,41 +167,127 @@ var (
 	}
 )
 
+func (r *Renderer) renderErrorf(line int, format string, args ...any) {
+	d := diagnostics.Errorf(line, format, args...)
+	d.File = r.lineFile
+	r.renderErrors = append(r.renderErrors, d)
+}
+
+// Returns the errors found while rendering the program.
+func (r *Renderer) Errors() []error {
+	return r.renderErrors
+}
+
+// Returns the scar file of a module, or of the main program for "", when
+// #line directives are emitted.
+func (r *Renderer) moduleSourceFile(module string) string {
+	if r.opts.SourceFile == "" {
+		return ""
+	}
+	if module == "" {
+		return r.opts.SourceFile
+	}
+	if info, exists := lexer.LoadedModules[module]; exists {
+		if path, err := filepath.Abs(info.FilePath); err == nil {
+			return path
+		}
+		return info.FilePath
+	}
+	return ""
+}
+
+// Renders a program as C with a new Renderer.
 func RenderC(program *lexer.Program, baseDir string) string {
-	var b strings.Builder
+	return NewRenderer(Options{}).RenderC(program, baseDir)
+}
+
+// Renders the program as C.
+func (r *Renderer) RenderC(program *lexer.Program, baseDir string) string {
+	var (
+		b = strings.Builder{}
+		p = r.renderProgram(program, baseDir)
+	)
+	b.WriteString(p.head.String())
+	writeArgGlobals(&b, false)
+	b.WriteString(p.types.String())
+	b.WriteString(p.prototypes.String())
+	for _, module := range lexer.SortedModules() {
+		b.WriteString(p.section(p.headers, module.Name).String())
+	}
+	b.WriteString("\n")
+	for _, module := range lexer.SortedModules() {
+		b.WriteString(p.section(p.definitions, module.Name).String())
+	}
+	b.WriteString(p.adapters.String())
+	b.WriteString(p.section(p.definitions, "").String())
+	return b.String()
+}
 
+// Renders the sections of a program, loading the modules it imports.
+func (r *Renderer) renderProgram(program *lexer.Program, baseDir string) *renderedProgram {
+	p := &renderedProgram{
+		headers:     make(map[string]*strings.Builder),
+		definitions: make(map[string]*strings.Builder),
+	}
+	r.loopCount = 0
+	r.renderErrors = nil
+	r.spawnedFunctions = make(map[string]bool)
+	r.sortComparators = make(map[string]bool)
+	r.atomicVars = make(map[string]bool)
+	r.externFunctions = make(map[string]*lexer.ExternFuncStmt)
 	for _, importStmt := range program.Imports {
-		_, err := lexer.LoadModule(importStmt.Module, baseDir)
+		module, err := lexer.LoadModule(importStmt.Module, baseDir)
+		if err == nil {
+			err = lexer.CheckImportedNames(importStmt, module)
+		}
 		if err != nil {
-			fmt.Printf("\033[31mFailed to load module '%s': %v\033[0m\n", importStmt.Module, err)
-			os.Exit(1)
+			r.renderErrors = append(r.renderErrors, fmt.Errorf("failed to load module '%s': %w", importStmt.Module, err))
 		}
 	}
+	if len(r.renderErrors) > 0 {
+		return p
+	}
 
 	for _, stmt := range program.Statements {
 		if stmt.ClassDecl != nil {
-			collectClassInfo(stmt.ClassDecl)
+			r.collectClassInfo(stmt.ClassDecl)
+		}
+		if stmt.InterfaceDecl != nil {
+			r.globalInterfaces[stmt.InterfaceDecl.Name] = stmt.InterfaceDecl
+		}
+		if stmt.StructDecl != nil {
+			r.collectStruct(stmt.StructDecl)
 		}
 		if stmt.PubVarDecl != nil {
-			globalVars[stmt.PubVarDecl.Name] = stmt.PubVarDecl
+			r.globalVars[stmt.PubVarDecl.Name] = stmt.PubVarDecl
+			r.atomicVars[stmt.PubVarDecl.Name] = stmt.PubVarDecl.Atomic
+		}
+		if stmt.ExternFunc != nil {
+			r.externFunctions[stmt.ExternFunc.Name] = stmt.ExternFunc
+		}
+		if stmt.ConstDecl != nil {
+			r.collectConst(stmt.ConstDecl.Name, "", stmt.ConstDecl)
 		}
 		if stmt.PubClassDecl != nil {
 			classDecl := &lexer.ClassDeclStmt{
 				Name:        stmt.PubClassDecl.Name,
+				Base:        stmt.PubClassDecl.Base,
+				Interfaces:  stmt.PubClassDecl.Interfaces,
 				Constructor: stmt.PubClassDecl.Constructor,
 				Methods:     stmt.PubClassDecl.Methods,
+				Deinit:      stmt.PubClassDecl.Deinit,
 			}
-			collectClassInfo(classDecl)
+			r.collectClassInfo(classDecl)
 		}
 		if stmt.ObjectDecl != nil {
 			objectInfo := &ObjectInfo{
 				Name: stmt.ObjectDecl.Name,
 				Type: stmt.ObjectDecl.Type,
 			}
-			globalObjects[stmt.ObjectDecl.Name] = objectInfo
+			r.globalObjects[stmt.ObjectDecl.Name] = objectInfo
 		}
 		if stmt.TopLevelFuncDecl != nil {
-			globalFunctions[stmt.TopLevelFuncDecl.Name] = stmt.TopLevelFuncDecl
+			r.globalFunctions[stmt.TopLevelFuncDecl.Name] = stmt.TopLevelFuncDecl
 		}
 		if stmt.PubTopLevelFuncDecl != nil {
 			topLevelFunc := &lexer.TopLevelFuncDeclStmt{
@@ -88,128 +296,81 @@ func RenderC(program *lexer.Program, baseDir string) string {
 				ReturnType: stmt.PubTopLevelFuncDecl.ReturnType,
 				Body:       stmt.PubTopLevelFuncDecl.Body,
 			}
-			globalFunctions[stmt.PubTopLevelFuncDecl.Name] = topLevelFunc
+			r.globalFunctions[stmt.PubTopLevelFuncDecl.Name] = topLevelFunc
 		}
 		// Handle enum declarations
 		if stmt.EnumDecl != nil {
 			enumInfo := &EnumInfo{
-				Name:   stmt.EnumDecl.Name,
-				Values: stmt.EnumDecl.Values,
+				Name:          stmt.EnumDecl.Name,
+				Values:        stmt.EnumDecl.Values,
+				Discriminants: stmt.EnumDecl.Discriminants,
 			}
-			globalEnums[stmt.EnumDecl.Name] = enumInfo
+			r.globalEnums[stmt.EnumDecl.Name] = enumInfo
 		}
 		// Handle public enum declarations
 		if stmt.PubEnumDecl != nil {
 			enumInfo := &EnumInfo{
-				Name:   stmt.PubEnumDecl.Name,
-				Values: stmt.PubEnumDecl.Values,
+				Name:          stmt.PubEnumDecl.Name,
+				Values:        stmt.PubEnumDecl.Values,
+				Discriminants: stmt.PubEnumDecl.Discriminants,
 			}
-			globalEnums[stmt.PubEnumDecl.Name] = enumInfo
+			r.globalEnums[stmt.PubEnumDecl.Name] = enumInfo
 		}
 	}
 
-	for _, module := range lexer.LoadedModules {
+	for _, module := range lexer.SortedModules() {
 		for _, classDecl := range module.PublicClasses {
-			collectClassInfoWithModule(classDecl, module.Name)
+			r.collectClassInfoWithModule(classDecl, module.Name)
 		}
-	}
-	for _, enumInfo := range globalEnums {
-		b.WriteString("typedef enum {\n")
-		for i, value := range enumInfo.Values {
-			b.WriteString(fmt.Sprintf("    %s_%s", enumInfo.Name, value))
-			if i < len(enumInfo.Values)-1 {
-				b.WriteString(",\n")
-			}
+		for _, extern := range module.Externs {
+			r.externFunctions[extern.Name] = extern
 		}
-		b.WriteString(fmt.Sprintf("\n} %s;\n\n", enumInfo.Name))
 	}
+	r.resolveInheritedFields()
+	r.generateEnumTypedefs(&p.head)
 
-	b.WriteString(`#include <stdio.h>
+	p.head.WriteString(`#include <stdio.h>
 #include <string.h>
 #include <unistd.h>
-#include <omp.h>
 #include <stdlib.h>
 #include <stdbool.h>
 #include <stdint.h>
 
-int _exception = 0;
-int __global_argc = 0;
-char** __global_argv = NULL;
-
-bool __check_string_key_exists(char keys[][256], int size, char* key) {
-    for (int i = 0; i < size; i++) {
-        if (strcmp(keys[i], key) == 0) {
-            return true;
-        }
-    }
-    return false;
-}
-
-bool __check_key_exists(int* keys, int size, int key) {
-    for (int i = 0; i < size; i++) {
-        if (keys[i] == key) {
-            return true;
-        }
-    }
-    return false;
-}
-
 `)
-	for className := range globalClasses {
-		fmt.Fprintf(&b, "struct %s;\n", className)
+	r.writeExternDeclarations(&p.head)
+	b := &p.types
+	r.collectModuleConsts()
+	r.collectModuleVars()
+	r.generateConsts(b)
+	r.generateEnumFunctions(b)
+	classNames := r.sortedClassNames()
+	for _, className := range classNames {
+		fmt.Fprintf(b, "struct %s;\n", className)
 	}
 	b.WriteString("\n")
-	for className := range globalClasses {
-		fmt.Fprintf(&b, "typedef struct %s %s;\n", className, className)
+	for _, className := range classNames {
+		fmt.Fprintf(b, "typedef struct %s %s;\n", className, className)
 	}
 	b.WriteString("\n")
-	for className, classInfo := range globalClasses {
-		generateStructDefinition(&b, classInfo, className)
+	r.generateStructTypedefs(b)
+	for _, name := range r.sortedInterfaceNames() {
+		r.generateInterfaceDefinition(b, r.globalInterfaces[name])
+	}
+	for _, className := range classNames {
+		r.generateStructDefinition(b, r.globalClasses[className], className)
+		r.generateUpcastHelpers(b, className)
 		b.WriteString("\n")
 	}
 
-	for className := range globalClasses {
-		var constructor *lexer.ConstructorStmt
-		for _, stmt := range program.Statements {
-			if stmt.ClassDecl != nil && stmt.ClassDecl.Name == className {
-				constructor = stmt.ClassDecl.Constructor
-				break
-			}
-			if stmt.PubClassDecl != nil && stmt.PubClassDecl.Name == className {
-				constructor = stmt.PubClassDecl.Constructor
-				break
-			}
-		}
-
-		if constructor == nil {
-			for _, module := range lexer.LoadedModules {
-				if classDecl, exists := module.PublicClasses[className]; exists {
-					constructor = classDecl.Constructor
-					break
-				}
-			}
-		}
-
-		if constructor != nil && len(constructor.Parameters) > 0 {
-			fmt.Fprintf(&b, "%s* %s_new(", className, className)
-			for i, param := range constructor.Parameters {
-				if i > 0 {
-					b.WriteString(", ")
-				}
-				paramType := mapTypeToCType(param.Type)
-				if param.Type == "string" {
-					paramType = "char*"
-				}
-				fmt.Fprintf(&b, "%s %s", paramType, param.Name)
-			}
-			b.WriteString(");\n")
-		} else {
-			fmt.Fprintf(&b, "%s* %s_new();\n", className, className)
-		}
-
+	for _, className := range classNames {
+		r.writeClassPrototypes(b, className, program)
 		b.WriteString("\n")
 	}
-	for _, module := range lexer.LoadedModules {
+	for _, className := range classNames {
+		r.generateInterfaceVtables(b, className)
+	}
+	functionModules := make(map[string]string)
+	for _, module := range lexer.SortedModules() {
 		for funcName, funcDecl := range module.PublicFuncs {
 			topLevelFunc := &lexer.TopLevelFuncDeclStmt{
 				Name:       lexer.GenerateUniqueSymbol(funcName, module.Name),
@@ -217,53 +378,62 @@ bool __check_key_exists(int* keys, int size, int key) {
 				ReturnType: funcDecl.ReturnType,
 				Body:       funcDecl.Body,
 			}
-			globalFunctions[lexer.GenerateUniqueSymbol(funcName, module.Name)] = topLevelFunc
+			r.globalFunctions[topLevelFunc.Name] = topLevelFunc
+			functionModules[topLevelFunc.Name] = module.Name
 		}
 	}
-	for _, funcDecl := range globalFunctions {
+	for _, name := range slices.Sorted(maps.Keys(r.globalFunctions)) {
+		funcDecl := r.globalFunctions[name]
 		if funcDecl.Name == "main" {
 			continue
 		}
-		prototype := generateFunctionPrototype(funcDecl)
-		b.WriteString(fmt.Sprintf("%s;\n", prototype))
+		prototypes := &p.prototypes
+		if module := functionModules[funcDecl.Name]; module != "" {
+			prototypes = p.section(p.headers, module)
+		}
+		fmt.Fprintf(prototypes, "%s;\n", r.generateFunctionPrototype(funcDecl))
 	}
-	b.WriteString("\n")
-	for varName, varDecl := range globalVars {
-		cType := mapTypeToCType(varDecl.Type)
+	p.prototypes.WriteString("\n")
+
+	b = p.section(p.definitions, "")
+	for _, varName := range slices.Sorted(maps.Keys(r.globalVars)) {
+		varDecl := r.globalVars[varName]
+		cType := r.mapTypeToCType(varDecl.Type)
 		value := varDecl.Value
 
 		if varDecl.Type == "string" {
 			if !strings.HasPrefix(value, "\"") {
 				value = fmt.Sprintf("\"%s\"", value)
 			}
-			fmt.Fprintf(&b, "char %s[256];\n", varName)
-			fmt.Fprintf(&b, "void init_%s() { strcpy(%s, %s); }\n", varName, varName, value)
+			fmt.Fprintf(b, "char %s[256];\n", varName)
+			fmt.Fprintf(b, "void init_%s() { strcpy(%s, %s); }\n", varName, varName, value)
 		} else {
-			fmt.Fprintf(&b, "%s %s = %s;\n", cType, varName, value)
+			fmt.Fprintf(b, "%s %s = %s;\n", cType, varName, value)
 		}
 	}
 	b.WriteString("\n")
-	for varName, varDecl := range globalVars {
-		if varDecl.Type == "string" {
-			fmt.Fprintf(&b, "    init_%s();\n", varName)
-		}
-	}
-	for _, module := range lexer.LoadedModules {
-		for varName, varDecl := range module.PublicVars {
-			cType := mapTypeToCType(varDecl.Type)
+	for _, module := range lexer.SortedModules() {
+		header := p.section(p.headers, module.Name)
+		for _, varName := range slices.Sorted(maps.Keys(module.PublicVars)) {
+			varDecl := module.PublicVars[varName]
+			cType := r.mapTypeToCType(varDecl.Type)
 			uniqueName := lexer.GenerateUniqueSymbol(varName, module.Name)
+			r.atomicVars[uniqueName] = varDecl.Atomic
 			if varDecl.Type == "string" {
-				fmt.Fprintf(&b, "extern char %s[256];\n", uniqueName)
+				fmt.Fprintf(header, "extern char %s[256];\n", uniqueName)
+				fmt.Fprintf(header, "void init_%s();\n", uniqueName)
 			} else {
-				fmt.Fprintf(&b, "extern %s %s;\n", cType, uniqueName)
+				fmt.Fprintf(header, "extern %s %s;\n", cType, uniqueName)
 			}
 		}
 	}
 
-	for _, module := range lexer.LoadedModules {
-		for varName, varDecl := range module.PublicVars {
+	for _, module := range lexer.SortedModules() {
+		definitions := p.section(p.definitions, module.Name)
+		for _, varName := range slices.Sorted(maps.Keys(module.PublicVars)) {
+			varDecl := module.PublicVars[varName]
 			var (
-				cType      = mapTypeToCType(varDecl.Type)
+				cType      = r.mapTypeToCType(varDecl.Type)
 				uniqueName = lexer.GenerateUniqueSymbol(varName, module.Name)
 				value      = varDecl.Value
 			)
@@ -271,104 +441,143 @@ bool __check_key_exists(int* keys, int size, int key) {
 				if !strings.HasPrefix(value, "\"") {
 					value = fmt.Sprintf("\"%s\"", value)
 				}
-				fmt.Fprintf(&b, "char %s[256];\n", uniqueName)
-				fmt.Fprintf(&b, "void init_%s() { strcpy(%s, %s); }\n", uniqueName, uniqueName, value)
+				fmt.Fprintf(definitions, "char %s[256];\n", uniqueName)
+				fmt.Fprintf(definitions, "void init_%s() { strcpy(%s, %s); }\n", uniqueName, uniqueName, value)
 			} else {
-				fmt.Fprintf(&b, "%s %s = %s;\n", cType, uniqueName, value)
+				fmt.Fprintf(definitions, "%s %s = %s;\n", cType, uniqueName, value)
 			}
 		}
 	}
 
+	r.lineFile = r.moduleSourceFile("")
 	for _, stmt := range program.Statements {
 		if stmt.ClassDecl != nil {
-			generateClassImplementation(&b, stmt.ClassDecl, "", program)
+			r.generateClassImplementation(b, stmt.ClassDecl, "", program)
 		}
 		if stmt.PubClassDecl != nil {
 			classDecl := &lexer.ClassDeclStmt{
 				Name:        stmt.PubClassDecl.Name,
+				Base:        stmt.PubClassDecl.Base,
+				Interfaces:  stmt.PubClassDecl.Interfaces,
 				Constructor: stmt.PubClassDecl.Constructor,
 				Methods:     stmt.PubClassDecl.Methods,
+				Deinit:      stmt.PubClassDecl.Deinit,
 			}
-			generateClassImplementation(&b, classDecl, "", program)
+			r.generateClassImplementation(b, classDecl, "", program)
 		}
 	}
 
-	for _, module := range lexer.LoadedModules {
-		for _, classDecl := range module.PublicClasses {
-			generateClassImplementation(&b, classDecl, module.Name, program)
+	for _, module := range lexer.SortedModules() {
+		for _, name := range slices.Sorted(maps.Keys(module.PublicClasses)) {
+			classDecl := module.PublicClasses[name]
+			r.lineFile = r.moduleSourceFile(module.Name)
+			r.generateClassImplementation(p.section(p.definitions, module.Name), classDecl, module.Name, program)
 		}
 	}
+	for _, className := range classNames {
+		r.generateInterfaceAdapters(&p.adapters, className)
+	}
 
-	for _, funcDecl := range globalFunctions {
-		generateTopLevelFunctionImplementation(&b, funcDecl, program)
+	for _, name := range slices.Sorted(maps.Keys(r.globalFunctions)) {
+		funcDecl := r.globalFunctions[name]
+		r.lineFile = r.moduleSourceFile(functionModules[funcDecl.Name])
+		r.generateTopLevelFunctionImplementation(p.section(p.definitions, functionModules[funcDecl.Name]), funcDecl, program)
 	}
 
-	b.WriteString("int main(int argc, char** argv) {\n")
-	b.WriteString("    __global_argc = argc;\n")
-	b.WriteString("    __global_argv = argv;\n")
+	if r.libraryMode {
+		b.WriteString("__attribute__((constructor)) static void __scar_library_init(void) {\n")
+	} else {
+		b.WriteString("int main(int argc, char** argv) {\n")
+		b.WriteString("    __global_argc = argc;\n")
+		b.WriteString("    __global_argv = argv;\n")
+	}
 
-	for _, module := range lexer.LoadedModules {
-		for varName, varDecl := range module.PublicVars {
+	for _, varName := range slices.Sorted(maps.Keys(r.globalVars)) {
+		varDecl := r.globalVars[varName]
+		if varDecl.Type == "string" {
+			fmt.Fprintf(b, "    init_%s();\n", varName)
+		}
+	}
+	for _, module := range lexer.SortedModules() {
+		for _, varName := range slices.Sorted(maps.Keys(module.PublicVars)) {
+			varDecl := module.PublicVars[varName]
 			if varDecl.Type == "string" {
 				uniqueName := lexer.GenerateUniqueSymbol(varName, module.Name)
-				fmt.Fprintf(&b, "    init_%s();\n", uniqueName)
+				fmt.Fprintf(b, "    init_%s();\n", uniqueName)
 			}
 		}
 	}
 
 	var mainStatements []*lexer.Statement
 	for _, stmt := range program.Statements {
-		if stmt.ClassDecl == nil && stmt.PubClassDecl == nil && stmt.PubVarDecl == nil && stmt.TopLevelFuncDecl == nil && stmt.PubTopLevelFuncDecl == nil {
+		if stmt.ClassDecl == nil && stmt.PubClassDecl == nil && stmt.InterfaceDecl == nil && stmt.PubVarDecl == nil && stmt.TopLevelFuncDecl == nil && stmt.PubTopLevelFuncDecl == nil && stmt.ConstDecl == nil {
 			mainStatements = append(mainStatements, stmt)
 		}
 	}
 
-	renderStatements(&b, mainStatements, "    ", "", program, "")
-	b.WriteString("    return 0;\n")
+	r.lineFile = r.moduleSourceFile("")
+	r.renderStatements(b, mainStatements, "    ", "", program, "")
+	r.endFunctionScope(b, nil)
+	switch {
+	case r.libraryMode:
+	case r.opts.TestMode:
+		b.WriteString("    return __scar_test_summary();\n")
+	default:
+		b.WriteString("    return 0;\n")
+	}
 	b.WriteString("}\n")
+	r.writeSpawnWrappers(p, functionModules)
+	r.writeSortComparators(p, functionModules)
 
-	for _, stmt := range program.Statements {
-		if stmt.PubTopLevelFuncDecl == nil && stmt.ClassDecl == nil && stmt.PubClassDecl == nil && stmt.PubVarDecl == nil && stmt.TopLevelFuncDecl == nil {
-			mainStatements = append(mainStatements, stmt)
-		}
-	}
-	return b.String()
+	return p
 }
 
-func resolveLenFunctionCalls(expression string) string {
+func (r *Renderer) resolveLenFunctionCalls(expression string) string {
+	rowLenRegex := regexp.MustCompile(`len\(([a-zA-Z_][a-zA-Z0-9_]*)\[([^\[\]]+)\]\)`)
+	expression = rowLenRegex.ReplaceAllStringFunc(expression, func(match string) string {
+		groups := rowLenRegex.FindStringSubmatch(match)
+		if length, ok := r.rowLength(groups[1], groups[2]); ok {
+			return length
+		}
+		return match
+	})
 	lenRegex := regexp.MustCompile(`len\(([a-zA-Z_][a-zA-Z0-9_]*)\)`)
 	result := lenRegex.ReplaceAllStringFunc(expression, func(match string) string {
 		arrayName := lenRegex.FindStringSubmatch(match)[1]
-		if _, exists := globalArrays[arrayName]; exists {
-			return arrayName + "_len"
+		if length, ok := r.listLength(arrayName); ok {
+			return length
 		}
-		if currentFunction != nil {
-			for _, param := range currentFunction.Parameters {
-				if param.Name == arrayName && (param.IsList || strings.HasPrefix(param.Type, "list[")) {
-					return arrayName + "_len"
-				}
+		return match
+	})
+	fieldLenRegex := regexp.MustCompile(`len\(([a-zA-Z_]\w*(?:(?:\.|->)[a-zA-Z_]\w*)+)\)`)
+	return fieldLenRegex.ReplaceAllStringFunc(result, func(match string) string {
+		field := strings.ReplaceAll(fieldLenRegex.FindStringSubmatch(match)[1], "->", ".")
+		if expr, err := lexer.ParseExpr(field); err == nil {
+			if _, ok := r.listFieldType(expr); ok {
+				return r.renderExpr(expr) + "_len"
 			}
 		}
-
 		return match
 	})
-	return result
 }
 
-func collectClassInfo(classDecl *lexer.ClassDeclStmt) {
-	collectClassInfoWithModule(classDecl, "")
+func (r *Renderer) collectClassInfo(classDecl *lexer.ClassDeclStmt) {
+	r.collectClassInfoWithModule(classDecl, "")
 }
 
-func collectClassInfoWithModule(classDecl *lexer.ClassDeclStmt, moduleName string) {
+func (r *Renderer) collectClassInfoWithModule(classDecl *lexer.ClassDeclStmt, moduleName string) {
 	className := classDecl.Name
 	if moduleName != "" {
 		className = lexer.GenerateUniqueSymbol(classDecl.Name, moduleName)
 	}
 
 	classInfo := &ClassInfo{
-		Name:    className,
-		Fields:  []FieldInfo{},
-		Methods: []MethodInfo{},
+		Name:        className,
+		Base:        resolveBaseName(classDecl.Base, moduleName),
+		Interfaces:  classDecl.Interfaces,
+		Fields:      []FieldInfo{},
+		Methods:     []MethodInfo{},
+		Constructor: classDecl.Constructor,
 	}
 
 	if classDecl.Constructor != nil {
@@ -379,10 +588,11 @@ func collectClassInfoWithModule(classDecl *lexer.ClassDeclStmt, moduleName strin
 				if after, ok := strings.CutPrefix(fieldType, "ref "); ok {
 					fieldType = after
 				}
+				_, isObject := r.countedClass(fieldType)
 				fieldInfo := FieldInfo{
 					Name:  param.Name,
-					Type:  mapTypeToCType(fieldType),
-					IsRef: param.IsRef,
+					Type:  r.mapTypeToCType(fieldType),
+					IsRef: param.IsRef || isObject,
 				}
 				classInfo.Fields = append(classInfo.Fields, fieldInfo)
 				fieldMap[param.Name] = true
@@ -415,7 +625,7 @@ func collectClassInfoWithModule(classDecl *lexer.ClassDeclStmt, moduleName strin
 					if isRef {
 						fieldType = strings.TrimPrefix(fieldType, "ref ")
 					}
-					fmt.Printf("Debug: Field %s, Value %s, Inferred Type: %s, IsRef: %v\n", fieldName, stmt.VarAssign.Value, fieldType, isRef)
+					logging.Tracef("Field %s, Value %s, Inferred Type: %s, IsRef: %v", fieldName, stmt.VarAssign.Value, fieldType, isRef)
 					fieldInfo := FieldInfo{
 						Name:  fieldName,
 						Type:  fieldType,
@@ -425,31 +635,33 @@ func collectClassInfoWithModule(classDecl *lexer.ClassDeclStmt, moduleName strin
 					fieldMap[fieldName] = true
 				}
 			}
+			if listName, elemType, ok := listField(stmt); ok {
+				fieldName := strings.TrimPrefix(listName, "this.")
+				if _, exists := fieldMap[fieldName]; !exists {
+					classInfo.Fields = append(classInfo.Fields, FieldInfo{
+						Name: fieldName,
+						Type: "list[" + elemType + "]",
+					})
+					fieldMap[fieldName] = true
+				}
+			}
 			if stmt.MapDecl != nil && strings.HasPrefix(stmt.MapDecl.Name, "this.") {
 				fieldName := strings.TrimPrefix(stmt.MapDecl.Name, "this.")
 				if _, exists := fieldMap[fieldName]; !exists {
-					// For map fields, we need to store key/value arrays and size
-					keyFieldInfo := FieldInfo{
-						Name:  fieldName + "_keys",
-						Type:  stmt.MapDecl.KeyType,
-						IsRef: false,
-					}
-					valueFieldInfo := FieldInfo{
-						Name:  fieldName + "_values",
-						Type:  stmt.MapDecl.ValueType,
-						IsRef: false,
-					}
-					capacityFieldInfo := FieldInfo{
-						Name:  fieldName + "_capacity",
-						Type:  "int",
-						IsRef: false,
-					}
-					sizeFieldInfo := FieldInfo{
-						Name:  fieldName + "_size",
-						Type:  "int",
-						IsRef: false,
-					}
-					classInfo.Fields = append(classInfo.Fields, keyFieldInfo, valueFieldInfo, capacityFieldInfo, sizeFieldInfo)
+					classInfo.Fields = append(classInfo.Fields, FieldInfo{
+						Name: fieldName,
+						Type: mapTypeName(stmt.MapDecl.KeyType, stmt.MapDecl.ValueType),
+					})
+					fieldMap[fieldName] = true
+				}
+			}
+			if stmt.SetDecl != nil && strings.HasPrefix(stmt.SetDecl.Name, "this.") {
+				fieldName := strings.TrimPrefix(stmt.SetDecl.Name, "this.")
+				if _, exists := fieldMap[fieldName]; !exists {
+					classInfo.Fields = append(classInfo.Fields, FieldInfo{
+						Name: fieldName,
+						Type: setTypeName(stmt.SetDecl.ElemType),
+					})
 					fieldMap[fieldName] = true
 				}
 			}
@@ -468,14 +680,14 @@ func collectClassInfoWithModule(classDecl *lexer.ClassDeclStmt, moduleName strin
 		classInfo.Methods = append(classInfo.Methods, methodInfo)
 	}
 
-	globalClasses[className] = classInfo
+	r.globalClasses[className] = classInfo
 }
 
 func isFunctionCall(value string) bool {
 	return strings.Contains(value, "(") && strings.Contains(value, ")")
 }
 
-func resolveFunctionCall(value string) string {
+func (r *Renderer) resolveFunctionCall(value string) string {
 	if !isFunctionCall(value) {
 		return value
 	}
@@ -485,94 +697,10 @@ func resolveFunctionCall(value string) string {
 	}
 	funcName := strings.TrimSpace(value[:parenIndex])
 	argsWithParens := value[parenIndex:]
-	resolvedFuncName := lexer.ResolveSymbol(funcName, currentModule)
-	if functionReturnsString(resolvedFuncName) {
-		tempBufferName := fmt.Sprintf("temp_str_buffer_%d", len(value)*31%1000) // Simple hash for uniqueness
-
-		args := argsWithParens[1 : len(argsWithParens)-1] // Remove parentheses
-		if strings.TrimSpace(args) == "" {
-			return fmt.Sprintf("({ char %s[256]; %s(%s); %s; })", tempBufferName, resolvedFuncName, tempBufferName, tempBufferName)
-		} else {
-			return fmt.Sprintf("({ char %s[256]; %s(%s, %s); %s; })", tempBufferName, resolvedFuncName, tempBufferName, args, tempBufferName)
-		}
-	}
-
+	resolvedFuncName := lexer.ResolveSymbol(funcName, r.currentModule)
 	return resolvedFuncName + argsWithParens
 }
 
-func processMethodArguments(args string) string {
-	if strings.TrimSpace(args) == "" {
-		return args
-	}
-	var processedArgs []string
-	var currentArg strings.Builder
-	parenDepth := 0
-	inQuotes := false
-
-	for i, char := range args {
-		switch char {
-		case '"':
-			if i == 0 || args[i-1] != '\\' {
-				inQuotes = !inQuotes
-			}
-			currentArg.WriteRune(char)
-		case '(':
-			if !inQuotes {
-				parenDepth++
-			}
-			currentArg.WriteRune(char)
-		case ')':
-			if !inQuotes {
-				parenDepth--
-			}
-			currentArg.WriteRune(char)
-		case ',':
-			if parenDepth == 0 && !inQuotes {
-				arg := strings.TrimSpace(currentArg.String())
-				processedArgs = append(processedArgs, processStringFunctionArg(arg))
-				currentArg.Reset()
-			} else {
-				currentArg.WriteRune(char)
-			}
-		default:
-			currentArg.WriteRune(char)
-		}
-	}
-	if currentArg.Len() > 0 {
-		arg := strings.TrimSpace(currentArg.String())
-		processedArgs = append(processedArgs, processStringFunctionArg(arg))
-	}
-
-	return strings.Join(processedArgs, ", ")
-}
-
-func processStringFunctionArg(arg string) string {
-	fmt.Printf("Debug: processStringFunctionArg called with: '%s'\n", arg)
-	if isFunctionCall(arg) {
-		parenIndex := strings.Index(arg, "(")
-		if parenIndex == -1 {
-			return arg
-		}
-		funcName := strings.TrimSpace(arg[:parenIndex])
-		resolvedFuncName := lexer.ResolveSymbol(funcName, currentModule)
-
-		fmt.Printf("Debug: Function call detected - funcName: '%s', resolvedFuncName: '%s'\n", funcName, resolvedFuncName)
-
-		if functionReturnsString(resolvedFuncName) {
-			fmt.Printf("Debug: Function returns string, transforming...\n")
-			argsStr := arg[parenIndex+1 : len(arg)-1]
-			tempBufferName := fmt.Sprintf("temp_str_buffer_%d", len(arg)*31%1000)
-			if strings.TrimSpace(argsStr) == "" {
-				return fmt.Sprintf("({ char %s[256]; %s(%s); %s; })", tempBufferName, resolvedFuncName, tempBufferName, tempBufferName)
-			} else {
-				return fmt.Sprintf("({ char %s[256]; %s(%s, %s); %s; })", tempBufferName, resolvedFuncName, tempBufferName, argsStr, tempBufferName)
-			}
-		}
-	}
-
-	return arg
-}
-
 func inferTypeFromValue(value string) string {
 	if strings.HasPrefix(value, "\"") && strings.HasSuffix(value, "\"") {
 		return "string"
@@ -595,13 +723,12 @@ func inferTypeFromValue(value string) string {
 	return "i32"
 }
 
-func generateStructDefinition(b *strings.Builder, classInfo *ClassInfo, structName string) {
+func (r *Renderer) generateStructDefinition(b *strings.Builder, classInfo *ClassInfo, structName string) {
 	fmt.Fprintf(b, "#define MAX_STRING_LENGTH 256\n")
-	fmt.Fprintf(b, "#define MAX_MAP_SIZE 100\n")
 
 	hasSelfReference := false
 	for _, field := range classInfo.Fields {
-		if field.Type == structName && field.IsRef {
+		if field.Type == structName && field.IsRef || field.Type == structName+"?" {
 			hasSelfReference = true
 			break
 		}
@@ -612,78 +739,78 @@ func generateStructDefinition(b *strings.Builder, classInfo *ClassInfo, structNa
 	}
 
 	fmt.Fprintf(b, "typedef struct %s {\n", structName)
+	r.writeStructFields(b, classInfo, "    ")
+	fmt.Fprintf(b, "} %s;\n", structName)
+}
 
+// Writes the members of a class struct, starting with its embedded base.
+func (r *Renderer) writeStructFields(b *strings.Builder, classInfo *ClassInfo, indent string) {
+	if base, exists := r.globalClasses[classInfo.Base]; exists {
+		fmt.Fprintf(b, "%sunion {\n", indent)
+		fmt.Fprintf(b, "%s    %s base_%s;\n", indent, base.Name, base.Name)
+		fmt.Fprintf(b, "%s    struct {\n", indent)
+		r.writeStructFields(b, base, indent+"        ")
+		fmt.Fprintf(b, "%s    };\n", indent)
+		fmt.Fprintf(b, "%s};\n", indent)
+	}
 	for _, field := range classInfo.Fields {
-		if strings.HasSuffix(field.Name, "_keys") {
-			if field.Type == "string" {
-				fmt.Fprintf(b, "    char %s[MAX_MAP_SIZE][MAX_STRING_LENGTH];\n", field.Name)
-			} else {
-				cType := mapTypeToCType(field.Type)
-				fmt.Fprintf(b, "    %s %s[MAX_MAP_SIZE];\n", cType, field.Name)
-			}
-		} else if strings.HasSuffix(field.Name, "_values") {
-			if field.Type == "string" {
-				fmt.Fprintf(b, "    char %s[MAX_MAP_SIZE][MAX_STRING_LENGTH];\n", field.Name)
-			} else {
-				cType := mapTypeToCType(field.Type)
-				fmt.Fprintf(b, "    %s %s[MAX_MAP_SIZE];\n", cType, field.Name)
-			}
-		} else if strings.HasSuffix(field.Name, "_size") || strings.HasSuffix(field.Name, "_capacity") {
-			fmt.Fprintf(b, "    int %s;\n", field.Name)
+		_, isMap := parseMapType(field.Type)
+		if _, isSet := parseSetType(field.Type); isMap || isSet {
+			fmt.Fprintf(b, "%s__scar_map %s;\n", indent, field.Name)
+		} else if elemType, isList := nestedListType(field.Type); isList {
+			r.writeListField(b, indent, elemType, field.Name)
 		} else if field.IsRef {
 			switch field.Type {
 			case "int", "float", "double", "bool", "char":
-				fmt.Fprintf(b, "    %s* %s;\n", mapTypeToCType(field.Type), field.Name)
+				fmt.Fprintf(b, "%s%s* %s;\n", indent, r.mapTypeToCType(field.Type), field.Name)
 			case "string":
-				fmt.Fprintf(b, "    char* %s;\n", field.Name)
+				fmt.Fprintf(b, "%schar* %s;\n", indent, field.Name)
 			default:
 				// For custom types, use the type name directly (without 'struct')
 				// since we have a forward declaration with 'typedef struct X X;'
-				fmt.Fprintf(b, "    %s* %s;\n", field.Type, field.Name)
+				fmt.Fprintf(b, "%s%s* %s;\n", indent, field.Type, field.Name)
 			}
 		} else if field.Type == "string" {
-			fmt.Fprintf(b, "    char %s[MAX_STRING_LENGTH];\n", field.Name)
+			fmt.Fprintf(b, "%schar %s[MAX_STRING_LENGTH];\n", indent, field.Name)
 		} else {
-			cType := mapTypeToCType(field.Type)
-			fmt.Fprintf(b, "    %s %s;\n", cType, field.Name)
+			cType := r.mapTypeToCType(field.Type)
+			fmt.Fprintf(b, "%s%s %s;\n", indent, cType, field.Name)
 		}
 	}
-	fmt.Fprintf(b, "} %s;\n", structName)
 }
 
-func generateClassImplementation(b *strings.Builder, classDecl *lexer.ClassDeclStmt, moduleName string, program *lexer.Program) {
+func (r *Renderer) generateClassImplementation(b *strings.Builder, classDecl *lexer.ClassDeclStmt, moduleName string, program *lexer.Program) {
 	className := classDecl.Name
 	if moduleName != "" {
 		className = lexer.GenerateUniqueSymbol(classDecl.Name, moduleName)
 	}
 
-	currentClassName = className
-	defer func() { currentClassName = "" }()
+	r.currentClassName = className
+	defer func() { r.currentClassName = "" }()
 
-	if classDecl.Constructor != nil && len(classDecl.Constructor.Parameters) > 0 {
+	constructor := r.findConstructor(className, program)
+	if constructor != nil && len(constructor.Parameters) > 0 {
 		fmt.Fprintf(b, "%s* %s_new(", className, className)
-		for i, param := range classDecl.Constructor.Parameters {
+		for i, param := range constructor.Parameters {
 			if i > 0 {
 				b.WriteString(", ")
 			}
-			paramType := mapTypeToCType(param.Type)
-			if param.Type == "string" {
-				paramType = "char*"
-			}
-			fmt.Fprintf(b, "%s %s", paramType, param.Name)
+			fmt.Fprintf(b, "%s %s", r.constructorParamType(param), param.Name)
 		}
 		b.WriteString(") {\n")
 	} else {
 		fmt.Fprintf(b, "%s* %s_new() {\n", className, className)
 	}
 
-	fmt.Fprintf(b, "    %s* this = malloc(sizeof(%s));\n", className, className)
+	r.enterContext(b, classDecl.Name+".init")
+	fmt.Fprintf(b, "    %s* this = %s;\n", className, r.allocObject(className))
 
-	if classInfo, exists := globalClasses[className]; exists {
+	if classInfo, exists := r.globalClasses[className]; exists {
+		if classInfo.Base != "" {
+			r.initDefaultBase(b, classDecl, classInfo.Base, program)
+		}
 		for _, field := range classInfo.Fields {
-			if strings.HasSuffix(field.Name, "_size") || strings.HasSuffix(field.Name, "_capacity") {
-				fmt.Fprintf(b, "    this->%s = 0;\n", field.Name)
-			} else if strings.HasPrefix(field.Type, "ref ") {
+			if strings.HasPrefix(field.Type, "ref ") {
 				fmt.Fprintf(b, "    this->%s = NULL;\n", field.Name)
 			} else {
 				switch field.Type {
@@ -692,13 +819,12 @@ func generateClassImplementation(b *strings.Builder, classDecl *lexer.ClassDeclS
 				case "float", "double":
 					fmt.Fprintf(b, "    this->%s = 0.0;\n", field.Name)
 				case "string":
-					if !strings.HasSuffix(field.Name, "_keys") && !strings.HasSuffix(field.Name, "_values") {
-						fmt.Fprintf(b, "    this->%s[0] = '\\0';\n", field.Name)
-					}
+					fmt.Fprintf(b, "    this->%s[0] = '\\0';\n", field.Name)
 				case "bool":
-					// Skip initialization for array fields like grid_values
-					if !strings.HasSuffix(field.Name, "_values") {
-						fmt.Fprintf(b, "    this->%s = 0;\n", field.Name)
+					fmt.Fprintf(b, "    this->%s = 0;\n", field.Name)
+				default:
+					if r.isStructType(field.Type) {
+						fmt.Fprintf(b, "    this->%s = (%s){0};\n", field.Name, field.Type)
 					}
 				}
 			}
@@ -706,61 +832,39 @@ func generateClassImplementation(b *strings.Builder, classDecl *lexer.ClassDeclS
 	}
 
 	if classDecl.Constructor != nil {
-		if classInfo, exists := globalClasses[className]; exists {
-			for _, param := range classDecl.Constructor.Parameters {
-				for _, field := range classInfo.Fields {
-					if field.Name == param.Name {
-						if strings.HasPrefix(field.Type, "ref ") {
-							fmt.Fprintf(b, "    this->%s = %s;\n", param.Name, param.Name)
-						} else if param.Type == "string" {
-							fmt.Fprintf(b, "    strcpy(this->%s, %s);\n", param.Name, param.Name)
-						} else {
-							fmt.Fprintf(b, "    this->%s = %s;\n", param.Name, param.Name)
-						}
-						break
-					}
+		for _, param := range classDecl.Constructor.Parameters {
+			if field, exists := r.findField(className, param.Name); exists {
+				if _, isObject := r.countedClass(field.Type); isObject || strings.HasPrefix(field.Type, "ref ") {
+					fmt.Fprintf(b, "    this->%s = %s;\n", param.Name, r.retainValue(param.Name, param.Name))
+				} else if field.Type == "string" {
+					fmt.Fprintf(b, "    strcpy(this->%s, %s);\n", param.Name, param.Name)
+				} else {
+					fmt.Fprintf(b, "    this->%s = %s;\n", param.Name, param.Name)
 				}
 			}
 		}
 
 		for _, stmt := range classDecl.Constructor.Fields {
+			if args, ok := superCall(stmt); ok {
+				if base := r.globalClasses[className].Base; base != "" {
+					r.initBase(b, "    ", base, args)
+				}
+				continue
+			}
 			switch {
 			case stmt.MapDecl != nil && strings.HasPrefix(stmt.MapDecl.Name, "this."):
-				fieldName := strings.TrimPrefix(stmt.MapDecl.Name, "this.")
-				mapSize := len(stmt.MapDecl.Pairs)
-
-				// Set initial capacity - use a reasonable default for empty maps
-				initialCapacity := 10
-				if mapSize > 0 {
-					initialCapacity = mapSize * 2 // Allow for growth
-				}
-
-				fmt.Fprintf(b, "    this->%s_size = %d;\n", fieldName, mapSize)
-				fmt.Fprintf(b, "    this->%s_capacity = %d;\n", fieldName, initialCapacity)
-
-				// Initialize map pairs
-				for i, pair := range stmt.MapDecl.Pairs {
-					key := pair.Key
-					value := pair.Value
-
-					if stmt.MapDecl.KeyType == "string" {
-						if !strings.HasPrefix(key, "\"") && !strings.HasSuffix(key, "\"") {
-							key = fmt.Sprintf("\"%s\"", key)
-						}
-						fmt.Fprintf(b, "    strcpy(this->%s_keys[%d], %s);\n", fieldName, i, key)
-					} else {
-						fmt.Fprintf(b, "    this->%s_keys[%d] = %s;\n", fieldName, i, key)
-					}
-
-					if stmt.MapDecl.ValueType == "string" {
-						if !strings.HasPrefix(value, "\"") && !strings.HasSuffix(value, "\"") {
-							value = fmt.Sprintf("\"%s\"", value)
-						}
-						fmt.Fprintf(b, "    strcpy(this->%s_values[%d], %s);\n", fieldName, i, value)
-					} else {
-						fmt.Fprintf(b, "    this->%s_values[%d] = %s;\n", fieldName, i, value)
-					}
-				}
+				r.initMapField(b, "    ", stmt.MapDecl)
+			case stmt.SetDecl != nil && strings.HasPrefix(stmt.SetDecl.Name, "this."):
+				r.initSetField(b, "    ", stmt.SetDecl)
+			case stmt.ListDecl != nil && strings.HasPrefix(stmt.ListDecl.Name, "this."):
+				r.initListField(b, "    ", stmt.ListDecl)
+			case stmt.ListDeclFunctionCall != nil && strings.HasPrefix(stmt.ListDeclFunctionCall.Name, "this."):
+				r.initListFieldCall(b, "    ", stmt.ListDeclFunctionCall)
+			case stmt.VarDecl != nil && lexer.IsOptionalType(stmt.VarDecl.Type):
+				r.declareOptional(b, "    ", stmt.VarDecl.Name, stmt.VarDecl.Type, stmt.VarDecl.Value)
+			case stmt.VarDecl != nil && r.isStructType(stmt.VarDecl.Type):
+				fieldName := strings.TrimPrefix(stmt.VarDecl.Name, "this.")
+				fmt.Fprintf(b, "    this->%s = %s;\n", fieldName, r.convertThisReferencesGranular(stmt.VarDecl.Value))
 
 			case stmt.VarDecl != nil:
 				fieldName := stmt.VarDecl.Name
@@ -781,17 +885,16 @@ func generateClassImplementation(b *strings.Builder, classDecl *lexer.ClassDeclS
 				} else if stmt.VarDecl.Type == "string" {
 					isStringField := stmt.VarDecl.Type == "string"
 
-					fmt.Printf("Debug: VarDecl field %s, value %s, isStringField %v\n", fieldName, value, isStringField)
+					logging.Tracef("VarDecl field %s, value %s, isStringField %v", fieldName, value, isStringField)
 
 					if isStringField {
-						if !strings.HasPrefix(value, "\"") && !strings.HasSuffix(value, "\"") && isValidIdentifier(value) {
+						if stmt.VarDecl.Quoted || !strings.HasPrefix(value, "\"") && !strings.HasSuffix(value, "\"") && isValidIdentifier(value) && !isCtorParam(classDecl, value) {
 							value = fmt.Sprintf("\"%s\"", value)
 						}
 						fmt.Fprintf(b, "    strcpy(this->%s, %s);\n", fieldName, value)
 					}
 				} else {
-					value = strings.ReplaceAll(value, "this.", "this->")
-					fmt.Fprintf(b, "    this->%s = %s;\n", fieldName, value)
+					fmt.Fprintf(b, "    this->%s = %s;\n", fieldName, r.convertThisReferencesGranular(value))
 				}
 
 			case stmt.VarAssign != nil:
@@ -801,20 +904,16 @@ func generateClassImplementation(b *strings.Builder, classDecl *lexer.ClassDeclS
 				if fieldName == "this" {
 					continue
 				}
+				if list, ok := listLiteral(value); ok && r.assignList(b, "    ", fieldName, list, stmt.Line) {
+					continue
+				}
 
 				fieldName = strings.TrimPrefix(fieldName, "this.")
 
-				isStringField := false
-				if classInfo, exists := globalClasses[className]; exists {
-					for _, field := range classInfo.Fields {
-						if field.Name == fieldName && field.Type == "string" {
-							isStringField = true
-							break
-						}
-					}
-				}
+				field, exists := r.findField(className, fieldName)
+				isStringField := exists && field.Type == "string"
 
-				fmt.Printf("Debug: VarAssign field %s, value %s, isStringField %v\n", fieldName, value, isStringField)
+				logging.Tracef("VarAssign field %s, value %s, isStringField %v", fieldName, value, isStringField)
 
 				if isStringField {
 					if !strings.HasPrefix(value, "\"") && !strings.HasSuffix(value, "\"") && isValidIdentifier(value) {
@@ -826,187 +925,74 @@ func generateClassImplementation(b *strings.Builder, classDecl *lexer.ClassDeclS
 					fmt.Fprintf(b, "    this->%s = %s;\n", fieldName, value)
 				}
 
-			case stmt.Print != nil:
+			case stmt.Print != nil && len(stmt.Print.Segments) == 0:
 				if stmt.Print.Format != "" && len(stmt.Print.Variables) > 0 {
 					args := make([]string, len(stmt.Print.Variables))
 					for i, v := range stmt.Print.Variables {
 						v = strings.ReplaceAll(v, "this.", "this->")
 						args[i] = v
 					}
-					fmt.Fprintf(b, "    printf(\"%s\\n\", %s);\n",
-						strings.ReplaceAll(stmt.Print.Format, "\"", "\\\""),
-						strings.Join(args, ", "))
-				} else if stmt.Print.Print != "" {
-					fmt.Fprintf(b, "    printf(\"%s\\n\");\n", stmt.Print.Print)
+					fmt.Fprintf(b, "    %s\"%s\\n\", %s);\n", printCall(stmt.Print.Stderr), cStringBody(stmt.Print.Format), strings.Join(args, ", "))
+				} else {
+					writeText(b, "    ", stmt.Print.Print, "\\n", stmt.Print.Stderr)
 				}
 			default:
-				renderStatements(b, []*lexer.Statement{stmt}, "    ", className, program, "")
+				r.renderStatements(b, []*lexer.Statement{stmt}, "    ", className, program, "")
 			}
 		}
 	}
 
+	r.endFunctionScope(b, nil)
 	b.WriteString("    return this;\n}\n\n")
-
-	// Generate instance map access helper functions after constructor
-	if classDecl.Constructor != nil {
-		for _, stmt := range classDecl.Constructor.Fields {
-			if stmt.MapDecl != nil && strings.HasPrefix(stmt.MapDecl.Name, "this.") {
-				fieldName := strings.TrimPrefix(stmt.MapDecl.Name, "this.")
-				generateInstanceMapAccessHelper(b, className, fieldName, stmt.MapDecl.KeyType, stmt.MapDecl.ValueType)
-				generateInstanceMapPutHelper(b, className, fieldName, stmt.MapDecl.KeyType, stmt.MapDecl.ValueType)
-			}
-		}
-	}
-
-	for _, method := range classDecl.Methods {
-		returnType := "void"
-		if method.ReturnType != "" && method.ReturnType != "void" {
-			returnType = mapTypeToCType(method.ReturnType)
-		}
-		prototype := generateMethodPrototype(className, method.Name, returnType, method.Parameters)
-		b.WriteString(prototype)
-		b.WriteString(";\n")
-	}
-	b.WriteString("\n")
+	r.generateFree(b, classDecl, className, program)
 
 	for _, method := range classDecl.Methods {
-		returnType := "void"
-		if method.ReturnType != "" && method.ReturnType != "void" {
-			returnType = mapTypeToCType(method.ReturnType)
-		}
-
-		fmt.Fprintf(b, "%s %s_%s(%s* this", returnType, className, method.Name, className)
+		fmt.Fprintf(b, "%s %s_%s(%s* this", r.methodReturnType(method.ReturnType), className, method.Name, className)
 
 		for _, param := range method.Parameters {
-			paramType := mapTypeToCType(param.Type)
-			if _, isPrimitive := primitiveTypes[param.Type]; !isPrimitive && param.Type != "string" {
-				paramType = paramType + "*"
-			} else if param.Type == "string" {
-				paramType = "char*"
-			}
-			fmt.Fprintf(b, ", %s %s", paramType, param.Name)
+			fmt.Fprintf(b, ", %s %s", r.methodParamType(param), param.Name)
 		}
 
 		b.WriteString(") {\n")
-		renderStatements(b, method.Body, "    ", className, program, method.ReturnType)
+		r.enterContext(b, classDecl.Name+"."+method.Name)
+		r.declareParamTypes(method.Parameters)
+		r.renderStatements(b, method.Body, "    ", className, program, method.ReturnType)
+		r.endFunctionScope(b, method.Body)
 		b.WriteString("}\n\n")
 	}
 }
 
-func generateInstanceMapAccessHelper(b *strings.Builder, className, fieldName, keyType, valueType string) {
-	cKeyType := mapTypeToCType(keyType)
-	if keyType == "string" {
-		cKeyType = "char*"
-	}
-
-	cValueType := mapTypeToCType(valueType)
-	if valueType == "string" {
-		cValueType = "char*"
-	}
-
-	helperName := fmt.Sprintf("%s_get_%s_value", className, fieldName)
-
-	fmt.Fprintf(b, "%s %s(%s* this, %s key) {\n", cValueType, helperName, className, cKeyType)
-	fmt.Fprintf(b, "    for (int i = 0; i < this->%s_size; i++) {\n", fieldName)
-
-	if keyType == "string" {
-		fmt.Fprintf(b, "        if (strcmp(this->%s_keys[i], key) == 0) {\n", fieldName)
-	} else {
-		fmt.Fprintf(b, "        if (this->%s_keys[i] == key) {\n", fieldName)
-	}
-
-	if valueType == "string" {
-		fmt.Fprintf(b, "            return this->%s_values[i];\n", fieldName)
-	} else {
-		fmt.Fprintf(b, "            return this->%s_values[i];\n", fieldName)
-	}
-	fmt.Fprintf(b, "        }\n")
-	fmt.Fprintf(b, "    }\n")
-
-	// Default return value
-	switch valueType {
-	case "string":
-		fmt.Fprintf(b, "    return \"\";\n")
-	case "char":
-		fmt.Fprintf(b, "    return '\\0';\n")
-	default:
-		fmt.Fprintf(b, "    return 0;\n")
-	}
-
-	fmt.Fprintf(b, "}\n\n")
+func (r *Renderer) functionReturnsString(funcName string) bool {
+	return r.functionReturnType(funcName) == "string"
 }
 
-// New helper function for instance map put:
-func generateInstanceMapPutHelper(b *strings.Builder, className, fieldName, keyType, valueType string) {
-	cKeyType := mapTypeToCType(keyType)
-	if keyType == "string" {
-		cKeyType = "char*"
-	}
-
-	cValueType := mapTypeToCType(valueType)
-	if valueType == "string" {
-		cValueType = "char*"
-	}
-
-	helperName := fmt.Sprintf("%s_put_%s_value", className, fieldName)
-
-	fmt.Fprintf(b, "void %s(%s* this, %s key, %s value) {\n", helperName, className, cKeyType, cValueType)
-	fmt.Fprintf(b, "    int found = 0;\n")
-	fmt.Fprintf(b, "    for (int i = 0; i < this->%s_size; i++) {\n", fieldName)
-
-	if keyType == "string" {
-		fmt.Fprintf(b, "        if (strcmp(this->%s_keys[i], key) == 0) {\n", fieldName)
-	} else {
-		fmt.Fprintf(b, "        if (this->%s_keys[i] == key) {\n", fieldName)
-	}
-
-	if valueType == "string" {
-		fmt.Fprintf(b, "            strcpy(this->%s_values[i], value);\n", fieldName)
-	} else {
-		fmt.Fprintf(b, "            this->%s_values[i] = value;\n", fieldName)
-	}
-	fmt.Fprintf(b, "            found = 1;\n")
-	fmt.Fprintf(b, "            break;\n")
-	fmt.Fprintf(b, "        }\n")
-	fmt.Fprintf(b, "    }\n")
-
-	fmt.Fprintf(b, "    if (!found && this->%s_size < MAX_MAP_SIZE) {\n", fieldName)
-
-	if keyType == "string" {
-		fmt.Fprintf(b, "        strcpy(this->%s_keys[this->%s_size], key);\n", fieldName, fieldName)
-	} else {
-		fmt.Fprintf(b, "        this->%s_keys[this->%s_size] = key;\n", fieldName, fieldName)
-	}
-
-	if valueType == "string" {
-		fmt.Fprintf(b, "        strcpy(this->%s_values[this->%s_size], value);\n", fieldName, fieldName)
-	} else {
-		fmt.Fprintf(b, "        this->%s_values[this->%s_size] = value;\n", fieldName, fieldName)
+// Returns the declared return type of a function of the program or of a
+// loaded module, or an empty string if there is no such function. Extern
+// functions returning strings return a char*.
+func (r *Renderer) functionReturnType(funcName string) string {
+	if extern, exists := r.externFunctions[funcName]; exists {
+		if extern.ReturnType == "string" {
+			return "char*"
+		}
+		return extern.ReturnType
 	}
-
-	fmt.Fprintf(b, "        this->%s_size++;\n", fieldName)
-	fmt.Fprintf(b, "    }\n")
-	fmt.Fprintf(b, "}\n\n")
-}
-
-func functionReturnsString(funcName string) bool {
-	if funcDecl, exists := globalFunctions[funcName]; exists {
-		return funcDecl.ReturnType == "string"
+	if funcDecl, exists := r.globalFunctions[funcName]; exists {
+		return funcDecl.ReturnType
 	}
-	for _, module := range lexer.LoadedModules {
+	for _, module := range lexer.SortedModules() {
 		if funcDecl, exists := module.PublicFuncs[funcName]; exists {
-			return funcDecl.ReturnType == "string"
+			return funcDecl.ReturnType
 		}
 	}
-	return false
+	return ""
 }
 
-func functionReturnsList(funcName string) (bool, string) {
+func (r *Renderer) functionReturnsList(funcName string) (bool, string) {
 	var returnType string
-	if funcDecl, exists := globalFunctions[funcName]; exists {
+	if funcDecl, exists := r.globalFunctions[funcName]; exists {
 		returnType = funcDecl.ReturnType
 	} else {
-		for _, module := range lexer.LoadedModules {
+		for _, module := range lexer.SortedModules() {
 			if funcDecl, exists := module.PublicFuncs[funcName]; exists {
 				returnType = funcDecl.ReturnType
 				break
@@ -1021,6 +1007,33 @@ func functionReturnsList(funcName string) (bool, string) {
 	return false, ""
 }
 
+// Returns the C arguments of a call to funcDecl, which may be nil for a
+// function that is not known, passing lists along with their lengths.
+func (r *Renderer) renderCallArgs(funcDecl *lexer.TopLevelFuncDeclStmt, rawArgs []string) []string {
+	args := make([]string, 0, len(rawArgs))
+	for i, arg := range rawArgs {
+		if list, ok := listLiteral(arg); ok && funcDecl != nil && i < len(funcDecl.Parameters) && isFlatListParam(funcDecl.Parameters[i]) {
+			items, n := r.renderListLiteral(listParamElemType(funcDecl.Parameters[i]), list)
+			args = append(args, items, n)
+			continue
+		}
+		resolvedArg := lexer.ResolveSymbol(arg, r.currentModule)
+		if formatted, ok := r.interpolatedLiteral(arg); ok {
+			resolvedArg = formatted
+		}
+		if funcDecl != nil && i < len(funcDecl.Parameters) {
+			if elemType, ok := optionalElemType(funcDecl.Parameters[i].Type); ok {
+				resolvedArg = r.optionalValue(elemType, arg)
+			}
+		}
+		args = append(args, resolvedArg)
+		if _, ok := r.listLength(arg); ok {
+			args = append(args, r.listLengthArgs(arg, resolvedArg)...)
+		}
+	}
+	return args
+}
+
 func parseFunctionCall(funcCall string) (string, []string) {
 	parenIndex := strings.Index(funcCall, "(")
 	if parenIndex == -1 {
@@ -1032,44 +1045,46 @@ func parseFunctionCall(funcCall string) (string, []string) {
 
 	var args []string
 	if strings.TrimSpace(argsStr) != "" {
-		args = strings.Split(argsStr, ",")
-		for i := range args {
-			args[i] = strings.TrimSpace(args[i])
-		}
+		args = lexer.SplitArguments(argsStr)
 	}
 
 	return funcName, args
 }
 
-func renderStatements(b *strings.Builder, stmts []*lexer.Statement, indent string, className string, program *lexer.Program, currentFunctionReturnType string) {
+func (r *Renderer) renderStatements(b *strings.Builder, stmts []*lexer.Statement, indent string, className string, program *lexer.Program, currentFunctionReturnType string) {
 	if className != "" {
-		fmt.Printf("Debug: renderStatements - className: '%s'\n", className)
-		currentClassName = className
+		logging.Tracef("renderStatements - className: '%s'", className)
+		r.currentClassName = className
 	}
+	defer r.endBlockScope(b, stmts, indent)
 
 	for _, stmt := range stmts {
+		if r.lineFile != "" && stmt.Line > 0 {
+			fmt.Fprintf(b, "#line %d %q\n", stmt.Line, r.lineFile)
+		}
 		switch {
 		case stmt.Put != nil:
-			if stmt.Put.Format != "" && len(stmt.Put.Variables) > 0 {
+			if len(stmt.Put.Segments) > 0 {
+				r.renderInterpolatedPrint(b, indent, "", stmt.Put.Segments, stmt.Put.Variables, stmt.Put.Stderr, program)
+			} else if stmt.Put.Format != "" && len(stmt.Put.Variables) > 0 {
 				var (
 					variables = reconstructMethodCalls(stmt.Put.Variables)
 					args      = make([]string, len(variables))
 				)
 				for i, v := range variables {
 					if isMethodCall(v) {
-						args[i] = convertMethodCallToC(v)
+						args[i] = r.convertMethodCallToC(v)
 					} else {
-						resolvedVar := lexer.ResolveSymbol(v, currentModule)
-						resolvedVar = convertThisReferencesGranular(resolvedVar)
-						resolvedVar = resolveLenFunctionCalls(resolvedVar)
+						resolvedVar := lexer.ResolveSymbol(v, r.currentModule)
+						resolvedVar = r.convertThisReferencesGranular(resolvedVar)
+						resolvedVar = r.resolveLenFunctionCalls(resolvedVar)
 						args[i] = resolvedVar
 					}
 				}
 				argsStr := strings.Join(args, ", ")
-				escapedFormat := strings.ReplaceAll(stmt.Put.Format, "\"", "\\\"")
-				fmt.Fprintf(b, "%sprintf(\"%s\", %s);\n", indent, escapedFormat, argsStr)
+				fmt.Fprintf(b, "%s%s\"%s\", %s);\n", indent, printCall(stmt.Put.Stderr), cStringBody(stmt.Put.Format), argsStr)
 			} else if stmt.Put.Put != "" {
-				fmt.Fprintf(b, "%sprintf(\"%s\");\n", indent, stmt.Put.Put)
+				writeText(b, indent, stmt.Put.Put, "", stmt.Put.Stderr)
 			}
 		case stmt.ListDeclFunctionCall != nil:
 			listType := stmt.ListDeclFunctionCall.Type
@@ -1077,6 +1092,13 @@ func renderStatements(b *strings.Builder, stmts []*lexer.Statement, indent strin
 			functionCall := stmt.ListDeclFunctionCall.FunctionCall
 			resolvedCall := strings.ReplaceAll(functionCall, "::", "_")
 
+			if low, high, ok := lexer.ParseRange(functionCall); ok {
+				r.globalArrays[listName] = listType
+				r.declareList(b, indent, listType, listName)
+				r.fillRange(b, indent, listName, low, high)
+				continue
+			}
+
 			// Extract function name and existing arguments
 			openParen := strings.Index(resolvedCall, "(")
 			closeParen := strings.LastIndex(resolvedCall, ")")
@@ -1088,37 +1110,47 @@ func renderStatements(b *strings.Builder, stmts []*lexer.Statement, indent strin
 
 			funcName := resolvedCall[:openParen]
 			existingArgs := strings.TrimSpace(resolvedCall[openParen+1 : closeParen])
+			r.globalArrays[listName] = listType
+
+			if _, userDefined := r.globalFunctions[funcName]; funcName == "args" && !userDefined {
+				funcName = "__scar_args"
+			}
+			if funcName == "map!" || funcName == "filter!" {
+				r.declareList(b, indent, listType, listName)
+				r.transformList(b, indent, funcName, listType, listName, lexer.SplitArguments(existingArgs))
+				continue
+			}
+			if funcName == "grid!" {
+				r.declareList(b, indent, listType, listName)
+				if dims := lexer.SplitArguments(existingArgs); len(dims) == 2 {
+					allocateRows(b, indent, listName, r.convertThisReferencesGranular(dims[0]), r.convertThisReferencesGranular(dims[1]))
+				} else {
+					fmt.Fprintf(b, "%s// Error: grid! expects a row and a column count\n", indent)
+				}
+				continue
+			}
 
 			// Build new function call with target array and size parameters
 			var newCall string
 			if existingArgs == "" {
-				newCall = fmt.Sprintf("%s(%s, 1000)", funcName, listName)
-			} else {
-				newCall = fmt.Sprintf("%s(%s, 1000, %s)", funcName, listName, existingArgs)
-			}
-
-			if listType == "string" {
-				fmt.Fprintf(b, "%schar %s[1000][256];\n", indent, listName)
-				fmt.Fprintf(b, "%sint %s_len;\n", indent, listName)
-				fmt.Fprintf(b, "%s%s_len = %s;\n", indent, listName, newCall)
+				newCall = fmt.Sprintf("%s(%s, %s_cap)", funcName, listName, listName)
 			} else {
-				cType := mapTypeToCType(listType)
-				fmt.Fprintf(b, "%s%s %s[1000];\n", indent, cType, listName)
-				fmt.Fprintf(b, "%sint %s_len;\n", indent, listName)
-				fmt.Fprintf(b, "%s%s_len = %s;\n", indent, listName, newCall)
+				newCall = fmt.Sprintf("%s(%s, %s_cap, %s)", funcName, listName, listName, existingArgs)
 			}
 
-			globalArrays[listName] = listType
+			r.declareList(b, indent, listType, listName)
+			reserveList(b, indent, listName, strconv.Itoa(listReturnCapacity))
+			fmt.Fprintf(b, "%s%s_len = %s;\n", indent, listName, newCall)
 		case stmt.CatList != nil:
 			if stmt.CatList.Target != "" {
-				targetVar := lexer.ResolveSymbol(stmt.CatList.Target, currentModule)
+				targetVar := lexer.ResolveSymbol(stmt.CatList.Target, r.currentModule)
 				listType := "int"
 				firstList := stmt.CatList.Lists[0]
 				if strings.HasPrefix(firstList, "list_of!(") && strings.HasSuffix(firstList, ")") {
 					strings.TrimSpace(firstList[9 : len(firstList)-1])
 					listType = "string"
 				} else {
-					for listName, arrayType := range globalArrays {
+					for listName, arrayType := range r.globalArrays {
 						if listName == firstList {
 							listType = arrayType
 							break
@@ -1126,61 +1158,25 @@ func renderStatements(b *strings.Builder, stmts []*lexer.Statement, indent strin
 					}
 				}
 
-				if listType == "string" {
-					fmt.Fprintf(b, "%schar %s[1000][256]; // Concatenated list\n", indent, targetVar)
-					fmt.Fprintf(b, "%sint %s_len = 0;\n", indent, targetVar)
-				} else {
-					cType := mapTypeToCType(listType)
-					fmt.Fprintf(b, "%s%s %s[1000]; // Concatenated list\n", indent, cType, targetVar)
-					fmt.Fprintf(b, "%sint %s_len = 0;\n", indent, targetVar)
-				}
+				fmt.Fprintf(b, "%s// Concatenated list\n", indent)
+				r.declareList(b, indent, listType, targetVar)
 
 				for _, listName := range stmt.CatList.Lists {
 					if strings.HasPrefix(listName, "list_of!(") && strings.HasSuffix(listName, ")") {
 						value := strings.TrimSpace(listName[9 : len(listName)-1])
-						value = lexer.ResolveSymbol(value, currentModule)
-						value = convertThisReferencesGranular(value)
-
-						if listType == "string" {
-							fmt.Fprintf(b, "%s// Add single element from list_of!(%s)\n", indent, value)
-							fmt.Fprintf(b, "%sif (%s_len < 1000) {\n", indent, targetVar)
-							if strings.HasPrefix(value, "\"") && strings.HasSuffix(value, "\"") {
-								fmt.Fprintf(b, "%s    strcpy(%s[%s_len], %s);\n", indent, targetVar, targetVar, value)
-							} else {
-								fmt.Fprintf(b, "%s    strcpy(%s[%s_len], %s);\n", indent, targetVar, targetVar, value)
-							}
-							fmt.Fprintf(b, "%s    %s_len++;\n", indent, targetVar)
-							fmt.Fprintf(b, "%s}\n", indent)
-						} else {
-							fmt.Fprintf(b, "%s// Add single element from list_of!(%s)\n", indent, value)
-							fmt.Fprintf(b, "%sif (%s_len < 1000) {\n", indent, targetVar)
-							fmt.Fprintf(b, "%s    %s[%s_len] = %s;\n", indent, targetVar, targetVar, value)
-							fmt.Fprintf(b, "%s    %s_len++;\n", indent, targetVar)
-							fmt.Fprintf(b, "%s}\n", indent)
-						}
+						value = lexer.ResolveSymbol(value, r.currentModule)
+						value = r.convertThisReferencesGranular(value)
+
+						fmt.Fprintf(b, "%s// Add single element from list_of!(%s)\n", indent, value)
+						pushList(b, indent, listType, targetVar, value)
 					} else {
-						resolvedListName := lexer.ResolveSymbol(listName, currentModule)
-
-						if listType == "string" {
-							fmt.Fprintf(b, "%s// Copy from %s\n", indent, resolvedListName)
-							fmt.Fprintf(b, "%sfor (int __i = 0; __i < %s_len && %s_len < 1000; __i++) {\n",
-								indent, resolvedListName, targetVar)
-							fmt.Fprintf(b, "%s    strcpy(%s[%s_len], %s[__i]);\n",
-								indent, targetVar, targetVar, resolvedListName)
-							fmt.Fprintf(b, "%s    %s_len++;\n", indent, targetVar)
-							fmt.Fprintf(b, "%s}\n", indent)
-						} else {
-							fmt.Fprintf(b, "%s// Copy from %s\n", indent, resolvedListName)
-							fmt.Fprintf(b, "%sfor (int __i = 0; __i < %s_len && %s_len < 1000; __i++) {\n",
-								indent, resolvedListName, targetVar)
-							fmt.Fprintf(b, "%s    %s[%s_len] = %s[__i];\n",
-								indent, targetVar, targetVar, resolvedListName)
-							fmt.Fprintf(b, "%s    %s_len++;\n", indent, targetVar)
-							fmt.Fprintf(b, "%s}\n", indent)
-						}
+						resolvedListName := lexer.ResolveSymbol(listName, r.currentModule)
+
+						fmt.Fprintf(b, "%s// Copy from %s\n", indent, resolvedListName)
+						extendList(b, indent, listType, targetVar, resolvedListName)
 					}
 				}
-				globalArrays[stmt.CatList.Target] = listType
+				r.globalArrays[stmt.CatList.Target] = listType
 
 			} else {
 				if len(stmt.CatList.Lists) < 2 {
@@ -1188,10 +1184,10 @@ func renderStatements(b *strings.Builder, stmts []*lexer.Statement, indent strin
 					break
 				}
 
-				targetList := lexer.ResolveSymbol(stmt.CatList.Lists[0], currentModule)
+				targetList := lexer.ResolveSymbol(stmt.CatList.Lists[0], r.currentModule)
 				listType := "int"
 
-				for listName, arrayType := range globalArrays {
+				for listName, arrayType := range r.globalArrays {
 					if listName == stmt.CatList.Lists[0] {
 						listType = arrayType
 						break
@@ -1202,50 +1198,16 @@ func renderStatements(b *strings.Builder, stmts []*lexer.Statement, indent strin
 					listName := stmt.CatList.Lists[i]
 					if strings.HasPrefix(listName, "list_of!(") && strings.HasSuffix(listName, ")") {
 						value := strings.TrimSpace(listName[9 : len(listName)-1])
-						value = lexer.ResolveSymbol(value, currentModule)
-						value = convertThisReferencesGranular(value)
-
-						if listType == "string" {
-							fmt.Fprintf(b, "%s// Add single element from list_of!(%s)\n", indent, value)
-							fmt.Fprintf(b, "%sif (%s_len < 1000) {\n", indent, targetList)
-							if strings.HasPrefix(value, "\"") && strings.HasSuffix(value, "\"") {
-								fmt.Fprintf(b, "%s    strcpy(%s[%s_len], %s);\n", indent, targetList, targetList, value)
-							} else {
-								fmt.Fprintf(b, "%s    strcpy(%s[%s_len], %s);\n", indent, targetList, targetList, value)
-							}
-							fmt.Fprintf(b, "%s    %s_len++;\n", indent, targetList)
-							fmt.Fprintf(b, "%s}\n", indent)
-						} else {
-							fmt.Fprintf(b, "%s// Add single element from list_of!(%s)\n", indent, value)
-							fmt.Fprintf(b, "%sif (%s_len < 1000) {\n", indent, targetList)
-							fmt.Fprintf(b, "%s    %s[%s_len] = %s;\n", indent, targetList, targetList, value)
-							fmt.Fprintf(b, "%s    %s_len++;\n", indent, targetList)
-							fmt.Fprintf(b, "%s}\n", indent)
-						}
+						value = lexer.ResolveSymbol(value, r.currentModule)
+						value = r.convertThisReferencesGranular(value)
+
+						fmt.Fprintf(b, "%s// Add single element from list_of!(%s)\n", indent, value)
+						pushList(b, indent, listType, targetList, value)
 					} else {
-						sourceList := lexer.ResolveSymbol(listName, currentModule)
-
-						if listType == "string" {
-							fmt.Fprintf(b, "%s// Concatenate %s into %s\n", indent, sourceList, targetList)
-							fmt.Fprintf(b, "%sfor (int __i = 0; __i < %s_len; __i++) {\n",
-								indent, sourceList)
-							fmt.Fprintf(b, "%s    if (%s_len < 1000) {\n", indent, targetList)
-							fmt.Fprintf(b, "%s        strcpy(%s[%s_len], %s[__i]);\n",
-								indent, targetList, targetList, sourceList)
-							fmt.Fprintf(b, "%s        %s_len++;\n", indent, targetList)
-							fmt.Fprintf(b, "%s    }\n", indent)
-							fmt.Fprintf(b, "%s}\n", indent)
-						} else {
-							fmt.Fprintf(b, "%s// Concatenate %s into %s\n", indent, sourceList, targetList)
-							fmt.Fprintf(b, "%sfor (int __i = 0; __i < %s_len; __i++) {\n",
-								indent, sourceList)
-							fmt.Fprintf(b, "%s    if (%s_len < 1000) {\n", indent, targetList)
-							fmt.Fprintf(b, "%s        %s[%s_len] = %s[__i];\n",
-								indent, targetList, targetList, sourceList)
-							fmt.Fprintf(b, "%s        %s_len++;\n", indent, targetList)
-							fmt.Fprintf(b, "%s    }\n", indent)
-							fmt.Fprintf(b, "%s}\n", indent)
-						}
+						sourceList := lexer.ResolveSymbol(listName, r.currentModule)
+
+						fmt.Fprintf(b, "%s// Concatenate %s into %s\n", indent, sourceList, targetList)
+						extendList(b, indent, listType, targetList, sourceList)
 					}
 				}
 			}
@@ -1254,8 +1216,8 @@ func renderStatements(b *strings.Builder, stmts []*lexer.Statement, indent strin
 			if strings.HasPrefix(value, "this.") {
 				value = "this->" + value[5:]
 			} else {
-				value = lexer.ResolveSymbol(value, currentModule)
-				value = convertThisReferencesGranular(value)
+				value = lexer.ResolveSymbol(value, r.currentModule)
+				value = r.convertThisReferencesGranular(value)
 			}
 			tempVar := fmt.Sprintf("_temp_list_%d", len(b.String())%1000)
 			fmt.Fprintf(b, "%schar %s[1][256];\n", indent, tempVar)
@@ -1274,83 +1236,70 @@ func renderStatements(b *strings.Builder, stmts []*lexer.Statement, indent strin
 			if strings.HasPrefix(value, "this.") {
 				value = "this->" + value[5:]
 			} else {
-				value = lexer.ResolveSymbol(value, currentModule)
-				value = convertThisReferencesGranular(value)
+				value = lexer.ResolveSymbol(value, r.currentModule)
+				value = r.convertThisReferencesGranular(value)
 			}
 
-			if listType == "string" {
-				fmt.Fprintf(b, "%schar %s[1000][256];\n", indent, listName)
-				fmt.Fprintf(b, "%sint %s_len = 1;\n", indent, listName)
-				if strings.HasPrefix(value, "\"") && strings.HasSuffix(value, "\"") {
-					fmt.Fprintf(b, "%sstrcpy(%s[0], %s);\n", indent, listName, value)
-				} else {
-					fmt.Fprintf(b, "%sstrcpy(%s[0], %s);\n", indent, listName, value)
-				}
-			} else {
-				cType := mapTypeToCType(listType)
-				fmt.Fprintf(b, "%s%s %s[1000];\n", indent, cType, listName)
-				fmt.Fprintf(b, "%sint %s_len = 1;\n", indent, listName)
-				fmt.Fprintf(b, "%s%s[0] = %s;\n", indent, listName, value)
-			}
+			r.declareList(b, indent, listType, listName)
+			pushList(b, indent, listType, listName, value)
 
-			globalArrays[listName] = listType
+			r.globalArrays[listName] = listType
 		case stmt.Print != nil:
-			if stmt.Print.Format != "" && len(stmt.Print.Variables) > 0 {
+			if len(stmt.Print.Segments) > 0 {
+				r.renderInterpolatedPrint(b, indent, "\\n", stmt.Print.Segments, stmt.Print.Variables, stmt.Print.Stderr, program)
+			} else if stmt.Print.Format != "" && len(stmt.Print.Variables) > 0 {
 				var (
 					variables = reconstructMethodCalls(stmt.Print.Variables)
 					args      = make([]string, len(variables))
 				)
 				for i, v := range variables {
-					if strings.HasPrefix(v, "get!") {
-						getArgs := v[4:]
-						getArgs = strings.TrimSpace(getArgs[1 : len(getArgs)-1])
-						parts := strings.SplitN(getArgs, ",", 2)
-						if len(parts) == 2 {
-							mapName := strings.TrimSpace(parts[0])
-							key := strings.TrimSpace(parts[1])
-							args[i] = renderMapAccess(mapName, key, program)
-						} else {
-							args[i] = v
-						}
-					} else if isMethodCall(v) {
-						args[i] = convertMethodCallToC(v)
-					} else {
-						resolvedVar := lexer.ResolveSymbol(v, currentModule)
-						resolvedVar = convertThisReferencesGranular(resolvedVar)
-						resolvedVar = resolveLenFunctionCalls(resolvedVar)
-						args[i] = resolvedVar
-					}
+					args[i] = r.renderPrintArg(v, program)
 				}
 				argsStr := strings.Join(args, ", ")
-				escapedFormat := strings.ReplaceAll(stmt.Print.Format, "\"", "\\\"")
-				fmt.Fprintf(b, "%sprintf(\"%s\\n\", %s);\n", indent, escapedFormat, argsStr)
-			} else if stmt.Print.Print != "" {
+				fmt.Fprintf(b, "%s%s\"%s\\n\", %s);\n", indent, printCall(stmt.Print.Stderr), cStringBody(stmt.Print.Format), argsStr)
+			} else {
 				printValue := stmt.Print.Print
 				if isMethodCall(printValue) {
-					printValue = convertMethodCallToC(printValue)
+					printValue = r.convertMethodCallToC(printValue)
 				}
 				if strings.Contains(printValue, "get!") {
-					fmt.Fprintf(b, "%sprintf(\"%%s\\n\", %s);\n", indent, printValue)
+					fmt.Fprintf(b, "%s%s\"%%s\\n\", %s);\n", indent, printCall(stmt.Print.Stderr), printValue)
 				} else {
-					fmt.Fprintf(b, "%sprintf(\"%s\\n\");\n", indent, printValue)
+					writeText(b, indent, printValue, "\\n", stmt.Print.Stderr)
 				}
 			}
 
 		case stmt.Sleep != nil:
-			fmt.Fprintf(b, "%ssleep(%s);\n", indent, stmt.Sleep.Duration)
+			r.renderSleep(b, indent, stmt.Sleep)
 		case stmt.Break != nil:
-			fmt.Fprintf(b, "%sbreak;\n", indent)
+			r.renderLoopExit(b, "break", stmt.Break.Target, indent, className, program, currentFunctionReturnType)
 		case stmt.Continue != nil:
-			fmt.Fprintf(b, "%scontinue;\n", indent)
+			r.renderLoopExit(b, "continue", stmt.Continue.Target, indent, className, program, currentFunctionReturnType)
+		case stmt.Spawn != nil:
+			r.renderSpawn(b, indent, stmt.Spawn, stmt.Line)
+
+		case stmt.Join != nil:
+			r.renderJoin(b, indent, stmt.Join)
+		case stmt.Breakpoint != nil:
+			if r.opts.Debug {
+				fmt.Fprintf(b, "%s__scar_breakpoint();\n", indent)
+			}
+
 		case stmt.Run != nil:
 			funcCall := stmt.Run.FunctionCall
 			fmt.Fprintf(b, "%s%s;\n", indent, funcCall)
 
 		case stmt.Return != nil:
 			if stmt.Return.Value == "" {
-				fmt.Fprintf(b, "%sreturn;\n", indent)
+				r.leaveTryFrames(b, len(r.tryFrames), indent, className, program, currentFunctionReturnType)
+				r.renderReturn(b, indent, "", "", currentFunctionReturnType)
 			} else {
-				value := stmt.Return.Value
+				source := stmt.Return.Value
+				// "format" | values returned formatted text before format! did.
+				if call, ok := lexer.PipeFormatCall(source); ok && !lexer.LangVersionAtLeast("0.3") {
+					source = call
+				}
+				value := source
 
 				// Handle list return types
 				if strings.HasPrefix(currentFunctionReturnType, "list[") && strings.HasSuffix(currentFunctionReturnType, "]") {
@@ -1358,88 +1307,87 @@ func renderStatements(b *strings.Builder, stmts []*lexer.Statement, indent strin
 					// and return the length
 					innerType := strings.TrimPrefix(strings.TrimSuffix(currentFunctionReturnType, "]"), "list[")
 
+					// A list literal is copied from a temporary list.
+					copyIndent := indent
+					if list, ok := listLiteral(value); ok {
+						r.openListItems(b, indent, innerType, list)
+						value, copyIndent = "__items", indent+"    "
+					}
 					if innerType == "string" {
 						// For string arrays, copy each string
-						fmt.Fprintf(b, "%sfor (int _i = 0; _i < %s_len && _i < _max_size; _i++) {\n", indent, value)
-						fmt.Fprintf(b, "%s    strcpy(_output_array[_i], %s[_i]);\n", indent, value)
-						fmt.Fprintf(b, "%s}\n", indent)
-						fmt.Fprintf(b, "%sreturn %s_len;\n", indent, value)
+						fmt.Fprintf(b, "%sfor (int _i = 0; _i < %s_len && _i < _max_size; _i++) {\n", copyIndent, value)
+						fmt.Fprintf(b, "%s    strcpy(_output_array[_i], %s[_i]);\n", copyIndent, value)
+						fmt.Fprintf(b, "%s}\n", copyIndent)
+						r.leaveTryFrames(b, len(r.tryFrames), copyIndent, className, program, currentFunctionReturnType)
+						fmt.Fprintf(b, "%sreturn %s_len;\n", copyIndent, value)
 					} else {
 						// For other types, copy the array
-						fmt.Fprintf(b, "%sfor (int _i = 0; _i < %s_len && _i < _max_size; _i++) {\n", indent, value)
-						fmt.Fprintf(b, "%s    _output_array[_i] = %s[_i];\n", indent, value)
+						fmt.Fprintf(b, "%sfor (int _i = 0; _i < %s_len && _i < _max_size; _i++) {\n", copyIndent, value)
+						fmt.Fprintf(b, "%s    _output_array[_i] = %s[_i];\n", copyIndent, value)
+						fmt.Fprintf(b, "%s}\n", copyIndent)
+						r.leaveTryFrames(b, len(r.tryFrames), copyIndent, className, program, currentFunctionReturnType)
+						fmt.Fprintf(b, "%sreturn %s_len;\n", copyIndent, value)
+					}
+					if copyIndent != indent {
 						fmt.Fprintf(b, "%s}\n", indent)
-						fmt.Fprintf(b, "%sreturn %s_len;\n", indent, value)
 					}
 					break
 				}
 
 				// Process get! and has! expressions first (before this. conversion)
-				value = processGetExpressions(value, program)
-				value = processHasExpressions(value, program)
-
-				if isMethodCall(value) {
-					value = convertMethodCallToC(value)
+				value = r.processGetExpressions(value, program)
+				value = r.processHasExpressions(value, program)
+
+				if elemType, isOptional := optionalElemType(currentFunctionReturnType); isOptional {
+					// A plain value returned as an optional is boxed like a stored one.
+					value = r.optionalValue(elemType, source)
+				} else if isMethodCall(value) {
+					value = r.convertMethodCallToC(value)
 				} else if strings.HasPrefix(value, "this.") {
 					value = "this->" + value[5:]
 				} else {
-					value = lexer.ResolveSymbol(value, currentModule)
+					value = lexer.ResolveSymbol(value, r.currentModule)
 				}
 
 				// Convert this references after macro processing
-				value = convertThisReferencesGranular(value)
-
-				if strings.Contains(value, " | ") {
-					parts := strings.Split(value, " | ")
-					if strings.HasPrefix(parts[0], "\"") && strings.HasSuffix(parts[0], "\"") {
-						format := parts[0][1 : len(parts[0])-1] // Remove quotes
-						specifierCount := strings.Count(format, "%")
-						if specifierCount == len(parts)-1 {
-							args := strings.Join(parts[1:], ", ")
-							tempVar := "_temp_ret_" + strconv.Itoa(len(b.String())%1000)
-							fmt.Fprintf(b, "%schar %s[256];\n", indent, tempVar)
-							fmt.Fprintf(b, "%ssprintf(%s, \"%s\", %s);\n", indent, tempVar, format, args)
-							fmt.Fprintf(b, "%sreturn %s;\n", indent, tempVar)
-							break
-						}
-					}
-				}
+				value = r.convertThisReferencesGranular(value)
 
-				fmt.Fprintf(b, "%sreturn %s;\n", indent, value)
+				if r.inStringFunction() {
+					value = r.ownedString(value)
+				}
+				if len(r.tryFrames) > 0 {
+					r.returnFromTry(b, value, indent, className, program, currentFunctionReturnType)
+					break
+				}
+				r.renderReturn(b, indent, source, value, currentFunctionReturnType)
 			}
 		case stmt.GetMap != nil:
-			mapAccess := renderMapAccess(stmt.GetMap.MapName, stmt.GetMap.Key, program)
+			mapAccess := r.renderMapAccess(stmt.GetMap.MapName, stmt.GetMap.Key)
 			fmt.Fprintf(b, "%s%s;\n", indent, mapAccess)
 		case stmt.Throw != nil:
-			value := lexer.ResolveSymbol(stmt.Throw.Value, currentModule)
-			fmt.Fprintf(b, "%s_exception = %s;\n", indent, value)
-			fmt.Fprintf(b, "%sgoto catch_label;\n", indent)
+			r.renderThrow(b, stmt.Throw, indent)
+		case stmt.Test != nil:
+			r.renderTest(b, stmt.Test, indent, className, program, currentFunctionReturnType)
+		case stmt.Bench != nil:
+			r.renderBench(b, stmt.Bench, indent, className, program, currentFunctionReturnType)
+		case stmt.Assert != nil:
+			r.renderAssert(b, stmt.Assert, indent, program)
 		case stmt.TryCatch != nil:
-			fmt.Fprintf(b, "%s{\n", indent)
-			fmt.Fprintf(b, "%s    int _prev_exception = _exception;\n", indent)
-			fmt.Fprintf(b, "%s    _exception = 0;\n", indent)
-			renderStatements(b, stmt.TryCatch.TryBody, indent+"    ", className, program, currentFunctionReturnType)
-			fmt.Fprintf(b, "%s    if (_exception != 0) {\n", indent)
-			fmt.Fprintf(b, "%scatch_label:\n", indent)
-			renderStatements(b, stmt.TryCatch.CatchBody, indent+"    ", className, program, currentFunctionReturnType)
-			fmt.Fprintf(b, "%s    }\n", indent)
-			fmt.Fprintf(b, "%s    _exception = _prev_exception;\n", indent)
-			fmt.Fprintf(b, "%s}\n", indent)
+			r.renderTryCatch(b, stmt.TryCatch, indent, className, program, currentFunctionReturnType)
 		case stmt.While != nil:
-			condition := lexer.ResolveSymbol(stmt.While.Condition, currentModule)
-			condition = convertThisReferencesGranular(condition)
+			condition := lexer.ResolveSymbol(stmt.While.Condition, r.currentModule)
+			condition = r.convertThisReferencesGranular(condition)
 			fmt.Fprintf(b, "%swhile (%s) {\n", indent, condition)
-			renderStatements(b, stmt.While.Body, indent+"    ", className, program, currentFunctionReturnType)
-			fmt.Fprintf(b, "%s}\n", indent)
+			r.renderLoopBody(b, stmt.While.Label, stmt.While.Body, indent, className, program, currentFunctionReturnType)
 		case stmt.CatString != nil:
-			target := lexer.ResolveSymbol(stmt.CatString.Target, currentModule)
+			target := lexer.ResolveSymbol(stmt.CatString.Target, r.currentModule)
 			value := stmt.CatString.Value
 			if strings.HasPrefix(target, "this.") {
 				target = "this->" + target[5:]
 			}
 			if !strings.HasPrefix(value, "\"") && !strings.HasSuffix(value, "\"") {
 				if isValidIdentifier(value) {
-					value = lexer.ResolveSymbol(value, currentModule)
+					value = lexer.ResolveSymbol(value, r.currentModule)
 					if strings.HasPrefix(value, "this.") {
 						value = "this->" + value[5:]
 					}
@@ -1447,13 +1395,25 @@ func renderStatements(b *strings.Builder, stmts []*lexer.Statement, indent strin
 					value = fmt.Sprintf("\"%s\"", value)
 				}
 			}
-			fmt.Fprintf(b, "%sstrcat(%s, %s);\n", indent, target, value)
+			if r.isHeapString(target) {
+				catString(b, indent, target, value)
+			} else {
+				fmt.Fprintf(b, "%sstrcat(%s, %s);\n", indent, target, value)
+			}
 		case stmt.Foreach != nil:
 			var (
 				collection = stmt.Foreach.Collection
-				varType    = mapTypeToCType(stmt.Foreach.VarType)
+				varType    = r.mapTypeToCType(stmt.Foreach.VarType)
 				varName    = stmt.Foreach.VarName
 			)
+			r.varTypes[varName] = stmt.Foreach.VarType
+
+			if object, ok := r.fileLines(collection); ok {
+				r.renderFileLinesForeach(b, indent, object, varName)
+				r.renderLoopBody(b, stmt.Foreach.Label, stmt.Foreach.Body, indent+"    ", className, program, currentFunctionReturnType)
+				endFileLinesForeach(b, indent, varName)
+				break
+			}
 
 			var mapName, accessType string
 			if strings.HasSuffix(collection, ".keys") {
@@ -1462,41 +1422,38 @@ func renderStatements(b *strings.Builder, stmts []*lexer.Statement, indent strin
 			} else if strings.HasSuffix(collection, ".values") {
 				mapName = collection[:len(collection)-7]
 				accessType = "values"
+			} else if _, isSet := r.lookupSet(collection); isSet {
+				mapName = collection
+				accessType = "keys"
+			} else if length, ok := r.foreachListLength(collection); ok {
+				list := r.convertThisReferencesGranular(lexer.ResolveSymbol(collection, r.currentModule))
+				fmt.Fprintf(b, "%sfor (int __i = 0; __i < %s; __i++) {\n", indent, length)
+				fmt.Fprintf(b, "%s    %s %s = %s[__i];\n", indent, varType, varName, list)
+				r.renderLoopBody(b, stmt.Foreach.Label, stmt.Foreach.Body, indent, className, program, currentFunctionReturnType)
+				break
 			} else {
-				resolvedStringName := lexer.ResolveSymbol(collection, currentModule)
+				resolvedStringName := lexer.ResolveSymbol(collection, r.currentModule)
+				if varType == "char*" {
+					renderCodePointForeach(b, indent, resolvedStringName, varName)
+					r.renderLoopBody(b, stmt.Foreach.Label, stmt.Foreach.Body, indent, className, program, currentFunctionReturnType)
+					break
+				}
 				fmt.Fprintf(b, "%sfor (int __i = 0; __i < strlen(%s); __i++) {\n", indent, resolvedStringName)
 				fmt.Fprintf(b, "%s    %s %s = %s[__i];\n", indent, varType, varName, resolvedStringName)
-				renderStatements(b, stmt.Foreach.Body, indent+"    ", className, program, currentFunctionReturnType)
-				fmt.Fprintf(b, "%s}\n", indent)
+				r.renderLoopBody(b, stmt.Foreach.Label, stmt.Foreach.Body, indent, className, program, currentFunctionReturnType)
 				break
 			}
-			resolvedMapName := lexer.ResolveSymbol(mapName, currentModule)
-			fmt.Fprintf(b, "%sfor (int __i = 0; __i < %s_size; __i++) {\n", indent, resolvedMapName)
-			if accessType == "keys" {
-				if stmt.Foreach.VarType == "string" {
-					fmt.Fprintf(b, "%s    %s* %s = %s_keys[__i];\n", indent, varType, varName, resolvedMapName)
-				} else {
-					fmt.Fprintf(b, "%s    %s %s = %s_keys[__i];\n", indent, varType, varName, resolvedMapName)
-				}
-			} else {
-				if stmt.Foreach.VarType == "string" {
-					fmt.Fprintf(b, "%s    %s* %s = %s_values[__i];\n", indent, varType, varName, resolvedMapName)
-				} else {
-					fmt.Fprintf(b, "%s    %s %s = %s_values[__i];\n", indent, varType, varName, resolvedMapName)
-				}
-			}
-			renderStatements(b, stmt.Foreach.Body, indent+"    ", className, program, currentFunctionReturnType)
-
-			fmt.Fprintf(b, "%s}\n", indent)
+			r.renderMapForeach(b, indent, mapName, accessType, stmt.Foreach.VarType, varName)
+			r.renderLoopBody(b, stmt.Foreach.Label, stmt.Foreach.Body, indent, className, program, currentFunctionReturnType)
 		case stmt.For != nil:
 			var (
 				varName = stmt.For.Var
-				start   = lexer.ResolveSymbol(stmt.For.Start, currentModule)
+				start   = lexer.ResolveSymbol(stmt.For.Start, r.currentModule)
 				end     = stmt.For.End
 			)
-			end = convertThisReferencesGranular(end)
-			end = lexer.ResolveSymbol(end, currentModule)
-			end = resolveLenFunctionCalls(end)
+			end = r.convertThisReferencesGranular(end)
+			end = lexer.ResolveSymbol(end, r.currentModule)
+			end = r.resolveLenFunctionCalls(end)
 
 			// Clean up variable name - remove type prefix if present
 			if after, ok := strings.CutPrefix(varName, "int "); ok {
@@ -1505,7 +1462,6 @@ func renderStatements(b *strings.Builder, stmts []*lexer.Statement, indent strin
 
 			// Clean up any malformed characters that might have been introduced
 			varName = strings.ReplaceAll(varName, "*", "")
-			varName = strings.ReplaceAll(varName, "_", "")
 
 			endCond := end
 			if strings.ContainsAny(end, "+-*/><=!&|^%(") {
@@ -1514,74 +1470,59 @@ func renderStatements(b *strings.Builder, stmts []*lexer.Statement, indent strin
 
 			fmt.Fprintf(b, "%sfor (int %s = %s; %s <= %s; %s++) {\n",
 				indent, varName, start, varName, endCond, varName)
-			renderStatements(b, stmt.For.Body, indent+"    ", className, program, currentFunctionReturnType)
-			fmt.Fprintf(b, "%s}\n", indent)
+			r.varTypes[varName] = "int"
+			r.renderLoopBody(b, stmt.For.Label, stmt.For.Body, indent, className, program, currentFunctionReturnType)
 		case stmt.If != nil:
-			condition := stmt.If.Condition
-			// Process get! and has! expressions first (before this. conversion)
-			condition = processGetExpressions(condition, program)
-			condition = processHasExpressions(condition, program)
-
-			if isMethodCall(condition) {
-				condition = convertMethodCallToC(condition)
-			} else {
-				condition = lexer.ResolveSymbol(condition, currentModule)
-			}
-
-			// Convert this references after macro processing
-			condition = convertThisReferencesGranular(condition)
-			condition = resolveImportedSymbols(condition, program.Imports)
-			fmt.Fprintf(b, "%sif (%s) {\n", indent, condition)
-			renderStatements(b, stmt.If.Body, indent+"    ", className, program, currentFunctionReturnType)
+			fmt.Fprintf(b, "%sif (%s) {\n", indent, r.renderCondition(stmt.If.Condition, program))
+			r.renderStatements(b, stmt.If.Body, indent+"    ", className, program, currentFunctionReturnType)
 			fmt.Fprintf(b, "%s}\n", indent)
 
 			for _, elif := range stmt.If.ElseIfs {
-				elifCondition := elif.Condition
-				// Process get! and has! expressions first (before this. conversion)
-				elifCondition = processGetExpressions(elifCondition, program)
-				elifCondition = processHasExpressions(elifCondition, program)
-
-				if isMethodCall(elifCondition) {
-					elifCondition = convertMethodCallToC(elifCondition)
-				} else {
-					elifCondition = lexer.ResolveSymbol(elifCondition, currentModule)
-				}
-
-				// Convert this references after macro processing
-				elifCondition = convertThisReferencesGranular(elifCondition)
-				elifCondition = resolveImportedSymbols(elifCondition, program.Imports)
-				fmt.Fprintf(b, "%selse if (%s) {\n", indent, elifCondition)
-				renderStatements(b, elif.Body, indent+"    ", className, program, currentFunctionReturnType)
+				fmt.Fprintf(b, "%selse if (%s) {\n", indent, r.renderCondition(elif.Condition, program))
+				r.renderStatements(b, elif.Body, indent+"    ", className, program, currentFunctionReturnType)
 				fmt.Fprintf(b, "%s}\n", indent)
 			}
 
 			if stmt.If.Else != nil {
 				fmt.Fprintf(b, "%selse {\n", indent)
-				renderStatements(b, stmt.If.Else.Body, indent+"    ", className, program, currentFunctionReturnType)
+				r.renderStatements(b, stmt.If.Else.Body, indent+"    ", className, program, currentFunctionReturnType)
 				fmt.Fprintf(b, "%s}\n", indent)
 			}
+		case stmt.Match != nil:
+			r.renderMatch(b, stmt.Match, indent, className, program, currentFunctionReturnType)
 		case stmt.VarDecl != nil:
 			var (
 				varType = stmt.VarDecl.Type
-				varName = lexer.ResolveSymbol(stmt.VarDecl.Name, currentModule)
+				varName = lexer.ResolveSymbol(stmt.VarDecl.Name, r.currentModule)
 				value   = stmt.VarDecl.Value
 			)
 
+			if _, isOptional := optionalElemType(varType); isOptional {
+				r.declareOptional(b, indent, stmt.VarDecl.Name, varType, value)
+				break
+			}
+			if className, isClass := r.countedClass(varType); isClass && !stmt.VarDecl.IsRef && !strings.HasPrefix(varName, "this.") {
+				r.declareObject(b, indent, stmt.VarDecl.Name, className, value)
+				break
+			}
+			r.atomicVars[varName] = stmt.VarDecl.Atomic
 			if stmt.VarDecl.IsRef {
 				if strings.HasPrefix(varName, "this.") {
 					fieldName := varName[5:]
 					if value == "0" || value == "NULL" {
 						fmt.Fprintf(b, "%sthis->%s = NULL;\n", indent, fieldName)
 					} else {
-						value = convertThisReferencesGranular(value)
-						value = convertNewToConstructor(value)
-						fmt.Fprintf(b, "%sthis->%s = %s;\n", indent, fieldName, value)
+						rendered := r.convertNewToConstructor(r.convertThisReferencesGranular(value))
+						if _, counted := r.countedClass(varType); counted {
+							rendered = r.retainValue(value, rendered)
+						}
+						fmt.Fprintf(b, "%sthis->%s = %s;\n", indent, fieldName, rendered)
 					}
 				} else {
 					innerType := strings.TrimPrefix(varType, "ref ")
 					switch innerType {
 					case "int", "float", "double", "bool", "char":
-						fmt.Fprintf(b, "%s%s* %s = ", indent, mapTypeToCType(innerType), varName)
+						fmt.Fprintf(b, "%s%s* %s = ", indent, r.mapTypeToCType(innerType), varName)
 					case "string":
 						fmt.Fprintf(b, "%schar* %s = ", indent, varName)
 					default:
@@ -1591,46 +1532,33 @@ func renderStatements(b *strings.Builder, stmts []*lexer.Statement, indent strin
 					if value == "0" || value == "NULL" || value == "nil" {
 						fmt.Fprintf(b, "NULL;\n")
 					} else {
-						value = convertThisReferencesGranular(value)
-						value = convertNewToConstructor(value)
-						fmt.Fprintf(b, "%s;\n", value)
+						rendered := r.convertNewToConstructor(r.convertThisReferencesGranular(value))
+						if _, counted := r.countedClass(innerType); counted {
+							rendered = r.retainValue(value, rendered)
+						}
+						fmt.Fprintf(b, "%s;\n", rendered)
 					}
+					r.trackLocal(varName, varType, indent)
 				}
 				return
 			}
 
-			if isMethodCall(value) {
-				value = convertMethodCallToC(value)
+			if _, err := lexer.ParseExpr(lexer.ReplaceDoubleColonsOutsideStrings(value)); err != nil && isMethodCall(value) {
+				value = r.convertMethodCallToC(value)
 			} else {
-				value = convertThisReferencesGranular(value)
+				value = r.convertThisReferencesGranular(value)
 			}
 
-			value = processGetExpressions(value, program)
-			value = processHasExpressions(value, program)
-			value = fixFloatCastGranular(value)
+			value = r.processGetExpressions(value, program)
+			value = r.processHasExpressions(value, program)
 			value = resolveImportedSymbols(value, program.Imports)
-			value = resolveLenFunctionCalls(value)
+			value = r.resolveLenFunctionCalls(value)
 
 			if strings.HasPrefix(varName, "this.") {
 				fieldName := varName[5:]
 				if stmt.VarDecl.Type == "string" {
 					if isFunctionCall(value) {
-						funcName, args := parseFunctionCall(value)
-						resolvedFuncName := lexer.ResolveSymbol(funcName, currentModule)
-						if functionReturnsString(resolvedFuncName) {
-							if len(args) == 0 {
-								fmt.Fprintf(b, "%s%s(this->%s);\n", indent, resolvedFuncName, fieldName)
-							} else {
-								resolvedArgs := make([]string, len(args))
-								for i, arg := range args {
-									resolvedArgs[i] = lexer.ResolveSymbol(arg, currentModule)
-								}
-								fmt.Fprintf(b, "%s%s(this->%s, %s);\n", indent, resolvedFuncName, fieldName, strings.Join(resolvedArgs, ", "))
-							}
-						} else {
-							resolvedCall := resolveFunctionCall(value)
-							fmt.Fprintf(b, "%sstrcpy(this->%s, %s);\n", indent, fieldName, resolvedCall)
-						}
+						fmt.Fprintf(b, "%sstrcpy(this->%s, %s);\n", indent, fieldName, r.resolveFunctionCall(value))
 					} else {
 						if !strings.HasPrefix(value, "\"") && !strings.HasSuffix(value, "\"") {
 							value = fmt.Sprintf("\"%s\"", value)
@@ -1640,107 +1568,54 @@ func renderStatements(b *strings.Builder, stmts []*lexer.Statement, indent strin
 				} else {
 					value = strings.ReplaceAll(value, "this.", "this->")
 					if isFunctionCall(value) {
-						value = resolveFunctionCall(value)
+						value = r.resolveFunctionCall(value)
 					}
 					fmt.Fprintf(b, "%sthis->%s = %s;\n", indent, fieldName, value)
 				}
 			} else {
 				if stmt.VarDecl.Type == "string" {
-					fmt.Fprintf(b, "%schar %s[256];\n", indent, varName)
-					// Always initialize string variables; handle empty string case
-					if value == "" || value == "\"\"" {
-						fmt.Fprintf(b, "%sstrcpy(%s, \"\");\n", indent, varName)
-					} else if isFunctionCall(value) {
-						funcName, args := parseFunctionCall(value)
-						resolvedFuncName := lexer.ResolveSymbol(funcName, currentModule)
-
-						if functionReturnsString(resolvedFuncName) {
-							if len(args) == 0 {
-								fmt.Fprintf(b, "%s%s(%s);\n", indent, resolvedFuncName, varName)
-							} else {
-								resolvedArgs := make([]string, len(args))
-								for i, arg := range args {
-									resolvedArgs[i] = lexer.ResolveSymbol(arg, currentModule)
-								}
-								fmt.Fprintf(b, "%s%s(%s, %s);\n", indent, resolvedFuncName, varName, strings.Join(resolvedArgs, ", "))
-							}
-						} else {
-							resolvedCall := resolveFunctionCall(value)
-							fmt.Fprintf(b, "%sstrcpy(%s, %s);\n", indent, varName, resolvedCall)
-						}
-					} else {
-						if !strings.HasPrefix(value, "\"") && !strings.HasSuffix(value, "\"") {
-							value = fmt.Sprintf("\"%s\"", value)
-						}
-						fmt.Fprintf(b, "%sstrcpy(%s, %s);\n", indent, varName, value)
+					if stmt.VarDecl.Quoted {
+						value = stmt.VarDecl.Value
 					}
+					r.declareString(b, indent, varName, value, stmt.VarDecl.Quoted)
 				} else {
+					delete(r.heapStrings, varName)
+					r.varTypes[varName] = varType
 					if isFunctionCall(value) {
-						value = resolveFunctionCall(value)
+						value = r.resolveFunctionCall(value)
 					}
 					fmt.Fprintf(b, "%s%s %s = %s;\n", indent, varType, varName, value)
 				}
 			}
 		case stmt.VarAssign != nil:
 			var (
-				varName = lexer.ResolveSymbol(stmt.VarAssign.Name, currentModule)
+				varName = lexer.ResolveSymbol(stmt.VarAssign.Name, r.currentModule)
 				value   = stmt.VarAssign.Value
 			)
-			value = fixFloatCastGranular(value)
-			value = convertThisReferencesGranular(value)
+			if strings.Contains(varName, ".") {
+				value = quotedValue(value, stmt.VarAssign.Quoted)
+			}
+			value = r.convertThisReferencesGranular(value)
 			if strings.HasPrefix(varName, "this.") {
 				varName = "this->" + varName[5:]
+			} else if member, ok := r.structMember(varName); ok {
+				varName = member
 			} else if strings.Contains(varName, ".") {
-				re := regexp.MustCompile(`([a-zA-Z_][a-zA-Z0-9_]*)\.([a-zA-Z_][a-zA-Z0-9_]*)`)
-				varName = re.ReplaceAllString(varName, "$1->$2")
-			}
-
-			isMapToMapAssignment := false
-			var targetFieldName, sourceMapName string
-			if strings.HasPrefix(varName, "this->") {
-				targetFieldName = varName[6:] // Remove "this->"
-				sourceMapName = value
-				for _, s := range program.Statements {
-					if (s.ClassDecl != nil || s.PubClassDecl != nil) && s.ClassDecl != nil && s.ClassDecl.Constructor != nil {
-						for _, field := range s.ClassDecl.Constructor.Fields {
-							if field.MapDecl != nil && strings.HasPrefix(field.MapDecl.Name, "this.") {
-								declFieldName := strings.TrimPrefix(field.MapDecl.Name, "this.")
-								if declFieldName == targetFieldName {
-									isMapToMapAssignment = true
-									break
-								}
-							}
-						}
-					}
-					if (s.PubClassDecl != nil) && s.PubClassDecl.Constructor != nil {
-						for _, field := range s.PubClassDecl.Constructor.Fields {
-							if field.MapDecl != nil && strings.HasPrefix(field.MapDecl.Name, "this.") {
-								declFieldName := strings.TrimPrefix(field.MapDecl.Name, "this.")
-								if declFieldName == targetFieldName {
-									isMapToMapAssignment = true
-									break
-								}
-							}
-						}
-					}
-					if isMapToMapAssignment {
-						break
-					}
-				}
+				varName = r.convertThisReferencesGranular(varName)
 			}
 
-			if isMapToMapAssignment {
-				fmt.Fprintf(b, "%s// Copy map from %s to this->%s\n", indent, sourceMapName, targetFieldName)
-				fmt.Fprintf(b, "%sthis->%s_size = %s_size;\n", indent, targetFieldName, sourceMapName)
-				fmt.Fprintf(b, "%sfor (int i = 0; i < %s_size; i++) {\n", indent, sourceMapName)
-				fmt.Fprintf(b, "%s    strcpy(this->%s_keys[i], %s_keys[i]);\n", indent, targetFieldName, sourceMapName)
-				fmt.Fprintf(b, "%s    this->%s_values[i] = %s_values[i];\n", indent, targetFieldName, sourceMapName)
-				fmt.Fprintf(b, "%s}\n", indent)
+			if r.assignCounted(b, indent, stmt.VarAssign.Name, stmt.VarAssign.Value) {
+			} else if r.atomicVars[varName] {
+				r.assignAtomic(b, indent, varName, resolveImportedSymbols(value, program.Imports))
+			} else if r.assignOptional(b, indent, stmt.VarAssign.Name, quotedValue(stmt.VarAssign.Value, stmt.VarAssign.Quoted)) {
+			} else if _, isMap := r.lookupMap(stmt.VarAssign.Name); isMap {
+				r.assignMap(b, indent, stmt.VarAssign.Name, stmt.VarAssign.Value)
+			} else if list, ok := listLiteral(stmt.VarAssign.Value); ok && r.assignList(b, indent, stmt.VarAssign.Name, list, stmt.Line) {
 			} else if strings.Contains(varName, "[") && strings.Contains(varName, "]") {
 				arrayName := varName[:strings.Index(varName, "[")]
-				if arrayType, exists := globalArrays[arrayName]; exists && arrayType == "string" {
+				if arrayType, exists := r.globalArrays[arrayName]; exists && arrayType == "string" {
 					if isFunctionCall(value) {
-						value = resolveFunctionCall(value)
+						value = r.resolveFunctionCall(value)
 						fmt.Fprintf(b, "%sstrcpy(%s, %s);\n", indent, varName, value)
 					} else {
 						if !strings.HasPrefix(value, "\"") && !strings.HasSuffix(value, "\"") {
@@ -1750,13 +1625,19 @@ func renderStatements(b *strings.Builder, stmts []*lexer.Statement, indent strin
 					}
 				} else {
 					if isFunctionCall(value) {
-						value = resolveFunctionCall(value)
+						value = r.resolveFunctionCall(value)
 					}
 					fmt.Fprintf(b, "%s%s = %s;\n", indent, varName, value)
 				}
+			} else if elemType, isList := r.globalArrays[stmt.VarAssign.Name]; isList && r.assignSlice(b, indent, elemType, varName, stmt.VarAssign.Value) {
+			} else if r.isHeapString(varName) {
+				if stmt.VarAssign.Quoted {
+					value = stmt.VarAssign.Value
+				}
+				r.assignString(b, indent, varName, value, stmt.VarAssign.Quoted)
 			} else {
 				var varType string
-				for _, classInfo := range globalClasses {
+				for _, classInfo := range r.globalClasses {
 					for _, field := range classInfo.Fields {
 						if field.Name == varName || ("this->"+field.Name) == varName {
 							varType = field.Type
@@ -1764,9 +1645,12 @@ func renderStatements(b *strings.Builder, stmts []*lexer.Statement, indent strin
 						}
 					}
 				}
+				if varType == "" {
+					varType = r.targetType(stmt.VarAssign.Name)
+				}
 				if varType == "string" {
 					if isFunctionCall(value) {
-						value = resolveFunctionCall(value)
+						value = r.resolveFunctionCall(value)
 						fmt.Fprintf(b, "%sstrcpy(%s, %s);\n", indent, varName, value)
 					} else {
 						if strings.HasPrefix(value, "\"") && strings.HasSuffix(value, "\"") {
@@ -1779,96 +1663,115 @@ func renderStatements(b *strings.Builder, stmts []*lexer.Statement, indent strin
 					}
 				} else {
 					if isFunctionCall(value) {
-						if _, isListVar := globalArrays[varName]; isListVar {
+						if _, isListVar := r.globalArrays[varName]; isListVar {
 							var (
 								funcName, args   = parseFunctionCall(value)
-								resolvedFuncName = lexer.ResolveSymbol(funcName, currentModule)
+								resolvedFuncName = lexer.ResolveSymbol(funcName, r.currentModule)
 							)
-							if returnsListType, _ := functionReturnsList(resolvedFuncName); returnsListType {
+							if returnsListType, _ := r.functionReturnsList(resolvedFuncName); returnsListType {
 								resolvedArgs := make([]string, len(args))
 								for i, arg := range args {
-									resolvedArgs[i] = lexer.ResolveSymbol(arg, currentModule)
+									resolvedArgs[i] = lexer.ResolveSymbol(arg, r.currentModule)
 								}
 
 								// For functions that return lists, we need to pass:
 								//
 								// 1. Output array (same as varName)
-								// 2. Max size (1000)
+								// 2. Max size (its capacity)
 								// 3. All resolved args with their lengths if they are lists
 								var callArgs []string
 								callArgs = append(callArgs, varName)
-								callArgs = append(callArgs, "1000")
+								callArgs = append(callArgs, varName+"_cap")
 								for _, arg := range resolvedArgs {
 									callArgs = append(callArgs, arg)
-									if _, isListArg := globalArrays[arg]; isListArg {
-										callArgs = append(callArgs, arg+"_len")
+									if _, isListArg := r.globalArrays[arg]; isListArg {
+										callArgs = append(callArgs, r.listLengthArgs(arg, arg)...)
 									}
 								}
 
+								reserveList(b, indent, varName, strconv.Itoa(listReturnCapacity))
 								fmt.Fprintf(b, "%s%s_len = %s(%s);\n", indent, varName, resolvedFuncName, strings.Join(callArgs, ", "))
 								break
 							}
 						}
-						value = resolveFunctionCall(value)
+						value = r.resolveFunctionCall(value)
 					}
 					fmt.Fprintf(b, "%s%s = %s;\n", indent, varName, value)
 				}
 			}
 		case stmt.IndexAssign != nil:
-			listName := lexer.ResolveSymbol(stmt.IndexAssign.ListName, currentModule)
+			listName := lexer.ResolveSymbol(stmt.IndexAssign.ListName, r.currentModule)
 			index := stmt.IndexAssign.Index
 			value := stmt.IndexAssign.Value
-			index = lexer.ResolveSymbol(index, currentModule)
-			value = lexer.ResolveSymbol(value, currentModule)
-			value = fixFloatCastGranular(value)
-			value = convertThisReferencesGranular(value)
-			fmt.Fprintf(b, "%s%s[%s] = %s;\n", indent, listName, index, value)
+			index = lexer.ResolveSymbol(index, r.currentModule)
+			value = lexer.ResolveSymbol(value, r.currentModule)
+			value = r.convertThisReferencesGranular(value)
+			elemType := r.globalArrays[stmt.IndexAssign.ListName]
+			if length, ok := r.listLength(stmt.IndexAssign.ListName); ok && !strings.Contains(index, "[") {
+				index = r.checkedIndex(index, length)
+			} else if target, err := lexer.ParseExpr(stmt.IndexAssign.ListName); err == nil {
+				if fieldType, ok := r.listFieldType(target); ok {
+					listName = r.renderExpr(target)
+					elemType = fieldType
+					if !strings.Contains(index, "[") {
+						index = r.checkedIndex(index, listName+"_len")
+					}
+				}
+			}
+			if elemType == "string" {
+				fmt.Fprintf(b, "%sstrcpy(%s[%s], %s);\n", indent, listName, index, value)
+			} else {
+				fmt.Fprintf(b, "%s%s[%s] = %s;\n", indent, listName, index, value)
+			}
 
 		case stmt.ListDecl != nil:
-			listType := mapTypeToCType(stmt.ListDecl.Type)
-			listName := lexer.ResolveSymbol(stmt.ListDecl.Name, currentModule)
-			globalArrays[stmt.ListDecl.Name] = stmt.ListDecl.Type
-			if len(stmt.ListDecl.Elements) == 1 && !strings.Contains(stmt.ListDecl.Elements[0], ",") &&
+			listName := lexer.ResolveSymbol(stmt.ListDecl.Name, r.currentModule)
+			r.globalArrays[stmt.ListDecl.Name] = stmt.ListDecl.Type
+			if slice, ok := r.listDeclSlice(stmt.ListDecl); ok {
+				r.declareList(b, indent, stmt.ListDecl.Type, listName)
+				r.extendListSlice(b, indent, stmt.ListDecl.Type, listName, slice)
+			} else if _, nested := nestedListType(stmt.ListDecl.Type); nested {
+				r.declareList(b, indent, stmt.ListDecl.Type, listName)
+				for _, elem := range stmt.ListDecl.Elements {
+					if strings.HasPrefix(elem, "[") || len(stmt.ListDecl.Elements) > 1 {
+						r.pushRowValue(b, indent, stmt.ListDecl.Type, listName, elem)
+					} else {
+						extendList(b, indent, stmt.ListDecl.Type, listName, lexer.ResolveSymbol(elem, r.currentModule))
+					}
+				}
+			} else if len(stmt.ListDecl.Elements) == 1 && !strings.Contains(stmt.ListDecl.Elements[0], ",") &&
 				!strings.HasPrefix(stmt.ListDecl.Elements[0], "\"") && !strings.HasSuffix(stmt.ListDecl.Elements[0], "\"") &&
 				!isNumericOrBoolean(stmt.ListDecl.Elements[0]) {
 				// This is likely a variable assignment (e.g., list[int] sorted_list = input_list)
-				sourceVar := lexer.ResolveSymbol(stmt.ListDecl.Elements[0], currentModule)
-
-				if stmt.ListDecl.Type == "string" {
-					fmt.Fprintf(b, "%s%s %s[1000][256];\n", indent, "char", listName)
-					fmt.Fprintf(b, "%sint %s_len = %s_len;\n", indent, listName, sourceVar)
-					fmt.Fprintf(b, "%sfor (int i = 0; i < %s_len; i++) {\n", indent, sourceVar)
-					fmt.Fprintf(b, "%s    strcpy(%s[i], %s[i]);\n", indent, listName, sourceVar)
-					fmt.Fprintf(b, "%s}\n", indent)
-				} else {
-					fmt.Fprintf(b, "%s%s %s[1000];\n", indent, listType, listName)
-					fmt.Fprintf(b, "%sint %s_len = %s_len;\n", indent, listName, sourceVar)
-					fmt.Fprintf(b, "%sfor (int i = 0; i < %s_len; i++) {\n", indent, sourceVar)
-					fmt.Fprintf(b, "%s    %s[i] = %s[i];\n", indent, listName, sourceVar)
-					fmt.Fprintf(b, "%s}\n", indent)
-				}
+				sourceVar := lexer.ResolveSymbol(stmt.ListDecl.Elements[0], r.currentModule)
+
+				r.declareList(b, indent, stmt.ListDecl.Type, listName)
+				reserveList(b, indent, listName, sourceVar+"_len")
+				extendList(b, indent, stmt.ListDecl.Type, listName, sourceVar)
 			} else {
 				// Traditional list declaration with elements
-				if stmt.ListDecl.Type == "string" {
-					fmt.Fprintf(b, "%s%s %s[%d][256];\n", indent, "char", listName, len(stmt.ListDecl.Elements))
-				} else {
-					fmt.Fprintf(b, "%s%s %s[%d];\n", indent, listType, listName, len(stmt.ListDecl.Elements))
+				r.declareList(b, indent, stmt.ListDecl.Type, listName)
+				if len(stmt.ListDecl.Elements) > 0 {
+					reserveList(b, indent, listName, strconv.Itoa(len(stmt.ListDecl.Elements)))
 				}
 				for i, elem := range stmt.ListDecl.Elements {
-					elem = lexer.ResolveSymbol(elem, currentModule)
+					elem = lexer.ResolveSymbol(elem, r.currentModule)
 					if stmt.ListDecl.Type == "string" {
 						if !strings.HasPrefix(elem, "\"") && !strings.HasSuffix(elem, "\"") {
 							elem = fmt.Sprintf("\"%s\"", elem)
 						}
 						fmt.Fprintf(b, "%sstrcpy(%s[%d], %s);\n", indent, listName, i, elem)
 					} else {
+						if r.isStructType(stmt.ListDecl.Type) {
+							elem = r.convertThisReferencesGranular(elem)
+						}
 						fmt.Fprintf(b, "%s%s[%d] = %s;\n", indent, listName, i, elem)
 					}
 				}
-				fmt.Fprintf(b, "%sint %s_len = %d;\n", indent, listName, len(stmt.ListDecl.Elements))
+				fmt.Fprintf(b, "%s%s_len = %d;\n", indent, listName, len(stmt.ListDecl.Elements))
 			}
 		case stmt.ObjectDecl != nil:
-			varName := lexer.ResolveSymbol(stmt.ObjectDecl.Name, currentModule)
+			varName := lexer.ResolveSymbol(stmt.ObjectDecl.Name, r.currentModule)
 			typeName := stmt.ObjectDecl.Type
 			args := stmt.ObjectDecl.Args
 			resolvedType := typeName
@@ -1884,7 +1787,16 @@ func renderStatements(b *strings.Builder, stmts []*lexer.Statement, indent strin
 				Name: stmt.ObjectDecl.Name,
 				Type: typeName,
 			}
-			globalObjects[stmt.ObjectDecl.Name] = objectInfo
+			r.globalObjects[stmt.ObjectDecl.Name] = objectInfo
+
+			// `Base b = new Derived(...)` stores the new object upcast to its base.
+			createdType := resolvedType
+			if len(args) > 0 && args[0] != typeName {
+				if _, isClass := r.globalClasses[args[0]]; isClass {
+					createdType = args[0]
+					args = args[1:]
+				}
+			}
 			constructorArgs := make([]string, 0)
 			for _, arg := range args {
 				if strings.Contains(typeName, ".") {
@@ -1897,32 +1809,58 @@ func renderStatements(b *strings.Builder, stmts []*lexer.Statement, indent strin
 					if strings.HasPrefix(arg, "\"") && strings.HasSuffix(arg, "\"") {
 						constructorArgs = append(constructorArgs, arg)
 					} else {
-						constructorArgs = append(constructorArgs, lexer.ResolveSymbol(arg, currentModule))
+						constructorArgs = append(constructorArgs, lexer.ResolveSymbol(arg, r.currentModule))
 					}
 				}
 			}
 
-			argsStr := strings.Join(constructorArgs, ", ")
-			fmt.Fprintf(b, "%s%s* %s = %s_new(%s);\n", indent, resolvedType, varName, resolvedType, argsStr)
-
+			created := r.allocatedAt(fmt.Sprintf("%s_new(%s)", createdType, strings.Join(r.withDefaultArgs(createdType, constructorArgs), ", ")))
+			if r.isInterface(resolvedType) {
+				fmt.Fprintf(b, "%s%s %s = %s_as_%s(%s);\n", indent, resolvedType, varName, createdType, resolvedType, created)
+			} else if createdType != resolvedType {
+				fmt.Fprintf(b, "%s%s* %s = %s_as_%s(%s);\n", indent, resolvedType, varName, createdType, resolvedType, created)
+			} else {
+				fmt.Fprintf(b, "%s%s* %s = %s;\n", indent, resolvedType, varName, created)
+			}
+			r.trackLocal(stmt.ObjectDecl.Name, resolvedType, indent)
+
+		case stmt.VarDeclMethodCall != nil && r.isEnumMethodCall(stmt.VarDeclMethodCall.Object, stmt.VarDeclMethodCall.Method, stmt.VarDeclMethodCall.Args):
+			decl := stmt.VarDeclMethodCall
+			rendered, _ := r.enumMethodCall(decl.Object, decl.Method, decl.Args)
+			r.varTypes[decl.Name] = decl.Type
+			fmt.Fprintf(b, "%s%s %s = %s;\n", indent, r.mapTypeToCType(decl.Type), lexer.ResolveSymbol(decl.Name, r.currentModule), rendered)
+		case stmt.VarAssignMethodCall != nil && r.isEnumMethodCall(stmt.VarAssignMethodCall.Object, stmt.VarAssignMethodCall.Method, stmt.VarAssignMethodCall.Args):
+			assign := stmt.VarAssignMethodCall
+			rendered, _ := r.enumMethodCall(assign.Object, assign.Method, assign.Args)
+			fmt.Fprintf(b, "%s%s = %s;\n", indent, lexer.ResolveSymbol(assign.Name, r.currentModule), rendered)
+		case stmt.VarDeclMethodCall != nil && r.isModuleCall(stmt.VarDeclMethodCall.Object, stmt.VarDeclMethodCall.Method, stmt.VarDeclMethodCall.Args):
+			decl := stmt.VarDeclMethodCall
+			rendered, _ := r.moduleCall(decl.Object, decl.Method, decl.Args)
+			r.varTypes[decl.Name] = decl.Type
+			fmt.Fprintf(b, "%s%s %s = %s;\n", indent, r.mapTypeToCType(decl.Type), lexer.ResolveSymbol(decl.Name, r.currentModule), rendered)
+		case stmt.VarAssignMethodCall != nil && r.isModuleCall(stmt.VarAssignMethodCall.Object, stmt.VarAssignMethodCall.Method, stmt.VarAssignMethodCall.Args):
+			assign := stmt.VarAssignMethodCall
+			rendered, _ := r.moduleCall(assign.Object, assign.Method, assign.Args)
+			fmt.Fprintf(b, "%s%s = %s;\n", indent, lexer.ResolveSymbol(assign.Name, r.currentModule), rendered)
 		case stmt.VarDeclMethodCall != nil:
 			var (
-				varType           = mapTypeToCType(stmt.VarDeclMethodCall.Type)
-				varName           = lexer.ResolveSymbol(stmt.VarDeclMethodCall.Name, currentModule)
-				objectName        = lexer.ResolveSymbol(stmt.VarDeclMethodCall.Object, currentModule)
+				varType           = r.mapTypeToCType(stmt.VarDeclMethodCall.Type)
+				varName           = lexer.ResolveSymbol(stmt.VarDeclMethodCall.Name, r.currentModule)
+				objectName        = lexer.ResolveSymbol(stmt.VarDeclMethodCall.Object, r.currentModule)
 				methodName        = stmt.VarDeclMethodCall.Method
 				args              = make([]string, len(stmt.VarDeclMethodCall.Args))
 				resolvedClassName string
 			)
+			r.varTypes[varName] = stmt.VarDeclMethodCall.Type
 
 			if stmt.VarDeclMethodCall.Object == "this" {
+				resolvedClassName = className
 				if className == "" {
-					fmt.Println("\033[91mError: 'this' used outside of class context\033[0m")
-					os.Exit(1)
+					r.renderErrorf(stmt.Line, "'this' used outside of class context")
+					resolvedClassName = "unknown"
 				}
-				resolvedClassName = className
 			} else {
-				for _, obj := range globalObjects {
+				for _, obj := range r.globalObjects {
 					if obj.Name == stmt.VarDeclMethodCall.Object {
 						resolvedClassName = obj.Type
 						if strings.Contains(resolvedClassName, ".") {
@@ -1937,42 +1875,39 @@ func renderStatements(b *strings.Builder, stmts []*lexer.Statement, indent strin
 			}
 
 			for i, arg := range stmt.VarDeclMethodCall.Args {
-				args[i] = lexer.ResolveSymbol(arg, currentModule)
+				args[i] = lexer.ResolveSymbol(arg, r.currentModule)
 			}
 			argsStr := strings.Join(args, ", ")
+			if resolvedClassName == "" {
+				resolvedClassName, _ = r.listElementClass(stmt.VarDeclMethodCall.Object)
+			}
+			if resolvedClassName == "" {
+				resolvedClassName, objectName, _ = r.chainedReceiver(stmt.VarDeclMethodCall.Object)
+			}
 			if resolvedClassName == "" {
 				resolvedClassName = "unknown"
-				fmt.Println("\033[91mUnknown class name for method call:\033[0m", stmt.VarDeclMethodCall.Object)
-				fmt.Println("\033[91mObject name:\033[0m", stmt.VarDeclMethodCall.Object)
-				fmt.Println("\033[91mMethod name:\033[0m", stmt.VarDeclMethodCall.Method)
-				fmt.Println("\033[91mArgs:\033[0m", stmt.VarDeclMethodCall.Args)
-				fmt.Println("\033[91mCompilation failed.\033[0m")
-				os.Exit(1)
-			}
-			if argsStr == "" {
-				fmt.Fprintf(b, "%s%s %s = %s_%s(%s);\n", indent, varType, varName, resolvedClassName, methodName, objectName)
-			} else {
-				fmt.Fprintf(b, "%s%s %s = %s_%s(%s, %s);\n", indent, varType, varName, resolvedClassName, methodName, objectName, argsStr)
+				r.renderErrorf(stmt.Line, "unknown class of '%s' in call to method '%s'", stmt.VarDeclMethodCall.Object, stmt.VarDeclMethodCall.Method)
 			}
+			fmt.Fprintf(b, "%s%s %s = %s;\n", indent, varType, varName, r.methodCall(resolvedClassName, methodName, objectName, argsStr))
 		case stmt.VarAssignMethodCall != nil:
-			varName := lexer.ResolveSymbol(stmt.VarAssignMethodCall.Name, currentModule)
-			objectName := lexer.ResolveSymbol(stmt.VarAssignMethodCall.Object, currentModule)
+			varName := lexer.ResolveSymbol(stmt.VarAssignMethodCall.Name, r.currentModule)
+			objectName := lexer.ResolveSymbol(stmt.VarAssignMethodCall.Object, r.currentModule)
 			methodName := stmt.VarAssignMethodCall.Method
 			args := make([]string, len(stmt.VarAssignMethodCall.Args))
 			for i, arg := range stmt.VarAssignMethodCall.Args {
-				args[i] = lexer.ResolveSymbol(arg, currentModule)
+				args[i] = lexer.ResolveSymbol(arg, r.currentModule)
 			}
 			argsStr := strings.Join(args, ", ")
 
 			var resolvedClassName string
 			if stmt.VarAssignMethodCall.Object == "this" {
+				resolvedClassName = className
 				if className == "" {
-					fmt.Println("\033[91mError: 'this' used outside of class context\033[0m")
-					os.Exit(1)
+					r.renderErrorf(stmt.Line, "'this' used outside of class context")
+					resolvedClassName = "unknown"
 				}
-				resolvedClassName = className
 			} else {
-				for _, obj := range globalObjects {
+				for _, obj := range r.globalObjects {
 					if obj.Name == stmt.VarAssignMethodCall.Object {
 						resolvedClassName = obj.Type
 						if strings.Contains(resolvedClassName, ".") {
@@ -1986,65 +1921,54 @@ func renderStatements(b *strings.Builder, stmts []*lexer.Statement, indent strin
 				}
 			}
 			if resolvedClassName == "" {
-				resolvedClassName = "unknown"
+				resolvedClassName, _ = r.listElementClass(stmt.VarAssignMethodCall.Object)
 			}
-			if argsStr == "" {
-				fmt.Fprintf(b, "%s%s = %s_%s(%s);\n", indent, varName, resolvedClassName, methodName, objectName)
-			} else {
-				fmt.Fprintf(b, "%s%s = %s_%s(%s, %s);\n", indent, varName, resolvedClassName, methodName, objectName, argsStr)
+			if resolvedClassName == "" {
+				resolvedClassName, objectName, _ = r.chainedReceiver(stmt.VarAssignMethodCall.Object)
 			}
+			if resolvedClassName == "" {
+				resolvedClassName = "unknown"
+			}
+			fmt.Fprintf(b, "%s%s = %s;\n", indent, varName, r.methodCall(resolvedClassName, methodName, objectName, argsStr))
 		case stmt.VarDeclInferred != nil:
 			var (
-				varName = lexer.ResolveSymbol(stmt.VarDeclInferred.Name, currentModule)
-				value   = lexer.ResolveSymbol(stmt.VarDeclInferred.Value, currentModule)
+				varName = lexer.ResolveSymbol(stmt.VarDeclInferred.Name, r.currentModule)
+				value   = lexer.ResolveSymbol(stmt.VarDeclInferred.Value, r.currentModule)
 				varType = inferTypeFromValue(stmt.VarDeclInferred.Value)
-				cType   = mapTypeToCType(varType)
+				cType   = r.mapTypeToCType(varType)
 			)
+			if builtin, ok := r.inputBuiltinCall(value); ok {
+				value, varType, cType = builtin.function+"()", builtin.returnType, r.mapTypeToCType(builtin.returnType)
+			}
+			if className, isClass := r.objectValueClass(stmt.VarDeclInferred.Value); isClass {
+				r.declareObject(b, indent, stmt.VarDeclInferred.Name, className, stmt.VarDeclInferred.Value)
+				break
+			}
 			if isFunctionCall(value) {
 				funcName, _ := parseFunctionCall(value)
-				resolvedFuncName := lexer.ResolveSymbol(funcName, currentModule)
-				if functionReturnsString(resolvedFuncName) {
+				resolvedFuncName := lexer.ResolveSymbol(funcName, r.currentModule)
+				switch r.functionReturnType(resolvedFuncName) {
+				case "string":
 					varType = "string"
 					cType = "char"
+				case "char*":
+					varType = "char*"
+					cType = "char*"
+					r.varTypes[varName] = varType
 				}
 			}
 
 			if varType == "string" {
-				fmt.Fprintf(b, "%s%s %s[256];\n", indent, cType, varName)
-				if value != "" {
-					if isFunctionCall(value) {
-						funcName, args := parseFunctionCall(value)
-						resolvedFuncName := lexer.ResolveSymbol(funcName, currentModule)
-						if functionReturnsString(resolvedFuncName) {
-							if len(args) == 0 {
-								fmt.Fprintf(b, "%s%s(%s);\n", indent, resolvedFuncName, varName)
-							} else {
-								resolvedArgs := make([]string, len(args))
-								for i, arg := range args {
-									resolvedArgs[i] = lexer.ResolveSymbol(arg, currentModule)
-								}
-								fmt.Fprintf(b, "%s%s(%s, %s);\n", indent, resolvedFuncName, varName, strings.Join(resolvedArgs, ", "))
-							}
-						} else {
-							resolvedCall := resolveFunctionCall(value)
-							fmt.Fprintf(b, "%sstrcpy(%s, %s);\n", indent, varName, resolvedCall)
-						}
-					} else {
-						if !strings.HasPrefix(value, "\"") && !strings.HasSuffix(value, "\"") {
-							value = fmt.Sprintf("\"%s\"", value)
-						}
-						fmt.Fprintf(b, "%sstrcpy(%s, %s);\n", indent, varName, value)
-					}
-				}
+				r.declareString(b, indent, varName, value, false)
 			} else {
 				if isFunctionCall(value) {
-					value = resolveFunctionCall(value)
+					value = r.resolveFunctionCall(value)
 				}
 				fmt.Fprintf(b, "%s%s %s = %s;\n", indent, cType, varName, value)
 			}
 		case stmt.VarDeclRead != nil:
 			var (
-				varName   = lexer.ResolveSymbol(stmt.VarDeclRead.Name, currentModule)
+				varName   = lexer.ResolveSymbol(stmt.VarDeclRead.Name, r.currentModule)
 				filePath  = stmt.VarDeclRead.FilePath
 				fpVarName = fmt.Sprintf("fp_read_%s", varName)
 			)
@@ -2061,7 +1985,7 @@ func renderStatements(b *strings.Builder, stmts []*lexer.Statement, indent strin
 			fmt.Fprintf(b, "%s}\n", indent)
 		case stmt.VarDeclWrite != nil:
 			var (
-				content   = lexer.ResolveSymbol(stmt.VarDeclWrite.Content, currentModule)
+				content   = lexer.ResolveSymbol(stmt.VarDeclWrite.Content, r.currentModule)
 				filePath  = fmt.Sprintf("\"%s\"", stmt.VarDeclWrite.FilePath)
 				mode      = stmt.VarDeclWrite.Mode
 				fpVarName = fmt.Sprintf("fp_write_%d", len(stmt.VarDeclWrite.FilePath))
@@ -2085,6 +2009,10 @@ func renderStatements(b *strings.Builder, stmts []*lexer.Statement, indent strin
 
 			fmt.Fprintf(b, "%s    fclose(%s);\n", indent, fpVarName)
 			fmt.Fprintf(b, "%s}\n", indent)
+		case stmt.MethodCall != nil && r.isModuleCall(stmt.MethodCall.Object, stmt.MethodCall.Method, stmt.MethodCall.Args):
+			call := stmt.MethodCall
+			rendered, _ := r.moduleCall(call.Object, call.Method, call.Args)
+			fmt.Fprintf(b, "%s%s;\n", indent, rendered)
 		case stmt.MethodCall != nil:
 			objectName := stmt.MethodCall.Object
 			methodName := stmt.MethodCall.Method
@@ -2120,13 +2048,12 @@ func renderStatements(b *strings.Builder, stmts []*lexer.Statement, indent strin
 
 			args := make([]string, len(reconstructedArgs))
 			for i, arg := range reconstructedArgs {
-				resolvedArg := lexer.ResolveSymbol(arg, currentModule)
-				args[i] = processStringFunctionArg(resolvedArg)
+				args[i] = lexer.ResolveSymbol(arg, r.currentModule)
 			}
 			argsStr := strings.Join(args, ", ")
 
-			fmt.Printf("Debug: Method call - object: '%s', method: '%s', args: %v\n", objectName, methodName, stmt.MethodCall.Args)
-			fmt.Printf("Debug: Current class name: '%s'\n", className)
+			logging.Tracef("Method call - object: '%s', method: '%s', args: %v", objectName, methodName, stmt.MethodCall.Args)
+			logging.Tracef("Current class name: '%s'", className)
 
 			if objectName == "this" {
 				resolvedClassName := className
@@ -2140,319 +2067,146 @@ func renderStatements(b *strings.Builder, stmts []*lexer.Statement, indent strin
 							resolvedClassName = s.PubClassDecl.Name
 							break
 						}
-					}
-					// TODO: This is terrible.
-					if resolvedClassName == "" {
-						resolvedClassName = "Matrix"
-					}
-				}
-
-				methodExists := false
-				for _, s := range program.Statements {
-					var class *lexer.ClassDeclStmt
-					if s.ClassDecl != nil && s.ClassDecl.Name == resolvedClassName {
-						class = s.ClassDecl
-					} else if s.PubClassDecl != nil && s.PubClassDecl.Name == resolvedClassName {
-						class = &lexer.ClassDeclStmt{
-							Name:    s.PubClassDecl.Name,
-							Methods: s.PubClassDecl.Methods,
-						}
-					}
-
-					if class != nil {
-						for _, method := range class.Methods {
-							if method.Name == methodName {
-								methodExists = true
-								break
-							}
-						}
-						if methodExists {
-							break
-						}
-					}
-				}
-
-				if !methodExists {
-					fmt.Printf("Warning: Method '%s' not found in class '%s'\n", methodName, resolvedClassName)
-				}
-
-				if argsStr == "" {
-					fmt.Fprintf(b, "%s%s_%s(this);\n", indent, resolvedClassName, methodName)
-				} else {
-					fmt.Fprintf(b, "%s%s_%s(this, %s);\n", indent, resolvedClassName, methodName, argsStr)
-				}
-			} else {
-				objectName = lexer.ResolveSymbol(objectName, currentModule)
-				var resolvedClassName string
-				for _, obj := range globalObjects {
-					if obj.Name == stmt.MethodCall.Object {
-						resolvedClassName = obj.Type
-						if strings.Contains(resolvedClassName, ".") {
-							parts := strings.Split(resolvedClassName, ".")
-							resolvedClassName = lexer.GenerateUniqueSymbol(parts[1], parts[0])
-						} else if moduleName, exists := isImportedType(resolvedClassName, program.Imports); exists {
-							resolvedClassName = lexer.GenerateUniqueSymbol(resolvedClassName, moduleName)
-						}
-						break
-					}
-				}
-				if resolvedClassName == "" {
-					resolvedClassName = "unknown"
-				}
-				if argsStr == "" {
-					fmt.Fprintf(b, "%s%s_%s(%s);\n", indent, resolvedClassName, methodName, objectName)
-				} else {
-					fmt.Fprintf(b, "%s%s_%s(%s, %s);\n", indent, resolvedClassName, methodName, objectName, argsStr)
-				}
-			}
-		case stmt.FunctionCall != nil:
-			funcName := lexer.ResolveSymbol(stmt.FunctionCall.Name, currentModule)
-			args := make([]string, 0)
-
-			if functionReturnsString(funcName) {
-				fmt.Fprintf(b, "%s{\n", indent)
-				fmt.Fprintf(b, "%s    char temp_buffer[256];\n", indent)
-				fmt.Fprintf(b, "%s    %s(temp_buffer", indent, funcName)
-				for _, arg := range stmt.FunctionCall.Args {
-					resolvedArg := lexer.ResolveSymbol(arg, currentModule)
-					fmt.Fprintf(b, ", %s", resolvedArg)
-				}
-				fmt.Fprintf(b, ");\n")
-				fmt.Fprintf(b, "%s}\n", indent)
-			} else {
-				for _, arg := range stmt.FunctionCall.Args {
-					resolvedArg := lexer.ResolveSymbol(arg, currentModule)
-					args = append(args, resolvedArg)
-					if _, exists := globalArrays[arg]; exists {
-						args = append(args, fmt.Sprintf("len(%s)", arg))
-					}
-				}
-				argsStr := strings.Join(args, ", ")
-				fmt.Fprintf(b, "%s%s(%s);\n", indent, funcName, argsStr)
-			}
-		case stmt.RawCode != nil:
-			rawLines := strings.Split(stmt.RawCode.Code, "\n")
-			for _, rawLine := range rawLines {
-				if strings.TrimSpace(rawLine) != "" {
-					fmt.Fprintf(b, "%s%s\n", indent, rawLine)
-				} else {
-					b.WriteString("\n")
-				}
-			}
-		case stmt.MapDecl != nil:
-			var (
-				mapName     = lexer.ResolveSymbol(stmt.MapDecl.Name, currentModule)
-				keyType     = stmt.MapDecl.KeyType
-				valueType   = stmt.MapDecl.ValueType
-				cKeyType    = mapTypeToCType(keyType)
-				cValueType  = mapTypeToCType(valueType)
-				mapSize     = len(stmt.MapDecl.Pairs)
-				initialSize = mapSize
-			)
-
-			if initialSize == 0 {
-				initialSize = 10
-			}
-
-			if keyType == "string" {
-				fmt.Fprintf(b, "%schar %s_keys[%d][256];\n", indent, mapName, initialSize)
-			} else {
-				fmt.Fprintf(b, "%s %s_keys[%d];\n", cKeyType, mapName, initialSize)
-			}
-
-			if valueType == "string" {
-				fmt.Fprintf(b, "%schar %s_values[%d][256];\n", indent, mapName, initialSize)
-			} else {
-				fmt.Fprintf(b, "%s %s_values[%d];\n", cValueType, mapName, initialSize)
-			}
-
-			fmt.Fprintf(b, "%sint %s_size = %d;\n", indent, mapName, mapSize)
-
-			if indent != "" {
-				generateLocalMapAccessHelper(b, mapName, keyType, valueType, indent)
-			} else {
-				generateMapAccessHelper(b, mapName, keyType, valueType)
-			}
-
-			if len(stmt.MapDecl.Pairs) > 0 {
-				for i, pair := range stmt.MapDecl.Pairs {
-					key := pair.Key
-					value := pair.Value
-
-					if keyType == "string" {
-						if !strings.HasPrefix(key, "\"") && !strings.HasSuffix(key, "\"") {
-							key = fmt.Sprintf("\"%s\"", key)
-						}
-						fmt.Fprintf(b, "%sstrcpy(%s_keys[%d], %s);\n", indent, mapName, i, key)
-					} else {
-						fmt.Fprintf(b, "%s%s_keys[%d] = %s;\n", indent, mapName, i, key)
-					}
-
-					if valueType == "string" {
-						if !strings.HasPrefix(value, "\"") && !strings.HasSuffix(value, "\"") {
-							value = fmt.Sprintf("\"%s\"", value)
-						}
-						fmt.Fprintf(b, "%sstrcpy(%s_values[%d], %s);\n", indent, mapName, i, value)
-					} else {
-						fmt.Fprintf(b, "%s%s_values[%d] = %s;\n", indent, mapName, i, value)
+					}
+					// TODO: This is terrible.
+					if resolvedClassName == "" {
+						resolvedClassName = "Matrix"
 					}
 				}
-			}
-
-		case stmt.GetMap != nil:
-			expr := renderMapAccess(stmt.GetMap.MapName, stmt.GetMap.Key, program)
-			fmt.Fprintf(b, "%s%s", indent, expr)
 
-		case stmt.PutMap != nil:
-			mapName := lexer.ResolveSymbol(stmt.PutMap.MapName, currentModule)
-			key := stmt.PutMap.Key
-			value := stmt.PutMap.Value
-
-			var keyType, valueType string
-			for _, s := range program.Statements {
-				if s.MapDecl != nil && s.MapDecl.Name == stmt.PutMap.MapName {
-					keyType = s.MapDecl.KeyType
-					valueType = s.MapDecl.ValueType
-					break
+				if _, methodExists := r.methodOwner(resolvedClassName, methodName); !methodExists {
+					logging.Warnf("Method '%s' not found in class '%s'", methodName, resolvedClassName)
 				}
-				// Also check inside class declarations (both public and regular)
-				if s.ClassDecl != nil && s.ClassDecl.Constructor != nil {
-					for _, field := range s.ClassDecl.Constructor.Fields {
-						if field.MapDecl != nil && field.MapDecl.Name == stmt.PutMap.MapName {
-							keyType = field.MapDecl.KeyType
-							valueType = field.MapDecl.ValueType
-							break
+
+				fmt.Fprintf(b, "%s%s;\n", indent, r.methodCall(resolvedClassName, methodName, "this", argsStr))
+			} else {
+				objectName = lexer.ResolveSymbol(objectName, r.currentModule)
+				var resolvedClassName string
+				for _, obj := range r.globalObjects {
+					if obj.Name == stmt.MethodCall.Object {
+						resolvedClassName = obj.Type
+						if strings.Contains(resolvedClassName, ".") {
+							parts := strings.Split(resolvedClassName, ".")
+							resolvedClassName = lexer.GenerateUniqueSymbol(parts[1], parts[0])
+						} else if moduleName, exists := isImportedType(resolvedClassName, program.Imports); exists {
+							resolvedClassName = lexer.GenerateUniqueSymbol(resolvedClassName, moduleName)
 						}
-					}
-					if keyType != "" {
 						break
 					}
 				}
-				if s.PubClassDecl != nil && s.PubClassDecl.Constructor != nil {
-					for _, field := range s.PubClassDecl.Constructor.Fields {
-						if field.MapDecl != nil && field.MapDecl.Name == stmt.PutMap.MapName {
-							keyType = field.MapDecl.KeyType
-							valueType = field.MapDecl.ValueType
-							break
-						}
-					}
-					if keyType != "" {
-						break
-					}
+				if resolvedClassName == "" {
+					resolvedClassName, _ = r.listElementClass(stmt.MethodCall.Object)
 				}
-			}
-
-			// Fallback: If we couldn't find the map type in top-level declarations,
-			// try to infer it from common patterns for local maps
-			if keyType == "" && valueType == "" {
-				keyType = "string"
-				valueType = "bool"
-				if value == "true" || value == "false" {
-					valueType = "bool"
-				} else if strings.HasPrefix(value, "\"") && strings.HasSuffix(value, "\"") {
-					valueType = "string"
-				} else if strings.Contains(value, ".") {
-					valueType = "float"
-				} else {
-					if _, err := strconv.Atoi(value); err == nil {
-						valueType = "int"
-					}
+				if resolvedClassName == "" {
+					resolvedClassName, objectName, _ = r.chainedReceiver(stmt.MethodCall.Object)
+				}
+				if resolvedClassName == "" {
+					resolvedClassName = "unknown"
 				}
+				fmt.Fprintf(b, "%s%s;\n", indent, r.methodCall(resolvedClassName, methodName, objectName, argsStr))
 			}
+		case stmt.FunctionCall != nil:
+			funcName := lexer.ResolveSymbol(stmt.FunctionCall.Name, r.currentModule)
+			args := make([]string, 0)
 
-			fmt.Fprintf(b, "%s{\n", indent)
-			fmt.Fprintf(b, "%s    int found = 0;\n", indent)
-			fmt.Fprintf(b, "%s    for (int i = 0; i < %s_size; i++) {\n", indent, mapName)
-			if keyType == "string" {
-				if strings.HasPrefix(key, "\"") && strings.HasSuffix(key, "\"") {
-					keyStr := key[1 : len(key)-1]                     // Remove quotes
-					keyStr = strings.ReplaceAll(keyStr, "\"", "\\\"") // Escape quotes in the string
-					fmt.Fprintf(b, "%s        if (strcmp(%s_keys[i], \"%s\") == 0) {\n", indent, mapName, keyStr)
-				} else {
-					resolvedKey := lexer.ResolveSymbol(key, currentModule)
-					fmt.Fprintf(b, "%s        if (strcmp(%s_keys[i], %s) == 0) {\n", indent, mapName, resolvedKey)
-				}
+			if funcName == "append!" {
+				r.renderAppend(b, indent, stmt.FunctionCall.Args)
+			} else if funcName == "sort!" {
+				r.renderSort(b, indent, stmt.FunctionCall.Args, stmt.Line)
+			} else if funcName == "reverse!" {
+				r.renderReverse(b, indent, stmt.FunctionCall.Args, stmt.Line)
+			} else if r.isPanic(funcName) {
+				r.renderPanic(b, indent, stmt.FunctionCall.Args, stmt.Line)
+			} else if funcName == "pop!" && len(stmt.FunctionCall.Args) == 1 {
+				list := lexer.ResolveSymbol(stmt.FunctionCall.Args[0], r.currentModule)
+				fmt.Fprintf(b, "%s(void)__scar_list_pop(%s, %s_len);\n", indent, list, list)
+			} else if _, userDefined := r.globalFunctions[funcName]; funcName == "set_threads" && !userDefined {
+				fmt.Fprintf(b, "%somp_set_num_threads(%s);\n", indent, strings.Join(stmt.FunctionCall.Args, ", "))
 			} else {
-				fmt.Fprintf(b, "%s        if (%s_keys[i] == %s) {\n", indent, mapName, key)
+				args = r.renderCallArgs(r.globalFunctions[stmt.FunctionCall.Name], stmt.FunctionCall.Args)
+				call := fmt.Sprintf("%s(%s)", funcName, strings.Join(args, ", "))
+				if r.functionReturnsString(funcName) {
+					// The string returned is owned by the caller.
+					call = fmt.Sprintf("free(%s)", call)
+				}
+				fmt.Fprintf(b, "%s%s;\n", indent, call)
 			}
-
-			if valueType == "string" {
-				if strings.HasPrefix(value, "\"") && strings.HasSuffix(value, "\"") {
-					fmt.Fprintf(b, "%s            strcpy(%s_values[i], %s);\n", indent, mapName, value)
+		case stmt.RawCode != nil:
+			code := stmt.RawCode.Code
+			if r.inStringFunction() {
+				code = rawStringReturns(code)
+			}
+			rawLines := strings.Split(code, "\n")
+			for _, rawLine := range rawLines {
+				if strings.TrimSpace(rawLine) != "" {
+					fmt.Fprintf(b, "%s%s\n", indent, rawLine)
 				} else {
-					resolvedValue := lexer.ResolveSymbol(value, currentModule)
-					fmt.Fprintf(b, "%s            strcpy(%s_values[i], %s);\n", indent, mapName, resolvedValue)
+					b.WriteString("\n")
 				}
-			} else {
-				resolvedValue := lexer.ResolveSymbol(value, currentModule)
-				fmt.Fprintf(b, "%s            %s_values[i] = %s;\n", indent, mapName, resolvedValue)
 			}
+		case stmt.MapDecl != nil:
+			r.declareMap(b, indent, stmt.MapDecl)
+		case stmt.ArrayDecl != nil:
+			r.declareArray(b, indent, stmt.ArrayDecl)
+		case stmt.Delete != nil:
+			r.renderDelete(b, indent, stmt.Delete.Target)
 
-			fmt.Fprintf(b, "%s            found = 1;\n", indent)
-			fmt.Fprintf(b, "%s            break;\n", indent)
-			fmt.Fprintf(b, "%s        }\n", indent)
-			fmt.Fprintf(b, "%s    }\n", indent)
-
-			fmt.Fprintf(b, "%s    if (!found && %s_size < 100) {\n", indent, mapName)
+		case stmt.GetMap != nil:
+			expr := r.renderMapAccess(stmt.GetMap.MapName, stmt.GetMap.Key)
+			fmt.Fprintf(b, "%s%s", indent, expr)
 
-			if keyType == "string" {
-				if strings.HasPrefix(key, "\"") && strings.HasSuffix(key, "\"") {
-					keyStr := key[1 : len(key)-1]                     // Remove quotes
-					keyStr = strings.ReplaceAll(keyStr, "\"", "\\\"") // Escape quotes in the string
-					fmt.Fprintf(b, "%s        strcpy(%s_keys[%s_size], \"%s\");\n", indent, mapName, mapName, keyStr)
-				} else {
-					resolvedKey := lexer.ResolveSymbol(key, currentModule)
-					fmt.Fprintf(b, "%s        strcpy(%s_keys[%s_size], %s);\n", indent, mapName, mapName, resolvedKey)
-				}
-			} else {
-				resolvedKey := lexer.ResolveSymbol(key, currentModule)
-				fmt.Fprintf(b, "%s        %s_keys[%s_size] = %s;\n", indent, mapName, mapName, resolvedKey)
+		case stmt.PutMap != nil:
+			r.renderMapPut(b, indent, stmt.PutMap)
+		case stmt.DelMap != nil:
+			r.renderMapDel(b, indent, stmt.DelMap)
+		case stmt.SetDecl != nil:
+			r.declareSet(b, indent, stmt.SetDecl)
+		case stmt.SetAdd != nil:
+			r.renderSetAdd(b, indent, stmt.SetAdd)
+		case stmt.SetRemove != nil:
+			r.renderSetRemove(b, indent, stmt.SetRemove)
+		case stmt.ParallelFor != nil:
+			varName := lexer.ResolveSymbol(stmt.ParallelFor.Var, r.currentModule)
+			start := lexer.ResolveSymbol(stmt.ParallelFor.Start, r.currentModule)
+			end := lexer.ResolveSymbol(stmt.ParallelFor.End, r.currentModule)
+			end = r.convertThisReferencesGranular(end)
+			if r.opts.NoOpenMP {
+				fmt.Fprintf(b, "%sfor (int %s = %s; %s <= %s; %s++) {\n", indent, varName, start, varName, end, varName)
+				r.renderLoopBody(b, "", stmt.ParallelFor.Body, indent, className, program, currentFunctionReturnType)
+				break
 			}
-			if valueType == "string" {
-				if strings.HasPrefix(value, "\"") && strings.HasSuffix(value, "\"") {
-					fmt.Fprintf(b, "%s        strcpy(%s_values[%s_size], %s);\n", indent, mapName, mapName, value)
-				} else {
-					resolvedValue := lexer.ResolveSymbol(value, currentModule)
-					fmt.Fprintf(b, "%s        strcpy(%s_values[%s_size], %s);\n", indent, mapName, mapName, resolvedValue)
+			fmt.Fprintf(b, "%s#pragma omp parallel for", indent)
+			for _, reduction := range stmt.ParallelFor.Reductions {
+				op, vars, _ := strings.Cut(reduction, ":")
+				names := strings.Split(vars, ",")
+				for i, name := range names {
+					names[i] = lexer.ResolveSymbol(strings.TrimSpace(name), r.currentModule)
 				}
-			} else {
-				resolvedValue := lexer.ResolveSymbol(value, currentModule)
-				fmt.Fprintf(b, "%s        %s_values[%s_size] = %s;\n", indent, mapName, mapName, resolvedValue)
+				fmt.Fprintf(b, " reduction(%s: %s)", op, strings.Join(names, ", "))
 			}
-
-			fmt.Fprintf(b, "%s        %s_size++;\n", indent, mapName)
-			fmt.Fprintf(b, "%s    }\n", indent)
-			fmt.Fprintf(b, "%s}\n", indent)
-		case stmt.ParallelFor != nil:
-			varName := lexer.ResolveSymbol(stmt.ParallelFor.Var, currentModule)
-			start := lexer.ResolveSymbol(stmt.ParallelFor.Start, currentModule)
-			end := lexer.ResolveSymbol(stmt.ParallelFor.End, currentModule)
-			end = convertThisReferencesGranular(end)
-			fmt.Fprintf(b, "%s#pragma omp parallel for\n", indent)
+			if threads := stmt.ParallelFor.Threads; threads != "" {
+				fmt.Fprintf(b, " num_threads(%s)", r.convertThisReferencesGranular(resolveImportedSymbols(threads, program.Imports)))
+			}
+			if schedule := stmt.ParallelFor.Schedule; schedule != "" {
+				fmt.Fprintf(b, " schedule(%s)", r.convertThisReferencesGranular(resolveImportedSymbols(schedule, program.Imports)))
+			}
+			b.WriteString("\n")
 			fmt.Fprintf(b, "%sfor (int %s = %s; %s <= %s; %s++) {\n", indent, varName, start, varName, end, varName)
-			renderStatements(b, stmt.ParallelFor.Body, indent+"    ", className, program, currentFunctionReturnType)
-			fmt.Fprintf(b, "%s}\n", indent)
+			r.renderLoopBody(b, "", stmt.ParallelFor.Body, indent, className, program, currentFunctionReturnType)
 		}
 	}
 }
 
-func fixFloatCastGranular(expr string) string {
-	return strings.ReplaceAll(expr, "float(", "(float)(")
-}
-
 // Converts 'new ClassName(args)' to 'ClassName_new(args)'
-func convertNewToConstructor(expr string) string {
+func (r *Renderer) convertNewToConstructor(expr string) string {
 	if !strings.HasPrefix(expr, "new ") {
 		return expr
 	}
 
 	src := strings.TrimSpace(expr[3:])
-	if src == "" {
-		return fmt.Sprintf("%s_new()", strings.TrimSpace(src))
-	}
 	parenPos := strings.Index(src, "(")
 	if parenPos == -1 {
-		return fmt.Sprintf("%s_new()", strings.TrimSpace(src))
+		return r.allocatedAt(fmt.Sprintf("%s_new()", src))
 	}
 
 	className := strings.TrimSpace(src[:parenPos])
@@ -2462,7 +2216,7 @@ func convertNewToConstructor(expr string) string {
 	}
 	args := src[parenPos : closeParen+1]
 
-	return fmt.Sprintf("%s_new%s", className, args)
+	return r.allocatedAt(fmt.Sprintf("%s_new%s", className, args))
 }
 
 func reconstructMethodCalls(variables []string) []string {
@@ -2495,10 +2249,16 @@ func reconstructMethodCalls(variables []string) []string {
 	return result
 }
 
-func convertThisReferencesGranular(expr string) string {
+func (r *Renderer) convertThisReferencesGranular(expr string) string {
 	if expr == "" {
 		return expr
 	}
+	if tree, err := lexer.ParseExpr(lexer.ReplaceDoubleColonsOutsideStrings(expr)); err == nil {
+		return r.renderExpr(tree)
+	}
+
+	// Expressions the parser does not understand, such as raw C fragments,
+	// are rewritten textually.
 	var stringLiterals []string
 	reString := regexp.MustCompile(`"(?:\\.|[^"\\])*"`)
 	expr = reString.ReplaceAllStringFunc(expr, func(match string) string {
@@ -2506,7 +2266,7 @@ func convertThisReferencesGranular(expr string) string {
 		return fmt.Sprintf("__STRING_LITERAL_%d__", len(stringLiterals)-1)
 	})
 	if isMethodCall(expr) {
-		expr = convertMethodCallToC(expr)
+		expr = r.convertMethodCallToC(expr)
 	}
 
 	expr = strings.Join(strings.Fields(expr), " ")
@@ -2523,7 +2283,7 @@ func convertThisReferencesGranular(expr string) string {
 			varName := strings.TrimSpace(parts[0])
 			fieldName := strings.TrimSpace(parts[1])
 
-			for _, obj := range globalObjects {
+			for _, obj := range r.globalObjects {
 				if obj.Name == varName {
 					return fmt.Sprintf("%s->%s", varName, fieldName)
 				}
@@ -2547,8 +2307,13 @@ func convertThisReferencesGranular(expr string) string {
 		expr = "NULL"
 	}
 
+	// Handle logical keywords
+	expr = regexp.MustCompile(`\band\b`).ReplaceAllString(expr, "&&")
+	expr = regexp.MustCompile(`\bor\b`).ReplaceAllString(expr, "||")
+	expr = regexp.MustCompile(`\bnot\b\s*`).ReplaceAllString(expr, "!")
+
 	if isMethodCall(expr) {
-		expr = convertMethodCallToC(expr)
+		expr = r.convertMethodCallToC(expr)
 	}
 
 	for i, lit := range stringLiterals {
@@ -2558,8 +2323,52 @@ func convertThisReferencesGranular(expr string) string {
 	return expr
 }
 
+// Renders the condition of an if, elif or match as C.
+func (r *Renderer) renderCondition(condition string, program *lexer.Program) string {
+	// Process get! and has! expressions first (before this. conversion)
+	condition = r.processGetExpressions(condition, program)
+	condition = r.processHasExpressions(condition, program)
+
+	if isMethodCall(condition) {
+		condition = r.convertMethodCallToC(condition)
+	} else {
+		condition = lexer.ResolveSymbol(condition, r.currentModule)
+	}
+
+	// Convert this references after macro processing
+	condition = r.convertThisReferencesGranular(condition)
+	return resolveImportedSymbols(condition, program.Imports)
+}
+
+// Renders an argument of a formatted print as C.
+func (r *Renderer) renderPrintArg(v string, program *lexer.Program) string {
+	if strings.HasPrefix(v, "get!") {
+		getArgs := v[4:]
+		getArgs = strings.TrimSpace(getArgs[1 : len(getArgs)-1])
+		parts := strings.SplitN(getArgs, ",", 2)
+		if len(parts) == 2 {
+			mapName := strings.TrimSpace(parts[0])
+			key := strings.TrimSpace(parts[1])
+			return r.renderMapAccess(mapName, key)
+		}
+		return v
+	}
+	if conversion, ok := r.enumCallSource(v); ok {
+		return conversion
+	}
+	if chain, ok := memberChain(v); ok {
+		return r.renderExpr(chain)
+	}
+	if isMethodCall(v) {
+		return r.convertMethodCallToC(v)
+	}
+	resolvedVar := lexer.ResolveSymbol(v, r.currentModule)
+	resolvedVar = r.convertThisReferencesGranular(resolvedVar)
+	return r.resolveLenFunctionCalls(resolvedVar)
+}
+
 // Processes all get! expressions in a string and replaces them with the C code
-func processGetExpressions(expr string, program *lexer.Program) string {
+func (r *Renderer) processGetExpressions(expr string, program *lexer.Program) string {
 	re := regexp.MustCompile(`get!\s*\(([^)]+)\)`)
 	matches := re.FindAllStringSubmatchIndex(expr, -1)
 	if len(matches) == 0 {
@@ -2603,7 +2412,7 @@ func processGetExpressions(expr string, program *lexer.Program) string {
 			var (
 				mapName = args[0]
 				key     = args[1]
-				cCode   = renderMapAccess(mapName, key, program)
+				cCode   = r.renderMapAccess(mapName, key)
 				before  = result[:match[0]+offset]
 				after   = result[match[1]+offset:]
 			)
@@ -2616,7 +2425,7 @@ func processGetExpressions(expr string, program *lexer.Program) string {
 }
 
 // Processes all has! expressions in a string and replaces them with the C code
-func processHasExpressions(expr string, program *lexer.Program) string {
+func (r *Renderer) processHasExpressions(expr string, program *lexer.Program) string {
 	re := regexp.MustCompile(`has!\s*\(([^)]+)\)`)
 	matches := re.FindAllStringSubmatchIndex(expr, -1)
 	if len(matches) == 0 {
@@ -2660,7 +2469,7 @@ func processHasExpressions(expr string, program *lexer.Program) string {
 			var (
 				mapName = args[0]
 				key     = args[1]
-				cCode   = renderMapHas(mapName, key, program)
+				cCode   = r.renderMapHas(mapName, key)
 				before  = result[:match[0]+offset]
 				after   = result[match[1]+offset:]
 			)
@@ -2757,7 +2566,10 @@ func findMatchingParen(s string, openPos int) int {
 }
 
 // Converts method calls in the format 'this.method(args)' to 'ClassName_method(this, args)'
-func convertMethodCallToC(expr string) string {
+func (r *Renderer) convertMethodCallToC(expr string) string {
+	if call, ok := r.moduleCallSource(expr); ok {
+		return call
+	}
 	// Handle comparison operators
 	comparisonOps := []string{"==", "!=", ">", "<", ">=", "<="}
 	var op, left, right string
@@ -2775,7 +2587,7 @@ func convertMethodCallToC(expr string) string {
 		}
 	}
 	if hasComparison && (strings.HasPrefix(left, "this.") || strings.Contains(left, "(")) {
-		convertedLeft := convertSingleMethodCall(left)
+		convertedLeft := r.convertSingleMethodCall(left)
 		if convertedLeft != "" {
 			return fmt.Sprintf("%s %s %s", convertedLeft, op, right)
 		}
@@ -2801,325 +2613,27 @@ func convertMethodCallToC(expr string) string {
 			right = strings.TrimSpace(expr[opIndex+len(arithOp):])
 			op = arithOp
 			hasArithmetic = true
-			fmt.Printf("Debug: Found arithmetic operator '%s' at index %d, left='%s', right='%s'\n", arithOp, opIndex, left, right)
+			logging.Tracef("Found arithmetic operator '%s' at index %d, left='%s', right='%s'", arithOp, opIndex, left, right)
 			break
 		}
 	}
 
 	if hasArithmetic && isMethodCall(left) {
-		convertedLeft := convertSingleMethodCall(left)
+		convertedLeft := r.convertSingleMethodCall(left)
+		if isMethodCall(right) {
+			right = r.convertMethodCallToC(right)
+		}
 		if convertedLeft != "" {
-			fmt.Printf("Debug: Converted arithmetic expression: '%s %s %s'\n", convertedLeft, op, right)
+			logging.Tracef("Converted arithmetic expression: '%s %s %s'", convertedLeft, op, right)
 			return fmt.Sprintf("%s %s %s", convertedLeft, op, right)
 		}
 	}
 
-	fmt.Printf("Debug: convertMethodCallToC called with: '%s', falling back to convertSingleMethodCall\n", expr)
-	return convertSingleMethodCall(expr)
-}
-
-// Generates a function for map access
-func generateMapAccessHelper(b *strings.Builder, mapName, keyType, valueType string) {
-	helperName := fmt.Sprintf("__get_%s_value", mapName)
-
-	// Handle key type conversion
-	var cKeyType string
-	switch keyType {
-	case "string":
-		cKeyType = "char*"
-	case "char":
-		cKeyType = "char"
-	default:
-		cKeyType = mapTypeToCType(keyType)
-	}
-
-	// Handle value type conversion - for return type
-	var cValueType string
-	switch valueType {
-	case "string":
-		cValueType = "char*"
-	case "char":
-		cValueType = "char"
-	default:
-		cValueType = mapTypeToCType(valueType)
-	}
-
-	fmt.Fprintf(b, "%s %s(%s key) {\n", cValueType, helperName, cKeyType)
-	fmt.Fprintf(b, "    for (int i = 0; i < %s_size; i++) {\n", mapName)
-
-	// Key comparison
-	if keyType == "string" {
-		// String key comparison
-		fmt.Fprintf(b, "        if (strcmp(%s_keys[i], key) == 0) {\n", mapName)
-	} else {
-		// Numeric or char key comparison
-		fmt.Fprintf(b, "        if (%s_keys[i] == key) {\n", mapName)
-	}
-
-	// Return value - for string values, x_values[i] is already char*
-	fmt.Fprintf(b, "            return %s_values[i];\n", mapName)
-
-	fmt.Fprintf(b, "        }\n")
-	fmt.Fprintf(b, "    }\n")
-
-	// Default return value
-	switch valueType {
-	case "string":
-		fmt.Fprintf(b, "    return \"\";\n")
-	case "char":
-		fmt.Fprintf(b, "    return '\\0';\n")
-	default:
-		fmt.Fprintf(b, "    return 0;\n")
-	}
-
-	fmt.Fprintf(b, "}\n\n")
-
-	if keyType == "string" {
-		fmt.Fprintf(b, "char* __get_%s_key_at(int index) {\n", mapName)
-		fmt.Fprintf(b, "    if (index >= 0 && index < %s_size) {\n", mapName)
-		fmt.Fprintf(b, "        return %s_keys[index];\n", mapName)
-		fmt.Fprintf(b, "    }\n")
-		fmt.Fprintf(b, "    return \"\";\n")
-		fmt.Fprintf(b, "}\n\n")
-	} else {
-		cKeyType := mapTypeToCType(keyType)
-		fmt.Fprintf(b, "%s __get_%s_key_at(int index) {\n", cKeyType, mapName)
-		fmt.Fprintf(b, "    if (index >= 0 && index < %s_size) {\n", mapName)
-		fmt.Fprintf(b, "        return %s_keys[index];\n", mapName)
-		fmt.Fprintf(b, "    }\n")
-		if keyType == "char" {
-			fmt.Fprintf(b, "    return '\\0';\n")
-		} else {
-			fmt.Fprintf(b, "    return 0;\n")
-		}
-		fmt.Fprintf(b, "}\n\n")
-	}
-
-	fmt.Fprintf(b, "int __get_%s_size() {\n", mapName)
-	fmt.Fprintf(b, "    return %s_size;\n", mapName)
-	fmt.Fprintf(b, "}\n\n")
-}
-
-func generateLocalMapAccessHelper(b *strings.Builder, mapName, keyType, valueType string, indent string) {
-	var cKeyType string
-	switch keyType {
-	case "string":
-		cKeyType = "char*"
-	case "char":
-		cKeyType = "char"
-	default:
-		cKeyType = mapTypeToCType(keyType)
-	}
-	var cValueType string
-	switch valueType {
-	case "string":
-		cValueType = "char*"
-	case "char":
-		cValueType = "char"
-	default:
-		cValueType = mapTypeToCType(valueType)
-	}
-	helperName := fmt.Sprintf("__get_%s_value", mapName)
-	fmt.Fprintf(b, "%s%s %s(%s key) {\n", indent, cValueType, helperName, cKeyType)
-	fmt.Fprintf(b, "%s    for (int i = 0; i < %s_size; i++) {\n", indent, mapName)
-	if keyType == "string" {
-		fmt.Fprintf(b, "%s        if (strcmp(%s_keys[i], key) == 0) {\n", indent, mapName)
-	} else {
-		fmt.Fprintf(b, "%s        if (%s_keys[i] == key) {\n", indent, mapName)
-	}
-	fmt.Fprintf(b, "%s            return %s_values[i];\n", indent, mapName)
-	fmt.Fprintf(b, "%s        }\n", indent)
-	fmt.Fprintf(b, "%s    }\n", indent)
-	switch valueType {
-	case "string":
-		fmt.Fprintf(b, "%s    return \"\";\n", indent)
-	case "char":
-		fmt.Fprintf(b, "%s    return '\\0';\n", indent)
-	default:
-		fmt.Fprintf(b, "%s    return 0;\n", indent)
-	}
-	fmt.Fprintf(b, "%s}\n\n", indent)
-	if keyType == "string" {
-		fmt.Fprintf(b, "%schar* __get_%s_key_at(int index) {\n", indent, mapName)
-		fmt.Fprintf(b, "%s    if (index >= 0 && index < %s_size) {\n", indent, mapName)
-		fmt.Fprintf(b, "%s        return %s_keys[index];\n", indent, mapName)
-		fmt.Fprintf(b, "%s    }\n", indent)
-		fmt.Fprintf(b, "%s    return \"\";\n", indent)
-		fmt.Fprintf(b, "%s}\n\n", indent)
-	} else {
-		cKeyType := mapTypeToCType(keyType)
-		fmt.Fprintf(b, "%s%s __get_%s_key_at(int index) {\n", indent, cKeyType, mapName)
-		fmt.Fprintf(b, "%s    if (index >= 0 && index < %s_size) {\n", indent, mapName)
-		fmt.Fprintf(b, "%s        return %s_keys[index];\n", indent, mapName)
-		fmt.Fprintf(b, "%s    }\n", indent)
-		if keyType == "char" {
-			fmt.Fprintf(b, "%s    return '\\0';\n", indent)
-		} else {
-			fmt.Fprintf(b, "%s    return 0;\n", indent)
-		}
-		fmt.Fprintf(b, "%s}\n\n", indent)
-	}
-
-	fmt.Fprintf(b, "%sint __get_%s_size() {\n", indent, mapName)
-	fmt.Fprintf(b, "%s    return %s_size;\n", indent, mapName)
-	fmt.Fprintf(b, "%s}\n\n", indent)
-	fmt.Fprintf(b, "%sint __has_%s_key(%s key) {\n", indent, mapName, cKeyType)
-	fmt.Fprintf(b, "%s    for (int i = 0; i < %s_size; i++) {\n", indent, mapName)
-	if keyType == "string" {
-		fmt.Fprintf(b, "%s        if (strcmp(%s_keys[i], key) == 0) {\n", indent, mapName)
-	} else {
-		fmt.Fprintf(b, "%s        if (%s_keys[i] == key) {\n", indent, mapName)
-	}
-	fmt.Fprintf(b, "%s            return 1;\n", indent)
-	fmt.Fprintf(b, "%s        }\n", indent)
-	fmt.Fprintf(b, "%s    }\n", indent)
-	fmt.Fprintf(b, "%s    return 0;\n", indent)
-	fmt.Fprintf(b, "%s}\n\n", indent)
-}
-
-// Generates a C expression for accessing a map value by key
-func renderMapAccess(mapName, key string, program *lexer.Program) string {
-	if after, ok := strings.CutPrefix(mapName, "this."); ok {
-		fieldName := after
-		var keyType string
-		for _, s := range program.Statements {
-			if s.ClassDecl != nil && s.ClassDecl.Constructor != nil {
-				for _, stmt := range s.ClassDecl.Constructor.Fields {
-					if stmt.MapDecl != nil && strings.HasPrefix(stmt.MapDecl.Name, "this.") {
-						declFieldName := strings.TrimPrefix(stmt.MapDecl.Name, "this.")
-						if declFieldName == fieldName {
-							keyType = stmt.MapDecl.KeyType
-							break
-						}
-					}
-				}
-			}
-			if s.PubClassDecl != nil && s.PubClassDecl.Constructor != nil {
-				for _, stmt := range s.PubClassDecl.Constructor.Fields {
-					if stmt.MapDecl != nil && strings.HasPrefix(stmt.MapDecl.Name, "this.") {
-						declFieldName := strings.TrimPrefix(stmt.MapDecl.Name, "this.")
-						if declFieldName == fieldName {
-							keyType = stmt.MapDecl.KeyType
-							break
-						}
-					}
-				}
-			}
-		}
-
-		helperName := fmt.Sprintf("%s_get_%s_value", currentClassName, fieldName)
-
-		var keyExpr string
-		if keyType == "string" {
-			if strings.HasPrefix(key, "\"") && strings.HasSuffix(key, "\"") {
-				keyStr := key[1 : len(key)-1]
-				keyStr = strings.ReplaceAll(keyStr, "\"", "\\\"")
-				keyExpr = fmt.Sprintf(`"%s"`, keyStr)
-			} else {
-				keyExpr = lexer.ResolveSymbol(key, currentModule)
-			}
-		} else {
-			if !unicode.IsDigit(rune(key[0])) && !(key[0] == '-' && len(key) > 1 && unicode.IsDigit(rune(key[1]))) {
-				key = lexer.ResolveSymbol(key, currentModule)
-			}
-			keyExpr = key
-		}
-
-		return fmt.Sprintf("%s(this, %s)", helperName, keyExpr)
-	}
-
-	resolvedMapName := lexer.ResolveSymbol(mapName, currentModule)
-
-	// Find the map to determine key type
-	var keyType string
-	for _, s := range program.Statements {
-		if s.MapDecl != nil && s.MapDecl.Name == mapName {
-			keyType = s.MapDecl.KeyType
-			break
-		}
-	}
-
-	helperName := fmt.Sprintf("__get_%s_value", resolvedMapName)
-
-	var keyExpr string
-	if keyType == "string" || keyType == "char*" {
-		if strings.HasPrefix(key, "\"") && strings.HasSuffix(key, "\"") {
-			keyStr := key[1 : len(key)-1]                     // Remove quotes
-			keyStr = strings.ReplaceAll(keyStr, "\"", "\\\"") // Escape quotes
-			keyExpr = fmt.Sprintf(`"%s"`, keyStr)
-		} else {
-			keyExpr = lexer.ResolveSymbol(key, currentModule)
-			if keyExpr == key && len(key) == 3 && key[0] == '\'' && key[2] == '\'' {
-				keyExpr = fmt.Sprintf("'%c'", key[1])
-			}
-		}
-	} else {
-		if !unicode.IsDigit(rune(key[0])) && !(key[0] == '-' && len(key) > 1 && unicode.IsDigit(rune(key[1]))) {
-			key = lexer.ResolveSymbol(key, currentModule)
-		}
-		keyExpr = key
-		if keyType == "char" && len(keyExpr) == 3 && keyExpr[0] == '\'' && keyExpr[2] == '\'' {
-			keyExpr = fmt.Sprintf("'%c'", keyExpr[1])
-		}
-	}
-
-	return fmt.Sprintf("%s(%s)", helperName, keyExpr)
-}
-
-func renderMapHas(mapName, key string, program *lexer.Program) string {
-	if after, ok := strings.CutPrefix(mapName, "this."); ok {
-		fieldName := after
-		var keyType string
-		for _, s := range program.Statements {
-			if s.ClassDecl != nil && s.ClassDecl.Constructor != nil {
-				for _, stmt := range s.ClassDecl.Constructor.Fields {
-					if stmt.MapDecl != nil && strings.HasPrefix(stmt.MapDecl.Name, "this.") {
-						declFieldName := strings.TrimPrefix(stmt.MapDecl.Name, "this.")
-						if declFieldName == fieldName {
-							keyType = stmt.MapDecl.KeyType
-							break
-						}
-					}
-				}
-			}
-			if s.PubClassDecl != nil && s.PubClassDecl.Constructor != nil {
-				for _, stmt := range s.PubClassDecl.Constructor.Fields {
-					if stmt.MapDecl != nil && strings.HasPrefix(stmt.MapDecl.Name, "this.") {
-						declFieldName := strings.TrimPrefix(stmt.MapDecl.Name, "this.")
-						if declFieldName == fieldName {
-							keyType = stmt.MapDecl.KeyType
-							break
-						}
-					}
-				}
-			}
-		}
-
-		var keyExpr string
-		if keyType == "string" {
-			if strings.HasPrefix(key, "\"") && strings.HasSuffix(key, "\"") {
-				keyStr := key[1 : len(key)-1]
-				keyStr = strings.ReplaceAll(keyStr, "\"", "\\\"")
-				keyExpr = fmt.Sprintf(`"%s"`, keyStr)
-			} else {
-				resolvedKey := lexer.ResolveSymbol(key, "")
-				keyExpr = resolvedKey
-			}
-			return fmt.Sprintf("(__check_string_key_exists(this->%s_keys, this->%s_size, %s))", fieldName, fieldName, keyExpr)
-		} else {
-			if !unicode.IsDigit(rune(key[0])) && !(key[0] == '-' && len(key) > 1 && unicode.IsDigit(rune(key[1]))) {
-				key = lexer.ResolveSymbol(key, "")
-			}
-			keyExpr = key
-			return fmt.Sprintf("(__check_key_exists(this->%s_keys, this->%s_size, %s))", fieldName, fieldName, keyExpr)
-		}
-	}
-
-	resolvedMapName := lexer.ResolveSymbol(mapName, "")
-	return fmt.Sprintf("(__has_%s_key(%s))", resolvedMapName, lexer.ResolveSymbol(key, ""))
+	logging.Tracef("convertMethodCallToC called with: '%s', falling back to convertSingleMethodCall", expr)
+	return r.convertSingleMethodCall(expr)
 }
 
-func convertSingleMethodCall(expr string) string {
+func (r *Renderer) convertSingleMethodCall(expr string) string {
 	if strings.Contains(expr, "this.") {
 		startIdx := strings.Index(expr, "this.")
 		if startIdx == -1 {
@@ -3138,7 +2652,7 @@ func convertSingleMethodCall(expr string) string {
 		parenIndex += dotIndex
 		var (
 			methodName = expr[dotIndex+1 : parenIndex]
-			className  = currentClassName
+			className  = r.currentClassName
 		)
 		if className == "" {
 			return expr
@@ -3154,17 +2668,14 @@ func convertSingleMethodCall(expr string) string {
 
 		if args != "" {
 			if strings.Contains(args, "this.") {
-				nestedProcessed := convertMethodCallToC(args)
+				nestedProcessed := r.convertMethodCallToC(args)
 				if nestedProcessed != args {
 					expr = expr[:parenIndex+1] + nestedProcessed + expr[closeParen:]
-					return convertSingleMethodCall(expr)
+					return r.convertSingleMethodCall(expr)
 				}
 			}
 		}
-		if args == "" {
-			return fmt.Sprintf("%s_%s(this)", className, methodName)
-		}
-		return fmt.Sprintf("%s_%s(this, %s)", className, methodName, args)
+		return r.methodCall(className, methodName, "this", args)
 	}
 	dotIndex := strings.Index(expr, ".")
 	if dotIndex == -1 {
@@ -3195,7 +2706,7 @@ func convertSingleMethodCall(expr string) string {
 	}
 
 	var resolvedClassName string
-	for objName, obj := range globalObjects {
+	for objName, obj := range r.globalObjects {
 		if objName == objectName {
 			resolvedClassName = obj.Type
 			if strings.Contains(resolvedClassName, ".") {
@@ -3206,37 +2717,30 @@ func convertSingleMethodCall(expr string) string {
 		}
 	}
 
+	if resolvedClassName == "" {
+		resolvedClassName, _ = r.listElementClass(objectName)
+	}
 	if resolvedClassName == "" {
 		return expr
 	}
 
-	resolvedObjectName := lexer.ResolveSymbol(objectName, currentModule)
+	resolvedObjectName := lexer.ResolveSymbol(objectName, r.currentModule)
 
 	if args == "" {
-		return fmt.Sprintf("%s_%s(%s)", resolvedClassName, methodName, resolvedObjectName)
+		return r.methodCall(resolvedClassName, methodName, resolvedObjectName, "")
 	}
-
-	processedArgs := processMethodArguments(args)
-	return fmt.Sprintf("%s_%s(%s, %s)", resolvedClassName, methodName, resolvedObjectName, processedArgs)
+	return r.methodCall(resolvedClassName, methodName, resolvedObjectName, strings.TrimSpace(args))
 }
 
-func generateTopLevelFunctionImplementation(b *strings.Builder, funcDecl *lexer.TopLevelFuncDeclStmt, program *lexer.Program) {
-	currentFunction = funcDecl
-	defer func() { currentFunction = nil }()
+func (r *Renderer) generateTopLevelFunctionImplementation(b *strings.Builder, funcDecl *lexer.TopLevelFuncDeclStmt, program *lexer.Program) {
+	r.currentFunction = funcDecl
+	defer func() { r.currentFunction = nil }()
 
 	// This means return array length.
 	returnType := "int"
 
-	if strings.HasPrefix(funcDecl.ReturnType, "list[") && strings.HasSuffix(funcDecl.ReturnType, "]") {
-		returnType = "int"
-	} else if funcDecl.ReturnType != "" && funcDecl.ReturnType != "void" {
-		if funcDecl.ReturnType == "string" {
-			returnType = "void"
-		} else {
-			returnType = mapTypeToCType(funcDecl.ReturnType)
-		}
-	} else {
-		returnType = "void"
+	if !strings.HasPrefix(funcDecl.ReturnType, "list[") || !strings.HasSuffix(funcDecl.ReturnType, "]") {
+		returnType = r.methodReturnType(funcDecl.ReturnType)
 	}
 
 	fmt.Fprintf(b, "%s %s(", returnType, funcDecl.Name)
@@ -3248,86 +2752,32 @@ func generateTopLevelFunctionImplementation(b *strings.Builder, funcDecl *lexer.
 		if innerType == "string" {
 			paramList = append(paramList, "char _output_array[][256]")
 		} else {
-			cType := mapTypeToCType(innerType)
+			cType := r.mapTypeToCType(innerType)
 			paramList = append(paramList, fmt.Sprintf("%s _output_array[]", cType))
 		}
 		paramList = append(paramList, "int _max_size")
-	} else if funcDecl.ReturnType == "string" {
-		paramList = append(paramList, "char* _output_buffer")
 	}
 
 	for _, param := range funcDecl.Parameters {
-		var (
-			paramType = mapTypeToCType(param.Type)
-			paramName = param.Name
-		)
 		if param.IsList || strings.HasPrefix(param.Type, "list[") {
-			if param.Type == "string" {
-				paramList = append(paramList, fmt.Sprintf("char %s[][256]", paramName))
-			} else {
-				paramList = append(paramList, fmt.Sprintf("%s %s[]", paramType, paramName))
-			}
-			paramList = append(paramList, fmt.Sprintf("int %s_len", paramName))
+			paramList = append(paramList, r.listParams(listParamElemType(param), param.Name)...)
 		} else {
-			if param.Type == "string" {
-				paramType = "char*"
-			}
-			if param.IsRef {
-				paramType = paramType + "*"
-			}
-			paramList = append(paramList, fmt.Sprintf("%s %s", paramType, paramName))
+			paramList = append(paramList, fmt.Sprintf("%s %s", r.functionParamType(param), param.Name))
 		}
 	}
 
 	b.WriteString(strings.Join(paramList, ", "))
 	b.WriteString(") {\n")
+	r.enterContext(b, funcDecl.Name)
+	r.declareParamTypes(funcDecl.Parameters)
 
 	if funcDecl.ReturnType == "string" {
-		for _, stmt := range funcDecl.Body {
-			if stmt.RawCode != nil {
-				modifiedCode := strings.ReplaceAll(stmt.RawCode.Code, "return buffer;", "strcpy(_output_buffer, buffer); return;")
-				modifiedCode = strings.ReplaceAll(modifiedCode, `return "";`, `strcpy(_output_buffer, ""); return;`)
-				rawLines := strings.SplitSeq(modifiedCode, "\n")
-				for rawLine := range rawLines {
-					if strings.TrimSpace(rawLine) != "" {
-						fmt.Fprintf(b, "    %s\n", rawLine)
-					} else {
-						b.WriteString("\n")
-					}
-				}
-			} else if stmt.Return != nil {
-				value := stmt.Return.Value
-				if isFunctionCall(value) {
-					funcName, args := parseFunctionCall(value)
-					resolvedFuncName := lexer.ResolveSymbol(funcName, currentModule)
-					if functionReturnsString(resolvedFuncName) {
-						if len(args) == 0 {
-							fmt.Fprintf(b, "    %s(_output_buffer);\n", resolvedFuncName)
-						} else {
-							resolvedArgs := make([]string, len(args))
-							for i, arg := range args {
-								resolvedArgs[i] = lexer.ResolveSymbol(arg, currentModule)
-							}
-							fmt.Fprintf(b, "    %s(_output_buffer, %s);\n", resolvedFuncName, strings.Join(resolvedArgs, ", "))
-						}
-						fmt.Fprintf(b, "    return;\n")
-					} else {
-						resolvedCall := resolveFunctionCall(value)
-						fmt.Fprintf(b, "    strcpy(_output_buffer, %s);\n", resolvedCall)
-						fmt.Fprintf(b, "    return;\n")
-					}
-				} else {
-					value = strings.ReplaceAll(value, "this.", "this->")
-					value = lexer.ResolveSymbol(value, currentModule)
-					fmt.Fprintf(b, "    strcpy(_output_buffer, %s);\n", value)
-					fmt.Fprintf(b, "    return;\n")
-				}
-			} else {
-				renderStatements(b, []*lexer.Statement{stmt}, "    ", "", program, funcDecl.ReturnType)
-			}
-		}
-	} else {
-		renderStatements(b, funcDecl.Body, "    ", "", program, funcDecl.ReturnType)
+		declareOutputBuffer(b, funcDecl.Body)
+	}
+	r.renderStatements(b, funcDecl.Body, "    ", "", program, funcDecl.ReturnType)
+	r.endFunctionScope(b, funcDecl.Body)
+	if funcDecl.ReturnType == "string" && !lexer.LeavesBlock(funcDecl.Body) {
+		fmt.Fprintf(b, "    return %s;\n", stringFunctionResult(funcDecl.Body))
 	}
 
 	b.WriteString("}\n\n")
@@ -3362,26 +2812,41 @@ func isValidIdentifier(s string) bool {
 }
 
 // Generates a C function prototype for a class method
-func generateMethodPrototype(className, methodName, returnType string, parameters []*lexer.MethodParameter) string {
-	cReturnType := "void"
-	if returnType != "" && returnType != "void" {
-		cReturnType = mapTypeToCType(returnType)
-	}
-	paramList := []string{fmt.Sprintf("%s* this", className)}
-	for _, param := range parameters {
-		paramType := mapTypeToCType(param.Type)
-		if _, isPrimitive := primitiveTypes[param.Type]; !isPrimitive && param.Type != "string" {
-			paramType = paramType + "*"
-		} else if param.Type == "string" {
-			paramType = "char*"
+// Emits the prototypes of the methods a class declares.
+// Emits the prototypes of the constructor, destructor and methods of a class.
+func (r *Renderer) writeClassPrototypes(b *strings.Builder, className string, program *lexer.Program) {
+	constructor := r.findConstructor(className, program)
+	if constructor != nil && len(constructor.Parameters) > 0 {
+		fmt.Fprintf(b, "%s* %s_new(", className, className)
+		for i, param := range constructor.Parameters {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			fmt.Fprintf(b, "%s %s", r.constructorParamType(param), param.Name)
 		}
-		paramList = append(paramList, fmt.Sprintf("%s %s", paramType, param.Name))
+		b.WriteString(");\n")
+	} else {
+		fmt.Fprintf(b, "%s* %s_new();\n", className, className)
+	}
+	fmt.Fprintf(b, "void %s_deinit(%s* this);\n", className, className)
+	fmt.Fprintf(b, "void %s_free(%s* this);\n", className, className)
+	r.generateMethodPrototypes(b, findClassDecl(className, program), className)
+}
+
+func (r *Renderer) generateMethodPrototypes(b *strings.Builder, classDecl *lexer.ClassDeclStmt, className string) {
+	if classDecl == nil {
+		return
 	}
+	for _, method := range classDecl.Methods {
+		fmt.Fprintf(b, "%s;\n", r.generateMethodPrototype(className, method.Name, method.ReturnType, method.Parameters))
+	}
+}
 
-	return fmt.Sprintf("%s %s_%s(%s)", cReturnType, className, methodName, strings.Join(paramList, ", "))
+func (r *Renderer) generateMethodPrototype(className, methodName, returnType string, parameters []*lexer.MethodParameter) string {
+	return fmt.Sprintf("%s %s_%s(%s)", r.methodReturnType(returnType), className, methodName, r.methodParamList(className+"* this", parameters))
 }
 
-func generateFunctionPrototype(funcDecl *lexer.TopLevelFuncDeclStmt) string {
+func (r *Renderer) generateFunctionPrototype(funcDecl *lexer.TopLevelFuncDeclStmt) string {
 	returnType := "int" // Default to int (will return array length for list types)
 
 	var paramList []string
@@ -3392,41 +2857,20 @@ func generateFunctionPrototype(funcDecl *lexer.TopLevelFuncDeclStmt) string {
 		if innerType == "string" {
 			paramList = append(paramList, "char _output_array[][256]")
 		} else {
-			cType := mapTypeToCType(innerType)
+			cType := r.mapTypeToCType(innerType)
 			paramList = append(paramList, fmt.Sprintf("%s _output_array[]", cType))
 		}
 		paramList = append(paramList, "int _max_size")
 		returnType = "int" // Return the length of the array
-	} else if funcDecl.ReturnType != "" && funcDecl.ReturnType != "void" {
-		if funcDecl.ReturnType == "string" {
-			returnType = "void"
-			paramList = append(paramList, "char* _output_buffer")
-		} else {
-			returnType = mapTypeToCType(funcDecl.ReturnType)
-		}
 	} else {
-		returnType = "void"
+		returnType = r.methodReturnType(funcDecl.ReturnType)
 	}
 
 	for _, param := range funcDecl.Parameters {
-		paramType := mapTypeToCType(param.Type)
-		paramName := param.Name
-
 		if param.IsList || strings.HasPrefix(param.Type, "list[") {
-			if param.Type == "string" {
-				paramList = append(paramList, fmt.Sprintf("char %s[][256]", paramName))
-			} else {
-				paramList = append(paramList, fmt.Sprintf("%s %s[]", paramType, paramName))
-			}
-			paramList = append(paramList, fmt.Sprintf("int %s_len", paramName))
+			paramList = append(paramList, r.listParams(listParamElemType(param), param.Name)...)
 		} else {
-			if param.Type == "string" {
-				paramType = "char*"
-			}
-			if param.IsRef {
-				paramType = paramType + "*"
-			}
-			paramList = append(paramList, fmt.Sprintf("%s %s", paramType, paramName))
+			paramList = append(paramList, fmt.Sprintf("%s %s", r.functionParamType(param), param.Name))
 		}
 	}
 	if funcDecl.Name == "main" && len(funcDecl.Parameters) == 0 {
@@ -3436,13 +2880,30 @@ func generateFunctionPrototype(funcDecl *lexer.TopLevelFuncDeclStmt) string {
 	return fmt.Sprintf("%s %s(%s)", returnType, funcDecl.Name, strings.Join(paramList, ", "))
 }
 
-func isEnumType(typeName string) bool {
-	_, exists := globalEnums[typeName]
+// Returns the C type of a parameter of a top-level function other than a list.
+// Objects are passed as pointers to them, so they are shared with the caller
+// whether or not the parameter is a ref.
+func (r *Renderer) functionParamType(param *lexer.MethodParameter) string {
+	if className, ok := r.countedClass(param.Type); ok {
+		return className + "*"
+	}
+	paramType := r.mapTypeToCType(param.Type)
+	if param.Type == "string" {
+		paramType = "char*"
+	}
+	if param.IsRef {
+		paramType += "*"
+	}
+	return paramType
+}
+
+func (r *Renderer) isEnumType(typeName string) bool {
+	_, exists := r.globalEnums[typeName]
 	return exists
 }
 
-func mapTypeToCType(mapType string) string {
-	if isEnumType(mapType) {
+func (r *Renderer) mapTypeToCType(mapType string) string {
+	if r.isEnumType(mapType) {
 		return mapType
 	}
 	switch mapType {
@@ -3469,9 +2930,12 @@ func mapTypeToCType(mapType string) string {
 	case "i64":
 		return "long"
 	default:
+		if elemType, ok := optionalElemType(mapType); ok {
+			return r.optionalCType(elemType)
+		}
 		if strings.HasPrefix(mapType, "list[") && strings.HasSuffix(mapType, "]") {
 			innerType := strings.TrimPrefix(strings.TrimSuffix(mapType, "]"), "list[")
-			cInnerType := mapTypeToCType(innerType)
+			cInnerType := r.mapTypeToCType(innerType)
 			if innerType == "string" {
 				return "char"
 			}
@@ -3483,9 +2947,9 @@ func mapTypeToCType(mapType string) string {
 
 func isImportedType(typeName string, imports []*lexer.ImportStmt) (string, bool) {
 	for _, imp := range imports {
-		if module, exists := lexer.LoadedModules[imp.Module]; exists {
+		if module, exists := lexer.LoadedModules[lexer.ModuleBaseName(imp.Module)]; exists {
 			if _, classExists := module.PublicClasses[typeName]; classExists {
-				return imp.Module, true
+				return module.Name, true
 			}
 		}
 	}
@@ -6,6 +6,8 @@
 
 package renderer
 
+import "scar/lexer"
+
 type MethodInfo struct {
 	Name       string
 	Parameters []string
@@ -13,8 +15,9 @@ type MethodInfo struct {
 }
 
 type EnumInfo struct {
-	Name   string
-	Values []string
+	Name          string
+	Values        []string
+	Discriminants map[string]string
 }
 
 type FieldInfo struct {
@@ -24,9 +27,12 @@ type FieldInfo struct {
 }
 
 type ClassInfo struct {
-	Name    string
-	Fields  []FieldInfo
-	Methods []MethodInfo
+	Name        string
+	Base        string
+	Interfaces  []string
+	Fields      []FieldInfo
+	Methods     []MethodInfo
+	Constructor *lexer.ConstructorStmt
 }
 
 type ObjectInfo struct {
@@ -1,6 +1,8 @@
 package renderer
 
 import (
+	"os"
+	"path/filepath"
 	"scar/lexer"
 	"strings"
 	"testing"
@@ -18,7 +20,7 @@ func TestRenderC(t *testing.T) {
 	}
 
 	cCode := RenderC(program, "")
-	expected := `printf("Hello, World!\n");`
+	expected := `fputs("Hello, World!\n", stdout);`
 
 	if !strings.Contains(cCode, expected) {
 		t.Errorf("Expected C code to contain '%s', but it didn't", expected)
@@ -128,8 +130,8 @@ func TestRenderCWithStringVariable(t *testing.T) {
 	}
 
 	cCode := RenderC(program, "")
-	expectedVarDecl := `char msg[256]`
-	expectedStrcpy := `strcpy(msg, "Hello, String!");`
+	expectedVarDecl := `char* msg`
+	expectedStrcpy := `msg = __scar_str_new("Hello, String!");`
 	expectedPrintf := `printf("%s\n", msg);`
 
 	if !strings.Contains(cCode, expectedVarDecl) {
@@ -163,7 +165,7 @@ func TestRenderCWithList(t *testing.T) {
 	}
 
 	cCode := RenderC(program, "")
-	expectedListDecl := `int myList[3];`
+	expectedListDecl := `int* myList = NULL;`
 	expectedListInit1 := `myList[0] = 1;`
 	expectedListInit2 := `myList[1] = 2;`
 	expectedListInit3 := `myList[2] = 3;`
@@ -205,35 +207,17 @@ func TestRenderCWithMap(t *testing.T) {
 		}
 
 		var (
-			cCode              = RenderC(program, "")
-			expectedKeyDecl    = `char myMap_keys[2][256]`
-			expectedValueDecl  = `int myMap_values[2]`
-			expectedSize       = `int myMap_size = 2`
-			expectedKeyInit1   = `strcpy(myMap_keys[0], "one")`
-			expectedValueInit1 = `myMap_values[0] = 1`
-			expectedKeyInit2   = `strcpy(myMap_keys[1], "two")`
-			expectedValueInit2 = `myMap_values[1] = 2`
+			cCode        = RenderC(program, "")
+			expectedCode = []string{
+				`__scar_map myMap = __scar_map_new(sizeof(char*), sizeof(int), 1, 0);`,
+				`__scar_map_put(&myMap, &(char*){"one"}, &(int){1});`,
+				`__scar_map_put(&myMap, &(char*){"two"}, &(int){2});`,
+			}
 		)
-		if !strings.Contains(cCode, expectedKeyDecl) {
-			t.Errorf("Expected C code to contain '%s', but it didn't", expectedKeyDecl)
-		}
-		if !strings.Contains(cCode, expectedValueDecl) {
-			t.Errorf("Expected C code to contain '%s', but it didn't", expectedValueDecl)
-		}
-		if !strings.Contains(cCode, expectedSize) {
-			t.Errorf("Expected C code to contain '%s', but it didn't", expectedSize)
-		}
-		if !strings.Contains(cCode, expectedKeyInit1) {
-			t.Errorf("Expected C code to contain '%s', but it didn't", expectedKeyInit1)
-		}
-		if !strings.Contains(cCode, expectedValueInit1) {
-			t.Errorf("Expected C code to contain '%s', but it didn't", expectedValueInit1)
-		}
-		if !strings.Contains(cCode, expectedKeyInit2) {
-			t.Errorf("Expected C code to contain '%s', but it didn't", expectedKeyInit2)
-		}
-		if !strings.Contains(cCode, expectedValueInit2) {
-			t.Errorf("Expected C code to contain '%s', but it didn't", expectedValueInit2)
+		for _, code := range expectedCode {
+			if !strings.Contains(cCode, code) {
+				t.Errorf("Expected C code to contain '%s', but it didn't", code)
+			}
 		}
 	})
 
@@ -251,32 +235,12 @@ func TestRenderCWithMap(t *testing.T) {
 			},
 		}
 
-		var (
-			cCode        = RenderC(program, "")
-			expectedCode = []string{
-				`char emptyMap_keys[10][256];`,
-				`int emptyMap_values[10];`,
-				`int emptyMap_size = 0;`,
-			}
-			unexpectedCode = []string{
-				`strcpy(emptyMap_keys[`,
-			}
-		)
-
-		for _, code := range expectedCode {
-			if !strings.Contains(cCode, code) {
-				t.Errorf("Expected C code to contain '%s', but it didn't", code)
-			}
+		cCode := RenderC(program, "")
+		if want := `__scar_map emptyMap = __scar_map_new(sizeof(char*), sizeof(int), 1, 0);`; !strings.Contains(cCode, want) {
+			t.Errorf("Expected C code to contain '%s', but it didn't", want)
 		}
-
-		for _, code := range unexpectedCode {
-			if strings.Contains(cCode, code) {
-				if !strings.Contains(cCode, code+"]") &&
-					!strings.Contains(cCode, code+" ") &&
-					!strings.Contains(cCode, code+";") {
-					t.Errorf("Expected C code to not contain '%s' for empty map, but it did", code)
-				}
-			}
+		if strings.Contains(cCode, "__scar_map_put(&emptyMap") {
+			t.Error("Expected C code to not fill an empty map")
 		}
 	})
 }
@@ -345,7 +309,7 @@ func TestRenderCWithStringList(t *testing.T) {
 	}
 
 	cCode := RenderC(program, "")
-	expectedListDecl := `char names[3][256]`
+	expectedListDecl := `char (*names)[256] = NULL;`
 	if !strings.Contains(cCode, expectedListDecl) {
 		t.Errorf("Expected C code to contain '%s', but it didn't", expectedListDecl)
 	}
@@ -412,8 +376,8 @@ func TestTopLevelStringLiteralQuotes(t *testing.T) {
 	}
 	var (
 		result       = RenderC(program, ".")
-		expectedDecl = `char code[256];`
-		expectedInit = `strcpy(code, "++++++++[>++++[>++>+++>+++>+<<<<-]>+>+>->>+[<]<-]>>.>---.+++++++..+++.>>.<-.<.+++.------.--------.>>+.>++.");`
+		expectedDecl = `char* code`
+		expectedInit = `code = __scar_str_new("++++++++[>++++[>++>+++>+++>+<<<<-]>+>+>->>+[<]<-]>>.>---.+++++++..+++.>>.<-.<.+++.------.--------.>>+.>++.");`
 	)
 	if !strings.Contains(result, expectedDecl) {
 		t.Errorf("Expected string declaration '%s' not found in generated code", expectedDecl)
@@ -1161,6 +1125,7 @@ func TestMethodCallOnThis(t *testing.T) {
 // }
 
 func TestThisMethodCall(t *testing.T) {
+	r := NewRenderer(Options{})
 	program := &lexer.Program{
 		Statements: []*lexer.Statement{
 			{
@@ -1207,9 +1172,8 @@ func TestThisMethodCall(t *testing.T) {
 			},
 		},
 	}
-	currentClassName = "GameOfLife"
-	defer func() { currentClassName = "" }()
-	code := RenderC(program, "./testdata")
+	r.currentClassName = "GameOfLife"
+	code := r.RenderC(program, "./testdata")
 	expected := "GameOfLife_get_cell(this, 1, 2)"
 	if !strings.Contains(code, expected) {
 		t.Errorf("Expected method call to be converted to '%s', but got:\n%s", expected, code)
@@ -1313,6 +1277,7 @@ print "Counter: {}, Active: {}, Temp: {}, Status: {}", counter, is_active, tempe
 }
 
 func TestListOfInlineAndStandalone(t *testing.T) {
+	r := NewRenderer(Options{})
 	program := &lexer.Program{
 		Statements: []*lexer.Statement{
 			{
@@ -1356,17 +1321,17 @@ func TestListOfInlineAndStandalone(t *testing.T) {
 		},
 	}
 
-	globalArrays = map[string]string{
+	r.globalArrays = map[string]string{
 		"lines":            "string",
 		"existing_numbers": "int",
 	}
 
-	result := RenderC(program, "")
+	result := r.RenderC(program, "")
 
 	expectedStandaloneString := []string{
-		"char single_line[1000][256];",
-		"int single_line_len = 1;",
-		"strcpy(single_line[0], current_line);",
+		"char (*single_line)[256] = NULL;",
+		"int single_line_len = 0;",
+		"__scar_list_push_str(single_line, single_line_len, single_line_cap, current_line);",
 	}
 
 	for _, expected := range expectedStandaloneString {
@@ -1376,9 +1341,9 @@ func TestListOfInlineAndStandalone(t *testing.T) {
 	}
 
 	expectedStandaloneInt := []string{
-		"int single_num[1000];",
-		"int single_num_len = 1;",
-		"single_num[0] = 42;",
+		"int* single_num = NULL;",
+		"int single_num_cap = 0;",
+		"__scar_list_push(single_num, single_num_len, single_num_cap, 42);",
 	}
 
 	for _, expected := range expectedStandaloneInt {
@@ -1387,12 +1352,11 @@ func TestListOfInlineAndStandalone(t *testing.T) {
 		}
 	}
 	expectedInlineWithTarget := []string{
-		"char lines2[1000][256]; // Concatenated list",
+		"// Concatenated list",
+		"char (*lines2)[256] = NULL;",
 		"int lines2_len = 0;",
 		"// Add single element from list_of!(current_line)",
-		"if (lines2_len < 1000) {",
-		"strcpy(lines2[lines2_len], current_line);",
-		"lines2_len++;",
+		"__scar_list_push_str(lines2, lines2_len, lines2_cap, current_line);",
 	}
 	for _, expected := range expectedInlineWithTarget {
 		if !strings.Contains(result, expected) {
@@ -1401,9 +1365,7 @@ func TestListOfInlineAndStandalone(t *testing.T) {
 	}
 	expectedInlineWithoutTarget := []string{
 		"// Add single element from list_of!(another_line)",
-		"if (lines_len < 1000) {",
-		"strcpy(lines[lines_len], another_line);",
-		"lines_len++;",
+		"__scar_list_push_str(lines, lines_len, lines_cap, another_line);",
 	}
 
 	for _, expected := range expectedInlineWithoutTarget {
@@ -1412,11 +1374,9 @@ func TestListOfInlineAndStandalone(t *testing.T) {
 		}
 	}
 	expectedInlineNumeric := []string{
-		"int numbers[1000]; // Concatenated list",
+		"int* numbers = NULL;",
 		"// Add single element from list_of!(99)",
-		"if (numbers_len < 1000) {",
-		"numbers[numbers_len] = 99;",
-		"numbers_len++;",
+		"__scar_list_push(numbers, numbers_len, numbers_cap, 99);",
 	}
 
 	for _, expected := range expectedInlineNumeric {
@@ -1435,10 +1395,10 @@ func TestListOfInlineAndStandalone(t *testing.T) {
 			t.Errorf("Found malformed list_of pattern '%s' in generated code:\n%s", pattern, result)
 		}
 	}
-	globalArrays = make(map[string]string)
 }
 
 func TestListOfWithVariableResolution(t *testing.T) {
+	r := NewRenderer(Options{})
 	program := &lexer.Program{
 		Statements: []*lexer.Statement{
 			{
@@ -1456,15 +1416,15 @@ func TestListOfWithVariableResolution(t *testing.T) {
 		},
 	}
 
-	globalArrays = map[string]string{
+	r.globalArrays = map[string]string{
 		"existing":     "string",
 		"old_messages": "string",
 	}
-	currentModule = "test_module"
-	result := RenderC(program, "")
+	r.currentModule = "test_module"
+	result := r.RenderC(program, "")
 	expectedThisRef := []string{
 		"// Add single element from list_of!(this->current_line)",
-		"strcpy(result[result_len], this->current_line);",
+		"__scar_list_push_str(result, result_len, result_cap, this->current_line);",
 	}
 	for _, expected := range expectedThisRef {
 		if !strings.Contains(result, expected) {
@@ -1473,15 +1433,13 @@ func TestListOfWithVariableResolution(t *testing.T) {
 	}
 	expectedQuotedString := []string{
 		"// Add single element from list_of!(\"hello world\")",
-		"strcpy(messages[messages_len], \"hello world\");",
+		"__scar_list_push_str(messages, messages_len, messages_cap, \"hello world\");",
 	}
 	for _, expected := range expectedQuotedString {
 		if !strings.Contains(result, expected) {
 			t.Errorf("Expected quoted string handling '%s' not found in:\n%s", expected, result)
 		}
 	}
-	globalArrays = make(map[string]string)
-	currentModule = ""
 }
 
 func TestRecursiveMethodCall(t *testing.T) {
@@ -1556,7 +1514,7 @@ func TestPutStatement(t *testing.T) {
 
 	code := RenderC(program, "./testdata")
 
-	expected1 := `printf("Hello world");`
+	expected1 := `fputs("Hello world", stdout);`
 	if !strings.Contains(code, expected1) {
 		t.Errorf("Expected simple put statement to be '%s', but got:\n%s", expected1, code)
 	}
@@ -1571,7 +1529,7 @@ func TestPutStatement(t *testing.T) {
 		t.Errorf("Expected multi-variable put statement to be '%s', but got:\n%s", expected3, code)
 	}
 
-	if strings.Contains(code, `printf("Hello world\n");`) {
+	if strings.Contains(code, `fputs("Hello world\n", stdout);`) {
 		t.Errorf("Put statement should not add newlines, but found newline in output")
 	}
 }
@@ -1769,11 +1727,7 @@ func TestGetInPrintStatement(t *testing.T) {
 	}
 
 	cCode := RenderC(program, "")
-	if !strings.Contains(cCode, "__get_myMap_value") {
-		t.Error("Expected helper function __get_myMap_value not found in generated code")
-	}
-
-	expectedPrint := `printf("The value is: %d\n", __get_myMap_value("one"))`
+	expectedPrint := `printf("The value is: %d\n", (*(int*)__scar_map_get(&myMap, &(char*){"one"})))`
 	if !strings.Contains(cCode, expectedPrint) {
 		t.Errorf("Expected print statement not found in generated code. Expected to find: %s", expectedPrint)
 	}
@@ -1820,365 +1774,2461 @@ func TestListParameterInFunction(t *testing.T) {
 	}
 }
 
-func TestFunctionHoisting(t *testing.T) {
-	program := &lexer.Program{
-		Imports: []*lexer.ImportStmt{},
-		Statements: []*lexer.Statement{
-			{
-				TopLevelFuncDecl: &lexer.TopLevelFuncDeclStmt{
-					Name:       "main",
-					Parameters: []*lexer.MethodParameter{},
-					ReturnType: "void",
-					Body: []*lexer.Statement{
-						{
-							FunctionCall: &lexer.FunctionCallStmt{
-								Name: "print",
-								Args: []string{"calculate(5)"},
-							},
-						},
-					},
-				},
-			},
-			{
-				TopLevelFuncDecl: &lexer.TopLevelFuncDeclStmt{
-					Name: "calculate",
-					Parameters: []*lexer.MethodParameter{
-						{
-							Type: "int",
-							Name: "x",
-						},
-					},
-					ReturnType: "int",
-					Body: []*lexer.Statement{
-						{
-							Return: &lexer.ReturnStmt{
-								Value: "x * 2",
-							},
-						},
-					},
-				},
-			},
-		},
-	}
+func TestListArgumentToPublicFunction(t *testing.T) {
+	input := `pub fn total(list[int] xs) -> int:
+    return 0
 
-	// Generate the C code
+list[int] items = [1, 2]
+int n = total(items)
+`
+	program, err := lexer.ParseWithIndentation(input)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
 	cCode := RenderC(program, "")
+	if want := "int n = total(items, items_len);"; !strings.Contains(cCode, want) {
+		t.Errorf("Expected C code to contain '%s', but it didn't:\n%s", want, cCode)
+	}
+}
 
-	// Verify the output contains the function prototype before the main function
-	prototypeIndex := strings.Index(cCode, "int calculate(int x);")
-	mainFuncIndex := strings.Index(cCode, "int main(int argc, char** argv) {")
-	calculateFuncIndex := strings.Index(cCode, "int calculate(int x) {")
+func TestFloatCastAndFunctionNames(t *testing.T) {
+	input := `fn next_float() -> float:
+    return 0.5
 
-	// The prototype should appear before both function implementations
-	if prototypeIndex == -1 {
-		t.Error("Function prototype not found in generated code")
-	} else if prototypeIndex >= mainFuncIndex || prototypeIndex >= calculateFuncIndex {
-		t.Error("Function prototype not emitted before function implementations")
+int n = 3
+float a = next_float()
+float b = float(n) / 2
+`
+	program, err := lexer.ParseWithIndentation(input)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	cCode := RenderC(program, "")
+	for _, want := range []string{"float a = next_float();", "float b = (float)(n) / 2;"} {
+		if !strings.Contains(cCode, want) {
+			t.Errorf("Expected C code to contain '%s', but it didn't:\n%s", want, cCode)
+		}
 	}
+}
 
-	// Both function implementations should be present
-	if mainFuncIndex == -1 {
-		t.Error("main function not found in generated code")
+func TestSleepUnits(t *testing.T) {
+	input := `int n = 2
+float delay = 0.5
+sleep n
+sleep delay
+sleep_ms 20
+sleep_us n * 10
+`
+	program, err := lexer.ParseWithIndentation(input)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
 	}
+	cCode := RenderC(program, "")
+	for _, want := range []string{
+		"sleep(n);",
+		"__scar_sleep_us((delay) * 1000000.0);",
+		"__scar_sleep_us((20) * 1000.0);",
+		"__scar_sleep_us((n * 10) * 1.0);",
+	} {
+		if !strings.Contains(cCode, want) {
+			t.Errorf("Expected C code to contain '%s', but it didn't:\n%s", want, cCode)
+		}
+	}
+}
 
-	if calculateFuncIndex == -1 {
-		t.Error("calculate function not found in generated code")
+func TestForeachOverLists(t *testing.T) {
+	program, err := lexer.ParseWithIndentation(`class Bag:
+    init():
+        list[int] this.items = [4, 5]
+
+    fn sum() -> int:
+        int total = 0
+        foreach (int x in this.items):
+            total = total + x
+        return total
+
+fn total(list[int] xs) -> int:
+    int t = 0
+    foreach (int x in xs):
+        t = t + x
+    return t
+
+list[string] words = ["a", "bc"]
+foreach (string w in words):
+    print "{w}"
+`)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	cCode := RenderC(program, "")
+	for _, want := range []string{
+		"for (int __i = 0; __i < this->items_len; __i++) {\n        int x = this->items[__i];",
+		"for (int __i = 0; __i < xs_len; __i++) {\n        int x = xs[__i];",
+		"for (int __i = 0; __i < words_len; __i++) {\n        char* w = words[__i];",
+	} {
+		if !strings.Contains(cCode, want) {
+			t.Errorf("Expected C code to contain '%s', but it didn't:\n%s", want, cCode)
+		}
+	}
+	if strings.Contains(cCode, "strlen(") {
+		t.Errorf("Expected lists to be iterated up to their length:\n%s", cCode)
 	}
+}
 
-	// The function call in main should be correct
-	if !strings.Contains(cCode, "print(calculate(5))") {
-		t.Error("Function call in main is incorrect")
+func TestForeachOverFileLines(t *testing.T) {
+	program, err := lexer.ParseWithIndentation(`var f = new io_File("data.txt", "r")
+foreach (string line in f.lines):
+    print "{line}"
+`)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	cCode := RenderC(program, "")
+	for _, want := range []string{
+		"char* line = NULL;",
+		"while (__scar_io_getline(&line, &__cap, (FILE*)f->handle)) {",
+		"free(line);",
+	} {
+		if !strings.Contains(cCode, want) {
+			t.Errorf("Expected C code to contain '%s', but it didn't:\n%s", want, cCode)
+		}
 	}
+}
 
-	// Verify the function prototype is correct
-	expectedPrototype := "int calculate(int x);"
-	if !strings.Contains(cCode, expectedPrototype) {
-		t.Errorf("Expected prototype '%s' not found in generated code", expectedPrototype)
+func TestInputBuiltins(t *testing.T) {
+	program, err := lexer.ParseWithIndentation(`string name = input()
+int n = read_int()
+var x = read_float()
+name = input()
+`)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	cCode := RenderC(program, "")
+	for _, want := range []string{
+		"char* name = __scar_input();",
+		"int n = __scar_read_int();",
+		"float x = __scar_read_float();",
+		"__scar_str_take(&name, __scar_input());",
+	} {
+		if !strings.Contains(cCode, want) {
+			t.Errorf("Expected C code to contain '%s', but it didn't:\n%s", want, cCode)
+		}
 	}
 }
 
-func TestMethodCallTranslation(t *testing.T) {
-	input := `pub int PI = 3
-pub class Calculator:
-    fn add(int a, int b) -> int:
-        return a + b
-var calc = new Calculator()
-print "%d" | calc.add(2, 3)`
+func TestPrintCharReferenceField(t *testing.T) {
+	program, err := lexer.ParseWithIndentation(`class Buffer:
+    init():
+        ref char this.text = nil
+        char this.last = 'x'
 
-	program, err := lexer.ParseWithIndentation(input)
+var b = new Buffer()
+print "{b.text} {b.last}"
+`)
 	if err != nil {
-		t.Fatalf("Failed to parse input: %v", err)
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	cCode := RenderC(program, "")
+	if want := `printf("%s %c\n", b->text, b->last);`; !strings.Contains(cCode, want) {
+		t.Errorf("Expected C code to contain '%s', but it didn't:\n%s", want, cCode)
 	}
+}
 
-	result := RenderC(program, ".")
+func TestInferVarFromCharPointerFunction(t *testing.T) {
+	program, err := lexer.ParseWithIndentation(`fn greeting() -> char*:
+    $raw (
+        return strdup("hi");
+    )
 
-	expectedClassDecl := "typedef struct Calculator Calculator;"
-	if !strings.Contains(result, expectedClassDecl) {
-		t.Errorf("Expected class typedef '%s' not found in generated code", expectedClassDecl)
+var g = greeting()
+print "{g}"
+`)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
 	}
-	expectedConstructor := "Calculator* Calculator_new();"
-	if !strings.Contains(result, expectedConstructor) {
-		t.Errorf("Expected constructor declaration '%s' not found in generated code", expectedConstructor)
+	cCode := RenderC(program, "")
+	for _, want := range []string{"char* g = greeting();", `printf("%s\n", g);`} {
+		if !strings.Contains(cCode, want) {
+			t.Errorf("Expected C code to contain '%s', but it didn't:\n%s", want, cCode)
+		}
 	}
-	expectedMethodDecl := "int Calculator_add(Calculator* this, int a, int b);"
-	if !strings.Contains(result, expectedMethodDecl) {
-		t.Errorf("Expected method declaration '%s' not found in generated code", expectedMethodDecl)
+}
+
+func TestPrintModuleVariables(t *testing.T) {
+	lexer.LoadedModules["geo"] = &lexer.ModuleInfo{
+		Name: "geo",
+		PublicVars: map[string]*lexer.VarDeclStmt{
+			"SCALE": {Type: "float", Name: "SCALE", Value: "2.5"},
+			"LABEL": {Type: "string", Name: "LABEL", Value: `"geo"`},
+		},
 	}
-	expectedInstantiation := "Calculator* calc = Calculator_new();"
-	if !strings.Contains(result, expectedInstantiation) {
-		t.Errorf("Expected object instantiation '%s' not found in generated code", expectedInstantiation)
+	defer delete(lexer.LoadedModules, "geo")
+	program, err := lexer.ParseWithIndentation(`import geo
+print "{geo.SCALE} {geo_LABEL}"
+`)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
 	}
-	expectedMethodCall := "Calculator_add(calc, 2, 3)"
-	if !strings.Contains(result, expectedMethodCall) {
-		t.Errorf("Expected method call '%s' not found in generated code", expectedMethodCall)
+	cCode := RenderC(program, "")
+	if want := `printf("%f %s\n", geo_SCALE, geo_LABEL);`; !strings.Contains(cCode, want) {
+		t.Errorf("Expected C code to contain '%s', but it didn't:\n%s", want, cCode)
 	}
-	incorrectMethodCall := "Calc_add(calc, 2, 3)"
-	if strings.Contains(result, incorrectMethodCall) {
-		t.Errorf("Found incorrect method call '%s' in generated code - this indicates a regression", incorrectMethodCall)
+}
+
+func TestPrintCaughtExceptionFields(t *testing.T) {
+	program, err := lexer.ParseWithIndentation(`try:
+    throw "boom"
+catch e:
+    print "{e.message} ({e.code})"
+`)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
 	}
-	expectedPrintCall := `printf("%d\n", Calculator_add(calc, 2, 3));`
-	if !strings.Contains(result, expectedPrintCall) {
-		t.Errorf("Expected print statement '%s' not found in generated code", expectedPrintCall)
+	cCode := RenderC(program, "")
+	if want := `printf("%s (%d)\n", e->message, e->code);`; !strings.Contains(cCode, want) {
+		t.Errorf("Expected C code to contain '%s', but it didn't:\n%s", want, cCode)
 	}
-	expectedGlobalVar := "int PI = 3;"
-	if !strings.Contains(result, expectedGlobalVar) {
-		t.Errorf("Expected global variable '%s' not found in generated code", expectedGlobalVar)
+}
+
+func TestSpawnAndJoin(t *testing.T) {
+	program, err := lexer.ParseWithIndentation(`fn work(int id, string name, list[int] xs):
+    print "{id} {name}"
+
+list[int] data = [1, 2]
+var t = spawn work(1, "a", data)
+join t
+spawn work(2, "b", data)
+`)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
 	}
-	if t.Failed() {
-		t.Logf("Full generated C code:\n%s", result)
+	cCode := RenderC(program, "")
+	for _, want := range []string{
+		"void* __scar_spawn_work(int id, char* name, int* xs, int xs_len);",
+		`void* t = __scar_spawn_work(1, "a", data, data_len);`,
+		"__scar_thread_join(t);",
+		`__scar_thread_detach(__scar_spawn_work(2, "b", data, data_len));`,
+		"args->name = strdup(name);",
+		"work(args->id, args->name, args->xs, args->xs_len);",
+	} {
+		if !strings.Contains(cCode, want) {
+			t.Errorf("Expected C code to contain '%s', but it didn't:\n%s", want, cCode)
+		}
 	}
 }
 
-func TestRenderCWithListFunctionAssignment(t *testing.T) {
-	t.Run("simple int list function assignment", func(t *testing.T) {
-		program := &lexer.Program{
-			Statements: []*lexer.Statement{
-				{
-					TopLevelFuncDecl: &lexer.TopLevelFuncDeclStmt{
-						Name:       "get_numbers",
-						Parameters: []*lexer.MethodParameter{},
-						ReturnType: "list[int]",
-						Body: []*lexer.Statement{
-							{
-								ListDecl: &lexer.ListDeclStmt{
-									Name:     "result",
-									Type:     "int",
-									Elements: []string{"1", "2", "3"},
-								},
-							},
-							{
-								Return: &lexer.ReturnStmt{
-									Value: "result",
-								},
-							},
-						},
-					},
-				},
-				{
-					ListDeclFunctionCall: &lexer.ListDeclFunctionCallStmt{
-						Type:         "int",
-						Name:         "my_list",
-						FunctionCall: "get_numbers()",
-					},
-				},
-				{
-					Print: &lexer.PrintStmt{
-						Format:    "First: %d",
-						Variables: []string{"my_list[0]"},
-					},
-				},
-			},
-		}
+func TestSpawnWithObject(t *testing.T) {
+	program, err := lexer.ParseWithIndentation(`class Counter:
+    init():
+        int this.n = 0
 
-		cCode := RenderC(program, "")
-		expectedPrototype := "int get_numbers(int _output_array[], int _max_size);"
-		if !strings.Contains(cCode, expectedPrototype) {
-			t.Errorf("Expected function prototype '%s' not found in generated code", expectedPrototype)
+fn bump(Counter c):
+    c.n = c.n + 1
+
+Counter counter = new Counter()
+var t = spawn bump(counter)
+join t
+`)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	cCode := RenderC(program, "")
+	for _, want := range []string{
+		"void* __scar_spawn_bump(Counter* c);",
+		"Counter* c;",
+		"bump(args->c);",
+	} {
+		if !strings.Contains(cCode, want) {
+			t.Errorf("Expected C code to contain '%s', but it didn't:\n%s", want, cCode)
 		}
-		expectedSignature := "int get_numbers(int _output_array[], int _max_size) {"
-		if !strings.Contains(cCode, expectedSignature) {
-			t.Errorf("Expected function signature '%s' not found in generated code", expectedSignature)
+	}
+}
+
+func TestAtomicAndReduce(t *testing.T) {
+	program, err := lexer.ParseWithIndentation(`atomic int hits = 0
+int total = 0
+parallel for i = 1 to 100 reduce(+: total):
+    total = total + i
+    hits = hits + 1
+    hits = 5
+    hits = hits * hits
+`)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	cCode := RenderC(program, "")
+	for _, want := range []string{
+		"#pragma omp parallel for reduction(+: total)",
+		"#pragma omp atomic\n        hits = hits + 1;",
+		"#pragma omp atomic write\n        hits = 5;",
+		"#pragma omp critical(__scar_atomic)\n        hits = hits * hits;",
+		"    total = total + i;",
+	} {
+		if !strings.Contains(cCode, want) {
+			t.Errorf("Expected C code to contain '%s', but it didn't:\n%s", want, cCode)
 		}
-		expectedCopy := "for (int _i = 0; _i < result_len && _i < _max_size; _i++) {"
-		if !strings.Contains(cCode, expectedCopy) {
-			t.Errorf("Expected array copy loop '%s' not found in generated code", expectedCopy)
+	}
+}
+
+func TestParallelForThreadsAndSchedule(t *testing.T) {
+	program, err := lexer.ParseWithIndentation(`set_threads(2)
+int total = 0
+parallel for i = 1 to 100 threads(8) schedule(dynamic, 4) reduce(+: total):
+    total = total + i
+`)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	cCode := RenderC(program, "")
+	for _, want := range []string{
+		"omp_set_num_threads(2);",
+		"#pragma omp parallel for reduction(+: total) num_threads(8) schedule(dynamic, 4)",
+	} {
+		if !strings.Contains(cCode, want) {
+			t.Errorf("Expected C code to contain '%s', but it didn't:\n%s", want, cCode)
 		}
-		expectedReturnLength := "return result_len;"
-		if !strings.Contains(cCode, expectedReturnLength) {
-			t.Errorf("Expected return length statement '%s' not found in generated code", expectedReturnLength)
-		}
-		expectedListDecl := "int my_list[1000];"
-		if !strings.Contains(cCode, expectedListDecl) {
-			t.Errorf("Expected list declaration '%s' not found in generated code", expectedListDecl)
+	}
+}
+
+func TestNoOpenMP(t *testing.T) {
+	program, err := lexer.ParseWithIndentation(`atomic int hits = 0
+parallel for i = 1 to 100 reduce(+: hits):
+    hits = hits + i
+    hits = 0
+`)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	cCode := NewRenderer(Options{NoOpenMP: true}).RenderC(program, "")
+	if strings.Contains(cCode, "#pragma omp") {
+		t.Errorf("Expected C code without OpenMP pragmas:\n%s", cCode)
+	}
+	for _, want := range []string{
+		"for (int i = 1; i <= 100; i++) {",
+		"!__atomic_compare_exchange_n(&hits, &__scar_old, __scar_old + i, 0, __ATOMIC_SEQ_CST, __ATOMIC_SEQ_CST);) {",
+		"__atomic_store_n(&hits, 0, __ATOMIC_SEQ_CST);",
+	} {
+		if !strings.Contains(cCode, want) {
+			t.Errorf("Expected C code to contain '%s', but it didn't:\n%s", want, cCode)
 		}
-		expectedLengthVar := "int my_list_len;"
-		if !strings.Contains(cCode, expectedLengthVar) {
-			t.Errorf("Expected length variable '%s' not found in generated code", expectedLengthVar)
+	}
+}
+
+func TestExternFunctions(t *testing.T) {
+	program, err := lexer.ParseWithIndentation(`extern fn strlen(string s) -> int from "string.h"
+extern fn getenv(string name) -> string from "stdlib.h"
+extern fn mylib_scale(double x, ref int count) -> double
+var home = getenv("HOME")
+int n = strlen(home)
+`)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	cCode := RenderC(program, "")
+	for _, want := range []string{
+		"#include \"stdlib.h\"\n#include \"string.h\"\ndouble mylib_scale(double x, int* count);",
+		`char* home = getenv("HOME");`,
+		"int n = strlen(home);",
+	} {
+		if !strings.Contains(cCode, want) {
+			t.Errorf("Expected C code to contain '%s', but it didn't:\n%s", want, cCode)
 		}
-		expectedFunctionCall := "my_list_len = get_numbers(my_list, 1000);"
-		if !strings.Contains(cCode, expectedFunctionCall) {
-			t.Errorf("Expected function call '%s' not found in generated code", expectedFunctionCall)
+	}
+}
+
+func TestRenderLibrary(t *testing.T) {
+	program, err := lexer.ParseWithIndentation(`pub fn add(int a, int b) -> int:
+    return a + b
+
+fn helper() -> int:
+    return 1
+
+pub class Counter:
+    init(int start):
+        int this.n = start
+    fn bump() -> int:
+        this.n = this.n + 1
+        return this.n
+
+print "loaded"
+`)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	code, header := NewRenderer(Options{}).RenderLibrary(program, "", "my-lib")
+	if strings.Contains(code, "int main(") || !strings.Contains(code, "__attribute__((constructor)) static void __scar_library_init(void) {") {
+		t.Errorf("Expected a library without main, running its statements when loaded:\n%s", code)
+	}
+	for _, want := range []string{
+		"#ifndef SCAR_LIB_MY_LIB_H",
+		"extern \"C\" {",
+		"typedef struct Counter Counter;\nCounter* Counter_new(int start);",
+		"int Counter_bump(Counter* self);",
+		"int add(int a, int b);",
+	} {
+		if !strings.Contains(header, want) {
+			t.Errorf("Expected header to contain '%s', but it didn't:\n%s", want, header)
 		}
-		if t.Failed() {
-			t.Logf("Full generated C code:\n%s", cCode)
+	}
+	if strings.Contains(header, "helper") {
+		t.Errorf("Expected header to leave out functions that are not pub:\n%s", header)
+	}
+}
+
+func TestRenderBreakpoint(t *testing.T) {
+	program, err := lexer.ParseWithIndentation(`int x = 1
+breakpoint
+print "x = {x}"
+`)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	if code := RenderC(program, ""); strings.Contains(code, "__scar_breakpoint") {
+		t.Errorf("Expected breakpoints to be left out without -debug:\n%s", code)
+	}
+	if code := NewRenderer(Options{Debug: true}).RenderC(program, ""); !strings.Contains(code, "    __scar_breakpoint();\n") {
+		t.Errorf("Expected C code to contain '__scar_breakpoint();', but it didn't:\n%s", code)
+	}
+}
+
+func TestRenderPanic(t *testing.T) {
+	program, err := lexer.ParseWithIndentation(`class Account:
+    init(int balance):
+        this.balance = balance
+
+    fn withdraw(int amount):
+        if amount > this.balance:
+            panic("short by {amount - this.balance}")
+
+fn check(int n):
+    try:
+        print "{n}"
+    catch e:
+        panic(e.message)
+`)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	code := RenderC(program, "")
+	if expected := `__scar_panic(__scar_str_format("short by %d", amount - this->balance));`; !strings.Contains(code, expected) {
+		t.Errorf("Expected C code to contain '%s', but it didn't:\n%s", expected, code)
+	}
+	if strings.Contains(code, "__scar_context") {
+		t.Errorf("Expected the call context to be left out without -debug:\n%s", code)
+	}
+	code = NewRenderer(Options{Debug: true}).RenderC(program, "")
+	for _, expected := range []string{
+		`__scar_context_enter("Account.init");`,
+		`__scar_context_enter("Account.withdraw");`,
+		`__scar_context_enter("check");`,
+		"__scar_context* __try_0_context = __scar_context_top;",
+		"__scar_context_top = __try_0_context;",
+		"__scar_panic(e->message);",
+	} {
+		if !strings.Contains(code, expected) {
+			t.Errorf("Expected C code to contain '%s', but it didn't:\n%s", expected, code)
 		}
-	})
+	}
+}
 
-	t.Run("string list function assignment", func(t *testing.T) {
-		program := &lexer.Program{
-			Statements: []*lexer.Statement{
-				{
-					TopLevelFuncDecl: &lexer.TopLevelFuncDeclStmt{
-						Name:       "get_names",
-						Parameters: []*lexer.MethodParameter{},
-						ReturnType: "list[string]",
-						Body: []*lexer.Statement{
-							{
-								ListDecl: &lexer.ListDeclStmt{
-									Name:     "result",
-									Type:     "string",
-									Elements: []string{"\"Alice\"", "\"Bob\"", "\"Charlie\""},
-								},
-							},
-							{
-								Return: &lexer.ReturnStmt{
-									Value: "result",
-								},
-							},
-						},
-					},
-				},
-				{
-					ListDeclFunctionCall: &lexer.ListDeclFunctionCallStmt{
-						Type:         "string",
-						Name:         "my_names",
-						FunctionCall: "get_names()",
-					},
-				},
-			},
+func TestRenderBoundsCheck(t *testing.T) {
+	program, err := lexer.ParseWithIndentation(`list[int] xs = [1, 2, 3]
+list[list[int]] grid = [[1, 2], [3, 4]]
+int i = 2
+xs[i] = xs[i - 1]
+int g = grid[i][0]
+`)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	if code := RenderC(program, ""); strings.Contains(code, "__scar_check_index") {
+		t.Errorf("Expected indexes to be unchecked without -bounds-check:\n%s", code)
+	}
+	code := NewRenderer(Options{BoundsCheck: true}).RenderC(program, "")
+	for _, expected := range []string{
+		"xs[__scar_check_index(i, xs_len)] = xs[__scar_check_index(i - 1, xs_len)];",
+		"int g = grid[__scar_check_index(i, grid_len)][__scar_check_index(0, grid_lens[i])];",
+	} {
+		if !strings.Contains(code, expected) {
+			t.Errorf("Expected C code to contain '%s', but it didn't:\n%s", expected, code)
 		}
+	}
+}
 
-		cCode := RenderC(program, "")
+func TestRenderLeakCheck(t *testing.T) {
+	program, err := lexer.ParseWithIndentation(`class Point:
+    init(int x):
+        int this.x = x
 
-		expectedPrototype := "int get_names(char _output_array[][256], int _max_size);"
-		if !strings.Contains(cCode, expectedPrototype) {
-			t.Errorf("Expected string function prototype '%s' not found in generated code", expectedPrototype)
+fn make() -> Point:
+    return new Point(2)
+
+Point p = new Point(1)
+Point q = make()
+`)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	if code := RenderC(program, ""); strings.Contains(code, "__scar_new_at") {
+		t.Errorf("Expected objects to be created untracked without -leak-check:\n%s", code)
+	}
+	code := NewRenderer(Options{LeakCheck: true}).RenderC(program, "")
+	for _, expected := range []string{
+		"return __scar_new_at(Point_new(2));",
+		"Point* p = __scar_new_at(Point_new(1));",
+		"Point* this = malloc(sizeof(Point));",
+	} {
+		if !strings.Contains(code, expected) {
+			t.Errorf("Expected C code to contain '%s', but it didn't:\n%s", expected, code)
 		}
-		expectedStringCopy := "strcpy(_output_array[_i], result[_i]);"
-		if !strings.Contains(cCode, expectedStringCopy) {
-			t.Errorf("Expected string copy statement '%s' not found in generated code", expectedStringCopy)
+	}
+}
+
+func TestRenderSafeMode(t *testing.T) {
+	program, err := lexer.ParseWithIndentation(`i8 small = 100
+int n = 7
+i64 total = 9
+float f = 1.5
+i8 more = small + 1
+int q = n / (n - 7) % 3
+i64 sum = total * n
+float g = f * 2
+i32 narrow = total as i32
+i64 wide = n as i64
+u8 byte = n as u8
+u64 count = n as u64
+i64 back = count as i64
+int lit = 300 as int
+`)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	if code := RenderC(program, ""); strings.Contains(code, "__scar_checked_") {
+		t.Errorf("Expected arithmetic to be unchecked without -safe:\n%s", code)
+	}
+	code := NewRenderer(Options{SafeMode: true}).RenderC(program, "")
+	for _, expected := range []string{
+		"i8 more = __scar_checked_add_int8_t(small, 1);",
+		"int q = __scar_checked_mod_int(__scar_checked_div_int(n, (__scar_checked_sub_int(n, 7))), 3);",
+		"i64 sum = __scar_checked_mul_long(total, n);",
+		"float g = f * 2;",
+		"i32 narrow = __scar_checked_cast_int(total);",
+		"i64 wide = ((long)(n));",
+		"u8 byte = __scar_checked_cast_uint8_t(n);",
+		"u64 count = __scar_checked_cast_uint64_t(n);",
+		"i64 back = __scar_checked_ucast_long(count);",
+		"int lit = ((int)(300));",
+	} {
+		if !strings.Contains(code, expected) {
+			t.Errorf("Expected C code to contain '%s', but it didn't:\n%s", expected, code)
 		}
-		expectedStringListDecl := "char my_names[1000][256];"
-		if !strings.Contains(cCode, expectedStringListDecl) {
-			t.Errorf("Expected string list declaration '%s' not found in generated code", expectedStringListDecl)
+	}
+}
+
+func TestRenderStringFromListElement(t *testing.T) {
+	program, err := lexer.ParseWithIndentation(`list[string] names = ["a", "b"]
+string s = names[1]
+`)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	code := RenderC(program, "")
+	if expected := "char* s = __scar_str_new(names[1]);"; !strings.Contains(code, expected) {
+		t.Errorf("Expected C code to contain '%s', but it didn't:\n%s", expected, code)
+	}
+}
+
+func TestRenderStringFunctionComposition(t *testing.T) {
+	program, err := lexer.ParseWithIndentation(`fn greet(string name) -> string:
+    return "hi " + name
+
+fn shout(string s) -> string:
+    return s + "!"
+
+string both = greet("a") + shout(greet("b"))
+print "{shout(both)}"
+greet("c")
+`)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	code := RenderC(program, "")
+	for _, expected := range []string{
+		"char* greet(char* name);",
+		`return __scar_str_concat("hi ", name);`,
+		`char* both = __scar_str_concat(greet("a"), shout(greet("b")));`,
+		"shout(both)",
+		`free(greet("c"));`,
+	} {
+		if !strings.Contains(code, expected) {
+			t.Errorf("Expected C code to contain '%s', but it didn't:\n%s", expected, code)
 		}
-		if t.Failed() {
-			t.Logf("Full generated C code:\n%s", cCode)
+	}
+	if strings.Contains(code, "_output_buffer") {
+		t.Errorf("Expected no hidden output buffer:\n%s", code)
+	}
+}
+
+func TestRenderClassReturnTypes(t *testing.T) {
+	program, err := lexer.ParseWithIndentation(`class Node:
+    init(int v):
+        this.value = v
+    fn clone() -> Node:
+        return new Node(this.value)
+
+fn make_node(int v) -> Node:
+    return new Node(v)
+
+var n = make_node(5)
+Node m = n.clone()
+var k = m.clone()
+`)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	code := RenderC(program, "")
+	for _, expected := range []string{
+		"Node* make_node(int v);",
+		"Node* Node_clone(Node* this) {",
+		"Node* n = make_node(5);",
+		"Node* m = Node_clone(n);",
+		"Node* k = Node_clone(m);",
+	} {
+		if !strings.Contains(code, expected) {
+			t.Errorf("Expected C code to contain '%s', but it didn't:\n%s", expected, code)
 		}
-	})
+	}
+}
 
-	t.Run("function with parameters returning list", func(t *testing.T) {
-		program := &lexer.Program{
-			Statements: []*lexer.Statement{
-				{
-					TopLevelFuncDecl: &lexer.TopLevelFuncDeclStmt{
-						Name: "create_range",
-						Parameters: []*lexer.MethodParameter{
-							{Type: "int", Name: "start"},
-							{Type: "int", Name: "end"},
-						},
-						ReturnType: "list[int]",
-						Body: []*lexer.Statement{
-							{
-								ListDecl: &lexer.ListDeclStmt{
-									Name:     "result",
-									Type:     "int",
-									Elements: []string{},
-								},
-							},
-							{
-								Return: &lexer.ReturnStmt{
-									Value: "result",
-								},
-							},
-						},
-					},
-				},
-				{
-					ListDeclFunctionCall: &lexer.ListDeclFunctionCallStmt{
-						Type:         "int",
-						Name:         "range_list",
-						FunctionCall: "create_range(1, 5)",
-					},
-				},
-			},
+func TestRenderObjectParameters(t *testing.T) {
+	program, err := lexer.ParseWithIndentation(`class Task:
+    init(string name, int cost):
+        this.name = name
+        this.cost = cost
+    fn bump():
+        this.cost = this.cost + 1
+
+fn process(Task t) -> string:
+    t.bump()
+    return "task " + t.name
+
+Task a = new Task("write", 3)
+string d = process(a)
+`)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	code := RenderC(program, "")
+	for _, expected := range []string{
+		"char* process(Task* t);",
+		"char* process(Task* t) {",
+		"Task_bump(t);",
+		`__scar_str_concat("task ", t->name)`,
+		"char* d = process(a);",
+	} {
+		if !strings.Contains(code, expected) {
+			t.Errorf("Expected C code to contain '%s', but it didn't:\n%s", expected, code)
 		}
+	}
+}
 
-		cCode := RenderC(program, "")
+func TestRenderMemberChains(t *testing.T) {
+	program, err := lexer.ParseWithIndentation(`class Customer:
+    init(string name, int age):
+        this.name = name
+        this.age = age
+    fn older(int n) -> Customer:
+        return new Customer(this.name, this.age + n)
+
+class Order:
+    init(int id, Customer customer):
+        this.id = id
+        this.customer = customer
+    fn owner() -> Customer:
+        return this.customer
+
+Customer c = new Customer("ann", 30)
+Order o = new Order(1, c)
+string n = o.customer.name
+int a = o.customer.age + 1
+a = a + o.owner().age
+o.customer.age = 40
+o.owner().older(2)
+print "{o.owner().older(5).age}"
+`)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	code := RenderC(program, "")
+	for _, expected := range []string{
+		"char* n = __scar_str_new(o->customer->name);",
+		"int a = o->customer->age + 1;",
+		"a = a + Order_owner(o)->age;",
+		"o->customer->age = 40;",
+		"Customer_older(Order_owner(o), 2);",
+		`printf("%d\n", Customer_older(Order_owner(o), 5)->age);`,
+	} {
+		if !strings.Contains(code, expected) {
+			t.Errorf("Expected C code to contain '%s', but it didn't:\n%s", expected, code)
+		}
+	}
+}
 
-		expectedPrototype := "int create_range(int _output_array[], int _max_size, int start, int end);"
+func TestRenderListFields(t *testing.T) {
+	program, err := lexer.ParseWithIndentation(`class Board:
+    init(int size):
+        this.size = size
+        list[int] this.cells = [1, 2]
+        list[list[int]] this.grid = grid!(size, size)
+    fn mark(int x, int y):
+        this.grid[y][x] = this.cells[0]
+        append!(this.cells, x)
+    fn count() -> int:
+        return len(this.cells)
+
+Board b = new Board(3)
+print "{b.grid[1][2]}"
+`)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	code := RenderC(program, "")
+	for _, expected := range []string{
+		"    int* cells;\n    int cells_len;\n    int cells_cap;\n",
+		"    int** grid;\n    int* grid_lens;\n    int grid_len;\n    int grid_cap;\n",
+		"__scar_list_push(this->cells, this->cells_len, this->cells_cap, 2);",
+		"__scar_list_add_row(this->grid, this->grid_lens, this->grid_len, this->grid_cap, size);",
+		"this->grid[y][x] = this->cells[0];",
+		"__scar_list_push(this->cells, this->cells_len, this->cells_cap, x);",
+		"return this->cells_len;",
+		`printf("%d\n", b->grid[1][2]);`,
+		"free(this->grid_lens);\n    free(this->grid);",
+	} {
+		if !strings.Contains(code, expected) {
+			t.Errorf("Expected C code to contain '%s', but it didn't:\n%s", expected, code)
+		}
+	}
+}
 
-		if !strings.Contains(cCode, expectedPrototype) {
-			t.Errorf("Expected function prototype with params '%s' not found in generated code", expectedPrototype)
+func TestRenderStringEscapes(t *testing.T) {
+	program, err := lexer.ParseWithIndentation(`int n = 5
+print "say \"%d\" now", n
+print "100% \"done\"\t"
+put "{n}% \\ of \"it\"\n"
+string s = "a\tb\"c\\"
+`)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	code := RenderC(program, "")
+	for _, expected := range []string{
+		`printf("say \"%d\" now\n", n);`,
+		`fputs("100% \"done\"\t\n", stdout);`,
+		`printf("%d%% \\ of \"it\"\n", n);`,
+		`__scar_str_new("a\tb\"c\\")`,
+	} {
+		if !strings.Contains(code, expected) {
+			t.Errorf("Expected C code to contain '%s', but it didn't:\n%s", expected, code)
 		}
+	}
+}
 
-		expectedFunctionCall := "range_list_len = create_range(range_list, 1000, 1, 5);"
+func TestRenderRanges(t *testing.T) {
+	program, err := lexer.ParseWithIndentation(`int n = 4
+foreach (int row_i in 0..n):
+    print "{row_i}"
+list[int] xs = range(1, n)
+class Bag:
+    init(int k):
+        list[int] this.items = 1..k
+`)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	code := RenderC(program, "")
+	for _, expected := range []string{
+		"for (int row_i = 0; row_i <= n; row_i++) {",
+		"for (int __i = 1; __i <= n - 1; __i++) {\n        __scar_list_push(xs, xs_len, xs_cap, __i);",
+		"for (int __i = 1; __i <= k; __i++) {\n        __scar_list_push(this->items, this->items_len, this->items_cap, __i);",
+	} {
+		if !strings.Contains(code, expected) {
+			t.Errorf("Expected C code to contain '%s', but it didn't:\n%s", expected, code)
+		}
+	}
+}
 
-		if !strings.Contains(cCode, expectedFunctionCall) {
-			t.Errorf("Expected function call with params '%s' not found in generated code", expectedFunctionCall)
+func TestRenderListTransforms(t *testing.T) {
+	program, err := lexer.ParseWithIndentation(`fn twice(int x) -> int:
+    return x * 2
+fn is_even(int x) -> bool:
+    return x % 2 == 0
+fn shout(string s) -> string:
+    return s + "!"
+list[int] xs = [1, 2, 3]
+list[int] doubled = map!(xs, twice)
+list[int] evens = filter!(xs, is_even)
+list[string] words = ["a", "b"]
+list[string] loud = map!(words, shout)
+`)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	code := RenderC(program, "")
+	for _, expected := range []string{
+		"for (int __i = 0; __i < xs_len; __i++) {\n        __scar_list_push(doubled, doubled_len, doubled_cap, twice(xs[__i]));",
+		"if (is_even(xs[__i])) {\n            __scar_list_push(evens, evens_len, evens_cap, xs[__i]);",
+		"char* __value = shout(words[__i]);\n        __scar_list_push_str(loud, loud_len, loud_cap, __value);\n        free(__value);",
+	} {
+		if !strings.Contains(code, expected) {
+			t.Errorf("Expected C code to contain '%s', but it didn't:\n%s", expected, code)
 		}
+	}
+}
 
-		if t.Failed() {
-			t.Logf("Full generated C code:\n%s", cCode)
+func TestRenderSort(t *testing.T) {
+	program, err := lexer.ParseWithIndentation(`fn desc(int a, int b) -> int:
+    return b - a
+fn shorter(string a, string b) -> bool:
+    return strlen(a) < strlen(b)
+list[int] nums = [3, 1, 2]
+list[string] words = ["kiwi", "fig"]
+sort!(nums)
+sort!(nums, desc)
+sort!(words)
+sort!(words, shorter)
+`)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	code := RenderC(program, "")
+	for _, expected := range []string{
+		"qsort(nums, nums_len, sizeof(*nums), __scar_cmp_int);",
+		"qsort(nums, nums_len, sizeof(*nums), __scar_sort_desc);",
+		"qsort(words, words_len, sizeof(*words), __scar_cmp_str);",
+		"int __scar_sort_desc(const void* a, const void* b) {\n    return desc(*(int*)a, *(int*)b);",
+		"return shorter((char*)a, (char*)b) ? -1 : shorter((char*)b, (char*)a) ? 1 : 0;",
+	} {
+		if !strings.Contains(code, expected) {
+			t.Errorf("Expected C code to contain '%s', but it didn't:\n%s", expected, code)
 		}
-	})
+	}
+}
 
-	t.Run("regression test - regular function calls still work", func(t *testing.T) {
-		program := &lexer.Program{
-			Statements: []*lexer.Statement{
-				{
-					TopLevelFuncDecl: &lexer.TopLevelFuncDeclStmt{
-						Name:       "get_number",
-						Parameters: []*lexer.MethodParameter{},
-						ReturnType: "int",
-						Body: []*lexer.Statement{
-							{
-								Return: &lexer.ReturnStmt{
-									Value: "42",
-								},
-							},
-						},
-					},
-				},
-				{
-					VarDecl: &lexer.VarDeclStmt{
-						Type:  "int",
-						Name:  "num",
-						Value: "get_number()",
-					},
-				},
-			},
+func TestRenderListBuiltins(t *testing.T) {
+	program, err := lexer.ParseWithIndentation(`class Bag:
+    init():
+        list[float] this.weights = [2.5, 0.5]
+list[int] nums = [4, 9, 1]
+list[string] names = ["ann", "bob"]
+int total = sum!(nums) + min!(nums) + max!(nums)
+int at = index_of!(nums, 9)
+bool found = contains!(names, "bob")
+reverse!(nums)
+Bag bag = new Bag()
+reverse!(bag.weights)
+print "{max!(bag.weights)}"
+`)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	code := RenderC(program, "")
+	for _, expected := range []string{
+		"__scar_list_sum_int(nums, nums_len) + __scar_list_min_int(nums, nums_len) + __scar_list_max_int(nums, nums_len)",
+		"__scar_list_index_of_int(nums, nums_len, 9)",
+		`__scar_list_contains_str(names, names_len, "bob")`,
+		"__scar_list_reverse(nums, nums_len);",
+		"__scar_list_reverse(bag->weights, bag->weights_len);",
+		`printf("%f\n", __scar_list_max_float(bag->weights, bag->weights_len));`,
+	} {
+		if !strings.Contains(code, expected) {
+			t.Errorf("Expected C code to contain '%s', but it didn't:\n%s", expected, code)
 		}
+	}
+}
 
-		cCode := RenderC(program, "")
+func TestRenderConversions(t *testing.T) {
+	program, err := lexer.ParseWithIndentation(`int n = to_int("42")
+float f = to_float(" 2.5 ")
+string a = to_string(n + 1)
+string b = to_string(f)
+string c = to_string(n > 1)
+a = to_string('x')
+print "{to_float("1") + f}"
+`)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	code := RenderC(program, "")
+	for _, expected := range []string{
+		`int n = __scar_to_int("42");`,
+		`float f = __scar_to_float(" 2.5 ");`,
+		`char* a = __scar_str_format("%d", n + 1);`,
+		`char* b = __scar_str_format("%g", (double)(f));`,
+		`char* c = __scar_str_bool(n > 1);`,
+		`__scar_str_take(&a, __scar_str_format("%c", 'x'));`,
+		`printf("%f\n", __scar_to_float("1") + f);`,
+	} {
+		if !strings.Contains(code, expected) {
+			t.Errorf("Expected C code to contain '%s', but it didn't:\n%s", expected, code)
+		}
+	}
+}
 
-		expectedPrototype := "int get_number();"
-		if !strings.Contains(cCode, expectedPrototype) {
-			t.Errorf("Expected regular function prototype '%s' not found in generated code", expectedPrototype)
+func TestRenderCasts(t *testing.T) {
+	program, err := lexer.ParseWithIndentation(`enum Color:
+    Red
+    Green
+    Blue
+class Box:
+    init(int w):
+        float this.w = float(w) / 2
+int total = 7
+float avg = total as f64 / 2
+Color c = 2 as Color
+int i = c as int + 1
+u8 b = 300 as u8
+`)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	code := RenderC(program, "")
+	for _, expected := range []string{
+		"this->w = (float)(w) / 2;",
+		"float avg = ((double)(total)) / 2;",
+		"Color c = Color_from_int(2);",
+		"int i = ((int)(c)) + 1;",
+		"u8 b = ((u8)(300));",
+	} {
+		if !strings.Contains(code, expected) {
+			t.Errorf("Expected C code to contain '%s', but it didn't:\n%s", expected, code)
 		}
+	}
+}
 
-		expectedVarDecl := "int num = get_number();"
-		if !strings.Contains(cCode, expectedVarDecl) {
-			t.Errorf("Expected regular variable declaration '%s' not found in generated code", expectedVarDecl)
+func TestRenderStderrPrints(t *testing.T) {
+	program, err := lexer.ParseWithIndentation(`int n = 2
+eprint "low on {n}"
+eprint "%d left" | n
+eprint plain text
+eput "no newline"
+print "done"
+`)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	code := RenderC(program, "")
+	for _, expected := range []string{
+		`fprintf(stderr, "low on %d\n", n);`,
+		`fprintf(stderr, "%d left\n", n);`,
+		`fputs("plain text\n", stderr);`,
+		`fputs("no newline", stderr);`,
+		`fputs("done\n", stdout);`,
+	} {
+		if !strings.Contains(code, expected) {
+			t.Errorf("Expected C code to contain '%s', but it didn't:\n%s", expected, code)
 		}
+	}
+}
 
-		incorrectPrototype := "int get_number(int _output_array[], int _max_size);"
-		if strings.Contains(cCode, incorrectPrototype) {
-			t.Errorf("Found incorrect list function prototype '%s' - this indicates a regression", incorrectPrototype)
+func TestRenderPlainPrints(t *testing.T) {
+	program, err := lexer.ParseWithIndentation(`int n = 2
+print "100% done"
+print ""
+put "50%d"
+print "{n}% left"
+
+class Bar:
+    fn show() -> void:
+        print "10% of %s"
+        print ""
+`)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	code := RenderC(program, "")
+	for _, expected := range []string{
+		`fputs("100% done\n", stdout);`,
+		`fputs("\n", stdout);`,
+		`fputs("50%d", stdout);`,
+		`printf("%d%% left\n", n);`,
+		`fputs("10% of %s\n", stdout);`,
+	} {
+		if !strings.Contains(code, expected) {
+			t.Errorf("Expected C code to contain '%s', but it didn't:\n%s", expected, code)
+		}
+	}
+	if count := strings.Count(code, `fputs("\n", stdout);`); count != 2 {
+		t.Errorf("Expected both empty prints to write a newline, got %d:\n%s", count, code)
+	}
+}
+
+func TestRenderUnicode(t *testing.T) {
+	program, err := lexer.ParseWithIndentation(`string word = "héllo"
+int n = ulen(word)
+foreach (string ch in word):
+    print "{ch}"
+foreach (char b in word):
+    print "{b}"
+`)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	code := RenderC(program, "")
+	for _, expected := range []string{
+		"int n = __scar_utf8_len(word);",
+		"for (int __i = 0, __n; (__n = __scar_utf8_size(word + __i)) > 0; __i += __n) {",
+		"char ch[5] = {0};",
+		"memcpy(ch, word + __i, __n);",
+		"char b = word[__i];",
+	} {
+		if !strings.Contains(code, expected) {
+			t.Errorf("Expected C code to contain '%s', but it didn't:\n%s", expected, code)
 		}
+	}
+}
 
-		if t.Failed() {
-			t.Logf("Full generated C code:\n%s", cCode)
+func TestRenderFormat(t *testing.T) {
+	program, err := lexer.ParseWithIndentation(`fn describe(string name, int age) -> string:
+    return format!("%s is %d", name, age)
+
+string name = "Ada"
+string s = format!("%s: %.2f", name, 1.5 * 2)
+s = format!("[%*d]", 5, len(name))
+`)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	code := RenderC(program, "")
+	for _, expected := range []string{
+		`return __scar_str_format("%s is %d", name, age);`,
+		`char* s = __scar_str_format("%s: %.2f", name, 1.5 * 2);`,
+		`__scar_str_take(&s, __scar_str_format("[%*d]", 5, `,
+	} {
+		if !strings.Contains(code, expected) {
+			t.Errorf("Expected C code to contain '%s', but it didn't:\n%s", expected, code)
 		}
-	})
+	}
+
+	// Before 0.3 a string function returned "format" | values instead.
+	defer lexer.SetLangVersion(lexer.CurrentLangVersion)
+	lexer.SetLangVersion("0.2")
+	program, err = lexer.ParseWithIndentation(`fn describe(string name, int age) -> string:
+    return "%s is %d" | name, age
+`)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	if code := RenderC(program, ""); !strings.Contains(code, `return __scar_str_format("%s is %d", name, age);`) {
+		t.Errorf("Expected the pipe return to be formatted on the heap:\n%s", code)
+	}
+}
+
+func TestRenderListLiterals(t *testing.T) {
+	program, err := lexer.ParseWithIndentation(`fn total(list[int] xs) -> int:
+    return len(xs)
+
+fn names(string who) -> list[string]:
+    return [who, "b"]
+
+list[int] a = [1, 2]
+a = [a[1], a[0], 3]
+int n = total([4, 5])
+total([])
+`)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	code := RenderC(program, "")
+	for _, expected := range []string{
+		"char (*__items)[256] = __scar_list_strs((char[2][256]){0}, 2, who, \"b\");",
+		"strcpy(_output_array[_i], __items[_i]);",
+		"return __items_len;",
+		"int* __items = ((int[]){a[1], a[0], 3});",
+		"a_len = 0;",
+		"__scar_list_push(a, a_len, a_cap, __items[__i]);",
+		"int n = total(((int[]){4, 5}), 2);",
+		"total(NULL, 0);",
+	} {
+		if !strings.Contains(code, expected) {
+			t.Errorf("Expected C code to contain '%s', but it didn't:\n%s", expected, code)
+		}
+	}
+}
+
+func TestFunctionHoisting(t *testing.T) {
+	program := &lexer.Program{
+		Imports: []*lexer.ImportStmt{},
+		Statements: []*lexer.Statement{
+			{
+				TopLevelFuncDecl: &lexer.TopLevelFuncDeclStmt{
+					Name:       "main",
+					Parameters: []*lexer.MethodParameter{},
+					ReturnType: "void",
+					Body: []*lexer.Statement{
+						{
+							FunctionCall: &lexer.FunctionCallStmt{
+								Name: "print",
+								Args: []string{"calculate(5)"},
+							},
+						},
+					},
+				},
+			},
+			{
+				TopLevelFuncDecl: &lexer.TopLevelFuncDeclStmt{
+					Name: "calculate",
+					Parameters: []*lexer.MethodParameter{
+						{
+							Type: "int",
+							Name: "x",
+						},
+					},
+					ReturnType: "int",
+					Body: []*lexer.Statement{
+						{
+							Return: &lexer.ReturnStmt{
+								Value: "x * 2",
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	// Generate the C code
+	cCode := RenderC(program, "")
+
+	// Verify the output contains the function prototype before the main function
+	prototypeIndex := strings.Index(cCode, "int calculate(int x);")
+	mainFuncIndex := strings.Index(cCode, "int main(int argc, char** argv) {")
+	calculateFuncIndex := strings.Index(cCode, "int calculate(int x) {")
+
+	// The prototype should appear before both function implementations
+	if prototypeIndex == -1 {
+		t.Error("Function prototype not found in generated code")
+	} else if prototypeIndex >= mainFuncIndex || prototypeIndex >= calculateFuncIndex {
+		t.Error("Function prototype not emitted before function implementations")
+	}
+
+	// Both function implementations should be present
+	if mainFuncIndex == -1 {
+		t.Error("main function not found in generated code")
+	}
+
+	if calculateFuncIndex == -1 {
+		t.Error("calculate function not found in generated code")
+	}
+
+	// The function call in main should be correct
+	if !strings.Contains(cCode, "print(calculate(5))") {
+		t.Error("Function call in main is incorrect")
+	}
+
+	// Verify the function prototype is correct
+	expectedPrototype := "int calculate(int x);"
+	if !strings.Contains(cCode, expectedPrototype) {
+		t.Errorf("Expected prototype '%s' not found in generated code", expectedPrototype)
+	}
+}
+
+func TestMethodCallTranslation(t *testing.T) {
+	input := `pub int PI = 3
+pub class Calculator:
+    fn add(int a, int b) -> int:
+        return a + b
+var calc = new Calculator()
+print "%d" | calc.add(2, 3)`
+
+	program, err := lexer.ParseWithIndentation(input)
+	if err != nil {
+		t.Fatalf("Failed to parse input: %v", err)
+	}
+
+	result := RenderC(program, ".")
+
+	expectedClassDecl := "typedef struct Calculator Calculator;"
+	if !strings.Contains(result, expectedClassDecl) {
+		t.Errorf("Expected class typedef '%s' not found in generated code", expectedClassDecl)
+	}
+	expectedConstructor := "Calculator* Calculator_new();"
+	if !strings.Contains(result, expectedConstructor) {
+		t.Errorf("Expected constructor declaration '%s' not found in generated code", expectedConstructor)
+	}
+	expectedMethodDecl := "int Calculator_add(Calculator* this, int a, int b);"
+	if !strings.Contains(result, expectedMethodDecl) {
+		t.Errorf("Expected method declaration '%s' not found in generated code", expectedMethodDecl)
+	}
+	expectedInstantiation := "Calculator* calc = Calculator_new();"
+	if !strings.Contains(result, expectedInstantiation) {
+		t.Errorf("Expected object instantiation '%s' not found in generated code", expectedInstantiation)
+	}
+	expectedMethodCall := "Calculator_add(calc, 2, 3)"
+	if !strings.Contains(result, expectedMethodCall) {
+		t.Errorf("Expected method call '%s' not found in generated code", expectedMethodCall)
+	}
+	incorrectMethodCall := "Calc_add(calc, 2, 3)"
+	if strings.Contains(result, incorrectMethodCall) {
+		t.Errorf("Found incorrect method call '%s' in generated code - this indicates a regression", incorrectMethodCall)
+	}
+	expectedPrintCall := `printf("%d\n", Calculator_add(calc, 2, 3));`
+	if !strings.Contains(result, expectedPrintCall) {
+		t.Errorf("Expected print statement '%s' not found in generated code", expectedPrintCall)
+	}
+	expectedGlobalVar := "int PI = 3;"
+	if !strings.Contains(result, expectedGlobalVar) {
+		t.Errorf("Expected global variable '%s' not found in generated code", expectedGlobalVar)
+	}
+	if t.Failed() {
+		t.Logf("Full generated C code:\n%s", result)
+	}
+}
+
+func TestRenderCWithListFunctionAssignment(t *testing.T) {
+	t.Run("simple int list function assignment", func(t *testing.T) {
+		program := &lexer.Program{
+			Statements: []*lexer.Statement{
+				{
+					TopLevelFuncDecl: &lexer.TopLevelFuncDeclStmt{
+						Name:       "get_numbers",
+						Parameters: []*lexer.MethodParameter{},
+						ReturnType: "list[int]",
+						Body: []*lexer.Statement{
+							{
+								ListDecl: &lexer.ListDeclStmt{
+									Name:     "result",
+									Type:     "int",
+									Elements: []string{"1", "2", "3"},
+								},
+							},
+							{
+								Return: &lexer.ReturnStmt{
+									Value: "result",
+								},
+							},
+						},
+					},
+				},
+				{
+					ListDeclFunctionCall: &lexer.ListDeclFunctionCallStmt{
+						Type:         "int",
+						Name:         "my_list",
+						FunctionCall: "get_numbers()",
+					},
+				},
+				{
+					Print: &lexer.PrintStmt{
+						Format:    "First: %d",
+						Variables: []string{"my_list[0]"},
+					},
+				},
+			},
+		}
+
+		cCode := RenderC(program, "")
+		expectedPrototype := "int get_numbers(int _output_array[], int _max_size);"
+		if !strings.Contains(cCode, expectedPrototype) {
+			t.Errorf("Expected function prototype '%s' not found in generated code", expectedPrototype)
+		}
+		expectedSignature := "int get_numbers(int _output_array[], int _max_size) {"
+		if !strings.Contains(cCode, expectedSignature) {
+			t.Errorf("Expected function signature '%s' not found in generated code", expectedSignature)
+		}
+		expectedCopy := "for (int _i = 0; _i < result_len && _i < _max_size; _i++) {"
+		if !strings.Contains(cCode, expectedCopy) {
+			t.Errorf("Expected array copy loop '%s' not found in generated code", expectedCopy)
+		}
+		expectedReturnLength := "return result_len;"
+		if !strings.Contains(cCode, expectedReturnLength) {
+			t.Errorf("Expected return length statement '%s' not found in generated code", expectedReturnLength)
+		}
+		expectedListDecl := "int* my_list = NULL;"
+		if !strings.Contains(cCode, expectedListDecl) {
+			t.Errorf("Expected list declaration '%s' not found in generated code", expectedListDecl)
+		}
+		expectedLengthVar := "int my_list_len = 0;"
+		if !strings.Contains(cCode, expectedLengthVar) {
+			t.Errorf("Expected length variable '%s' not found in generated code", expectedLengthVar)
+		}
+		expectedFunctionCall := "my_list_len = get_numbers(my_list, my_list_cap);"
+		if !strings.Contains(cCode, expectedFunctionCall) {
+			t.Errorf("Expected function call '%s' not found in generated code", expectedFunctionCall)
+		}
+		if t.Failed() {
+			t.Logf("Full generated C code:\n%s", cCode)
+		}
+	})
+
+	t.Run("string list function assignment", func(t *testing.T) {
+		program := &lexer.Program{
+			Statements: []*lexer.Statement{
+				{
+					TopLevelFuncDecl: &lexer.TopLevelFuncDeclStmt{
+						Name:       "get_names",
+						Parameters: []*lexer.MethodParameter{},
+						ReturnType: "list[string]",
+						Body: []*lexer.Statement{
+							{
+								ListDecl: &lexer.ListDeclStmt{
+									Name:     "result",
+									Type:     "string",
+									Elements: []string{"\"Alice\"", "\"Bob\"", "\"Charlie\""},
+								},
+							},
+							{
+								Return: &lexer.ReturnStmt{
+									Value: "result",
+								},
+							},
+						},
+					},
+				},
+				{
+					ListDeclFunctionCall: &lexer.ListDeclFunctionCallStmt{
+						Type:         "string",
+						Name:         "my_names",
+						FunctionCall: "get_names()",
+					},
+				},
+			},
+		}
+
+		cCode := RenderC(program, "")
+
+		expectedPrototype := "int get_names(char _output_array[][256], int _max_size);"
+		if !strings.Contains(cCode, expectedPrototype) {
+			t.Errorf("Expected string function prototype '%s' not found in generated code", expectedPrototype)
+		}
+		expectedStringCopy := "strcpy(_output_array[_i], result[_i]);"
+		if !strings.Contains(cCode, expectedStringCopy) {
+			t.Errorf("Expected string copy statement '%s' not found in generated code", expectedStringCopy)
+		}
+		expectedStringListDecl := "char (*my_names)[256] = NULL;"
+		if !strings.Contains(cCode, expectedStringListDecl) {
+			t.Errorf("Expected string list declaration '%s' not found in generated code", expectedStringListDecl)
+		}
+		if t.Failed() {
+			t.Logf("Full generated C code:\n%s", cCode)
+		}
+	})
+
+	t.Run("function with parameters returning list", func(t *testing.T) {
+		program := &lexer.Program{
+			Statements: []*lexer.Statement{
+				{
+					TopLevelFuncDecl: &lexer.TopLevelFuncDeclStmt{
+						Name: "create_range",
+						Parameters: []*lexer.MethodParameter{
+							{Type: "int", Name: "start"},
+							{Type: "int", Name: "end"},
+						},
+						ReturnType: "list[int]",
+						Body: []*lexer.Statement{
+							{
+								ListDecl: &lexer.ListDeclStmt{
+									Name:     "result",
+									Type:     "int",
+									Elements: []string{},
+								},
+							},
+							{
+								Return: &lexer.ReturnStmt{
+									Value: "result",
+								},
+							},
+						},
+					},
+				},
+				{
+					ListDeclFunctionCall: &lexer.ListDeclFunctionCallStmt{
+						Type:         "int",
+						Name:         "range_list",
+						FunctionCall: "create_range(1, 5)",
+					},
+				},
+			},
+		}
+
+		cCode := RenderC(program, "")
+
+		expectedPrototype := "int create_range(int _output_array[], int _max_size, int start, int end);"
+
+		if !strings.Contains(cCode, expectedPrototype) {
+			t.Errorf("Expected function prototype with params '%s' not found in generated code", expectedPrototype)
+		}
+
+		expectedFunctionCall := "range_list_len = create_range(range_list, range_list_cap, 1, 5);"
+
+		if !strings.Contains(cCode, expectedFunctionCall) {
+			t.Errorf("Expected function call with params '%s' not found in generated code", expectedFunctionCall)
+		}
+
+		if t.Failed() {
+			t.Logf("Full generated C code:\n%s", cCode)
+		}
+	})
+
+	t.Run("regression test - regular function calls still work", func(t *testing.T) {
+		program := &lexer.Program{
+			Statements: []*lexer.Statement{
+				{
+					TopLevelFuncDecl: &lexer.TopLevelFuncDeclStmt{
+						Name:       "get_number",
+						Parameters: []*lexer.MethodParameter{},
+						ReturnType: "int",
+						Body: []*lexer.Statement{
+							{
+								Return: &lexer.ReturnStmt{
+									Value: "42",
+								},
+							},
+						},
+					},
+				},
+				{
+					VarDecl: &lexer.VarDeclStmt{
+						Type:  "int",
+						Name:  "num",
+						Value: "get_number()",
+					},
+				},
+			},
+		}
+
+		cCode := RenderC(program, "")
+
+		expectedPrototype := "int get_number();"
+		if !strings.Contains(cCode, expectedPrototype) {
+			t.Errorf("Expected regular function prototype '%s' not found in generated code", expectedPrototype)
+		}
+
+		expectedVarDecl := "int num = get_number();"
+		if !strings.Contains(cCode, expectedVarDecl) {
+			t.Errorf("Expected regular variable declaration '%s' not found in generated code", expectedVarDecl)
+		}
+
+		incorrectPrototype := "int get_number(int _output_array[], int _max_size);"
+		if strings.Contains(cCode, incorrectPrototype) {
+			t.Errorf("Found incorrect list function prototype '%s' - this indicates a regression", incorrectPrototype)
+		}
+
+		if t.Failed() {
+			t.Logf("Full generated C code:\n%s", cCode)
+		}
+	})
+}
+
+func TestGrowableListBuiltins(t *testing.T) {
+	input := `list[int] xs = []
+append!(xs, 42)
+int last = pop!(xs)
+print "%d" | len(xs)
+`
+	program, err := lexer.ParseWithIndentation(input)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	cCode := RenderC(program, "")
+	expected := []string{
+		"int* xs = NULL;",
+		"int xs_len = 0;",
+		"int xs_cap = 0;",
+		"__scar_list_push(xs, xs_len, xs_cap, 42);",
+		"int last = __scar_list_pop(xs, xs_len);",
+		`printf("%d\n", xs_len);`,
+	}
+	for _, want := range expected {
+		if !strings.Contains(cCode, want) {
+			t.Errorf("Expected C code to contain '%s', but it didn't:\n%s", want, cCode)
+		}
+	}
+	if strings.Contains(cCode, "[1000]") {
+		t.Errorf("Expected no fixed size list buffers, got:\n%s", cCode)
+	}
+}
+
+func TestHeapStringAssignmentAndConcat(t *testing.T) {
+	input := `string s = "abc"
+s = "a much longer value"
+cat!(s, "!")
+string t = s
+print "%s %d" | t, len(s)
+`
+	program, err := lexer.ParseWithIndentation(input)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	cCode := RenderC(program, "")
+	expected := []string{
+		`char* s = __scar_str_new("abc");`,
+		`__scar_str_set(&s, "a much longer value");`,
+		`__scar_str_cat(&s, "!");`,
+		`char* t = __scar_str_new(s);`,
+		`printf("%s %d\n", t, (int)strlen(s));`,
+	}
+	for _, want := range expected {
+		if !strings.Contains(cCode, want) {
+			t.Errorf("Expected C code to contain '%s', but it didn't:\n%s", want, cCode)
+		}
+	}
+}
+
+func TestClassInheritance(t *testing.T) {
+	input := `class Animal:
+    init(string name, int legs):
+        this.name = name
+        this.legs = legs
+
+    fn speak():
+        print "%s makes a sound" | this.name
+
+    fn describe():
+        print "%s has %d legs" | this.name, this.legs
+
+class Dog(Animal):
+    init(string name):
+        super(name, 4)
+
+    fn speak():
+        print "%s barks" | this.name
+
+class Puppy(Dog):
+    fn play():
+        this.describe()
+
+Puppy p = new Puppy("Bit")
+p.speak()
+p.describe()
+`
+	program, err := lexer.ParseWithIndentation(input)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	cCode := RenderC(program, "")
+	expected := []string{
+		"typedef struct Dog {\n    union {\n        Animal base_Animal;\n        struct {\n            char* name;\n            int legs;\n        };\n    };\n} Dog;",
+		"static inline Animal* Dog_as_Animal(Dog* obj) { return &obj->base_Animal; }",
+		"static inline Dog* Puppy_as_Dog(Puppy* obj) { return &obj->base_Dog; }",
+		"static inline Animal* Puppy_as_Animal(Puppy* obj) { return &obj->base_Animal; }",
+		"Puppy* Puppy_new(char* name);",
+		"Animal* __super = Animal_new(name, 4);\n    this->base_Animal = *__super;\n    free(__super);",
+		"Dog* __super = Dog_new(name);",
+		"Animal_describe(Puppy_as_Animal(this));",
+		"Dog_speak(Puppy_as_Dog(p));",
+		"Animal_describe(Puppy_as_Animal(p));",
+	}
+	for _, want := range expected {
+		if !strings.Contains(cCode, want) {
+			t.Errorf("Expected C code to contain '%s', but it didn't:\n%s", want, cCode)
+		}
+	}
+	if strings.Index(cCode, "typedef struct Animal {") > strings.Index(cCode, "typedef struct Dog {") {
+		t.Errorf("Expected the base struct to be defined before its subclasses")
+	}
+}
+
+func TestInterfaceDispatch(t *testing.T) {
+	input := `interface Shape:
+    fn area() -> float
+    fn scale(float factor)
+
+class Rect implements Shape:
+    init(float w, float h):
+        this.w = w
+        this.h = h
+
+    fn area() -> float:
+        return this.w * this.h
+
+    fn scale(float factor):
+        this.w = this.w * factor
+
+class Square(Rect):
+    init(float side):
+        super(side, side)
+
+Rect r = new Rect(2, 3)
+Shape s = new Square(2)
+list[Shape] shapes = []
+append!(shapes, r)
+append!(shapes, s)
+shapes[0].scale(2)
+float a = s.area()
+`
+	program, err := lexer.ParseWithIndentation(input)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	cCode := RenderC(program, "")
+	expected := []string{
+		"typedef struct Shape_vtable {\n    float (*area)(void* self);\n    void (*scale)(void* self, float factor);\n} Shape_vtable;",
+		"typedef struct Shape {\n    void* self;\n    const Shape_vtable* vtable;\n} Shape;",
+		"static const Shape_vtable Rect_Shape_vtable = { .area = Rect_Shape_area, .scale = Rect_Shape_scale };",
+		"static inline Shape Square_as_Shape(Square* obj) { return (Shape){ obj, &Square_Shape_vtable }; }",
+		"static float Square_Shape_area(void* self) {\n    return Rect_area(Square_as_Rect((Square*)self));\n}",
+		"Shape s = Square_as_Shape(Square_new(2));",
+		"__scar_list_push(shapes, shapes_len, shapes_cap, Rect_as_Shape(r));",
+		"__scar_list_push(shapes, shapes_len, shapes_cap, s);",
+		"shapes[0].vtable->scale(shapes[0].self, 2);",
+		"float a = s.vtable->area(s.self);",
+	}
+	for _, want := range expected {
+		if !strings.Contains(cCode, want) {
+			t.Errorf("Expected C code to contain '%s', but it didn't:\n%s", want, cCode)
+		}
+	}
+}
+
+func TestMatchLowering(t *testing.T) {
+	input := `enum Color:
+    Red
+    Green
+
+int c = Color::Green
+match c:
+    case Color::Red:
+        print "red"
+    case Color::Green, 7:
+        print "green"
+    else:
+        print "other"
+
+for i = 0 to 10:
+    match i:
+        case 0..2:
+            continue
+        case 8:
+            break
+
+string name = "bob"
+match name:
+    case "bob":
+        print "hi"
+`
+	program, err := lexer.ParseWithIndentation(lexer.ReplaceDoubleColonsOutsideStrings(input))
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	cCode := RenderC(program, "")
+	expected := []string{
+		"switch (c) {\n        case Color_Red: {\n            fputs(\"red\\n\", stdout);\n            break;\n        }",
+		"case Color_Green:\n        case 7: {",
+		"default: {",
+		"if ((i >= 0 && i <= 2)) {\n            continue;\n        }\n        else if (i == 8) {\n            break;\n        }",
+		"if (strcmp(name, \"bob\") == 0) {",
+	}
+	for _, want := range expected {
+		if !strings.Contains(cCode, want) {
+			t.Errorf("Expected C code to contain '%s', but it didn't:\n%s", want, cCode)
+		}
+	}
+}
+
+func TestTryCatchFrames(t *testing.T) {
+	input := `fn risky(int n) -> int:
+    try:
+        return n
+    catch e:
+        throw e
+    finally:
+        print "done"
+
+for i = 0 to 3:
+    try:
+        break
+    catch:
+        throw "failed"
+`
+	program, err := lexer.ParseWithIndentation(input)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	cCode := RenderC(program, "")
+	expected := []string{
+		"__scar_try_frame __try_0;\n        __scar_try_push(&__try_0);\n        if (setjmp(__try_0.env) == 0) {",
+		"__auto_type __ret = n;\n                __scar_try_top = __try_0.prev;\n                fputs(\"done\\n\", stdout);\n                return __ret;",
+		"__scar_exception* e = &__caught;",
+		"__scar_throw(e->code, e->message);",
+		"fputs(\"done\\n\", stdout);\n                __scar_rethrow();",
+		"__scar_try_top = __try_0.prev;\n                break;",
+		"__scar_throw(1, \"failed\");",
+	}
+	for _, want := range expected {
+		if !strings.Contains(cCode, want) {
+			t.Errorf("Expected C code to contain '%s', but it didn't:\n%s", want, cCode)
+		}
+	}
+}
+
+func TestLabeledLoopExits(t *testing.T) {
+	input := `outer: for i = 0 to 3:
+    for j = 0 to 3:
+        if j > i:
+            continue outer
+        if j == 2:
+            break 2
+        print "%d %d", i, j
+`
+	program, err := lexer.ParseWithIndentation(input)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	cCode := RenderC(program, "")
+	expected := []string{
+		"goto __loop_0_continue;",
+		"goto __loop_0_break;",
+		"        __loop_0_continue: ;\n    }\n    __loop_0_break: ;",
+	}
+	for _, want := range expected {
+		if !strings.Contains(cCode, want) {
+			t.Errorf("Expected C code to contain '%s', but it didn't:\n%s", want, cCode)
+		}
+	}
+	if strings.Contains(cCode, "__loop_1_") {
+		t.Errorf("Expected no labels for the inner loop:\n%s", cCode)
+	}
+}
+
+func TestStringInterpolation(t *testing.T) {
+	input := `fn ratio(int a, int b) -> float:
+    return a / b
+
+string name = "Ada"
+int age = 36
+char grade = 'A'
+print "{name} is {age}, grade {grade}, ratio {ratio(age, 2)}, 100%"
+put "{age > 30}"
+string line = "{name}!"
+line = "age {age + 1}"
+`
+	program, err := lexer.ParseWithIndentation(input)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	cCode := RenderC(program, "")
+	expected := []string{
+		`printf("%s is %d, grade %c, ratio %f, 100%%\n", name, age, grade, ratio(age, 2));`,
+		`printf("%d", age > 30);`,
+		`char* line = __scar_str_format("%s!", name);`,
+		`__scar_str_take(&line, __scar_str_format("age %d", age + 1));`,
+	}
+	for _, want := range expected {
+		if !strings.Contains(cCode, want) {
+			t.Errorf("Expected C code to contain '%s', but it didn't:\n%s", want, cCode)
+		}
+	}
+}
+
+func TestNestedLists(t *testing.T) {
+	input := `fn total(list[list[int]] g) -> int:
+    int sum = 0
+    for i = 0 to len(g) - 1:
+        for j = 0 to len(g[i]) - 1:
+            sum = sum + g[i][j]
+    return sum
+
+list[list[int]] grid = [[1, 2], []]
+list[int] row = [7, 8]
+append!(grid, row)
+list[list[float]] zeros = grid!(2, 3)
+print "{total(grid)} {zeros[1][2]}"
+`
+	program, err := lexer.ParseWithIndentation(input)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	cCode := RenderC(program, "")
+	expected := []string{
+		`int total(int** g, int* g_lens, int g_len) {`,
+		`for (int j = 0; j <= (g_lens[i] - 1); j++) {`,
+		`int* grid_lens = NULL;`,
+		`__scar_list_push_row(grid, grid_lens, grid_len, grid_cap, ((int[]){1, 2}), 2);`,
+		`__scar_list_push_row(grid, grid_lens, grid_len, grid_cap, NULL, 0);`,
+		`__scar_list_push_row(grid, grid_lens, grid_len, grid_cap, row, row_len);`,
+		`float** zeros = NULL;`,
+		`__scar_list_add_row(zeros, zeros_lens, zeros_len, zeros_cap, 3);`,
+		`printf("%d %f\n", total(grid, grid_lens, grid_len), zeros[1][2]);`,
+	}
+	for _, want := range expected {
+		if !strings.Contains(cCode, want) {
+			t.Errorf("Expected C code to contain '%s', but it didn't:\n%s", want, cCode)
+		}
+	}
+}
+
+func TestSlices(t *testing.T) {
+	input := `list[int] items = [1, 2, 3, 4]
+list[int] mid = items[1:len(items) - 1]
+items = items[2:]
+string name = "hello"
+string head = name[:2]
+head = name[-3:]
+`
+	program, err := lexer.ParseWithIndentation(input)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	cCode := RenderC(program, "")
+	expected := []string{
+		`int __lo = __scar_list_bound(1, items_len);`,
+		`int __hi = __scar_list_bound(items_len - 1, items_len);`,
+		`__scar_list_push(mid, mid_len, mid_cap, items[__i]);`,
+		`int __hi = __scar_list_bound(items_len, items_len);`,
+		`items = __slice;`,
+		`char* head = __scar_str_slice(name, 0, 2);`,
+		`__scar_str_take(&head, __scar_str_slice(name, -3, INT_MAX));`,
+	}
+	for _, want := range expected {
+		if !strings.Contains(cCode, want) {
+			t.Errorf("Expected C code to contain '%s', but it didn't:\n%s", want, cCode)
+		}
+	}
+}
+
+func TestHashMaps(t *testing.T) {
+	input := `class Inventory:
+    init():
+        map[string: int] this.stock = ["apple": 3]
+
+    fn add(string item, int n):
+        int total = get!(this.stock, item) + n
+        put!(this.stock, item, total)
+
+    fn replace(map[string: int] other):
+        this.stock = other
+
+map[int: float] big = []
+for i = 0 to 999:
+    put!(big, i, 0.5)
+foreach (int k in big.keys):
+    print "{k} {get!(big, k)} {has!(big, k + 1)}"
+`
+	program, err := lexer.ParseWithIndentation(input)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	cCode := RenderC(program, "")
+	expected := []string{
+		`__scar_map stock;`,
+		`this->stock = __scar_map_new(sizeof(char*), sizeof(int), 1, 0);`,
+		`__scar_map_put(&this->stock, &(char*){"apple"}, &(int){3});`,
+		`int total = (*(int*)__scar_map_get(&this->stock, &(char*){item})) + n;`,
+		`__scar_map_put(&this->stock, &(char*){item}, &(int){total});`,
+		`__scar_map_copy(&this->stock, &other);`,
+		`__scar_map big = __scar_map_new(sizeof(int), sizeof(float), 0, 0);`,
+		`__scar_map_put(&big, &(int){i}, &(float){0.5});`,
+		`if (!(&big)->live[__i]) continue;`,
+		`int k = *(int*)__scar_map_key(&big, __i);`,
+		`printf("%d %f %d\n", k, (*(float*)__scar_map_get(&big, &(int){k})), __scar_map_has(&big, &(int){k + 1}));`,
+	}
+	for _, want := range expected {
+		if !strings.Contains(cCode, want) {
+			t.Errorf("Expected C code to contain '%s', but it didn't:\n%s", want, cCode)
+		}
+	}
+}
+
+func TestMapDeleteAndLength(t *testing.T) {
+	input := `class Registry:
+    init():
+        map[string: int] this.ids = ["a": 1]
+
+    fn drop(string name) -> bool:
+        bool removed = del!(this.ids, name)
+        return removed
+
+    fn size() -> int:
+        return maplen!(this.ids)
+
+map[int: int] squares = []
+del!(squares, 4)
+if has!(squares, 9):
+    print "left {maplen!(squares)}"
+`
+	program, err := lexer.ParseWithIndentation(input)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	cCode := RenderC(program, "")
+	expected := []string{
+		`bool removed = __scar_map_del(&this->ids, &(char*){name});`,
+		`return (&this->ids)->len;`,
+		`__scar_map_del(&squares, &(int){4});`,
+		`if (__scar_map_has(&squares, &(int){9})) {`,
+		`printf("left %d\n", (&squares)->len);`,
+	}
+	for _, want := range expected {
+		if !strings.Contains(cCode, want) {
+			t.Errorf("Expected C code to contain '%s', but it didn't:\n%s", want, cCode)
+		}
+	}
+}
+
+func TestSets(t *testing.T) {
+	input := `class Visitor:
+    init():
+        set[string] this.seen = ["home"]
+
+    fn visit(string page) -> bool:
+        if contains!(this.seen, page):
+            return false
+        add!(this.seen, page)
+        return true
+
+set[int] evens = []
+add!(evens, 4)
+remove!(evens, 2)
+foreach (int n in evens):
+    print "{n}"
+`
+	program, err := lexer.ParseWithIndentation(input)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	cCode := RenderC(program, "")
+	expected := []string{
+		`__scar_map seen;`,
+		`this->seen = __scar_map_new(sizeof(char*), 0, 1, 0);`,
+		`__scar_map_entry(&this->seen, &(char*){"home"});`,
+		`if (__scar_map_has(&this->seen, &(char*){page})) {`,
+		`__scar_map_entry(&this->seen, &(char*){page});`,
+		`__scar_map evens = __scar_map_new(sizeof(int), 0, 0, 0);`,
+		`__scar_map_entry(&evens, &(int){4});`,
+		`__scar_map_del(&evens, &(int){2});`,
+		`int n = *(int*)__scar_map_key(&evens, __i);`,
+	}
+	for _, want := range expected {
+		if !strings.Contains(cCode, want) {
+			t.Errorf("Expected C code to contain '%s', but it didn't:\n%s", want, cCode)
+		}
+	}
+}
+
+func TestOptionals(t *testing.T) {
+	input := `class Node:
+    init(int value):
+        int this.value = value
+        Node? this.next = nil
+
+fn describe(int? n) -> void:
+    if n != nil:
+        print "got {n}"
+
+Node head = new Node(1)
+if head.next != nil:
+    print "{head.next.value}"
+int? maybe = nil
+maybe = 41
+describe(7)
+string? name = nil
+`
+	program, err := lexer.ParseWithIndentation(input)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	cCode := RenderC(program, "")
+	expected := []string{
+		`Node* next;`,
+		`this->next = NULL;`,
+		`void describe(int* n) {`,
+		`if (n != NULL) {`,
+		`(*__scar_unwrap(n, "n"))`,
+		`int* maybe = NULL;`,
+		`maybe = __scar_box(int, 41);`,
+		`describe(__scar_box(int, 7));`,
+		`char* name = NULL;`,
+	}
+	for _, want := range expected {
+		if !strings.Contains(cCode, want) {
+			t.Errorf("Expected C code to contain '%s', but it didn't:\n%s", want, cCode)
+		}
+	}
+}
+
+func TestStructs(t *testing.T) {
+	input := `struct Point:
+    int x
+    int y
+
+class Player:
+    init():
+        Point this.pos = Point(0, 0)
+
+    fn walk(int dx):
+        this.pos.x = this.pos.x + dx
+
+fn shifted(Point p, int by) -> Point:
+    p.x = p.x + by
+    return p
+
+Point a = Point(1, 2)
+a.y = 5
+Point b = shifted(a, 3)
+print "{b.x}"
+list[Point] pts = [Point(1, 1)]
+append!(pts, Point(3, 9))
+`
+	program, err := lexer.ParseWithIndentation(input)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	cCode := RenderC(program, "")
+	expected := []string{
+		"typedef struct {\n    int x;\n    int y;\n} Point;",
+		`Point pos;`,
+		`this->pos = (Point){0, 0};`,
+		`this->pos.x = this->pos.x + dx;`,
+		`Point shifted(Point p, int by) {`,
+		`p.x = p.x + by;`,
+		`Point a = (Point){1, 2};`,
+		`a.y = 5;`,
+		`printf("%d\n", b.x);`,
+		`pts[0] = (Point){1, 1};`,
+		`__scar_list_push(pts, pts_len, pts_cap, (Point){3, 9});`,
+	}
+	for _, want := range expected {
+		if !strings.Contains(cCode, want) {
+			t.Errorf("Expected C code to contain '%s', but it didn't:\n%s", want, cCode)
+		}
+	}
+}
+
+func TestConstructorDefaults(t *testing.T) {
+	input := `class Rect:
+    init(int w = 10, string tag = "plain"):
+        int this.w = w
+        string this.label = tag
+
+class Square(Rect):
+    init(int side):
+        super(side)
+
+Rect a = new Rect()
+Rect b = new Rect(4)
+Rect c = new Rect(4, "named")
+print "{new Rect().w}"
+`
+	program, err := lexer.ParseWithIndentation(input)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	cCode := RenderC(program, "")
+	expected := []string{
+		`Rect* Rect_new(int w, char* tag) {`,
+		`strcpy(this->label, tag);`,
+		`Rect* __super = Rect_new(side, "plain");`,
+		`Rect* a = Rect_new(10, "plain");`,
+		`Rect* b = Rect_new(4, "plain");`,
+		`Rect* c = Rect_new(4, "named");`,
+		`Rect_new(10, "plain")->w`,
+	}
+	for _, want := range expected {
+		if !strings.Contains(cCode, want) {
+			t.Errorf("Expected C code to contain '%s', but it didn't:\n%s", want, cCode)
+		}
+	}
+}
+
+func TestDeinitAndDelete(t *testing.T) {
+	input := `class Resource:
+    init(int id):
+        int this.id = id
+        set[int] this.seen = []
+
+    deinit:
+        print "closing {this.id}"
+
+class Pool(Resource):
+    init(int id):
+        super(id)
+
+Resource r = new Resource(1)
+delete r
+`
+	program, err := lexer.ParseWithIndentation(input)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	cCode := RenderC(program, "")
+	expected := []string{
+		"void Resource_free(Resource* this);",
+		"void Resource_deinit(Resource* this) {\n    printf(\"closing %d\\n\", this->id);\n    __scar_map_free(&this->seen);\n}",
+		"void Resource_free(Resource* this) {\n    if (this == NULL) {\n        return;\n    }\n    Resource_deinit(this);\n    free(this);\n}",
+		"void Pool_deinit(Pool* this) {\n    Resource_deinit(&this->base_Resource);\n}",
+		"Resource_free(r);\n    r = NULL;",
+	}
+	for _, want := range expected {
+		if !strings.Contains(cCode, want) {
+			t.Errorf("Expected C code to contain '%s', but it didn't:\n%s", want, cCode)
+		}
+	}
+}
+
+func TestMemoryModes(t *testing.T) {
+	input := `class Node:
+    init(int value):
+        int this.value = value
+        Node? this.next = nil
+
+class Stack:
+    init():
+        Node? this.top = nil
+
+    fn push(int value):
+        Node fresh = new Node(value)
+        fresh.next = this.top
+        this.top = fresh
+
+    fn peek() -> int:
+        Node? top = this.top
+        if top == nil:
+            return -1
+        return top.value
+
+Stack s = new Stack()
+s.push(1)
+delete s
+`
+	if err := CheckMemoryMode("gc"); err == nil {
+		t.Error("CheckMemoryMode should reject unknown modes")
+	}
+
+	tests := []struct {
+		mode     string
+		expected []string
+	}{
+		{MemRC, []string{
+			"Node* this = __scar_rc_alloc(sizeof(Node), (void (*)(void*))Node_deinit);",
+			"void Node_deinit(Node* this) {\n    __scar_release(this->next);\n}",
+			"void Stack_free(Stack* this) {\n    if (this == NULL) {\n        return;\n    }\n    __scar_release(this);\n}",
+			"__scar_rc_set(fresh->next, this->top);\n    __scar_rc_set(this->top, fresh);\n    __scar_release(fresh);\n}",
+			"Node* top = __scar_retain(this->top);",
+			"__typeof__(__scar_unwrap(top, \"top\")->value) __scar_ret = __scar_unwrap(top, \"top\")->value;\n        __scar_release(top);\n        return __scar_ret;",
+			"Stack_free(s);\n    s = NULL;\n    __scar_release(s);\n    return 0;",
+		}},
+		{MemArena, []string{
+			"Node* this = __scar_arena_alloc(sizeof(Node));",
+			"void Node_free(Node* this) {\n    if (this == NULL) {\n        return;\n    }\n    Node_deinit(this);\n}",
+			"fresh->next = this->top;\n    this->top = fresh;\n}",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			program, err := lexer.ParseWithIndentation(input)
+			if err != nil {
+				t.Fatalf("ParseWithIndentation failed: %v", err)
+			}
+			cCode := NewRenderer(Options{Memory: tt.mode}).RenderC(program, "")
+			for _, want := range tt.expected {
+				if !strings.Contains(cCode, want) {
+					t.Errorf("Expected C code to contain '%s', but it didn't:\n%s", want, cCode)
+				}
+			}
+		})
+	}
+}
+
+func TestConstsAndArrays(t *testing.T) {
+	input := `const int MAX = 8
+const int DOUBLE = MAX * 2
+const string NAME = "scar"
+int[DOUBLE] buf
+list[string] names = ["a"]
+string[MAX] labels
+buf[1] = MAX
+print "{NAME} {buf[1]}"
+`
+	program, err := lexer.ParseWithIndentation(input)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	cCode := RenderC(program, "")
+	expected := []string{
+		"#define MAX (8)\n#define DOUBLE (MAX * 2)\n#define NAME \"scar\"\n",
+		"int buf[16] = {0};\n    int buf_len = 16;",
+		"char labels[8][256] = {{0}};\n    int labels_len = 8;",
+		"buf[1] = MAX;",
+		"printf(\"%s %d\\n\", NAME, buf[1]);",
+	}
+	for _, want := range expected {
+		if !strings.Contains(cCode, want) {
+			t.Errorf("Expected C code to contain '%s', but it didn't:\n%s", want, cCode)
+		}
+	}
+	if strings.Contains(cCode, "    #define") {
+		t.Error("constants should be emitted at file scope")
+	}
+}
+
+func TestCharLiterals(t *testing.T) {
+	input := `char c = 'a'
+map[char:int] counts = []
+put!(counts, '\n', 7)
+int n = get!(counts, '\'')
+int code = ord(c)
+print "{chr(code + 1)} {ord('z')}"
+if c == 'a':
+    print "a"
+`
+	program, err := lexer.ParseWithIndentation(input)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	cCode := RenderC(program, "")
+	expected := []string{
+		"char c = 'a';",
+		"__scar_map_put(&counts, &(char){'\\n'}, &(int){7});",
+		"__scar_map_get(&counts, &(char){'\\''})",
+		"printf(\"%c %d\\n\", ((char)(code + 1)), ((int)('z')));",
+		"if (c == 'a') {",
+	}
+	for _, want := range expected {
+		if !strings.Contains(cCode, want) {
+			t.Errorf("Expected C code to contain '%s', but it didn't:\n%s", want, cCode)
+		}
+	}
+}
+
+func TestEnumConversions(t *testing.T) {
+	input := `enum Color:
+    Red = 1
+    Green
+    Crimson = Red
+
+Color c = Color_Green
+int n = int(c)
+c = Color(n)
+string name = c.to_string()
+print "{Color.to_string(n)}"
+`
+	program, err := lexer.ParseWithIndentation(input)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	cCode := RenderC(program, "")
+	expected := []string{
+		"typedef enum {\n    Color_Red = 1,\n    Color_Green,\n    Color_Crimson = Color_Red\n} Color;",
+		"static inline char* Color_to_string(Color value) {\n    switch (value) {\n    case Color_Red:\n        return \"Red\";\n    case Color_Green:\n        return \"Green\";\n    }",
+		"    case Color_Green:\n        return (Color)value;\n    }\n    char message[128];\n    snprintf(message, sizeof(message), \"%d is not a valid Color\", value);\n    __scar_throw(1, message);\n    return (Color)value;",
+		"Color c = Color_Green;",
+		"c = Color_from_int(n);",
+		"char* name = Color_to_string(c);",
+		"printf(\"%s\\n\", Color_to_string(n));",
+	}
+	for _, want := range expected {
+		if !strings.Contains(cCode, want) {
+			t.Errorf("Expected C code to contain '%s', but it didn't:\n%s", want, cCode)
+		}
+	}
+	if strings.Contains(cCode, "case Color_Crimson") {
+		t.Error("a member repeating the value of another should not get a case of its own")
+	}
+}
+
+func TestRenderUnits(t *testing.T) {
+	dir := t.TempDir()
+	module := "pub int ucount = 3\n\npub fn utwice(int n) -> int:\n    return n * 2\n"
+	if err := os.WriteFile(filepath.Join(dir, "uparts.scar"), []byte(module), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { delete(lexer.LoadedModules, "uparts") })
+
+	program, err := lexer.ParseWithIndentation("import uparts\n\nint n = uparts_utwice(uparts.ucount)\nprint \"%d\" | n\n")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	units := NewRenderer(Options{}).RenderUnits(program, dir)
+	if len(units) != 2 || units[0].Module != "uparts" || units[1].Module != "" {
+		t.Fatalf("Expected a unit for uparts followed by the program, got %d units", len(units))
+	}
+
+	moduleUnit, programUnit := units[0], units[1]
+	for _, expected := range []string{"#ifndef SCAR_MODULE_UPARTS_H", "int uparts_utwice(int n);", "extern int uparts_ucount;"} {
+		if !strings.Contains(moduleUnit.Header, expected) {
+			t.Errorf("Expected '%s' in the header of uparts:\n%s", expected, moduleUnit.Header)
+		}
+	}
+	for _, expected := range []string{"extern int __global_argc;", "#include \"uparts.h\"", "int uparts_ucount = 3;", "int uparts_utwice(int n) {"} {
+		if !strings.Contains(moduleUnit.Source, expected) {
+			t.Errorf("Expected '%s' in the unit of uparts", expected)
+		}
+	}
+	if strings.Contains(moduleUnit.Source, "int main(") {
+		t.Errorf("Expected main to be left out of the unit of uparts")
+	}
+	for _, expected := range []string{"int __global_argc = 0;", "#include \"uparts.h\"", "int main(", "uparts_utwice(uparts_ucount)"} {
+		if !strings.Contains(programUnit.Source, expected) {
+			t.Errorf("Expected '%s' in the unit of the program", expected)
+		}
+	}
+	for _, unexpected := range []string{"int uparts_utwice(int n) {", "int uparts_ucount = 3;"} {
+		if strings.Contains(programUnit.Source, unexpected) {
+			t.Errorf("Expected '%s' to be left out of the unit of the program", unexpected)
+		}
+	}
+}
+
+func TestCommandLineArguments(t *testing.T) {
+	input := `list[string] params = args()
+int count = argc()
+print "{params[0]} {count}"
+`
+	program, err := lexer.ParseWithIndentation(input)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	cCode := RenderC(program, "")
+	expected := []string{
+		"int main(int argc, char** argv) {",
+		"params_len = __scar_args(params, params_cap);",
+		"int count = argc();",
+	}
+	for _, want := range expected {
+		if !strings.Contains(cCode, want) {
+			t.Errorf("Expected C code to contain '%s', but it didn't:\n%s", want, cCode)
+		}
+	}
+}
+
+func TestLineDirectives(t *testing.T) {
+	input := `fn twice(int x) -> int:
+    return x * 2
+
+print "hello"
+if twice(2) > 3:
+    print "big"
+`
+	program, err := lexer.ParseWithIndentation(input)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	cCode := NewRenderer(Options{SourceFile: "/src/main.scar"}).RenderC(program, "")
+	expected := []string{
+		"#line 2 \"/src/main.scar\"\n    return x * 2;",
+		"#line 4 \"/src/main.scar\"\n    fputs(\"hello\\n\", stdout);",
+		"#line 6 \"/src/main.scar\"\n        fputs(\"big\\n\", stdout);",
+	}
+	for _, want := range expected {
+		if !strings.Contains(cCode, want) {
+			t.Errorf("Expected C code to contain '%s', but it didn't:\n%s", want, cCode)
+		}
+	}
+}
+
+func TestRenderErrors(t *testing.T) {
+	input := `int a = this.get()
+print "after"
+int b = this.size()
+`
+	program, err := lexer.ParseWithIndentation(input)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	r := NewRenderer(Options{})
+	cCode := r.RenderC(program, "")
+	errs := r.Errors()
+	if len(errs) != 2 || errs[0].Error() != "line 1: 'this' used outside of class context" || errs[1].Error() != "line 3: 'this' used outside of class context" {
+		t.Errorf("expected an error for each use of 'this', got %v", errs)
+	}
+	if !strings.Contains(cCode, `fputs("after\n", stdout);`) {
+		t.Errorf("expected rendering to go on after an error:\n%s", cCode)
+	}
+}
+
+func TestRenderersDoNotShareState(t *testing.T) {
+	first, err := lexer.ParseWithIndentation(`class Counter:
+    init(int n):
+        this.n = n
+    fn total() -> int:
+        return this.n
+
+Counter c = new Counter(1)
+`)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	second, err := lexer.ParseWithIndentation("int t = c.total()\n")
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	RenderC(first, "")
+	if code := RenderC(second, ""); strings.Contains(code, "Counter_total") {
+		t.Errorf("Expected the second program not to see the classes of the first:\n%s", code)
+	}
+}
+
+func TestRenderTestBlocks(t *testing.T) {
+	input := `test "compares":
+    string s = "abc"
+    assert_eq!(s, "abc")
+assert!(1 < 2)
+`
+	program, err := lexer.ParseWithIndentation(input)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	cCode := RenderC(program, "")
+	if strings.Contains(cCode, "__scar_test_start") || !strings.Contains(cCode, "return 0;") {
+		t.Errorf("expected test blocks to be left out outside of test mode:\n%s", cCode)
+	}
+	if !strings.Contains(cCode, `if (!(1 < 2)) __scar_assert_fail(__FILE__, __LINE__, "assert!(1 < 2)", "");`) {
+		t.Errorf("expected assert! outside of tests to be rendered:\n%s", cCode)
+	}
+
+	cCode = NewRenderer(Options{TestMode: true}).RenderC(program, "")
+	for _, expected := range []string{
+		`__scar_test_start("compares");`,
+		`if (setjmp(__scar_test_env) == 0) {`,
+		`__scar_assert_eq(s, "abc", "assert_eq!(s, \"abc\")");`,
+		`__scar_test_pass();`,
+		`return __scar_test_summary();`,
+	} {
+		if !strings.Contains(cCode, expected) {
+			t.Errorf("expected %q in test mode:\n%s", expected, cCode)
+		}
+	}
+}
+
+func TestRenderAsserts(t *testing.T) {
+	program, err := lexer.ParseWithIndentation(`int n = 3
+assert n > 0
+assert n == 3, "n should be three"
+`)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	code := RenderC(program, "")
+	for _, expected := range []string{
+		`__scar_assert_debug(n > 0, "assert n > 0", NULL);`,
+		`__scar_assert_debug(n == 3, "assert n == 3", "n should be three");`,
+	} {
+		if !strings.Contains(code, expected) {
+			t.Errorf("Expected C code to contain '%s', but it didn't:\n%s", expected, code)
+		}
+	}
+}
+
+func TestRenderBenchBlocks(t *testing.T) {
+	input := `bench "adds":
+    int x = 1 + 2
+`
+	program, err := lexer.ParseWithIndentation(input)
+	if err != nil {
+		t.Fatalf("ParseWithIndentation failed: %v", err)
+	}
+	if cCode := RenderC(program, ""); strings.Contains(cCode, "__scar_bench_") {
+		t.Errorf("expected bench blocks to be left out outside of bench mode:\n%s", cCode)
+	}
+
+	cCode := NewRenderer(Options{BenchMode: true, BenchIterations: 500}).RenderC(program, "")
+	for _, expected := range []string{
+		`for (long long __scar_bench_n = 500; ; __scar_bench_n *= 2) {`,
+		`int x = 1 + 2;`,
+		`if (__scar_bench_report("adds", __scar_bench_n, __scar_bench_now() - __scar_bench_start, true)) break;`,
+	} {
+		if !strings.Contains(cCode, expected) {
+			t.Errorf("expected %q in bench mode:\n%s", expected, cCode)
+		}
+	}
 }
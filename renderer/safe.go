@@ -0,0 +1,104 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains the runtime checks of integer arithmetic made with --safe.
+//
+// Addition, subtraction and multiplication of integers go through helpers of
+// the type of the operation built on __builtin_add_overflow and its kin, such
+// as __scar_checked_add_int, and division and modulo through helpers checking
+// the divisor. A cast of an integer to a type that may not hold it, such as
+// big as i32 of an i64 big, goes through __scar_checked_cast_int. An overflow,
+// a lossy cast or a division by zero throws a scar exception instead of
+// wrapping or being undefined behavior in C, so it can be caught like any
+// other error.
+
+package renderer
+
+import (
+	"fmt"
+	"strings"
+
+	"scar/lexer"
+)
+
+// The width in bits of the integer types arithmetic is checked for.
+var checkedIntegerBits = map[string]int{
+	"i8": 8, "u8": 8, "i16": 16, "u16": 16,
+	"int": 32, "i32": 32, "u32": 32,
+	"long": 64, "i64": 64, "u64": 64,
+}
+
+// The names of the checked helpers of the arithmetic operators.
+var checkedOperations = map[string]string{
+	"+": "add", "-": "sub", "*": "mul", "/": "div", "%": "mod",
+}
+
+// Renders an arithmetic operation on integers through the checked helper of
+// its type with --safe.
+func (r *Renderer) renderCheckedArithmetic(e *lexer.BinaryExpr) (string, bool) {
+	operation, ok := checkedOperations[e.Op]
+	if !r.opts.SafeMode || !ok {
+		return "", false
+	}
+	typ, ok := r.checkedType(e.Left, e.Right)
+	if !ok {
+		return "", false
+	}
+	typeName, ok := runtimeTypeName(typ)
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprintf("__scar_checked_%s_%s(%s, %s)", operation, typeName, r.renderExpr(e.Left), r.renderExpr(e.Right)), true
+}
+
+// Returns the integer type arithmetic on two operands is checked in, which
+// is the wider of their types. A literal takes the type of the other operand,
+// so b + 1 of an i8 b overflows as an i8.
+func (r *Renderer) checkedType(left, right lexer.Expr) (string, bool) {
+	leftType, rightType := r.exprType(left), r.exprType(right)
+	leftBits, leftOk := checkedIntegerBits[leftType]
+	rightBits, rightOk := checkedIntegerBits[rightType]
+	switch {
+	case !leftOk || !rightOk:
+		return "", false
+	case isIntLiteral(left):
+		return rightType, true
+	case isIntLiteral(right) || leftBits >= rightBits:
+		return leftType, true
+	}
+	return rightType, true
+}
+
+// Renders a cast of an integer to an integer type that may not hold its value
+// through the checked helper of that type with --safe.
+func (r *Renderer) renderCheckedCast(e *lexer.CastExpr, value string) (string, bool) {
+	if !r.opts.SafeMode || isIntLiteral(e.Value) {
+		return "", false
+	}
+	from := r.exprType(e.Value)
+	fromBits, fromOk := checkedIntegerBits[from]
+	toBits, toOk := checkedIntegerBits[e.Type]
+	if !fromOk || !toOk {
+		return "", false
+	}
+	fromSigned, toSigned := !strings.HasPrefix(from, "u"), !strings.HasPrefix(e.Type, "u")
+	if (fromSigned == toSigned && toBits >= fromBits) || (!fromSigned && toSigned && toBits > fromBits) {
+		// Every value of the source type fits the target.
+		return "", false
+	}
+	typeName, ok := runtimeTypeName(e.Type)
+	if !ok {
+		return "", false
+	}
+	helper := "cast"
+	if !fromSigned {
+		helper = "ucast"
+	}
+	return fmt.Sprintf("__scar_checked_%s_%s(%s)", helper, typeName, value), true
+}
+
+func isIntLiteral(expr lexer.Expr) bool {
+	lit, ok := expr.(*lexer.LiteralExpr)
+	return ok && lit.Kind == lexer.IntLiteral
+}
@@ -0,0 +1,106 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains code generation for sets.
+//
+// A set is lowered to a __scar_map from the map runtime whose values are empty,
+// so the elements of the set are the keys of the table.
+
+package renderer
+
+import (
+	"fmt"
+	"strings"
+
+	"scar/lexer"
+)
+
+// Returns the scar type of a set, as stored on set fields of classes.
+func setTypeName(elemType string) string {
+	return fmt.Sprintf("set[%s]", elemType)
+}
+
+// Returns the element type of a set type such as set[int].
+func parseSetType(typ string) (string, bool) {
+	if !strings.HasPrefix(typ, "set[") || !strings.HasSuffix(typ, "]") {
+		return "", false
+	}
+	return strings.TrimSpace(typ[4 : len(typ)-1]), true
+}
+
+// Returns the element type of a set visible in the current scope, which is
+// either a variable or a field of this.
+func (r *Renderer) lookupSet(name string) (string, bool) {
+	if fieldName, ok := strings.CutPrefix(name, "this."); ok {
+		if field, exists := r.findField(r.currentClassName, fieldName); exists {
+			return parseSetType(field.Type)
+		}
+		return "", false
+	}
+	elemType, exists := r.globalSets[name]
+	return elemType, exists
+}
+
+// Returns a C expression creating an empty set.
+func (r *Renderer) newSet(elemType string) string {
+	return fmt.Sprintf("__scar_map_new(sizeof(%s), 0, %d, 0)", r.mapElemCType(elemType), boolToInt(elemType == "string"))
+}
+
+// Emits the declaration of a set variable and its initial elements.
+func (r *Renderer) declareSet(b *strings.Builder, indent string, decl *lexer.SetDeclStmt) {
+	r.globalSets[decl.Name] = decl.ElemType
+	name := lexer.ResolveSymbol(decl.Name, r.currentModule)
+	fmt.Fprintf(b, "%s__scar_map %s = %s;\n", indent, name, r.newSet(decl.ElemType))
+	r.addSetElements(b, indent, "&"+name, decl.ElemType, decl.Elements)
+}
+
+// Emits the initialisation of a set field of this in a constructor.
+func (r *Renderer) initSetField(b *strings.Builder, indent string, decl *lexer.SetDeclStmt) {
+	fieldName := strings.TrimPrefix(decl.Name, "this.")
+	fmt.Fprintf(b, "%sthis->%s = %s;\n", indent, fieldName, r.newSet(decl.ElemType))
+	r.addSetElements(b, indent, "&this->"+fieldName, decl.ElemType, decl.Elements)
+}
+
+func (r *Renderer) addSetElements(b *strings.Builder, indent, ref, elemType string, elements []string) {
+	for _, elem := range elements {
+		if elemType == "string" && !strings.HasPrefix(elem, "\"") {
+			elem = fmt.Sprintf("\"%s\"", elem)
+		}
+		fmt.Fprintf(b, "%s__scar_map_entry(%s, %s);\n", indent, ref, r.mapArg(elemType, elem))
+	}
+}
+
+// Returns the element type of a set, guessing it from a value when the set
+// is unknown.
+func (r *Renderer) setTypeOf(name, value string) string {
+	if elemType, ok := r.lookupSet(name); ok {
+		return elemType
+	}
+	return r.mapTypesOf(name, value, "").keyType
+}
+
+// Emits the add!(set, value) builtin.
+func (r *Renderer) renderSetAdd(b *strings.Builder, indent string, add *lexer.SetElemStmt) {
+	elemType := r.setTypeOf(add.SetName, add.Value)
+	fmt.Fprintf(b, "%s__scar_map_entry(%s, %s);\n", indent, r.mapRef(add.SetName), r.mapArg(elemType, add.Value))
+}
+
+// Emits the remove!(set, value) builtin.
+func (r *Renderer) renderSetRemove(b *strings.Builder, indent string, remove *lexer.SetElemStmt) {
+	elemType := r.setTypeOf(remove.SetName, remove.Value)
+	fmt.Fprintf(b, "%s%s;\n", indent, r.mapDel(remove.SetName, r.mapArg(elemType, remove.Value)))
+}
+
+// Renders the set builtin contains!(set, value) inside expressions.
+func (r *Renderer) renderSetBuiltin(name string, args []lexer.Expr) (string, bool) {
+	if name != "contains!" || len(args) != 2 {
+		return "", false
+	}
+	setName, ok := exprVarName(args[0])
+	if !ok {
+		return "", false
+	}
+	value := r.renderExpr(args[1])
+	return r.mapHas(setName, r.mapArgC(r.setTypeOf(setName, value), value)), true
+}
@@ -0,0 +1,48 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains code generation for sleep, sleep_ms and sleep_us.
+//
+// Whole seconds are slept with sleep(). Other durations, such as sleep 0.5 or
+// sleep_ms 20, are converted to microseconds for __scar_sleep_us, which sleeps
+// with nanosleep, or with Sleep on Windows.
+
+package renderer
+
+import (
+	"fmt"
+	"strings"
+
+	"scar/lexer"
+)
+
+// The microseconds in one unit of each sleep statement.
+var sleepUnits = map[string]string{
+	"s":  "1000000.0",
+	"ms": "1000.0",
+	"us": "1.0",
+}
+
+// Emits a sleep statement.
+func (r *Renderer) renderSleep(b *strings.Builder, indent string, stmt *lexer.SleepStmt) {
+	duration := r.convertThisReferencesGranular(stmt.Duration)
+	if stmt.Unit == "s" && r.wholeSeconds(stmt.Duration) {
+		fmt.Fprintf(b, "%ssleep(%s);\n", indent, duration)
+		return
+	}
+	fmt.Fprintf(b, "%s__scar_sleep_us((%s) * %s);\n", indent, duration, sleepUnits[stmt.Unit])
+}
+
+// Reports whether a duration is known to be an integer.
+func (r *Renderer) wholeSeconds(duration string) bool {
+	expr, err := lexer.ParseExpr(duration)
+	if err != nil {
+		return false
+	}
+	switch r.exprType(expr) {
+	case "int", "i8", "i16", "i32", "i64", "u8", "u16", "u32", "u64":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,147 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains code generation for slices such as items[2:5] and name[:3].
+//
+// Slicing a string yields a new heap string, while slicing a list copies the
+// elements into a new list with its own length. Bounds follow Python: omitted
+// bounds mean the start or end, negative bounds count from the end and bounds
+// out of range are clamped.
+
+package renderer
+
+import (
+	"fmt"
+	"strings"
+
+	"scar/lexer"
+)
+
+// Returns the slice a scar value consists of, if it is one.
+func parseSlice(value string) (*lexer.SliceExpr, bool) {
+	expr, err := lexer.ParseExpr(value)
+	if err != nil {
+		return nil, false
+	}
+	slice, ok := expr.(*lexer.SliceExpr)
+	return slice, ok
+}
+
+// Renders the bounds of a slice, using the given C expressions for omitted ones.
+func (r *Renderer) sliceBounds(slice *lexer.SliceExpr, low, high string) (string, string) {
+	if slice.Low != nil {
+		low = r.renderExpr(slice.Low)
+	}
+	if slice.High != nil {
+		high = r.renderExpr(slice.High)
+	}
+	return low, high
+}
+
+// Renders a slice of a string as a C expression evaluating to a new heap string.
+func (r *Renderer) renderStringSlice(slice *lexer.SliceExpr) string {
+	low, high := r.sliceBounds(slice, "0", "INT_MAX")
+	return fmt.Sprintf("__scar_str_slice(%s, %s, %s)", r.renderExpr(slice.Object), low, high)
+}
+
+// Reports whether a rendered C expression evaluates to a new heap string that
+// the receiving variable can take ownership of.
+func (r *Renderer) isFreshString(value string) bool {
+	expr, err := lexer.ParseExpr(value)
+	if err != nil {
+		// C the parser does not read, such as a cast in the arguments, is
+		// still a call of a fresh string function when a call spans it.
+		name, _, ok := strings.Cut(value, "(")
+		return ok && isValidIdentifier(name) && findMatchingParen(value, len(name)) == len(value)-1 && r.returnsFreshString(name)
+	}
+	call, ok := expr.(*lexer.CallExpr)
+	if !ok {
+		return false
+	}
+	callee, ok := call.Callee.(*lexer.IdentExpr)
+	return ok && r.returnsFreshString(callee.Name)
+}
+
+// Reports whether a function returns a new heap string.
+func (r *Renderer) returnsFreshString(name string) bool {
+	typ, isConversion := r.conversionType(name)
+	return freshStringFunctions[name] || r.functionReturnsString(name) || isConversion && typ == "string"
+}
+
+// The runtime functions returning new heap strings.
+var freshStringFunctions = map[string]bool{
+	"__scar_str_new": true, "__scar_str_bool": true, "__scar_str_slice": true, "__scar_str_format": true, "__scar_str_concat": true, "__scar_input": true,
+}
+
+// Returns the list a slice is taken from, if it names one.
+func (r *Renderer) slicedList(slice *lexer.SliceExpr) (string, bool) {
+	ident, ok := slice.Object.(*lexer.IdentExpr)
+	if !ok {
+		return "", false
+	}
+	if _, isList := r.listLength(ident.Name); !isList {
+		return "", false
+	}
+	return ident.Name, true
+}
+
+// Emits code appending the elements of a slice of a list to target.
+func (r *Renderer) extendListSlice(b *strings.Builder, indent, elemType, target string, slice *lexer.SliceExpr) bool {
+	source, ok := r.slicedList(slice)
+	if !ok {
+		return false
+	}
+	resolved := lexer.ResolveSymbol(source, r.currentModule)
+	low, high := r.sliceBounds(slice, "0", resolved+"_len")
+	fmt.Fprintf(b, "%s{\n", indent)
+	fmt.Fprintf(b, "%s    int __lo = __scar_list_bound(%s, %s_len);\n", indent, low, resolved)
+	fmt.Fprintf(b, "%s    int __hi = __scar_list_bound(%s, %s_len);\n", indent, high, resolved)
+	copyListRange(b, indent+"    ", elemType, target, resolved, "__lo", "__hi")
+	fmt.Fprintf(b, "%s}\n", indent)
+	return true
+}
+
+// Emits an assignment of a slice of a list to a list variable. The slice is
+// built in a new list first, so a list can be assigned a slice of itself.
+func (r *Renderer) assignListSlice(b *strings.Builder, indent, elemType, target string, slice *lexer.SliceExpr) bool {
+	if _, ok := r.slicedList(slice); !ok {
+		return false
+	}
+	fmt.Fprintf(b, "%s{\n", indent)
+	r.declareList(b, indent+"    ", elemType, "__slice")
+	r.extendListSlice(b, indent+"    ", elemType, "__slice", slice)
+	fmt.Fprintf(b, "%s    %s = __slice;\n", indent, target)
+	if _, nested := nestedListType(elemType); nested {
+		fmt.Fprintf(b, "%s    %s_lens = __slice_lens;\n", indent, target)
+	}
+	fmt.Fprintf(b, "%s    %s_len = __slice_len;\n", indent, target)
+	fmt.Fprintf(b, "%s    %s_cap = __slice_cap;\n", indent, target)
+	fmt.Fprintf(b, "%s}\n", indent)
+	return true
+}
+
+// Returns the slice a list declaration is initialised from, if any.
+func (r *Renderer) listDeclSlice(decl *lexer.ListDeclStmt) (*lexer.SliceExpr, bool) {
+	if len(decl.Elements) != 1 {
+		return nil, false
+	}
+	slice, ok := parseSlice(decl.Elements[0])
+	if !ok {
+		return nil, false
+	}
+	if _, ok := r.slicedList(slice); !ok {
+		return nil, false
+	}
+	return slice, true
+}
+
+// Emits an assignment of a scar value to a list if the value is a slice of a
+// list, reporting whether it was one.
+func (r *Renderer) assignSlice(b *strings.Builder, indent, elemType, target, value string) bool {
+	slice, ok := parseSlice(value)
+	if !ok {
+		return false
+	}
+	return r.assignListSlice(b, indent, elemType, target, slice)
+}
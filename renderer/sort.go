@@ -0,0 +1,99 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains the rendering of sort!, which sorts a list in place with qsort.
+//
+// sort!(list) sorts numbers, chars and strings in ascending order with the
+// comparators of the sort runtime. sort!(list, f) sorts by a function of the
+// program taking two elements, which either returns a negative, zero or
+// positive int like strcmp, or returns a bool telling whether its first
+// argument goes before its second. Such a function gets a shim,
+// __scar_sort_f, adapting it to the comparators qsort takes.
+
+package renderer
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"scar/lexer"
+)
+
+// Emits the sorting of a list by sort!(list) or sort!(list, f).
+func (r *Renderer) renderSort(b *strings.Builder, indent string, args []string, line int) {
+	if len(args) != 1 && len(args) != 2 {
+		r.renderErrorf(line, "sort! takes a list and optionally a comparator, got %d arguments", len(args))
+		return
+	}
+	name := strings.TrimSpace(args[0])
+	var (
+		list, elemType string
+		ok             bool
+	)
+	if expr, err := lexer.ParseExpr(name); err == nil {
+		list, elemType, ok = r.listOperand(expr)
+	}
+	if !ok {
+		r.renderErrorf(line, "sort! expects a list, but '%s' is not one", name)
+		return
+	}
+
+	var comparator string
+	if len(args) == 2 {
+		fn := strings.ReplaceAll(strings.TrimSpace(args[1]), "::", "_")
+		funcDecl, exists := r.globalFunctions[fn]
+		if !exists || len(funcDecl.Parameters) != 2 {
+			r.renderErrorf(line, "sort! expects a function taking two elements of '%s', but '%s' is not one", name, args[1])
+			return
+		}
+		r.sortComparators[fn] = true
+		comparator = "__scar_sort_" + fn
+	} else if typeName, ok := runtimeTypeName(elemType); ok {
+		comparator = "__scar_cmp_" + typeName
+	} else {
+		r.renderErrorf(line, "sort! cannot order the %s elements of '%s' by itself, pass it a comparator", elemType, name)
+		return
+	}
+	fmt.Fprintf(b, "%sqsort(%s, %s_len, sizeof(*%s), %s);\n", indent, list, list, list, comparator)
+}
+
+// Emits the shims of the functions sort! was given, declaring each along with
+// the function it calls and defining it in the same section.
+func (r *Renderer) writeSortComparators(p *renderedProgram, functionModules map[string]string) {
+	for _, name := range slices.Sorted(maps.Keys(r.sortComparators)) {
+		var (
+			funcDecl  = r.globalFunctions[name]
+			module    = functionModules[name]
+			prototype = fmt.Sprintf("int __scar_sort_%s(const void* a, const void* b)", name)
+			left      = r.sortedElement(funcDecl.Parameters[0].Type, "a")
+			right     = r.sortedElement(funcDecl.Parameters[1].Type, "b")
+		)
+		if module == "" {
+			fmt.Fprintf(&p.prototypes, "%s;\n", prototype)
+		} else {
+			fmt.Fprintf(p.section(p.headers, module), "%s;\n", prototype)
+		}
+
+		b := p.section(p.definitions, module)
+		fmt.Fprintf(b, "\n%s {\n", prototype)
+		if funcDecl.ReturnType == "bool" {
+			fmt.Fprintf(b, "    return %s(%s, %s) ? -1 : %s(%s, %s) ? 1 : 0;\n", name, left, right, name, right, left)
+		} else {
+			fmt.Fprintf(b, "    return %s(%s, %s);\n", name, left, right)
+		}
+		b.WriteString("}\n")
+	}
+}
+
+// Returns the element of a list a comparator shim is passed a pointer to, as
+// the scar type the comparator takes. The strings of a list are arrays of
+// chars, so a pointer to one is the string.
+func (r *Renderer) sortedElement(scarType, pointer string) string {
+	if scarType == "string" {
+		return "(char*)" + pointer
+	}
+	return fmt.Sprintf("*(%s*)%s", r.mapTypeToCType(scarType), pointer)
+}
@@ -0,0 +1,237 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains code generation for heap allocated strings.
+//
+// String variables are lowered to malloc'd char pointers managed by the string
+// runtime the preprocessor inserts, so assignment and concatenation grow the
+// buffer instead of truncating at a fixed size.
+
+package renderer
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"scar/lexer"
+)
+
+// Size of the buffer raw C code in a function returning a string may fill.
+const outputBufferSize = 4096
+
+// Reports whether a variable is a heap allocated string.
+func (r *Renderer) isHeapString(name string) bool {
+	return r.heapStrings[name]
+}
+
+// Functions returning a string return a new heap string the caller owns, so
+// their calls compose like any other value. The result is freed by a call
+// made as a statement, and taken over by the string a call initialises.
+//
+// Raw C code in such a function may instead fill _output_buffer, a heap
+// buffer of outputBufferSize bytes returned when the code returns without a
+// value, while any other string it returns is copied.
+
+// Reports whether the statements being rendered belong to a function of the
+// program returning a string.
+func (r *Renderer) inStringFunction() bool {
+	return r.currentFunction != nil && r.currentFunction.ReturnType == "string"
+}
+
+// Declares _output_buffer for a function returning a string whose raw C code
+// fills it.
+func declareOutputBuffer(b *strings.Builder, body []*lexer.Statement) {
+	if usesOutputBuffer(body) {
+		fmt.Fprintf(b, "    char* _output_buffer = __scar_str_alloc(%d);\n", outputBufferSize)
+	}
+}
+
+func usesOutputBuffer(body []*lexer.Statement) bool {
+	for _, stmt := range body {
+		if stmt.RawCode != nil && strings.Contains(stmt.RawCode.Code, "_output_buffer") {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns what a function returning a string returns when its body ends
+// without a return.
+func stringFunctionResult(body []*lexer.Statement) string {
+	if usesOutputBuffer(body) {
+		return "_output_buffer"
+	}
+	return `__scar_str_new("")`
+}
+
+var (
+	reRawReturn      = regexp.MustCompile(`\breturn\s*;`)
+	reRawReturnValue = regexp.MustCompile(`\breturn\s+([^;]+);`)
+)
+
+// Rewrites the returns of raw C code in a function returning a string to
+// return heap strings.
+func rawStringReturns(code string) string {
+	code = reRawReturn.ReplaceAllString(code, "return _output_buffer;")
+	return reRawReturnValue.ReplaceAllStringFunc(code, func(match string) string {
+		value := strings.TrimSpace(reRawReturnValue.FindStringSubmatch(match)[1])
+		if value == "_output_buffer" {
+			return match
+		}
+		return fmt.Sprintf("return __scar_str_new(%s);", value)
+	})
+}
+
+// Returns a rendered string value as a string the caller owns, copying it
+// unless it is already new.
+func (r *Renderer) ownedString(value string) string {
+	if r.isFreshString(value) {
+		return value
+	}
+	return fmt.Sprintf("__scar_str_new(%s)", value)
+}
+
+// Emits the declaration of a heap string initialised from a scar value.
+func (r *Renderer) declareString(b *strings.Builder, indent, name, value string, quoted bool) {
+	r.heapStrings[name] = true
+	if quoted {
+		if formatted, ok := r.interpolatedString(value); ok {
+			fmt.Fprintf(b, "%schar* %s = %s;\n", indent, name, formatted)
+			return
+		}
+	}
+	if !quoted && r.isFreshString(value) {
+		fmt.Fprintf(b, "%schar* %s = %s;\n", indent, name, value)
+		return
+	}
+	if funcName, args, ok := r.stringFunctionCall(value); ok {
+		fmt.Fprintf(b, "%schar* %s = %s(%s);\n", indent, name, funcName, strings.Join(args, ", "))
+		return
+	}
+	fmt.Fprintf(b, "%schar* %s = __scar_str_new(%s);\n", indent, name, r.stringValue(value, quoted))
+}
+
+// Emits an assignment to a heap string.
+func (r *Renderer) assignString(b *strings.Builder, indent, name, value string, quoted bool) {
+	if quoted {
+		if formatted, ok := r.interpolatedString(value); ok {
+			fmt.Fprintf(b, "%s__scar_str_take(&%s, %s);\n", indent, name, formatted)
+			return
+		}
+	}
+	if !quoted && r.isFreshString(value) {
+		fmt.Fprintf(b, "%s__scar_str_take(&%s, %s);\n", indent, name, value)
+		return
+	}
+	fmt.Fprintf(b, "%s__scar_str_set(&%s, %s);\n", indent, name, r.stringValue(value, quoted))
+}
+
+// Emits code appending a value to a heap string, growing it as needed.
+func catString(b *strings.Builder, indent, name, value string) {
+	fmt.Fprintf(b, "%s__scar_str_cat(&%s, %s);\n", indent, name, value)
+}
+
+// Returns the resolved name and arguments of a call to a string-returning function.
+func (r *Renderer) stringFunctionCall(value string) (string, []string, bool) {
+	if !isFunctionCall(value) {
+		return "", nil, false
+	}
+	funcName, args := parseFunctionCall(value)
+	resolvedFuncName := lexer.ResolveSymbol(funcName, r.currentModule)
+	if !r.functionReturnsString(resolvedFuncName) {
+		return "", nil, false
+	}
+	resolvedArgs := make([]string, len(args))
+	for i, arg := range args {
+		resolvedArgs[i] = lexer.ResolveSymbol(arg, r.currentModule)
+	}
+	return resolvedFuncName, resolvedArgs, true
+}
+
+// Renders a scar string value as a C expression.
+//
+// Unquoted bare words are string literals unless they name another string.
+func (r *Renderer) stringValue(value string, quoted bool) string {
+	switch {
+	case value == "":
+		return `""`
+	case quoted:
+		return fmt.Sprintf("\"%s\"", value)
+	case strings.HasPrefix(value, "\"") && strings.HasSuffix(value, "\""):
+		return value
+	case isFunctionCall(value):
+		return r.resolveFunctionCall(value)
+	case r.isHeapString(value) || strings.Contains(value, "->") || r.isListElement(value):
+		return value
+	}
+	return fmt.Sprintf("\"%s\"", value)
+}
+
+// Reports whether an expression evaluates to a C string, such as a string
+// variable or a string field of an object.
+func (r *Renderer) isStringExpr(expr lexer.Expr) bool {
+	return r.mapTypeToCType(r.exprType(expr)) == "char*"
+}
+
+// Reports whether a value is an element of a list, such as names[i].
+func (r *Renderer) isListElement(value string) bool {
+	expr, err := lexer.ParseExpr(value)
+	if err != nil {
+		return false
+	}
+	index, ok := expr.(*lexer.IndexExpr)
+	if !ok {
+		return false
+	}
+	_, ok = r.indexedLength(index.Object)
+	return ok
+}
+
+// Returns a C string literal holding s.
+func cStringLiteral(s string) string {
+	return `"` + cEscape(s) + `"`
+}
+
+// Returns s escaped for the body of a C string literal. Control characters
+// are written as octal escapes, which unlike \x escapes cannot run into the
+// characters following them.
+func cEscape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch ch := s[i]; {
+		case ch == '\\' || ch == '"':
+			b.WriteByte('\\')
+			b.WriteByte(ch)
+		case ch == '\n':
+			b.WriteString(`\n`)
+		case ch == '\t':
+			b.WriteString(`\t`)
+		case ch == '\r':
+			b.WriteString(`\r`)
+		case ch < ' ' || ch == 0x7f:
+			fmt.Fprintf(&b, `\%03o`, ch)
+		default:
+			b.WriteByte(ch)
+		}
+	}
+	return b.String()
+}
+
+// Returns the body of a scar string literal as the body of a C string
+// literal. The parser rejects invalid escape sequences, so a body that does
+// not decode is emitted as it is.
+func cStringBody(body string) string {
+	text, err := lexer.Unescape(body)
+	if err != nil {
+		return body
+	}
+	return cEscape(text)
+}
+
+// Returns the body of a scar string literal as the body of a printf format
+// printing it as it is.
+func printfText(body string) string {
+	return strings.ReplaceAll(cStringBody(body), "%", "%%")
+}
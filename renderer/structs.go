@@ -0,0 +1,111 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains code generation for structs.
+//
+// A struct is a C struct used by value, so it is copied on assignment and when
+// passed to or returned from functions. Struct values are written as calls
+// such as Point(1, 2), which become compound literals, and their fields are
+// accessed with . where class fields go through ->.
+
+package renderer
+
+import (
+	"fmt"
+	"strings"
+
+	"scar/lexer"
+)
+
+// Records a struct declaration.
+func (r *Renderer) collectStruct(decl *lexer.StructDeclStmt) {
+	if _, exists := r.globalStructs[decl.Name]; !exists {
+		r.structOrder = append(r.structOrder, decl.Name)
+	}
+	r.globalStructs[decl.Name] = decl
+}
+
+// Reports whether a type names a struct.
+func (r *Renderer) isStructType(typ string) bool {
+	_, exists := r.globalStructs[typ]
+	return exists
+}
+
+// Returns the type of a field of a struct.
+func (r *Renderer) structField(structName, fieldName string) (string, bool) {
+	if decl, exists := r.globalStructs[structName]; exists {
+		for _, field := range decl.Fields {
+			if field.Name == fieldName {
+				return field.Type, true
+			}
+		}
+	}
+	return "", false
+}
+
+// Emits the typedefs of the declared structs. Structs are emitted so that
+// the structs a struct embeds come before it.
+func (r *Renderer) generateStructTypedefs(b *strings.Builder) {
+	emitted := make(map[string]bool)
+	var emit func(name string)
+	emit = func(name string) {
+		if emitted[name] {
+			return
+		}
+		emitted[name] = true
+		decl := r.globalStructs[name]
+		for _, field := range decl.Fields {
+			if r.isStructType(listElem(field.Type)) {
+				emit(listElem(field.Type))
+			}
+		}
+		b.WriteString("typedef struct {\n")
+		for _, field := range decl.Fields {
+			fmt.Fprintf(b, "    %s %s;\n", r.structFieldCType(field.Type), field.Name)
+		}
+		fmt.Fprintf(b, "} %s;\n\n", name)
+	}
+	for _, name := range r.structOrder {
+		emit(name)
+	}
+}
+
+func listElem(typ string) string {
+	if elemType, ok := strings.CutPrefix(typ, "list["); ok {
+		return strings.TrimSuffix(elemType, "]")
+	}
+	return typ
+}
+
+// Returns the C type of a struct field. Class instances are held by pointer
+// as everywhere else.
+func (r *Renderer) structFieldCType(typ string) string {
+	if _, exists := r.globalClasses[typ]; exists {
+		return typ + "*"
+	}
+	return r.mapTypeToCType(typ)
+}
+
+// Renders a struct value such as Point(1, 2) as a compound literal, reporting
+// false when the callee is not a struct.
+func (r *Renderer) renderStructLiteral(name string, args []lexer.Expr) (string, bool) {
+	if !r.isStructType(name) {
+		return "", false
+	}
+	return fmt.Sprintf("(%s){%s}", name, r.renderExprList(args)), true
+}
+
+// Renders a field access such as p.x on a struct value, reporting false when
+// the target is not a field of a struct.
+func (r *Renderer) structMember(target string) (string, bool) {
+	expr, err := lexer.ParseExpr(target)
+	if err != nil {
+		return "", false
+	}
+	member, ok := expr.(*lexer.MemberExpr)
+	if !ok || !r.isStructType(r.exprType(member.Object)) {
+		return "", false
+	}
+	return r.renderExpr(member), true
+}
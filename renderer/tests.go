@@ -0,0 +1,84 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains code generation for test and bench blocks and assertions.
+//
+// Test blocks are only compiled in test mode, which scar test builds programs
+// in. Each test runs behind a setjmp point that a failing assertion unwinds
+// to after recording the failure, so the tests after it still run, and main
+// returns non-zero when any test failed. Outside of a test a failing
+// assertion stops the program.
+//
+// Bench blocks are only compiled in bench mode, which scar bench builds
+// programs in. A bench block runs its body a number of times, timed with
+// clock_gettime, and prints the time one iteration took.
+
+package renderer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"scar/lexer"
+)
+
+func (r *Renderer) renderTest(b *strings.Builder, test *lexer.TestStmt, indent, className string, program *lexer.Program, currentFunctionReturnType string) {
+	if !r.opts.TestMode {
+		return
+	}
+	fmt.Fprintf(b, "%s__scar_test_start(%s);\n", indent, cStringLiteral(test.Name))
+	fmt.Fprintf(b, "%sif (setjmp(__scar_test_env) == 0) {\n", indent)
+	r.renderStatements(b, test.Body, indent+"    ", className, program, currentFunctionReturnType)
+	fmt.Fprintf(b, "%s    __scar_test_pass();\n", indent)
+	fmt.Fprintf(b, "%s}\n", indent)
+}
+
+func (r *Renderer) renderBench(b *strings.Builder, bench *lexer.BenchStmt, indent, className string, program *lexer.Program, currentFunctionReturnType string) {
+	if !r.opts.BenchMode {
+		return
+	}
+	start := "1"
+	if r.opts.BenchIterations > 0 {
+		start = strconv.Itoa(r.opts.BenchIterations)
+	}
+	fmt.Fprintf(b, "%sfor (long long __scar_bench_n = %s; ; __scar_bench_n *= 2) {\n", indent, start)
+	fmt.Fprintf(b, "%s    long long __scar_bench_start = __scar_bench_now();\n", indent)
+	fmt.Fprintf(b, "%s    for (long long __scar_bench_i = 0; __scar_bench_i < __scar_bench_n; __scar_bench_i++) {\n", indent)
+	r.renderStatements(b, bench.Body, indent+"        ", className, program, currentFunctionReturnType)
+	fmt.Fprintf(b, "%s    }\n", indent)
+	fmt.Fprintf(b, "%s    if (__scar_bench_report(%s, __scar_bench_n, __scar_bench_now() - __scar_bench_start, %t)) break;\n",
+		indent, cStringLiteral(bench.Name), r.opts.BenchIterations > 0)
+	fmt.Fprintf(b, "%s}\n", indent)
+}
+
+// Renders an assert! as a check of its condition and an assert_eq! as a
+// comparison chosen by the type of its left operand, so strings are compared
+// by content. An assert goes through __scar_assert_debug, which compiles to
+// nothing with the NDEBUG of release builds. Failures name the scar line
+// through __LINE__, which the #line directives map to the source.
+func (r *Renderer) renderAssert(b *strings.Builder, assert *lexer.AssertStmt, indent string, program *lexer.Program) {
+	if assert.DebugOnly {
+		var (
+			source  = cStringLiteral("assert " + assert.Condition)
+			message = "NULL"
+		)
+		if assert.Message != "" {
+			message = r.renderCondition(assert.Message, program)
+		}
+		fmt.Fprintf(b, "%s__scar_assert_debug(%s, %s, %s);\n", indent, r.renderCondition(assert.Condition, program), source, message)
+		return
+	}
+	if assert.Condition != "" {
+		source := cStringLiteral("assert!(" + assert.Condition + ")")
+		fmt.Fprintf(b, "%sif (!(%s)) __scar_assert_fail(__FILE__, __LINE__, %s, \"\");\n", indent, r.renderCondition(assert.Condition, program), source)
+		return
+	}
+	var (
+		left   = r.renderCondition(assert.Left, program)
+		right  = r.renderCondition(assert.Right, program)
+		source = cStringLiteral("assert_eq!(" + assert.Left + ", " + assert.Right + ")")
+	)
+	fmt.Fprintf(b, "%s__scar_assert_eq(%s, %s, %s);\n", indent, left, right, source)
+}
@@ -0,0 +1,191 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains the rendering of spawn, join and assignments to atomic variables.
+//
+// Every function started by spawn gets a wrapper, __scar_spawn_f, taking the
+// same arguments as f. The wrapper copies them to the heap, the contents of
+// strings included, and starts a thread calling f with the copy. Threads are
+// passed around as void pointers, so the headers of modules declaring a
+// wrapper need none of the types of the thread runtime.
+
+package renderer
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+
+	"scar/lexer"
+)
+
+// Emits an assignment to an atomic variable. Updates of the form x = x op y
+// become an atomic update and plain stores an atomic write, while anything
+// reading the variable otherwise is made a critical section. Without OpenMP,
+// stores are atomic stores and updates a compare and swap loop.
+func (r *Renderer) assignAtomic(b *strings.Builder, indent, varName, value string) {
+	varRegex := regexp.MustCompile(`\b` + regexp.QuoteMeta(varName) + `\b`)
+	uses := len(varRegex.FindAllStringIndex(value, -1))
+	if r.opts.NoOpenMP {
+		if uses == 0 {
+			fmt.Fprintf(b, "%s__atomic_store_n(&%s, %s, __ATOMIC_SEQ_CST);\n", indent, varName, value)
+			return
+		}
+		fmt.Fprintf(b, "%sfor (__typeof__(%s) __scar_old = __atomic_load_n(&%s, __ATOMIC_SEQ_CST);\n", indent, varName, varName)
+		fmt.Fprintf(b, "%s     !__atomic_compare_exchange_n(&%s, &__scar_old, %s, 0, __ATOMIC_SEQ_CST, __ATOMIC_SEQ_CST);) {\n", indent, varName, varRegex.ReplaceAllString(value, "__scar_old"))
+		fmt.Fprintf(b, "%s}\n", indent)
+		return
+	}
+	pragma := "critical(__scar_atomic)"
+	if expr, err := lexer.ParseExpr(value); err == nil {
+		binary, isBinary := expr.(*lexer.BinaryExpr)
+		switch {
+		case uses == 0:
+			pragma = "atomic write"
+		case uses == 1 && isBinary && slices.Contains([]string{"+", "-", "*", "/", "&", "|", "^", "<<", ">>"}, binary.Op) &&
+			(isIdent(binary.Left, varName) || isIdent(binary.Right, varName)):
+			pragma = "atomic"
+		}
+	}
+	fmt.Fprintf(b, "%s#pragma omp %s\n", indent, pragma)
+	fmt.Fprintf(b, "%s%s = %s;\n", indent, varName, value)
+}
+
+// Reports whether expr is the variable name.
+func isIdent(expr lexer.Expr, name string) bool {
+	ident, ok := expr.(*lexer.IdentExpr)
+	return ok && ident.Name == name
+}
+
+// A field of the arguments a wrapper copies, as declared in C.
+type spawnField struct {
+	decl   string
+	name   string
+	string bool
+}
+
+func (r *Renderer) renderSpawn(b *strings.Builder, indent string, spawn *lexer.SpawnStmt, line int) {
+	name, args, _ := strings.Cut(spawn.Call, "(")
+	name = lexer.ResolveSymbol(strings.TrimSpace(name), r.currentModule)
+	funcDecl, ok := r.globalFunctions[name]
+	if !ok {
+		r.renderErrorf(line, "spawn requires a function of the program or of a module, but '%s' is not one", name)
+		return
+	}
+	r.spawnedFunctions[name] = true
+	call := fmt.Sprintf("__scar_spawn_%s(%s)", name, strings.Join(r.renderCallArgs(funcDecl, lexer.SplitArguments(strings.TrimSuffix(args, ")"))), ", "))
+	if spawn.Handle == "" {
+		fmt.Fprintf(b, "%s__scar_thread_detach(%s);\n", indent, call)
+		return
+	}
+	handle := lexer.ResolveSymbol(spawn.Handle, r.currentModule)
+	r.varTypes[handle] = "thread"
+	fmt.Fprintf(b, "%svoid* %s = %s;\n", indent, handle, call)
+}
+
+func (r *Renderer) renderJoin(b *strings.Builder, indent string, join *lexer.JoinStmt) {
+	fmt.Fprintf(b, "%s__scar_thread_join(%s);\n", indent, lexer.ResolveSymbol(join.Handle, r.currentModule))
+}
+
+// Returns the fields holding the arguments of a function on its way to the
+// thread running it, lists being held as a pointer and a length.
+func (r *Renderer) spawnFields(params []*lexer.MethodParameter) []spawnField {
+	var fields []spawnField
+	for _, param := range params {
+		if param.IsList || strings.HasPrefix(param.Type, "list[") {
+			elemType := listParamElemType(param)
+			fields = append(fields, spawnField{decl: r.listPointer(elemType, param.Name), name: param.Name})
+			if _, ok := nestedListType(elemType); ok {
+				fields = append(fields, spawnField{decl: fmt.Sprintf("int* %s_lens", param.Name), name: param.Name + "_lens"})
+			}
+			fields = append(fields, spawnField{decl: fmt.Sprintf("int %s_len", param.Name), name: param.Name + "_len"})
+			continue
+		}
+		fields = append(fields, spawnField{decl: r.functionParamType(param) + " " + param.Name, name: param.Name, string: param.Type == "string" && !param.IsRef})
+	}
+	return fields
+}
+
+// Emits the wrappers of the functions started by spawn, declaring each along
+// with the function it starts and defining it in the same section.
+func (r *Renderer) writeSpawnWrappers(p *renderedProgram, functionModules map[string]string) {
+	for _, name := range slices.Sorted(maps.Keys(r.spawnedFunctions)) {
+		funcDecl := r.globalFunctions[name]
+		module := functionModules[name]
+		fields := r.spawnFields(funcDecl.Parameters)
+		decls := make([]string, len(fields))
+		for i, field := range fields {
+			decls[i] = field.decl
+		}
+		params := strings.Join(decls, ", ")
+		if params == "" {
+			params = "void"
+		}
+		prototype := fmt.Sprintf("void* __scar_spawn_%s(%s)", name, params)
+		if module == "" {
+			fmt.Fprintf(&p.prototypes, "%s;\n", prototype)
+		} else {
+			fmt.Fprintf(p.section(p.headers, module), "%s;\n", prototype)
+		}
+
+		b := p.section(p.definitions, module)
+		args := "__scar_spawn_" + name + "_args"
+		fmt.Fprintf(b, "\ntypedef struct {\n")
+		for _, field := range fields {
+			fmt.Fprintf(b, "    %s;\n", field.decl)
+		}
+		if len(fields) == 0 {
+			b.WriteString("    char unused;\n")
+		}
+		fmt.Fprintf(b, "} %s;\n", args)
+
+		fmt.Fprintf(b, "static void %s_free(%s* args) {\n", args, args)
+		for _, field := range fields {
+			if field.string {
+				fmt.Fprintf(b, "    free(args->%s);\n", field.name)
+			}
+		}
+		b.WriteString("    free(args);\n}\n")
+
+		var (
+			callArgs []string
+			call     = "%s(%s)"
+		)
+		fmt.Fprintf(b, "static __SCAR_THREAD_FN(__scar_spawn_%s_run) {\n", name)
+		fmt.Fprintf(b, "    %s* args = __arg;\n", args)
+		switch returnType := funcDecl.ReturnType; {
+		case returnType == "list[string]":
+			b.WriteString("    char output[256][256];\n")
+			callArgs = append(callArgs, "output", "256")
+		case strings.HasPrefix(returnType, "list["):
+			elemType := strings.TrimSuffix(strings.TrimPrefix(returnType, "list["), "]")
+			fmt.Fprintf(b, "    %s output[256];\n", r.mapTypeToCType(elemType))
+			callArgs = append(callArgs, "output", "256")
+		case returnType == "string":
+			call = "free(%s(%s))"
+		}
+		for _, field := range fields {
+			callArgs = append(callArgs, "args->"+field.name)
+		}
+		fmt.Fprintf(b, "    "+call+";\n", name, strings.Join(callArgs, ", "))
+		fmt.Fprintf(b, "    %s_free(args);\n", args)
+		b.WriteString("    return __SCAR_THREAD_RETURN;\n}\n")
+
+		fmt.Fprintf(b, "%s {\n", prototype)
+		fmt.Fprintf(b, "    %s* args = malloc(sizeof(%s));\n", args, args)
+		b.WriteString("    if (!args) return NULL;\n")
+		for _, field := range fields {
+			if field.string {
+				fmt.Fprintf(b, "    args->%s = strdup(%s);\n", field.name, field.name)
+			} else {
+				fmt.Fprintf(b, "    args->%s = %s;\n", field.name, field.name)
+			}
+		}
+		fmt.Fprintf(b, "    void* thread = __scar_thread_start(__scar_spawn_%s_run, args);\n", name)
+		fmt.Fprintf(b, "    if (!thread) %s_free(args);\n", args)
+		b.WriteString("    return thread;\n}\n")
+	}
+}
@@ -0,0 +1,35 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains the rendering of the UTF-8 aware string operations.
+//
+// Strings are UTF-8 text stored as bytes, so len(s) and s[i] count and index
+// bytes. ulen(s) counts the code points of s instead, and a foreach over a
+// string with a string variable walks its code points, binding each to a small
+// buffer holding its bytes, where a char variable walks its bytes.
+
+package renderer
+
+import (
+	"fmt"
+	"strings"
+
+	"scar/lexer"
+)
+
+// Renders ulen(s) inside expressions.
+func (r *Renderer) renderUlen(name string, args []lexer.Expr) (string, bool) {
+	if _, userDefined := r.globalFunctions[name]; userDefined || name != "ulen" || len(args) != 1 {
+		return "", false
+	}
+	return fmt.Sprintf("__scar_utf8_len(%s)", r.renderExpr(args[0])), true
+}
+
+// Emits a foreach over the code points of a string, leaving its body and
+// closing brace to the caller.
+func renderCodePointForeach(b *strings.Builder, indent, str, varName string) {
+	fmt.Fprintf(b, "%sfor (int __i = 0, __n; (__n = __scar_utf8_size(%s + __i)) > 0; __i += __n) {\n", indent, str)
+	fmt.Fprintf(b, "%s    char %s[5] = {0};\n", indent, varName)
+	fmt.Fprintf(b, "%s    memcpy(%s, %s + __i, __n);\n", indent, varName, str)
+}
@@ -0,0 +1,101 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains the rendering of a program as separately compiled units.
+//
+// A program is rendered into sections: the types, constants and class
+// declarations every unit needs, the declarations of each module and the
+// definitions of each module and of the program itself. RenderC joins them
+// into a single translation unit, while RenderUnits gives every module a .c
+// file holding its definitions and a .h file holding its declarations, so a
+// module is only compiled again when its own code or a declaration it uses
+// changes.
+
+package renderer
+
+import (
+	"fmt"
+	"strings"
+
+	"scar/lexer"
+)
+
+// A translation unit of a program compiled module by module. The unit of the
+// program itself has no module and no header.
+type Unit struct {
+	Module string
+	Header string
+	Source string
+}
+
+// The rendered sections of a program. Headers and definitions are keyed by
+// module, the definitions of the program itself being those of "".
+type renderedProgram struct {
+	head        strings.Builder
+	types       strings.Builder
+	prototypes  strings.Builder
+	adapters    strings.Builder
+	headers     map[string]*strings.Builder
+	definitions map[string]*strings.Builder
+}
+
+// Returns the section of a module, creating it when it is empty.
+func (p *renderedProgram) section(sections map[string]*strings.Builder, module string) *strings.Builder {
+	if sections[module] == nil {
+		sections[module] = &strings.Builder{}
+	}
+	return sections[module]
+}
+
+// Emits argc and argv, which the unit of the program defines and the units
+// of its modules declare.
+func writeArgGlobals(b *strings.Builder, external bool) {
+	if external {
+		b.WriteString("extern int __global_argc;\nextern char** __global_argv;\n\n")
+		return
+	}
+	b.WriteString("int __global_argc = 0;\nchar** __global_argv = NULL;\n\n")
+}
+
+// Returns the name of the header declaring the symbols of a module.
+func HeaderName(module string) string {
+	return module + ".h"
+}
+
+// Renders a program as a unit per loaded module followed by the unit of the
+// program itself. Every unit includes the headers of all modules, as a module
+// may use the symbols of the modules it imports.
+func (r *Renderer) RenderUnits(program *lexer.Program, baseDir string) []Unit {
+	var (
+		p        = r.renderProgram(program, baseDir)
+		modules  = lexer.SortedModules()
+		includes strings.Builder
+		units    []Unit
+	)
+	for _, module := range modules {
+		fmt.Fprintf(&includes, "#include \"%s\"\n", HeaderName(module.Name))
+	}
+	includes.WriteString("\n")
+
+	unitSource := func(module string, prototypes string) string {
+		var b strings.Builder
+		b.WriteString(p.head.String())
+		writeArgGlobals(&b, module != "")
+		b.WriteString(p.types.String())
+		b.WriteString(includes.String())
+		b.WriteString(prototypes)
+		b.WriteString(p.adapters.String())
+		b.WriteString(p.section(p.definitions, module).String())
+		return b.String()
+	}
+	for _, module := range modules {
+		guard := fmt.Sprintf("SCAR_MODULE_%s_H", strings.ToUpper(module.Name))
+		units = append(units, Unit{
+			Module: module.Name,
+			Header: fmt.Sprintf("#ifndef %s\n#define %s\n\n%s\n#endif\n", guard, guard, p.section(p.headers, module.Name)),
+			Source: unitSource(module.Name, ""),
+		})
+	}
+	return append(units, Unit{Source: unitSource("", p.prototypes.String())})
+}
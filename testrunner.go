@@ -0,0 +1,120 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains scar test and scar bench, which find the test files of a directory
+// tree and run each of them.
+//
+// A test file is a program named like math_test.scar. scar test builds it
+// with its test blocks and runs it like scar run -test does, printing a line
+// for each test and a summary, and exiting non-zero when a test failed. scar
+// bench builds it with its bench blocks instead, like scar run -bench.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// The suffix of the names of test files.
+const testFileSuffix = "_test.scar"
+
+// Returns the test files at the given paths, which are test files or the
+// directories they are looked for in.
+func findTestFiles(paths []string) ([]string, error) {
+	return findFiles(paths, testFileSuffix)
+}
+
+// Returns the files with names ending in suffix at the given paths, which
+// are such files or the directories they are looked for in. Dependencies and
+// the build cache are not searched.
+func findFiles(paths []string, suffix string) ([]string, error) {
+	var files []string
+	for _, root := range paths {
+		info, err := os.Stat(root)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, root)
+			continue
+		}
+		err = filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if entry.IsDir() && path != root && (entry.Name() == "deps" || entry.Name() == cacheDirName || strings.HasPrefix(entry.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			if !entry.IsDir() && strings.HasSuffix(entry.Name(), suffix) {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	slices.Sort(files)
+	return slices.Compact(files), nil
+}
+
+// Builds and runs the test files at the given paths, or under the working
+// directory when none are given, in test or bench mode and with the flags scar
+// test or scar bench was given. Returns the exit code of the command, which is
+// 1 when a test file failed to build or to run, such as on a failing test.
+func runTests(paths []string, mode string) int {
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	files, err := findTestFiles(paths)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if len(files) == 0 {
+		fmt.Fprintf(os.Stderr, "no %s files found\n", "*"+testFileSuffix)
+		return 1
+	}
+
+	scar, err := os.Executable()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to find the scar executable: %v\n", err)
+		return 1
+	}
+	args := []string{"run", "-" + mode}
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name != mode {
+			args = append(args, "-"+f.Name+"="+f.Value.String())
+		}
+	})
+
+	wd, _ := os.Getwd()
+	var failed []string
+	for _, file := range files {
+		// scar run takes programs relative to the working directory.
+		if rel, err := filepath.Rel(wd, file); err == nil && filepath.IsAbs(file) {
+			file = rel
+		}
+		fmt.Printf("=== %s\n", file)
+		if runBinary(scar, append(args, strings.TrimSuffix(file, ".scar"))) != 0 {
+			failed = append(failed, file)
+		}
+	}
+
+	fmt.Println()
+	for _, file := range failed {
+		fmt.Printf("FAIL %s\n", file)
+	}
+	fmt.Printf("%d test files: %d passed, %d failed\n", len(files), len(files)-len(failed), len(failed))
+	if len(failed) > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestFindTestFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"math_test.scar",
+		"main.scar",
+		"lib/strings_test.scar",
+		"lib/strings.scar",
+		"deps/other/other_test.scar",
+		cacheDirName + "/cached_test.scar",
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := findTestFiles([]string{dir, filepath.Join(dir, "math_test.scar")})
+	if err != nil {
+		t.Fatalf("findTestFiles failed: %v", err)
+	}
+	expected := []string{filepath.Join(dir, "lib/strings_test.scar"), filepath.Join(dir, "math_test.scar")}
+	if !slices.Equal(files, expected) {
+		t.Errorf("expected %v, got %v", expected, files)
+	}
+}
@@ -0,0 +1,150 @@
+// By Navid M (c)
+// Date: 2025
+// License: GPL3
+//
+// Contains scar watch, which rebuilds a program whenever it or one of the
+// modules it imports changes.
+//
+// Each build runs scar again with the flags scar watch was given, so its
+// diagnostics are printed like those of any build. With -run, the program is
+// run after each build, and a change made while it runs is built once it
+// exits.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"scar/lexer"
+	"scar/preprocessor"
+)
+
+// How long to wait for further changes after a change, as editors often save
+// a file in several writes.
+const watchDebounce = 100 * time.Millisecond
+
+// Returns the scar files a program is built from: the program itself and the
+// modules it imports, std modules excluded. Modules that cannot be loaded,
+// such as one that does not parse, are left out.
+func watchedFiles(program string) []string {
+	files := []string{program}
+	data, err := os.ReadFile(program)
+	if err != nil {
+		return files
+	}
+	parsed, err := lexer.ParseWithIndentation(preprocessor.ProcessSourceLevelMacros(string(data)))
+	if err != nil {
+		return files
+	}
+	clear(lexer.LoadedModules)
+	for _, imp := range parsed.Imports {
+		lexer.LoadModule(imp.Module, filepath.Dir(program))
+	}
+	for _, module := range lexer.LoadedModules {
+		if path, err := filepath.Abs(module.FilePath); err == nil && !module.Std {
+			files = append(files, path)
+		}
+	}
+	slices.Sort(files[1:])
+	return files
+}
+
+// Builds the program, and with run runs it with args, each time it or a
+// module it imports changes, until interrupted. Returns the exit code of the
+// command, which is 1 when the files could not be watched.
+func watchProgram(program string, args []string, run bool) int {
+	scar, err := os.Executable()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to find the scar executable: %v\n", err)
+		return 1
+	}
+	program = strings.TrimSuffix(program, ".scar")
+	source, err := filepath.Abs(program + ".scar")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	var buildArgs []string
+	if run {
+		buildArgs = append(buildArgs, "run")
+	}
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name != "run" {
+			buildArgs = append(buildArgs, "-"+f.Name+"="+f.Value.String())
+		}
+	})
+	buildArgs = append(buildArgs, program)
+	if run && len(args) > 0 {
+		buildArgs = append(append(buildArgs, "--"), args...)
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to watch files: %v\n", err)
+		return 1
+	}
+	defer watcher.Close()
+
+	// Files are watched through their directories, as editors may save a
+	// file by replacing it. Modules stay watched once seen, so one that fails
+	// to load is still rebuilt when it is fixed.
+	watched := make(map[string]bool)
+	build := func() {
+		for _, file := range watchedFiles(source) {
+			if watched[file] {
+				continue
+			}
+			watched[file] = true
+			if err := watcher.Add(filepath.Dir(file)); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to watch %s: %v\n", file, err)
+			}
+		}
+		start := time.Now()
+		fmt.Printf("[watch] building %s\n", filepath.Base(source))
+		if code := runBinary(scar, buildArgs); code == 0 {
+			fmt.Printf("[watch] done in %s\n", time.Since(start).Round(time.Millisecond))
+		} else {
+			fmt.Printf("[watch] failed with exit code %d\n", code)
+		}
+		fmt.Printf("[watch] watching %d files for changes\n", len(watched))
+	}
+
+	build()
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return 0
+			}
+			if !watched[event.Name] || event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) == 0 {
+				continue
+			}
+			// Further changes while waiting are part of this one.
+			settled := time.After(watchDebounce)
+		wait:
+			for {
+				select {
+				case <-watcher.Events:
+				case <-settled:
+					break wait
+				}
+			}
+			fmt.Printf("[watch] %s changed\n", filepath.Base(event.Name))
+			build()
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return 0
+			}
+			fmt.Fprintf(os.Stderr, "[watch] %v\n", err)
+		}
+	}
+}
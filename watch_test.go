@@ -0,0 +1,28 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestWatchedFiles(t *testing.T) {
+	dir := t.TempDir()
+	for name, source := range map[string]string{
+		"main.scar":   "import \"util\"\nint x = util::twice(2)\nprint \"{x}\"\n",
+		"util.scar":   "import \"helper\"\npub fn twice(int n) -> int:\n    return helper::add(n, n)\n",
+		"helper.scar": "pub fn add(int a, int b) -> int:\n    return a + b\n",
+		"other.scar":  "print \"unrelated\"\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(source), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files := watchedFiles(filepath.Join(dir, "main.scar"))
+	expected := []string{filepath.Join(dir, "main.scar"), filepath.Join(dir, "helper.scar"), filepath.Join(dir, "util.scar")}
+	if !slices.Equal(files, expected) {
+		t.Errorf("expected %v, got %v", expected, files)
+	}
+}